@@ -0,0 +1,33 @@
+package bindings
+
+import "github.com/MJE43/stake-pf-replay-go/internal/store"
+
+// AnnotateRun sets the name, notes, tags and starred flag of a run and
+// returns the updated run. Tags are lowercased and deduplicated.
+func (a *App) AnnotateRun(runID string, annotation store.Annotation) (*store.Run, error) {
+	if err := a.db.AnnotateRun(runID, annotation); err != nil {
+		return nil, err
+	}
+	return a.db.GetRun(runID)
+}
+
+// AnnotateHit sets the annotation of the hit at nonce in a run. An empty
+// annotation removes it.
+func (a *App) AnnotateHit(runID string, nonce uint64, annotation store.Annotation) error {
+	return a.db.AnnotateHit(runID, nonce, annotation)
+}
+
+// GetHitAnnotations returns the annotated hits of a run in nonce order.
+func (a *App) GetHitAnnotations(runID string) ([]store.HitAnnotation, error) {
+	return a.db.ListHitAnnotations(runID, "")
+}
+
+// FindTaggedHits returns annotated hits carrying tag across all runs.
+func (a *App) FindTaggedHits(tag string) ([]store.HitAnnotation, error) {
+	return a.db.ListHitAnnotations("", tag)
+}
+
+// ListTags returns every tag in use with its run and hit counts.
+func (a *App) ListTags() ([]store.TagCount, error) {
+	return a.db.ListTags()
+}
@@ -6,9 +6,12 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log"
 	"strconv"
+	"strings"
 
 	"github.com/MJE43/stake-pf-replay-go/internal/games"
+	"github.com/MJE43/stake-pf-replay-go/internal/repro"
 	"github.com/MJE43/stake-pf-replay-go/internal/scan"
 	"github.com/MJE43/stake-pf-replay-go/internal/store"
 )
@@ -46,6 +49,7 @@ type ScanResult struct {
 	Echo           ScanRequest
 	TimedOut       bool
 	ServerSeedHash string
+	Warnings       []string
 }
 
 type SeedGroupSeeds struct {
@@ -59,12 +63,9 @@ type SeedRunGroup struct {
 	Runs  []store.Run    `json:"runs"`
 }
 
-// RunsQuery represents query parameters for listing runs
-type RunsQuery struct {
-	Game    string `json:"game,omitempty"`
-	Page    int    `json:"page"`
-	PerPage int    `json:"perPage"`
-}
+// RunsQuery represents query parameters for listing runs. It shares its
+// filters with the HTTP runs endpoint.
+type RunsQuery store.RunsQuery
 
 // RunsList represents paginated runs response
 type RunsList struct {
@@ -88,12 +89,46 @@ func (a *App) GetGames() ([]games.GameSpec, error) {
 	return games.ListGames(), nil
 }
 
+// PumpHitProbability is the exact chance a Pump round at difficulty pays
+// at least threshold. The live streams module uses it for tier cadences.
+func PumpHitProbability(difficulty string, threshold float64) (float64, error) {
+	return games.PumpHitProbability(difficulty, threshold)
+}
+
+// EvaluateMetric replays one nonce of a game and returns its metric. The
+// live streams module uses it to fill in rounds its ingest missed.
+func EvaluateMetric(game, serverSeed, clientSeed string, nonce uint64, params map[string]any) (float64, error) {
+	g, ok := games.GetGame(game)
+	if !ok {
+		return 0, fmt.Errorf("unknown game: %s", game)
+	}
+	result, err := g.Evaluate(games.Seeds{Server: serverSeed, Client: clientSeed}, nonce, params)
+	if err != nil {
+		return 0, err
+	}
+	return result.Metric, nil
+}
+
+// HasGame reports whether id is a registered game, built in or custom.
+func HasGame(id string) bool {
+	_, ok := games.GetGame(id)
+	return ok
+}
+
+// ValidateGameParams checks params against a game's parameter handling,
+// see games.ValidateParams. Live ingest uses it for bet details.
+func ValidateGameParams(game string, params map[string]any) error {
+	return games.ValidateParams(game, params)
+}
+
 func (a *App) HashServerSeed(server string) (string, error) {
 	h := sha256.Sum256([]byte(server))
 	return hex.EncodeToString(h[:]), nil
 }
 
-func (a *App) StartScan(req ScanRequest) (ScanResult, error) {
+// parseScanRequest converts the loosely typed frontend request into a
+// scan.ScanRequest.
+func parseScanRequest(req ScanRequest) (scan.ScanRequest, error) {
 	// Convert NonceStart to uint64 if it's a string
 	var nonceStart uint64
 	switch v := req.NonceStart.(type) {
@@ -105,10 +140,10 @@ func (a *App) StartScan(req ScanRequest) (ScanResult, error) {
 		var err error
 		nonceStart, err = strconv.ParseUint(v, 10, 64)
 		if err != nil {
-			return ScanResult{}, fmt.Errorf("invalid nonce start: %v", v)
+			return scan.ScanRequest{}, fmt.Errorf("invalid nonce start: %v", v)
 		}
 	default:
-		return ScanResult{}, fmt.Errorf("nonce start must be a number or string, got %T", v)
+		return scan.ScanRequest{}, fmt.Errorf("nonce start must be a number or string, got %T", v)
 	}
 
 	// Convert NonceEnd to uint64 if it's a string
@@ -122,10 +157,10 @@ func (a *App) StartScan(req ScanRequest) (ScanResult, error) {
 		var err error
 		nonceEnd, err = strconv.ParseUint(v, 10, 64)
 		if err != nil {
-			return ScanResult{}, fmt.Errorf("invalid nonce end: %v", v)
+			return scan.ScanRequest{}, fmt.Errorf("invalid nonce end: %v", v)
 		}
 	default:
-		return ScanResult{}, fmt.Errorf("nonce end must be a number or string, got %T", v)
+		return scan.ScanRequest{}, fmt.Errorf("nonce end must be a number or string, got %T", v)
 	}
 
 	// Convert TargetOp to string if needed
@@ -136,7 +171,7 @@ func (a *App) StartScan(req ScanRequest) (ScanResult, error) {
 	case TargetOp:
 		targetOp = string(v)
 	default:
-		return ScanResult{}, fmt.Errorf("target op must be a string, got %T", v)
+		return scan.ScanRequest{}, fmt.Errorf("target op must be a string, got %T", v)
 	}
 
 	// Convert TargetVal to float64 if it's a string
@@ -144,16 +179,43 @@ func (a *App) StartScan(req ScanRequest) (ScanResult, error) {
 	switch v := req.TargetVal.(type) {
 	case float64:
 		targetVal = v
+	case nil:
+		// Top/bottom scans rank outcomes instead of matching a target
+		if !scan.TargetOp(targetOp).IsRanked() {
+			return scan.ScanRequest{}, fmt.Errorf("target value is required for %q", targetOp)
+		}
 	case string:
 		var err error
 		targetVal, err = strconv.ParseFloat(v, 64)
 		if err != nil {
-			return ScanResult{}, fmt.Errorf("invalid target value: %v", v)
+			return scan.ScanRequest{}, fmt.Errorf("invalid target value: %v", v)
 		}
 	default:
-		return ScanResult{}, fmt.Errorf("target value must be a number or string, got %T", v)
+		return scan.ScanRequest{}, fmt.Errorf("target value must be a number or string, got %T", v)
 	}
 
+	return scan.ScanRequest{
+		Game:       req.Game,
+		Seeds:      games.Seeds{Server: req.Seeds.Server, Client: req.Seeds.Client},
+		NonceStart: nonceStart,
+		NonceEnd:   nonceEnd,
+		Params:     req.Params,
+		TargetOp:   scan.TargetOp(targetOp),
+		TargetVal:  targetVal,
+		Tolerance:  req.Tolerance,
+		Limit:      req.Limit,
+		TimeoutMs:  req.TimeoutMs,
+	}, nil
+}
+
+func (a *App) StartScan(req ScanRequest) (ScanResult, error) {
+	parsed, err := parseScanRequest(req)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	nonceStart, nonceEnd := parsed.NonceStart, parsed.NonceEnd
+	targetOp, targetVal := string(parsed.TargetOp), parsed.TargetVal
+
 	// Create a cancellable context for this scan
 	scanCtx, cancel := context.WithCancel(context.Background())
 
@@ -180,7 +242,17 @@ func (a *App) StartScan(req ScanRequest) (ScanResult, error) {
 		TargetVal:      targetVal,
 		Tolerance:      req.Tolerance,
 		HitLimit:       req.Limit,
-		EngineVersion:  "v1.0.0", // TODO: Get from version package
+		EngineVersion:  scan.EngineVersion,
+	}
+	if manifest, err := repro.New(parsed); err == nil {
+		run.Manifest = manifest.String()
+	}
+
+	var warnings []string
+	if msg, hash, custom := customGameWarning(req.Game); custom {
+		log.Printf("scan: %s", msg)
+		warnings = append(warnings, msg)
+		run.EngineVersion += "+custom." + hash
 	}
 
 	if err := a.db.SaveRun(run); err != nil {
@@ -201,19 +273,8 @@ func (a *App) StartScan(req ScanRequest) (ScanResult, error) {
 		cancel()
 	}()
 
-	s := scan.NewScanner()
-	res, err := s.Scan(scanCtx, scan.ScanRequest{
-		Game:       req.Game,
-		Seeds:      games.Seeds{Server: req.Seeds.Server, Client: req.Seeds.Client},
-		NonceStart: nonceStart,
-		NonceEnd:   nonceEnd,
-		Params:     req.Params,
-		TargetOp:   scan.TargetOp(targetOp),
-		TargetVal:  targetVal,
-		Tolerance:  req.Tolerance,
-		Limit:      req.Limit,
-		TimeoutMs:  req.TimeoutMs,
-	})
+	s := scan.NewScanner().WithCache(a.metricCache).WithBudget(a.scanBudget)
+	res, err := s.Scan(scanCtx, parsed)
 	if err != nil {
 		return ScanResult{}, err
 	}
@@ -235,6 +296,7 @@ func (a *App) StartScan(req ScanRequest) (ScanResult, error) {
 		return ScanResult{}, err
 	}
 
+	ranked := scan.TargetOp(targetOp).IsRanked()
 	dbHits := make([]store.Hit, len(res.Hits))
 	for i, h := range res.Hits {
 		dbHits[i] = store.Hit{
@@ -242,6 +304,10 @@ func (a *App) StartScan(req ScanRequest) (ScanResult, error) {
 			Nonce:  h.Nonce,
 			Metric: h.Metric,
 		}
+		if ranked {
+			rank := i + 1
+			dbHits[i].Rank = &rank
+		}
 	}
 
 	if err := a.db.SaveHits(run.ID, dbHits); err != nil {
@@ -274,6 +340,7 @@ func (a *App) StartScan(req ScanRequest) (ScanResult, error) {
 		Echo:           echoReq,
 		TimedOut:       res.Summary.TimedOut,
 		ServerSeedHash: serverHash,
+		Warnings:       warnings,
 	}, nil
 }
 
@@ -325,15 +392,9 @@ func (a *App) GetRunHits(runID string, page, perPage int) (*HitsPage, error) {
 	}, nil
 }
 
-// ListRuns retrieves runs with pagination and game-based filtering
+// ListRuns retrieves runs with pagination, filtering and sorting
 func (a *App) ListRuns(query RunsQuery) (*RunsList, error) {
-	storeQuery := store.RunsQuery{
-		Game:    query.Game,
-		Page:    query.Page,
-		PerPage: query.PerPage,
-	}
-
-	runsList, err := a.db.ListRuns(storeQuery)
+	runsList, err := a.db.ListRuns(store.RunsQuery(query))
 	if err != nil {
 		return nil, err
 	}
@@ -510,16 +571,29 @@ func (a *App) ExportRunCSV(runID string) (string, error) {
 		return "", fmt.Errorf("failed to fetch hits: %w", err)
 	}
 
+	// Hit annotations are exported alongside so tags and notes travel with the file
+	annotations, err := a.db.ListHitAnnotations(runID, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch hit annotations: %w", err)
+	}
+	byNonce := make(map[uint64]store.HitAnnotation, len(annotations))
+	for _, ha := range annotations {
+		byNonce[ha.Nonce] = ha
+	}
+
 	var csv string
-	csv += "nonce,metric,details,delta_nonce\n"
+	csv += "nonce,metric,details,delta_nonce,name,tags,notes,starred\n"
 	for _, h := range hitsPage.Hits {
 		delta := ""
 		if h.DeltaNonce != nil {
 			delta = strconv.FormatUint(*h.DeltaNonce, 10)
 		}
-		csv += fmt.Sprintf("%d,%f,%s,%s\n",
+		ha := byNonce[h.Nonce]
+		csv += fmt.Sprintf("%d,%f,%s,%s,%s,%s,%s,%t\n",
 			h.Nonce, h.Metric,
-			escapeCSV(h.Details), delta)
+			escapeCSV(h.Details), delta,
+			escapeCSV(ha.Name), escapeCSV(strings.Join(ha.Tags, ",")), escapeCSV(ha.Notes),
+			ha.Starred)
 	}
 
 	_ = run // Used for context in future enhancements (header with seed info)
@@ -0,0 +1,121 @@
+package bindings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/archive"
+)
+
+// Archive types, re-exported so modules outside this one (the live
+// streams module) can add their own sections.
+type (
+	ArchiveSection   = archive.Section
+	ArchiveWriter    = archive.Writer
+	ArchiveReader    = archive.Reader
+	ArchiveStats     = archive.Stats
+	ArchiveSelection = archive.Selection
+	ArchiveManifest  = archive.Manifest
+	ArchiveReport    = archive.Report
+)
+
+// EachArchiveRecord decodes the records of an archive file, see archive.Each
+func EachArchiveRecord[T any](r *ArchiveReader, name string, fn func(T) error) error {
+	return archive.Each(r, name, fn)
+}
+
+// ArchiveModule exports and imports portable archives spanning runs, live
+// streams and script sessions.
+type ArchiveModule struct {
+	ctx      context.Context
+	sections []ArchiveSection
+}
+
+// NewArchiveModule archives the given sections. Imports run them in order.
+func NewArchiveModule(sections ...ArchiveSection) *ArchiveModule {
+	return &ArchiveModule{ctx: context.Background(), sections: sections}
+}
+
+// Startup is called by Wails on application startup.
+func (m *ArchiveModule) Startup(ctx context.Context) {
+	m.ctx = ctx
+}
+
+// ArchiveExport is the result of ExportArchive
+type ArchiveExport struct {
+	Path     string          `json:"path"`
+	Manifest ArchiveManifest `json:"manifest"`
+}
+
+// ExportArchive writes the selected runs, streams and sessions, keyed
+// "runs", "streams" and "sessions", to a zip at path. An empty path
+// writes to the temp dir. The path is returned with the manifest.
+func (m *ArchiveModule) ExportArchive(selection ArchiveSelection, path string) (ArchiveExport, error) {
+	if len(selection) == 0 {
+		return ArchiveExport{}, errors.New("nothing selected to export")
+	}
+	if path == "" {
+		path = filepath.Join(os.TempDir(), fmt.Sprintf("wen_archive_%d.zip", time.Now().UTC().UnixNano()))
+	}
+	manifest, err := archive.ExportFile(m.ctx, path, selection, m.sections...)
+	if err != nil {
+		return ArchiveExport{}, err
+	}
+	return ArchiveExport{Path: path, Manifest: manifest}, nil
+}
+
+// ImportArchive imports the archive at path. Importing the same archive
+// again adds nothing; the report counts the duplicates found.
+func (m *ArchiveModule) ImportArchive(path string) (ArchiveReport, error) {
+	return archive.ImportFile(m.ctx, path, m.sections...)
+}
+
+// lazySection builds a section when it's used, for modules whose stores
+// open at startup
+type lazySection struct {
+	name string
+	get  func() (ArchiveSection, error)
+}
+
+func (s lazySection) Name() string { return s.name }
+
+func (s lazySection) Export(ctx context.Context, w *ArchiveWriter, ids []string) error {
+	section, err := s.get()
+	if err != nil {
+		return err
+	}
+	return section.Export(ctx, w, ids)
+}
+
+func (s lazySection) Import(ctx context.Context, r *ArchiveReader) (ArchiveStats, error) {
+	section, err := s.get()
+	if err != nil {
+		return ArchiveStats{}, err
+	}
+	return section.Import(ctx, r)
+}
+
+// RunsArchive archives the app's runs with their hits and annotations.
+// It's a function rather than a method so Wails doesn't bind it.
+func RunsArchive(a *App) ArchiveSection {
+	return lazySection{name: "runs", get: func() (ArchiveSection, error) {
+		if a.db == nil {
+			return nil, errors.New("database not initialized")
+		}
+		return archive.NewRunsSection(a.db), nil
+	}}
+}
+
+// SessionsArchive archives script sessions with their bets
+func SessionsArchive(sm *ScriptModule) ArchiveSection {
+	return lazySection{name: "sessions", get: func() (ArchiveSection, error) {
+		if sm.store == nil {
+			return nil, errors.New("script store not initialized")
+		}
+		return archive.NewSessionsSection(sm.store), nil
+	}}
+}
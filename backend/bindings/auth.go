@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"path/filepath"
 
+	"github.com/MJE43/stake-pf-replay-go/internal/atrest"
 	"github.com/MJE43/stake-pf-replay-go/internal/stake"
 	"github.com/MJE43/stake-pf-replay-go/internal/stakeauth"
 )
@@ -15,7 +16,9 @@ type AuthModule struct {
 	store *stakeauth.Store
 }
 
-func NewAuthModule(dbPath, fallbackSecretsPath string) (*AuthModule, error) {
+// NewAuthModule opens the account store. Secrets that fall back to a file
+// when no OS keyring is available are sealed with vault, if it is set.
+func NewAuthModule(dbPath, fallbackSecretsPath string, vault *atrest.Vault) (*AuthModule, error) {
 	store, err := stakeauth.NewStore(dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("auth store init failed: %w", err)
@@ -26,6 +29,8 @@ func NewAuthModule(dbPath, fallbackSecretsPath string) (*AuthModule, error) {
 	}
 
 	keyringStore := stakeauth.NewKeyringStore("wen-desktop", fallbackSecretsPath)
+	keyringStore.SetCipher(vault.Cipher())
+	vault.Register("auth secrets", keyringStore.ResealFallback)
 	mod := stakeauth.NewModule(store, keyringStore)
 	return &AuthModule{
 		inner: mod,
@@ -0,0 +1,310 @@
+package bindings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+	"github.com/MJE43/stake-pf-replay-go/internal/repro"
+	"github.com/MJE43/stake-pf-replay-go/internal/scan"
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+)
+
+// BatchSeed is one revealed seed pair in a batch scan
+type BatchSeed struct {
+	Server     string
+	Client     string
+	NonceStart interface{} // Accept both string and uint64
+	NonceEnd   interface{} // Accept both string and uint64
+}
+
+// BatchScanRequest applies one target to many seed pairs. Limit applies to
+// each seed pair.
+type BatchScanRequest struct {
+	Game      string
+	Seeds     []BatchSeed
+	Params    map[string]any
+	TargetOp  string
+	TargetVal float64
+	Tolerance float64
+	Limit     int
+	TimeoutMs int
+}
+
+// BatchScanResult holds the parent run and one child result per seed pair
+type BatchScanResult struct {
+	ParentRunID string
+	Runs        []ScanResult
+	Summary     Summary
+	TimedOut    bool
+	Warnings    []string
+}
+
+// StartBatchScan scans every seed pair on one shared worker pool. It saves a
+// parent run covering the batch and a child run per seed pair; child runs
+// keep their own server_seed_hash, so GetSeedRuns lists them alongside
+// single-seed runs of the same seeds.
+func (a *App) StartBatchScan(req BatchScanRequest) (BatchScanResult, error) {
+	if len(req.Seeds) == 0 {
+		return BatchScanResult{}, fmt.Errorf("batch scan needs at least one seed pair")
+	}
+	// Validate before the parent run is saved so a bad request can't leave
+	// an orphan parent behind.
+	if err := validateBatchRequest(req); err != nil {
+		return BatchScanResult{}, err
+	}
+
+	ranges := make([]scan.SeedRange, len(req.Seeds))
+	for i, s := range req.Seeds {
+		start, err := parseNonceArg(s.NonceStart)
+		if err != nil {
+			return BatchScanResult{}, fmt.Errorf("seed pair %d: nonce start: %w", i, err)
+		}
+		end, err := parseNonceArg(s.NonceEnd)
+		if err != nil {
+			return BatchScanResult{}, fmt.Errorf("seed pair %d: nonce end: %w", i, err)
+		}
+		if end < start {
+			return BatchScanResult{}, fmt.Errorf("seed pair %d: nonce end %d is before nonce start %d", i, end, start)
+		}
+		ranges[i] = scan.SeedRange{
+			Seeds:      games.Seeds{Server: s.Server, Client: s.Client},
+			NonceStart: start,
+			NonceEnd:   end,
+		}
+	}
+
+	paramsJSON := "{}"
+	if req.Params != nil {
+		if jsonBytes, err := json.Marshal(req.Params); err == nil {
+			paramsJSON = string(jsonBytes)
+		}
+	}
+
+	parent := &store.Run{
+		Game:          req.Game,
+		NonceStart:    ranges[0].NonceStart,
+		NonceEnd:      ranges[0].NonceEnd,
+		ParamsJSON:    paramsJSON,
+		TargetOp:      req.TargetOp,
+		TargetVal:     req.TargetVal,
+		Tolerance:     req.Tolerance,
+		HitLimit:      req.Limit,
+		EngineVersion: scan.EngineVersion,
+	}
+	if manifest, err := repro.New(scan.ScanRequest{
+		Game:      req.Game,
+		Params:    req.Params,
+		TargetOp:  scan.TargetOp(req.TargetOp),
+		TargetVal: req.TargetVal,
+		Tolerance: req.Tolerance,
+		Limit:     req.Limit,
+	}); err == nil {
+		parent.Manifest = manifest.String()
+	}
+	for _, r := range ranges[1:] {
+		parent.NonceStart = min(parent.NonceStart, r.NonceStart)
+		parent.NonceEnd = max(parent.NonceEnd, r.NonceEnd)
+	}
+
+	var warnings []string
+	if msg, hash, custom := customGameWarning(req.Game); custom {
+		log.Printf("batch scan: %s", msg)
+		warnings = append(warnings, msg)
+		parent.EngineVersion += "+custom." + hash
+	}
+
+	if err := a.db.SaveRun(parent); err != nil {
+		return BatchScanResult{}, err
+	}
+
+	scanCtx, cancel := context.WithCancel(context.Background())
+	a.runCancelsMux.Lock()
+	a.runCancels[parent.ID] = cancel
+	a.runCancelsMux.Unlock()
+	defer func() {
+		a.runCancelsMux.Lock()
+		delete(a.runCancels, parent.ID)
+		a.runCancelsMux.Unlock()
+		cancel()
+	}()
+
+	res, err := scan.NewScanner().WithBudget(a.scanBudget).ScanBatch(scanCtx, scan.BatchScanRequest{
+		Game:      req.Game,
+		Ranges:    ranges,
+		Params:    req.Params,
+		TargetOp:  scan.TargetOp(req.TargetOp),
+		TargetVal: req.TargetVal,
+		Tolerance: req.Tolerance,
+		Limit:     req.Limit,
+		TimeoutMs: req.TimeoutMs,
+	})
+	if err != nil {
+		return BatchScanResult{}, err
+	}
+
+	ranked := scan.TargetOp(req.TargetOp).IsRanked()
+	out := BatchScanResult{
+		ParentRunID: parent.ID,
+		Runs:        make([]ScanResult, len(res.Results)),
+		TimedOut:    res.Summary.TimedOut,
+		Warnings:    warnings,
+	}
+	var parentSum float64
+	for i, child := range res.Results {
+		serverHash, _ := a.HashServerSeed(ranges[i].Seeds.Server)
+		run := &store.Run{
+			Game:           req.Game,
+			ServerSeed:     ranges[i].Seeds.Server,
+			ServerSeedHash: serverHash,
+			ClientSeed:     ranges[i].Seeds.Client,
+			NonceStart:     ranges[i].NonceStart,
+			NonceEnd:       ranges[i].NonceEnd,
+			ParamsJSON:     paramsJSON,
+			TargetOp:       req.TargetOp,
+			TargetVal:      req.TargetVal,
+			Tolerance:      req.Tolerance,
+			HitLimit:       req.Limit,
+			TimedOut:       child.Summary.TimedOut,
+			HitCount:       len(child.Hits),
+			TotalEvaluated: child.Summary.TotalEvaluated,
+			EngineVersion:  parent.EngineVersion,
+			ParentRunID:    parent.ID,
+			Manifest:       parent.Manifest,
+		}
+		childSum := 0.0
+		for _, h := range child.Hits {
+			childSum += h.Metric
+		}
+		parentSum += childSum
+		setRunSummary(run, child.Summary, childSum)
+		if err := a.db.SaveRun(run); err != nil {
+			return BatchScanResult{}, err
+		}
+
+		dbHits := make([]store.Hit, len(child.Hits))
+		hits := make([]Hit, len(child.Hits))
+		for j, h := range child.Hits {
+			dbHits[j] = store.Hit{RunID: run.ID, Nonce: h.Nonce, Metric: h.Metric}
+			if ranked {
+				rank := j + 1
+				dbHits[j].Rank = &rank
+			}
+			hits[j] = Hit{Nonce: h.Nonce, Metric: h.Metric}
+		}
+		if err := a.db.SaveHits(run.ID, dbHits); err != nil {
+			return BatchScanResult{}, err
+		}
+
+		out.Runs[i] = ScanResult{
+			RunID: run.ID,
+			Hits:  hits,
+			Summary: Summary{
+				Count:          uint64(child.Summary.HitsFound),
+				Min:            child.Summary.MinMetric,
+				Max:            child.Summary.MaxMetric,
+				Sum:            childSum,
+				TotalEvaluated: child.Summary.TotalEvaluated,
+			},
+			EngineVersion: res.EngineVersion,
+			Echo: ScanRequest{
+				Game:       req.Game,
+				Seeds:      Seeds{Server: ranges[i].Seeds.Server, Client: ranges[i].Seeds.Client},
+				NonceStart: ranges[i].NonceStart,
+				NonceEnd:   ranges[i].NonceEnd,
+				Params:     req.Params,
+				TargetOp:   req.TargetOp,
+				TargetVal:  req.TargetVal,
+				Tolerance:  req.Tolerance,
+				Limit:      req.Limit,
+				TimeoutMs:  req.TimeoutMs,
+			},
+			TimedOut:       child.Summary.TimedOut,
+			ServerSeedHash: serverHash,
+		}
+	}
+
+	parent.TimedOut = res.Summary.TimedOut
+	parent.HitCount = res.Summary.HitsFound
+	parent.TotalEvaluated = res.Summary.TotalEvaluated
+	setRunSummary(parent, res.Summary, parentSum)
+	if err := a.db.UpdateRun(parent); err != nil {
+		return BatchScanResult{}, err
+	}
+
+	out.Summary = Summary{
+		Count:          uint64(res.Summary.HitsFound),
+		Min:            res.Summary.MinMetric,
+		Max:            res.Summary.MaxMetric,
+		Sum:            parentSum,
+		TotalEvaluated: res.Summary.TotalEvaluated,
+	}
+	return out, nil
+}
+
+// GetBatchRuns returns the per-seed runs of a batch scan
+func (a *App) GetBatchRuns(parentRunID string) ([]store.Run, error) {
+	return a.db.ListChildRuns(parentRunID)
+}
+
+// maxBatchLimit caps a batch scan's Limit, which every worker applies to
+// every seed pair. It matches the API's limit for a single scan.
+const maxBatchLimit = 100_000
+
+// validateBatchRequest rejects what ScanBatch would, plus params the game
+// can't evaluate and limits over maxBatchLimit.
+func validateBatchRequest(req BatchScanRequest) error {
+	if _, ok := games.GetGame(req.Game); !ok {
+		return scan.ErrGameNotFound
+	}
+	switch op := scan.TargetOp(req.TargetOp); op {
+	case scan.OpEqual, scan.OpGreater, scan.OpGreaterEqual, scan.OpLess, scan.OpLessEqual,
+		scan.OpBetween, scan.OpOutside:
+	case scan.OpTopK, scan.OpBottomK:
+		if req.Limit <= 0 {
+			return scan.ErrInvalidLimit
+		}
+	default:
+		return fmt.Errorf("invalid target op %q", req.TargetOp)
+	}
+	if req.Limit < 0 || req.Limit > maxBatchLimit {
+		return fmt.Errorf("limit must be between 0 and %d per seed pair, got %d", maxBatchLimit, req.Limit)
+	}
+	if err := games.ValidateParams(req.Game, req.Params); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+	return nil
+}
+
+// setRunSummary records hit statistics on a run. sum is the total metric of
+// the run's hits; for a batch parent it is the sum of its children.
+func setRunSummary(run *store.Run, summary scan.Summary, sum float64) {
+	if summary.HitsFound == 0 {
+		return
+	}
+	min, max := summary.MinMetric, summary.MaxMetric
+	run.SummaryMin = &min
+	run.SummaryMax = &max
+	run.SummarySum = &sum
+	run.SummaryCount = summary.HitsFound
+}
+
+func parseNonceArg(v interface{}) (uint64, error) {
+	switch n := v.(type) {
+	case uint64:
+		return n, nil
+	case float64:
+		return uint64(n), nil
+	case string:
+		parsed, err := strconv.ParseUint(n, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid nonce: %v", n)
+		}
+		return parsed, nil
+	default:
+		return 0, fmt.Errorf("must be a number or string, got %T", v)
+	}
+}
@@ -0,0 +1,20 @@
+package bindings
+
+import "errors"
+
+// GetMetricCacheSize returns the bytes used by the scan metric cache.
+func (a *App) GetMetricCacheSize() (int64, error) {
+	if a.metricCache == nil {
+		return 0, nil
+	}
+	return a.metricCache.Size()
+}
+
+// ClearMetricCache deletes all cached scan metrics. Later scans recompute
+// and cache them again.
+func (a *App) ClearMetricCache() error {
+	if a.metricCache == nil {
+		return errors.New("metric cache is not available")
+	}
+	return a.metricCache.Clear()
+}
@@ -0,0 +1,106 @@
+package bindings
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+	"github.com/MJE43/stake-pf-replay-go/internal/scripting"
+)
+
+// CustomGameInfo describes a registered custom game for the frontend.
+type CustomGameInfo struct {
+	Spec       games.GameSpec `json:"spec"`
+	SourceHash string         `json:"sourceHash"`
+}
+
+// LoadCustomGame compiles a JavaScript game definition, registers it so scans
+// and verification can use it, and saves it so it is reloaded on startup.
+func (a *App) LoadCustomGame(source string) (CustomGameInfo, error) {
+	g, err := scripting.CompileCustomGame(source)
+	if err != nil {
+		return CustomGameInfo{}, err
+	}
+	if err := games.RegisterCustomGame(g, g.SourceHash()); err != nil {
+		return CustomGameInfo{}, err
+	}
+
+	if a.customGamesDir != "" {
+		path := filepath.Join(a.customGamesDir, g.Spec().ID+".js")
+		if err := os.WriteFile(path, []byte(source), 0o600); err != nil {
+			return CustomGameInfo{}, fmt.Errorf("save custom game: %w", err)
+		}
+	}
+	return CustomGameInfo{Spec: g.Spec(), SourceHash: g.SourceHash()}, nil
+}
+
+// RemoveCustomGame unregisters a custom game and deletes its saved definition.
+func (a *App) RemoveCustomGame(id string) error {
+	if !games.UnregisterCustomGame(id) {
+		return fmt.Errorf("custom game not found: %s", id)
+	}
+	if a.customGamesDir != "" {
+		path := filepath.Join(a.customGamesDir, id+".js")
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("delete custom game: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListCustomGames returns the registered custom games.
+func (a *App) ListCustomGames() []CustomGameInfo {
+	specs := games.ListCustomGames()
+	out := make([]CustomGameInfo, len(specs))
+	for i, spec := range specs {
+		hash, _ := games.CustomGameHash(spec.ID)
+		out[i] = CustomGameInfo{Spec: spec, SourceHash: hash}
+	}
+	return out
+}
+
+// loadSavedCustomGames registers every definition in the custom games
+// directory. A broken definition is logged and skipped.
+func (a *App) loadSavedCustomGames() {
+	entries, err := os.ReadDir(a.customGamesDir)
+	if err != nil {
+		log.Printf("custom games: read dir: %v", err)
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".js") {
+			continue
+		}
+		source, err := os.ReadFile(filepath.Join(a.customGamesDir, e.Name()))
+		if err != nil {
+			log.Printf("custom games: read %s: %v", e.Name(), err)
+			continue
+		}
+		g, err := scripting.CompileCustomGame(string(source))
+		if err != nil {
+			log.Printf("custom games: %s: %v", e.Name(), err)
+			continue
+		}
+		if err := games.RegisterCustomGame(g, g.SourceHash()); err != nil {
+			log.Printf("custom games: %s: %v", e.Name(), err)
+		}
+	}
+}
+
+// customGameWarning returns a warning for runs that use a custom game, whose
+// results depend on a definition that lives outside the engine.
+func customGameWarning(game string) (string, string, bool) {
+	hash, ok := games.CustomGameHash(game)
+	if !ok {
+		return "", "", false
+	}
+	short := hash
+	if len(short) > 12 {
+		short = short[:12]
+	}
+	msg := fmt.Sprintf("%q is a custom game (definition %s); results are only reproducible with the same definition loaded", game, short)
+	return msg, short, true
+}
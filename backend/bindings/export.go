@@ -0,0 +1,113 @@
+package bindings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/export"
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+)
+
+// Export types, re-exported so the live streams module can write its bets
+// and rounds the same way runs are exported.
+type (
+	ExportFormat    = export.Format
+	ExportColumn    = export.Column
+	ExportRowWriter = export.RowWriter
+	ExportProgress  = export.Progress
+)
+
+const (
+	ExportNDJSON  = export.NDJSON
+	ExportParquet = export.Parquet
+
+	ExportInt64     = export.Int64
+	ExportFloat64   = export.Float64
+	ExportBool      = export.Bool
+	ExportString    = export.String
+	ExportJSON      = export.JSON
+	ExportTimestamp = export.Timestamp
+)
+
+// ExportProgressEvent is the Wails event file exports report progress on
+const ExportProgressEvent = "export:progress"
+
+// ParseExportFormat parses "ndjson" or "parquet", see export.ParseFormat
+func ParseExportFormat(name string) (ExportFormat, error) {
+	return export.ParseFormat(name)
+}
+
+// NewExportRowWriter writes rows in format to w, see export.NewRowWriter
+func NewExportRowWriter(w io.Writer, format ExportFormat, columns []ExportColumn) (ExportRowWriter, error) {
+	return export.NewRowWriter(w, format, columns)
+}
+
+// ExportResult is the outcome of a file export. Path is empty when the
+// save dialog was cancelled.
+type ExportResult struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Rows   int64  `json:"rows"`
+}
+
+// ExportToFile runs write into the file at path, asking where to save it
+// when path is empty. Progress goes out as ExportProgressEvent events
+// carrying the path and the rows written so far. A failed export removes
+// the partial file.
+func ExportToFile(ctx context.Context, path, defaultName string, format ExportFormat,
+	write func(io.Writer, ExportProgress) (int64, error)) (ExportResult, error) {
+	if path == "" {
+		chosen, err := runtime.SaveFileDialog(ctx, runtime.SaveDialogOptions{
+			DefaultFilename: defaultName + "." + format.Ext(),
+			Filters: []runtime.FileFilter{{
+				DisplayName: string(format),
+				Pattern:     "*." + format.Ext(),
+			}},
+		})
+		if err != nil || chosen == "" {
+			return ExportResult{}, err
+		}
+		path = chosen
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return ExportResult{}, err
+	}
+	rows, err := write(f, func(rows int64) {
+		runtime.EventsEmit(ctx, ExportProgressEvent, map[string]any{"path": path, "rows": rows})
+	})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return ExportResult{}, err
+	}
+	return ExportResult{Path: path, Format: string(format), Rows: rows}, nil
+}
+
+// ExportRunHits writes every hit of a run to an NDJSON or Parquet file,
+// with the game's details split into typed columns. An empty path opens
+// a save dialog.
+func (a *App) ExportRunHits(runID, format, path string) (ExportResult, error) {
+	if a.db == nil {
+		return ExportResult{}, errors.New("database not initialized")
+	}
+	f, err := export.ParseFormat(format)
+	if err != nil {
+		return ExportResult{}, err
+	}
+	if _, err := a.db.GetRun(runID); err != nil {
+		return ExportResult{}, fmt.Errorf("run not found: %w", err)
+	}
+	source := func(fn func(store.HitWithDelta) error) error { return a.db.EachHit(runID, fn) }
+	return ExportToFile(a.ctx, path, "run_"+runID+"_hits", f, func(w io.Writer, progress ExportProgress) (int64, error) {
+		return export.WriteHits(a.ctx, w, f, source, progress)
+	})
+}
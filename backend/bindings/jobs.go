@@ -0,0 +1,69 @@
+package bindings
+
+import (
+	"fmt"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/jobs"
+)
+
+// EnqueueScan adds a scan to the persistent job queue instead of running it
+// immediately. Higher priorities run first.
+func (a *App) EnqueueScan(req ScanRequest, priority int) (*jobs.Job, error) {
+	if a.jobs == nil {
+		return nil, fmt.Errorf("scan queue is not available")
+	}
+	parsed, err := parseScanRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return a.jobs.Enqueue(parsed, priority)
+}
+
+// ListScanJobs returns queued, running, paused and finished jobs. An empty
+// status lists every job.
+func (a *App) ListScanJobs(status string) ([]jobs.Job, error) {
+	if a.jobs == nil {
+		return nil, fmt.Errorf("scan queue is not available")
+	}
+	return a.jobs.List(jobs.Status(status))
+}
+
+// GetScanJob returns a single job with its progress.
+func (a *App) GetScanJob(id string) (*jobs.Job, error) {
+	if a.jobs == nil {
+		return nil, fmt.Errorf("scan queue is not available")
+	}
+	return a.jobs.Get(id)
+}
+
+// PauseScanJob pauses a queued or running job.
+func (a *App) PauseScanJob(id string) error {
+	if a.jobs == nil {
+		return fmt.Errorf("scan queue is not available")
+	}
+	return a.jobs.Pause(id)
+}
+
+// ResumeScanJob puts a paused job back in the queue.
+func (a *App) ResumeScanJob(id string) error {
+	if a.jobs == nil {
+		return fmt.Errorf("scan queue is not available")
+	}
+	return a.jobs.Resume(id)
+}
+
+// CancelScanJob stops a job for good.
+func (a *App) CancelScanJob(id string) error {
+	if a.jobs == nil {
+		return fmt.Errorf("scan queue is not available")
+	}
+	return a.jobs.Cancel(id)
+}
+
+// SetScanJobPriority changes the priority of an unfinished job.
+func (a *App) SetScanJobPriority(id string, priority int) error {
+	if a.jobs == nil {
+		return fmt.Errorf("scan queue is not available")
+	}
+	return a.jobs.SetPriority(id, priority)
+}
@@ -2,24 +2,42 @@ package bindings
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
 
+	"github.com/MJE43/stake-pf-replay-go/internal/atrest"
+	"github.com/MJE43/stake-pf-replay-go/internal/jobs"
+	"github.com/MJE43/stake-pf-replay-go/internal/scan"
 	"github.com/MJE43/stake-pf-replay-go/internal/store"
 )
 
 type App struct {
-	ctx           context.Context
-	db            store.DB
-	runCancels    map[string]context.CancelFunc
-	runCancelsMux sync.RWMutex
+	ctx            context.Context
+	db             store.DB
+	runCancels     map[string]context.CancelFunc
+	runCancelsMux  sync.RWMutex
+	customGamesDir string
+	jobs           *jobs.Queue
+	jobStore       *jobs.Store
+	metricCache    *scan.MetricCache
+	scanBudget     *scan.WorkerBudget // shared by every scan, queued or not
+	vault          *atrest.Vault // nil when seeds are stored unencrypted
 }
 
-func New() *App { 
+// metricCacheBytes caps the on-disk metric cache used by StartScan
+const metricCacheBytes = 1 << 30
+
+// New creates the app. Server seeds are sealed with vault, which may be
+// nil to store them unencrypted.
+func New(vault *atrest.Vault) *App {
 	return &App{
 		runCancels: make(map[string]context.CancelFunc),
-	} 
+		scanBudget: scan.NewWorkerBudget(0),
+		vault:      vault,
+	}
 }
 
 func (a *App) Startup(ctx context.Context) {
@@ -40,9 +58,62 @@ func (a *App) Startup(ctx context.Context) {
 	if err != nil {
 		panic(err)
 	}
+	db.SetCipher(a.vault.Cipher())
+	a.vault.Register("runs", db.ResealSeeds)
 	a.db = db
 
 	if err := a.db.Migrate(); err != nil {
 		panic(err)
 	}
+	// Without the key, every sealed seed would be unreadable and new ones
+	// stored in plaintext next to them
+	if a.vault == nil {
+		if n, err := db.SealedSeeds(); err != nil {
+			panic(err)
+		} else if n > 0 {
+			panic(fmt.Errorf("%d stored server seeds are encrypted but the seed key could not be opened; unlock the keyring or set %s", n, SeedPassphraseEnv))
+		}
+	}
+
+	a.customGamesDir = filepath.Join(appDir, "custom_games")
+	if err := os.MkdirAll(a.customGamesDir, 0755); err != nil {
+		panic(err)
+	}
+	a.loadSavedCustomGames()
+
+	if cache, err := scan.NewMetricCache(filepath.Join(appDir, "metric_cache"), metricCacheBytes); err != nil {
+		log.Printf("metric cache init failed (continuing without it): %v", err)
+	} else {
+		a.metricCache = cache
+	}
+
+	// The scan queue shares the runs database. Custom games are loaded
+	// first so recovered jobs can use them.
+	jobStore, err := jobs.NewStore(dbPath)
+	if err == nil {
+		err = jobStore.Migrate()
+	}
+	if err == nil {
+		jobStore.SetCipher(a.vault.Cipher())
+		queue := jobs.NewQueue(jobStore, a.db, jobs.Config{Budget: a.scanBudget})
+		if err = queue.Start(ctx); err == nil {
+			a.jobs, a.jobStore = queue, jobStore
+			a.vault.Register("scan jobs", jobStore.ResealSeeds)
+		}
+	}
+	if err != nil {
+		if jobStore != nil {
+			jobStore.Close()
+		}
+		log.Printf("scan queue init failed (continuing without it): %v", err)
+	}
+}
+
+// Shutdown stops the scan queue. Running jobs resume from their last
+// checkpoint on the next start.
+func (a *App) Shutdown() {
+	if a.jobs != nil {
+		a.jobs.Stop()
+		a.jobStore.Close()
+	}
 }
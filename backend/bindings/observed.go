@@ -0,0 +1,210 @@
+package bindings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+	"github.com/MJE43/stake-pf-replay-go/internal/repro"
+	"github.com/MJE43/stake-pf-replay-go/internal/scan"
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+)
+
+// observedBatch is how many hits of an observed run are saved at a time
+const observedBatch = 5000
+
+// ErrNoObservedRounds is returned when there are no rounds to open a run on
+var ErrNoObservedRounds = errors.New("no observed rounds")
+
+// ObservedRun describes the rounds played on a pair of seeds, such as a
+// live stream's, to open as a run.
+type ObservedRun struct {
+	Game   string
+	Seeds  Seeds
+	Params map[string]any
+	Name   string
+	Notes  string
+	Tags   []string
+}
+
+// ObservedRound is a played round and the result reported for it. Source
+// says where the result came from, e.g. a bet or a round observation.
+// Params, when set, are the params the round was played with, in place of
+// the run's.
+type ObservedRound struct {
+	Nonce    uint64
+	Observed float64
+	Source   string
+	Params   map[string]any
+}
+
+// ObservedRunResult reports a run opened on observed rounds. Mismatched
+// counts rounds whose reported result the engine didn't reproduce.
+type ObservedRunResult struct {
+	RunID      string `json:"run_id"`
+	NonceStart uint64 `json:"nonce_start"`
+	NonceEnd   uint64 `json:"nonce_end"`
+	Rounds     int    `json:"rounds"`
+	Matched    int    `json:"matched"`
+	Mismatched int    `json:"mismatched"`
+}
+
+// observedDetails are the details of each hit of an observed run
+type observedDetails struct {
+	Observed float64        `json:"observed"`
+	Source   string         `json:"source,omitempty"`
+	Match    bool           `json:"match"`
+	Params   map[string]any `json:"params,omitempty"` // when not the run's
+}
+
+// MetricsMatch compares a reported result with a computed one. Senders
+// often round or truncate results to two decimals.
+func MetricsMatch(reported, computed float64) bool {
+	diff := math.Abs(reported - computed)
+	return diff < 0.01 || diff <= 1e-6*math.Abs(computed)
+}
+
+// OpenObservedRun saves a run whose hits are exactly the rounds each
+// yields, in nonce order, over the range from the first to the last. Each
+// hit's metric is the outcome replayed from the seeds with the run's game
+// and the round's params, or the run's, and its details hold the observed
+// result, whether the two match and params other than the run's, so the usual run views, top-K and exports work on the played
+// nonces. The run is stored as a "ge" 0 scan whose manifest marks it
+// observed, so a re-run replays the played nonces and not the whole range.
+//
+// It is meant for Go callers, each being a Go callback; the live streams
+// module calls it with the rounds of a stream.
+func (a *App) OpenObservedRun(req ObservedRun, each func(yield func(ObservedRound) error) error) (ObservedRunResult, error) {
+	var res ObservedRunResult
+	g, ok := games.GetGame(req.Game)
+	if !ok {
+		return res, fmt.Errorf("unknown game: %s", req.Game)
+	}
+	params := req.Params
+	if params == nil {
+		params = map[string]any{}
+	}
+	if err := games.ValidateParams(req.Game, params); err != nil {
+		return res, err
+	}
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return res, fmt.Errorf("invalid params: %w", err)
+	}
+	serverHash, _ := a.HashServerSeed(req.Seeds.Server)
+	seeds := games.Seeds{Server: req.Seeds.Server, Client: req.Seeds.Client}
+
+	run := &store.Run{
+		Game:           req.Game,
+		ServerSeed:     req.Seeds.Server,
+		ServerSeedHash: serverHash,
+		ClientSeed:     req.Seeds.Client,
+		ParamsJSON:     string(paramsJSON),
+		TargetOp:       string(scan.OpGreaterEqual),
+		EngineVersion:  scan.EngineVersion,
+		Name:           req.Name,
+		Notes:          req.Notes,
+		Tags:           req.Tags,
+	}
+	if manifest, err := repro.New(scan.ScanRequest{
+		Game:     req.Game,
+		Params:   params,
+		TargetOp: scan.OpGreaterEqual,
+	}); err == nil {
+		manifest.Observed = true
+		run.Manifest = manifest.String()
+	}
+	if msg, hash, custom := customGameWarning(req.Game); custom {
+		log.Printf("observed run: %s", msg)
+		run.EngineVersion += "+custom." + hash
+	}
+
+	var (
+		sum   float64
+		last  uint64
+		batch = make([]store.Hit, 0, observedBatch)
+	)
+	// The run is saved with the first batch, so rounds that all fail to
+	// replay, or none at all, leave no empty run behind
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if run.ID == "" {
+			run.NonceStart, run.NonceEnd = res.NonceStart, last
+			if err := a.db.SaveRun(run); err != nil {
+				return err
+			}
+		}
+		err := a.db.SaveHits(run.ID, batch)
+		batch = batch[:0]
+		return err
+	}
+
+	err = each(func(r ObservedRound) error {
+		if res.Rounds > 0 && r.Nonce <= last {
+			return nil // rounds come in nonce order; skip repeats
+		}
+		p, own := params, r.Params != nil && !reflect.DeepEqual(r.Params, params)
+		if own {
+			if err := games.ValidateParams(req.Game, r.Params); err != nil {
+				return fmt.Errorf("nonce %d: %w", r.Nonce, err)
+			}
+			p = r.Params
+		}
+		out, err := g.Evaluate(seeds, r.Nonce, p)
+		if err != nil {
+			return fmt.Errorf("nonce %d: %w", r.Nonce, err)
+		}
+		d := observedDetails{Observed: r.Observed, Source: r.Source, Match: MetricsMatch(r.Observed, out.Metric)}
+		if own {
+			d.Params = p
+		}
+		details, _ := json.Marshal(d)
+		batch = append(batch, store.Hit{Nonce: r.Nonce, Metric: out.Metric, Details: string(details)})
+
+		if res.Rounds == 0 {
+			res.NonceStart = r.Nonce
+			run.SummaryMin, run.SummaryMax = new(float64), new(float64)
+			*run.SummaryMin, *run.SummaryMax = out.Metric, out.Metric
+		}
+		*run.SummaryMin = math.Min(*run.SummaryMin, out.Metric)
+		*run.SummaryMax = math.Max(*run.SummaryMax, out.Metric)
+		sum += out.Metric
+		last = r.Nonce
+		res.Rounds++
+		if d.Match {
+			res.Matched++
+		} else {
+			res.Mismatched++
+		}
+		if len(batch) < observedBatch {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return res, err
+	}
+	if res.Rounds == 0 {
+		return res, ErrNoObservedRounds
+	}
+
+	run.NonceEnd = last
+	run.HitCount = res.Rounds
+	run.TotalEvaluated = uint64(res.Rounds)
+	run.SummarySum = &sum
+	run.SummaryCount = res.Rounds
+	if err := a.db.UpdateRun(run); err != nil {
+		return res, err
+	}
+	res.RunID, res.NonceEnd = run.ID, last
+	return res, nil
+}
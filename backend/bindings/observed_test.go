@@ -0,0 +1,127 @@
+package bindings
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+)
+
+func newObservedApp(t *testing.T) *App {
+	t.Helper()
+	db, err := store.NewSQLiteDB(filepath.Join(t.TempDir(), "runs.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	a := New(nil)
+	a.db = db
+	return a
+}
+
+// pumpMetric is the multiplier pump gives nonce at difficulty
+func pumpMetric(t *testing.T, seeds Seeds, nonce uint64, difficulty string) float64 {
+	t.Helper()
+	g, _ := games.GetGame("pump")
+	out, err := g.Evaluate(games.Seeds{Server: seeds.Server, Client: seeds.Client}, nonce, map[string]any{"difficulty": difficulty})
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	return out.Metric
+}
+
+func TestOpenObservedRun(t *testing.T) {
+	a := newObservedApp(t)
+	seeds := Seeds{Server: "observed-server-seed", Client: "observed-client"}
+	req := ObservedRun{Game: "pump", Seeds: seeds, Params: map[string]any{"difficulty": "easy"}, Name: "observed"}
+	expert := map[string]any{"difficulty": "expert"}
+
+	rounds := []ObservedRound{
+		{Nonce: 2, Observed: pumpMetric(t, seeds, 2, "easy"), Source: "bet"},
+		// A later report of a nonce already had is skipped
+		{Nonce: 2, Observed: 999, Source: "round"},
+		{Nonce: 3, Observed: pumpMetric(t, seeds, 3, "easy") + 5, Source: "round"},
+		// Played with other params than the run's
+		{Nonce: 5, Observed: pumpMetric(t, seeds, 5, "expert"), Source: "bet", Params: expert},
+		{Nonce: 7, Observed: pumpMetric(t, seeds, 7, "easy"), Source: "bet", Params: map[string]any{"difficulty": "easy"}},
+	}
+	res, err := a.OpenObservedRun(req, func(yield func(ObservedRound) error) error {
+		for _, r := range rounds {
+			if err := yield(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("OpenObservedRun: %v", err)
+	}
+	if res.Rounds != 4 || res.Matched != 3 || res.Mismatched != 1 || res.NonceStart != 2 || res.NonceEnd != 7 {
+		t.Fatalf("expected 4 rounds over 2-7 with 3 matched, got %+v", res)
+	}
+
+	run, err := a.GetRun(res.RunID)
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if run.HitCount != 4 || run.TotalEvaluated != 4 || run.ParamsJSON != `{"difficulty":"easy"}` {
+		t.Errorf("unexpected run %+v", run)
+	}
+	page, err := a.GetRunHits(res.RunID, 1, 10)
+	if err != nil {
+		t.Fatalf("GetRunHits: %v", err)
+	}
+	if len(page.Hits) != 4 {
+		t.Fatalf("expected 4 hits, got %d", len(page.Hits))
+	}
+	details := map[uint64]observedDetails{}
+	for _, h := range page.Hits {
+		var d observedDetails
+		if err := json.Unmarshal([]byte(h.Details), &d); err != nil {
+			t.Fatalf("hit %d details: %v", h.Nonce, err)
+		}
+		details[h.Nonce] = d
+	}
+	if d := details[2]; d.Source != "bet" || !d.Match {
+		t.Errorf("expected nonce 2 to keep the bet's result, got %+v", d)
+	}
+	if d := details[3]; d.Match {
+		t.Errorf("expected nonce 3 mismatched, got %+v", d)
+	}
+	if d := details[5]; !d.Match || d.Params["difficulty"] != "expert" {
+		t.Errorf("expected nonce 5 replayed with its own params, got %+v", d)
+	}
+	if d := details[7]; !d.Match || d.Params != nil {
+		t.Errorf("expected nonce 7, played with the run's params, to list none, got %+v", d)
+	}
+}
+
+func TestOpenObservedRunRejects(t *testing.T) {
+	a := newObservedApp(t)
+	req := ObservedRun{Game: "pump", Seeds: Seeds{Server: "s", Client: "c"}, Params: map[string]any{"difficulty": "easy"}}
+
+	_, err := a.OpenObservedRun(req, func(yield func(ObservedRound) error) error { return nil })
+	if !errors.Is(err, ErrNoObservedRounds) {
+		t.Errorf("expected ErrNoObservedRounds without rounds, got %v", err)
+	}
+
+	_, err = a.OpenObservedRun(req, func(yield func(ObservedRound) error) error {
+		return yield(ObservedRound{Nonce: 1, Params: map[string]any{"difficulty": "impossible"}})
+	})
+	if err == nil {
+		t.Error("expected a round with invalid params to be rejected")
+	}
+	if list, err := a.ListRuns(RunsQuery{Page: 1, PerPage: 10}); err != nil || list.TotalCount != 0 {
+		t.Errorf("expected no run left behind, got %+v (%v)", list, err)
+	}
+
+	if _, err := a.OpenObservedRun(ObservedRun{Game: "nope"}, nil); err == nil {
+		t.Error("expected an unknown game to be rejected")
+	}
+}
@@ -0,0 +1,48 @@
+package bindings
+
+import (
+	"context"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/repro"
+	"github.com/MJE43/stake-pf-replay-go/internal/scan"
+)
+
+// RunManifest is a run's reproducibility manifest with warnings about what
+// has changed in this build since the run was created.
+type RunManifest struct {
+	Manifest *repro.Manifest `json:"manifest,omitempty"`
+	Warnings []string        `json:"warnings"`
+}
+
+// GetRunManifest returns the manifest recorded for a run. Warnings flag
+// payout tables, custom game definitions or engine versions that differ
+// from the ones the run was created with.
+func (a *App) GetRunManifest(runID string) (*RunManifest, error) {
+	run, err := a.db.GetRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	if run.Manifest == "" {
+		return &RunManifest{Warnings: []string{"run has no manifest; it was created before manifests were recorded"}}, nil
+	}
+	m, err := repro.Parse(run.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	warnings := m.Check()
+	if warnings == nil {
+		warnings = []string{}
+	}
+	return &RunManifest{Manifest: m, Warnings: warnings}, nil
+}
+
+// RerunAndCompare scans a stored run's range again and diffs the new hits
+// against the saved ones. Batch parent runs have no seeds of their own;
+// re-run their child runs instead.
+func (a *App) RerunAndCompare(runID string) (*repro.Comparison, error) {
+	ctx := a.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return repro.Rerun(ctx, a.db, scan.NewScanner().WithBudget(a.scanBudget), runID)
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
+	"math/rand"
 	"strings"
 	"sync"
 
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
 	"github.com/MJE43/stake-pf-replay-go/internal/stake"
 	"github.com/MJE43/stake-pf-replay-go/internal/scripting"
 	"github.com/MJE43/stake-pf-replay-go/internal/scriptstore"
@@ -367,6 +370,8 @@ func (s *SimulatedBetPlacer) PlaceBet(ctx context.Context, vars *scripting.Varia
 		return simulateDiceBet(vars), nil
 	case "limbo":
 		return simulateLimboBet(vars), nil
+	case "roulette":
+		return simulateRouletteBet(vars)
 	default:
 		return simulateGenericBet(vars), nil
 	}
@@ -405,6 +410,32 @@ func simulateLimboBet(vars *scripting.Variables) *scripting.BetResult {
 	}
 }
 
+// simulateRouletteBet spins a random pocket and pays the chip layout the way
+// the roulette game evaluator does.
+func simulateRouletteBet(vars *scripting.Variables) (*scripting.BetResult, error) {
+	bets, err := games.ParseRouletteChips(vars.Chips)
+	if err != nil {
+		return nil, err
+	}
+	pocket := int(math.Floor(rand.Float64() * 37))
+	multiplier, _ := games.RouletteLayoutPayout(bets, pocket)
+
+	// The parsed amounts are normalised, whether chips came from JS as
+	// floats or were built in Go with integers
+	amount := 0.0
+	for _, b := range bets {
+		amount += b.Amount
+	}
+
+	return &scripting.BetResult{
+		Amount:      amount,
+		Payout:      amount * multiplier,
+		PayoutMulti: multiplier,
+		Win:         multiplier >= 1,
+		Roll:        float64(pocket),
+	}, nil
+}
+
 func simulateGenericBet(vars *scripting.Variables) *scripting.BetResult {
 	return &scripting.BetResult{
 		Amount:      vars.NextBet,
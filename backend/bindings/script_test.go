@@ -0,0 +1,36 @@
+package bindings
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/scripting"
+)
+
+func TestSimulateRouletteBetIntegerChips(t *testing.T) {
+	// A straight chip on every pocket, built in Go with integer amounts,
+	// always returns 36 of the 37 staked
+	vars := &scripting.Variables{Game: "roulette"}
+	for n := 0; n <= 36; n++ {
+		amount := any(1)
+		if n%2 == 1 {
+			amount = int64(1)
+		}
+		vars.Chips = append(vars.Chips, map[string]any{"value": fmt.Sprintf("number%d", n), "amount": amount})
+	}
+
+	res, err := simulateRouletteBet(vars)
+	if err != nil {
+		t.Fatalf("simulateRouletteBet: %v", err)
+	}
+	if res.Amount != 37 {
+		t.Errorf("expected 37 staked, got %g", res.Amount)
+	}
+	if math.Abs(res.Payout-36) > 1e-9 || math.Abs(res.PayoutMulti-36.0/37) > 1e-9 {
+		t.Errorf("expected a payout of 36 (x%g), got %g (x%g)", 36.0/37, res.Payout, res.PayoutMulti)
+	}
+	if res.Roll < 0 || res.Roll > 36 {
+		t.Errorf("pocket out of range: %g", res.Roll)
+	}
+}
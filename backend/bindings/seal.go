@@ -0,0 +1,36 @@
+package bindings
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/atrest"
+)
+
+// SeedPassphraseEnv switches at-rest encryption from the OS keyring to a key
+// derived from the passphrase it holds.
+const SeedPassphraseEnv = "WEN_SEED_PASSPHRASE"
+
+// OpenVault sets up at-rest encryption of server seeds and fallback
+// secrets. The data key is kept in the OS keyring, or, when
+// WEN_SEED_PASSPHRASE is set, wrapped with that passphrase in
+// seed_key.json under appDir.
+func OpenVault(appDir string) (*atrest.Vault, error) {
+	var keys atrest.KeyStore = atrest.NewKeyringKeys("wen-desktop")
+	if passphrase := os.Getenv(SeedPassphraseEnv); passphrase != "" {
+		keys = atrest.NewPassphraseKeys(filepath.Join(appDir, "seed_key.json"), passphrase)
+	}
+	return atrest.Open(keys)
+}
+
+// GetSeedEncryption reports whether stored seeds are encrypted and with
+// which key.
+func (a *App) GetSeedEncryption() atrest.Status {
+	return a.vault.Status()
+}
+
+// RotateSeedKey moves every stored seed and fallback secret to a fresh
+// data key and returns how many values were re-encrypted.
+func (a *App) RotateSeedKey() (int, error) {
+	return a.vault.Rotate()
+}
@@ -6,10 +6,14 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/MJE43/stake-pf-replay-go/internal/api"
+	"github.com/MJE43/stake-pf-replay-go/internal/atrest"
+	"github.com/MJE43/stake-pf-replay-go/internal/jobs"
+	"github.com/MJE43/stake-pf-replay-go/internal/scan"
 	"github.com/MJE43/stake-pf-replay-go/internal/store"
 )
 
@@ -26,8 +30,60 @@ func main() {
 		log.Fatal("Failed to run migrations:", err)
 	}
 
+	// The scan job queue shares the database
+	jobStore, err := jobs.NewStore("./data.db")
+	if err != nil {
+		log.Fatal("Failed to open job store:", err)
+	}
+	defer jobStore.Close()
+	if err := jobStore.Migrate(); err != nil {
+		log.Fatal("Failed to migrate job store:", err)
+	}
+
+	// Optional at-rest encryption of server seeds, in runs and queued jobs
+	if passphrase := os.Getenv("SEED_PASSPHRASE"); passphrase != "" {
+		vault, err := atrest.Open(atrest.NewPassphraseKeys(getEnv("SEED_KEY_FILE", "./seed_key.json"), passphrase))
+		if err != nil {
+			log.Fatal("Failed to open seed key:", err)
+		}
+		db.SetCipher(vault.Cipher())
+		jobStore.SetCipher(vault.Cipher())
+		vault.Register("runs", db.ResealSeeds)
+		vault.Register("scan jobs", jobStore.ResealSeeds)
+		if n, err := vault.Migrate(); err != nil {
+			log.Fatal("Failed to encrypt stored seeds:", err)
+		} else if n > 0 {
+			log.Printf("Encrypted %d stored server seeds", n)
+		}
+	} else if n, err := db.SealedSeeds(); err != nil {
+		log.Fatal("Failed to check stored seeds:", err)
+	} else if n > 0 {
+		log.Fatalf("%d stored server seeds are encrypted; set SEED_PASSPHRASE to open them", n)
+	}
+	// Direct scans and queued jobs share one worker budget
+	budget := scan.NewWorkerBudget(0)
+	queue := jobs.NewQueue(jobStore, db, jobs.Config{Budget: budget})
+	if err := queue.Start(context.Background()); err != nil {
+		log.Fatal("Failed to start job queue:", err)
+	}
+
 	// Initialize API server
 	server := api.NewServer(db)
+	server.SetJobQueue(queue)
+	server.SetWorkerBudget(budget)
+
+	// Optional on-disk metric cache for repeated scans
+	if dir := os.Getenv("METRIC_CACHE_DIR"); dir != "" {
+		maxMB, err := strconv.ParseInt(getEnv("METRIC_CACHE_MB", "1024"), 10, 64)
+		if err != nil {
+			log.Fatal("Invalid METRIC_CACHE_MB:", err)
+		}
+		cache, err := scan.NewMetricCache(dir, maxMB<<20)
+		if err != nil {
+			log.Fatal("Failed to open metric cache:", err)
+		}
+		server.SetMetricCache(cache)
+	}
 	
 	// Setup HTTP server
 	port := getEnv("PORT", "8080")
@@ -58,6 +114,7 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
+	queue.Stop()
 
 	log.Println("Server exited")
 }
@@ -19,6 +19,7 @@ func (m *mockDB) Migrate() error                                               {
 func (m *mockDB) SaveRun(run *store.Run) error                                 { return nil }
 func (m *mockDB) UpdateRun(run *store.Run) error                               { return nil }
 func (m *mockDB) SaveHits(runID string, hits []store.Hit) error                { return nil }
+func (m *mockDB) ImportRun(run *store.Run) (store.RunImport, error)            { return nil, nil }
 func (m *mockDB) GetRun(id string) (*store.Run, error)                         { return nil, nil }
 func (m *mockDB) GetHits(runID string, limit, offset int) ([]store.Hit, error) { return nil, nil }
 func (m *mockDB) ListRuns(query store.RunsQuery) (*store.RunsList, error) {
@@ -27,9 +28,26 @@ func (m *mockDB) ListRuns(query store.RunsQuery) (*store.RunsList, error) {
 func (m *mockDB) GetRunHits(runID string, page, perPage int) (*store.HitsPage, error) {
 	return &store.HitsPage{}, nil
 }
+func (m *mockDB) EachHit(runID string, fn func(store.HitWithDelta) error) error {
+	return nil
+}
 func (m *mockDB) ListRunsBySeed(serverSeedHash string, serverSeed string, clientSeed string) ([]store.Run, error) {
 	return nil, nil
 }
+func (m *mockDB) ListChildRuns(parentRunID string) ([]store.Run, error) {
+	return nil, nil
+}
+func (m *mockDB) DeleteHitsFrom(runID string, nonce uint64) error {
+	return nil
+}
+func (m *mockDB) AnnotateRun(runID string, a store.Annotation) error { return nil }
+func (m *mockDB) AnnotateHit(runID string, nonce uint64, a store.Annotation) error {
+	return nil
+}
+func (m *mockDB) ListHitAnnotations(runID, tag string) ([]store.HitAnnotation, error) {
+	return nil, nil
+}
+func (m *mockDB) ListTags() ([]store.TagCount, error) { return nil, nil }
 
 func TestHealthEndpoint(t *testing.T) {
 	server := NewServer(&mockDB{})
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/jobs"
+)
+
+// EnqueueJobRequest is a scan request plus its queue priority
+type EnqueueJobRequest struct {
+	ScanRequest
+	Priority int `json:"priority"`
+}
+
+// JobPriorityRequest changes the priority of a job
+type JobPriorityRequest struct {
+	Priority int `json:"priority"`
+}
+
+// JobsResponse lists queued jobs
+type JobsResponse struct {
+	Jobs          []jobs.Job `json:"jobs"`
+	EngineVersion string     `json:"engine_version"`
+}
+
+// SetJobQueue enables the /api/v1/jobs endpoints
+func (s *Server) SetJobQueue(q *jobs.Queue) {
+	s.jobs = q
+}
+
+func (s *Server) jobRoutes(r chi.Router) {
+	r.Post("/", s.handleEnqueueJob)
+	r.Get("/", s.handleListJobs)
+	r.Get("/{id}", s.handleGetJob)
+	r.Post("/{id}/pause", s.handleJobAction(func(q *jobs.Queue, id string) error { return q.Pause(id) }))
+	r.Post("/{id}/resume", s.handleJobAction(func(q *jobs.Queue, id string) error { return q.Resume(id) }))
+	r.Post("/{id}/cancel", s.handleJobAction(func(q *jobs.Queue, id string) error { return q.Cancel(id) }))
+	r.Put("/{id}/priority", s.handleSetJobPriority)
+}
+
+// requireJobs writes an error and returns false when no queue is configured
+func (s *Server) requireJobs(w http.ResponseWriter, r *http.Request) bool {
+	if s.jobs != nil {
+		return true
+	}
+	engineErr := NewError(ErrTypeServiceUnavailable, "Scan queue is not enabled").
+		WithRequestID(middleware.GetReqID(r.Context())).
+		Build()
+	s.errorHandler.HandleError(w, r, engineErr, http.StatusServiceUnavailable)
+	return false
+}
+
+// handleEnqueueJob validates a scan request and queues it
+func (s *Server) handleEnqueueJob(w http.ResponseWriter, r *http.Request) {
+	if !s.requireJobs(w, r) {
+		return
+	}
+
+	var req EnqueueJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorHandler.HandleValidationError(w, r, "request_body", "Invalid JSON format: "+err.Error())
+		return
+	}
+	if err := ValidateScanRequest(&req.ScanRequest); err != nil {
+		s.errorHandler.HandleValidationError(w, r, "scan_request", err.Error())
+		return
+	}
+
+	job, err := s.jobs.Enqueue(convertToScanRequest(&req.ScanRequest), req.Priority)
+	if err != nil {
+		s.errorHandler.HandleError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	s.writeJSON(w, http.StatusAccepted, job)
+}
+
+// handleListJobs lists jobs, optionally filtered by ?status=
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	if !s.requireJobs(w, r) {
+		return
+	}
+
+	list, err := s.jobs.List(jobs.Status(r.URL.Query().Get("status")))
+	if err != nil {
+		s.errorHandler.HandleError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []jobs.Job{}
+	}
+	s.writeJSON(w, http.StatusOK, JobsResponse{Jobs: list, EngineVersion: EngineVersion})
+}
+
+// handleGetJob returns a job with its progress
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	if !s.requireJobs(w, r) {
+		return
+	}
+
+	job, err := s.jobs.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeJobError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, job)
+}
+
+// handleJobAction applies a state change and returns the updated job
+func (s *Server) handleJobAction(action func(q *jobs.Queue, id string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.requireJobs(w, r) {
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		if _, err := s.jobs.Get(id); err != nil {
+			s.writeJobError(w, r, err)
+			return
+		}
+		if err := action(s.jobs, id); err != nil {
+			s.writeJobError(w, r, err)
+			return
+		}
+		s.handleGetJob(w, r)
+	}
+}
+
+// handleSetJobPriority changes the priority of an unfinished job
+func (s *Server) handleSetJobPriority(w http.ResponseWriter, r *http.Request) {
+	if !s.requireJobs(w, r) {
+		return
+	}
+
+	var req JobPriorityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorHandler.HandleValidationError(w, r, "request_body", "Invalid JSON format: "+err.Error())
+		return
+	}
+	s.handleJobAction(func(q *jobs.Queue, id string) error { return q.SetPriority(id, req.Priority) })(w, r)
+}
+
+func (s *Server) writeJobError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, jobs.ErrInvalidState):
+		status = http.StatusConflict
+	}
+	s.errorHandler.HandleError(w, r, err, status)
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/jobs"
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+)
+
+func TestJobsEndpointsDisabled(t *testing.T) {
+	server := NewServer(&mockDB{})
+
+	req := httptest.NewRequest("GET", "/api/v1/jobs", nil)
+	w := httptest.NewRecorder()
+	server.Routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+}
+
+func TestJobsEndpoints(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "jobs.db")
+	db, err := store.NewSQLiteDB(dbPath)
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	jobStore, err := jobs.NewStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer jobStore.Close()
+	if err := jobStore.Migrate(); err != nil {
+		t.Fatalf("Migrate jobs: %v", err)
+	}
+	queue := jobs.NewQueue(jobStore, db, jobs.Config{MaxWorkers: 2})
+
+	server := NewServer(db)
+	server.SetJobQueue(queue)
+	routes := server.Routes()
+
+	do := func(method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, req)
+		return w
+	}
+
+	// Queue before starting so the job can be paused deterministically
+	w := do("POST", "/api/v1/jobs", map[string]any{
+		"game":        "dice",
+		"seeds":       map[string]string{"server": "s", "client": "c"},
+		"nonce_start": 1,
+		"nonce_end":   5000,
+		"target_op":   "ge",
+		"target_val":  99,
+		"priority":    3,
+	})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var job jobs.Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatalf("decode job: %v", err)
+	}
+	if job.Status != jobs.StatusQueued || job.Priority != 3 {
+		t.Errorf("Unexpected job: %+v", job)
+	}
+
+	if w := do("POST", "/api/v1/jobs/"+job.ID+"/pause", nil); w.Code != http.StatusOK {
+		t.Fatalf("pause: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/api/v1/jobs/"+job.ID+"/pause", nil); w.Code != http.StatusConflict {
+		t.Errorf("second pause: expected 409, got %d", w.Code)
+	}
+	if w := do("GET", "/api/v1/jobs/missing", nil); w.Code != http.StatusNotFound {
+		t.Errorf("missing job: expected 404, got %d", w.Code)
+	}
+	if w := do("PUT", "/api/v1/jobs/"+job.ID+"/priority", map[string]int{"priority": 9}); w.Code != http.StatusOK {
+		t.Errorf("priority: expected 200, got %d", w.Code)
+	}
+
+	if err := queue.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer queue.Stop()
+	if w := do("POST", "/api/v1/jobs/"+job.ID+"/resume", nil); w.Code != http.StatusOK {
+		t.Fatalf("resume: expected 200, got %d", w.Code)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		w := do("GET", "/api/v1/jobs?status=completed", nil)
+		var list JobsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+			t.Fatalf("decode list: %v", err)
+		}
+		if len(list.Jobs) == 1 {
+			if list.Jobs[0].Evaluated != 5000 || list.Jobs[0].Priority != 9 || list.Jobs[0].RunID == "" {
+				t.Errorf("Unexpected completed job: %+v", list.Jobs[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job did not complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/export"
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+)
+
+func (s *Server) runRoutes(r chi.Router) {
+	r.Get("/", s.handleListRuns)
+	r.Put("/{id}/annotation", s.handleAnnotateRun)
+	r.Get("/{id}/annotations", s.handleListHitAnnotations)
+	r.Get("/{id}/hits/export", s.handleExportHits)
+	r.Put("/{id}/hits/{nonce}/annotation", s.handleAnnotateHit)
+}
+
+func (s *Server) tagRoutes(r chi.Router) {
+	r.Get("/", s.handleListTags)
+	r.Get("/{tag}/hits", s.handleListTaggedHits)
+}
+
+// handleListRuns searches stored runs. Filters come from the query string,
+// see parseRunsQuery.
+func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
+	query, field, err := parseRunsQuery(r.URL.Query())
+	if err != nil {
+		s.errorHandler.HandleValidationError(w, r, field, err.Error())
+		return
+	}
+
+	list, err := s.db.ListRuns(query)
+	if errors.Is(err, store.ErrInvalidRunsQuery) {
+		s.errorHandler.HandleValidationError(w, r, "query", err.Error())
+		return
+	}
+	if err != nil {
+		s.errorHandler.HandleError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if list.Runs == nil {
+		list.Runs = []store.Run{}
+	}
+	s.writeJSON(w, http.StatusOK, list)
+}
+
+// handleExportHits streams every hit of a run as NDJSON or Parquet, picked
+// with ?format=. The response is chunked, so exports of any size start
+// right away.
+func (s *Server) handleExportHits(w http.ResponseWriter, r *http.Request) {
+	format, err := export.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		s.errorHandler.HandleValidationError(w, r, "format", err.Error())
+		return
+	}
+	id := chi.URLParam(r, "id")
+	if _, err := s.db.GetRun(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.errorHandler.HandleError(w, r, err, http.StatusNotFound)
+		} else {
+			s.errorHandler.HandleError(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="run_`+id+`_hits.`+format.Ext()+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	// Large exports outlive the request timeout; a client that goes away
+	// still ends the export through a failed write.
+	ctx := context.WithoutCancel(r.Context())
+	source := func(fn func(store.HitWithDelta) error) error { return s.db.EachHit(id, fn) }
+	if _, err := export.WriteHits(ctx, flushWriter{w}, format, source, nil); err != nil {
+		// The status is sent already, so the truncated body is all the
+		// client sees
+		s.logger.Printf("export of run %s hits failed: %v", id, err)
+	}
+}
+
+// flushWriter sends everything written to it to the client straight away
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if fl, ok := f.w.(http.Flusher); ok && err == nil {
+		fl.Flush()
+	}
+	return n, err
+}
+
+// handleAnnotateRun replaces a run's name, notes, tags and starred flag and
+// returns the updated run
+func (s *Server) handleAnnotateRun(w http.ResponseWriter, r *http.Request) {
+	var annotation store.Annotation
+	if err := json.NewDecoder(r.Body).Decode(&annotation); err != nil {
+		s.errorHandler.HandleValidationError(w, r, "request_body", "Invalid JSON format: "+err.Error())
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if err := s.db.AnnotateRun(id, annotation); err != nil {
+		s.writeAnnotationError(w, r, err)
+		return
+	}
+	run, err := s.db.GetRun(id)
+	if err != nil {
+		s.errorHandler.HandleError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, run)
+}
+
+// handleAnnotateHit replaces the annotation of one hit; an empty body
+// object removes it
+func (s *Server) handleAnnotateHit(w http.ResponseWriter, r *http.Request) {
+	nonce, err := strconv.ParseUint(chi.URLParam(r, "nonce"), 10, 64)
+	if err != nil {
+		s.errorHandler.HandleValidationError(w, r, "nonce", "Invalid nonce: "+err.Error())
+		return
+	}
+	var annotation store.Annotation
+	if err := json.NewDecoder(r.Body).Decode(&annotation); err != nil {
+		s.errorHandler.HandleValidationError(w, r, "request_body", "Invalid JSON format: "+err.Error())
+		return
+	}
+
+	if err := s.db.AnnotateHit(chi.URLParam(r, "id"), nonce, annotation); err != nil {
+		s.writeAnnotationError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListHitAnnotations lists the annotated hits of a run
+func (s *Server) handleListHitAnnotations(w http.ResponseWriter, r *http.Request) {
+	s.writeHitAnnotations(w, r, chi.URLParam(r, "id"), "")
+}
+
+// handleListTaggedHits lists annotated hits carrying a tag across runs
+func (s *Server) handleListTaggedHits(w http.ResponseWriter, r *http.Request) {
+	s.writeHitAnnotations(w, r, "", chi.URLParam(r, "tag"))
+}
+
+func (s *Server) writeHitAnnotations(w http.ResponseWriter, r *http.Request, runID, tag string) {
+	annotations, err := s.db.ListHitAnnotations(runID, tag)
+	if err != nil {
+		s.writeAnnotationError(w, r, err)
+		return
+	}
+	if annotations == nil {
+		annotations = []store.HitAnnotation{}
+	}
+	s.writeJSON(w, http.StatusOK, annotations)
+}
+
+// handleListTags returns the tag index
+func (s *Server) handleListTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := s.db.ListTags()
+	if err != nil {
+		s.errorHandler.HandleError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if tags == nil {
+		tags = []store.TagCount{}
+	}
+	s.writeJSON(w, http.StatusOK, tags)
+}
+
+// writeAnnotationError maps store errors to 400 and 404 responses
+func (s *Server) writeAnnotationError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrInvalidTag):
+		s.errorHandler.HandleValidationError(w, r, "tags", err.Error())
+	case errors.Is(err, sql.ErrNoRows):
+		s.errorHandler.HandleError(w, r, err, http.StatusNotFound)
+	default:
+		s.errorHandler.HandleError(w, r, err, http.StatusInternalServerError)
+	}
+}
+
+// parseRunsQuery maps URL parameters onto a store.RunsQuery. Params fields
+// are given as param.<key>=<value>; values that parse as numbers or bools
+// are matched as such. tag may be repeated. On error the offending parameter is returned too.
+func parseRunsQuery(values url.Values) (store.RunsQuery, string, error) {
+	q := store.RunsQuery{
+		Game:           values.Get("game"),
+		ServerSeedHash: values.Get("server_seed_hash"),
+		ClientSeed:     values.Get("client_seed"),
+		TargetOp:       values.Get("target_op"),
+		Text:           values.Get("q"),
+		SortBy:         values.Get("sort"),
+		SortOrder:      values.Get("order"),
+	}
+
+	var err error
+	parseTime := func(name string) *time.Time {
+		v := values.Get(name)
+		if v == "" || err != nil {
+			return nil
+		}
+		t, perr := time.Parse(time.RFC3339, v)
+		if perr != nil {
+			err = perr
+			return nil
+		}
+		return &t
+	}
+	parseFloat := func(name string) *float64 {
+		v := values.Get(name)
+		if v == "" || err != nil {
+			return nil
+		}
+		f, perr := strconv.ParseFloat(v, 64)
+		if perr != nil {
+			err = perr
+			return nil
+		}
+		return &f
+	}
+	parseInt := func(name string) *int {
+		v := values.Get(name)
+		if v == "" || err != nil {
+			return nil
+		}
+		n, perr := strconv.Atoi(v)
+		if perr != nil {
+			err = perr
+			return nil
+		}
+		return &n
+	}
+
+	fields := []struct {
+		name  string
+		parse func()
+	}{
+		{"created_after", func() { q.CreatedAfter = parseTime("created_after") }},
+		{"created_before", func() { q.CreatedBefore = parseTime("created_before") }},
+		{"target_val_min", func() { q.TargetValMin = parseFloat("target_val_min") }},
+		{"target_val_max", func() { q.TargetValMax = parseFloat("target_val_max") }},
+		{"hits_min", func() { q.HitCountMin = parseInt("hits_min") }},
+		{"hits_max", func() { q.HitCountMax = parseInt("hits_max") }},
+		{"page", func() {
+			if p := parseInt("page"); p != nil {
+				q.Page = *p
+			}
+		}},
+		{"per_page", func() {
+			if p := parseInt("per_page"); p != nil {
+				q.PerPage = *p
+			}
+		}},
+	}
+	for _, f := range fields {
+		if f.parse(); err != nil {
+			return q, f.name, err
+		}
+	}
+
+	if q.TimedOut, err = optionalBool(values, "timed_out"); err != nil {
+		return q, "timed_out", err
+	}
+	if q.Starred, err = optionalBool(values, "starred"); err != nil {
+		return q, "starred", err
+	}
+	q.Tags = values["tag"]
+
+	for name, vs := range values {
+		key, ok := strings.CutPrefix(name, "param.")
+		if !ok || len(vs) == 0 {
+			continue
+		}
+		if q.Params == nil {
+			q.Params = map[string]any{}
+		}
+		q.Params[key] = paramValue(vs[0])
+	}
+	return q, "", nil
+}
+
+func optionalBool(values url.Values, name string) (*bool, error) {
+	v := values.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// paramValue types a params filter value from the query string
+func paramValue(v string) any {
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	}
+	if v == "true" || v == "false" {
+		return v == "true"
+	}
+	return v
+}
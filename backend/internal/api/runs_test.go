@@ -0,0 +1,203 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+)
+
+func TestListRunsEndpoint(t *testing.T) {
+	db, err := store.NewSQLiteDB(":memory:")
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	for _, run := range []*store.Run{
+		{ID: "easy", Game: "pump", ClientSeed: "c", ParamsJSON: `{"difficulty":"easy"}`, TargetOp: "ge", TargetVal: 10, HitCount: 3, EngineVersion: "1.0.0"},
+		{ID: "hard", Game: "pump", ClientSeed: "c", ParamsJSON: `{"difficulty":"hard"}`, TargetOp: "ge", TargetVal: 10, HitCount: 12, EngineVersion: "1.0.0"},
+		{ID: "dice", Game: "dice", ClientSeed: "c", ParamsJSON: `{}`, TargetOp: "ge", TargetVal: 99, HitCount: 8, EngineVersion: "1.0.0"},
+	} {
+		if err := db.SaveRun(run); err != nil {
+			t.Fatalf("SaveRun: %v", err)
+		}
+	}
+	routes := NewServer(db).Routes()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := get("/api/v1/runs?game=pump&param.difficulty=hard&hits_min=5")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var list store.RunsList
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode runs: %v", err)
+	}
+	if list.TotalCount != 1 || list.Runs[0].ID != "hard" {
+		t.Errorf("Expected only the hard pump run, got %+v", list.Runs)
+	}
+
+	w = get("/api/v1/runs?sort=hit_count&order=asc&per_page=2")
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode runs: %v", err)
+	}
+	if list.TotalCount != 3 || list.TotalPages != 2 || len(list.Runs) != 2 || list.Runs[0].ID != "easy" || list.Runs[1].ID != "dice" {
+		t.Errorf("Unexpected sorted page: %+v", list)
+	}
+
+	for _, path := range []string{
+		"/api/v1/runs?sort=server_seed",
+		"/api/v1/runs?hits_min=many",
+		"/api/v1/runs?created_after=yesterday",
+		"/api/v1/runs?timed_out=maybe",
+	} {
+		if w := get(path); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestAnnotationEndpoints(t *testing.T) {
+	db, err := store.NewSQLiteDB(":memory:")
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := db.SaveRun(&store.Run{ID: "run1", Game: "limbo", ClientSeed: "c", TargetOp: "ge", TargetVal: 2, EngineVersion: "1.0.0"}); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	if err := db.SaveHits("run1", []store.Hit{{Nonce: 42, Metric: 3}}); err != nil {
+		t.Fatalf("SaveHits: %v", err)
+	}
+	routes := NewServer(db).Routes()
+
+	do := func(method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, httptest.NewRequest(method, path, &buf))
+		return w
+	}
+
+	w := do("PUT", "/api/v1/runs/run1/annotation", map[string]any{"name": "baseline", "tags": []string{"Baseline"}, "starred": true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var run store.Run
+	if err := json.Unmarshal(w.Body.Bytes(), &run); err != nil {
+		t.Fatalf("decode run: %v", err)
+	}
+	if run.Name != "baseline" || len(run.Tags) != 1 || run.Tags[0] != "baseline" || !run.Starred {
+		t.Errorf("Unexpected annotated run: %+v", run)
+	}
+
+	if w := do("PUT", "/api/v1/runs/run1/hits/42/annotation", map[string]any{"notes": "check", "tags": []string{"baseline"}}); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do("GET", "/api/v1/tags/baseline/hits", nil)
+	var hits []store.HitAnnotation
+	if err := json.Unmarshal(w.Body.Bytes(), &hits); err != nil {
+		t.Fatalf("decode hit annotations: %v", err)
+	}
+	if len(hits) != 1 || hits[0].Nonce != 42 || hits[0].Notes != "check" {
+		t.Errorf("Unexpected tagged hits: %+v", hits)
+	}
+
+	w = do("GET", "/api/v1/tags", nil)
+	var tags []store.TagCount
+	if err := json.Unmarshal(w.Body.Bytes(), &tags); err != nil {
+		t.Fatalf("decode tags: %v", err)
+	}
+	if len(tags) != 1 || tags[0] != (store.TagCount{Tag: "baseline", Runs: 1, Hits: 1}) {
+		t.Errorf("Unexpected tag index: %+v", tags)
+	}
+
+	w = do("GET", "/api/v1/runs?tag=baseline&starred=true", nil)
+	var list store.RunsList
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode runs: %v", err)
+	}
+	if list.TotalCount != 1 {
+		t.Errorf("Expected the starred baseline run, got %+v", list)
+	}
+
+	if w := do("PUT", "/api/v1/runs/missing/annotation", map[string]any{"name": "x"}); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+	if w := do("PUT", "/api/v1/runs/run1/hits/7/annotation", map[string]any{"name": "x"}); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing hit, got %d", w.Code)
+	}
+	if w := do("PUT", "/api/v1/runs/run1/annotation", map[string]any{"tags": []string{"a,b"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid tag, got %d", w.Code)
+	}
+}
+
+func TestExportHitsEndpoint(t *testing.T) {
+	db, err := store.NewSQLiteDB(":memory:")
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := db.SaveRun(&store.Run{ID: "run", Game: "dice", TargetOp: "ge", TargetVal: 90, EngineVersion: "1.0.0"}); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	if err := db.SaveHits("run", []store.Hit{
+		{RunID: "run", Nonce: 10, Metric: 95.5, Details: `{"roll":95.5,"raw_float":0.955}`},
+		{RunID: "run", Nonce: 30, Metric: 91.25, Details: `{"roll":91.25,"raw_float":0.9125}`},
+	}); err != nil {
+		t.Fatalf("SaveHits: %v", err)
+	}
+	routes := NewServer(db).Routes()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := get("/api/v1/runs/run/hits/export?format=ndjson")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("Expected an NDJSON export, got %d %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	lines := bytes.Split(bytes.TrimSpace(w.Body.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+	var row map[string]any
+	if err := json.Unmarshal(lines[1], &row); err != nil {
+		t.Fatalf("decode row: %v", err)
+	}
+	if row["nonce"] != float64(30) || row["delta_nonce"] != float64(20) || row["details_roll"] != 91.25 {
+		t.Errorf("Unexpected row %v", row)
+	}
+
+	w = get("/api/v1/runs/run/hits/export?format=parquet")
+	if w.Code != http.StatusOK || !bytes.HasPrefix(w.Body.Bytes(), []byte("PAR1")) {
+		t.Errorf("Expected a parquet export, got %d", w.Code)
+	}
+	if w := get("/api/v1/runs/run/hits/export?format=xlsx"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown format, got %d", w.Code)
+	}
+	if w := get("/api/v1/runs/missing/hits/export"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing run, got %d", w.Code)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/MJE43/stake-pf-replay-go/internal/games"
+	"github.com/MJE43/stake-pf-replay-go/internal/jobs"
 	"github.com/MJE43/stake-pf-replay-go/internal/scan"
 	"github.com/MJE43/stake-pf-replay-go/internal/store"
 )
@@ -22,6 +23,7 @@ type Server struct {
 	logger         *log.Logger
 	securityLogger *SecurityLogger
 	startTime      time.Time
+	jobs           *jobs.Queue // optional; see SetJobQueue
 }
 
 // NewServer creates a new API server
@@ -49,6 +51,17 @@ func NewServer(db store.DB) *Server {
 	return server
 }
 
+// SetWorkerBudget makes /api/v1/scan share b with other scanners, such as
+// the job queue's
+func (s *Server) SetWorkerBudget(b *scan.WorkerBudget) {
+	s.scanner.WithBudget(b)
+}
+
+// SetMetricCache makes /api/v1/scan reuse and fill c
+func (s *Server) SetMetricCache(c *scan.MetricCache) {
+	s.scanner.WithCache(c)
+}
+
 // Routes sets up the HTTP routes with proper middleware
 func (s *Server) Routes() http.Handler {
 	r := chi.NewRouter()
@@ -73,6 +86,9 @@ func (s *Server) Routes() http.Handler {
 		r.Post("/verify", s.handleVerify)
 		r.Get("/games", s.handleListGames)
 		r.Post("/seed/hash", s.handleSeedHash)
+		r.Route("/runs", s.runRoutes)
+		r.Route("/tags", s.tagRoutes)
+		r.Route("/jobs", s.jobRoutes)
 	})
 	
 	// Legacy routes (without /api/v1 prefix for backward compatibility)
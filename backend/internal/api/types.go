@@ -76,7 +76,7 @@ type ScanRequest struct {
 	NonceStart uint64         `json:"nonce_start"`
 	NonceEnd   uint64         `json:"nonce_end"`
 	Params     map[string]any `json:"params"`
-	TargetOp   string         `json:"target_op"` // "ge", "le", "eq", "gt", "lt", "between", "outside"
+	TargetOp   string         `json:"target_op"` // "ge", "le", "eq", "gt", "lt", "between", "outside", "top", "bottom"
 	TargetVal  float64        `json:"target_val"`
 	TargetVal2 float64        `json:"target_val2,omitempty"` // for "between" and "outside"
 	Tolerance  float64        `json:"tolerance"`              // default 1e-9 for floats, 0 for integers
@@ -40,7 +40,7 @@ func ValidateScanRequest(req *ScanRequest) error {
 	}
 	
 	// Validate target operation
-	validOps := []string{"eq", "gt", "ge", "lt", "le", "between", "outside"}
+	validOps := []string{"eq", "gt", "ge", "lt", "le", "between", "outside", "top", "bottom"}
 	if req.TargetOp == "" {
 		return fmt.Errorf("target_op is required")
 	}
@@ -70,6 +70,9 @@ func ValidateScanRequest(req *ScanRequest) error {
 	if req.Limit < 0 {
 		return fmt.Errorf("limit must be >= 0")
 	}
+	if (req.TargetOp == "top" || req.TargetOp == "bottom") && req.Limit == 0 {
+		return fmt.Errorf("limit is required for '%s' operation", req.TargetOp)
+	}
 	const maxLimit = 100_000
 	if req.Limit > maxLimit {
 		return fmt.Errorf("limit too large (max %d)", maxLimit)
@@ -1,10 +1,13 @@
 package api
 
-// Version information - these will be set at build time via ldflags
+import "github.com/MJE43/stake-pf-replay-go/internal/version"
+
+// Version information - set at build time via ldflags on the version package
+// (setting these directly still works)
 var (
-	EngineVersion = "dev"
-	GitCommit     = "unknown"
-	BuildTime     = "unknown"
+	EngineVersion = version.Version
+	GitCommit     = version.Get().Commit
+	BuildTime     = version.BuildTime
 )
 
 // GetVersionInfo returns the current version information
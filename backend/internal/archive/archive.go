@@ -0,0 +1,305 @@
+// Package archive reads and writes portable archives of runs, live streams
+// and script sessions. An archive is a zip holding manifest.json and one
+// NDJSON file per record type, so it can be inspected with ordinary tools
+// and records are streamed rather than loaded whole.
+package archive
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/version"
+)
+
+const (
+	// Format identifies wen archives in the manifest
+	Format = "wen-archive"
+	// Version is the archive layout written by this build. Readers accept
+	// it and anything older.
+	Version = 1
+
+	manifestName = "manifest.json"
+
+	// batchSize is how many records are read or saved at a time
+	batchSize = 5000
+)
+
+// ErrUnsupported is returned for zips that aren't archives this build can read
+var ErrUnsupported = errors.New("archive: unsupported archive")
+
+// Manifest describes an archive
+type Manifest struct {
+	Format     string         `json:"format"`
+	Version    int            `json:"version"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	AppVersion string         `json:"appVersion"`
+	Files      map[string]int `json:"files"` // records per NDJSON file
+}
+
+// Selection picks the records to export, by section name (e.g. "runs")
+type Selection map[string][]string
+
+// Stats counts what an import did for one section. Top-level records are
+// runs, streams or sessions; items are their hits, bets and rounds.
+type Stats struct {
+	Added          int `json:"added"`
+	Duplicates     int `json:"duplicates"`
+	Items          int `json:"items"`
+	ItemDuplicates int `json:"itemDuplicates"`
+}
+
+// Report maps section names to their import stats
+type Report map[string]Stats
+
+// Section exports and imports one kind of record. Imports must be
+// idempotent: records already present are counted as duplicates, and IDs
+// of new records are remapped so they can't collide with local ones.
+type Section interface {
+	Name() string
+	Export(ctx context.Context, w *Writer, ids []string) error
+	Import(ctx context.Context, r *Reader) (Stats, error)
+}
+
+// Export writes the records picked by sel from each section to w
+func Export(ctx context.Context, w io.Writer, sel Selection, sections ...Section) (Manifest, error) {
+	aw := NewWriter(w)
+	for _, s := range sections {
+		ids := sel[s.Name()]
+		if len(ids) == 0 {
+			continue
+		}
+		if err := s.Export(ctx, aw, ids); err != nil {
+			return Manifest{}, fmt.Errorf("archive: export %s: %w", s.Name(), err)
+		}
+	}
+	if err := aw.Close(); err != nil {
+		return Manifest{}, err
+	}
+	return aw.manifest, nil
+}
+
+// ExportFile is Export to a new file at path
+func ExportFile(ctx context.Context, path string, sel Selection, sections ...Section) (Manifest, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+	m, err := Export(ctx, f, sel, sections...)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return Manifest{}, err
+	}
+	return m, nil
+}
+
+// ImportFile imports the archive at path into each section. Sections are
+// imported in order; on error the report covers the sections that
+// finished, and importing the archive again picks up where it stopped.
+func ImportFile(ctx context.Context, path string, sections ...Section) (Report, error) {
+	r, err := OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	report := Report{}
+	for _, s := range sections {
+		stats, err := s.Import(ctx, r)
+		if err != nil {
+			return report, fmt.Errorf("archive: import %s: %w", s.Name(), err)
+		}
+		report[s.Name()] = stats
+	}
+	return report, nil
+}
+
+// Writer writes an archive. Files are written one at a time: each Create
+// ends the file before it.
+type Writer struct {
+	zw       *zip.Writer
+	manifest Manifest
+	created  map[string]bool
+}
+
+// NewWriter starts an archive on w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		zw: zip.NewWriter(w),
+		manifest: Manifest{
+			Format:     Format,
+			Version:    Version,
+			CreatedAt:  time.Now().UTC(),
+			AppVersion: version.Get().Version,
+			Files:      map[string]int{},
+		},
+		created: map[string]bool{},
+	}
+}
+
+// Records is an NDJSON file inside an archive
+type Records struct {
+	name string
+	enc  *json.Encoder
+	w    *Writer
+}
+
+// Create starts the NDJSON file name. Each file may be created once.
+func (w *Writer) Create(name string) (*Records, error) {
+	if w.created[name] || name == manifestName {
+		return nil, fmt.Errorf("archive: %s written twice", name)
+	}
+	f, err := w.zw.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	w.created[name] = true
+	w.manifest.Files[name] = 0
+	return &Records{name: name, enc: json.NewEncoder(f), w: w}, nil
+}
+
+// Write appends v as one JSON line
+func (r *Records) Write(v any) error {
+	if err := r.enc.Encode(v); err != nil {
+		return fmt.Errorf("archive: write %s: %w", r.name, err)
+	}
+	r.w.manifest.Files[r.name]++
+	return nil
+}
+
+// Close writes the manifest and finishes the zip. It doesn't close the
+// underlying writer.
+func (w *Writer) Close() error {
+	f, err := w.zw.Create(manifestName)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(w.manifest); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+// Reader reads an archive
+type Reader struct {
+	Manifest Manifest
+
+	files  map[string]*zip.File
+	closer io.Closer
+}
+
+// OpenReader opens the archive at path
+func OpenReader(path string) (*Reader, error) {
+	rc, err := zip.OpenReader(path)
+	if err != nil {
+		if errors.Is(err, zip.ErrFormat) {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+		}
+		return nil, err
+	}
+	r, err := newReader(&rc.Reader)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	r.closer = rc
+	return r, nil
+}
+
+// NewReader reads an archive of the given size from ra
+func NewReader(ra io.ReaderAt, size int64) (*Reader, error) {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	return newReader(zr)
+}
+
+func newReader(zr *zip.Reader) (*Reader, error) {
+	r := &Reader{files: map[string]*zip.File{}}
+	for _, f := range zr.File {
+		r.files[f.Name] = f
+	}
+	mf := r.files[manifestName]
+	if mf == nil {
+		return nil, fmt.Errorf("%w: no %s", ErrUnsupported, manifestName)
+	}
+	rc, err := mf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(&r.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: bad manifest: %v", ErrUnsupported, err)
+	}
+	if r.Manifest.Format != Format {
+		return nil, fmt.Errorf("%w: format %q", ErrUnsupported, r.Manifest.Format)
+	}
+	if r.Manifest.Version < 1 || r.Manifest.Version > Version {
+		return nil, fmt.Errorf("%w: version %d (this build reads up to %d)", ErrUnsupported, r.Manifest.Version, Version)
+	}
+	return r, nil
+}
+
+// Close releases the file opened by OpenReader
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Has reports whether the archive contains the file name
+func (r *Reader) Has(name string) bool {
+	return r.files[name] != nil
+}
+
+// Files lists the NDJSON files in the archive
+func (r *Reader) Files() []string {
+	var names []string
+	for name := range r.files {
+		if name != manifestName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Each decodes the records of file name in order and calls fn for each. A
+// file missing from the archive has no records.
+func Each[T any](r *Reader, name string, fn func(T) error) error {
+	f := r.files[name]
+	if f == nil {
+		return nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	dec := json.NewDecoder(rc)
+	for line := 1; ; line++ {
+		var v T
+		if err := dec.Decode(&v); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("archive: %s record %d: %w", name, line, err)
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+}
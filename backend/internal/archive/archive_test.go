@@ -0,0 +1,359 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/scriptstore"
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+)
+
+func TestWriterReader(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	rec, err := w.Create("things.ndjson")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := rec.Write(map[string]int{"n": i}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if _, err := w.Create("things.ndjson"); err == nil {
+		t.Error("expected an error creating a file twice")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if r.Manifest.Format != Format || r.Manifest.Version != Version || r.Manifest.Files["things.ndjson"] != 3 {
+		t.Errorf("unexpected manifest %+v", r.Manifest)
+	}
+	var got []int
+	err = Each(r, "things.ndjson", func(v struct{ N int }) error {
+		got = append(got, v.N)
+		return nil
+	})
+	if err != nil || len(got) != 3 || got[2] != 3 {
+		t.Errorf("Each = %v, %v", got, err)
+	}
+	if err := Each(r, "missing.ndjson", func(any) error { return errors.New("called") }); err != nil {
+		t.Errorf("a missing file should have no records, got %v", err)
+	}
+
+	if _, err := NewReader(bytes.NewReader([]byte("not a zip")), 9); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestReaderRejectsNewerVersions(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.manifest.Version = Version + 1
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len())); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+func newRunsDB(t *testing.T) *store.SQLiteDB {
+	t.Helper()
+	db, err := store.NewSQLiteDB(":memory:")
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return db
+}
+
+func TestRunsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := newRunsDB(t)
+
+	created := time.Date(2026, 5, 1, 12, 30, 0, 0, time.UTC)
+	parent := &store.Run{Game: "limbo", NonceStart: 1, NonceEnd: 200, TargetOp: ">=", TargetVal: 2, ParamsJSON: "{}", CreatedAt: created}
+	if err := src.SaveRun(parent); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	child := &store.Run{
+		Game: "limbo", ServerSeed: "server", ServerSeedHash: "abc", ClientSeed: "client",
+		NonceStart: 1, NonceEnd: 200, TargetOp: ">=", TargetVal: 2, ParamsJSON: "{}",
+		ParentRunID: parent.ID, HitCount: 2, Name: "lucky", Tags: []string{"keep"}, CreatedAt: created,
+	}
+	if err := src.SaveRun(child); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	if err := src.SaveHits(child.ID, []store.Hit{{Nonce: 5, Metric: 3}, {Nonce: 9, Metric: 7.5, Details: `{"x":1}`}}); err != nil {
+		t.Fatalf("SaveHits: %v", err)
+	}
+	if err := src.AnnotateHit(child.ID, 9, store.Annotation{Notes: "big one", Tags: []string{"streak"}}); err != nil {
+		t.Fatalf("AnnotateHit: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "runs.zip")
+	m, err := ExportFile(ctx, path, Selection{"runs": {parent.ID}}, NewRunsSection(src))
+	if err != nil {
+		t.Fatalf("ExportFile: %v", err)
+	}
+	if m.Files[runsFile] != 2 || m.Files[hitsFile] != 2 || m.Files[hitAnnotationsFile] != 1 {
+		t.Errorf("unexpected manifest files %v", m.Files)
+	}
+
+	dst := newRunsDB(t)
+	report, err := ImportFile(ctx, path, NewRunsSection(dst))
+	if err != nil {
+		t.Fatalf("ImportFile: %v", err)
+	}
+	if got := report["runs"]; got != (Stats{Added: 2, Items: 2}) {
+		t.Errorf("first import stats = %+v", got)
+	}
+
+	runs, err := dst.ListRunsBySeed("abc", "", "client")
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("ListRunsBySeed = %v, %v", runs, err)
+	}
+	imported := runs[0]
+	if imported.ID == child.ID || imported.ParentRunID == parent.ID || imported.ParentRunID == "" {
+		t.Errorf("IDs not remapped: id %s parent %s", imported.ID, imported.ParentRunID)
+	}
+	if imported.ServerSeed != "server" || imported.Name != "lucky" || len(imported.Tags) != 1 || !imported.CreatedAt.Equal(created) {
+		t.Errorf("run not carried over: %+v", imported)
+	}
+	if children, _ := dst.ListChildRuns(imported.ParentRunID); len(children) != 1 {
+		t.Errorf("expected the batch parent to be imported with its child, got %d children", len(children))
+	}
+	hits, _ := dst.GetHits(imported.ID, 10, 0)
+	if len(hits) != 2 || hits[1].Details != `{"x":1}` {
+		t.Errorf("unexpected hits %+v", hits)
+	}
+	annotations, _ := dst.ListHitAnnotations("", "streak")
+	if len(annotations) != 1 || annotations[0].RunID != imported.ID || annotations[0].Notes != "big one" {
+		t.Errorf("unexpected hit annotations %+v", annotations)
+	}
+
+	// Importing again only finds duplicates
+	report, err = ImportFile(ctx, path, NewRunsSection(dst))
+	if err != nil {
+		t.Fatalf("second ImportFile: %v", err)
+	}
+	if got := report["runs"]; got != (Stats{Duplicates: 2, ItemDuplicates: 2}) {
+		t.Errorf("second import stats = %+v", got)
+	}
+	list, _ := dst.ListRuns(store.RunsQuery{})
+	if list.TotalCount != 2 {
+		t.Errorf("expected 2 runs after importing twice, got %d", list.TotalCount)
+	}
+
+	// The source recognises its own runs too
+	report, err = ImportFile(ctx, path, NewRunsSection(src))
+	if err != nil {
+		t.Fatalf("ImportFile into source: %v", err)
+	}
+	if got := report["runs"]; got.Added != 0 || got.Duplicates != 2 {
+		t.Errorf("import into source stats = %+v", got)
+	}
+}
+
+func TestRunsImportMergesAnnotations(t *testing.T) {
+	ctx := context.Background()
+	src := newRunsDB(t)
+	run := &store.Run{Game: "dice", ServerSeedHash: "h", ClientSeed: "c", NonceStart: 1, NonceEnd: 10, TargetOp: "<", TargetVal: 1}
+	if err := src.SaveRun(run); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	if err := src.SaveHits(run.ID, []store.Hit{{Nonce: 3, Metric: 0.5}}); err != nil {
+		t.Fatalf("SaveHits: %v", err)
+	}
+
+	// A teammate scanned the same seeds and annotated their copy
+	theirs := newRunsDB(t)
+	copyRun := *run
+	copyRun.ID, copyRun.Notes = "", "from a teammate"
+	if err := theirs.SaveRun(&copyRun); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	if err := theirs.SaveHits(copyRun.ID, []store.Hit{{Nonce: 3, Metric: 0.5}}); err != nil {
+		t.Fatalf("SaveHits: %v", err)
+	}
+	if err := theirs.AnnotateHit(copyRun.ID, 3, store.Annotation{Starred: true}); err != nil {
+		t.Fatalf("AnnotateHit: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "theirs.zip")
+	if _, err := ExportFile(ctx, path, Selection{"runs": {copyRun.ID}}, NewRunsSection(theirs)); err != nil {
+		t.Fatalf("ExportFile: %v", err)
+	}
+	report, err := ImportFile(ctx, path, NewRunsSection(src))
+	if err != nil {
+		t.Fatalf("ImportFile: %v", err)
+	}
+	if got := report["runs"]; got.Duplicates != 1 || got.Added != 0 {
+		t.Errorf("stats = %+v", got)
+	}
+	local, _ := src.GetRun(run.ID)
+	if local.Notes != "from a teammate" {
+		t.Errorf("expected the unannotated local run to take the notes, got %q", local.Notes)
+	}
+	if annotations, _ := src.ListHitAnnotations(run.ID, ""); len(annotations) != 1 || !annotations[0].Starred {
+		t.Errorf("expected the hit annotation to be merged, got %+v", annotations)
+	}
+}
+
+func TestRunsImportSavesRunsWithTheirHits(t *testing.T) {
+	ctx := context.Background()
+	created := time.Date(2026, 4, 2, 8, 0, 0, 0, time.UTC)
+	runs := []store.Run{
+		{ID: "a", Game: "dice", ServerSeedHash: "h", ClientSeed: "a", NonceStart: 1, NonceEnd: 10, TargetOp: "<", TargetVal: 1, CreatedAt: created},
+		{ID: "b", Game: "dice", ServerSeedHash: "h", ClientSeed: "b", NonceStart: 1, NonceEnd: 10, TargetOp: "<", TargetVal: 1, CreatedAt: created},
+	}
+	archive := func(hits ...store.Hit) *Reader {
+		t.Helper()
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		write := func(file string, records ...any) {
+			rec, err := w.Create(file)
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			for _, v := range records {
+				if err := rec.Write(v); err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+			}
+		}
+		write(runsFile, runs[0], runs[1])
+		records := make([]any, len(hits))
+		for i, h := range hits {
+			records[i] = h
+		}
+		write(hitsFile, records...)
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("NewReader: %v", err)
+		}
+		return r
+	}
+	hits := []store.Hit{{RunID: "a", Nonce: 2, Metric: 0.5}, {RunID: "b", Nonce: 4, Metric: 0.2}, {RunID: "b", Nonce: 7, Metric: 0.9}}
+
+	// The import stops on a bad record part way through b's hits
+	dst := newRunsDB(t)
+	section := NewRunsSection(dst)
+	broken := append(hits[:2:2], store.Hit{RunID: "gone", Nonce: 9})
+	if _, err := section.Import(ctx, archive(broken...)); err == nil {
+		t.Fatal("expected the import to fail")
+	}
+	if got, _ := dst.ListRunsBySeed("h", "", "b"); len(got) != 0 {
+		t.Fatalf("expected run b rolled back, got %+v", got)
+	}
+
+	stats, err := section.Import(ctx, archive(hits...))
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if stats != (Stats{Added: 1, Duplicates: 1, Items: 2, ItemDuplicates: 1}) {
+		t.Errorf("retry stats = %+v", stats)
+	}
+	b, _ := dst.ListRunsBySeed("h", "", "b")
+	if len(b) != 1 || !b[0].CreatedAt.Equal(created) {
+		t.Fatalf("expected run b imported with its creation time, got %+v", b)
+	}
+	if got, _ := dst.GetHits(b[0].ID, 10, 0); len(got) != 2 {
+		t.Errorf("expected both hits of b, got %+v", got)
+	}
+
+	split := []store.Hit{hits[1], hits[0], hits[2]}
+	if _, err := NewRunsSection(newRunsDB(t)).Import(ctx, archive(split...)); err == nil {
+		t.Error("expected an error for hits of a run that aren't together")
+	}
+}
+
+func newScriptStore(t *testing.T) *scriptstore.Store {
+	t.Helper()
+	s, err := scriptstore.New(filepath.Join(t.TempDir(), "scripts.db"))
+	if err != nil {
+		t.Fatalf("scriptstore.New: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if err := s.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return s
+}
+
+func TestSessionsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := newScriptStore(t)
+	sess := &scriptstore.ScriptSession{Game: "dice", Currency: "trx", Mode: "simulated", ScriptSource: "nextbet = 1", StartBalance: 10}
+	id, err := src.CreateSession(sess)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := src.EndSession(id, "stopped", scriptstore.SessionStats{FinalBalance: 12, TotalBets: 2, TotalProfit: 2}); err != nil {
+		t.Fatalf("EndSession: %v", err)
+	}
+	if err := src.InsertBetsBatch(id, []scriptstore.ScriptBet{{Nonce: 1, Amount: 1}, {Nonce: 2, Amount: 1, Payout: 3, Win: true}}); err != nil {
+		t.Fatalf("InsertBetsBatch: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "sessions.zip")
+	if _, err := ExportFile(ctx, path, Selection{"sessions": {id}}, NewSessionsSection(src)); err != nil {
+		t.Fatalf("ExportFile: %v", err)
+	}
+
+	dst := newScriptStore(t)
+	report, err := ImportFile(ctx, path, NewSessionsSection(dst))
+	if err != nil {
+		t.Fatalf("ImportFile: %v", err)
+	}
+	if got := report["sessions"]; got != (Stats{Added: 1, Items: 2}) {
+		t.Errorf("first import stats = %+v", got)
+	}
+	sessions, total, _ := dst.ListSessions(10, 0)
+	if total != 1 || sessions[0].ID == id || sessions[0].FinalState != "stopped" || sessions[0].TotalProfit != 2 || sessions[0].EndedAt == nil {
+		t.Fatalf("unexpected imported sessions %+v", sessions)
+	}
+
+	report, err = ImportFile(ctx, path, NewSessionsSection(dst))
+	if err != nil {
+		t.Fatalf("second ImportFile: %v", err)
+	}
+	if got := report["sessions"]; got != (Stats{Duplicates: 1, ItemDuplicates: 2}) {
+		t.Errorf("second import stats = %+v", got)
+	}
+
+	// A later archive of the same session only adds the new bets
+	if err := src.InsertBet(id, &scriptstore.ScriptBet{Nonce: 3, Amount: 2}); err != nil {
+		t.Fatalf("InsertBet: %v", err)
+	}
+	if _, err := ExportFile(ctx, path, Selection{"sessions": {id}}, NewSessionsSection(src)); err != nil {
+		t.Fatalf("ExportFile: %v", err)
+	}
+	report, err = ImportFile(ctx, path, NewSessionsSection(dst))
+	if err != nil {
+		t.Fatalf("third ImportFile: %v", err)
+	}
+	if got := report["sessions"]; got != (Stats{Duplicates: 1, Items: 1, ItemDuplicates: 2}) {
+		t.Errorf("third import stats = %+v", got)
+	}
+	bets, _ := dst.ListAllBets(sessions[0].ID)
+	if len(bets) != 3 {
+		t.Errorf("expected 3 bets, got %d", len(bets))
+	}
+}
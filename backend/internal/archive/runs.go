@@ -0,0 +1,392 @@
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+)
+
+const (
+	runsFile           = "runs.ndjson"
+	hitsFile           = "hits.ndjson"
+	hitAnnotationsFile = "hit_annotations.ndjson"
+)
+
+// RunsSection archives scan runs with their hits and annotations.
+// Exporting a batch run brings its child runs along.
+//
+// On import a run is a duplicate of a local run scanning the same seeds
+// (server seed hash and client seed), nonce range, game, params and
+// target; its hits are skipped, and its annotations are only taken where
+// the local run or hit has none. A batch parent, which has no seeds, is a
+// duplicate when one of its children is. Each new run is saved in the
+// same transaction as its hits, keeping its archived creation time.
+type RunsSection struct {
+	db store.DB
+}
+
+// NewRunsSection archives runs stored in db
+func NewRunsSection(db store.DB) *RunsSection {
+	return &RunsSection{db: db}
+}
+
+func (s *RunsSection) Name() string { return "runs" }
+
+func (s *RunsSection) Export(ctx context.Context, w *Writer, ids []string) error {
+	var runs []store.Run
+	seen := map[string]bool{}
+	add := func(run store.Run) {
+		if !seen[run.ID] {
+			seen[run.ID] = true
+			runs = append(runs, run)
+		}
+	}
+	for _, id := range ids {
+		run, err := s.db.GetRun(id)
+		if err != nil {
+			return fmt.Errorf("run %s: %w", id, err)
+		}
+		add(*run)
+		children, err := s.db.ListChildRuns(id)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			add(child)
+		}
+	}
+	// Parents go first so imports can remap the children's parent IDs
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].ParentRunID == "" && runs[j].ParentRunID != ""
+	})
+
+	rec, err := w.Create(runsFile)
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		if run.SeedSealed {
+			return fmt.Errorf("run %s: its server seed is encrypted under a key that isn't loaded", run.ID)
+		}
+		if err := rec.Write(run); err != nil {
+			return err
+		}
+	}
+
+	if rec, err = w.Create(hitsFile); err != nil {
+		return err
+	}
+	for _, run := range runs {
+		for offset := 0; ; offset += batchSize {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			hits, err := s.db.GetHits(run.ID, batchSize, offset)
+			if err != nil {
+				return fmt.Errorf("hits of run %s: %w", run.ID, err)
+			}
+			for _, hit := range hits {
+				if err := rec.Write(hit); err != nil {
+					return err
+				}
+			}
+			if len(hits) < batchSize {
+				break
+			}
+		}
+	}
+
+	if rec, err = w.Create(hitAnnotationsFile); err != nil {
+		return err
+	}
+	for _, run := range runs {
+		annotations, err := s.db.ListHitAnnotations(run.ID, "")
+		if err != nil {
+			return err
+		}
+		for _, ha := range annotations {
+			if err := rec.Write(ha); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// importedRun is where an archived run ended up locally
+type importedRun struct {
+	localID   string
+	duplicate bool
+}
+
+func (s *RunsSection) Import(ctx context.Context, r *Reader) (Stats, error) {
+	var stats Stats
+	var runs []store.Run
+	if err := Each(r, runsFile, func(run store.Run) error {
+		runs = append(runs, run)
+		return nil
+	}); err != nil {
+		return stats, err
+	}
+
+	mapped, err := s.matchRuns(runs)
+	if err != nil {
+		return stats, err
+	}
+	// New runs get their local IDs up front so children can point at
+	// parents that aren't saved yet
+	fresh := map[string]*store.Run{}
+	for _, run := range runs {
+		if m := mapped[run.ID]; m != nil {
+			stats.Duplicates++
+			if err := s.mergeRunAnnotation(m.localID, run); err != nil {
+				return stats, err
+			}
+			continue
+		}
+		local := run
+		fresh[run.ID] = &local
+		mapped[run.ID] = &importedRun{localID: uuid.New().String()}
+	}
+	for archivedID, run := range fresh {
+		run.ID = mapped[archivedID].localID
+		if parent := mapped[run.ParentRunID]; parent != nil {
+			run.ParentRunID = parent.localID
+		} else {
+			// The parent wasn't exported with this run
+			run.ParentRunID = ""
+		}
+	}
+
+	// A run with hits is saved in one transaction with them, so an import
+	// that stops part way leaves it either whole or absent, and a retry
+	// doesn't take a half-saved run for a duplicate
+	withHits := map[string]bool{}
+	if err := Each(r, hitsFile, func(hit struct {
+		RunID string `json:"run_id"`
+	}) error {
+		withHits[hit.RunID] = true
+		return nil
+	}); err != nil {
+		return stats, err
+	}
+	for _, run := range runs {
+		local := fresh[run.ID]
+		if local == nil || withHits[run.ID] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		if err := s.db.SaveRun(local); err != nil {
+			return stats, fmt.Errorf("save run %s: %w", run.ID, err)
+		}
+		stats.Added++
+	}
+
+	var current store.RunImport
+	currentRun, saved := "", 0
+	done := map[string]bool{}
+	var pending []store.Hit
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := current.SaveHits(pending); err != nil {
+			return fmt.Errorf("save hits of run %s: %w", currentRun, err)
+		}
+		saved += len(pending)
+		pending = pending[:0]
+		return nil
+	}
+	commit := func() error {
+		if current == nil {
+			return nil
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		if err := current.Commit(); err != nil {
+			return fmt.Errorf("save run %s: %w", currentRun, err)
+		}
+		current, done[currentRun] = nil, true
+		stats.Added++
+		stats.Items += saved
+		return nil
+	}
+	defer func() {
+		if current != nil {
+			current.Rollback()
+		}
+	}()
+	err = Each(r, hitsFile, func(hit store.Hit) error {
+		m := mapped[hit.RunID]
+		if m == nil {
+			return fmt.Errorf("hit at nonce %d belongs to run %s, which isn't in the archive", hit.Nonce, hit.RunID)
+		}
+		if m.duplicate {
+			stats.ItemDuplicates++
+			return nil
+		}
+		if hit.RunID != currentRun {
+			if err := commit(); err != nil {
+				return err
+			}
+			if done[hit.RunID] {
+				return fmt.Errorf("hits of run %s aren't together in the archive", hit.RunID)
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			imp, err := s.db.ImportRun(fresh[hit.RunID])
+			if err != nil {
+				return fmt.Errorf("save run %s: %w", hit.RunID, err)
+			}
+			current, currentRun, saved = imp, hit.RunID, 0
+		} else if len(pending) >= batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		hit.ID, hit.RunID = 0, m.localID
+		pending = append(pending, hit)
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	if err := commit(); err != nil {
+		return stats, err
+	}
+
+	annotated := map[string]map[uint64]bool{} // local hit annotations of duplicate runs
+	err = Each(r, hitAnnotationsFile, func(ha store.HitAnnotation) error {
+		m := mapped[ha.RunID]
+		if m == nil {
+			return nil
+		}
+		if m.duplicate {
+			if annotated[m.localID] == nil {
+				local, err := s.db.ListHitAnnotations(m.localID, "")
+				if err != nil {
+					return err
+				}
+				annotated[m.localID] = map[uint64]bool{}
+				for _, l := range local {
+					annotated[m.localID][l.Nonce] = true
+				}
+			}
+			if annotated[m.localID][ha.Nonce] {
+				return nil
+			}
+		}
+		err := s.db.AnnotateHit(m.localID, ha.Nonce, ha.Annotation)
+		if errors.Is(err, sql.ErrNoRows) {
+			// The local duplicate doesn't have this hit
+			return nil
+		}
+		return err
+	})
+	return stats, err
+}
+
+// matchRuns finds the local duplicates of archived runs, keyed by archived ID
+func (s *RunsSection) matchRuns(runs []store.Run) (map[string]*importedRun, error) {
+	mapped := map[string]*importedRun{}
+	for _, run := range runs {
+		if run.ClientSeed == "" {
+			continue
+		}
+		local, err := s.db.ListRunsBySeed(run.ServerSeedHash, run.ServerSeed, run.ClientSeed)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range local {
+			if sameScan(run, l) {
+				mapped[run.ID] = &importedRun{localID: l.ID, duplicate: true}
+				break
+			}
+		}
+	}
+
+	// Batch parents follow their children
+	byID := make(map[string]store.Run, len(runs))
+	for _, run := range runs {
+		byID[run.ID] = run
+	}
+	for _, run := range runs {
+		m := mapped[run.ID]
+		if m == nil || run.ParentRunID == "" || mapped[run.ParentRunID] != nil {
+			continue
+		}
+		parent, ok := byID[run.ParentRunID]
+		if !ok {
+			continue
+		}
+		local, err := s.db.GetRun(m.localID)
+		if err != nil {
+			return nil, err
+		}
+		if local.ParentRunID == "" {
+			continue
+		}
+		localParent, err := s.db.GetRun(local.ParentRunID)
+		if err != nil {
+			return nil, err
+		}
+		if sameScan(parent, *localParent) {
+			mapped[parent.ID] = &importedRun{localID: localParent.ID, duplicate: true}
+		}
+	}
+	return mapped, nil
+}
+
+// sameScan reports whether two runs scanned the same seeds and nonces for
+// the same target
+func sameScan(a, b store.Run) bool {
+	return a.Game == b.Game &&
+		seedHash(a) == seedHash(b) &&
+		a.ClientSeed == b.ClientSeed &&
+		a.NonceStart == b.NonceStart &&
+		a.NonceEnd == b.NonceEnd &&
+		a.ParamsJSON == b.ParamsJSON &&
+		a.TargetOp == b.TargetOp &&
+		a.TargetVal == b.TargetVal &&
+		a.Tolerance == b.Tolerance &&
+		a.HitLimit == b.HitLimit
+}
+
+// seedHash is the server seed hash of a run, computed for old runs that
+// only stored the plain seed
+func seedHash(run store.Run) string {
+	if run.ServerSeedHash != "" || run.ServerSeed == "" {
+		return run.ServerSeedHash
+	}
+	sum := sha256.Sum256([]byte(run.ServerSeed))
+	return hex.EncodeToString(sum[:])
+}
+
+// mergeRunAnnotation copies an archived run's annotation onto its local
+// duplicate unless that one is annotated already
+func (s *RunsSection) mergeRunAnnotation(localID string, run store.Run) error {
+	archived := store.Annotation{Name: run.Name, Notes: run.Notes, Tags: run.Tags, Starred: run.Starred}
+	if archived.IsZero() {
+		return nil
+	}
+	local, err := s.db.GetRun(localID)
+	if err != nil {
+		return err
+	}
+	if !(store.Annotation{Name: local.Name, Notes: local.Notes, Tags: local.Tags, Starred: local.Starred}).IsZero() {
+		return nil
+	}
+	return s.db.AnnotateRun(localID, archived)
+}
@@ -0,0 +1,148 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/scriptstore"
+)
+
+const (
+	sessionsFile   = "script_sessions.ndjson"
+	scriptBetsFile = "script_bets.ndjson"
+)
+
+// SessionsSection archives script sessions with their bets.
+//
+// Sessions carry no seeds, so on import a session is a duplicate of a
+// local one with the same game, currency, mode, script and start time.
+// Bets are matched by nonce: a duplicate session only gains the bets it is
+// missing, which lets an archive of a session that was still running top
+// up an earlier import.
+type SessionsSection struct {
+	store *scriptstore.Store
+}
+
+// NewSessionsSection archives sessions kept in store
+func NewSessionsSection(store *scriptstore.Store) *SessionsSection {
+	return &SessionsSection{store: store}
+}
+
+func (s *SessionsSection) Name() string { return "sessions" }
+
+func (s *SessionsSection) Export(ctx context.Context, w *Writer, ids []string) error {
+	if s.store == nil {
+		return errors.New("script store not initialized")
+	}
+	rec, err := w.Create(sessionsFile)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	var exported []string
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		sess, err := s.store.GetSession(id)
+		if err != nil {
+			return err
+		}
+		if err := rec.Write(sess); err != nil {
+			return err
+		}
+		exported = append(exported, id)
+	}
+
+	if rec, err = w.Create(scriptBetsFile); err != nil {
+		return err
+	}
+	for _, id := range exported {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		bets, err := s.store.ListAllBets(id)
+		if err != nil {
+			return err
+		}
+		for _, bet := range bets {
+			if err := rec.Write(bet); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *SessionsSection) Import(ctx context.Context, r *Reader) (Stats, error) {
+	var stats Stats
+	if !r.Has(sessionsFile) {
+		return stats, nil
+	}
+	if s.store == nil {
+		return stats, errors.New("script store not initialized")
+	}
+
+	mapped := map[string]string{}
+	err := Each(r, sessionsFile, func(sess scriptstore.ScriptSession) error {
+		archivedID := sess.ID
+		localID, err := s.store.FindSession(&sess)
+		if err != nil {
+			return err
+		}
+		if localID != "" {
+			stats.Duplicates++
+			mapped[archivedID] = localID
+			return nil
+		}
+		sess.ID = ""
+		if err := s.store.ImportSession(&sess); err != nil {
+			return err
+		}
+		stats.Added++
+		mapped[archivedID] = sess.ID
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	var pending []scriptstore.ScriptBet
+	pendingSession := ""
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		added, err := s.store.ImportBets(pendingSession, pending)
+		if err != nil {
+			return err
+		}
+		stats.Items += added
+		stats.ItemDuplicates += len(pending) - added
+		pending = pending[:0]
+		return nil
+	}
+	err = Each(r, scriptBetsFile, func(bet scriptstore.ScriptBet) error {
+		localID, ok := mapped[bet.SessionID]
+		if !ok {
+			return fmt.Errorf("bet #%d belongs to session %s, which isn't in the archive", bet.Nonce, bet.SessionID)
+		}
+		if localID != pendingSession || len(pending) >= batchSize {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+			pendingSession = localID
+		}
+		pending = append(pending, bet)
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	return stats, flush()
+}
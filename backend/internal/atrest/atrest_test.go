@@ -0,0 +1,235 @@
+package atrest
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func mustKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := NewKey()
+	if err != nil {
+		t.Fatalf("NewKey: %v", err)
+	}
+	return key
+}
+
+func TestCipherSealOpen(t *testing.T) {
+	c, err := NewCipher(mustKey(t))
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+
+	sealed, err := c.Seal("server-seed")
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, "server-seed") || !c.Current(sealed) {
+		t.Fatalf("unexpected sealed value %q", sealed)
+	}
+	again, _ := c.Seal("server-seed")
+	if again == sealed {
+		t.Error("sealing twice should use fresh nonces")
+	}
+	if plain, err := c.Open(sealed); err != nil || plain != "server-seed" {
+		t.Errorf("Open = %q, %v", plain, err)
+	}
+
+	// Legacy plaintext and empty values pass through
+	if plain, err := c.Open("legacy"); err != nil || plain != "legacy" || c.Current("legacy") {
+		t.Errorf("plaintext: Open = %q, %v, current %v", plain, err, c.Current("legacy"))
+	}
+	if sealed, _ := c.Seal(""); sealed != "" {
+		t.Errorf("empty values should stay empty, got %q", sealed)
+	}
+
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if _, err := c.Open(tampered); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt for a tampered value, got %v", err)
+	}
+	other, _ := NewCipher(mustKey(t))
+	if _, err := other.Open(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey, got %v", err)
+	}
+
+	var off *Cipher
+	if v, err := off.Seal("x"); v != "x" || err != nil {
+		t.Errorf("nil cipher should pass through, got %q, %v", v, err)
+	}
+	if _, err := off.Open(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("nil cipher can't open sealed values, got %v", err)
+	}
+}
+
+func TestPassphraseKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seed_key.json")
+
+	keys := NewPassphraseKeys(path, "correct horse")
+	key, pending, err := keys.Load()
+	if err != nil || pending != nil || len(key) != KeySize {
+		t.Fatalf("Load = %d bytes, pending %v, %v", len(key), pending, err)
+	}
+	raw, _ := os.ReadFile(path)
+	if bytes.Contains(raw, key) {
+		t.Fatal("key file holds the data key unwrapped")
+	}
+
+	again, _, err := NewPassphraseKeys(path, "correct horse").Load()
+	if err != nil || !bytes.Equal(again, key) {
+		t.Fatalf("reload returned a different key: %v", err)
+	}
+	if _, _, err := NewPassphraseKeys(path, "wrong").Load(); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("expected ErrWrongPassphrase, got %v", err)
+	}
+
+	next := mustKey(t)
+	if err := keys.SetPending(next); err != nil {
+		t.Fatalf("SetPending: %v", err)
+	}
+	if _, p, _ := NewPassphraseKeys(path, "correct horse").Load(); !bytes.Equal(p, next) {
+		t.Fatal("pending key not persisted")
+	}
+	if err := keys.Promote(); err != nil {
+		t.Fatalf("Promote: %v", err)
+	}
+	if k, p, _ := NewPassphraseKeys(path, "correct horse").Load(); !bytes.Equal(k, next) || p != nil {
+		t.Fatal("pending key not promoted")
+	}
+}
+
+func TestKeyringKeys(t *testing.T) {
+	keyring.MockInit()
+	keys := NewKeyringKeys("atrest-test")
+
+	key, _, err := keys.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	again, _, err := keys.Load()
+	if err != nil || !bytes.Equal(again, key) {
+		t.Fatalf("second Load returned a different key: %v", err)
+	}
+
+	next := mustKey(t)
+	if err := keys.SetPending(next); err != nil {
+		t.Fatalf("SetPending: %v", err)
+	}
+	if err := keys.Promote(); err != nil {
+		t.Fatalf("Promote: %v", err)
+	}
+	if k, p, _ := keys.Load(); !bytes.Equal(k, next) || p != nil {
+		t.Fatal("pending key not promoted")
+	}
+}
+
+// memStore is a sealed store for exercising the vault
+type memStore struct {
+	c    *Cipher
+	rows map[string]string
+	fail bool
+}
+
+func (m *memStore) put(k, plain string) error {
+	sealed, err := m.c.Seal(plain)
+	m.rows[k] = sealed
+	return err
+}
+
+func (m *memStore) get(k string) (string, error) { return m.c.Open(m.rows[k]) }
+
+func (m *memStore) reseal() (int, error) {
+	if m.fail {
+		return 0, errors.New("disk full")
+	}
+	n := 0
+	for k, v := range m.rows {
+		if m.c.Current(v) {
+			continue
+		}
+		sealed, err := m.c.Reseal(v)
+		if err != nil {
+			return n, err
+		}
+		m.rows[k] = sealed
+		n++
+	}
+	return n, nil
+}
+
+func TestVaultMigrateAndRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seed_key.json")
+	v, err := Open(NewPassphraseKeys(path, "pw"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	store := &memStore{c: v.Cipher(), rows: map[string]string{"legacy": "plain-seed"}}
+	v.Register("mem", store.reseal)
+
+	if n, err := v.Migrate(); err != nil || n != 1 || !IsSealed(store.rows["legacy"]) {
+		t.Fatalf("Migrate = %d, %v; row %q", n, err, store.rows["legacy"])
+	}
+	if err := store.put("new", "fresh-seed"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	oldID := v.Status().KeyID
+
+	// A failed reseal leaves the rotation pending and every value readable
+	store.fail = true
+	if _, err := v.Rotate(); err == nil {
+		t.Fatal("expected the rotation to report the failed store")
+	}
+	newID := v.Status().KeyID
+	if newID == oldID {
+		t.Fatal("rotation did not switch keys")
+	}
+	if err := store.put("during", "rotating-seed"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	// Reopening picks the pending rotation up again
+	v2, err := Open(NewPassphraseKeys(path, "pw"))
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if v2.Status().KeyID != newID {
+		t.Fatalf("expected the pending key %s after reopening, got %s", newID, v2.Status().KeyID)
+	}
+	store.c, store.fail = v2.Cipher(), false
+	v2.Register("mem", store.reseal)
+	if n, err := v2.Migrate(); err != nil || n != 2 {
+		t.Fatalf("Migrate = %d, %v", n, err)
+	}
+	for k, want := range map[string]string{"legacy": "plain-seed", "new": "fresh-seed", "during": "rotating-seed"} {
+		if got, err := store.get(k); err != nil || got != want {
+			t.Errorf("%s = %q, %v", k, got, err)
+		}
+		if !v2.Cipher().Current(store.rows[k]) {
+			t.Errorf("%s not sealed under the new key", k)
+		}
+	}
+
+	// The old key is gone once the rotation finished
+	_, pending, _ := NewPassphraseKeys(path, "pw").Load()
+	if pending != nil {
+		t.Error("pending key left behind")
+	}
+	old, _ := NewCipher(mustKey(t))
+	sealedOld, _ := old.Seal("x")
+	if _, err := v2.Cipher().Open(sealedOld); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey, got %v", err)
+	}
+
+	var off *Vault
+	if n, err := off.Migrate(); n != 0 || err != nil || off.Status().Enabled {
+		t.Error("nil vault should be a no-op")
+	}
+	if _, err := off.Rotate(); err == nil {
+		t.Error("rotating without encryption should fail")
+	}
+}
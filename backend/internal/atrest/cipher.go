@@ -0,0 +1,204 @@
+// Package atrest encrypts secrets kept in the app's databases and files.
+// Values are sealed with AES-256-GCM under a random data key, which lives in
+// the OS keyring or is wrapped with a key derived from a passphrase.
+package atrest
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// sealPrefix marks sealed values. Anything without it is legacy plaintext.
+const sealPrefix = "sealed:v1:"
+
+// SealedPattern is a SQL LIKE pattern matching sealed values, for stores
+// that need to know whether they hold any.
+const SealedPattern = sealPrefix + "%"
+
+// KeySize is the length of a data key in bytes
+const KeySize = 32
+
+var (
+	// ErrUnknownKey is returned when opening a value sealed under a key the
+	// cipher doesn't have
+	ErrUnknownKey = errors.New("atrest: value sealed with an unknown key")
+	// ErrCorrupt is returned for sealed values that fail to decode or
+	// authenticate
+	ErrCorrupt = errors.New("atrest: sealed value is corrupt")
+)
+
+// Cipher seals and opens values. It holds the primary key new values are
+// sealed with, plus older keys that are still readable during a rotation.
+// A nil *Cipher passes values through unchanged, so stores work the same
+// with encryption switched off.
+type Cipher struct {
+	mu      sync.RWMutex
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewCipher returns a cipher sealing with primary and also opening values
+// sealed under any of others.
+func NewCipher(primary []byte, others ...[]byte) (*Cipher, error) {
+	c := &Cipher{keys: make(map[string]cipher.AEAD)}
+	for _, key := range others {
+		if _, err := c.add(key); err != nil {
+			return nil, err
+		}
+	}
+	id, err := c.add(primary)
+	if err != nil {
+		return nil, err
+	}
+	c.primary = id
+	return c, nil
+}
+
+// KeyID is a short public fingerprint of a data key
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(append([]byte("atrest key id\x00"), key...))
+	return hex.EncodeToString(sum[:4])
+}
+
+func (c *Cipher) add(key []byte) (string, error) {
+	if len(key) != KeySize {
+		return "", fmt.Errorf("atrest: data key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	id := KeyID(key)
+	c.mu.Lock()
+	c.keys[id] = aead
+	c.mu.Unlock()
+	return id, nil
+}
+
+// KeyID returns the ID of the primary key, or "" for a nil cipher.
+func (c *Cipher) KeyID() string {
+	if c == nil {
+		return ""
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.primary
+}
+
+// Seal encrypts plain under the primary key. Empty strings stay empty.
+func (c *Cipher) Seal(plain string) (string, error) {
+	if c == nil || plain == "" {
+		return plain, nil
+	}
+	c.mu.RLock()
+	id, aead := c.primary, c.keys[c.primary]
+	c.mu.RUnlock()
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("atrest: nonce: %w", err)
+	}
+	header := sealPrefix + id + ":"
+	sealed := aead.Seal(nonce, nonce, []byte(plain), []byte(header))
+	return header + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a sealed value. Values that were never sealed are returned
+// as they are, so rows written before encryption was enabled stay readable.
+func (c *Cipher) Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	id, payload, ok := strings.Cut(strings.TrimPrefix(value, sealPrefix), ":")
+	if !ok {
+		return "", ErrCorrupt
+	}
+	if c == nil {
+		return "", fmt.Errorf("%w %s (encryption is not enabled)", ErrUnknownKey, id)
+	}
+	c.mu.RLock()
+	aead := c.keys[id]
+	c.mu.RUnlock()
+	if aead == nil {
+		return "", fmt.Errorf("%w %s", ErrUnknownKey, id)
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(payload)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrCorrupt
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(sealPrefix+id+":"))
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	return string(plain), nil
+}
+
+// Current reports whether value needs no resealing: it is empty or sealed
+// under the primary key. With a nil cipher every value is current.
+func (c *Cipher) Current(value string) bool {
+	if c == nil || value == "" {
+		return true
+	}
+	return strings.HasPrefix(value, sealPrefix+c.KeyID()+":")
+}
+
+// Reseal opens value with whichever key sealed it and seals it again under
+// the primary key.
+func (c *Cipher) Reseal(value string) (string, error) {
+	plain, err := c.Open(value)
+	if err != nil {
+		return "", err
+	}
+	return c.Seal(plain)
+}
+
+// IsSealed reports whether value was produced by Seal
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealPrefix)
+}
+
+// rotate makes key the primary key, keeping the old ones readable
+func (c *Cipher) rotate(key []byte) error {
+	id, err := c.add(key)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.primary = id
+	c.mu.Unlock()
+	return nil
+}
+
+// retire drops every key but the primary one
+func (c *Cipher) retire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id := range c.keys {
+		if id != c.primary {
+			delete(c.keys, id)
+		}
+	}
+}
+
+// NewKey returns a random data key
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("atrest: generate key: %w", err)
+	}
+	return key, nil
+}
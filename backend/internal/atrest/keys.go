@@ -0,0 +1,286 @@
+package atrest
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+)
+
+// ErrWrongPassphrase is returned when a passphrase doesn't unwrap the key file
+var ErrWrongPassphrase = errors.New("atrest: wrong passphrase")
+
+// KeyStore keeps the data key. While a rotation is in progress it also
+// keeps the pending key that will replace it.
+type KeyStore interface {
+	// Load returns the data key, creating one on first use, and the pending
+	// key if a rotation was interrupted.
+	Load() (key, pending []byte, err error)
+	// SetPending records the key a rotation is moving to
+	SetPending(key []byte) error
+	// Promote replaces the data key with the pending key
+	Promote() error
+	// Mode names where the key is kept
+	Mode() string
+}
+
+const (
+	keyringDataKey    = "atrest/data-key"
+	keyringPendingKey = "atrest/data-key-next"
+)
+
+// KeyringKeys keeps the data key in the OS keyring
+type KeyringKeys struct {
+	service string
+}
+
+// NewKeyringKeys stores keys under the given keyring service name
+func NewKeyringKeys(service string) *KeyringKeys {
+	return &KeyringKeys{service: service}
+}
+
+func (k *KeyringKeys) Mode() string { return "keyring" }
+
+func (k *KeyringKeys) get(user string) ([]byte, error) {
+	encoded, err := keyring.Get(k.service, user)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("atrest: keyring entry %s is not a data key", user)
+	}
+	return key, nil
+}
+
+func (k *KeyringKeys) Load() ([]byte, []byte, error) {
+	key, err := k.get(keyringDataKey)
+	if errors.Is(err, keyring.ErrNotFound) {
+		if key, err = NewKey(); err != nil {
+			return nil, nil, err
+		}
+		if err := keyring.Set(k.service, keyringDataKey, base64.StdEncoding.EncodeToString(key)); err != nil {
+			return nil, nil, fmt.Errorf("atrest: store key in keyring: %w", err)
+		}
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("atrest: read key from keyring: %w", err)
+	}
+
+	pending, err := k.get(keyringPendingKey)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return key, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("atrest: read pending key from keyring: %w", err)
+	}
+	return key, pending, nil
+}
+
+func (k *KeyringKeys) SetPending(key []byte) error {
+	if err := keyring.Set(k.service, keyringPendingKey, base64.StdEncoding.EncodeToString(key)); err != nil {
+		return fmt.Errorf("atrest: store pending key in keyring: %w", err)
+	}
+	return nil
+}
+
+func (k *KeyringKeys) Promote() error {
+	pending, err := keyring.Get(k.service, keyringPendingKey)
+	if err != nil {
+		return fmt.Errorf("atrest: read pending key from keyring: %w", err)
+	}
+	if err := keyring.Set(k.service, keyringDataKey, pending); err != nil {
+		return fmt.Errorf("atrest: store key in keyring: %w", err)
+	}
+	if err := keyring.Delete(k.service, keyringPendingKey); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("atrest: delete pending key from keyring: %w", err)
+	}
+	return nil
+}
+
+// pbkdf2Iterations follows the current OWASP recommendation for
+// PBKDF2-HMAC-SHA256
+const pbkdf2Iterations = 600_000
+
+// keyFile is the on-disk form of PassphraseKeys. Keys are wrapped with
+// AES-GCM under the passphrase-derived key.
+type keyFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Key        []byte `json:"key"`
+	Pending    []byte `json:"pending,omitempty"`
+}
+
+// PassphraseKeys keeps the data key in a file, wrapped with a key derived
+// from a passphrase. Use it where no OS keyring is available.
+type PassphraseKeys struct {
+	path       string
+	passphrase string
+
+	mu  sync.Mutex
+	kek []byte // derived on first use; the KDF is slow on purpose
+}
+
+// NewPassphraseKeys keeps the wrapped key at path
+func NewPassphraseKeys(path, passphrase string) *PassphraseKeys {
+	return &PassphraseKeys{path: path, passphrase: passphrase}
+}
+
+func (p *PassphraseKeys) Mode() string { return "passphrase" }
+
+func (p *PassphraseKeys) read() (*keyFile, error) {
+	raw, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+	var f keyFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("atrest: decode key file: %w", err)
+	}
+	if f.Version != 1 || f.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("atrest: unsupported key file (version %d, kdf %q)", f.Version, f.KDF)
+	}
+	return &f, nil
+}
+
+func (p *PassphraseKeys) write(f *keyFile) error {
+	raw, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o700); err != nil {
+		return fmt.Errorf("atrest: create key dir: %w", err)
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("atrest: write key file: %w", err)
+	}
+	if err := os.Rename(tmp, p.path); err != nil {
+		return fmt.Errorf("atrest: replace key file: %w", err)
+	}
+	return nil
+}
+
+func (p *PassphraseKeys) aead(f *keyFile) (cipher.AEAD, error) {
+	if p.kek == nil {
+		kek, err := pbkdf2.Key(sha256.New, p.passphrase, f.Salt, f.Iterations, KeySize)
+		if err != nil {
+			return nil, fmt.Errorf("atrest: derive key: %w", err)
+		}
+		p.kek = kek
+	}
+	block, err := aes.NewCipher(p.kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (p *PassphraseKeys) wrap(f *keyFile, key []byte) ([]byte, error) {
+	aead, err := p.aead(f)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, key, nil), nil
+}
+
+func (p *PassphraseKeys) unwrap(f *keyFile, wrapped []byte) ([]byte, error) {
+	aead, err := p.aead(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	key, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return key, nil
+}
+
+func (p *PassphraseKeys) Load() ([]byte, []byte, error) {
+	if p.passphrase == "" {
+		return nil, nil, errors.New("atrest: passphrase is empty")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, err := p.read()
+	if errors.Is(err, os.ErrNotExist) {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, nil, err
+		}
+		f = &keyFile{Version: 1, KDF: "pbkdf2-sha256", Iterations: pbkdf2Iterations, Salt: salt}
+		key, err := NewKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		if f.Key, err = p.wrap(f, key); err != nil {
+			return nil, nil, err
+		}
+		if err := p.write(f); err != nil {
+			return nil, nil, err
+		}
+		return key, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := p.unwrap(f, f.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.Pending == nil {
+		return key, nil, nil
+	}
+	pending, err := p.unwrap(f, f.Pending)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, pending, nil
+}
+
+func (p *PassphraseKeys) SetPending(key []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, err := p.read()
+	if err != nil {
+		return err
+	}
+	if f.Pending, err = p.wrap(f, key); err != nil {
+		return err
+	}
+	return p.write(f)
+}
+
+func (p *PassphraseKeys) Promote() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, err := p.read()
+	if err != nil {
+		return err
+	}
+	if f.Pending == nil {
+		return errors.New("atrest: no pending key to promote")
+	}
+	f.Key, f.Pending = f.Pending, nil
+	return p.write(f)
+}
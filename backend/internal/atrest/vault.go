@@ -0,0 +1,144 @@
+package atrest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Status describes the encryption state for display
+type Status struct {
+	Enabled bool   `json:"enabled"`
+	Mode    string `json:"mode,omitempty"`  // "keyring" or "passphrase"
+	KeyID   string `json:"keyId,omitempty"` // fingerprint of the current data key
+}
+
+type sealedStore struct {
+	name   string
+	reseal func() (int, error)
+}
+
+// Vault ties a KeyStore to the cipher built from it and to the stores that
+// seal values with that cipher. Its methods are safe on a nil *Vault, which
+// stands for encryption being switched off.
+type Vault struct {
+	keys   KeyStore
+	cipher *Cipher
+
+	mu      sync.Mutex
+	stores  []sealedStore
+	pending bool
+}
+
+// Open loads the data key from keys. If a rotation was interrupted, the
+// pending key becomes the primary one right away and Migrate finishes the
+// rotation.
+func Open(keys KeyStore) (*Vault, error) {
+	key, pending, err := keys.Load()
+	if err != nil {
+		return nil, err
+	}
+	v := &Vault{keys: keys}
+	if pending != nil {
+		v.cipher, err = NewCipher(pending, key)
+		v.pending = true
+	} else {
+		v.cipher, err = NewCipher(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Cipher returns the cipher stores should seal with
+func (v *Vault) Cipher() *Cipher {
+	if v == nil {
+		return nil
+	}
+	return v.cipher
+}
+
+// Register adds a store to reseal on Migrate and Rotate. reseal rewrites
+// every value that is plaintext or sealed under an older key and returns
+// how many it changed.
+func (v *Vault) Register(name string, reseal func() (int, error)) {
+	if v == nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.stores = append(v.stores, sealedStore{name: name, reseal: reseal})
+}
+
+// Migrate reseals every registered store, which encrypts rows written
+// before encryption was enabled. When a rotation is pending and every
+// store succeeded, the new key replaces the old one for good.
+func (v *Vault) Migrate() (int, error) {
+	if v == nil {
+		return 0, nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.migrateLocked()
+}
+
+func (v *Vault) migrateLocked() (int, error) {
+	total := 0
+	var errs []error
+	for _, s := range v.stores {
+		n, err := s.reseal()
+		total += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reseal %s: %w", s.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		// The old key stays available so the next attempt can finish
+		return total, errors.Join(errs...)
+	}
+
+	if v.pending {
+		if err := v.keys.Promote(); err != nil {
+			return total, err
+		}
+		v.pending = false
+		v.cipher.retire()
+	}
+	return total, nil
+}
+
+// Rotate switches to a fresh data key and reseals every registered store
+// under it. New values are sealed with the new key as soon as it is
+// recorded. If resealing fails part way, the rotation is finished by a
+// later Migrate or Rotate.
+func (v *Vault) Rotate() (int, error) {
+	if v == nil {
+		return 0, errors.New("atrest: encryption is not enabled")
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if !v.pending {
+		key, err := NewKey()
+		if err != nil {
+			return 0, err
+		}
+		if err := v.keys.SetPending(key); err != nil {
+			return 0, err
+		}
+		if err := v.cipher.rotate(key); err != nil {
+			return 0, err
+		}
+		v.pending = true
+	}
+	return v.migrateLocked()
+}
+
+// Status reports whether encryption is on and which key is in use
+func (v *Vault) Status() Status {
+	if v == nil {
+		return Status{}
+	}
+	return Status{Enabled: true, Mode: v.keys.Mode(), KeyID: v.cipher.KeyID()}
+}
@@ -7,6 +7,9 @@ import (
 	"math"
 )
 
+// RNGScheme describes how floats are derived from the seeds, for run manifests
+const RNGScheme = "hmac-sha256(server_seed, client_seed:nonce:round) / 4 bytes per float"
+
 // ByteGenerator generates cryptographically secure bytes using HMAC-SHA256
 // for streaming approach to float generation
 type ByteGenerator struct {
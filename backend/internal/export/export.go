@@ -0,0 +1,157 @@
+// Package export streams typed result sets to NDJSON or Parquet files.
+//
+// Rows are written one at a time through a RowWriter, so exports of
+// millions of rows never hold more than a row group in memory. Unlike CSV
+// both formats keep column types: NDJSON as JSON numbers and booleans,
+// Parquet as typed columns.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Format is an export file format
+type Format string
+
+const (
+	NDJSON  Format = "ndjson"
+	Parquet Format = "parquet"
+)
+
+// ParseFormat accepts a format name or file extension, case-insensitively.
+// An empty name is NDJSON.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "", "ndjson", "jsonl":
+		return NDJSON, nil
+	case "parquet":
+		return Parquet, nil
+	}
+	return "", fmt.Errorf("unsupported export format %q (want ndjson or parquet)", name)
+}
+
+// ContentType is the MIME type served for the format
+func (f Format) ContentType() string {
+	if f == Parquet {
+		return "application/vnd.apache.parquet"
+	}
+	return "application/x-ndjson"
+}
+
+// Ext is the file extension for the format, without the dot
+func (f Format) Ext() string {
+	return string(f)
+}
+
+// Kind is the type of a column's values
+type Kind int
+
+const (
+	Int64     Kind = iota // int64
+	Float64               // float64
+	Bool                  // bool
+	String                // string
+	JSON                  // json.RawMessage or a JSON string, kept as text in Parquet
+	Timestamp             // time.Time, microseconds UTC in Parquet
+)
+
+// Column describes one column of an export. Only optional columns accept
+// nil values.
+type Column struct {
+	Name     string
+	Kind     Kind
+	Optional bool
+}
+
+// RowWriter writes rows whose values line up with its columns
+type RowWriter interface {
+	// Write appends a row. Values must match their column's Kind, or be nil
+	// for optional columns.
+	Write(row []any) error
+	// Flush pushes buffered rows to the underlying writer. For Parquet this
+	// ends the current row group.
+	Flush() error
+	// Close flushes and finishes the file. It doesn't close the underlying
+	// writer.
+	Close() error
+}
+
+// NewRowWriter writes rows with the given columns to w
+func NewRowWriter(w io.Writer, format Format, columns []Column) (RowWriter, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("export has no columns")
+	}
+	seen := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		if seen[c.Name] {
+			return nil, fmt.Errorf("duplicate export column %q", c.Name)
+		}
+		seen[c.Name] = true
+	}
+	switch format {
+	case NDJSON:
+		return newNDJSONWriter(w, columns), nil
+	case Parquet:
+		return newParquetWriter(w, columns)
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+// checkValue reports whether v is a valid value for column c
+func checkValue(c Column, v any) error {
+	if v == nil {
+		if c.Optional {
+			return nil
+		}
+		return fmt.Errorf("column %s: value required", c.Name)
+	}
+	ok := false
+	switch c.Kind {
+	case Int64:
+		_, ok = v.(int64)
+	case Float64:
+		_, ok = v.(float64)
+	case Bool:
+		_, ok = v.(bool)
+	case String:
+		_, ok = v.(string)
+	case JSON:
+		switch v.(type) {
+		case json.RawMessage, string:
+			ok = true
+		}
+	case Timestamp:
+		_, ok = v.(time.Time)
+	}
+	if !ok {
+		return fmt.Errorf("column %s: unexpected value of type %T", c.Name, v)
+	}
+	return nil
+}
+
+// rawJSON is the text of a JSON column value, or nil for an empty one
+func rawJSON(v any) json.RawMessage {
+	var raw json.RawMessage
+	switch v := v.(type) {
+	case json.RawMessage:
+		raw = v
+	case string:
+		raw = json.RawMessage(v)
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	return raw
+}
+
+func errRowLength(got, want int) error {
+	return fmt.Errorf("row has %d values, want %d", got, want)
+}
+
+func errInvalidJSON(column string) error {
+	return fmt.Errorf("column %s: invalid JSON", column)
+}
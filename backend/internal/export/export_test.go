@@ -0,0 +1,259 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+)
+
+func TestParseFormat(t *testing.T) {
+	for name, want := range map[string]Format{"": NDJSON, "jsonl": NDJSON, ".parquet": Parquet, "PARQUET": Parquet} {
+		if got, err := ParseFormat(name); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("csv"); err == nil {
+		t.Error("expected csv to be rejected")
+	}
+}
+
+var testColumns = []Column{
+	{Name: "n", Kind: Int64},
+	{Name: "x", Kind: Float64},
+	{Name: "ok", Kind: Bool, Optional: true},
+	{Name: "s", Kind: String},
+	{Name: "j", Kind: JSON, Optional: true},
+	{Name: "at", Kind: Timestamp},
+}
+
+func testRow(i int) []any {
+	var ok any
+	if i%2 == 0 {
+		ok = i%4 == 0
+	}
+	return []any{int64(i), float64(i) / 2, ok, fmt.Sprint("s", i),
+		json.RawMessage(fmt.Sprintf(`{"i":%d}`, i)), time.Unix(int64(i), 0).UTC()}
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	var buf bytes.Buffer
+	rw, err := NewRowWriter(&buf, NDJSON, testColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := rw.Write(testRow(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3", len(lines))
+	}
+	want := `{"n":1,"x":0.5,"ok":null,"s":"s1","j":{"i":1},"at":"1970-01-01T00:00:01Z"}`
+	if string(lines[1]) != want {
+		t.Errorf("line 1 = %s\nwant %s", lines[1], want)
+	}
+}
+
+func TestWriterRejectsBadValues(t *testing.T) {
+	for _, format := range []Format{NDJSON, Parquet} {
+		rw, err := NewRowWriter(io.Discard, format, testColumns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		row := testRow(1)
+		row[0] = nil
+		if err := rw.Write(row); err == nil {
+			t.Errorf("%s: expected an error for a null required value", format)
+		}
+		row = testRow(1)
+		row[1] = "1.5"
+		if err := rw.Write(row); err == nil {
+			t.Errorf("%s: expected an error for a mistyped value", format)
+		}
+		if err := rw.Write(testRow(1)[:2]); err == nil {
+			t.Errorf("%s: expected an error for a short row", format)
+		}
+	}
+	if _, err := NewRowWriter(io.Discard, NDJSON, []Column{{Name: "a"}, {Name: "a"}}); err == nil {
+		t.Error("expected an error for duplicate columns")
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+	var buf bytes.Buffer
+	rw, err := NewRowWriter(&buf, Parquet, testColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 3000
+	for i := 0; i < n; i++ {
+		if err := rw.Write(testRow(i)); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1500 {
+			if err := rw.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	type row struct {
+		N  int64     `parquet:"n"`
+		X  float64   `parquet:"x"`
+		OK *bool     `parquet:"ok,optional"`
+		S  string    `parquet:"s"`
+		J  string    `parquet:"j,optional"`
+		At time.Time `parquet:"at,timestamp(microsecond)"`
+	}
+	r := parquet.NewGenericReader[row](bytes.NewReader(buf.Bytes()))
+	defer r.Close()
+	if r.NumRows() != n {
+		t.Fatalf("file has %d rows, want %d", r.NumRows(), n)
+	}
+	rows := make([]row, n)
+	if got, err := r.Read(rows); got != n || (err != nil && err != io.EOF) {
+		t.Fatalf("read %d rows: %v", got, err)
+	}
+	for _, i := range []int{0, 1, 2, 1501, n - 1} {
+		got := rows[i]
+		if got.N != int64(i) || got.X != float64(i)/2 || got.S != fmt.Sprint("s", i) ||
+			got.J != fmt.Sprintf(`{"i":%d}`, i) || !got.At.Equal(time.Unix(int64(i), 0)) {
+			t.Errorf("row %d = %+v", i, got)
+		}
+		if (i%2 == 0) != (got.OK != nil) || (got.OK != nil && *got.OK != (i%4 == 0)) {
+			t.Errorf("row %d: ok = %v", i, got.OK)
+		}
+	}
+}
+
+func hitsSource(hits []store.HitWithDelta) HitsSource {
+	return func(fn func(store.HitWithDelta) error) error {
+		for _, h := range hits {
+			if err := fn(h); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestWriteHits(t *testing.T) {
+	var hits []store.HitWithDelta
+	for i := 0; i < detailsSample+500; i++ {
+		details := fmt.Sprintf(`{"roll":%d,"raw_float":0.%d5,"mixed":%d,"risk":"high","draws":[1,2]}`, i, i, i)
+		if i == 3 {
+			details = `{"roll":3,"raw_float":0.35,"mixed":"three","risk":"high","draws":[1,2]}`
+		}
+		if i == detailsSample+10 {
+			// After the sample, a value that doesn't fit its column
+			details = `{"roll":1.5,"raw_float":0.5,"mixed":1,"risk":"high","draws":[]}`
+		}
+		h := store.HitWithDelta{Hit: store.Hit{Nonce: uint64(i + 1), Metric: float64(i), Details: details}}
+		if i > 0 {
+			delta := uint64(1)
+			h.DeltaNonce = &delta
+		}
+		hits = append(hits, h)
+	}
+
+	var buf bytes.Buffer
+	var reported []int64
+	n, err := WriteHits(context.Background(), &buf, NDJSON, hitsSource(hits), func(rows int64) {
+		reported = append(reported, rows)
+	})
+	if err != nil || n != int64(len(hits)) {
+		t.Fatalf("WriteHits = %d, %v", n, err)
+	}
+	if len(reported) == 0 || reported[len(reported)-1] != n {
+		t.Errorf("progress reported %v", reported)
+	}
+
+	var rows []map[string]any
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var row map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &row); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) != len(hits) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(hits))
+	}
+	first, last := rows[0], rows[len(rows)-1]
+	if first["delta_nonce"] != nil || last["delta_nonce"] != float64(1) || first["rank"] != nil {
+		t.Errorf("unexpected delta or rank in %v / %v", first, last)
+	}
+	if first["details_roll"] != float64(0) || first["details_raw_float"] != 0.05 || first["details_risk"] != "high" {
+		t.Errorf("unexpected details columns in %v", first)
+	}
+	if draws, ok := first["details_draws"].([]any); !ok || len(draws) != 2 {
+		t.Errorf("details_draws = %v", first["details_draws"])
+	}
+	if first["details_mixed"] != float64(0) || rows[3]["details_mixed"] != "three" {
+		t.Errorf("mixed column = %v, %v", first["details_mixed"], rows[3]["details_mixed"])
+	}
+	if late := rows[detailsSample+10]; late["details_roll"] != nil || late["details"] == nil {
+		t.Errorf("a value that doesn't fit should be null, got %v", late)
+	}
+
+	buf.Reset()
+	if _, err := WriteHits(context.Background(), &buf, Parquet, hitsSource(hits), nil); err != nil {
+		t.Fatal(err)
+	}
+	f, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.NumRows() != int64(len(hits)) {
+		t.Errorf("parquet file has %d rows", f.NumRows())
+	}
+	kinds := map[string]parquet.Kind{}
+	for _, field := range f.Schema().Fields() {
+		kinds[field.Name()] = field.Type().Kind()
+	}
+	for name, want := range map[string]parquet.Kind{
+		"nonce":             parquet.Int64,
+		"metric":            parquet.Double,
+		"details_roll":      parquet.Int64,
+		"details_raw_float": parquet.Double,
+		"details_risk":      parquet.ByteArray,
+	} {
+		if kinds[name] != want {
+			t.Errorf("column %s is %v, want %v", name, kinds[name], want)
+		}
+	}
+}
+
+func TestWriteHitsEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := WriteHits(context.Background(), &buf, Parquet, hitsSource(nil), nil)
+	if err != nil || n != 0 {
+		t.Fatalf("WriteHits = %d, %v", n, err)
+	}
+	f, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("an empty export should still be a valid file: %v", err)
+	}
+	if f.NumRows() != 0 {
+		t.Errorf("file has %d rows", f.NumRows())
+	}
+}
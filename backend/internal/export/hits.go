@@ -0,0 +1,228 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+)
+
+const (
+	// detailsSample is how many hits are read to work out the details columns
+	detailsSample = 1000
+	// flushEvery is how often, in rows, an export is pushed to its writer
+	// and progress is reported
+	flushEvery = 10000
+)
+
+// Progress is told how many rows an export has written so far
+type Progress func(rows int64)
+
+// HitsSource streams hits to fn in export order, such as store.DB.EachHit
+type HitsSource func(fn func(store.HitWithDelta) error) error
+
+// hitColumns are the columns every hits export starts with
+var hitColumns = []Column{
+	{Name: "nonce", Kind: Int64},
+	{Name: "metric", Kind: Float64},
+	{Name: "rank", Kind: Int64, Optional: true},
+	{Name: "delta_nonce", Kind: Int64, Optional: true},
+	{Name: "details", Kind: JSON, Optional: true},
+}
+
+// WriteHits exports hits to w. Besides the raw details JSON, each key of
+// the game's details becomes a typed details_<key> column. Column types
+// are inferred from the first hits; a later value that doesn't fit its
+// column is left null there, and is still in the details column.
+func WriteHits(ctx context.Context, w io.Writer, format Format, source HitsSource, progress Progress) (int64, error) {
+	var (
+		sample  []store.HitWithDelta
+		rw      RowWriter
+		details []detailsColumn
+		written int64
+	)
+	write := func(hit store.HitWithDelta) error {
+		row := make([]any, 0, len(hitColumns)+len(details))
+		row = append(row, int64(hit.Nonce), hit.Metric, nil, nil, nil)
+		if hit.Rank != nil {
+			row[2] = int64(*hit.Rank)
+		}
+		if hit.DeltaNonce != nil {
+			row[3] = int64(*hit.DeltaNonce)
+		}
+		var fields map[string]any
+		if hit.Details != "" {
+			row[4] = json.RawMessage(hit.Details)
+			fields = parseDetails(hit.Details)
+		}
+		for _, d := range details {
+			row = append(row, d.value(fields[d.key]))
+		}
+		if err := rw.Write(row); err != nil {
+			return err
+		}
+		written++
+		if written%flushEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := rw.Flush(); err != nil {
+				return err
+			}
+			if progress != nil {
+				progress(written)
+			}
+		}
+		return nil
+	}
+	start := func() error {
+		details = inferDetails(sample)
+		columns := append([]Column{}, hitColumns...)
+		for _, d := range details {
+			columns = append(columns, Column{Name: "details_" + d.key, Kind: d.kind, Optional: true})
+		}
+		var err error
+		if rw, err = NewRowWriter(w, format, columns); err != nil {
+			return err
+		}
+		for _, hit := range sample {
+			if err := write(hit); err != nil {
+				return err
+			}
+		}
+		sample = nil
+		return nil
+	}
+
+	err := source(func(hit store.HitWithDelta) error {
+		if rw != nil {
+			return write(hit)
+		}
+		sample = append(sample, hit)
+		if len(sample) < detailsSample {
+			return nil
+		}
+		return start()
+	})
+	if err == nil && rw == nil {
+		err = start()
+	}
+	if err != nil {
+		return written, err
+	}
+	if err := rw.Close(); err != nil {
+		return written, err
+	}
+	if progress != nil {
+		progress(written)
+	}
+	return written, nil
+}
+
+// detailsColumn is a details key exported as its own column
+type detailsColumn struct {
+	key  string
+	kind Kind
+}
+
+// parseDetails decodes a details object, keeping numbers exact. Details
+// that aren't an object give no fields.
+func parseDetails(details string) map[string]any {
+	dec := json.NewDecoder(strings.NewReader(details))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// inferDetails works out the details columns of sampled hits, sorted by
+// key. Integers widen to floats when a key holds both; any other mix of
+// types, and arrays and objects, are exported as JSON.
+func inferDetails(hits []store.HitWithDelta) []detailsColumn {
+	kinds := map[string]Kind{}
+	for _, hit := range hits {
+		for key, v := range parseDetails(hit.Details) {
+			kind, ok := kindOf(v)
+			if !ok {
+				continue
+			}
+			prev, seen := kinds[key]
+			switch {
+			case !seen || prev == kind:
+				kinds[key] = kind
+			case (prev == Int64 && kind == Float64) || (prev == Float64 && kind == Int64):
+				kinds[key] = Float64
+			default:
+				kinds[key] = JSON
+			}
+		}
+	}
+	columns := make([]detailsColumn, 0, len(kinds))
+	for key, kind := range kinds {
+		columns = append(columns, detailsColumn{key: key, kind: kind})
+	}
+	sort.Slice(columns, func(i, j int) bool { return columns[i].key < columns[j].key })
+	return columns
+}
+
+// kindOf is the column kind for a decoded details value; nulls have none
+func kindOf(v any) (Kind, bool) {
+	switch v := v.(type) {
+	case nil:
+		return 0, false
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return Int64, true
+		}
+		return Float64, true
+	case bool:
+		return Bool, true
+	case string:
+		return String, true
+	}
+	return JSON, true
+}
+
+// value converts a decoded details value for the column, or nil when it
+// doesn't fit
+func (d detailsColumn) value(v any) any {
+	if v == nil {
+		return nil
+	}
+	switch d.kind {
+	case Int64:
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				return i
+			}
+		}
+	case Float64:
+		if n, ok := v.(json.Number); ok {
+			if f, err := n.Float64(); err == nil {
+				return f
+			}
+		}
+	case Bool:
+		if b, ok := v.(bool); ok {
+			return b
+		}
+	case String:
+		if s, ok := v.(string); ok {
+			return s
+		}
+	case JSON:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err == nil {
+			return json.RawMessage(bytes.TrimSpace(buf.Bytes()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// ndjsonWriter writes each row as a JSON object on its own line, with keys
+// in column order. Null values are written as null rather than omitted so
+// every line has the same keys.
+type ndjsonWriter struct {
+	w       *bufio.Writer
+	columns []Column
+	keys    [][]byte // `"name":` for each column
+	line    []byte
+}
+
+func newNDJSONWriter(w io.Writer, columns []Column) *ndjsonWriter {
+	keys := make([][]byte, len(columns))
+	for i, c := range columns {
+		name, _ := json.Marshal(c.Name)
+		keys[i] = append(name, ':')
+	}
+	return &ndjsonWriter{w: bufio.NewWriterSize(w, 64<<10), columns: columns, keys: keys}
+}
+
+func (n *ndjsonWriter) Write(row []any) error {
+	if len(row) != len(n.columns) {
+		return errRowLength(len(row), len(n.columns))
+	}
+	line := append(n.line[:0], '{')
+	for i, c := range n.columns {
+		if err := checkValue(c, row[i]); err != nil {
+			return err
+		}
+		if i > 0 {
+			line = append(line, ',')
+		}
+		line = append(line, n.keys[i]...)
+
+		var value []byte
+		switch v := row[i].(type) {
+		case nil:
+			value = []byte("null")
+		case time.Time:
+			value = []byte(`"` + v.UTC().Format(time.RFC3339Nano) + `"`)
+		default:
+			if c.Kind == JSON {
+				if raw := rawJSON(v); raw != nil {
+					if !json.Valid(raw) {
+						return errInvalidJSON(c.Name)
+					}
+					value = raw
+				} else {
+					value = []byte("null")
+				}
+				break
+			}
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			value = b
+		}
+		line = append(line, value...)
+	}
+	line = append(line, '}', '\n')
+	n.line = line
+	_, err := n.w.Write(line)
+	return err
+}
+
+func (n *ndjsonWriter) Flush() error { return n.w.Flush() }
+
+func (n *ndjsonWriter) Close() error { return n.w.Flush() }
@@ -0,0 +1,144 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetWriter writes rows to a Parquet file built from the columns.
+// A row group ends at each Flush and every rowGroupSize rows.
+type parquetWriter struct {
+	w       *parquet.Writer
+	columns []Column
+	leaf    []int // parquet column index of each column
+	rows    []parquet.Row
+}
+
+const (
+	// parquetBatch is how many rows are handed to the parquet writer at once
+	parquetBatch = 1024
+	// rowGroupSize caps the rows buffered in memory between row groups
+	rowGroupSize = 64 << 10
+)
+
+func newParquetWriter(w io.Writer, columns []Column) (*parquetWriter, error) {
+	group := make(parquet.Group, len(columns))
+	for _, c := range columns {
+		group[c.Name] = parquetNode(c)
+	}
+	schema := parquet.NewSchema("export", group)
+
+	// The schema orders its fields by name, not column order
+	leaf := make([]int, len(columns))
+	for i, c := range columns {
+		lc, ok := schema.Lookup(c.Name)
+		if !ok {
+			return nil, fmt.Errorf("column %s missing from parquet schema", c.Name)
+		}
+		leaf[i] = lc.ColumnIndex
+	}
+
+	pw := parquet.NewWriter(w, schema,
+		parquet.Compression(&parquet.Zstd),
+		parquet.MaxRowsPerRowGroup(rowGroupSize))
+	return &parquetWriter{
+		w:       pw,
+		columns: columns,
+		leaf:    leaf,
+	}, nil
+}
+
+func parquetNode(c Column) parquet.Node {
+	var node parquet.Node
+	switch c.Kind {
+	case Int64:
+		node = parquet.Int(64)
+	case Float64:
+		node = parquet.Leaf(parquet.DoubleType)
+	case Bool:
+		node = parquet.Leaf(parquet.BooleanType)
+	case String:
+		node = parquet.String()
+	case JSON:
+		node = parquet.JSON()
+	case Timestamp:
+		node = parquet.Timestamp(parquet.Microsecond)
+	}
+	if c.Optional {
+		node = parquet.Optional(node)
+	}
+	return node
+}
+
+func (p *parquetWriter) Write(row []any) error {
+	if len(row) != len(p.columns) {
+		return errRowLength(len(row), len(p.columns))
+	}
+	values := make(parquet.Row, len(row))
+	for i, c := range p.columns {
+		if err := checkValue(c, row[i]); err != nil {
+			return err
+		}
+		var value parquet.Value
+		switch v := row[i].(type) {
+		case nil:
+			value = parquet.NullValue()
+		case int64:
+			value = parquet.Int64Value(v)
+		case float64:
+			value = parquet.DoubleValue(v)
+		case bool:
+			value = parquet.BooleanValue(v)
+		case time.Time:
+			value = parquet.Int64Value(v.UnixMicro())
+		default:
+			if c.Kind == JSON {
+				if raw := rawJSON(v); raw != nil {
+					value = parquet.ByteArrayValue(raw)
+				} else if c.Optional {
+					value = parquet.NullValue()
+				} else {
+					value = parquet.ByteArrayValue([]byte("null"))
+				}
+			} else {
+				value = parquet.ByteArrayValue([]byte(v.(string)))
+			}
+		}
+		def := 0
+		if c.Optional && !value.IsNull() {
+			def = 1
+		}
+		values[p.leaf[i]] = value.Level(0, def, p.leaf[i])
+	}
+	p.rows = append(p.rows, values)
+	if len(p.rows) >= parquetBatch {
+		return p.writeRows()
+	}
+	return nil
+}
+
+func (p *parquetWriter) writeRows() error {
+	if len(p.rows) == 0 {
+		return nil
+	}
+	_, err := p.w.WriteRows(p.rows)
+	p.rows = p.rows[:0]
+	return err
+}
+
+func (p *parquetWriter) Flush() error {
+	if err := p.writeRows(); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+func (p *parquetWriter) Close() error {
+	if err := p.writeRows(); err != nil {
+		return err
+	}
+	return p.w.Close()
+}
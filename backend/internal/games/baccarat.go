@@ -9,10 +9,23 @@ import (
 // BaccaratGame implements the Baccarat provably fair game.
 // Uses unlimited deck (each card drawn independently from 52 cards).
 // Maximum 6 cards needed per game (3 player + 3 banker).
+//
+// The "metric" param selects what is scanned:
+//   - "first_card": index (0-51) of the first card dealt (default)
+//   - "winner":     0 = player, 1 = banker, 2 = tie
+//   - "natural":    1 when either side has 8 or 9 on two cards, else 0
+//   - "pair":       1 = player pair, 2 = banker pair, 3 = both, 0 = none
+//   - "tie":        1 on a tie, else 0
+//   - "payout":     amount returned / amount staked for the "betamount" split
 type BaccaratGame struct{}
 
 const (
 	baccaratMaxCards = 6
+
+	// Returns per unit staked, including the stake.
+	baccaratPlayerReturn = 2.0
+	baccaratBankerReturn = 1.95
+	baccaratTieReturn    = 9.0
 )
 
 // Spec returns metadata about the Baccarat game.
@@ -24,6 +37,21 @@ func (g *BaccaratGame) Spec() GameSpec {
 	}
 }
 
+// ParamSchema describes baccarat's parameters. Stakes for the payout
+// metric come in "betamount" or as top-level sides.
+func (g *BaccaratGame) ParamSchema() ParamSchema {
+	return ParamSchema{Params: map[string]ParamSpec{
+		"metric": {Type: ParamString, Enum: []string{"first_card", "winner", "natural", "pair", "tie", "payout"}},
+		"betamount": {Type: ParamObject, Parse: func(params map[string]any) error {
+			_, err := baccaratBetsFromParams(params)
+			return err
+		}},
+		"player": {Type: ParamNumber},
+		"banker": {Type: ParamNumber},
+		"tie":    {Type: ParamNumber},
+	}}
+}
+
 // FloatCount returns the number of floats required (6 max).
 func (g *BaccaratGame) FloatCount(params map[string]any) int {
 	return baccaratMaxCards
@@ -94,6 +122,10 @@ func (g *BaccaratGame) EvaluateWithFloats(floats []float64, params map[string]an
 		winner = "tie"
 	}
 
+	natural := baccaratHandScore(playerCards[:2]) >= 8 || baccaratHandScore(bankerCards[:2]) >= 8
+	playerPair := playerCards[0].Rank == playerCards[1].Rank
+	bankerPair := bankerCards[0].Rank == bankerCards[1].Rank
+
 	// Build card string lists
 	playerStrs := make([]string, len(playerCards))
 	for i, c := range playerCards {
@@ -104,24 +136,122 @@ func (g *BaccaratGame) EvaluateWithFloats(floats []float64, params map[string]an
 		bankerStrs[i] = c.String()
 	}
 
-	// First card index (0-51) as metric (for scanning)
-	firstCardIndex := cardIndexFromFloat(floats[0])
+	details := map[string]any{
+		"player_cards": playerStrs,
+		"banker_cards": bankerStrs,
+		"player_score": playerScore,
+		"banker_score": bankerScore,
+		"winner":       winner,
+		"player_draws": playerDraws,
+		"banker_draws": bankerDraws,
+		"natural":      natural,
+		"player_pair":  playerPair,
+		"banker_pair":  bankerPair,
+	}
+
+	mode := "first_card"
+	if m, ok := params["metric"].(string); ok && m != "" {
+		mode = m
+	}
+
+	var metric float64
+	switch mode {
+	case "first_card":
+		// First card index (0-51) as metric (for scanning)
+		metric = float64(cardIndexFromFloat(floats[0]))
+	case "winner":
+		metric = map[string]float64{"player": 0, "banker": 1, "tie": 2}[winner]
+	case "natural":
+		metric = boolMetric(natural)
+	case "pair":
+		metric = boolMetric(playerPair) + 2*boolMetric(bankerPair)
+	case "tie":
+		metric = boolMetric(winner == "tie")
+	case "payout":
+		bets, err := baccaratBetsFromParams(params)
+		if err != nil {
+			return GameResult{}, err
+		}
+		metric = baccaratPayout(bets, winner)
+		details["bets"] = bets
+		details["payout_multiplier"] = metric
+	default:
+		return GameResult{}, fmt.Errorf("baccarat metric must be one of first_card, winner, natural, pair, tie, payout; got %q", mode)
+	}
 
 	return GameResult{
-		Metric:      float64(firstCardIndex),
-		MetricLabel: "first_card",
-		Details: map[string]any{
-			"player_cards": playerStrs,
-			"banker_cards": bankerStrs,
-			"player_score": playerScore,
-			"banker_score": bankerScore,
-			"winner":       winner,
-			"player_draws": playerDraws,
-			"banker_draws": bankerDraws,
-		},
+		Metric:      metric,
+		MetricLabel: mode,
+		Details:     details,
 	}, nil
 }
 
+// baccaratBetsFromParams reads the stake on each side from "betamount"
+// ({"player", "banker", "tie"}, as in the scripting globals) or from
+// top-level "player", "banker" and "tie" params.
+func baccaratBetsFromParams(params map[string]any) (map[string]float64, error) {
+	bets := map[string]float64{"player": 0, "banker": 0, "tie": 0}
+	source := params
+	switch v := params["betamount"].(type) {
+	case nil:
+	case map[string]any:
+		source = v
+	case map[string]float64:
+		source = make(map[string]any, len(v))
+		for k, amt := range v {
+			source[k] = amt
+		}
+	default:
+		return nil, fmt.Errorf("baccarat betamount must be an object, got %T", v)
+	}
+	for side := range bets {
+		switch amt := source[side].(type) {
+		case nil:
+		case float64:
+			bets[side] = amt
+		case int:
+			bets[side] = float64(amt)
+		default:
+			return nil, fmt.Errorf("baccarat %s bet must be a number, got %T", side, amt)
+		}
+	}
+
+	total := 0.0
+	for side, amt := range bets {
+		if amt < 0 {
+			return nil, fmt.Errorf("baccarat %s bet must not be negative, got %f", side, amt)
+		}
+		total += amt
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("baccarat payout metric requires a positive betamount")
+	}
+	return bets, nil
+}
+
+// baccaratPayout returns the amount returned divided by the amount staked.
+// Player and banker bets push on a tie.
+func baccaratPayout(bets map[string]float64, winner string) float64 {
+	total := bets["player"] + bets["banker"] + bets["tie"]
+	var returned float64
+	switch winner {
+	case "player":
+		returned = bets["player"] * baccaratPlayerReturn
+	case "banker":
+		returned = bets["banker"] * baccaratBankerReturn
+	default:
+		returned = bets["tie"]*baccaratTieReturn + bets["player"] + bets["banker"]
+	}
+	return returned / total
+}
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 // baccaratHandScore calculates the baccarat hand score (sum of card values mod 10).
 func baccaratHandScore(cards []Card) int {
 	total := 0
@@ -1,6 +1,9 @@
 package games
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestBaccaratGame(t *testing.T) {
 	game := &BaccaratGame{}
@@ -178,3 +181,56 @@ func TestBaccaratDeterminism(t *testing.T) {
 		t.Errorf("determinism failed: %f != %f", r1.Metric, r2.Metric)
 	}
 }
+
+func TestBaccaratMetricModes(t *testing.T) {
+	game := &BaccaratGame{}
+	// Player 4+5 = 9 (natural), banker 4+4 = 8 (natural, pair): player wins.
+	floats := rankFloats("4", "4", "5", "4", "2", "2")
+
+	tests := []struct {
+		params map[string]any
+		want   float64
+	}{
+		{map[string]any{"metric": "winner"}, 0},
+		{map[string]any{"metric": "natural"}, 1},
+		{map[string]any{"metric": "pair"}, 2},
+		{map[string]any{"metric": "tie"}, 0},
+		{map[string]any{"metric": "payout", "betamount": map[string]any{"player": 1.0}}, 2},
+		{map[string]any{"metric": "payout", "betamount": map[string]float64{"player": 1, "banker": 1}}, 1},
+		{map[string]any{"metric": "payout", "banker": 2.0}, 0},
+	}
+	for _, tt := range tests {
+		result, err := game.EvaluateWithFloats(floats, tt.params)
+		if err != nil {
+			t.Fatalf("%v: evaluation failed: %v", tt.params, err)
+		}
+		if math.Abs(result.Metric-tt.want) > 1e-9 {
+			t.Errorf("%v: expected metric %v, got %v", tt.params, tt.want, result.Metric)
+		}
+	}
+}
+
+func TestBaccaratTiePayout(t *testing.T) {
+	game := &BaccaratGame{}
+	// Player 10+8 = 8, banker K+8 = 8: tie on naturals.
+	floats := rankFloats("10", "K", "8", "8", "2", "2")
+
+	result, err := game.EvaluateWithFloats(floats, map[string]any{
+		"metric":    "payout",
+		"betamount": map[string]any{"player": 1.0, "tie": 1.0},
+	})
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	// Tie returns 9x on the tie bet and pushes the player bet: (9 + 1) / 2.
+	if result.Metric != 5 {
+		t.Errorf("expected payout 5, got %v", result.Metric)
+	}
+
+	if _, err := game.EvaluateWithFloats(floats, map[string]any{"metric": "payout"}); err == nil {
+		t.Error("expected error when no bet amount is given")
+	}
+	if _, err := game.EvaluateWithFloats(floats, map[string]any{"metric": "dragon"}); err == nil {
+		t.Error("expected error for unknown metric")
+	}
+}
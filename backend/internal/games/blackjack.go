@@ -9,10 +9,20 @@ import (
 // BlackjackGame implements the Blackjack provably fair game.
 // Uses unlimited deck (each card drawn independently from 52 cards).
 // Generates up to 52 cards to cover all possible hands in a game.
+//
+// The round is played to completion: the dealer peeks for blackjack when
+// showing an ace or a ten-value card, the player acts on each hand (one
+// split allowed, split aces receive a single card), and the dealer draws
+// to 17. Player decisions come from the "actions" param when given (the
+// actions of a finished bet, in order), falling back to the "strategy"
+// param (basic strategy by default) once the list is exhausted.
 type BlackjackGame struct{}
 
 const (
 	blackjackDefaultCards = 52
+	blackjackPayout       = 1.5 // natural pays 3:2
+	blackjackInsuranceBet = 0.5 // insurance costs half the main bet
+	blackjackInsuranceWin = 2.0 // and pays 2:1
 )
 
 // Spec returns metadata about the Blackjack game.
@@ -20,71 +30,382 @@ func (g *BlackjackGame) Spec() GameSpec {
 	return GameSpec{
 		ID:          "blackjack",
 		Name:        "Blackjack",
-		MetricLabel: "first_card",
+		MetricLabel: "net_payout",
 	}
 }
 
+// ParamSchema describes blackjack's parameters. Whether a scripted action
+// is allowed depends on the cards, so only their names are checked here.
+func (g *BlackjackGame) ParamSchema() ParamSchema {
+	return ParamSchema{Params: map[string]ParamSpec{
+		"actions": {Type: ParamList, Parse: func(params map[string]any) error {
+			actions, err := blackjackActionsFromParams(params)
+			if err != nil {
+				return err
+			}
+			for i, a := range actions {
+				switch a {
+				case bjActionHit, bjActionStand, bjActionDouble, bjActionSplit, bjActionInsurance, bjActionNoInsurance:
+				default:
+					return fmt.Errorf("blackjack actions[%d]: unknown action %q", i, a)
+				}
+			}
+			return nil
+		}},
+		"dealerHitsSoft17": {Type: ParamBool},
+		"strategy": {Parse: func(params map[string]any) error {
+			_, _, err := parseBlackjackStrategy(params)
+			return err
+		}},
+	}}
+}
+
 // FloatCount returns the number of floats required.
 // Blackjack uses up to 52 floats (cursor of 13) to cover all possible cards.
 func (g *BlackjackGame) FloatCount(params map[string]any) int {
 	return blackjackDefaultCards
 }
 
-// Evaluate generates floats and calculates the card deal.
+// Evaluate generates floats and plays out the blackjack round.
 func (g *BlackjackGame) Evaluate(seeds Seeds, nonce uint64, params map[string]any) (GameResult, error) {
 	floats := engine.Floats(seeds.Server, seeds.Client, nonce, 0, blackjackDefaultCards)
 	return g.EvaluateWithFloats(floats, params)
 }
 
-// EvaluateWithFloats calculates the blackjack deal using pre-computed floats.
+// EvaluateWithFloats plays out the blackjack round using pre-computed floats.
+// The metric is the net result in units of the main bet (1.5 for a natural,
+// -1 for a lost hand, +2 for a won double, and so on).
 func (g *BlackjackGame) EvaluateWithFloats(floats []float64, params map[string]any) (GameResult, error) {
 	if len(floats) < 4 {
 		return GameResult{}, fmt.Errorf("blackjack requires at least 4 floats, got %d", len(floats))
 	}
 
+	strategy, source, err := parseBlackjackStrategy(params)
+	if err != nil {
+		return GameResult{}, err
+	}
+	actions, err := blackjackActionsFromParams(params)
+	if err != nil {
+		return GameResult{}, err
+	}
+	if len(actions) > 0 {
+		source = "actions"
+	}
+
 	// Deal cards from floats (unlimited deck)
 	allCards := make([]Card, len(floats))
 	for i, f := range floats {
 		allCards[i] = cardFromFloat(f)
 	}
 
+	round := &blackjackRound{
+		deck:      allCards,
+		next:      4,
+		strategy:  strategy,
+		actions:   actions,
+		hitSoft17: blackjackHitSoft17(params),
+	}
+	if err := round.play(); err != nil {
+		return GameResult{}, err
+	}
+
 	// Standard deal order: player1, dealer1, player2, dealer2
 	playerCards := []Card{allCards[0], allCards[2]}
 	dealerCards := []Card{allCards[1], allCards[3]}
 
-	playerValue := blackjackHandValue(playerCards)
-	dealerValue := blackjackHandValue(dealerCards)
-
-	// Build card string lists for details
-	playerStrs := make([]string, len(playerCards))
-	for i, c := range playerCards {
-		playerStrs[i] = c.String()
-	}
-	dealerStrs := make([]string, len(dealerCards))
-	for i, c := range dealerCards {
-		dealerStrs[i] = c.String()
-	}
-
 	// Build full deck list
 	allCardStrs := make([]string, len(allCards))
 	for i, c := range allCards {
 		allCardStrs[i] = c.String()
 	}
 
-	// First card index (0-51) as metric (for scanning)
-	firstCardIndex := cardIndexFromFloat(floats[0])
+	hands := make([]map[string]any, len(round.hands))
+	for i, h := range round.hands {
+		hands[i] = map[string]any{
+			"cards":   cardStrings(h.cards),
+			"value":   blackjackHandValue(h.cards),
+			"bet":     h.bet,
+			"doubled": h.doubled,
+			"split":   h.split,
+			"outcome": h.outcome,
+			"net":     h.net,
+		}
+	}
 
 	return GameResult{
-		Metric:      float64(firstCardIndex),
-		MetricLabel: "first_card",
+		Metric:      round.net,
+		MetricLabel: "net_payout",
 		Details: map[string]any{
-			"player_cards":     playerStrs,
-			"dealer_cards":     dealerStrs,
-			"player_value":     playerValue,
-			"dealer_value":     dealerValue,
-			"player_blackjack": playerValue == 21,
-			"dealer_blackjack": dealerValue == 21,
-			"all_cards":        allCardStrs,
+			"player_cards":       cardStrings(playerCards),
+			"dealer_cards":       cardStrings(dealerCards),
+			"player_value":       blackjackHandValue(playerCards),
+			"dealer_value":       blackjackHandValue(dealerCards),
+			"player_blackjack":   round.playerNatural,
+			"dealer_blackjack":   round.dealerNatural,
+			"dealer_peeked":      round.peeked,
+			"insurance":          round.insured,
+			"insurance_net":      round.insuranceNet,
+			"hands":              hands,
+			"dealer_final_cards": cardStrings(round.dealer),
+			"dealer_final_value": blackjackHandValue(round.dealer),
+			"dealer_bust":        blackjackHandValue(round.dealer) > 21,
+			"actions_taken":      round.taken,
+			"strategy":           source,
+			"cards_used":         round.next,
+			"net_payout":         round.net,
+			"all_cards":          allCardStrs,
 		},
 	}, nil
 }
+
+// blackjackHand is one player hand in a round.
+type blackjackHand struct {
+	cards   []Card
+	bet     float64
+	doubled bool
+	split   bool
+	outcome string
+	net     float64
+}
+
+// blackjackRound holds the state of a single round being played out.
+type blackjackRound struct {
+	deck      []Card
+	next      int
+	strategy  *blackjackStrategy
+	actions   []string
+	hitSoft17 bool
+
+	hands         []*blackjackHand
+	dealer        []Card
+	taken         []string
+	peeked        bool
+	insured       bool
+	insuranceNet  float64
+	playerNatural bool
+	dealerNatural bool
+	net           float64
+}
+
+func (r *blackjackRound) draw() (Card, error) {
+	if r.next >= len(r.deck) {
+		return Card{}, fmt.Errorf("blackjack ran out of cards after %d draws", r.next)
+	}
+	c := r.deck[r.next]
+	r.next++
+	return c, nil
+}
+
+// nextAction pops the next scripted action, if any remain.
+func (r *blackjackRound) nextAction() (string, bool) {
+	if len(r.actions) == 0 {
+		return "", false
+	}
+	a := r.actions[0]
+	r.actions = r.actions[1:]
+	return a, true
+}
+
+func (r *blackjackRound) play() error {
+	player := []Card{r.deck[0], r.deck[2]}
+	r.dealer = []Card{r.deck[1], r.deck[3]}
+	upcard := blackjackCardValue(r.dealer[0].Rank)
+
+	r.playerNatural = blackjackHandValue(player) == 21
+	r.dealerNatural = blackjackHandValue(r.dealer) == 21
+
+	if upcard == 11 {
+		r.insured = r.strategy.insurance
+		if len(r.actions) > 0 && (r.actions[0] == bjActionInsurance || r.actions[0] == bjActionNoInsurance) {
+			a, _ := r.nextAction()
+			r.insured = a == bjActionInsurance
+		}
+		if r.insured {
+			r.taken = append(r.taken, bjActionInsurance)
+			if r.dealerNatural {
+				r.insuranceNet = blackjackInsuranceBet * blackjackInsuranceWin
+			} else {
+				r.insuranceNet = -blackjackInsuranceBet
+			}
+		} else {
+			r.taken = append(r.taken, bjActionNoInsurance)
+		}
+	}
+
+	main := &blackjackHand{cards: player, bet: 1}
+	r.hands = []*blackjackHand{main}
+
+	if upcard == 11 || upcard == 10 {
+		r.peeked = true
+	}
+
+	switch {
+	case r.dealerNatural && r.playerNatural:
+		main.outcome = "push"
+	case r.dealerNatural:
+		main.outcome = "lose"
+		main.net = -main.bet
+	case r.playerNatural:
+		main.outcome = "blackjack"
+		main.net = blackjackPayout
+	}
+	if r.dealerNatural || r.playerNatural {
+		r.net = main.net + r.insuranceNet
+		return r.checkActionsConsumed()
+	}
+
+	for i := 0; i < len(r.hands); i++ {
+		if err := r.playHand(r.hands[i], upcard); err != nil {
+			return err
+		}
+	}
+
+	anyLive := false
+	for _, h := range r.hands {
+		if blackjackHandValue(h.cards) <= 21 {
+			anyLive = true
+			break
+		}
+	}
+	if anyLive {
+		for {
+			total, soft := blackjackHandTotal(r.dealer)
+			if total > 17 || total == 17 && !(soft && r.hitSoft17) {
+				break
+			}
+			c, err := r.draw()
+			if err != nil {
+				return err
+			}
+			r.dealer = append(r.dealer, c)
+		}
+	}
+
+	dealerValue := blackjackHandValue(r.dealer)
+	r.net = r.insuranceNet
+	for _, h := range r.hands {
+		value := blackjackHandValue(h.cards)
+		switch {
+		case value > 21:
+			h.outcome = "bust"
+			h.net = -h.bet
+		case dealerValue > 21 || value > dealerValue:
+			h.outcome = "win"
+			h.net = h.bet
+		case value < dealerValue:
+			h.outcome = "lose"
+			h.net = -h.bet
+		default:
+			h.outcome = "push"
+		}
+		r.net += h.net
+	}
+
+	return r.checkActionsConsumed()
+}
+
+// playHand acts on a single hand until it stands, busts, doubles or reaches 21.
+func (r *blackjackRound) playHand(h *blackjackHand, upcard int) error {
+	if h.split {
+		c, err := r.draw()
+		if err != nil {
+			return err
+		}
+		h.cards = append(h.cards, c)
+		if h.cards[0].Rank == "A" {
+			return nil
+		}
+	}
+
+	for blackjackHandValue(h.cards) < 21 {
+		canDouble := len(h.cards) == 2
+		canSplit := len(h.cards) == 2 && len(r.hands) == 1 &&
+			blackjackCardValue(h.cards[0].Rank) == blackjackCardValue(h.cards[1].Rank)
+
+		action, scripted := r.nextAction()
+		if !scripted {
+			action = r.strategy.decide(h.cards, upcard, canDouble, canSplit)
+		}
+		r.taken = append(r.taken, action)
+
+		switch action {
+		case bjActionStand:
+			return nil
+		case bjActionHit:
+			c, err := r.draw()
+			if err != nil {
+				return err
+			}
+			h.cards = append(h.cards, c)
+		case bjActionDouble:
+			if !canDouble {
+				return fmt.Errorf("blackjack action %d: double is only allowed on two cards", len(r.taken))
+			}
+			c, err := r.draw()
+			if err != nil {
+				return err
+			}
+			h.cards = append(h.cards, c)
+			h.bet *= 2
+			h.doubled = true
+			return nil
+		case bjActionSplit:
+			if !canSplit {
+				return fmt.Errorf("blackjack action %d: split is not allowed on this hand", len(r.taken))
+			}
+			second := &blackjackHand{cards: []Card{h.cards[1]}, bet: h.bet, split: true}
+			h.cards = h.cards[:1]
+			h.split = true
+			r.hands = append(r.hands, second)
+			return r.playHand(h, upcard)
+		default:
+			return fmt.Errorf("blackjack action %d: %q is not allowed here", len(r.taken), action)
+		}
+	}
+	return nil
+}
+
+func (r *blackjackRound) checkActionsConsumed() error {
+	if len(r.actions) > 0 {
+		return fmt.Errorf("blackjack round finished with %d unused actions", len(r.actions))
+	}
+	return nil
+}
+
+// blackjackActionsFromParams reads the optional "actions" list.
+func blackjackActionsFromParams(params map[string]any) ([]string, error) {
+	var raw []any
+	switch v := params["actions"].(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		return append([]string(nil), v...), nil
+	case []any:
+		raw = v
+	default:
+		return nil, fmt.Errorf("blackjack actions must be a list, got %T", v)
+	}
+
+	actions := make([]string, len(raw))
+	for i, a := range raw {
+		s, ok := a.(string)
+		if !ok {
+			return nil, fmt.Errorf("blackjack actions[%d] must be a string, got %T", i, a)
+		}
+		actions[i] = s
+	}
+	return actions, nil
+}
+
+func blackjackHitSoft17(params map[string]any) bool {
+	v, _ := params["dealerHitsSoft17"].(bool)
+	return v
+}
+
+func cardStrings(cards []Card) []string {
+	out := make([]string, len(cards))
+	for i, c := range cards {
+		out[i] = c.String()
+	}
+	return out
+}
@@ -0,0 +1,249 @@
+package games
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Strategy table codes. "D" doubles when allowed and otherwise hits, "Ds"
+// doubles when allowed and otherwise stands, "P" splits.
+const (
+	bjCodeHit         = "H"
+	bjCodeStand       = "S"
+	bjCodeDouble      = "D"
+	bjCodeDoubleStand = "Ds"
+	bjCodeSplit       = "P"
+)
+
+// Player actions, spelled the same way as the Stake blackjack/next API.
+const (
+	bjActionHit         = "hit"
+	bjActionStand       = "stand"
+	bjActionDouble      = "double"
+	bjActionSplit       = "split"
+	bjActionInsurance   = "insurance"
+	bjActionNoInsurance = "noInsurance"
+)
+
+// blackjackStrategy maps (hand, dealer upcard) to a table code. Rows are keyed
+// by the hand total (hard/soft) or by the paired card value (pairs, with aces
+// as 11); columns are the dealer upcard value 2..11.
+type blackjackStrategy struct {
+	hard      map[int]map[int]string
+	soft      map[int]map[int]string
+	pairs     map[int]map[int]string
+	insurance bool
+}
+
+// basicStrategyRow expands a row given as ten codes for upcards 2..A.
+func basicStrategyRow(codes ...string) map[int]string {
+	row := make(map[int]string, len(codes))
+	for i, code := range codes {
+		row[i+2] = code
+	}
+	return row
+}
+
+// newBasicStrategy returns multi-deck basic strategy for dealer-stands-on-17,
+// double after split allowed and no surrender.
+func newBasicStrategy() *blackjackStrategy {
+	s := &blackjackStrategy{
+		hard:  make(map[int]map[int]string),
+		soft:  make(map[int]map[int]string),
+		pairs: make(map[int]map[int]string),
+	}
+
+	//                           2    3    4    5    6    7    8    9    10   A
+	for total := 4; total <= 8; total++ {
+		s.hard[total] = basicStrategyRow("H", "H", "H", "H", "H", "H", "H", "H", "H", "H")
+	}
+	s.hard[9] = basicStrategyRow("H", "D", "D", "D", "D", "H", "H", "H", "H", "H")
+	s.hard[10] = basicStrategyRow("D", "D", "D", "D", "D", "D", "D", "D", "H", "H")
+	s.hard[11] = basicStrategyRow("D", "D", "D", "D", "D", "D", "D", "D", "D", "H")
+	s.hard[12] = basicStrategyRow("H", "H", "S", "S", "S", "H", "H", "H", "H", "H")
+	for total := 13; total <= 16; total++ {
+		s.hard[total] = basicStrategyRow("S", "S", "S", "S", "S", "H", "H", "H", "H", "H")
+	}
+	for total := 17; total <= 21; total++ {
+		s.hard[total] = basicStrategyRow("S", "S", "S", "S", "S", "S", "S", "S", "S", "S")
+	}
+
+	s.soft[12] = basicStrategyRow("H", "H", "H", "H", "H", "H", "H", "H", "H", "H")
+	s.soft[13] = basicStrategyRow("H", "H", "H", "D", "D", "H", "H", "H", "H", "H")
+	s.soft[14] = basicStrategyRow("H", "H", "H", "D", "D", "H", "H", "H", "H", "H")
+	s.soft[15] = basicStrategyRow("H", "H", "D", "D", "D", "H", "H", "H", "H", "H")
+	s.soft[16] = basicStrategyRow("H", "H", "D", "D", "D", "H", "H", "H", "H", "H")
+	s.soft[17] = basicStrategyRow("H", "D", "D", "D", "D", "H", "H", "H", "H", "H")
+	s.soft[18] = basicStrategyRow("S", "Ds", "Ds", "Ds", "Ds", "S", "S", "H", "H", "H")
+	for total := 19; total <= 21; total++ {
+		s.soft[total] = basicStrategyRow("S", "S", "S", "S", "S", "S", "S", "S", "S", "S")
+	}
+
+	s.pairs[2] = basicStrategyRow("P", "P", "P", "P", "P", "P", "H", "H", "H", "H")
+	s.pairs[3] = basicStrategyRow("P", "P", "P", "P", "P", "P", "H", "H", "H", "H")
+	s.pairs[4] = basicStrategyRow("H", "H", "H", "P", "P", "H", "H", "H", "H", "H")
+	s.pairs[5] = basicStrategyRow("D", "D", "D", "D", "D", "D", "D", "D", "H", "H")
+	s.pairs[6] = basicStrategyRow("P", "P", "P", "P", "P", "H", "H", "H", "H", "H")
+	s.pairs[7] = basicStrategyRow("P", "P", "P", "P", "P", "P", "H", "H", "H", "H")
+	s.pairs[8] = basicStrategyRow("P", "P", "P", "P", "P", "P", "P", "P", "P", "P")
+	s.pairs[9] = basicStrategyRow("P", "P", "P", "P", "P", "S", "P", "P", "S", "S")
+	s.pairs[10] = basicStrategyRow("S", "S", "S", "S", "S", "S", "S", "S", "S", "S")
+	s.pairs[11] = basicStrategyRow("P", "P", "P", "P", "P", "P", "P", "P", "P", "P")
+
+	return s
+}
+
+// parseBlackjackStrategy builds a strategy from the "strategy" param. The
+// param may be omitted or "basic", or an object whose "hard", "soft" and
+// "pairs" sections override individual basic strategy cells, e.g.
+// {"hard": {"16": {"10": "S"}}, "insurance": false}. Upcards are written
+// "2".."10" or "A"; pair rows use the card value ("A" for aces).
+func parseBlackjackStrategy(params map[string]any) (*blackjackStrategy, string, error) {
+	s := newBasicStrategy()
+
+	switch raw := params["strategy"].(type) {
+	case nil:
+		return s, "basic", nil
+	case string:
+		if raw == "" || strings.EqualFold(raw, "basic") {
+			return s, "basic", nil
+		}
+		return nil, "", fmt.Errorf("blackjack strategy must be \"basic\" or a strategy table, got %q", raw)
+	case map[string]any:
+		sections := []struct {
+			name  string
+			table map[int]map[int]string
+		}{
+			{"hard", s.hard},
+			{"soft", s.soft},
+			{"pairs", s.pairs},
+		}
+		for _, section := range sections {
+			rows, ok := raw[section.name]
+			if !ok {
+				continue
+			}
+			if err := overlayStrategySection(section.name, section.table, rows); err != nil {
+				return nil, "", err
+			}
+		}
+		if ins, ok := raw["insurance"].(bool); ok {
+			s.insurance = ins
+		}
+		return s, "custom", nil
+	default:
+		return nil, "", fmt.Errorf("blackjack strategy has unsupported type %T", raw)
+	}
+}
+
+func overlayStrategySection(name string, table map[int]map[int]string, raw any) error {
+	rows, ok := raw.(map[string]any)
+	if !ok {
+		return fmt.Errorf("blackjack strategy section %q must be an object", name)
+	}
+	for rowKey, rowVal := range rows {
+		rowNum, err := parseStrategyValue(rowKey)
+		if err != nil {
+			return fmt.Errorf("blackjack strategy %s row %q: %w", name, rowKey, err)
+		}
+		cells, ok := rowVal.(map[string]any)
+		if !ok {
+			return fmt.Errorf("blackjack strategy %s row %q must be an object", name, rowKey)
+		}
+		if table[rowNum] == nil {
+			table[rowNum] = make(map[int]string)
+		}
+		for upKey, codeVal := range cells {
+			up, err := parseStrategyValue(upKey)
+			if err != nil || up < 2 || up > 11 {
+				return fmt.Errorf("blackjack strategy %s row %q: invalid dealer upcard %q", name, rowKey, upKey)
+			}
+			code, _ := codeVal.(string)
+			switch code {
+			case bjCodeHit, bjCodeStand, bjCodeDouble, bjCodeDoubleStand, bjCodeSplit:
+			default:
+				return fmt.Errorf("blackjack strategy %s row %q: invalid code %q", name, rowKey, code)
+			}
+			table[rowNum][up] = code
+		}
+	}
+	return nil
+}
+
+// parseStrategyValue parses a row or column key, accepting "A" as 11.
+func parseStrategyValue(key string) (int, error) {
+	if strings.EqualFold(key, "A") {
+		return 11, nil
+	}
+	return strconv.Atoi(key)
+}
+
+// decide returns the action the strategy takes for a hand against the given
+// dealer upcard value. canDouble and canSplit reflect what the rules allow.
+func (s *blackjackStrategy) decide(cards []Card, upcard int, canDouble, canSplit bool) string {
+	total, soft := blackjackHandTotal(cards)
+
+	code := ""
+	if canSplit {
+		code = s.pairs[blackjackCardValue(cards[0].Rank)][upcard]
+		if code != bjCodeSplit && blackjackCardValue(cards[0].Rank) == 11 {
+			// A pair of aces not split plays as soft 12.
+			code = s.soft[12][upcard]
+		}
+	}
+	if code == "" {
+		if soft {
+			code = s.soft[total][upcard]
+		} else {
+			code = s.hard[total][upcard]
+		}
+	}
+
+	if code == bjCodeSplit && !canSplit {
+		code = ""
+	}
+
+	switch code {
+	case bjCodeSplit:
+		return bjActionSplit
+	case bjCodeDouble:
+		if canDouble {
+			return bjActionDouble
+		}
+		return bjActionHit
+	case bjCodeDoubleStand:
+		if canDouble {
+			return bjActionDouble
+		}
+		return bjActionStand
+	case bjCodeStand:
+		return bjActionStand
+	case bjCodeHit:
+		return bjActionHit
+	default:
+		if total >= 17 {
+			return bjActionStand
+		}
+		return bjActionHit
+	}
+}
+
+// blackjackHandTotal returns the best total and whether an ace is still
+// being counted as 11.
+func blackjackHandTotal(cards []Card) (int, bool) {
+	total := 0
+	aces := 0
+	for _, c := range cards {
+		if c.Rank == "A" {
+			aces++
+			total++
+			continue
+		}
+		total += blackjackCardValue(c.Rank)
+	}
+	if aces > 0 && total+10 <= 21 {
+		return total + 10, true
+	}
+	return total, false
+}
@@ -1,6 +1,9 @@
 package games
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestBlackjackGame(t *testing.T) {
 	game := &BlackjackGame{}
@@ -61,8 +64,9 @@ func TestBlackjackEvaluation(t *testing.T) {
 		t.Errorf("dealer value should be 2-21, got %d", dealerValue)
 	}
 
-	if result.Metric < 0 || result.Metric > 51 {
-		t.Errorf("metric (first card index) should be 0-51, got %f", result.Metric)
+	// Worst case is a lost insurance plus two lost doubled split hands.
+	if result.Metric < -4.5 || result.Metric > 4 {
+		t.Errorf("metric (net payout) should be between -4.5 and 4, got %f", result.Metric)
 	}
 }
 
@@ -109,3 +113,144 @@ func TestBlackjackDeterminism(t *testing.T) {
 		t.Errorf("determinism failed: %f != %f", r1.Metric, r2.Metric)
 	}
 }
+
+// rankFloats returns floats that deal the given ranks in order (suit ♦),
+// padded to 52 with twos.
+func rankFloats(ranks ...string) []float64 {
+	floats := make([]float64, 52)
+	for i := range floats {
+		floats[i] = 0.5 / 52 // ♦2
+	}
+	for i, rank := range ranks {
+		for idx, c := range cardDeck {
+			if c.Rank == rank {
+				floats[i] = (float64(idx) + 0.5) / 52
+				break
+			}
+		}
+	}
+	return floats
+}
+
+func TestBlackjackResolution(t *testing.T) {
+	game := &BlackjackGame{}
+
+	// Deal order is p1, d1, p2, d2, then draws in order.
+	tests := []struct {
+		name    string
+		ranks   []string
+		params  map[string]any
+		net     float64
+		actions []string
+	}{
+		{"player natural", []string{"A", "9", "K", "7"}, nil, 1.5, []string{}},
+		{"natural push", []string{"A", "A", "K", "K"}, nil, 0, []string{"noInsurance"}},
+		{"dealer natural peek", []string{"10", "A", "9", "K"}, nil, -1, []string{"noInsurance"}},
+		{"insurance pays", []string{"10", "A", "9", "K"}, map[string]any{"actions": []any{"insurance"}}, 0, []string{"insurance"}},
+		{"stand 20 vs dealer 17", []string{"K", "10", "Q", "7"}, nil, 1, []string{"stand"}},
+		{"double 11 wins", []string{"6", "9", "5", "8", "K"}, nil, 2, []string{"double"}},
+		{"hit 16 and bust", []string{"10", "K", "6", "8", "9"}, nil, -1, []string{"hit"}},
+		{"dealer draws and busts", []string{"10", "6", "3", "10", "K"}, nil, 1, []string{"stand"}},
+		{"split eights", []string{"8", "7", "8", "10", "3", "K", "2", "10"}, nil, 4,
+			[]string{"split", "double", "double"}},
+		{"scripted actions", []string{"10", "7", "2", "10", "5", "4"}, map[string]any{"actions": []string{"hit", "hit"}}, 1,
+			[]string{"hit", "hit"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := game.EvaluateWithFloats(rankFloats(tt.ranks...), tt.params)
+			if err != nil {
+				t.Fatalf("evaluation failed: %v", err)
+			}
+			if math.Abs(result.Metric-tt.net) > 1e-9 {
+				t.Errorf("expected net %v, got %v", tt.net, result.Metric)
+			}
+			details := result.Details.(map[string]any)
+			taken := details["actions_taken"].([]string)
+			if len(taken) != len(tt.actions) {
+				t.Fatalf("expected actions %v, got %v", tt.actions, taken)
+			}
+			for i := range taken {
+				if taken[i] != tt.actions[i] {
+					t.Errorf("expected actions %v, got %v", tt.actions, taken)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestBlackjackSplitHands(t *testing.T) {
+	game := &BlackjackGame{}
+	// 8,8 vs 7+10: split; 8+3 doubles into K (21), 8+2 doubles into 10 (20).
+	result, err := game.EvaluateWithFloats(rankFloats("8", "7", "8", "10", "3", "K", "2", "10"), nil)
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	hands := result.Details.(map[string]any)["hands"].([]map[string]any)
+	if len(hands) != 2 {
+		t.Fatalf("expected 2 hands, got %d", len(hands))
+	}
+	if hands[0]["value"] != 21 || hands[0]["doubled"] != true || hands[0]["outcome"] != "win" {
+		t.Errorf("unexpected first hand: %v", hands[0])
+	}
+	if hands[1]["value"] != 20 || hands[1]["doubled"] != true || hands[1]["outcome"] != "win" {
+		t.Errorf("unexpected second hand: %v", hands[1])
+	}
+	if hands[0]["split"] != true || hands[1]["split"] != true {
+		t.Error("expected both hands to be marked as split")
+	}
+}
+
+func TestBlackjackCustomStrategy(t *testing.T) {
+	game := &BlackjackGame{}
+	floats := rankFloats("10", "K", "6", "7", "5")
+
+	basic, err := game.EvaluateWithFloats(floats, nil)
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	// Basic strategy hits 16 against a ten and draws the 5.
+	if basic.Metric != 1 {
+		t.Errorf("expected basic strategy net 1, got %v", basic.Metric)
+	}
+
+	params := map[string]any{
+		"strategy": map[string]any{
+			"hard": map[string]any{"16": map[string]any{"10": "S"}},
+		},
+	}
+	custom, err := game.EvaluateWithFloats(floats, params)
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	if custom.Details.(map[string]any)["strategy"] != "custom" {
+		t.Error("expected strategy source 'custom'")
+	}
+	taken := custom.Details.(map[string]any)["actions_taken"].([]string)
+	if len(taken) != 1 || taken[0] != "stand" {
+		t.Errorf("expected custom table to stand on 16 vs 10, got %v", taken)
+	}
+	if custom.Metric != -1 {
+		t.Errorf("expected standing 16 to lose against 17, got net %v", custom.Metric)
+	}
+}
+
+func TestBlackjackInvalidActions(t *testing.T) {
+	game := &BlackjackGame{}
+	floats := rankFloats("10", "9", "6", "8", "2", "3")
+
+	bad := []map[string]any{
+		{"actions": []any{"split"}},
+		{"actions": []any{"hit", "double"}},
+		{"actions": []any{"stand", "hit"}},
+		{"actions": []any{"surrender"}},
+		{"strategy": "aggressive"},
+	}
+	for _, params := range bad {
+		if _, err := game.EvaluateWithFloats(floats, params); err == nil {
+			t.Errorf("expected error for params %v", params)
+		}
+	}
+}
@@ -28,6 +28,13 @@ func (g *ChickenGame) Spec() GameSpec {
 	}
 }
 
+// ParamSchema describes chicken's parameters
+func (g *ChickenGame) ParamSchema() ParamSchema {
+	return ParamSchema{Params: map[string]ParamSpec{
+		"bones": {Type: ParamInteger, Min: chickenMinBones, Max: chickenMaxBones},
+	}}
+}
+
 // FloatCount returns the number of floats required (always 20).
 func (g *ChickenGame) FloatCount(params map[string]any) int {
 	return chickenFloatCount
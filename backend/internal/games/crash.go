@@ -27,6 +27,24 @@ func (g *CrashGame) Spec() GameSpec {
 	}
 }
 
+// ParamSchema describes crash's parameters. A game hash switches to the
+// salt-chain algorithm, which needs the salt too.
+func (g *CrashGame) ParamSchema() ParamSchema {
+	return ParamSchema{
+		Params: map[string]ParamSpec{
+			"houseEdge": {Type: ParamNumber},
+			"game_hash": {Type: ParamString},
+			"salt":      {Type: ParamString},
+		},
+		Check: func(params map[string]any) error {
+			if salt, _ := params["salt"].(string); params["game_hash"] != nil && salt == "" {
+				return fmt.Errorf("crash salt-chain mode requires 'salt' parameter")
+			}
+			return nil
+		},
+	}
+}
+
 func (g *CrashGame) FloatCount(params map[string]any) int {
 	// If using salt-chain mode, no floats are needed.
 	// For scanner fallback, 1 float is used.
@@ -105,6 +123,11 @@ func (g *SlideGame) Spec() GameSpec {
 	}
 }
 
+// ParamSchema describes slide's parameters, which are crash's
+func (g *SlideGame) ParamSchema() ParamSchema {
+	return (&CrashGame{}).ParamSchema()
+}
+
 func (g *SlideGame) FloatCount(params map[string]any) int {
 	return 1
 }
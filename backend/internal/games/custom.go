@@ -0,0 +1,69 @@
+package games
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// customGameIDPattern restricts custom game IDs so they are safe to use as
+// file names and cannot be mistaken for built-in games.
+var customGameIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// customGames maps the ID of each registered custom game to the SHA-256 of
+// its definition. Guarded by registryMu.
+var customGames = make(map[string]string)
+
+// RegisterCustomGame adds a user-defined game to the registry. Built-in game
+// IDs cannot be replaced; registering an existing custom ID replaces it.
+// sourceHash identifies the definition so runs can record what they used.
+func RegisterCustomGame(game Game, sourceHash string) error {
+	id := game.Spec().ID
+	if !customGameIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid custom game id %q: use lowercase letters, digits, '-' and '_'", id)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := GameRegistry[id]; exists {
+		if _, custom := customGames[id]; !custom {
+			return fmt.Errorf("custom game id %q conflicts with a built-in game", id)
+		}
+	}
+	GameRegistry[id] = game
+	customGames[id] = sourceHash
+	return nil
+}
+
+// UnregisterCustomGame removes a custom game. Built-in games are never removed.
+func UnregisterCustomGame(id string) bool {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, custom := customGames[id]; !custom {
+		return false
+	}
+	delete(GameRegistry, id)
+	delete(customGames, id)
+	return true
+}
+
+// CustomGameHash returns the definition hash of a custom game, and false if
+// the ID is not a custom game.
+func CustomGameHash(id string) (string, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	hash, ok := customGames[id]
+	return hash, ok
+}
+
+// ListCustomGames returns the specs of all registered custom games, sorted by ID.
+func ListCustomGames() []GameSpec {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	specs := make([]GameSpec, 0, len(customGames))
+	for id := range customGames {
+		specs = append(specs, GameRegistry[id].Spec())
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].ID < specs[j].ID })
+	return specs
+}
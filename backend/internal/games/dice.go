@@ -19,6 +19,11 @@ func (g *DiceGame) Spec() GameSpec {
 	}
 }
 
+// ParamSchema describes dice's parameters, of which it has none
+func (g *DiceGame) ParamSchema() ParamSchema {
+	return ParamSchema{}
+}
+
 // FloatCount returns the number of floats required
 func (g *DiceGame) FloatCount(params map[string]any) int {
 	return 1
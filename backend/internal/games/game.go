@@ -1,5 +1,10 @@
 package games
 
+import (
+	"fmt"
+	"sync"
+)
+
 // Seeds represents the cryptographic seeds used for game evaluation
 type Seeds struct {
 	Server string `json:"server"`
@@ -38,20 +43,30 @@ type GameSpec struct {
 // GameRegistry holds all available games
 var GameRegistry = make(map[string]Game)
 
+// registryMu guards GameRegistry now that custom games can be registered
+// while scans are running.
+var registryMu sync.RWMutex
+
 // RegisterGame adds a game to the registry
 func RegisterGame(game Game) {
 	spec := game.Spec()
+	registryMu.Lock()
+	defer registryMu.Unlock()
 	GameRegistry[spec.ID] = game
 }
 
 // GetGame retrieves a game by ID
 func GetGame(id string) (Game, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
 	game, exists := GameRegistry[id]
 	return game, exists
 }
 
 // ListGames returns all registered game specs
 func ListGames() []GameSpec {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
 	specs := make([]GameSpec, 0, len(GameRegistry))
 	for _, game := range GameRegistry {
 		specs = append(specs, game.Spec())
@@ -59,6 +74,25 @@ func ListGames() []GameSpec {
 	return specs
 }
 
+// ValidateParams checks params by structure and type against a game's
+// ParamSchema, without evaluating a round. Games without a schema, such as
+// custom games, are checked by evaluating them once on neutral floats.
+func ValidateParams(id string, params map[string]any) error {
+	game, ok := GetGame(id)
+	if !ok {
+		return fmt.Errorf("unknown game: %s", id)
+	}
+	if sg, ok := game.(SchemaGame); ok {
+		return sg.ParamSchema().Validate(params)
+	}
+	floats := make([]float64, game.FloatCount(params))
+	for i := range floats {
+		floats[i] = 0.5
+	}
+	_, err := game.EvaluateWithFloats(floats, params)
+	return err
+}
+
 // init registers all games
 func init() {
 	RegisterGame(&LimboGame{})
@@ -117,6 +117,37 @@ func TestPumpGame(t *testing.T) {
 	}
 }
 
+func TestPumpHitProbability(t *testing.T) {
+	// Expert has 10 pops among 25 positions; 1066.73x needs 10 safe pumps
+	p, err := PumpHitProbability("expert", 1066.73)
+	if err != nil {
+		t.Fatalf("PumpHitProbability: %v", err)
+	}
+	if want := 3003.0 / 3268760.0; math.Abs(p-want) > 1e-15 {
+		t.Errorf("Expected %g, got %g", want, p)
+	}
+
+	// Thresholds between table entries round up to the next one
+	between, _ := PumpHitProbability("expert", 1000)
+	if between != p {
+		t.Errorf("Expected 1000x to need the 1066.73x tier, got %g", between)
+	}
+	if all, _ := PumpHitProbability("expert", 1); all != 1 {
+		t.Errorf("Expected every round to pay at least 1x, got %g", all)
+	}
+	if none, _ := PumpHitProbability("expert", 5e6); none != 0 {
+		t.Errorf("Expected no round past the table, got %g", none)
+	}
+	if _, err := PumpHitProbability("insane", 2); err == nil {
+		t.Error("Expected an error for an unknown difficulty")
+	}
+
+	// Easy has a single pop, so 9 safe pumps need it in the last 16 positions
+	if easy, _ := PumpHitProbability("easy", 1.53); math.Abs(easy-16.0/25.0) > 1e-15 {
+		t.Errorf("Expected 0.64, got %g", easy)
+	}
+}
+
 func TestPlinkoGame(t *testing.T) {
 	game := &PlinkoGame{}
 
@@ -444,3 +475,87 @@ func TestGameGoldenVectors(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateParams(t *testing.T) {
+	tests := []struct {
+		game   string
+		params map[string]any
+		ok     bool
+	}{
+		{"pump", map[string]any{"difficulty": "hard"}, true},
+		{"pump", map[string]any{"difficulty": "extreme"}, false},
+		{"limbo", map[string]any{}, true},
+		{"limbo", map[string]any{"houseEdge": "high"}, false},
+		{"dice", map[string]any{"anything": 1.0}, true},
+		{"keno", map[string]any{"risk": "high", "picks": []any{1.0, 7.0, 12.0}}, true},
+		{"keno", map[string]any{"risk": "high"}, false},
+		{"keno", map[string]any{"picks": []any{1.0, 40.0}}, false},
+		{"keno", map[string]any{"picks": "1,2"}, false},
+		{"plinko", map[string]any{"rows": 12.0, "risk": "medium"}, true},
+		{"plinko", map[string]any{"rows": "12"}, true},
+		{"plinko", map[string]any{"rows": 99.0}, false},
+		{"wheel", map[string]any{"segments": 30, "risk": "low"}, true},
+		{"wheel", map[string]any{"segments": 35.0}, false},
+		{"mines", map[string]any{"mines": 3.0}, true},
+		{"mines", map[string]any{"mineCount": 2.5}, false},
+		{"mines", map[string]any{"mineCount": 25}, false},
+		{"chicken", map[string]any{"bones": 21.0}, false},
+		{"roulette", map[string]any{"chips": []any{map[string]any{"value": "colorRed", "amount": 1.0}}}, true},
+		{"roulette", map[string]any{"chips": []any{"red"}}, false},
+		{"hilo", map[string]any{"metric": "sequence", "sequence": []any{"higher", 7.0}}, true},
+		{"hilo", map[string]any{"metric": "sequence"}, false},
+		{"hilo", map[string]any{"guesses": 52.0}, false},
+		{"blackjack", map[string]any{"actions": []any{"hit", "stand"}, "dealerHitsSoft17": true}, true},
+		{"blackjack", map[string]any{"actions": []any{"fold"}}, false},
+		{"blackjack", map[string]any{"strategy": "aggressive"}, false},
+		{"baccarat", map[string]any{"metric": "payout", "betamount": map[string]any{"player": 1.0}}, true},
+		{"baccarat", map[string]any{"betamount": 5.0}, false},
+		{"videopoker", map[string]any{"policy": "ev"}, true},
+		{"videopoker", map[string]any{"policy": "hold"}, false},
+		{"videopoker", map[string]any{"hold": []any{true, false}}, false},
+		{"crash", map[string]any{"game_hash": "abc", "salt": "s"}, true},
+		{"crash", map[string]any{"game_hash": "abc"}, false},
+		{"nope", map[string]any{}, false},
+	}
+	for _, tt := range tests {
+		err := ValidateParams(tt.game, tt.params)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateParams(%s, %v) = %v, want ok %v", tt.game, tt.params, err, tt.ok)
+		}
+	}
+
+	// Built-in games are checked by schema rather than by evaluating them
+	for _, spec := range ListGames() {
+		game, _ := GetGame(spec.ID)
+		if _, custom := CustomGameHash(spec.ID); !custom {
+			if _, ok := game.(SchemaGame); !ok {
+				t.Errorf("%s has no param schema", spec.ID)
+			}
+		}
+	}
+}
+
+func TestTableHashCoversPayoutConstants(t *testing.T) {
+	seen := map[string]string{}
+	for _, game := range []string{"blackjack", "baccarat", "roulette", "keno", "plinko", "pump", "wheel", "videopoker"} {
+		hash, ok := TableHash(game)
+		if !ok || hash == "" {
+			t.Fatalf("%s: expected a table hash", game)
+		}
+		if other, dup := seen[hash]; dup {
+			t.Errorf("%s and %s share a table hash", game, other)
+		}
+		seen[hash] = game
+	}
+	if _, ok := TableHash("dice"); ok {
+		t.Error("dice has no tables to hash")
+	}
+
+	before, _ := TableHash("roulette")
+	rouletteRed[2] = true
+	after, _ := TableHash("roulette")
+	delete(rouletteRed, 2)
+	if before == after {
+		t.Error("expected a roulette table change to change its hash")
+	}
+}
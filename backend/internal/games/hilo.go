@@ -8,11 +8,19 @@ import (
 
 // HiLoGame implements the HiLo provably fair game.
 // Uses unlimited deck (each card drawn independently from 52 cards).
-// Metric is the first card index (0-51) for scanning purposes.
+//
+// The "metric" param selects what is scanned:
+//   - "first_card": index (0-51) of the start card (default)
+//   - "best_multiplier": cumulative multiplier after "guesses" perfect
+//     guesses, choosing the best winning option Stake offers at each card
+//   - "sequence": multiplier reached by the guesses in "sequence"; 0 once a
+//     guess loses
 type HiLoGame struct{}
 
 const (
-	hiloDefaultCards = 52 // generate enough cards for a full game
+	hiloDefaultCards   = 52 // generate enough cards for a full game
+	hiloDefaultGuesses = 10
+	hiloRTP            = 0.99
 )
 
 // Spec returns metadata about the HiLo game.
@@ -24,6 +32,27 @@ func (g *HiLoGame) Spec() GameSpec {
 	}
 }
 
+// ParamSchema describes hilo's parameters. The sequence metric needs a
+// sequence.
+func (g *HiLoGame) ParamSchema() ParamSchema {
+	return ParamSchema{
+		Params: map[string]ParamSpec{
+			"metric":  {Type: ParamString, Enum: []string{"first_card", "best_multiplier", "sequence"}},
+			"guesses": {Type: ParamInteger, Min: 1, Max: hiloDefaultCards - 1},
+			"sequence": {Type: ParamList, Parse: func(params map[string]any) error {
+				_, err := hiloSequenceFromParams(params)
+				return err
+			}},
+		},
+		Check: func(params map[string]any) error {
+			if params["metric"] == "sequence" && params["sequence"] == nil {
+				return fmt.Errorf("hilo sequence metric requires a sequence param")
+			}
+			return nil
+		},
+	}
+}
+
 // FloatCount returns the number of floats required.
 // HiLo uses up to 52 floats (cursor of 13) to cover all possible cards needed.
 func (g *HiLoGame) FloatCount(params map[string]any) int {
@@ -58,15 +87,216 @@ func (g *HiLoGame) EvaluateWithFloats(floats []float64, params map[string]any) (
 		cardStrs[i] = c.String()
 	}
 
+	details := map[string]any{
+		"cards":       cardStrs,
+		"first_card":  firstCard.String(),
+		"first_rank":  firstCard.Rank,
+		"first_suit":  firstCard.Suit,
+		"total_cards": len(cards),
+	}
+
+	mode := "first_card"
+	if m, ok := params["metric"].(string); ok && m != "" {
+		mode = m
+	}
+
+	var metric float64
+	switch mode {
+	case "first_card":
+		metric = float64(firstCardIndex)
+	case "best_multiplier":
+		n, err := hiloGuessCount(params, len(cards)-1)
+		if err != nil {
+			return GameResult{}, err
+		}
+		guesses := make([]string, n)
+		metric = 1
+		for i := 0; i < n; i++ {
+			guess, mult := hiloBestGuess(cards[i], cards[i+1])
+			guesses[i] = guess
+			metric *= mult
+		}
+		details["guesses"] = guesses
+	case "sequence":
+		seq, err := hiloSequenceFromParams(params)
+		if err != nil {
+			return GameResult{}, err
+		}
+		if len(seq) > len(cards)-1 {
+			return GameResult{}, fmt.Errorf("hilo sequence has %d guesses but only %d cards follow the start card", len(seq), len(cards)-1)
+		}
+		metric = 1
+		played := 0
+		for i, guess := range seq {
+			if guess == "cashout" {
+				break
+			}
+			played++
+			if guess == "skip" {
+				continue
+			}
+			// Guesses that cannot win on the current card lose the round like
+			// any other miss rather than failing the nonce.
+			if !hiloGuessWins(cards[i], cards[i+1], guess) {
+				metric = 0
+				details["lost_at"] = i
+				break
+			}
+			prob, _ := hiloGuessProbability(cards[i], guess)
+			metric *= hiloRTP / prob
+		}
+		details["guesses"] = seq[:played]
+	default:
+		return GameResult{}, fmt.Errorf("hilo metric must be one of first_card, best_multiplier, sequence; got %q", mode)
+	}
+
 	return GameResult{
-		Metric:      float64(firstCardIndex),
-		MetricLabel: "first_card",
-		Details: map[string]any{
-			"cards":       cardStrs,
-			"first_card":  firstCard.String(),
-			"first_rank":  firstCard.Rank,
-			"first_suit":  firstCard.Suit,
-			"total_cards": len(cards),
-		},
+		Metric:      metric,
+		MetricLabel: mode,
+		Details:     details,
 	}, nil
 }
+
+// hiloGuessProbability returns the chance that the next card satisfies the
+// guess given the current card. Aces are low and kings high. A guess that
+// cannot win on the current card, such as higher on a king, has probability 0.
+func hiloGuessProbability(current Card, guess string) (float64, error) {
+	r := cardRankValue(current.Rank)
+	var ranks int
+	switch guess {
+	case "higher":
+		ranks = 13 - r
+	case "lower":
+		ranks = r - 1
+	case "equal":
+		ranks = 1
+	case "higherEqual":
+		ranks = 14 - r
+	case "lowerEqual":
+		ranks = r
+	default:
+		return 0, fmt.Errorf("invalid guess %q", guess)
+	}
+	return float64(ranks) / 13, nil
+}
+
+func hiloGuessWins(current, next Card, guess string) bool {
+	cur, nxt := cardRankValue(current.Rank), cardRankValue(next.Rank)
+	switch guess {
+	case "higher":
+		return nxt > cur
+	case "lower":
+		return nxt < cur
+	case "equal":
+		return nxt == cur
+	case "higherEqual":
+		return nxt >= cur
+	case "lowerEqual":
+		return nxt <= cur
+	}
+	return false
+}
+
+// hiloBestGuess returns the winning guess with the highest multiplier among
+// the options offered for the current card: higher/equal on an ace,
+// lower/equal on a king, and higherEqual/lowerEqual otherwise.
+func hiloBestGuess(current, next Card) (string, float64) {
+	var options []string
+	switch current.Rank {
+	case "A":
+		options = []string{"higher", "equal"}
+	case "K":
+		options = []string{"lower", "equal"}
+	default:
+		options = []string{"higherEqual", "lowerEqual"}
+	}
+
+	best, bestMult := "skip", 1.0
+	for _, guess := range options {
+		if !hiloGuessWins(current, next, guess) {
+			continue
+		}
+		prob, _ := hiloGuessProbability(current, guess)
+		if mult := hiloRTP / prob; mult > bestMult {
+			best, bestMult = guess, mult
+		}
+	}
+	return best, bestMult
+}
+
+func hiloGuessCount(params map[string]any, max int) (int, error) {
+	n := hiloDefaultGuesses
+	switch v := params["guesses"].(type) {
+	case nil:
+	case float64:
+		n = int(v)
+	case int:
+		n = v
+	default:
+		return 0, fmt.Errorf("hilo guesses must be a number, got %T", v)
+	}
+	if n < 1 || n > max {
+		return 0, fmt.Errorf("hilo guesses must be between 1 and %d, got %d", max, n)
+	}
+	return n, nil
+}
+
+// hiloSequenceFromParams reads the "sequence" param. Guesses may be Stake
+// guess names or the scripting constants (2 equal, 4 lower, 5 higher,
+// 7 skip, 3 cashout).
+func hiloSequenceFromParams(params map[string]any) ([]string, error) {
+	var raw []any
+	switch v := params["sequence"].(type) {
+	case nil:
+		return nil, fmt.Errorf("hilo sequence metric requires a sequence param")
+	case []string:
+		raw = make([]any, len(v))
+		for i, g := range v {
+			raw[i] = g
+		}
+	case []any:
+		raw = v
+	default:
+		return nil, fmt.Errorf("hilo sequence must be a list, got %T", v)
+	}
+
+	seq := make([]string, len(raw))
+	for i, g := range raw {
+		var err error
+		switch v := g.(type) {
+		case string:
+			seq[i] = v
+			switch v {
+			case "higher", "lower", "equal", "higherEqual", "lowerEqual", "skip", "cashout":
+			default:
+				err = fmt.Errorf("invalid guess %q", v)
+			}
+		case float64:
+			seq[i], err = hiloActionName(int(v))
+		case int:
+			seq[i], err = hiloActionName(v)
+		default:
+			err = fmt.Errorf("must be a string or number, got %T", g)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("hilo sequence[%d]: %w", i, err)
+		}
+	}
+	return seq, nil
+}
+
+func hiloActionName(code int) (string, error) {
+	switch code {
+	case 2:
+		return "equal", nil
+	case 3:
+		return "cashout", nil
+	case 4:
+		return "lower", nil
+	case 5:
+		return "higher", nil
+	case 7:
+		return "skip", nil
+	}
+	return "", fmt.Errorf("invalid action %d", code)
+}
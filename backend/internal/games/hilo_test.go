@@ -1,6 +1,9 @@
 package games
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestHiLoGame(t *testing.T) {
 	game := &HiLoGame{}
@@ -94,3 +97,78 @@ func TestHiLoDeterminism(t *testing.T) {
 		t.Errorf("determinism failed: %f != %f", r1.Metric, r2.Metric)
 	}
 }
+
+func TestHiLoBestMultiplier(t *testing.T) {
+	game := &HiLoGame{}
+	// A -> 5 (higher on an ace), 5 -> 5 (lowerEqual beats higherEqual), 5 -> K.
+	floats := rankFloats("A", "5", "5", "K")
+
+	result, err := game.EvaluateWithFloats(floats, map[string]any{"metric": "best_multiplier", "guesses": 3.0})
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	want := (0.99 / (12.0 / 13)) * (0.99 / (5.0 / 13)) * (0.99 / (9.0 / 13))
+	if math.Abs(result.Metric-want) > 1e-9 {
+		t.Errorf("expected best multiplier %v, got %v", want, result.Metric)
+	}
+	guesses := result.Details.(map[string]any)["guesses"].([]string)
+	expected := []string{"higher", "lowerEqual", "higherEqual"}
+	for i := range expected {
+		if guesses[i] != expected[i] {
+			t.Fatalf("expected guesses %v, got %v", expected, guesses)
+		}
+	}
+}
+
+func TestHiLoSequence(t *testing.T) {
+	game := &HiLoGame{}
+	floats := rankFloats("A", "5", "5", "K")
+
+	won, err := game.EvaluateWithFloats(floats, map[string]any{
+		"metric":   "sequence",
+		"sequence": []any{5.0, 7.0, "higherEqual", 3.0},
+	})
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	want := (0.99 / (12.0 / 13)) * (0.99 / (9.0 / 13))
+	if math.Abs(won.Metric-want) > 1e-9 {
+		t.Errorf("expected %v, got %v", want, won.Metric)
+	}
+
+	lost, err := game.EvaluateWithFloats(floats, map[string]any{
+		"metric":   "sequence",
+		"sequence": []string{"higher", "higher"},
+	})
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	if lost.Metric != 0 || lost.Details.(map[string]any)["lost_at"] != 1 {
+		t.Errorf("expected loss at guess 1, got metric %v", lost.Metric)
+	}
+
+	// Nothing is lower than an ace, so the guess loses instead of erroring.
+	impossible, err := game.EvaluateWithFloats(floats, map[string]any{
+		"metric":   "sequence",
+		"sequence": []any{"lower"},
+	})
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	if impossible.Metric != 0 || impossible.Details.(map[string]any)["lost_at"] != 0 {
+		t.Errorf("expected impossible guess to lose at 0, got metric %v", impossible.Metric)
+	}
+
+	bad := []map[string]any{
+		{"metric": "sequence"},
+		{"metric": "sequence", "sequence": []any{"sideways"}},
+		{"metric": "sequence", "sequence": []any{9.0}},
+		{"metric": "best_multiplier", "guesses": 0.0},
+		{"metric": "streak"},
+	}
+	for _, params := range bad {
+		if _, err := game.EvaluateWithFloats(floats, params); err == nil {
+			t.Errorf("expected error for params %v", params)
+		}
+	}
+}
@@ -19,6 +19,20 @@ func (g *KenoGame) Spec() GameSpec {
 	}
 }
 
+// ParamSchema describes keno's parameters
+func (g *KenoGame) ParamSchema() ParamSchema {
+	return ParamSchema{
+		Params: map[string]ParamSpec{
+			"risk": {Type: ParamString, Enum: ValidKenoRisks()},
+			"picks": {Type: ParamList, Parse: func(params map[string]any) error {
+				_, err := kenoPicks(params)
+				return err
+			}},
+		},
+		Required: []string{"picks"},
+	}
+}
+
 // FloatCount returns the number of floats required for Keno
 // Keno uses 2 cursor increments (10 floats total) for Fisher-Yates selection of 10 draws
 func (g *KenoGame) FloatCount(params map[string]any) int {
@@ -47,22 +61,11 @@ func (g *KenoGame) EvaluateWithFloats(floats []float64, params map[string]any) (
 	}
 
 	// Get player's picks from params
-	picks, err := extractPicks(params)
+	picks, err := kenoPicks(params)
 	if err != nil {
 		return GameResult{}, err
 	}
 
-	if len(picks) < KenoMinPicks || len(picks) > KenoMaxPicks {
-		return GameResult{}, fmt.Errorf("keno requires between %d and %d picks, got %d", KenoMinPicks, KenoMaxPicks, len(picks))
-	}
-
-	// Validate picks are in valid range
-	for _, p := range picks {
-		if p < 0 || p >= KenoSquares {
-			return GameResult{}, fmt.Errorf("invalid pick %d: must be between 0 and %d", p, KenoSquares-1)
-		}
-	}
-
 	// Generate the 10 drawn numbers using Fisher-Yates selection
 	draws := generateKenoDraws(floats)
 
@@ -134,6 +137,23 @@ func countHits(picks, draws []int) int {
 	return hits
 }
 
+// kenoPicks reads the player's picks and checks their count and range
+func kenoPicks(params map[string]any) ([]int, error) {
+	picks, err := extractPicks(params)
+	if err != nil {
+		return nil, err
+	}
+	if len(picks) < KenoMinPicks || len(picks) > KenoMaxPicks {
+		return nil, fmt.Errorf("keno requires between %d and %d picks, got %d", KenoMinPicks, KenoMaxPicks, len(picks))
+	}
+	for _, p := range picks {
+		if p < 0 || p >= KenoSquares {
+			return nil, fmt.Errorf("invalid pick %d: must be between 0 and %d", p, KenoSquares-1)
+		}
+	}
+	return picks, nil
+}
+
 // extractPicks extracts the picks array from params
 func extractPicks(params map[string]any) ([]int, error) {
 	picksRaw, ok := params["picks"]
@@ -19,6 +19,13 @@ func (g *LimboGame) Spec() GameSpec {
 	}
 }
 
+// ParamSchema describes limbo's parameters
+func (g *LimboGame) ParamSchema() ParamSchema {
+	return ParamSchema{Params: map[string]ParamSpec{
+		"houseEdge": {Type: ParamNumber},
+	}}
+}
+
 // FloatCount returns the number of floats required
 func (g *LimboGame) FloatCount(params map[string]any) int {
 	return 1
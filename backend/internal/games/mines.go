@@ -28,6 +28,16 @@ func (g *MinesGame) Spec() GameSpec {
 	}
 }
 
+// ParamSchema describes mines' parameters; "mines" is an alias of
+// "mineCount"
+func (g *MinesGame) ParamSchema() ParamSchema {
+	count := ParamSpec{Type: ParamInteger, Min: minesMinCount, Max: minesMaxCount}
+	return ParamSchema{Params: map[string]ParamSpec{
+		"mineCount": count,
+		"mines":     count,
+	}}
+}
+
 // FloatCount returns the number of floats required (always 24).
 func (g *MinesGame) FloatCount(params map[string]any) int {
 	return minesFloatCount
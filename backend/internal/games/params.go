@@ -0,0 +1,135 @@
+package games
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+)
+
+// ParamType is the JSON type a game parameter must have
+type ParamType string
+
+const (
+	ParamAny     ParamType = ""
+	ParamNumber  ParamType = "number"
+	ParamInteger ParamType = "integer"
+	ParamString  ParamType = "string"
+	ParamBool    ParamType = "bool"
+	ParamList    ParamType = "list"
+	ParamObject  ParamType = "object"
+)
+
+// ParamSpec describes one game parameter
+type ParamSpec struct {
+	Type     ParamType
+	Enum     []string // values a string may take; any when empty
+	Min, Max float64  // bounds of a number, checked when Max > Min
+	// Parse, if set, runs the game's own parsing of the parameter, for
+	// values with more structure than a type, such as roulette chips
+	Parse func(params map[string]any) error
+}
+
+// ParamSchema lists the parameters a game reads. Unset (or null)
+// parameters take the game's defaults, and parameters it doesn't list are
+// ignored, so payloads may carry extra fields.
+type ParamSchema struct {
+	Params   map[string]ParamSpec
+	Required []string
+	// Check, if set, enforces rules across parameters, such as a mode
+	// that needs another parameter
+	Check func(params map[string]any) error
+}
+
+// SchemaGame is implemented by games that describe their parameters, so
+// they can be validated without evaluating a round
+type SchemaGame interface {
+	ParamSchema() ParamSchema
+}
+
+// Validate checks params against the schema by structure and type
+func (s ParamSchema) Validate(params map[string]any) error {
+	for _, name := range s.Required {
+		if params[name] == nil {
+			return fmt.Errorf("param %q is required", name)
+		}
+	}
+	names := make([]string, 0, len(s.Params))
+	for name := range s.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := params[name]
+		if v == nil {
+			continue
+		}
+		if err := s.Params[name].check(name, v); err != nil {
+			return err
+		}
+		if parse := s.Params[name].Parse; parse != nil {
+			if err := parse(params); err != nil {
+				return err
+			}
+		}
+	}
+	if s.Check != nil {
+		return s.Check(params)
+	}
+	return nil
+}
+
+func (p ParamSpec) check(name string, v any) error {
+	switch p.Type {
+	case ParamNumber, ParamInteger:
+		n, ok := paramNumber(v)
+		if !ok {
+			return fmt.Errorf("param %q must be a number, got %T", name, v)
+		}
+		if p.Type == ParamInteger && n != math.Trunc(n) {
+			return fmt.Errorf("param %q must be an integer, got %v", name, n)
+		}
+		if p.Max > p.Min && (n < p.Min || n > p.Max) {
+			return fmt.Errorf("param %q must be between %v and %v, got %v", name, p.Min, p.Max, n)
+		}
+	case ParamString:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("param %q must be a string, got %T", name, v)
+		}
+		if len(p.Enum) > 0 && !slices.Contains(p.Enum, s) {
+			return fmt.Errorf("param %q must be one of %v, got %q", name, p.Enum, s)
+		}
+	case ParamBool:
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("param %q must be a boolean, got %T", name, v)
+		}
+	case ParamList:
+		if reflect.ValueOf(v).Kind() != reflect.Slice {
+			return fmt.Errorf("param %q must be a list, got %T", name, v)
+		}
+	case ParamObject:
+		if reflect.ValueOf(v).Kind() != reflect.Map {
+			return fmt.Errorf("param %q must be an object, got %T", name, v)
+		}
+	}
+	return nil
+}
+
+// paramNumber reads a number decoded from JSON or passed from Go
+func paramNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
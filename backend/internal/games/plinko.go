@@ -29,6 +29,20 @@ func (g *PlinkoGame) Spec() GameSpec {
 	}
 }
 
+// ParamSchema describes plinko's parameters. Rows may be sent as a string.
+func (g *PlinkoGame) ParamSchema() ParamSchema {
+	return ParamSchema{Params: map[string]ParamSpec{
+		"rows": {Parse: func(params map[string]any) error {
+			_, err := plinkoRowsFromParams(params)
+			return err
+		}},
+		"risk": {Type: ParamString, Parse: func(params map[string]any) error {
+			_, err := plinkoRiskFromParams(params)
+			return err
+		}},
+	}}
+}
+
 // FloatCount returns how many floats are required for the given parameters.
 func (g *PlinkoGame) FloatCount(params map[string]any) int {
 	rows, err := plinkoRowsFromParams(params)
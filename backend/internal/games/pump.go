@@ -55,6 +55,13 @@ func (g *PumpGame) Spec() GameSpec {
 	}
 }
 
+// ParamSchema describes pump's parameters
+func (g *PumpGame) ParamSchema() ParamSchema {
+	return ParamSchema{Params: map[string]ParamSpec{
+		"difficulty": {Type: ParamString, Enum: []string{"easy", "medium", "hard", "expert"}},
+	}}
+}
+
 // FloatCount returns the number of floats required
 // Pump uses 25 floats for Fisher-Yates shuffle of positions 1-25
 func (g *PumpGame) FloatCount(params map[string]any) int {
@@ -164,3 +171,32 @@ func (g *PumpGame) EvaluateWithFloats(floats []float64, params map[string]any) (
 		},
 	}, nil
 }
+
+// PumpHitProbability returns the exact chance that a Pump round at the
+// given difficulty pays at least threshold. Reaching n safe pumps needs
+// every pop to sit past position n, which happens in C(25-n, M) of the
+// C(25, M) pop placements.
+func PumpHitProbability(difficulty string, threshold float64) (float64, error) {
+	M, ok := pumpMValues[difficulty]
+	if !ok {
+		return 0, fmt.Errorf("invalid pump difficulty: %s", difficulty)
+	}
+	for n, multiplier := range pumpMultiplierTables[difficulty] {
+		if multiplier >= threshold {
+			return binomial(pumpPositions-n, M) / binomial(pumpPositions, M), nil
+		}
+	}
+	return 0, nil
+}
+
+// binomial returns C(n, k) as a float
+func binomial(n, k int) float64 {
+	if k < 0 || k > n {
+		return 0
+	}
+	result := 1.0
+	for i := 0; i < k; i++ {
+		result = result * float64(n-i) / float64(i+1)
+	}
+	return result
+}
@@ -8,6 +8,8 @@ import (
 )
 
 // RouletteGame implements European Roulette (0-36)
+// When params include a "chips" layout (see ParseRouletteChips) the metric
+// becomes the layout's payout multiplier instead of the pocket.
 type RouletteGame struct{}
 
 // Spec returns metadata about the Roulette game
@@ -19,6 +21,16 @@ func (g *RouletteGame) Spec() GameSpec {
 	}
 }
 
+// ParamSchema describes roulette's parameters
+func (g *RouletteGame) ParamSchema() ParamSchema {
+	return ParamSchema{Params: map[string]ParamSpec{
+		"chips": {Type: ParamList, Parse: func(params map[string]any) error {
+			_, err := ParseRouletteChips(params["chips"])
+			return err
+		}},
+	}}
+}
+
 // FloatCount returns the number of floats required
 func (g *RouletteGame) FloatCount(params map[string]any) int {
 	return 1
@@ -37,6 +49,14 @@ func (g *RouletteGame) EvaluateWithFloats(floats []float64, params map[string]an
 		return GameResult{}, fmt.Errorf("roulette requires at least 1 float, got %d", len(floats))
 	}
 
+	var bets []RouletteBet
+	if raw, ok := params["chips"]; ok {
+		var err error
+		if bets, err = ParseRouletteChips(raw); err != nil {
+			return GameResult{}, err
+		}
+	}
+
 	f := floats[0]
 
 	// Use formula: floor(float * 37) for European roulette (0-36)
@@ -52,15 +72,7 @@ func (g *RouletteGame) EvaluateWithFloats(floats []float64, params map[string]an
 		isEven = false
 		isLow = false
 	} else {
-		// Red numbers: 1,3,5,7,9,12,14,16,18,19,21,23,25,27,30,32,34,36
-		redNumbers := map[int]bool{
-			1: true, 3: true, 5: true, 7: true, 9: true,
-			12: true, 14: true, 16: true, 18: true, 19: true,
-			21: true, 23: true, 25: true, 27: true, 30: true,
-			32: true, 34: true, 36: true,
-		}
-
-		if redNumbers[int(pocket)] {
+		if rouletteRed[int(pocket)] {
 			color = "red"
 		} else {
 			color = "black"
@@ -70,15 +82,28 @@ func (g *RouletteGame) EvaluateWithFloats(floats []float64, params map[string]an
 		isLow = pocket >= 1 && pocket <= 18
 	}
 
+	details := map[string]any{
+		"raw_float": f,
+		"pocket":    int(pocket), // Integer in details
+		"color":     color,
+		"even":      isEven,
+		"low":       isLow,
+	}
+
+	if bets != nil {
+		multiplier, breakdown := RouletteLayoutPayout(bets, int(pocket))
+		details["chips"] = breakdown
+		details["payout_multiplier"] = multiplier
+		return GameResult{
+			Metric:      multiplier,
+			MetricLabel: "multiplier",
+			Details:     details,
+		}, nil
+	}
+
 	return GameResult{
 		Metric:      pocket, // Keep as float64 for uniformity
 		MetricLabel: "pocket",
-		Details: map[string]any{
-			"raw_float": f,
-			"pocket":    int(pocket), // Integer in details
-			"color":     color,
-			"even":      isEven,
-			"low":       isLow,
-		},
+		Details:     details,
 	}, nil
 }
@@ -0,0 +1,307 @@
+package games
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rouletteRed lists the red pockets on a European wheel.
+var rouletteRed = map[int]bool{
+	1: true, 3: true, 5: true, 7: true, 9: true,
+	12: true, 14: true, 16: true, 18: true, 19: true,
+	21: true, 23: true, 25: true, 27: true, 30: true,
+	32: true, 34: true, 36: true,
+}
+
+// RouletteBet is a single chip resolved to the pockets it covers.
+type RouletteBet struct {
+	Name    string  `json:"name"`
+	Type    string  `json:"type"`
+	Numbers []int   `json:"numbers"`
+	Amount  float64 `json:"amount"`
+}
+
+// rouletteReturn is what a chip covering every numbered pocket would return
+// per unit staked; a bet's return is this over the pockets it covers.
+const rouletteReturn = 36
+
+// Return is the amount a winning chip pays back, stake included. Every bet
+// on a single-zero table returns 36 / pockets covered (straight 36x, split
+// 18x, street 12x, corner 9x, dozen and column 3x, even-money 2x).
+func (b RouletteBet) Return() float64 {
+	return b.Amount * rouletteReturn / float64(len(b.Numbers))
+}
+
+// Covers reports whether the bet wins on the given pocket.
+func (b RouletteBet) Covers(pocket int) bool {
+	for _, n := range b.Numbers {
+		if n == pocket {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRouletteChips converts a chip layout into bets. Each chip is an object
+// with an "amount" and either a "value" naming the bet, as in the scripting
+// chips global ({"value": "colorBlack", "amount": 1}), or a "type" with the
+// covered "numbers" ({"type": "split", "numbers": [17, 20], "amount": 1}).
+//
+// Named bets: number0..number36, colorRed, colorBlack, parityEven,
+// parityOdd, range0118, range1936, range0112, range1324, range2536,
+// column1..column3 (row1..row3 are accepted as aliases; column1 is 1, 4, ...,
+// 34) and the inside bets "split:17,20", "street:1,2,3" and "corner:1,2,4,5".
+func ParseRouletteChips(raw any) ([]RouletteBet, error) {
+	var chips []map[string]any
+	switch v := raw.(type) {
+	case []map[string]any:
+		chips = v
+	case []any:
+		chips = make([]map[string]any, len(v))
+		for i, c := range v {
+			m, ok := c.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("roulette chip %d must be an object, got %T", i, c)
+			}
+			chips[i] = m
+		}
+	default:
+		return nil, fmt.Errorf("roulette chips must be a list, got %T", raw)
+	}
+	if len(chips) == 0 {
+		return nil, fmt.Errorf("roulette chips must not be empty")
+	}
+
+	bets := make([]RouletteBet, len(chips))
+	for i, chip := range chips {
+		bet, err := parseRouletteChip(chip)
+		if err != nil {
+			return nil, fmt.Errorf("roulette chip %d: %w", i, err)
+		}
+		bets[i] = bet
+	}
+	return bets, nil
+}
+
+func parseRouletteChip(chip map[string]any) (RouletteBet, error) {
+	var bet RouletteBet
+	switch a := chip["amount"].(type) {
+	case float64:
+		bet.Amount = a
+	case int:
+		bet.Amount = float64(a)
+	case int64:
+		bet.Amount = float64(a)
+	default:
+		return bet, fmt.Errorf("amount must be a number, got %T", chip["amount"])
+	}
+	if bet.Amount <= 0 {
+		return bet, fmt.Errorf("amount must be > 0, got %f", bet.Amount)
+	}
+
+	if t, ok := chip["type"].(string); ok {
+		nums, err := rouletteNumbersParam(chip["numbers"])
+		if err != nil {
+			return bet, err
+		}
+		bet.Type = t
+		bet.Numbers = nums
+		bet.Name = fmt.Sprintf("%s:%s", t, joinInts(nums))
+		return bet, validateInsideBet(bet.Type, bet.Numbers)
+	}
+
+	name, ok := chip["value"].(string)
+	if !ok {
+		return bet, fmt.Errorf("chip needs a \"value\" bet name or a \"type\" with \"numbers\"")
+	}
+	bet.Name = name
+	return bet, resolveNamedBet(&bet)
+}
+
+func resolveNamedBet(bet *RouletteBet) error {
+	name := bet.Name
+	if t, list, ok := strings.Cut(name, ":"); ok {
+		nums := make([]int, 0, 4)
+		for _, part := range strings.Split(list, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return fmt.Errorf("invalid number %q in %q", part, name)
+			}
+			nums = append(nums, n)
+		}
+		bet.Type = t
+		bet.Numbers = nums
+		return validateInsideBet(t, nums)
+	}
+
+	if rest, ok := strings.CutPrefix(name, "number"); ok {
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return fmt.Errorf("unknown roulette bet %q", name)
+		}
+		bet.Type = "straight"
+		bet.Numbers = []int{n}
+		return validateInsideBet("straight", bet.Numbers)
+	}
+
+	switch name {
+	case "colorRed", "colorBlack":
+		bet.Type = "color"
+		wantRed := name == "colorRed"
+		bet.Numbers = rouletteSelect(func(n int) bool { return rouletteRed[n] == wantRed })
+	case "parityEven", "parityOdd":
+		bet.Type = "parity"
+		rem := 0
+		if name == "parityOdd" {
+			rem = 1
+		}
+		bet.Numbers = rouletteSelect(func(n int) bool { return n%2 == rem })
+	case "range0118", "range1936":
+		bet.Type = "range"
+		lo := 1
+		if name == "range1936" {
+			lo = 19
+		}
+		bet.Numbers = rouletteSelect(func(n int) bool { return n >= lo && n < lo+18 })
+	case "range0112", "range1324", "range2536":
+		bet.Type = "dozen"
+		lo := map[string]int{"range0112": 1, "range1324": 13, "range2536": 25}[name]
+		bet.Numbers = rouletteSelect(func(n int) bool { return n >= lo && n < lo+12 })
+	case "column1", "column2", "column3", "row1", "row2", "row3":
+		bet.Type = "column"
+		col := int(name[len(name)-1] - '0')
+		bet.Numbers = rouletteSelect(func(n int) bool { return (n-1)%3 == col-1 })
+	default:
+		return fmt.Errorf("unknown roulette bet %q", name)
+	}
+	return nil
+}
+
+// rouletteSelect returns the pockets 1-36 matching keep.
+func rouletteSelect(keep func(n int) bool) []int {
+	nums := make([]int, 0, 18)
+	for n := 1; n <= 36; n++ {
+		if keep(n) {
+			nums = append(nums, n)
+		}
+	}
+	return nums
+}
+
+// validateInsideBet checks that the numbers form the named shape on the
+// standard layout (three pockets per street, zero above 1, 2 and 3).
+func validateInsideBet(t string, nums []int) error {
+	for _, n := range nums {
+		if n < 0 || n > 36 {
+			return fmt.Errorf("%s number %d is out of range 0-36", t, n)
+		}
+	}
+	sorted := append([]int(nil), nums...)
+	sort.Ints(sorted)
+
+	valid := false
+	switch t {
+	case "straight":
+		valid = len(sorted) == 1
+	case "split":
+		if len(sorted) == 2 {
+			a, b := sorted[0], sorted[1]
+			switch {
+			case a == 0:
+				valid = b >= 1 && b <= 3
+			case b-a == 3:
+				valid = true
+			case b-a == 1:
+				valid = (a-1)/3 == (b-1)/3
+			}
+		}
+	case "street":
+		if len(sorted) == 3 {
+			a := sorted[0]
+			switch {
+			case a == 0: // trio 0-1-2 or 0-2-3
+				valid = sorted[1] == 1 && sorted[2] == 2 || sorted[1] == 2 && sorted[2] == 3
+			default:
+				valid = a%3 == 1 && sorted[1] == a+1 && sorted[2] == a+2
+			}
+		}
+	case "corner":
+		if len(sorted) == 4 {
+			a := sorted[0]
+			switch {
+			case a == 0: // first four
+				valid = sorted[1] == 1 && sorted[2] == 2 && sorted[3] == 3
+			default:
+				valid = a%3 != 0 && sorted[1] == a+1 && sorted[2] == a+3 && sorted[3] == a+4
+			}
+		}
+	default:
+		return fmt.Errorf("unknown inside bet type %q", t)
+	}
+	if !valid {
+		return fmt.Errorf("numbers %v do not form a %s", nums, t)
+	}
+	return nil
+}
+
+func rouletteNumbersParam(raw any) ([]int, error) {
+	switch v := raw.(type) {
+	case []int:
+		return append([]int(nil), v...), nil
+	case []any:
+		nums := make([]int, len(v))
+		for i, n := range v {
+			switch x := n.(type) {
+			case float64:
+				nums[i] = int(x)
+			case int:
+				nums[i] = x
+			case int64:
+				nums[i] = int(x)
+			default:
+				return nil, fmt.Errorf("numbers[%d] must be a number, got %T", i, n)
+			}
+		}
+		return nums, nil
+	default:
+		return nil, fmt.Errorf("numbers must be a list, got %T", raw)
+	}
+}
+
+// RouletteLayoutPayout returns the amount returned divided by the amount
+// staked for a pocket, with a per-chip breakdown.
+func RouletteLayoutPayout(bets []RouletteBet, pocket int) (float64, []map[string]any) {
+	staked, returned := 0.0, 0.0
+	breakdown := make([]map[string]any, len(bets))
+	for i, b := range bets {
+		won := b.Covers(pocket)
+		payout := 0.0
+		if won {
+			payout = b.Return()
+		}
+		staked += b.Amount
+		returned += payout
+		breakdown[i] = map[string]any{
+			"bet":     b.Name,
+			"type":    b.Type,
+			"numbers": b.Numbers,
+			"amount":  b.Amount,
+			"won":     won,
+			"payout":  payout,
+		}
+	}
+	if staked == 0 {
+		return 0, breakdown
+	}
+	return returned / staked, breakdown
+}
+
+func joinInts(nums []int) string {
+	parts := make([]string, len(nums))
+	for i, n := range nums {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ",")
+}
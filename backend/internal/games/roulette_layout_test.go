@@ -0,0 +1,103 @@
+package games
+
+import (
+	"math"
+	"testing"
+)
+
+func rouletteFloat(pocket int) float64 {
+	return (float64(pocket) + 0.5) / 37
+}
+
+func TestRouletteLayoutPayout(t *testing.T) {
+	game := &RouletteGame{}
+
+	tests := []struct {
+		name   string
+		chips  []any
+		pocket int
+		want   float64
+	}{
+		{"straight hit", []any{map[string]any{"value": "number17", "amount": 1.0}}, 17, 36},
+		{"straight miss", []any{map[string]any{"value": "number17", "amount": 1.0}}, 18, 0},
+		{"split", []any{map[string]any{"type": "split", "numbers": []any{17.0, 20.0}, "amount": 1.0}}, 20, 18},
+		{"split string", []any{map[string]any{"value": "split:0,2", "amount": 1.0}}, 0, 18},
+		{"street", []any{map[string]any{"value": "street:13,14,15", "amount": 1.0}}, 14, 12},
+		{"corner", []any{map[string]any{"value": "corner:17,18,20,21", "amount": 1.0}}, 21, 9},
+		{"dozen", []any{map[string]any{"value": "range1324", "amount": 1.0}}, 24, 3},
+		{"column", []any{map[string]any{"value": "column3", "amount": 1.0}}, 36, 3},
+		{"red", []any{map[string]any{"value": "colorRed", "amount": 1.0}}, 32, 2},
+		{"black on zero", []any{map[string]any{"value": "colorBlack", "amount": 1.0}}, 0, 0},
+		{"odd", []any{map[string]any{"value": "parityOdd", "amount": 1.0}}, 7, 2},
+		{"high", []any{map[string]any{"value": "range1936", "amount": 1.0}}, 19, 2},
+		{
+			"mixed layout",
+			[]any{
+				map[string]any{"value": "colorBlack", "amount": 3.0},
+				map[string]any{"value": "number0", "amount": 1.0},
+			},
+			0, 9, // 36 returned on 4 staked
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := game.EvaluateWithFloats([]float64{rouletteFloat(tt.pocket)}, map[string]any{"chips": tt.chips})
+			if err != nil {
+				t.Fatalf("evaluation failed: %v", err)
+			}
+			if math.Abs(result.Metric-tt.want) > 1e-9 {
+				t.Errorf("expected multiplier %v, got %v", tt.want, result.Metric)
+			}
+			details := result.Details.(map[string]any)
+			if details["pocket"] != tt.pocket {
+				t.Errorf("expected pocket %d, got %v", tt.pocket, details["pocket"])
+			}
+			if chips := details["chips"].([]map[string]any); len(chips) != len(tt.chips) {
+				t.Errorf("expected %d chip breakdowns, got %d", len(tt.chips), len(chips))
+			}
+		})
+	}
+}
+
+func TestRouletteScriptingChips(t *testing.T) {
+	// The scripting chips global is a []map[string]interface{}.
+	chips := []map[string]any{{"value": "colorBlack", "amount": 0.0001}}
+	bets, err := ParseRouletteChips(chips)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(bets) != 1 || len(bets[0].Numbers) != 18 || bets[0].Type != "color" {
+		t.Errorf("unexpected bets: %+v", bets)
+	}
+
+	// goja exports JS integers as int64.
+	ints := []map[string]any{{"type": "split", "numbers": []any{int64(1), int64(2)}, "amount": int64(3)}}
+	bets, err = ParseRouletteChips(ints)
+	if err != nil {
+		t.Fatalf("parse int64 chips failed: %v", err)
+	}
+	if bets[0].Amount != 3 || bets[0].Numbers[1] != 2 {
+		t.Errorf("unexpected bets: %+v", bets)
+	}
+}
+
+func TestRouletteInvalidChips(t *testing.T) {
+	game := &RouletteGame{}
+	bad := []any{
+		"colorRed",
+		[]any{},
+		[]any{map[string]any{"value": "colorGreen", "amount": 1.0}},
+		[]any{map[string]any{"value": "number37", "amount": 1.0}},
+		[]any{map[string]any{"value": "colorRed", "amount": 0.0}},
+		[]any{map[string]any{"value": "split:3,4", "amount": 1.0}},
+		[]any{map[string]any{"value": "street:2,3,4", "amount": 1.0}},
+		[]any{map[string]any{"type": "corner", "numbers": []any{3.0, 4.0, 6.0, 7.0}, "amount": 1.0}},
+		[]any{map[string]any{"type": "basket", "numbers": []any{0.0, 1.0}, "amount": 1.0}},
+	}
+	for _, chips := range bad {
+		if _, err := game.EvaluateWithFloats([]float64{0.5}, map[string]any{"chips": chips}); err == nil {
+			t.Errorf("expected error for chips %v", chips)
+		}
+	}
+}
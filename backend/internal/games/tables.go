@@ -0,0 +1,63 @@
+package games
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// payoutTables returns the data each table-driven game computes outcomes
+// from, payout constants included. Games that are pure functions of their
+// floats aren't listed.
+func payoutTables(game string) (any, bool) {
+	switch game {
+	case "blackjack":
+		return map[string]any{
+			"natural":       blackjackPayout,
+			"insurance_bet": blackjackInsuranceBet,
+			"insurance_win": blackjackInsuranceWin,
+			"cards":         blackjackDefaultCards,
+		}, true
+	case "baccarat":
+		return map[string]any{
+			"player": baccaratPlayerReturn,
+			"banker": baccaratBankerReturn,
+			"tie":    baccaratTieReturn,
+		}, true
+	case "roulette":
+		return map[string]any{"red": rouletteRed, "return": rouletteReturn}, true
+	case "keno":
+		return KenoPayouts, true
+	case "plinko":
+		return json.RawMessage(plinkoTablesJSON), true
+	case "pump":
+		return map[string]any{"m": pumpMValues, "multipliers": pumpMultiplierTables}, true
+	case "wheel":
+		return wheelPayouts, true
+	case "videopoker":
+		return videoPokerPaytable, true
+	}
+	return nil, false
+}
+
+// TableHash returns a SHA256 over the payout tables of game, so a stored run
+// can tell whether the tables it was scored with have changed since. The
+// second result is false for games without tables.
+func TableHash(game string) (string, bool) {
+	tables, ok := payoutTables(game)
+	if !ok {
+		return "", false
+	}
+	var data []byte
+	if raw, isRaw := tables.(json.RawMessage); isRaw {
+		data = raw
+	} else {
+		// Map keys are sorted by encoding/json, so the encoding is stable
+		var err error
+		if data, err = json.Marshal(tables); err != nil {
+			return "", false
+		}
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), true
+}
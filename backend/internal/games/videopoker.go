@@ -10,6 +10,13 @@ import (
 
 // VideoPokerGame implements the Video Poker provably fair game.
 // Uses Fisher-Yates shuffle to deal from a 52-card deck (no replacement).
+//
+// The metric is the Jacks or Better paytable multiplier of the final hand
+// under the "policy" param:
+//   - "hold":    the mask given in the "hold" param (default when it is set)
+//   - "optimal": the best hold knowing the replacement cards (default otherwise)
+//   - "ev":      the hold with the highest expected value from the initial
+//     hand alone; this enumerates every draw and is far slower to scan
 type VideoPokerGame struct{}
 
 const (
@@ -22,7 +29,27 @@ func (g *VideoPokerGame) Spec() GameSpec {
 	return GameSpec{
 		ID:          "videopoker",
 		Name:        "Video Poker",
-		MetricLabel: "first_card",
+		MetricLabel: "multiplier",
+	}
+}
+
+// ParamSchema describes video poker's parameters. The hold policy needs
+// a hold.
+func (g *VideoPokerGame) ParamSchema() ParamSchema {
+	return ParamSchema{
+		Params: map[string]ParamSpec{
+			"policy": {Type: ParamString, Enum: []string{"optimal", "hold", "ev"}},
+			"hold": {Type: ParamList, Parse: func(params map[string]any) error {
+				_, _, err := holdMaskFromParams(params)
+				return err
+			}},
+		},
+		Check: func(params map[string]any) error {
+			if params["policy"] == "hold" && params["hold"] == nil {
+				return fmt.Errorf("video poker policy \"hold\" requires a hold param")
+			}
+			return nil
+		},
 	}
 }
 
@@ -65,45 +92,80 @@ func (g *VideoPokerGame) EvaluateWithFloats(floats []float64, params map[string]
 		pool = append(pool[:index], pool[index+1:]...)
 	}
 
-	// Convert shuffled indices to cards
-	cards := make([]Card, len(shuffled))
-	for i, idx := range shuffled {
-		cards[i] = cardDeck[idx]
+	mask, hasHold, err := holdMaskFromParams(params)
+	if err != nil {
+		return GameResult{}, err
+	}
+	policy := "optimal"
+	if hasHold {
+		policy = "hold"
+	}
+	if p, ok := params["policy"].(string); ok && p != "" {
+		policy = p
 	}
+	if policy == "hold" && !hasHold {
+		return GameResult{}, fmt.Errorf("video poker policy \"hold\" requires a hold param")
+	}
+
+	deal := videoPokerDeal(shuffled)
 
-	// Initial hand is first 5 cards
-	hand := cards[:5]
-	// Replacement cards are next 5 (indices 5-9)
-	replacements := cards[5:10]
+	// Initial hand is first 5 cards; replacements are the next 5 (indices 5-9)
+	handRank := evaluatePokerHand(indexCards(shuffled[:5]))
 
-	handStrs := make([]string, 5)
-	for i, c := range hand {
-		handStrs[i] = c.String()
+	details := map[string]any{
+		"hand":               deckIndexStrings(shuffled[:5]),
+		"replacements":       deckIndexStrings(shuffled[5:10]),
+		"hand_rank":          handRank,
+		"initial_multiplier": VideoPokerMultiplier(handRank),
+		"total_cards":        len(shuffled),
+		"policy":             policy,
 	}
 
-	replStrs := make([]string, 5)
-	for i, c := range replacements {
-		replStrs[i] = c.String()
+	var metric float64
+	addHold := func(prefix string, m int) float64 {
+		final := deal.draw(m)
+		rank := videoPokerHandClasses[videoPokerClass(&final)]
+		details[prefix+"_hold"] = holdMaskSlice(m)
+		details[prefix+"_hand"] = deckIndexStrings(final[:])
+		details[prefix+"_rank"] = rank
+		details[prefix+"_multiplier"] = VideoPokerMultiplier(rank)
+		return VideoPokerMultiplier(rank)
 	}
 
-	// Evaluate the initial hand
-	handRank := evaluatePokerHand(hand)
+	optimalMask, _ := deal.optimalHold()
+	optimal := addHold("optimal", optimalMask)
 
-	// First card index (0-51) as metric
-	firstCardIndex := shuffled[0]
+	switch policy {
+	case "optimal":
+		metric = optimal
+	case "hold":
+		metric = addHold("final", mask)
+	case "ev":
+		evMask, expected := deal.expectedValueHold()
+		metric = addHold("ev", evMask)
+		details["ev_expected"] = expected
+	default:
+		return GameResult{}, fmt.Errorf("video poker policy must be one of hold, optimal, ev; got %q", policy)
+	}
+	if hasHold && policy != "hold" {
+		addHold("final", mask)
+	}
 
 	return GameResult{
-		Metric:      float64(firstCardIndex),
-		MetricLabel: "first_card",
-		Details: map[string]any{
-			"hand":         handStrs,
-			"replacements": replStrs,
-			"hand_rank":    handRank,
-			"total_cards":  len(cards),
-		},
+		Metric:      metric,
+		MetricLabel: "multiplier",
+		Details:     details,
 	}, nil
 }
 
+func indexCards(idx []int) []Card {
+	cards := make([]Card, len(idx))
+	for i, c := range idx {
+		cards[i] = cardDeck[c]
+	}
+	return cards
+}
+
 // evaluatePokerHand returns a string describing the best poker hand.
 func evaluatePokerHand(cards []Card) string {
 	if len(cards) != 5 {
@@ -0,0 +1,224 @@
+package games
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Hand classes in ascending paytable order. Indices match videoPokerPaytable.
+var videoPokerHandClasses = []string{
+	"high_card",
+	"pair",
+	"jacks_or_better",
+	"two_pair",
+	"three_of_a_kind",
+	"straight",
+	"flush",
+	"full_house",
+	"four_of_a_kind",
+	"straight_flush",
+	"royal_flush",
+}
+
+// videoPokerPaytable is Stake's Jacks or Better paytable, indexed like
+// videoPokerHandClasses.
+var videoPokerPaytable = []float64{0, 0, 1, 2, 3, 4, 6, 9, 22, 60, 800}
+
+// VideoPokerMultiplier returns the paytable multiplier for a hand rank as
+// returned in the "hand_rank" detail.
+func VideoPokerMultiplier(rank string) float64 {
+	for i, name := range videoPokerHandClasses {
+		if name == rank {
+			return videoPokerPaytable[i]
+		}
+	}
+	return 0
+}
+
+// videoPokerClass classifies five deck indices (rank*4+suit, see cardDeck)
+// without allocating. It agrees with evaluatePokerHand and is used in the
+// expected-value search, which evaluates millions of hands per deal.
+func videoPokerClass(hand *[5]int) int {
+	var counts [13]uint8
+	var rankMask uint16
+	flush := true
+	suit := hand[0] & 3
+	for _, c := range hand {
+		r := c >> 2
+		counts[r]++
+		rankMask |= 1 << r
+		if c&3 != suit {
+			flush = false
+		}
+	}
+
+	switch bits.OnesCount16(rankMask) {
+	case 5:
+		straight := rankMask>>bits.TrailingZeros16(rankMask) == 0x1F || rankMask == 0x100F // A-2-3-4-5
+		switch {
+		case straight && flush && rankMask == 0x1F00: // 10-J-Q-K-A
+			return 10
+		case straight && flush:
+			return 9
+		case flush:
+			return 6
+		case straight:
+			return 5
+		}
+		return 0
+	case 4:
+		for r := 9; r < 13; r++ { // J, Q, K, A
+			if counts[r] == 2 {
+				return 2
+			}
+		}
+		return 1
+	case 3:
+		for _, n := range counts {
+			if n == 3 {
+				return 4
+			}
+		}
+		return 3
+	default:
+		for _, n := range counts {
+			if n == 4 {
+				return 8
+			}
+		}
+		return 7
+	}
+}
+
+// videoPokerDeal is a shuffled deck where the first five cards are the
+// initial hand and the following cards replace discards in order.
+type videoPokerDeal []int
+
+// draw returns the final hand for a hold mask (bit i holds position i).
+// Discarded positions are filled left to right from the replacement cards.
+func (d videoPokerDeal) draw(mask int) [5]int {
+	var final [5]int
+	next := 5
+	for i := 0; i < 5; i++ {
+		if mask&(1<<i) != 0 {
+			final[i] = d[i]
+		} else {
+			final[i] = d[next]
+			next++
+		}
+	}
+	return final
+}
+
+// optimalHold returns the hold mask with the highest final payout given the
+// replacement cards. Ties go to the mask holding the most cards.
+func (d videoPokerDeal) optimalHold() (int, float64) {
+	bestMask, best := 0, -1.0
+	for mask := 31; mask >= 0; mask-- {
+		final := d.draw(mask)
+		if pay := videoPokerPaytable[videoPokerClass(&final)]; pay > best {
+			bestMask, best = mask, pay
+		}
+	}
+	return bestMask, best
+}
+
+// expectedValueHold returns the hold mask with the highest expected payout
+// over every possible set of replacements from the 47 unseen cards, without
+// looking at the replacement cards themselves. Ties go to the mask holding
+// the most cards.
+func (d videoPokerDeal) expectedValueHold() (int, float64) {
+	var inHand [52]bool
+	for _, c := range d[:5] {
+		inHand[c] = true
+	}
+	unseen := make([]int, 0, 47)
+	for c := 0; c < 52; c++ {
+		if !inHand[c] {
+			unseen = append(unseen, c)
+		}
+	}
+
+	bestMask, best := 0, -1.0
+	for mask := 31; mask >= 0; mask-- {
+		var hand [5]int
+		held := 0
+		for i := 0; i < 5; i++ {
+			if mask&(1<<i) != 0 {
+				hand[held] = d[i]
+				held++
+			}
+		}
+		total, combos := videoPokerSumDraws(&hand, held, unseen, 0)
+		if ev := total / float64(combos); ev > best {
+			bestMask, best = mask, ev
+		}
+	}
+	return bestMask, best
+}
+
+// videoPokerSumDraws fills hand[pos:] with every combination of cards from
+// unseen[start:] and returns the summed payout and number of combinations.
+func videoPokerSumDraws(hand *[5]int, pos int, unseen []int, start int) (float64, int) {
+	if pos == 5 {
+		return videoPokerPaytable[videoPokerClass(hand)], 1
+	}
+	total, combos := 0.0, 0
+	for i := start; i <= len(unseen)-(5-pos); i++ {
+		hand[pos] = unseen[i]
+		t, n := videoPokerSumDraws(hand, pos+1, unseen, i+1)
+		total += t
+		combos += n
+	}
+	return total, combos
+}
+
+// holdMaskFromParams reads the optional "hold" param: five booleans, one per
+// hand position, as sent to Stake's videoPoker/next endpoint.
+func holdMaskFromParams(params map[string]any) (int, bool, error) {
+	var held []bool
+	switch v := params["hold"].(type) {
+	case nil:
+		return 0, false, nil
+	case []bool:
+		held = v
+	case []any:
+		held = make([]bool, len(v))
+		for i, h := range v {
+			b, ok := h.(bool)
+			if !ok {
+				return 0, false, fmt.Errorf("video poker hold[%d] must be a boolean, got %T", i, h)
+			}
+			held[i] = b
+		}
+	default:
+		return 0, false, fmt.Errorf("video poker hold must be a list of 5 booleans, got %T", v)
+	}
+	if len(held) != 5 {
+		return 0, false, fmt.Errorf("video poker hold must have 5 entries, got %d", len(held))
+	}
+
+	mask := 0
+	for i, h := range held {
+		if h {
+			mask |= 1 << i
+		}
+	}
+	return mask, true, nil
+}
+
+func holdMaskSlice(mask int) []bool {
+	held := make([]bool, 5)
+	for i := range held {
+		held[i] = mask&(1<<i) != 0
+	}
+	return held
+}
+
+func deckIndexStrings(idx []int) []string {
+	out := make([]string, len(idx))
+	for i, c := range idx {
+		out[i] = cardDeck[c].String()
+	}
+	return out
+}
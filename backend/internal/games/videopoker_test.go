@@ -1,6 +1,9 @@
 package games
 
-import "testing"
+import (
+	"math/rand"
+	"testing"
+)
 
 func TestVideoPokerGame(t *testing.T) {
 	game := &VideoPokerGame{}
@@ -60,8 +63,11 @@ func TestVideoPokerEvaluation(t *testing.T) {
 		t.Errorf("invalid hand rank: %s", handRank)
 	}
 
-	if result.Metric < 0 || result.Metric > 51 {
-		t.Errorf("metric (first card index) should be 0-51, got %f", result.Metric)
+	if result.Metric < 0 || result.Metric > 800 {
+		t.Errorf("metric (multiplier) should be 0-800, got %f", result.Metric)
+	}
+	if result.Metric < details["initial_multiplier"].(float64) {
+		t.Errorf("optimal hold should never pay less than holding the initial hand")
 	}
 }
 
@@ -184,3 +190,104 @@ func TestPokerHandEvaluation(t *testing.T) {
 		})
 	}
 }
+
+// shuffleFloats returns floats whose Fisher-Yates selection deals the given
+// cards first, followed by the rest of the deck in index order.
+func shuffleFloats(cards ...string) []float64 {
+	pool := make([]int, 52)
+	for i := range pool {
+		pool[i] = i
+	}
+	floats := make([]float64, 52)
+	for i := range floats {
+		pos := 0
+		if i < len(cards) {
+			for j, idx := range pool {
+				if cardDeck[idx].String() == cards[i] {
+					pos = j
+					break
+				}
+			}
+		}
+		floats[i] = (float64(pos) + 0.5) / float64(len(pool))
+		pool = append(pool[:pos], pool[pos+1:]...)
+	}
+	return floats
+}
+
+func TestVideoPokerClassMatchesEvaluator(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	for n := 0; n < 20000; n++ {
+		perm := rng.Perm(52)
+		var hand [5]int
+		copy(hand[:], perm[:5])
+		want := evaluatePokerHand(indexCards(hand[:]))
+		if got := videoPokerHandClasses[videoPokerClass(&hand)]; got != want {
+			t.Fatalf("hand %v: class %s, evaluator %s", deckIndexStrings(hand[:]), got, want)
+		}
+	}
+}
+
+func TestVideoPokerHoldPolicies(t *testing.T) {
+	game := &VideoPokerGame{}
+	// Four to a royal plus a low card; the first replacement completes it.
+	floats := shuffleFloats("♠A", "♠K", "♠Q", "♠J", "♦3", "♠10", "♥2", "♣2", "♦2", "♥3")
+
+	optimal, err := game.EvaluateWithFloats(floats, nil)
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	if optimal.Metric != 800 {
+		t.Errorf("expected optimal hold to make a royal flush (800), got %v", optimal.Metric)
+	}
+
+	holdAll, err := game.EvaluateWithFloats(floats, map[string]any{"hold": []any{true, true, true, true, true}})
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	if holdAll.Metric != 0 || holdAll.Details.(map[string]any)["final_rank"] != "high_card" {
+		t.Errorf("expected holding all five to stay high card, got %v", holdAll.Metric)
+	}
+
+	// Discarding the first two positions draws the first two replacements.
+	drawTwo, err := game.EvaluateWithFloats(floats, map[string]any{"hold": []bool{false, false, true, true, true}})
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	final := drawTwo.Details.(map[string]any)["final_hand"].([]string)
+	if final[0] != "♠10" || final[1] != "♥2" {
+		t.Errorf("expected replacements in discard order, got %v", final)
+	}
+
+	ev, err := game.EvaluateWithFloats(floats, map[string]any{"policy": "ev"})
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	held := ev.Details.(map[string]any)["ev_hold"].([]bool)
+	want := []bool{true, true, true, true, false}
+	for i := range want {
+		if held[i] != want[i] {
+			t.Fatalf("expected ev hold %v, got %v", want, held)
+		}
+	}
+	if ev.Metric != 800 {
+		t.Errorf("expected ev hold to draw the royal flush, got %v", ev.Metric)
+	}
+}
+
+func TestVideoPokerInvalidParams(t *testing.T) {
+	game := &VideoPokerGame{}
+	floats := shuffleFloats()
+
+	bad := []map[string]any{
+		{"hold": []bool{true, false}},
+		{"hold": "11111"},
+		{"policy": "hold"},
+		{"policy": "greedy"},
+	}
+	for _, params := range bad {
+		if _, err := game.EvaluateWithFloats(floats, params); err == nil {
+			t.Errorf("expected error for params %v", params)
+		}
+	}
+}
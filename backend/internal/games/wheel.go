@@ -110,6 +110,21 @@ func (g *WheelGame) Spec() GameSpec {
 	}
 }
 
+// ParamSchema describes wheel's parameters. Segments may be sent as a
+// string.
+func (g *WheelGame) ParamSchema() ParamSchema {
+	return ParamSchema{Params: map[string]ParamSpec{
+		"segments": {Parse: func(params map[string]any) error {
+			_, err := wheelSegmentsFromParams(params)
+			return err
+		}},
+		"risk": {Type: ParamString, Parse: func(params map[string]any) error {
+			_, err := wheelRiskFromParams(params)
+			return err
+		}},
+	}}
+}
+
 // FloatCount returns the number of floats required (always 1).
 func (g *WheelGame) FloatCount(params map[string]any) int {
 	return 1
@@ -0,0 +1,456 @@
+package jobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+	"github.com/MJE43/stake-pf-replay-go/internal/repro"
+	"github.com/MJE43/stake-pf-replay-go/internal/scan"
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+)
+
+const (
+	defaultMaxConcurrent = 2
+	defaultChunkSize     = 1 << 20
+)
+
+// Config bounds how much work the queue does at once.
+type Config struct {
+	// MaxWorkers caps scan goroutines across all running jobs.
+	// Default: the size of Budget, or GOMAXPROCS without one.
+	MaxWorkers int
+	// Budget is shared with scans run outside the queue so that together
+	// they stay within one worker limit. Default: a budget of MaxWorkers
+	// used only by the queue.
+	Budget *scan.WorkerBudget
+	// MaxConcurrent is how many jobs run at the same time; each gets an
+	// equal share of MaxWorkers. Default: 2.
+	MaxConcurrent int
+	// ChunkSize is the number of nonces scanned between checkpoints.
+	ChunkSize uint64
+	// EngineVersion is recorded on the runs jobs create.
+	EngineVersion string
+}
+
+// Queue runs scan jobs from a Store in priority order, saving each job's
+// results as a run in a store.DB.
+type Queue struct {
+	store *Store
+	runs  store.DB
+	cfg   Config
+
+	mu      sync.Mutex
+	running map[string]*activeJob
+	wake    chan struct{}
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+type activeJob struct {
+	cancel context.CancelFunc
+	stopAs Status // set by Pause/Cancel before cancelling
+}
+
+// NewQueue creates a queue. Call Start to begin running jobs.
+func NewQueue(jobStore *Store, runs store.DB, cfg Config) *Queue {
+	if cfg.MaxWorkers <= 0 {
+		if cfg.Budget != nil {
+			cfg.MaxWorkers = cfg.Budget.Size()
+		} else {
+			cfg.MaxWorkers = runtime.GOMAXPROCS(0)
+		}
+	}
+	if cfg.Budget == nil {
+		cfg.Budget = scan.NewWorkerBudget(cfg.MaxWorkers)
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = defaultMaxConcurrent
+	}
+	if cfg.MaxConcurrent > cfg.MaxWorkers {
+		cfg.MaxConcurrent = cfg.MaxWorkers
+	}
+	if cfg.ChunkSize == 0 {
+		cfg.ChunkSize = defaultChunkSize
+	}
+	if cfg.EngineVersion == "" {
+		cfg.EngineVersion = scan.EngineVersion
+	}
+	return &Queue{
+		store:   jobStore,
+		runs:    runs,
+		cfg:     cfg,
+		running: make(map[string]*activeJob),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Start requeues jobs interrupted by a previous shutdown and starts the
+// scheduler.
+func (q *Queue) Start(ctx context.Context) error {
+	n, err := q.store.RequeueInterrupted()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("jobs: resuming %d interrupted job(s)", n)
+	}
+
+	ctx, q.cancel = context.WithCancel(ctx)
+	q.wg.Add(1)
+	go q.loop(ctx)
+	q.notify()
+	return nil
+}
+
+// Stop stops the scheduler and interrupts running jobs. They stay marked
+// running and are resumed from their last checkpoint by the next Start.
+func (q *Queue) Stop() {
+	if q.cancel != nil {
+		q.cancel()
+	}
+	q.wg.Wait()
+}
+
+// Enqueue validates a scan request and adds it to the queue. The request's
+// TimeoutMs is ignored; queued jobs run until done, paused or cancelled.
+func (q *Queue) Enqueue(req scan.ScanRequest, priority int) (*Job, error) {
+	if _, ok := games.GetGame(req.Game); !ok {
+		return nil, scan.ErrGameNotFound
+	}
+	if req.NonceEnd < req.NonceStart {
+		return nil, scan.ErrInvalidNonce
+	}
+	if req.TargetOp.IsRanked() && req.Limit <= 0 {
+		return nil, scan.ErrInvalidLimit
+	}
+	req.TimeoutMs = 0
+
+	job := &Job{Request: req, Priority: priority}
+	if err := q.store.Create(job); err != nil {
+		return nil, err
+	}
+	q.notify()
+	return job, nil
+}
+
+// Get returns a job.
+func (q *Queue) Get(id string) (*Job, error) {
+	return q.store.Get(id)
+}
+
+// List returns jobs with the given status, or all jobs if status is empty.
+func (q *Queue) List(status Status) ([]Job, error) {
+	return q.store.List(status)
+}
+
+// Pause stops a queued or running job. A running job keeps the progress of
+// its last completed chunk.
+func (q *Queue) Pause(id string) error {
+	return q.stop(id, StatusPaused, StatusQueued, StatusRunning)
+}
+
+// Cancel stops a job for good. Hits already saved to its run are kept.
+func (q *Queue) Cancel(id string) error {
+	return q.stop(id, StatusCancelled, StatusQueued, StatusRunning, StatusPaused)
+}
+
+// Resume puts a paused job back in the queue.
+func (q *Queue) Resume(id string) error {
+	ok, err := q.store.SetStatus(id, StatusQueued, StatusPaused)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("jobs: job %s is not paused: %w", id, ErrInvalidState)
+	}
+	q.notify()
+	return nil
+}
+
+// SetPriority changes the priority of an unfinished job. Higher runs first;
+// running jobs are not preempted.
+func (q *Queue) SetPriority(id string, priority int) error {
+	ok, err := q.store.SetPriority(id, priority)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("jobs: job %s has already finished: %w", id, ErrInvalidState)
+	}
+	q.notify()
+	return nil
+}
+
+func (q *Queue) stop(id string, to Status, from ...Status) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ok, err := q.store.SetStatus(id, to, from...)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("jobs: cannot move job %s to %s: %w", id, to, ErrInvalidState)
+	}
+	if active, running := q.running[id]; running {
+		active.stopAs = to
+		active.cancel()
+	}
+	q.notify()
+	return nil
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) loop(ctx context.Context) {
+	defer q.wg.Done()
+	for {
+		q.schedule(ctx)
+		select {
+		case <-q.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// schedule starts queued jobs until MaxConcurrent are running.
+func (q *Queue) schedule(ctx context.Context) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.running) < q.cfg.MaxConcurrent && ctx.Err() == nil {
+		skip := make(map[string]bool, len(q.running))
+		for id := range q.running {
+			skip[id] = true
+		}
+		job, err := q.store.NextQueued(skip)
+		if err != nil {
+			log.Printf("jobs: pick next job: %v", err)
+			return
+		}
+		if job == nil {
+			return
+		}
+		ok, err := q.store.SetStatus(job.ID, StatusRunning, StatusQueued)
+		if err != nil {
+			log.Printf("jobs: start job %s: %v", job.ID, err)
+			return
+		}
+		if !ok {
+			continue
+		}
+		job.Status = StatusRunning
+
+		jobCtx, cancel := context.WithCancel(ctx)
+		active := &activeJob{cancel: cancel}
+		q.running[job.ID] = active
+		q.wg.Add(1)
+		go q.execute(jobCtx, job, active)
+	}
+}
+
+func (q *Queue) execute(ctx context.Context, job *Job, active *activeJob) {
+	defer q.wg.Done()
+
+	err := q.run(ctx, job)
+
+	q.mu.Lock()
+	delete(q.running, job.ID)
+	stopped := active.stopAs != ""
+	q.mu.Unlock()
+	active.cancel()
+
+	switch {
+	case err == nil:
+		// A Pause that raced with the last chunk finds nothing left to do;
+		// the job finished either way
+		if _, err := q.store.SetStatus(job.ID, StatusCompleted, StatusRunning, StatusPaused); err != nil {
+			log.Printf("jobs: complete job %s: %v", job.ID, err)
+		}
+	case errors.Is(err, context.Canceled) && stopped:
+		// Pause or Cancel already recorded the new status
+	case errors.Is(err, context.Canceled):
+		// Queue shutdown: leave the job running so Start resumes it
+	default:
+		log.Printf("jobs: job %s failed: %v", job.ID, err)
+		if ferr := q.store.Fail(job.ID, err); ferr != nil {
+			log.Printf("jobs: record failure of job %s: %v", job.ID, ferr)
+		}
+	}
+	q.notify()
+}
+
+// run scans the rest of a job's range chunk by chunk, checkpointing after
+// each one, and finalizes its run.
+func (q *Queue) run(ctx context.Context, job *Job) error {
+	req := job.Request
+	ranked := req.TargetOp.IsRanked()
+
+	run, err := q.prepareRun(job)
+	if err != nil {
+		return err
+	}
+
+	scanner := scan.NewScannerWithWorkers(q.cfg.MaxWorkers / q.cfg.MaxConcurrent).WithBudget(q.cfg.Budget)
+	for job.NextNonce <= req.NonceEnd {
+		if !ranked && req.Limit > 0 && job.HitsFound >= req.Limit {
+			break
+		}
+
+		end := job.NextNonce + q.cfg.ChunkSize - 1
+		if end > req.NonceEnd || end < job.NextNonce {
+			end = req.NonceEnd
+		}
+		limit := req.Limit
+		if !ranked && limit > 0 {
+			limit -= job.HitsFound
+		}
+
+		res, err := scanner.ScanBatch(ctx, scan.BatchScanRequest{
+			Game:       req.Game,
+			Ranges:     []scan.SeedRange{{Seeds: req.Seeds, NonceStart: job.NextNonce, NonceEnd: end}},
+			Params:     req.Params,
+			TargetOp:   req.TargetOp,
+			TargetVal:  req.TargetVal,
+			TargetVal2: req.TargetVal2,
+			Tolerance:  req.Tolerance,
+			Limit:      limit,
+		})
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err // the partial chunk is scanned again on resume
+		}
+
+		part := res.Results[0]
+		if ranked {
+			job.Ranked = scan.MergeRankedHits(req.TargetOp, req.Limit, job.Ranked, part.Hits)
+		} else {
+			hits := make([]store.Hit, len(part.Hits))
+			for i, h := range part.Hits {
+				hits[i] = store.Hit{RunID: run.ID, Nonce: h.Nonce, Metric: h.Metric}
+				job.trackMetric(h.Metric)
+			}
+			if err := q.runs.SaveHits(run.ID, hits); err != nil {
+				return err
+			}
+			job.HitsFound += len(hits)
+		}
+		job.Evaluated += part.Summary.TotalEvaluated
+
+		job.NextNonce = end + 1
+		if err := q.store.Checkpoint(job); err != nil {
+			return err
+		}
+	}
+
+	if ranked {
+		job.MetricSum = 0 // summed over the final hits only
+		hits := make([]store.Hit, len(job.Ranked))
+		for i, h := range job.Ranked {
+			rank := i + 1
+			hits[i] = store.Hit{RunID: run.ID, Nonce: h.Nonce, Metric: h.Metric, Rank: &rank}
+			job.trackMetric(h.Metric)
+		}
+		if err := q.runs.DeleteHitsFrom(run.ID, 0); err != nil {
+			return err
+		}
+		if err := q.runs.SaveHits(run.ID, hits); err != nil {
+			return err
+		}
+		job.HitsFound = len(hits)
+	}
+
+	run.HitCount = job.HitsFound
+	run.TotalEvaluated = job.Evaluated
+	run.SummaryMin = job.MetricMin
+	run.SummaryMax = job.MetricMax
+	run.SummaryCount = job.HitsFound
+	if job.HitsFound > 0 {
+		sum := job.MetricSum
+		run.SummarySum = &sum
+	}
+	if err := q.runs.UpdateRun(run); err != nil {
+		return err
+	}
+	return q.store.Checkpoint(job)
+}
+
+// prepareRun creates the job's run on first start. When resuming, it drops
+// hits saved past the last checkpoint so the chunk can be scanned again.
+func (q *Queue) prepareRun(job *Job) (*store.Run, error) {
+	if job.RunID != "" {
+		run, err := q.runs.GetRun(job.RunID)
+		if err != nil {
+			return nil, fmt.Errorf("jobs: load run %s: %w", job.RunID, err)
+		}
+		if err := q.runs.DeleteHitsFrom(run.ID, job.NextNonce); err != nil {
+			return nil, err
+		}
+		return run, nil
+	}
+
+	req := job.Request
+	serverHash := sha256.Sum256([]byte(req.Seeds.Server))
+	paramsJSON := "{}"
+	if req.Params != nil {
+		if b, err := json.Marshal(req.Params); err == nil {
+			paramsJSON = string(b)
+		}
+	}
+	run := &store.Run{
+		Game:           req.Game,
+		ServerSeed:     req.Seeds.Server,
+		ServerSeedHash: hex.EncodeToString(serverHash[:]),
+		ClientSeed:     req.Seeds.Client,
+		NonceStart:     req.NonceStart,
+		NonceEnd:       req.NonceEnd,
+		ParamsJSON:     paramsJSON,
+		TargetOp:       string(req.TargetOp),
+		TargetVal:      req.TargetVal,
+		Tolerance:      req.Tolerance,
+		HitLimit:       req.Limit,
+		EngineVersion:  q.cfg.EngineVersion,
+	}
+	if manifest, err := repro.New(req); err == nil {
+		run.Manifest = manifest.String()
+	}
+	if hash, ok := games.CustomGameHash(req.Game); ok {
+		if len(hash) > 12 {
+			hash = hash[:12]
+		}
+		run.EngineVersion += "+custom." + hash
+	}
+	if err := q.runs.SaveRun(run); err != nil {
+		return nil, err
+	}
+	job.RunID = run.ID
+	return run, q.store.Checkpoint(job)
+}
+
+func (j *Job) trackMetric(m float64) {
+	if j.MetricMin == nil || m < *j.MetricMin {
+		v := m
+		j.MetricMin = &v
+	}
+	if j.MetricMax == nil || m > *j.MetricMax {
+		v := m
+		j.MetricMax = &v
+	}
+	j.MetricSum += m
+}
@@ -0,0 +1,373 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/atrest"
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+	"github.com/MJE43/stake-pf-replay-go/internal/scan"
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+)
+
+func testQueue(t *testing.T, cfg Config) (*Queue, *Store, *store.SQLiteDB) {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "jobs.db")
+
+	runs, err := store.NewSQLiteDB(dbPath)
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	if err := runs.Migrate(); err != nil {
+		t.Fatalf("Migrate runs: %v", err)
+	}
+	jobStore, err := NewStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if err := jobStore.Migrate(); err != nil {
+		t.Fatalf("Migrate jobs: %v", err)
+	}
+
+	q := NewQueue(jobStore, runs, cfg)
+	t.Cleanup(func() {
+		q.Stop()
+		jobStore.Close()
+		runs.Close()
+	})
+	return q, jobStore, runs
+}
+
+func waitForStatus(t *testing.T, q *Queue, id string, want Status) *Job {
+	t.Helper()
+	deadline := time.Now().Add(20 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if job.Status == want {
+			return job
+		}
+		if job.Status == StatusFailed {
+			t.Fatalf("job %s failed: %s", id, job.Error)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not reach %s", id, want)
+	return nil
+}
+
+func limboRequest(end uint64) scan.ScanRequest {
+	return scan.ScanRequest{
+		Game:       "limbo",
+		Seeds:      games.Seeds{Server: "queue_server", Client: "queue_client"},
+		NonceStart: 1,
+		NonceEnd:   end,
+		TargetOp:   scan.OpGreaterEqual,
+		TargetVal:  10,
+	}
+}
+
+// expectedHits scans req serially.
+func expectedHits(req scan.ScanRequest) []scan.Hit {
+	game, _ := games.GetGame(req.Game)
+	var hits []scan.Hit
+	for nonce := req.NonceStart; nonce <= req.NonceEnd; nonce++ {
+		res, _ := game.Evaluate(req.Seeds, nonce, req.Params)
+		if res.Metric >= req.TargetVal-1e-9 {
+			hits = append(hits, scan.Hit{Nonce: nonce, Metric: res.Metric})
+		}
+	}
+	return hits
+}
+
+func checkRunHits(t *testing.T, runs *store.SQLiteDB, runID string, want []scan.Hit) {
+	t.Helper()
+	got, err := runs.GetHits(runID, len(want)+10, 0)
+	if err != nil {
+		t.Fatalf("GetHits: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d saved hits, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].Nonce != want[i].Nonce || got[i].Metric != want[i].Metric {
+			t.Errorf("hit %d: expected %+v, got nonce %d metric %v", i, want[i], got[i].Nonce, got[i].Metric)
+		}
+	}
+}
+
+func TestQueueRunsJobToCompletion(t *testing.T) {
+	q, _, runs := testQueue(t, Config{MaxWorkers: 2, ChunkSize: 3000})
+	req := limboRequest(20000)
+
+	job, err := q.Enqueue(req, 0)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if err := q.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	done := waitForStatus(t, q, job.ID, StatusCompleted)
+	want := expectedHits(req)
+	if done.Evaluated != 20000 || done.HitsFound != len(want) || done.Progress != 1 {
+		t.Errorf("unexpected job counters: %+v", done)
+	}
+
+	run, err := runs.GetRun(done.RunID)
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if run.HitCount != len(want) || run.TotalEvaluated != 20000 {
+		t.Errorf("unexpected run totals: hits %d evaluated %d", run.HitCount, run.TotalEvaluated)
+	}
+	sum := 0.0
+	for _, h := range want {
+		sum += h.Metric
+	}
+	if run.SummarySum == nil || math.Abs(*run.SummarySum-sum) > 1e-6 {
+		t.Errorf("expected summary sum %g, got %v", sum, run.SummarySum)
+	}
+	checkRunHits(t, runs, run.ID, want)
+}
+
+func TestQueuePauseRacingCompletion(t *testing.T) {
+	q, jobStore, _ := testQueue(t, Config{MaxWorkers: 2, ChunkSize: 3000})
+	job, err := q.Enqueue(limboRequest(2000), 0)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	// The job is running its last chunk when Pause records its status
+	if _, err := jobStore.SetStatus(job.ID, StatusRunning, StatusQueued); err != nil {
+		t.Fatalf("SetStatus: %v", err)
+	}
+	if _, err := jobStore.SetStatus(job.ID, StatusPaused, StatusRunning); err != nil {
+		t.Fatalf("SetStatus: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q.wg.Add(1)
+	q.execute(ctx, job, &activeJob{cancel: cancel, stopAs: StatusPaused})
+
+	if got, _ := q.Get(job.ID); got.Status != StatusCompleted {
+		t.Errorf("expected the finished job completed, got %s", got.Status)
+	}
+}
+
+func TestQueueRankedJobAcrossChunks(t *testing.T) {
+	q, _, runs := testQueue(t, Config{MaxWorkers: 2, ChunkSize: 1500})
+	req := limboRequest(10000)
+	req.TargetOp = scan.OpTopK
+	req.Limit = 15
+
+	job, err := q.Enqueue(req, 0)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if err := q.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	done := waitForStatus(t, q, job.ID, StatusCompleted)
+
+	direct, err := scan.NewScanner().Scan(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	page, err := runs.GetRunHits(done.RunID, 1, 100)
+	if err != nil {
+		t.Fatalf("GetRunHits: %v", err)
+	}
+	if len(page.Hits) != len(direct.Hits) {
+		t.Fatalf("expected %d ranked hits, got %d", len(direct.Hits), len(page.Hits))
+	}
+	for i, h := range direct.Hits {
+		got := page.Hits[i]
+		if got.Nonce != h.Nonce || got.Rank == nil || *got.Rank != i+1 {
+			t.Errorf("rank %d: expected nonce %d, got nonce %d rank %v", i+1, h.Nonce, got.Nonce, got.Rank)
+		}
+	}
+}
+
+func TestQueuePriorityOrder(t *testing.T) {
+	q, _, _ := testQueue(t, Config{MaxWorkers: 1, MaxConcurrent: 1})
+
+	low, err := q.Enqueue(limboRequest(5000), 0)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	high, err := q.Enqueue(limboRequest(5000), 5)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if err := q.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	lowDone := waitForStatus(t, q, low.ID, StatusCompleted)
+	highDone := waitForStatus(t, q, high.ID, StatusCompleted)
+	if !highDone.StartedAt.Before(*lowDone.StartedAt) {
+		t.Errorf("high priority job started at %v, after low priority job at %v", highDone.StartedAt, lowDone.StartedAt)
+	}
+}
+
+func TestQueuePauseResume(t *testing.T) {
+	q, _, _ := testQueue(t, Config{MaxWorkers: 2})
+
+	job, err := q.Enqueue(limboRequest(5000), 0)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if err := q.Pause(job.ID); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if err := q.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if got, _ := q.Get(job.ID); got.Status != StatusPaused {
+		t.Fatalf("paused job should not run, status %s", got.Status)
+	}
+	if err := q.Resume(job.ID); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	waitForStatus(t, q, job.ID, StatusCompleted)
+
+	if err := q.Pause(job.ID); err == nil {
+		t.Error("expected an error pausing a completed job")
+	}
+}
+
+func TestQueueRecoversInterruptedJob(t *testing.T) {
+	q, jobStore, runs := testQueue(t, Config{MaxWorkers: 2, ChunkSize: 4000})
+	req := limboRequest(16000)
+	want := expectedHits(req)
+
+	// Simulate a process that checkpointed the first chunk, saved some hits
+	// from the second and then died while the job was running.
+	job := &Job{Request: req}
+	if err := jobStore.Create(job); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	run := &store.Run{Game: req.Game, ServerSeed: req.Seeds.Server, ClientSeed: req.Seeds.Client,
+		NonceStart: req.NonceStart, NonceEnd: req.NonceEnd, TargetOp: string(req.TargetOp),
+		TargetVal: req.TargetVal, EngineVersion: "v1.0.0"}
+	if err := runs.SaveRun(run); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	var first, partial []store.Hit
+	for _, h := range want {
+		hit := store.Hit{RunID: run.ID, Nonce: h.Nonce, Metric: h.Metric}
+		switch {
+		case h.Nonce <= 4000:
+			first = append(first, hit)
+		case h.Nonce <= 6000:
+			partial = append(partial, hit)
+		}
+	}
+	if err := runs.SaveHits(run.ID, append(first, partial...)); err != nil {
+		t.Fatalf("SaveHits: %v", err)
+	}
+	job.RunID = run.ID
+	job.NextNonce = 4001
+	job.Evaluated = 4000
+	job.HitsFound = len(first)
+	if err := jobStore.Checkpoint(job); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+	if _, err := jobStore.SetStatus(job.ID, StatusRunning); err != nil {
+		t.Fatalf("SetStatus: %v", err)
+	}
+
+	if err := q.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	done := waitForStatus(t, q, job.ID, StatusCompleted)
+	if done.RunID != run.ID || done.Evaluated != 16000 || done.HitsFound != len(want) {
+		t.Errorf("unexpected recovered job: %+v", done)
+	}
+	checkRunHits(t, runs, run.ID, want)
+}
+
+func TestQueueRejectsInvalidRequests(t *testing.T) {
+	q, _, _ := testQueue(t, Config{})
+
+	bad := limboRequest(10)
+	bad.Game = "nope"
+	if _, err := q.Enqueue(bad, 0); err != scan.ErrGameNotFound {
+		t.Errorf("expected ErrGameNotFound, got %v", err)
+	}
+	bad = limboRequest(10)
+	bad.TargetOp = scan.OpTopK
+	if _, err := q.Enqueue(bad, 0); err != scan.ErrInvalidLimit {
+		t.Errorf("expected ErrInvalidLimit, got %v", err)
+	}
+}
+
+func TestStoreSealsServerSeeds(t *testing.T) {
+	_, jobStore, _ := testQueue(t, Config{})
+	req := limboRequest(100)
+	raw := func(id string) (reqJSON, seed string) {
+		t.Helper()
+		if err := jobStore.db.QueryRow(`SELECT request_json, server_seed FROM scan_jobs WHERE id = ?`, id).Scan(&reqJSON, &seed); err != nil {
+			t.Fatalf("read job: %v", err)
+		}
+		return reqJSON, seed
+	}
+
+	// Queued before seeds were stored apart from the request
+	reqJSON, _ := json.Marshal(req)
+	if _, err := jobStore.db.Exec(`INSERT INTO scan_jobs (id, status, request_json, next_nonce, created_at)
+		VALUES ('legacy', 'queued', ?, 1, ?)`, string(reqJSON), time.Now()); err != nil {
+		t.Fatalf("insert legacy job: %v", err)
+	}
+
+	key, _ := atrest.NewKey()
+	cipher, err := atrest.NewCipher(key)
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+	jobStore.SetCipher(cipher)
+	job := &Job{Request: req}
+	if err := jobStore.Create(job); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if n, err := jobStore.ResealSeeds(); err != nil || n != 1 {
+		t.Fatalf("ResealSeeds = %d, %v", n, err)
+	}
+
+	for _, id := range []string{"legacy", job.ID} {
+		reqJSON, seed := raw(id)
+		if strings.Contains(reqJSON, req.Seeds.Server) || !atrest.IsSealed(seed) {
+			t.Errorf("%s: expected only a sealed seed stored, got %s and %q", id, reqJSON, seed)
+		}
+		got, err := jobStore.Get(id)
+		if err != nil || got.Request.Seeds.Server != req.Seeds.Server || got.ServerSeedHash != hashSeed(req.Seeds.Server) {
+			t.Fatalf("%s: expected the seed opened, got %+v, %v", id, got, err)
+		}
+		out, _ := json.Marshal(got)
+		if strings.Contains(string(out), req.Seeds.Server) {
+			t.Errorf("%s: job JSON holds the server seed: %s", id, out)
+		}
+	}
+
+	// Without the key the jobs still list, but none is picked to run
+	jobStore.SetCipher(nil)
+	list, err := jobStore.List("")
+	if err != nil || len(list) != 2 || !list[0].SeedSealed {
+		t.Fatalf("expected both jobs listed as sealed, got %+v, %v", list, err)
+	}
+	if next, err := jobStore.NextQueued(nil); err != nil || next != nil {
+		t.Errorf("expected no runnable job, got %+v, %v", next, err)
+	}
+	if n, err := jobStore.SealedSeeds(); err != nil || n != 2 {
+		t.Errorf("SealedSeeds = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,507 @@
+// Package jobs provides a persistent queue for scan jobs.
+package jobs
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/atrest"
+	"github.com/MJE43/stake-pf-replay-go/internal/scan"
+)
+
+var (
+	// ErrNotFound is returned for unknown job IDs.
+	ErrNotFound = errors.New("job not found")
+	// ErrInvalidState is returned when a job can't make the requested
+	// transition, such as resuming a job that isn't paused.
+	ErrInvalidState = errors.New("invalid job state")
+)
+
+// Status is the lifecycle state of a job.
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusPaused    Status = "paused"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Finished reports whether the job will not run again.
+func (s Status) Finished() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusCancelled
+}
+
+// Job is a queued scan. NextNonce and the counters are checkpointed after
+// every chunk, so an interrupted job resumes where it left off.
+//
+// The server seed is stored sealed, apart from the rest of the request, and
+// left out of the job's JSON; ServerSeedHash identifies it instead.
+type Job struct {
+	ID             string           `json:"id"`
+	Status         Status           `json:"status"`
+	Priority       int              `json:"priority"`
+	Request        scan.ScanRequest `json:"request"`
+	ServerSeedHash string           `json:"serverSeedHash"`
+	SeedSealed     bool             `json:"seedSealed,omitempty"` // sealed under a key that isn't loaded; the job can't run
+	RunID          string           `json:"runId,omitempty"`
+	NextNonce      uint64           `json:"nextNonce"`
+	Evaluated      uint64           `json:"evaluated"`
+	HitsFound      int              `json:"hitsFound"`
+	Progress       float64          `json:"progress"` // fraction of the range scanned
+	MetricMin      *float64         `json:"metricMin,omitempty"`
+	MetricMax      *float64         `json:"metricMax,omitempty"`
+	MetricSum      float64          `json:"metricSum"`
+	Ranked         []scan.Hit       `json:"-"` // best hits so far for top/bottom jobs
+	Error          string           `json:"error,omitempty"`
+	CreatedAt      time.Time        `json:"createdAt"`
+	StartedAt      *time.Time       `json:"startedAt,omitempty"`
+	FinishedAt     *time.Time       `json:"finishedAt,omitempty"`
+}
+
+// MarshalJSON encodes the job without its server seed.
+func (j Job) MarshalJSON() ([]byte, error) {
+	type plain Job
+	out := plain(j)
+	out.Request.Seeds.Server = ""
+	return json.Marshal(out)
+}
+
+// updateProgress sets Progress from NextNonce.
+func (j *Job) updateProgress() {
+	total := j.Request.NonceEnd - j.Request.NonceStart + 1
+	if j.Status == StatusCompleted || total == 0 {
+		j.Progress = 1
+		return
+	}
+	j.Progress = float64(j.NextNonce-j.Request.NonceStart) / float64(total)
+}
+
+// Store persists jobs in SQLite.
+type Store struct {
+	db     *sql.DB
+	cipher *atrest.Cipher // seals server_seed; nil stores it as given
+}
+
+// SetCipher makes the store seal server seeds with c. Jobs written before
+// stay readable; ResealSeeds encrypts them.
+func (s *Store) SetCipher(c *atrest.Cipher) {
+	s.cipher = c
+}
+
+// NewStore opens the job store at the given SQLite path.
+func NewStore(dbPath string) (*Store, error) {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("jobs: open db: %w", err)
+	}
+	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+		return nil, fmt.Errorf("jobs: enable WAL: %w", err)
+	}
+	if _, err := db.Exec("PRAGMA busy_timeout=5000"); err != nil {
+		return nil, fmt.Errorf("jobs: set busy timeout: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Migrate creates the scan_jobs table.
+func (s *Store) Migrate() error {
+	migrations := []string{
+		`CREATE TABLE IF NOT EXISTS scan_jobs (
+			id TEXT PRIMARY KEY,
+			status TEXT NOT NULL,
+			priority INTEGER NOT NULL DEFAULT 0,
+			request_json TEXT NOT NULL,
+			run_id TEXT,
+			next_nonce INTEGER NOT NULL,
+			evaluated INTEGER NOT NULL DEFAULT 0,
+			hits_found INTEGER NOT NULL DEFAULT 0,
+			metric_min REAL,
+			metric_max REAL,
+			ranked_json TEXT,
+			error TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			started_at DATETIME,
+			finished_at DATETIME
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_scan_jobs_pick ON scan_jobs(status, priority DESC, created_at)`,
+	}
+	for _, m := range migrations {
+		if _, err := s.db.Exec(m); err != nil {
+			return fmt.Errorf("jobs: migrate: %w", err)
+		}
+	}
+	// Columns added since the table was first created
+	columns := []string{
+		`ALTER TABLE scan_jobs ADD COLUMN metric_sum REAL NOT NULL DEFAULT 0`,
+		`ALTER TABLE scan_jobs ADD COLUMN server_seed TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE scan_jobs ADD COLUMN server_seed_hash TEXT NOT NULL DEFAULT ''`,
+	}
+	for _, m := range columns {
+		if _, err := s.db.Exec(m); err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			return fmt.Errorf("jobs: migrate: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Create inserts a new queued job and fills in its ID and timestamps.
+func (s *Store) Create(job *Job) error {
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	if job.Status == "" {
+		job.Status = StatusQueued
+	}
+	job.NextNonce = job.Request.NonceStart
+	job.CreatedAt = time.Now().UTC()
+	job.ServerSeedHash = hashSeed(job.Request.Seeds.Server)
+
+	reqJSON, err := encodeRequest(job.Request)
+	if err != nil {
+		return err
+	}
+	sealed, err := s.cipher.Seal(job.Request.Seeds.Server)
+	if err != nil {
+		return fmt.Errorf("jobs: seal server seed: %w", err)
+	}
+	_, err = s.db.Exec(`INSERT INTO scan_jobs (id, status, priority, request_json, server_seed, server_seed_hash,
+		next_nonce, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Status, job.Priority, reqJSON, sealed, job.ServerSeedHash, job.NextNonce, job.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("jobs: create: %w", err)
+	}
+	return nil
+}
+
+// Get loads a job by ID.
+func (s *Store) Get(id string) (*Job, error) {
+	row := s.db.QueryRow(`SELECT `+jobColumns+` FROM scan_jobs WHERE id = ?`, id)
+	job, err := s.scanJob(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("jobs: %s: %w", id, ErrNotFound)
+	}
+	return job, err
+}
+
+// List returns jobs in queue order: running first, then queued and paused
+// jobs by priority, then finished jobs newest first. An empty status lists
+// every job.
+func (s *Store) List(status Status) ([]Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM scan_jobs`
+	var args []any
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY CASE status
+			WHEN 'running' THEN 0 WHEN 'queued' THEN 1 WHEN 'paused' THEN 2 ELSE 3 END,
+		CASE WHEN status IN ('running', 'queued', 'paused') THEN -priority ELSE 0 END,
+		CASE WHEN status IN ('running', 'queued', 'paused') THEN created_at END,
+		finished_at DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("jobs: list: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		job, err := s.scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// NextQueued returns the highest-priority queued job not in skip, oldest
+// first among equal priorities, or nil when there is none. Jobs whose seed
+// can't be opened stay queued until the key is loaded.
+func (s *Store) NextQueued(skip map[string]bool) (*Job, error) {
+	rows, err := s.db.Query(`SELECT ` + jobColumns + ` FROM scan_jobs
+		WHERE status = 'queued' ORDER BY priority DESC, created_at, rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("jobs: next queued: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		job, err := s.scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		if !skip[job.ID] && !job.SeedSealed {
+			return job, nil
+		}
+	}
+	return nil, rows.Err()
+}
+
+// SetStatus changes a job's status if it is currently one of from. It
+// reports whether the job was updated.
+func (s *Store) SetStatus(id string, to Status, from ...Status) (bool, error) {
+	query := `UPDATE scan_jobs SET status = ?`
+	args := []any{to}
+	switch {
+	case to == StatusRunning:
+		query += `, started_at = COALESCE(started_at, ?)`
+		args = append(args, time.Now().UTC())
+	case to.Finished():
+		query += `, finished_at = ?`
+		args = append(args, time.Now().UTC())
+	}
+	query += ` WHERE id = ?`
+	args = append(args, id)
+	if len(from) > 0 {
+		query += ` AND status IN (?` + repeatPlaceholder(len(from)-1) + `)`
+		for _, f := range from {
+			args = append(args, f)
+		}
+	}
+
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		return false, fmt.Errorf("jobs: set status: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// SetPriority changes the priority of a job that has not finished.
+func (s *Store) SetPriority(id string, priority int) (bool, error) {
+	res, err := s.db.Exec(`UPDATE scan_jobs SET priority = ?
+		WHERE id = ? AND status IN ('queued', 'running', 'paused')`, priority, id)
+	if err != nil {
+		return false, fmt.Errorf("jobs: set priority: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// Checkpoint saves a job's progress.
+func (s *Store) Checkpoint(job *Job) error {
+	var rankedJSON any
+	if job.Ranked != nil {
+		b, err := json.Marshal(job.Ranked)
+		if err != nil {
+			return fmt.Errorf("jobs: encode ranked hits: %w", err)
+		}
+		rankedJSON = string(b)
+	}
+	_, err := s.db.Exec(`UPDATE scan_jobs SET run_id = ?, next_nonce = ?, evaluated = ?, hits_found = ?,
+		metric_min = ?, metric_max = ?, metric_sum = ?, ranked_json = ? WHERE id = ?`,
+		job.RunID, job.NextNonce, job.Evaluated, job.HitsFound,
+		job.MetricMin, job.MetricMax, job.MetricSum, rankedJSON, job.ID)
+	if err != nil {
+		return fmt.Errorf("jobs: checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Fail marks a job failed with an error message.
+func (s *Store) Fail(id string, cause error) error {
+	_, err := s.db.Exec(`UPDATE scan_jobs SET status = ?, error = ?, finished_at = ? WHERE id = ?`,
+		StatusFailed, cause.Error(), time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("jobs: fail: %w", err)
+	}
+	return nil
+}
+
+// SealedSeeds returns how many jobs hold a sealed server seed, which can't
+// be read without the key that sealed it.
+func (s *Store) SealedSeeds() (int, error) {
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM scan_jobs WHERE server_seed LIKE ?`, atrest.SealedPattern).Scan(&n); err != nil {
+		return 0, fmt.Errorf("jobs: count sealed seeds: %w", err)
+	}
+	return n, nil
+}
+
+// ResealSeeds seals server seeds stored in plaintext, including those of
+// jobs queued before seeds moved out of request_json, or under an older key
+// with the current cipher, and returns how many jobs it changed.
+func (s *Store) ResealSeeds() (int, error) {
+	if s.cipher == nil {
+		return 0, nil
+	}
+	rows, err := s.db.Query(`SELECT id, request_json, server_seed FROM scan_jobs`)
+	if err != nil {
+		return 0, fmt.Errorf("jobs: query server seeds: %w", err)
+	}
+	type stale struct {
+		id, reqJSON, seed string
+		req               scan.ScanRequest
+	}
+	var found []stale
+	for rows.Next() {
+		var j stale
+		if err := rows.Scan(&j.id, &j.reqJSON, &j.seed); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("jobs: scan server seed: %w", err)
+		}
+		if err := json.Unmarshal([]byte(j.reqJSON), &j.req); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("jobs: decode request for %s: %w", j.id, err)
+		}
+		if j.req.Seeds.Server != "" || !s.cipher.Current(j.seed) {
+			found = append(found, j)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, fmt.Errorf("jobs: iterate server seeds: %w", err)
+	}
+	if len(found) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	for _, j := range found {
+		plain := j.req.Seeds.Server
+		if plain == "" {
+			if plain, err = s.cipher.Open(j.seed); err != nil {
+				return 0, fmt.Errorf("jobs: job %s: %w", j.id, err)
+			}
+		}
+		sealed, err := s.cipher.Seal(plain)
+		if err != nil {
+			return 0, fmt.Errorf("jobs: job %s: %w", j.id, err)
+		}
+		reqJSON, err := encodeRequest(j.req)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(`UPDATE scan_jobs SET request_json = ?, server_seed = ?, server_seed_hash = ? WHERE id = ?`,
+			reqJSON, sealed, hashSeed(plain), j.id); err != nil {
+			return 0, fmt.Errorf("jobs: update server seed: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(found), nil
+}
+
+// RequeueInterrupted puts jobs left running by a previous process back in
+// the queue and returns how many there were.
+func (s *Store) RequeueInterrupted() (int, error) {
+	res, err := s.db.Exec(`UPDATE scan_jobs SET status = 'queued' WHERE status = 'running'`)
+	if err != nil {
+		return 0, fmt.Errorf("jobs: requeue interrupted: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+const jobColumns = `id, status, priority, request_json, server_seed, server_seed_hash, run_id, next_nonce, evaluated, hits_found,
+	metric_min, metric_max, metric_sum, ranked_json, error, created_at, started_at, finished_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func (s *Store) scanJob(row rowScanner) (*Job, error) {
+	var job Job
+	var reqJSON, sealed string
+	var runID, rankedJSON sql.NullString
+	var metricMin, metricMax sql.NullFloat64
+	var startedAt, finishedAt sql.NullTime
+
+	err := row.Scan(&job.ID, &job.Status, &job.Priority, &reqJSON, &sealed, &job.ServerSeedHash, &runID, &job.NextNonce,
+		&job.Evaluated, &job.HitsFound, &metricMin, &metricMax, &job.MetricSum, &rankedJSON, &job.Error,
+		&job.CreatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(reqJSON), &job.Request); err != nil {
+		return nil, fmt.Errorf("jobs: decode request for %s: %w", job.ID, err)
+	}
+	// Jobs queued before seeds were stored apart keep theirs in the request
+	if sealed != "" {
+		plain, err := s.cipher.Open(sealed)
+		switch {
+		case errors.Is(err, atrest.ErrUnknownKey):
+			job.SeedSealed = true
+		case err != nil:
+			return nil, fmt.Errorf("jobs: open server seed of %s: %w", job.ID, err)
+		default:
+			job.Request.Seeds.Server = plain
+		}
+	}
+	if job.ServerSeedHash == "" {
+		job.ServerSeedHash = hashSeed(job.Request.Seeds.Server)
+	}
+	if rankedJSON.Valid {
+		if err := json.Unmarshal([]byte(rankedJSON.String), &job.Ranked); err != nil {
+			return nil, fmt.Errorf("jobs: decode ranked hits for %s: %w", job.ID, err)
+		}
+	}
+	job.RunID = runID.String
+	if metricMin.Valid {
+		job.MetricMin = &metricMin.Float64
+	}
+	if metricMax.Valid {
+		job.MetricMax = &metricMax.Float64
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	job.updateProgress()
+	return &job, nil
+}
+
+// encodeRequest encodes a job's request for request_json, without its
+// server seed.
+func encodeRequest(req scan.ScanRequest) (string, error) {
+	req.Seeds.Server = ""
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("jobs: encode request: %w", err)
+	}
+	return string(b), nil
+}
+
+func hashSeed(seed string) string {
+	if seed == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+func repeatPlaceholder(n int) string {
+	out := ""
+	for i := 0; i < n; i++ {
+		out += ", ?"
+	}
+	return out
+}
@@ -0,0 +1,219 @@
+// Package repro records what a run's outcomes depend on, so a stored run can
+// be re-executed later and checked against the hits it saved.
+package repro
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/engine"
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+	"github.com/MJE43/stake-pf-replay-go/internal/scan"
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+	"github.com/MJE43/stake-pf-replay-go/internal/version"
+)
+
+// Target is the match condition of a run. It is kept in full because runs
+// only store the first target value.
+type Target struct {
+	Op        scan.TargetOp `json:"op"`
+	Val       float64       `json:"val"`
+	Val2      float64       `json:"val2,omitempty"`
+	Tolerance float64       `json:"tolerance,omitempty"`
+	Limit     int           `json:"limit,omitempty"`
+}
+
+// Manifest is everything besides the seeds and nonce range that a run's
+// outcomes depend on.
+type Manifest struct {
+	Version        string          `json:"version"`
+	Commit         string          `json:"commit"`
+	EngineVersion  string          `json:"engine_version"`
+	RNG            string          `json:"rng"`
+	Game           string          `json:"game"`
+	TableHash      string          `json:"table_hash,omitempty"`
+	CustomGameHash string          `json:"custom_game_hash,omitempty"`
+	Params         json.RawMessage `json:"params"` // canonical JSON, keys sorted
+	Target         Target          `json:"target"`
+	// Observed marks a run whose hits are the nonces that were played,
+	// such as a live stream's, rather than what a scan of its range found.
+	// Re-running it replays just those nonces.
+	Observed bool `json:"observed,omitempty"`
+}
+
+// New builds the manifest for a scan run with the current build.
+func New(req scan.ScanRequest) (*Manifest, error) {
+	params := req.Params
+	if params == nil {
+		params = map[string]any{}
+	}
+	canonical, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("canonicalise params: %w", err)
+	}
+
+	build := version.Get()
+	m := &Manifest{
+		Version:       build.Version,
+		Commit:        build.Commit,
+		EngineVersion: scan.EngineVersion,
+		RNG:           engine.RNGScheme,
+		Game:          req.Game,
+		Params:        canonical,
+		Target: Target{
+			Op:        req.TargetOp,
+			Val:       req.TargetVal,
+			Val2:      req.TargetVal2,
+			Tolerance: req.Tolerance,
+			Limit:     req.Limit,
+		},
+	}
+	if build.Modified {
+		m.Commit += "+dirty"
+	}
+	m.TableHash, _ = games.TableHash(req.Game)
+	m.CustomGameHash, _ = games.CustomGameHash(req.Game)
+	return m, nil
+}
+
+// String returns the manifest as JSON, for store.Run.Manifest.
+func (m *Manifest) String() string {
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// Parse decodes a stored manifest.
+func Parse(s string) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// Check compares the manifest with the running build and returns a warning
+// for everything that could make a re-run score differently. The build
+// version isn't compared, since a release that leaves the engine version
+// and tables alone scores the same.
+func (m *Manifest) Check() []string {
+	var warnings []string
+	if m.EngineVersion != scan.EngineVersion {
+		warnings = append(warnings, fmt.Sprintf("run was scored by engine %s, this build runs %s", m.EngineVersion, scan.EngineVersion))
+	}
+	if m.RNG != engine.RNGScheme {
+		warnings = append(warnings, fmt.Sprintf("run used RNG scheme %q, this build uses %q", m.RNG, engine.RNGScheme))
+	}
+
+	if tableHash, _ := games.TableHash(m.Game); tableHash != m.TableHash {
+		warnings = append(warnings, fmt.Sprintf("%s payout tables have changed since this run (was %s, now %s)",
+			m.Game, short(m.TableHash), short(tableHash)))
+	}
+
+	customHash, loaded := games.CustomGameHash(m.Game)
+	switch {
+	case m.CustomGameHash != "" && !loaded:
+		warnings = append(warnings, fmt.Sprintf("custom game %q (definition %s) is not loaded", m.Game, short(m.CustomGameHash)))
+	case customHash != m.CustomGameHash:
+		warnings = append(warnings, fmt.Sprintf("custom game %q definition has changed since this run (was %s, now %s)",
+			m.Game, short(m.CustomGameHash), short(customHash)))
+	}
+	return warnings
+}
+
+func short(hash string) string {
+	if hash == "" {
+		return "none"
+	}
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// Request rebuilds the scan that produced run. The target comes from the
+// run's manifest when it has one, since runs don't store a second target
+// value.
+func Request(run *store.Run) (scan.ScanRequest, error) {
+	if run.SeedSealed {
+		return scan.ScanRequest{}, fmt.Errorf("run %s has a server seed encrypted under a key that isn't loaded", run.ID)
+	}
+	if run.ServerSeed == "" {
+		return scan.ScanRequest{}, fmt.Errorf("run %s has no server seed to re-run with", run.ID)
+	}
+
+	req := scan.ScanRequest{
+		Game:       run.Game,
+		Seeds:      games.Seeds{Server: run.ServerSeed, Client: run.ClientSeed},
+		NonceStart: run.NonceStart,
+		NonceEnd:   run.NonceEnd,
+		TargetOp:   scan.TargetOp(run.TargetOp),
+		TargetVal:  run.TargetVal,
+		Tolerance:  run.Tolerance,
+		Limit:      run.HitLimit,
+	}
+	paramsJSON := run.ParamsJSON
+	if run.Manifest != "" {
+		m, err := Parse(run.Manifest)
+		if err != nil {
+			return scan.ScanRequest{}, err
+		}
+		req.TargetOp = m.Target.Op
+		req.TargetVal = m.Target.Val
+		req.TargetVal2 = m.Target.Val2
+		req.Tolerance = m.Target.Tolerance
+		req.Limit = m.Target.Limit
+		paramsJSON = string(m.Params)
+	}
+	if paramsJSON != "" {
+		if err := json.Unmarshal([]byte(paramsJSON), &req.Params); err != nil {
+			return scan.ScanRequest{}, fmt.Errorf("decode params of run %s: %w", run.ID, err)
+		}
+	}
+	return req, nil
+}
+
+// MetricChange is a nonce that hit both times with different metrics
+type MetricChange struct {
+	Nonce  uint64  `json:"nonce"`
+	Stored float64 `json:"stored"`
+	Fresh  float64 `json:"fresh"`
+}
+
+// HitDiff compares the hits a run stored with the hits of a re-run
+type HitDiff struct {
+	Missing []scan.Hit     `json:"missing"` // stored, but not found again
+	Extra   []scan.Hit     `json:"extra"`   // found again, but not stored
+	Changed []MetricChange `json:"changed"`
+}
+
+// Match reports whether both hit lists were the same.
+func (d HitDiff) Match() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Changed) == 0
+}
+
+// CompareHits diffs stored hits against fresh ones by nonce. Order is
+// ignored, so ranked runs compare as sets as well.
+func CompareHits(stored, fresh []scan.Hit) HitDiff {
+	diff := HitDiff{Missing: []scan.Hit{}, Extra: []scan.Hit{}, Changed: []MetricChange{}}
+	freshByNonce := make(map[uint64]float64, len(fresh))
+	for _, h := range fresh {
+		freshByNonce[h.Nonce] = h.Metric
+	}
+	seen := make(map[uint64]bool, len(stored))
+	for _, h := range stored {
+		seen[h.Nonce] = true
+		metric, ok := freshByNonce[h.Nonce]
+		switch {
+		case !ok:
+			diff.Missing = append(diff.Missing, h)
+		case metric != h.Metric:
+			diff.Changed = append(diff.Changed, MetricChange{Nonce: h.Nonce, Stored: h.Metric, Fresh: metric})
+		}
+	}
+	for _, h := range fresh {
+		if !seen[h.Nonce] {
+			diff.Extra = append(diff.Extra, h)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,297 @@
+package repro
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+	"github.com/MJE43/stake-pf-replay-go/internal/scan"
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+)
+
+func testDB(t *testing.T) *store.SQLiteDB {
+	t.Helper()
+	db, err := store.NewSQLiteDB(":memory:")
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return db
+}
+
+// saveScan runs req and stores it the way the desktop app does.
+func saveScan(t *testing.T, db store.DB, req scan.ScanRequest) (*store.Run, []scan.Hit) {
+	t.Helper()
+	res, err := scan.NewScanner().ScanBatch(context.Background(), scan.BatchScanRequest{
+		Game:       req.Game,
+		Ranges:     []scan.SeedRange{{Seeds: req.Seeds, NonceStart: req.NonceStart, NonceEnd: req.NonceEnd}},
+		Params:     req.Params,
+		TargetOp:   req.TargetOp,
+		TargetVal:  req.TargetVal,
+		TargetVal2: req.TargetVal2,
+		Limit:      req.Limit,
+	})
+	if err != nil {
+		t.Fatalf("ScanBatch: %v", err)
+	}
+	hits := res.Results[0].Hits
+
+	manifest, err := New(req)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	run := &store.Run{
+		Game:          req.Game,
+		ServerSeed:    req.Seeds.Server,
+		ClientSeed:    req.Seeds.Client,
+		NonceStart:    req.NonceStart,
+		NonceEnd:      req.NonceEnd,
+		ParamsJSON:    string(manifest.Params),
+		TargetOp:      string(req.TargetOp),
+		TargetVal:     req.TargetVal,
+		HitLimit:      req.Limit,
+		HitCount:      len(hits),
+		EngineVersion: scan.EngineVersion,
+		Manifest:      manifest.String(),
+	}
+	if err := db.SaveRun(run); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	dbHits := make([]store.Hit, len(hits))
+	for i, h := range hits {
+		dbHits[i] = store.Hit{RunID: run.ID, Nonce: h.Nonce, Metric: h.Metric}
+	}
+	if err := db.SaveHits(run.ID, dbHits); err != nil {
+		t.Fatalf("SaveHits: %v", err)
+	}
+	return run, hits
+}
+
+func kenoRequest() scan.ScanRequest {
+	return scan.ScanRequest{
+		Game:       "keno",
+		Seeds:      games.Seeds{Server: "repro_server", Client: "repro_client"},
+		NonceStart: 1,
+		NonceEnd:   20000,
+		Params:     map[string]any{"risk": "high", "picks": []any{1, 5, 9, 13, 22}},
+		TargetOp:   scan.OpBetween,
+		TargetVal:  3,
+		TargetVal2: 50,
+	}
+}
+
+func TestManifestRecordsBuild(t *testing.T) {
+	m, err := New(kenoRequest())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if m.EngineVersion != scan.EngineVersion || m.RNG == "" || m.Version == "" || m.Commit == "" {
+		t.Errorf("manifest is missing build details: %+v", m)
+	}
+	if want, _ := games.TableHash("keno"); m.TableHash != want || want == "" {
+		t.Errorf("expected keno table hash %q, got %q", want, m.TableHash)
+	}
+	if string(m.Params) != `{"picks":[1,5,9,13,22],"risk":"high"}` {
+		t.Errorf("params not canonical: %s", m.Params)
+	}
+	if warnings := m.Check(); len(warnings) != 0 {
+		t.Errorf("fresh manifest should have no warnings, got %v", warnings)
+	}
+
+	parsed, err := Parse(m.String())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if parsed.Target != m.Target || parsed.TableHash != m.TableHash {
+		t.Errorf("manifest did not round trip: %+v", parsed)
+	}
+}
+
+func TestManifestWarnsOnChangedTables(t *testing.T) {
+	m, err := New(kenoRequest())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	original := games.KenoPayouts["high"][5][5]
+	games.KenoPayouts["high"][5][5] = original + 1
+	defer func() { games.KenoPayouts["high"][5][5] = original }()
+
+	warnings := m.Check()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "keno payout tables have changed") {
+		t.Fatalf("expected a table change warning, got %v", warnings)
+	}
+
+	m.EngineVersion = "go-0.9.0"
+	if warnings := m.Check(); len(warnings) != 2 {
+		t.Errorf("expected engine and table warnings, got %v", warnings)
+	}
+}
+
+func TestRerunMatches(t *testing.T) {
+	db := testDB(t)
+	req := kenoRequest()
+	run, hits := saveScan(t, db, req)
+	if len(hits) == 0 {
+		t.Fatal("test scan found no hits")
+	}
+
+	cmp, err := Rerun(context.Background(), db, nil, run.ID)
+	if err != nil {
+		t.Fatalf("Rerun: %v", err)
+	}
+	if !cmp.Match || cmp.StoredHits != len(hits) || cmp.FreshHits != len(hits) {
+		t.Errorf("expected a matching re-run of %d hits, got %+v", len(hits), cmp)
+	}
+	if len(cmp.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", cmp.Warnings)
+	}
+
+	// The second target value only lives in the manifest
+	rebuilt, err := Request(run)
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if rebuilt.TargetVal2 != req.TargetVal2 || rebuilt.Params["risk"] != "high" {
+		t.Errorf("request not rebuilt from manifest: %+v", rebuilt)
+	}
+}
+
+func TestRerunReportsDifferences(t *testing.T) {
+	db := testDB(t)
+	req := kenoRequest()
+	req.TargetOp = scan.OpTopK
+	req.Limit = 10
+	run, hits := saveScan(t, db, req)
+
+	// Replace the stored hits with a tampered copy
+	tampered := []store.Hit{
+		{RunID: run.ID, Nonce: hits[0].Nonce, Metric: hits[0].Metric + 1},
+		{RunID: run.ID, Nonce: 999999, Metric: 1},
+	}
+	for _, h := range hits[2:] {
+		tampered = append(tampered, store.Hit{RunID: run.ID, Nonce: h.Nonce, Metric: h.Metric})
+	}
+	if err := db.DeleteHitsFrom(run.ID, 0); err != nil {
+		t.Fatalf("DeleteHitsFrom: %v", err)
+	}
+	if err := db.SaveHits(run.ID, tampered); err != nil {
+		t.Fatalf("SaveHits: %v", err)
+	}
+
+	cmp, err := Rerun(context.Background(), db, nil, run.ID)
+	if err != nil {
+		t.Fatalf("Rerun: %v", err)
+	}
+	if cmp.Match {
+		t.Fatal("expected the re-run to differ")
+	}
+	d := cmp.Diff
+	if len(d.Changed) != 1 || d.Changed[0].Nonce != hits[0].Nonce || d.Changed[0].Fresh != hits[0].Metric {
+		t.Errorf("unexpected changed hits: %+v", d.Changed)
+	}
+	if len(d.Missing) != 1 || d.Missing[0].Nonce != 999999 {
+		t.Errorf("unexpected missing hits: %+v", d.Missing)
+	}
+	if len(d.Extra) != 1 || d.Extra[0].Nonce != hits[1].Nonce {
+		t.Errorf("unexpected extra hits: %+v", d.Extra)
+	}
+}
+
+func TestRerunWithoutManifest(t *testing.T) {
+	db := testDB(t)
+	run := &store.Run{
+		Game: "limbo", ServerSeed: "legacy_server", ClientSeed: "legacy_client",
+		NonceStart: 1, NonceEnd: 500, TargetOp: "ge", TargetVal: 1000, EngineVersion: "v1.0.0",
+	}
+	if err := db.SaveRun(run); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+
+	cmp, err := Rerun(context.Background(), db, nil, run.ID)
+	if err != nil {
+		t.Fatalf("Rerun: %v", err)
+	}
+	if len(cmp.Warnings) != 1 || !strings.Contains(cmp.Warnings[0], "no manifest") {
+		t.Errorf("expected a missing manifest warning, got %v", cmp.Warnings)
+	}
+
+	parent := &store.Run{Game: "limbo", TargetOp: "ge", TargetVal: 2, EngineVersion: "v1.0.0"}
+	if err := db.SaveRun(parent); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	if _, err := Rerun(context.Background(), db, nil, parent.ID); err == nil {
+		t.Error("expected an error re-running a run without seeds")
+	}
+}
+
+func TestRerunObservedRun(t *testing.T) {
+	db := testDB(t)
+	req := scan.ScanRequest{
+		Game:       "limbo",
+		Seeds:      games.Seeds{Server: "observed_server", Client: "observed_client"},
+		NonceStart: 1,
+		NonceEnd:   5000,
+		Params:     map[string]any{},
+		TargetOp:   scan.OpGreaterEqual,
+	}
+	manifest, err := New(req)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	manifest.Observed = true
+
+	// Only three nonces of the range were played
+	g, _ := games.GetGame("limbo")
+	var played []store.Hit
+	for _, nonce := range []uint64{10, 500, 4000} {
+		out, err := g.Evaluate(req.Seeds, nonce, req.Params)
+		if err != nil {
+			t.Fatalf("Evaluate: %v", err)
+		}
+		played = append(played, store.Hit{Nonce: nonce, Metric: out.Metric})
+	}
+	run := &store.Run{
+		Game: req.Game, ServerSeed: req.Seeds.Server, ClientSeed: req.Seeds.Client,
+		NonceStart: req.NonceStart, NonceEnd: req.NonceEnd, ParamsJSON: string(manifest.Params),
+		TargetOp: string(req.TargetOp), HitCount: len(played),
+		EngineVersion: scan.EngineVersion, Manifest: manifest.String(),
+	}
+	if err := db.SaveRun(run); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	for i := range played {
+		played[i].RunID = run.ID
+	}
+	if err := db.SaveHits(run.ID, played); err != nil {
+		t.Fatalf("SaveHits: %v", err)
+	}
+
+	cmp, err := Rerun(context.Background(), db, nil, run.ID)
+	if err != nil {
+		t.Fatalf("Rerun: %v", err)
+	}
+	if !cmp.Match || cmp.FreshHits != len(played) {
+		t.Errorf("expected only the played nonces replayed, got %+v", cmp)
+	}
+
+	played[1].Metric++
+	if err := db.DeleteHitsFrom(run.ID, 0); err != nil {
+		t.Fatalf("DeleteHitsFrom: %v", err)
+	}
+	if err := db.SaveHits(run.ID, played); err != nil {
+		t.Fatalf("SaveHits: %v", err)
+	}
+	cmp, err = Rerun(context.Background(), db, nil, run.ID)
+	if err != nil {
+		t.Fatalf("Rerun: %v", err)
+	}
+	d := cmp.Diff
+	if cmp.Match || len(d.Changed) != 1 || d.Changed[0].Nonce != 500 || len(d.Extra) != 0 || len(d.Missing) != 0 {
+		t.Errorf("expected only nonce 500 changed, got %+v", d)
+	}
+}
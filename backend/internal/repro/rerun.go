@@ -0,0 +1,141 @@
+package repro
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+	"github.com/MJE43/stake-pf-replay-go/internal/scan"
+	"github.com/MJE43/stake-pf-replay-go/internal/store"
+)
+
+// Comparison is the result of re-running a stored run
+type Comparison struct {
+	RunID      string   `json:"run_id"`
+	StoredHits int      `json:"stored_hits"`
+	FreshHits  int      `json:"fresh_hits"`
+	Match      bool     `json:"match"`
+	Diff       HitDiff  `json:"diff"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+// Rerun scans a stored run's range again with the current build and diffs
+// the hits against the saved ones; an observed run replays only the nonces
+// it stored. Warnings explain differences that are expected, such as
+// changed payout tables or a run that timed out. A nil scanner uses
+// scan.NewScanner.
+func Rerun(ctx context.Context, db store.DB, scanner *scan.Scanner, runID string) (*Comparison, error) {
+	run, err := db.GetRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	req, err := Request(run)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	observed := false
+	if run.Manifest == "" {
+		warnings = append(warnings, "run has no manifest; it was created before manifests were recorded")
+	} else if m, err := Parse(run.Manifest); err == nil {
+		warnings = append(warnings, m.Check()...)
+		observed = m.Observed
+	}
+	if run.TimedOut {
+		warnings = append(warnings, "the original run timed out before finishing its range")
+	}
+	if !req.TargetOp.IsRanked() && req.Limit > 0 && run.HitCount >= req.Limit {
+		warnings = append(warnings, fmt.Sprintf("the original run stopped at its limit of %d hits; the re-run keeps the earliest %d", req.Limit, req.Limit))
+	}
+
+	stored, err := allHits(db, run.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var fresh []scan.Hit
+	if observed {
+		fresh, err = replayNonces(ctx, req, stored)
+	} else {
+		fresh, err = rescan(ctx, scanner, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	diff := CompareHits(stored, fresh)
+	return &Comparison{
+		RunID:      run.ID,
+		StoredHits: len(stored),
+		FreshHits:  len(fresh),
+		Match:      diff.Match(),
+		Diff:       diff,
+		Warnings:   warnings,
+	}, nil
+}
+
+// rescan scans the range of req again
+func rescan(ctx context.Context, scanner *scan.Scanner, req scan.ScanRequest) ([]scan.Hit, error) {
+	if scanner == nil {
+		scanner = scan.NewScanner()
+	}
+	// ScanBatch keeps every hit and returns threshold hits in nonce order
+	res, err := scanner.ScanBatch(ctx, scan.BatchScanRequest{
+		Game:       req.Game,
+		Ranges:     []scan.SeedRange{{Seeds: req.Seeds, NonceStart: req.NonceStart, NonceEnd: req.NonceEnd}},
+		Params:     req.Params,
+		TargetOp:   req.TargetOp,
+		TargetVal:  req.TargetVal,
+		TargetVal2: req.TargetVal2,
+		Tolerance:  req.Tolerance,
+		Limit:      req.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.Summary.TimedOut {
+		return nil, ctx.Err()
+	}
+	return res.Results[0].Hits, nil
+}
+
+// replayNonces evaluates the nonces an observed run stored, and no others
+// of its range, which were never played.
+func replayNonces(ctx context.Context, req scan.ScanRequest, stored []scan.Hit) ([]scan.Hit, error) {
+	g, ok := games.GetGame(req.Game)
+	if !ok {
+		return nil, scan.ErrGameNotFound
+	}
+	fresh := make([]scan.Hit, 0, len(stored))
+	for i, h := range stored {
+		if i%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		out, err := g.Evaluate(req.Seeds, h.Nonce, req.Params)
+		if err != nil {
+			return nil, fmt.Errorf("nonce %d: %w", h.Nonce, err)
+		}
+		fresh = append(fresh, scan.Hit{Nonce: h.Nonce, Metric: out.Metric})
+	}
+	return fresh, nil
+}
+
+func allHits(db store.DB, runID string) ([]scan.Hit, error) {
+	const pageSize = 5000
+	var hits []scan.Hit
+	for offset := 0; ; offset += pageSize {
+		page, err := db.GetHits(runID, pageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range page {
+			hits = append(hits, scan.Hit{Nonce: h.Nonce, Metric: h.Metric})
+		}
+		if len(page) < pageSize {
+			return hits, nil
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package scan
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/engine"
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+)
+
+// SeedRange is one seed pair and the nonce range to scan for it
+type SeedRange struct {
+	Seeds      games.Seeds `json:"seeds"`
+	NonceStart uint64      `json:"nonce_start"`
+	NonceEnd   uint64      `json:"nonce_end"`
+}
+
+// BatchScanRequest applies one target to many seed pairs. Limit applies to
+// each seed pair separately.
+type BatchScanRequest struct {
+	Game       string         `json:"game"`
+	Ranges     []SeedRange    `json:"ranges"`
+	Params     map[string]any `json:"params"`
+	TargetOp   TargetOp       `json:"target_op"`
+	TargetVal  float64        `json:"target_val"`
+	TargetVal2 float64        `json:"target_val2,omitempty"`
+	Tolerance  float64        `json:"tolerance"`
+	Limit      int            `json:"limit,omitempty"`
+	TimeoutMs  int            `json:"timeout_ms,omitempty"`
+}
+
+// BatchScanResult holds one ScanResult per seed pair, in request order, and
+// a summary over the hits of all of them.
+type BatchScanResult struct {
+	Results       []ScanResult `json:"results"`
+	Summary       Summary      `json:"summary"`
+	EngineVersion string       `json:"engine_version"`
+}
+
+// batchJob is a nonce range for one of the batch's seed pairs
+type batchJob struct {
+	ScanJob
+	target int
+}
+
+// batchWorker processes jobs for any seed pair in the batch. Hits are kept
+// per worker and merged after all workers finish, so none are dropped.
+type batchWorker struct {
+	jobs      <-chan batchJob
+	game      games.Game
+	ranges    []SeedRange
+	params    map[string]any
+	evaluator *TargetEvaluator
+	op        TargetOp
+	limit     int
+	evaluated []uint64 // atomic counters, one per seed pair
+	budget    *WorkerBudget
+	hits      map[int][]Hit
+	ranked    map[int]*rankedHits
+}
+
+// ScanBatch scans every seed pair in req on a single shared worker pool.
+// Threshold hits are returned in nonce order, so Limit keeps the earliest
+// matches of each seed pair.
+func (s *Scanner) ScanBatch(ctx context.Context, req BatchScanRequest) (*BatchScanResult, error) {
+	game, exists := games.GetGame(req.Game)
+	if !exists {
+		return nil, ErrGameNotFound
+	}
+	if req.TargetOp.IsRanked() && req.Limit <= 0 {
+		return nil, ErrInvalidLimit
+	}
+	for _, r := range req.Ranges {
+		if r.NonceEnd < r.NonceStart {
+			return nil, ErrInvalidNonce
+		}
+	}
+
+	if req.TimeoutMs > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.TimeoutMs)*time.Millisecond)
+		defer cancel()
+	}
+
+	tolerance := req.Tolerance
+	if tolerance == 0 && req.Game != "roulette" {
+		tolerance = 1e-9
+	}
+	evaluator := NewTargetEvaluator(req.TargetOp, req.TargetVal, req.TargetVal2, tolerance)
+
+	jobs := make(chan batchJob, s.workerCount*2)
+	evaluated := make([]uint64, len(req.Ranges))
+	workers := make([]*batchWorker, s.workerCount)
+	var wg sync.WaitGroup
+
+	for i := range workers {
+		workers[i] = &batchWorker{
+			jobs:      jobs,
+			game:      game,
+			ranges:    req.Ranges,
+			params:    req.Params,
+			evaluator: evaluator,
+			op:        req.TargetOp,
+			limit:     req.Limit,
+			evaluated: evaluated,
+			budget:    s.budget,
+			hits:      make(map[int][]Hit),
+			ranked:    make(map[int]*rankedHits),
+		}
+		wg.Add(1)
+		go workers[i].run(ctx, &wg)
+	}
+
+	go generateBatchJobs(ctx, jobs, req.Ranges)
+	wg.Wait()
+
+	timedOut := ctx.Err() != nil
+	collector := &ResultCollector{}
+	result := &BatchScanResult{
+		Results:       make([]ScanResult, len(req.Ranges)),
+		EngineVersion: EngineVersion,
+	}
+
+	var allMetrics []float64
+	var totalEvaluated uint64
+	for t, r := range req.Ranges {
+		hits := mergeBatchHits(workers, t, req.TargetOp, req.Limit)
+		metrics := make([]float64, len(hits))
+		for i, hit := range hits {
+			metrics[i] = hit.Metric
+		}
+		allMetrics = append(allMetrics, metrics...)
+
+		count := atomic.LoadUint64(&evaluated[t])
+		totalEvaluated += count
+		result.Results[t] = ScanResult{
+			Hits:          hits,
+			Summary:       collector.calculateSummary(metrics, count, timedOut),
+			EngineVersion: result.EngineVersion,
+			Echo: ScanRequest{
+				Game:       req.Game,
+				Seeds:      r.Seeds,
+				NonceStart: r.NonceStart,
+				NonceEnd:   r.NonceEnd,
+				Params:     req.Params,
+				TargetOp:   req.TargetOp,
+				TargetVal:  req.TargetVal,
+				TargetVal2: req.TargetVal2,
+				Tolerance:  req.Tolerance,
+				Limit:      req.Limit,
+				TimeoutMs:  req.TimeoutMs,
+			},
+		}
+	}
+	result.Summary = collector.calculateSummary(allMetrics, totalEvaluated, timedOut)
+
+	return result, nil
+}
+
+// mergeBatchHits combines the hits every worker found for one seed pair.
+func mergeBatchHits(workers []*batchWorker, target int, op TargetOp, limit int) []Hit {
+	if op.IsRanked() {
+		parts := make([]*rankedHits, 0, len(workers))
+		for _, w := range workers {
+			if part, ok := w.ranked[target]; ok {
+				parts = append(parts, part)
+			}
+		}
+		return mergeRanked(op, limit, parts)
+	}
+
+	hits := []Hit{}
+	for _, w := range workers {
+		hits = append(hits, w.hits[target]...)
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Nonce < hits[j].Nonce })
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+func (bw *batchWorker) run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	floats := make([]float64, bw.game.FloatCount(bw.params))
+	for {
+		select {
+		case job, ok := <-bw.jobs:
+			if !ok {
+				return
+			}
+			if !bw.budget.acquire(ctx) {
+				return
+			}
+			bw.processJob(ctx, job, floats)
+			bw.budget.release()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (bw *batchWorker) processJob(ctx context.Context, job batchJob, floats []float64) {
+	seeds := bw.ranges[job.target].Seeds
+	var evaluated uint64
+	defer func() { atomic.AddUint64(&bw.evaluated[job.target], evaluated) }()
+
+	ranked := bw.ranked[job.target]
+	if bw.op.IsRanked() && ranked == nil {
+		ranked = newRankedHits(bw.op, bw.limit)
+		bw.ranked[job.target] = ranked
+	}
+
+	for nonce := job.NonceStart; nonce <= job.NonceEnd; nonce++ {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		engine.FloatsInto(floats, seeds.Server, seeds.Client, nonce, 0, len(floats))
+		result, err := bw.game.EvaluateWithFloats(floats, bw.params)
+		if err != nil {
+			continue
+		}
+		evaluated++
+
+		hit := Hit{Nonce: nonce, Metric: result.Metric}
+		if ranked != nil {
+			ranked.offer(hit)
+			continue
+		}
+		if bw.evaluator.Matches(result.Metric) {
+			// Jobs arrive in nonce order, so once a worker holds limit hits
+			// for a seed pair, later ones can't make the merged cut.
+			if bw.limit > 0 && len(bw.hits[job.target]) >= bw.limit {
+				continue
+			}
+			bw.hits[job.target] = append(bw.hits[job.target], hit)
+		}
+	}
+}
+
+// generateBatchJobs splits each seed pair's range into batches, one seed
+// pair after another.
+func generateBatchJobs(ctx context.Context, jobs chan<- batchJob, ranges []SeedRange) {
+	defer close(jobs)
+
+	const batchSize = 8192
+
+	for t, r := range ranges {
+		for current := r.NonceStart; current <= r.NonceEnd; {
+			batchEnd := current + batchSize - 1
+			if batchEnd > r.NonceEnd || batchEnd < current {
+				batchEnd = r.NonceEnd
+			}
+
+			select {
+			case jobs <- batchJob{ScanJob: ScanJob{NonceStart: current, NonceEnd: batchEnd}, target: t}:
+			case <-ctx.Done():
+				return
+			}
+			if batchEnd == r.NonceEnd {
+				break
+			}
+			current = batchEnd + 1
+		}
+	}
+}
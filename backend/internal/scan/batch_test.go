@@ -0,0 +1,115 @@
+package scan
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+)
+
+func testBatchRanges() []SeedRange {
+	return []SeedRange{
+		{Seeds: games.Seeds{Server: "batch_server_a", Client: "client_a"}, NonceStart: 1, NonceEnd: 12000},
+		{Seeds: games.Seeds{Server: "batch_server_b", Client: "client_b"}, NonceStart: 500, NonceEnd: 3000},
+		{Seeds: games.Seeds{Server: "batch_server_c", Client: "client_c"}, NonceStart: 7, NonceEnd: 7},
+	}
+}
+
+func TestScanBatchThreshold(t *testing.T) {
+	req := BatchScanRequest{
+		Game:      "limbo",
+		Ranges:    testBatchRanges(),
+		TargetOp:  OpGreaterEqual,
+		TargetVal: 20,
+		Limit:     30,
+	}
+	result, err := NewScanner().ScanBatch(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ScanBatch failed: %v", err)
+	}
+	if len(result.Results) != len(req.Ranges) {
+		t.Fatalf("Expected %d results, got %d", len(req.Ranges), len(result.Results))
+	}
+
+	game, _ := games.GetGame("limbo")
+	totalHits := 0
+	var totalEvaluated uint64
+	for i, r := range req.Ranges {
+		var want []Hit
+		for nonce := r.NonceStart; nonce <= r.NonceEnd && len(want) < req.Limit; nonce++ {
+			res, _ := game.Evaluate(r.Seeds, nonce, nil)
+			if res.Metric >= 20-1e-9 {
+				want = append(want, Hit{Nonce: nonce, Metric: res.Metric})
+			}
+		}
+
+		got := result.Results[i]
+		if got.Echo.Seeds != r.Seeds {
+			t.Errorf("Result %d: echo seeds %+v, want %+v", i, got.Echo.Seeds, r.Seeds)
+		}
+		if len(got.Hits) != len(want) {
+			t.Fatalf("Result %d: expected %d hits, got %d", i, len(want), len(got.Hits))
+		}
+		for j := range want {
+			if got.Hits[j] != want[j] {
+				t.Errorf("Result %d hit %d: expected %+v, got %+v", i, j, want[j], got.Hits[j])
+			}
+		}
+		if n := r.NonceEnd - r.NonceStart + 1; got.Summary.TotalEvaluated != n {
+			t.Errorf("Result %d: expected %d evaluations, got %d", i, n, got.Summary.TotalEvaluated)
+		}
+		totalHits += len(want)
+		totalEvaluated += got.Summary.TotalEvaluated
+	}
+
+	if result.Summary.HitsFound != totalHits {
+		t.Errorf("Expected %d combined hits, got %d", totalHits, result.Summary.HitsFound)
+	}
+	if result.Summary.TotalEvaluated != totalEvaluated {
+		t.Errorf("Expected %d combined evaluations, got %d", totalEvaluated, result.Summary.TotalEvaluated)
+	}
+}
+
+func TestScanBatchRanked(t *testing.T) {
+	req := BatchScanRequest{
+		Game:     "dice",
+		Ranges:   testBatchRanges(),
+		TargetOp: OpBottomK,
+		Limit:    10,
+	}
+	result, err := NewScanner().ScanBatch(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ScanBatch failed: %v", err)
+	}
+
+	for i, r := range req.Ranges {
+		want := bruteForceRanked(t, ScanRequest{
+			Game:       req.Game,
+			Seeds:      r.Seeds,
+			NonceStart: r.NonceStart,
+			NonceEnd:   r.NonceEnd,
+			TargetOp:   req.TargetOp,
+			Limit:      req.Limit,
+		})
+		got := result.Results[i].Hits
+		if len(got) != len(want) {
+			t.Fatalf("Result %d: expected %d hits, got %d", i, len(want), len(got))
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Errorf("Result %d rank %d: expected %+v, got %+v", i, j+1, want[j], got[j])
+			}
+		}
+	}
+}
+
+func TestScanBatchInvalidRange(t *testing.T) {
+	_, err := NewScanner().ScanBatch(context.Background(), BatchScanRequest{
+		Game:     "limbo",
+		Ranges:   []SeedRange{{Seeds: games.Seeds{Server: "s", Client: "c"}, NonceStart: 10, NonceEnd: 5}},
+		TargetOp: OpGreater,
+	})
+	if err != ErrInvalidNonce {
+		t.Fatalf("Expected ErrInvalidNonce, got %v", err)
+	}
+}
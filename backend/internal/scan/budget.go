@@ -0,0 +1,48 @@
+package scan
+
+import (
+	"context"
+	"runtime"
+)
+
+// WorkerBudget caps how many scan workers evaluate nonces at once across
+// every scanner that shares it. Workers hold a slot for one batch of nonces
+// at a time, so concurrent scans interleave instead of queueing behind each
+// other.
+type WorkerBudget struct {
+	slots chan struct{}
+}
+
+// NewWorkerBudget creates a budget of n concurrent workers. n <= 0 means
+// GOMAXPROCS.
+func NewWorkerBudget(n int) *WorkerBudget {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	return &WorkerBudget{slots: make(chan struct{}, n)}
+}
+
+// Size returns the number of workers the budget allows at once.
+func (b *WorkerBudget) Size() int {
+	return cap(b.slots)
+}
+
+// acquire blocks until a slot is free, returning false if ctx is done
+// first. A nil budget never blocks.
+func (b *WorkerBudget) acquire(ctx context.Context) bool {
+	if b == nil {
+		return ctx.Err() == nil
+	}
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (b *WorkerBudget) release() {
+	if b != nil {
+		<-b.slots
+	}
+}
@@ -0,0 +1,61 @@
+package scan
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+)
+
+func TestWorkerBudgetGatesScans(t *testing.T) {
+	budget := NewWorkerBudget(1)
+	req := ScanRequest{
+		Game:       "limbo",
+		Seeds:      games.Seeds{Server: "budget_server", Client: "budget_client"},
+		NonceStart: 1,
+		NonceEnd:   20000,
+		TargetOp:   OpGreaterEqual,
+		TargetVal:  10,
+		TimeoutMs:  50,
+	}
+
+	// With the only slot taken, the scan can't evaluate anything before it
+	// times out.
+	if !budget.acquire(context.Background()) {
+		t.Fatal("acquire failed")
+	}
+	blocked, err := NewScannerWithWorkers(4).WithBudget(budget).Scan(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if !blocked.Summary.TimedOut || blocked.Summary.TotalEvaluated != 0 {
+		t.Errorf("Expected a timed out scan with no evaluations, got %+v", blocked.Summary)
+	}
+	budget.release()
+
+	// Two scans sharing a one-worker budget both finish their full range.
+	req.TimeoutMs = 0
+	want, err := NewScanner().Scan(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	var wg sync.WaitGroup
+	results := make([]*ScanResult, 2)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = NewScannerWithWorkers(4).WithBudget(budget).Scan(context.Background(), req)
+		}(i)
+	}
+	wg.Wait()
+	for i, res := range results {
+		if res == nil || len(res.Hits) != len(want.Hits) || res.Summary.TotalEvaluated != want.Summary.TotalEvaluated {
+			t.Errorf("Scan %d: expected %d hits over %d nonces, got %+v", i, len(want.Hits), want.Summary.TotalEvaluated, res)
+		}
+	}
+	if len(budget.slots) != 0 {
+		t.Errorf("Expected every slot released, %d still held", len(budget.slots))
+	}
+}
@@ -0,0 +1,619 @@
+package scan
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/engine"
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+)
+
+// MetricCache keeps the metric of every evaluated nonce on disk, one file per
+// (server seed hash, client seed, game, params, payout tables), so
+// rescanning a range with a different target doesn't recompute any HMACs.
+// The cache only ever holds outcomes, never raw server seeds.
+//
+// Files are written by this engine version only; files from another version
+// or that fail their checksums are deleted when found. Once the directory
+// grows past the size limit, the least recently used files are evicted.
+type MetricCache struct {
+	dir      string
+	maxBytes int64
+	mu       sync.Mutex
+}
+
+// metricSegment holds the metrics of nonces Start, Start+1, ... Nonces that
+// failed to evaluate are NaN.
+type metricSegment struct {
+	Start   uint64
+	Metrics []float64
+}
+
+func (s metricSegment) end() uint64 { return s.Start + uint64(len(s.Metrics)) - 1 }
+
+const cacheFileExt = ".pfmc"
+
+// NewMetricCache opens (creating if needed) a cache in dir that holds at
+// most maxBytes of cache files.
+func NewMetricCache(dir string, maxBytes int64) (*MetricCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &MetricCache{dir: dir, maxBytes: maxBytes}, nil
+}
+
+// Size returns the total size of the cache files.
+func (c *MetricCache) Size() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files, err := c.files()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, f := range files {
+		total += f.Size()
+	}
+	return total, nil
+}
+
+// Clear deletes every cache file.
+func (c *MetricCache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := os.Remove(filepath.Join(c.dir, f.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// metricCacheKey identifies the outcomes of a seed pair, game and params.
+// Params are canonicalised by encoding/json, which sorts map keys, and custom
+// games include their definition hash so an edited script starts over.
+func metricCacheKey(game string, seeds games.Seeds, params map[string]any) (string, error) {
+	canonical, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	serverHash := sha256.Sum256([]byte(seeds.Server))
+	definition, _ := games.CustomGameHash(game)
+	// Payout table changes move a game to new files rather than reusing
+	// metrics scored with the old tables; the old files age out by LRU.
+	tables, _ := games.TableHash(game)
+	return strings.Join([]string{
+		game,
+		hex.EncodeToString(serverHash[:]),
+		seeds.Client,
+		string(canonical),
+		definition,
+		tables,
+	}, "\n"), nil
+}
+
+func (c *MetricCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:16])+cacheFileExt)
+}
+
+// open returns the cache file for key and its index, or nil if there is no
+// usable file. Stale and corrupt files are removed.
+func (c *MetricCache) open(key string) (*os.File, *cacheIndex, error) {
+	path := c.path(key)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	idx, err := readCacheIndex(f, info.Size(), EngineVersion)
+	if err == nil && idx.key != key {
+		err = errCacheStale
+	}
+	if err == errCacheCorrupt || err == errCacheStale {
+		f.Close()
+		return nil, nil, os.Remove(path)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, idx, nil
+}
+
+// nonceRange is the inclusive range of nonces start..end
+type nonceRange struct {
+	start, end uint64
+}
+
+// errCacheChanged is returned by each when the file for a key no longer
+// holds the ranges it was asked for, because it was evicted or discarded
+// since they were looked up.
+var errCacheChanged = errors.New("metric cache file changed since it was read")
+
+// covered returns the parts of start..end the file for key holds, in nonce
+// order, without reading their metrics.
+func (c *MetricCache) covered(key string, start, end uint64) ([]nonceRange, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, idx, err := c.open(key)
+	if f == nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ranges []nonceRange
+	for _, seg := range idx.segs {
+		if seg.end() < start || seg.Start > end {
+			continue
+		}
+		ranges = append(ranges, nonceRange{max(start, seg.Start), min(end, seg.end())})
+	}
+	return ranges, nil
+}
+
+// each reads the metrics of ranges, as returned by covered, and calls fn
+// with them a block at a time in nonce order, so a scan holds one block in
+// memory rather than its whole range. A file that fails its checksums is
+// removed and errCacheCorrupt returned.
+func (c *MetricCache) each(key string, ranges []nonceRange, fn func(metricSegment)) error {
+	if len(ranges) == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, idx, err := c.open(key)
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		return errCacheChanged
+	}
+	defer f.Close()
+
+	for _, r := range ranges {
+		// Stores only ever add to a file, so a segment still holds r whole
+		i := sort.Search(len(idx.segs), func(i int) bool { return idx.segs[i].end() >= r.start })
+		if i == len(idx.segs) || idx.segs[i].Start > r.start || idx.segs[i].end() < r.end {
+			return errCacheChanged
+		}
+		seg := idx.segs[i]
+		for from := r.start; ; {
+			to := min(r.end, seg.Start+((from-seg.Start)/cacheBlockSize+1)*cacheBlockSize-1)
+			metrics, err := readMetrics(f, seg, from, to, EngineVersion)
+			if err == errCacheCorrupt {
+				f.Close()
+				os.Remove(f.Name())
+				return err
+			}
+			if err != nil {
+				return err
+			}
+			fn(metricSegment{Start: from, Metrics: metrics})
+			if to == r.end {
+				break
+			}
+			from = to + 1
+		}
+	}
+
+	// Reads count as use for eviction
+	now := time.Now()
+	os.Chtimes(f.Name(), now, now)
+	return nil
+}
+
+// store adds fresh segments to the file for key. Nonces that are already
+// cached, for example by a concurrent scan of the same range, keep their
+// existing metrics. Nothing is stored if the file would exceed the size
+// limit on its own.
+func (c *MetricCache) store(key string, fresh []metricSegment) error {
+	if len(fresh) == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, idx, err := c.open(key)
+	if err != nil {
+		return err
+	}
+	var existing []segmentIndex
+	if f != nil {
+		defer f.Close()
+		existing = idx.segs
+	}
+
+	// Each piece is either an existing segment or new metrics
+	type piece struct {
+		start uint64
+		old   *segmentIndex
+		fresh []float64
+	}
+	var pieces []piece
+	var total uint64
+	for i := range existing {
+		pieces = append(pieces, piece{start: existing[i].Start, old: &existing[i]})
+		total += existing[i].Count
+	}
+	for _, seg := range fresh {
+		for _, part := range subtractCached(seg, existing) {
+			pieces = append(pieces, piece{start: part.Start, fresh: part.Metrics})
+			total += uint64(len(part.Metrics))
+		}
+	}
+	if cacheFileSize(total, len(pieces), key, EngineVersion) > c.maxBytes {
+		return nil
+	}
+	sort.Slice(pieces, func(i, j int) bool { return pieces[i].start < pieces[j].start })
+
+	path := c.path(key)
+	tmp, err := os.CreateTemp(c.dir, "write-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	cw, err := newCacheWriter(tmp, EngineVersion)
+	for _, p := range pieces {
+		if err != nil {
+			break
+		}
+		if p.old == nil {
+			err = cw.append(p.start, p.fresh)
+			continue
+		}
+		// Copy an existing segment a block at a time, verifying as we go
+		for from := p.old.Start; from <= p.old.end() && err == nil; from += cacheBlockSize {
+			to := min(from+cacheBlockSize-1, p.old.end())
+			var metrics []float64
+			if metrics, err = readMetrics(f, *p.old, from, to, EngineVersion); err == nil {
+				err = cw.append(from, metrics)
+			}
+		}
+	}
+	if err == nil {
+		err = cw.finish(EngineVersion, key)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == errCacheCorrupt {
+		f.Close()
+		return os.Remove(path)
+	}
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		f.Close()
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return c.evict(path)
+}
+
+// subtractCached returns the parts of seg not covered by the sorted segments
+// in cached.
+func subtractCached(seg metricSegment, cached []segmentIndex) []metricSegment {
+	parts := []metricSegment{seg}
+	for _, c := range cached {
+		var next []metricSegment
+		for _, p := range parts {
+			if c.end() < p.Start || c.Start > p.end() {
+				next = append(next, p)
+				continue
+			}
+			if c.Start > p.Start {
+				next = append(next, metricSegment{Start: p.Start, Metrics: p.Metrics[:c.Start-p.Start]})
+			}
+			if c.end() < p.end() {
+				next = append(next, metricSegment{Start: c.end() + 1, Metrics: p.Metrics[c.end()+1-p.Start:]})
+			}
+		}
+		parts = next
+	}
+	return parts
+}
+
+// evict removes the least recently used files, other than keep, until the
+// cache fits in its size limit.
+func (c *MetricCache) evict(keep string) error {
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, f := range files {
+		total += f.Size()
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, f := range files {
+		if total <= c.maxBytes {
+			break
+		}
+		path := filepath.Join(c.dir, f.Name())
+		if path == keep {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= f.Size()
+	}
+	return nil
+}
+
+func (c *MetricCache) files() ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []os.FileInfo
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != cacheFileExt {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+// maxFreshMetrics caps the uncached metrics a scan holds at once, 64 MiB
+// of them. Longer gaps are evaluated and stored a part at a time.
+const maxFreshMetrics = 1 << 23
+
+// scanCached answers req from the metric cache, evaluating and storing only
+// the nonces that aren't cached yet. Cached metrics are streamed from disk
+// rather than loaded. It reports false when the cache can't be used, in
+// which case the caller scans normally.
+func (s *Scanner) scanCached(ctx context.Context, game games.Game, req ScanRequest, evaluator *TargetEvaluator) (*ScanResult, bool) {
+	// A range that can't fit in the cache is scanned without it
+	if req.NonceEnd-req.NonceStart >= uint64(s.cache.maxBytes)/8 {
+		return nil, false
+	}
+	key, err := metricCacheKey(req.Game, req.Seeds, req.Params)
+	if err != nil {
+		return nil, false
+	}
+	cached, err := s.cache.covered(key, req.NonceStart, req.NonceEnd)
+	if err != nil {
+		return nil, false
+	}
+
+	var ranked *rankedHits
+	if req.TargetOp.IsRanked() {
+		ranked = newRankedHits(req.TargetOp, req.Limit)
+	}
+	// Fresh and cached metrics each arrive in nonce order, so each list
+	// keeps its earliest Limit matches and the merge keeps the earliest
+	// of both
+	var freshHits, cachedHits []Hit
+	var evaluated uint64
+	visit := func(hits *[]Hit) func(metricSegment) {
+		return func(seg metricSegment) {
+			for i, metric := range seg.Metrics {
+				if math.IsNaN(metric) {
+					continue
+				}
+				evaluated++
+				hit := Hit{Nonce: seg.Start + uint64(i), Metric: metric}
+				switch {
+				case ranked != nil:
+					ranked.offer(hit)
+				case (req.Limit <= 0 || len(*hits) < req.Limit) && evaluator.Matches(metric):
+					*hits = append(*hits, hit)
+				}
+			}
+		}
+	}
+
+	for _, part := range splitRanges(uncachedGaps(req.NonceStart, req.NonceEnd, cached), maxFreshMetrics) {
+		if ctx.Err() != nil {
+			break
+		}
+		fresh := s.fillGaps(ctx, game, req, nanSegments(part))
+		// A failed write only costs a recomputation next time
+		_ = s.cache.store(key, fresh)
+		for _, seg := range fresh {
+			visit(&freshHits)(seg)
+		}
+	}
+	timedOut := ctx.Err() != nil
+	if err := s.cache.each(key, cached, visit(&cachedHits)); err != nil {
+		return nil, false
+	}
+
+	hits := append(append([]Hit{}, cachedHits...), freshHits...)
+	if ranked != nil {
+		hits = mergeRanked(req.TargetOp, req.Limit, []*rankedHits{ranked})
+	} else {
+		sort.Slice(hits, func(i, j int) bool { return hits[i].Nonce < hits[j].Nonce })
+		if req.Limit > 0 && len(hits) > req.Limit {
+			hits = hits[:req.Limit]
+		}
+	}
+
+	metrics := make([]float64, len(hits))
+	for i, hit := range hits {
+		metrics[i] = hit.Metric
+	}
+	collector := &ResultCollector{}
+	return &ScanResult{
+		Hits:    hits,
+		Summary: collector.calculateSummary(metrics, evaluated, timedOut),
+	}, true
+}
+
+// uncachedGaps returns the parts of start..end not covered by cached.
+func uncachedGaps(start, end uint64, cached []nonceRange) []nonceRange {
+	var gaps []nonceRange
+	next := start
+	for _, r := range cached {
+		if r.start > next {
+			gaps = append(gaps, nonceRange{next, r.start - 1})
+		}
+		next = r.end + 1
+	}
+	if next <= end && next >= start {
+		gaps = append(gaps, nonceRange{next, end})
+	}
+	return gaps
+}
+
+// splitRanges groups ranges into parts of at most size nonces, splitting a
+// range that doesn't fit.
+func splitRanges(ranges []nonceRange, size uint64) [][]nonceRange {
+	var parts [][]nonceRange
+	var part []nonceRange
+	var n uint64
+	for _, r := range ranges {
+		for from := r.start; ; {
+			to := min(r.end, from+(size-n)-1)
+			part = append(part, nonceRange{from, to})
+			if n += to - from + 1; n == size {
+				parts, part, n = append(parts, part), nil, 0
+			}
+			if to == r.end {
+				break
+			}
+			from = to + 1
+		}
+	}
+	if len(part) > 0 {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// nanSegments allocates the metrics of ranges, filled with NaN.
+func nanSegments(ranges []nonceRange) []metricSegment {
+	segs := make([]metricSegment, len(ranges))
+	for i, r := range ranges {
+		metrics := make([]float64, r.end-r.start+1)
+		for j := range metrics {
+			metrics[j] = math.NaN()
+		}
+		segs[i] = metricSegment{Start: r.start, Metrics: metrics}
+	}
+	return segs
+}
+
+// gapJob is a nonce range within one gap
+type gapJob struct {
+	gap        int
+	nonceStart uint64
+	nonceEnd   uint64
+}
+
+// fillGaps evaluates the nonces of gaps on the worker pool and returns the
+// parts that were completed before ctx was done.
+func (s *Scanner) fillGaps(ctx context.Context, game games.Game, req ScanRequest, gaps []metricSegment) []metricSegment {
+	if len(gaps) == 0 {
+		return nil
+	}
+
+	jobs := make(chan gapJob, s.workerCount*2)
+	completed := make([][]gapJob, s.workerCount)
+	var wg sync.WaitGroup
+
+	for w := 0; w < s.workerCount; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			floats := make([]float64, game.FloatCount(req.Params))
+			for job := range jobs {
+				if !s.budget.acquire(ctx) {
+					return
+				}
+				metrics := gaps[job.gap].Metrics
+				base := gaps[job.gap].Start
+				for nonce := job.nonceStart; nonce <= job.nonceEnd; nonce++ {
+					if ctx.Err() != nil {
+						s.budget.release()
+						return
+					}
+					engine.FloatsInto(floats, req.Seeds.Server, req.Seeds.Client, nonce, 0, len(floats))
+					if result, err := game.EvaluateWithFloats(floats, req.Params); err == nil {
+						metrics[nonce-base] = result.Metric
+					}
+				}
+				s.budget.release()
+				completed[w] = append(completed[w], job)
+			}
+		}(w)
+	}
+
+	go func() {
+		defer close(jobs)
+		const batchSize = 8192
+		for g, gap := range gaps {
+			for start := gap.Start; start <= gap.end(); start += batchSize {
+				job := gapJob{gap: g, nonceStart: start, nonceEnd: min(start+batchSize-1, gap.end())}
+				select {
+				case jobs <- job:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	wg.Wait()
+
+	// Rebuild contiguous segments from the jobs that finished
+	var done []gapJob
+	for _, c := range completed {
+		done = append(done, c...)
+	}
+	sort.Slice(done, func(i, j int) bool {
+		if done[i].gap != done[j].gap {
+			return done[i].gap < done[j].gap
+		}
+		return done[i].nonceStart < done[j].nonceStart
+	})
+
+	var fresh []metricSegment
+	for i := 0; i < len(done); {
+		j := i
+		for j+1 < len(done) && done[j+1].gap == done[i].gap && done[j+1].nonceStart == done[j].nonceEnd+1 {
+			j++
+		}
+		gap := gaps[done[i].gap]
+		fresh = append(fresh, metricSegment{
+			Start:   done[i].nonceStart,
+			Metrics: gap.Metrics[done[i].nonceStart-gap.Start : done[j].nonceEnd-gap.Start+1],
+		})
+		i = j + 1
+	}
+	return fresh
+}
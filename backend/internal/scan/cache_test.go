@@ -0,0 +1,308 @@
+package scan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+)
+
+func cacheRequest(start, end uint64, op TargetOp, val float64) ScanRequest {
+	return ScanRequest{
+		Game:       "limbo",
+		Seeds:      games.Seeds{Server: "cache_server", Client: "cache_client"},
+		NonceStart: start,
+		NonceEnd:   end,
+		TargetOp:   op,
+		TargetVal:  val,
+	}
+}
+
+// lookup reads the cached parts of start..end into memory, joining blocks
+// of the same segment.
+func (c *MetricCache) lookup(key string, start, end uint64) ([]metricSegment, error) {
+	ranges, err := c.covered(key, start, end)
+	if err != nil {
+		return nil, err
+	}
+	var found []metricSegment
+	err = c.each(key, ranges, func(part metricSegment) {
+		if n := len(found); n > 0 && found[n-1].end()+1 == part.Start {
+			found[n-1].Metrics = append(found[n-1].Metrics, part.Metrics...)
+			return
+		}
+		found = append(found, part)
+	})
+	if err == errCacheCorrupt || err == errCacheChanged {
+		return nil, nil
+	}
+	return found, err
+}
+
+func cacheFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+cacheFileExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// checkSameResult compares a cached scan against evaluating every nonce
+// serially, keeping the earliest Limit matches.
+func checkSameResult(t *testing.T, cached *Scanner, req ScanRequest) {
+	t.Helper()
+	got, err := cached.Scan(context.Background(), req)
+	if err != nil {
+		t.Fatalf("cached scan: %v", err)
+	}
+
+	var want []Hit
+	if req.TargetOp.IsRanked() {
+		want = bruteForceRanked(t, req)
+	} else {
+		game, _ := games.GetGame(req.Game)
+		evaluator := NewTargetEvaluator(req.TargetOp, req.TargetVal, req.TargetVal2, 1e-9)
+		want = []Hit{}
+		for nonce := req.NonceStart; nonce <= req.NonceEnd; nonce++ {
+			res, err := game.Evaluate(req.Seeds, nonce, req.Params)
+			if err != nil {
+				t.Fatalf("evaluate nonce %d: %v", nonce, err)
+			}
+			if evaluator.Matches(res.Metric) {
+				want = append(want, Hit{Nonce: nonce, Metric: res.Metric})
+			}
+		}
+		if req.Limit > 0 && len(want) > req.Limit {
+			want = want[:req.Limit]
+		}
+	}
+	if !reflect.DeepEqual(got.Hits, want) {
+		t.Errorf("%s %v: cached hits differ: got %d, want %d", req.TargetOp, req.TargetVal, len(got.Hits), len(want))
+	}
+	if got.Summary.TotalEvaluated != req.NonceEnd-req.NonceStart+1 || got.Summary.HitsFound != len(want) {
+		t.Errorf("unexpected summary: %+v", got.Summary)
+	}
+}
+
+func TestScannerCacheMatchesUncached(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewMetricCache(dir, 64<<20)
+	if err != nil {
+		t.Fatalf("NewMetricCache: %v", err)
+	}
+	scanner := NewScanner().WithCache(cache)
+
+	// The first scan fills the cache, later ones overlap it on both sides
+	// and change the target.
+	checkSameResult(t, scanner, cacheRequest(20000, 90000, OpGreaterEqual, 10))
+	checkSameResult(t, scanner, cacheRequest(1, 150000, OpGreaterEqual, 50))
+	checkSameResult(t, scanner, cacheRequest(30000, 60000, OpBetween, 2))
+
+	ranked := cacheRequest(1, 150000, OpTopK, 0)
+	ranked.Limit = 20
+	checkSameResult(t, scanner, ranked)
+
+	if files := cacheFiles(t, dir); len(files) != 1 {
+		t.Fatalf("expected one cache file, got %d", len(files))
+	}
+
+	key, _ := metricCacheKey("limbo", games.Seeds{Server: "cache_server", Client: "cache_client"}, nil)
+	segs, err := cache.lookup(key, 1, 150000)
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if len(segs) != 1 || segs[0].Start != 1 || len(segs[0].Metrics) != 150000 {
+		t.Errorf("expected one coalesced segment covering 1..150000, got %d segments", len(segs))
+	}
+}
+
+func TestScannerCacheRespectsLimit(t *testing.T) {
+	cache, err := NewMetricCache(t.TempDir(), 64<<20)
+	if err != nil {
+		t.Fatalf("NewMetricCache: %v", err)
+	}
+	scanner := NewScanner().WithCache(cache)
+
+	req := cacheRequest(1, 50000, OpGreaterEqual, 2)
+	req.Limit = 10
+	if _, err := scanner.Scan(context.Background(), req); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	res, err := scanner.Scan(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if len(res.Hits) != 10 || res.Summary.TotalEvaluated != 50000 {
+		t.Fatalf("expected 10 hits over 50000 nonces, got %d over %d", len(res.Hits), res.Summary.TotalEvaluated)
+	}
+	for i := 1; i < len(res.Hits); i++ {
+		if res.Hits[i].Nonce <= res.Hits[i-1].Nonce {
+			t.Fatalf("cached hits should be the earliest matches in nonce order: %+v", res.Hits)
+		}
+	}
+}
+
+func TestScannerCacheLimitAcrossFreshAndCached(t *testing.T) {
+	cache, err := NewMetricCache(t.TempDir(), 64<<20)
+	if err != nil {
+		t.Fatalf("NewMetricCache: %v", err)
+	}
+	scanner := NewScanner().WithCache(cache)
+
+	// The earliest matches are fresh, the later ones cached, and vice versa
+	checkSameResult(t, scanner, cacheRequest(30000, 60000, OpGreaterEqual, 2))
+	req := cacheRequest(1, 90000, OpGreaterEqual, 2)
+	req.Limit = 25
+	checkSameResult(t, scanner, req)
+	req = cacheRequest(1, 120000, OpGreaterEqual, 3)
+	req.Limit = 40000
+	checkSameResult(t, scanner, req)
+}
+
+func TestSplitRanges(t *testing.T) {
+	got := splitRanges([]nonceRange{{1, 10}, {20, 22}, {30, 45}}, 8)
+	want := [][]nonceRange{
+		{{1, 8}},
+		{{9, 10}, {20, 22}, {30, 32}},
+		{{33, 40}},
+		{{41, 45}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestMetricCacheDiscardsCorruptAndStaleFiles(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewMetricCache(dir, 64<<20)
+	if err != nil {
+		t.Fatalf("NewMetricCache: %v", err)
+	}
+	scanner := NewScanner().WithCache(cache)
+	req := cacheRequest(1, 100000, OpGreaterEqual, 5)
+	if _, err := scanner.Scan(context.Background(), req); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	files := cacheFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("expected one cache file, got %d", len(files))
+	}
+
+	// Flip a metric in the second block
+	f, err := os.OpenFile(files[0], os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{0xff}, cacheHeaderSize+(cacheBlockSize+10)*8); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	key, _ := metricCacheKey(req.Game, req.Seeds, req.Params)
+	if segs, err := cache.lookup(key, 1, 100); err != nil || len(segs) != 1 {
+		t.Fatalf("blocks before the damage should still verify: %d segments, %v", len(segs), err)
+	}
+	if segs, err := cache.lookup(key, 1, 100000); err != nil || segs != nil {
+		t.Fatalf("expected corrupt file to be discarded, got %d segments, %v", len(segs), err)
+	}
+	if len(cacheFiles(t, dir)) != 0 {
+		t.Fatal("corrupt cache file was not removed")
+	}
+	checkSameResult(t, scanner, req)
+
+	// A file written by another engine version is never used
+	stale, err := os.Create(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw, err := newCacheWriter(stale, "go-0.9.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw.append(1, make([]float64, 100))
+	if err := cw.finish("go-0.9.0", key); err != nil {
+		t.Fatal(err)
+	}
+	stale.Close()
+	if segs, err := cache.lookup(key, 1, 100); err != nil || segs != nil {
+		t.Fatalf("expected stale file to be ignored, got %d segments, %v", len(segs), err)
+	}
+}
+
+func TestMetricCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	// Room for one 30000-nonce file but not two
+	cache, err := NewMetricCache(dir, 400<<10)
+	if err != nil {
+		t.Fatalf("NewMetricCache: %v", err)
+	}
+	scanner := NewScanner().WithCache(cache)
+
+	first := cacheRequest(1, 30000, OpGreaterEqual, 2)
+	if _, err := scanner.Scan(context.Background(), first); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	second := first
+	second.Seeds.Client = "other_client"
+	if _, err := scanner.Scan(context.Background(), second); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	size, err := cache.Size()
+	if err != nil {
+		t.Fatalf("Size: %v", err)
+	}
+	if size > 400<<10 {
+		t.Errorf("cache is %d bytes, over its limit", size)
+	}
+	key, _ := metricCacheKey(second.Game, second.Seeds, nil)
+	if segs, _ := cache.lookup(key, 1, 30000); len(segs) != 1 {
+		t.Error("most recent file should have been kept")
+	}
+	key, _ = metricCacheKey(first.Game, first.Seeds, nil)
+	if segs, _ := cache.lookup(key, 1, 30000); segs != nil {
+		t.Error("least recently used file should have been evicted")
+	}
+
+	// Ranges that can't fit are scanned without the cache
+	before := cacheFiles(t, dir)
+	res, err := scanner.Scan(context.Background(), cacheRequest(1, 60000, OpGreaterEqual, 2))
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if res.Summary.TotalEvaluated != 60000 {
+		t.Errorf("expected 60000 evaluated, got %d", res.Summary.TotalEvaluated)
+	}
+	if after := cacheFiles(t, dir); !reflect.DeepEqual(before, after) {
+		t.Errorf("oversized scan changed the cache: %v -> %v", before, after)
+	}
+	if err := cache.Clear(); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	if len(cacheFiles(t, dir)) != 0 {
+		t.Error("Clear left cache files behind")
+	}
+}
+
+func TestMetricCacheKeyTracksPayoutTables(t *testing.T) {
+	seeds := games.Seeds{Server: "cache_server", Client: "cache_client"}
+	params := map[string]any{"risk": "high", "picks": []any{1.0, 2.0, 3.0}}
+	before, err := metricCacheKey("keno", seeds, params)
+	if err != nil {
+		t.Fatalf("metricCacheKey: %v", err)
+	}
+
+	// Change one payout and restore it when done
+	old := games.KenoPayouts["high"][3][3]
+	games.KenoPayouts["high"][3][3] = old + 1
+	defer func() { games.KenoPayouts["high"][3][3] = old }()
+
+	after, _ := metricCacheKey("keno", seeds, params)
+	if after == before {
+		t.Fatal("expected a payout table change to change the cache key")
+	}
+}
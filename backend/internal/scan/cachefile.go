@@ -0,0 +1,321 @@
+package scan
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// Metric cache files are columnar: the metrics of every cached segment are
+// stored back to back as little-endian float64s, followed by an index of the
+// segments and a fixed-size footer pointing at the index.
+//
+//	"PFMC" format(u16) | metrics... | index | indexOffset(u64) indexLen(u32) indexCRC(u32) "PFMC"
+//
+// Each segment's metrics are checksummed in blocks of cacheBlockSize nonces so
+// a lookup only reads and verifies the blocks it needs. Block checksums are
+// seeded with the engine version, so a file written by another engine never
+// verifies even if its index were edited.
+const (
+	cacheMagic      = "PFMC"
+	cacheFormat     = 1
+	cacheHeaderSize = 6
+	cacheFooterSize = 20
+	cacheBlockSize  = 1 << 16 // nonces per checksummed block
+)
+
+var (
+	errCacheCorrupt = errors.New("metric cache file is corrupt")
+	errCacheStale   = errors.New("metric cache file was written by another engine version")
+)
+
+// segmentIndex describes one contiguous run of cached nonces
+type segmentIndex struct {
+	Start  uint64
+	Count  uint64
+	CRCs   []uint32 // one per block
+	offset int64    // file offset of the first metric
+}
+
+func (s segmentIndex) end() uint64 { return s.Start + s.Count - 1 }
+
+// cacheIndex is the decoded index of a cache file
+type cacheIndex struct {
+	engine string
+	key    string
+	segs   []segmentIndex
+}
+
+func blockCount(n uint64) int {
+	return int((n + cacheBlockSize - 1) / cacheBlockSize)
+}
+
+func engineCRC(engine string) uint32 {
+	return crc32.ChecksumIEEE([]byte(engine))
+}
+
+// readCacheIndex validates the header and footer of a cache file and decodes
+// its index. Block checksums are checked later, by readMetrics.
+func readCacheIndex(f io.ReaderAt, size int64, engine string) (*cacheIndex, error) {
+	if size < cacheHeaderSize+cacheFooterSize {
+		return nil, errCacheCorrupt
+	}
+	header := make([]byte, cacheHeaderSize)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != cacheMagic {
+		return nil, errCacheCorrupt
+	}
+	if binary.LittleEndian.Uint16(header[4:]) != cacheFormat {
+		return nil, errCacheStale
+	}
+
+	footer := make([]byte, cacheFooterSize)
+	if _, err := f.ReadAt(footer, size-cacheFooterSize); err != nil {
+		return nil, err
+	}
+	if string(footer[16:]) != cacheMagic {
+		return nil, errCacheCorrupt
+	}
+	indexOffset := int64(binary.LittleEndian.Uint64(footer))
+	indexLen := int64(binary.LittleEndian.Uint32(footer[8:]))
+	if indexOffset < cacheHeaderSize || indexOffset+indexLen != size-cacheFooterSize {
+		return nil, errCacheCorrupt
+	}
+	raw := make([]byte, indexLen)
+	if _, err := f.ReadAt(raw, indexOffset); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(raw) != binary.LittleEndian.Uint32(footer[12:]) {
+		return nil, errCacheCorrupt
+	}
+
+	idx, err := decodeCacheIndex(raw)
+	if err != nil {
+		return nil, err
+	}
+	if idx.engine != engine {
+		return nil, errCacheStale
+	}
+
+	// Segments must be ordered, disjoint and exactly fill the data section.
+	offset := int64(cacheHeaderSize)
+	for i := range idx.segs {
+		seg := &idx.segs[i]
+		if seg.Count == 0 || len(seg.CRCs) != blockCount(seg.Count) {
+			return nil, errCacheCorrupt
+		}
+		if i > 0 && seg.Start <= idx.segs[i-1].end() {
+			return nil, errCacheCorrupt
+		}
+		seg.offset = offset
+		offset += int64(seg.Count) * 8
+	}
+	if offset != indexOffset {
+		return nil, errCacheCorrupt
+	}
+	return idx, nil
+}
+
+func decodeCacheIndex(raw []byte) (*cacheIndex, error) {
+	r := &indexReader{buf: raw}
+	idx := &cacheIndex{
+		engine: r.string(int(r.uint16())),
+		key:    r.string(int(r.uint32())),
+	}
+	n := r.uint32()
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		seg := segmentIndex{Start: r.uint64(), Count: r.uint64()}
+		blocks := blockCount(seg.Count)
+		if blocks*4 > len(r.buf) {
+			return nil, errCacheCorrupt
+		}
+		seg.CRCs = make([]uint32, blocks)
+		for b := range seg.CRCs {
+			seg.CRCs[b] = r.uint32()
+		}
+		idx.segs = append(idx.segs, seg)
+	}
+	if r.err != nil || len(r.buf) != 0 {
+		return nil, errCacheCorrupt
+	}
+	return idx, nil
+}
+
+// indexReader decodes little-endian fields and remembers the first short read
+type indexReader struct {
+	buf []byte
+	err error
+}
+
+func (r *indexReader) take(n int) []byte {
+	if r.err != nil || n > len(r.buf) {
+		r.err = errCacheCorrupt
+		return make([]byte, n)
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *indexReader) uint16() uint16      { return binary.LittleEndian.Uint16(r.take(2)) }
+func (r *indexReader) uint32() uint32      { return binary.LittleEndian.Uint32(r.take(4)) }
+func (r *indexReader) uint64() uint64      { return binary.LittleEndian.Uint64(r.take(8)) }
+func (r *indexReader) string(n int) string { return string(r.take(n)) }
+
+// readMetrics reads the metrics of nonces from..to (inclusive) of seg,
+// verifying every block it touches.
+func readMetrics(f io.ReaderAt, seg segmentIndex, from, to uint64, engine string) ([]float64, error) {
+	firstBlock := int((from - seg.Start) / cacheBlockSize)
+	lastBlock := int((to - seg.Start) / cacheBlockSize)
+	blockStart := uint64(firstBlock) * cacheBlockSize
+	blockEnd := uint64(lastBlock+1) * cacheBlockSize
+	if blockEnd > seg.Count {
+		blockEnd = seg.Count
+	}
+
+	raw := make([]byte, (blockEnd-blockStart)*8)
+	if _, err := f.ReadAt(raw, seg.offset+int64(blockStart)*8); err != nil {
+		if err == io.EOF {
+			return nil, errCacheCorrupt
+		}
+		return nil, err
+	}
+
+	seed := engineCRC(engine)
+	for b := firstBlock; b <= lastBlock; b++ {
+		lo := (uint64(b)*cacheBlockSize - blockStart) * 8
+		hi := lo + cacheBlockSize*8
+		if hi > uint64(len(raw)) {
+			hi = uint64(len(raw))
+		}
+		if crc32.Update(seed, crc32.IEEETable, raw[lo:hi]) != seg.CRCs[b] {
+			return nil, errCacheCorrupt
+		}
+	}
+
+	skip := from - seg.Start - blockStart
+	metrics := make([]float64, to-from+1)
+	for i := range metrics {
+		metrics[i] = math.Float64frombits(binary.LittleEndian.Uint64(raw[(skip+uint64(i))*8:]))
+	}
+	return metrics, nil
+}
+
+// cacheWriter streams segments into a new cache file. Consecutive appends
+// with adjoining nonces are coalesced into one segment.
+type cacheWriter struct {
+	w        *bufio.Writer
+	written  int64
+	seed     uint32
+	segs     []segmentIndex
+	open     bool
+	blockN   int
+	blockCRC uint32
+	buf      []byte
+}
+
+func newCacheWriter(w io.Writer, engine string) (*cacheWriter, error) {
+	cw := &cacheWriter{w: bufio.NewWriterSize(w, 1<<20), seed: engineCRC(engine)}
+	header := binary.LittleEndian.AppendUint16([]byte(cacheMagic), cacheFormat)
+	if err := cw.write(header); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (cw *cacheWriter) write(b []byte) error {
+	n, err := cw.w.Write(b)
+	cw.written += int64(n)
+	return err
+}
+
+// append adds metrics for nonces start, start+1, ...
+func (cw *cacheWriter) append(start uint64, metrics []float64) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	if !cw.open || start != cw.segs[len(cw.segs)-1].end()+1 {
+		cw.closeSegment()
+		cw.segs = append(cw.segs, segmentIndex{Start: start, offset: cw.written})
+		cw.open = true
+		cw.blockCRC = cw.seed
+	}
+	seg := &cw.segs[len(cw.segs)-1]
+
+	for len(metrics) > 0 {
+		n := cacheBlockSize - cw.blockN
+		if n > len(metrics) {
+			n = len(metrics)
+		}
+		cw.buf = cw.buf[:0]
+		for _, m := range metrics[:n] {
+			cw.buf = binary.LittleEndian.AppendUint64(cw.buf, math.Float64bits(m))
+		}
+		cw.blockCRC = crc32.Update(cw.blockCRC, crc32.IEEETable, cw.buf)
+		if err := cw.write(cw.buf); err != nil {
+			return err
+		}
+		seg.Count += uint64(n)
+		cw.blockN += n
+		if cw.blockN == cacheBlockSize {
+			seg.CRCs = append(seg.CRCs, cw.blockCRC)
+			cw.blockN = 0
+			cw.blockCRC = cw.seed
+		}
+		metrics = metrics[n:]
+	}
+	return nil
+}
+
+func (cw *cacheWriter) closeSegment() {
+	if cw.open && cw.blockN > 0 {
+		seg := &cw.segs[len(cw.segs)-1]
+		seg.CRCs = append(seg.CRCs, cw.blockCRC)
+	}
+	cw.open = false
+	cw.blockN = 0
+}
+
+// finish writes the index and footer and flushes the file.
+func (cw *cacheWriter) finish(engine, key string) error {
+	cw.closeSegment()
+
+	index := binary.LittleEndian.AppendUint16(nil, uint16(len(engine)))
+	index = append(index, engine...)
+	index = binary.LittleEndian.AppendUint32(index, uint32(len(key)))
+	index = append(index, key...)
+	index = binary.LittleEndian.AppendUint32(index, uint32(len(cw.segs)))
+	for _, seg := range cw.segs {
+		index = binary.LittleEndian.AppendUint64(index, seg.Start)
+		index = binary.LittleEndian.AppendUint64(index, seg.Count)
+		for _, crc := range seg.CRCs {
+			index = binary.LittleEndian.AppendUint32(index, crc)
+		}
+	}
+
+	footer := binary.LittleEndian.AppendUint64(nil, uint64(cw.written))
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(index)))
+	footer = binary.LittleEndian.AppendUint32(footer, crc32.ChecksumIEEE(index))
+	footer = append(footer, cacheMagic...)
+
+	if err := cw.write(index); err != nil {
+		return err
+	}
+	if err := cw.write(footer); err != nil {
+		return err
+	}
+	return cw.w.Flush()
+}
+
+// cacheFileSize is an upper bound on the size of a file holding count
+// metrics in segs segments.
+func cacheFileSize(count uint64, segs int, key string, engine string) int64 {
+	blocks := int64(count/cacheBlockSize) + int64(segs)
+	return cacheHeaderSize + int64(count)*8 + 2 + int64(len(engine)) + 4 + int64(len(key)) + 4 +
+		int64(segs)*16 + blocks*4 + cacheFooterSize
+}
@@ -9,4 +9,5 @@ var (
 	ErrInvalidNonce  = errors.New("invalid nonce")
 	ErrInvalidParams = errors.New("invalid params")
 	ErrTimeout       = errors.New("timeout")
+	ErrInvalidLimit  = errors.New("top and bottom scans require a limit > 0")
 )
\ No newline at end of file
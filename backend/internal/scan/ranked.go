@@ -0,0 +1,96 @@
+package scan
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Ranked scan operations keep the Limit best outcomes in the nonce range
+// instead of matching a fixed target. TargetVal, TargetVal2 and Tolerance are
+// ignored.
+const (
+	OpTopK    TargetOp = "top"
+	OpBottomK TargetOp = "bottom"
+)
+
+// IsRanked reports whether op selects a top-K or bottom-K scan.
+func (op TargetOp) IsRanked() bool {
+	return op == OpTopK || op == OpBottomK
+}
+
+// rankedHits is a bounded heap holding the k best hits seen so far. The root
+// is the worst kept hit, so a new hit only has to beat the root to get in.
+// Equal metrics are ranked by nonce, lowest first, which makes the result
+// independent of how nonces were split between workers.
+type rankedHits struct {
+	k      int
+	bottom bool
+	hits   []Hit
+}
+
+// rankedPrealloc caps the slots a heap reserves up front. A heap grows past
+// it only as hits arrive, so a large k on a sparse range, or on each of many
+// seed pairs, costs no more than the hits kept.
+const rankedPrealloc = 1024
+
+func newRankedHits(op TargetOp, k int) *rankedHits {
+	return &rankedHits{k: k, bottom: op == OpBottomK, hits: make([]Hit, 0, min(k, rankedPrealloc))}
+}
+
+// better reports whether a ranks ahead of b.
+func (r *rankedHits) better(a, b Hit) bool {
+	if a.Metric != b.Metric {
+		if r.bottom {
+			return a.Metric < b.Metric
+		}
+		return a.Metric > b.Metric
+	}
+	return a.Nonce < b.Nonce
+}
+
+func (r *rankedHits) Len() int           { return len(r.hits) }
+func (r *rankedHits) Less(i, j int) bool { return r.better(r.hits[j], r.hits[i]) }
+func (r *rankedHits) Swap(i, j int)      { r.hits[i], r.hits[j] = r.hits[j], r.hits[i] }
+func (r *rankedHits) Push(x any)         { r.hits = append(r.hits, x.(Hit)) }
+func (r *rankedHits) Pop() any {
+	last := r.hits[len(r.hits)-1]
+	r.hits = r.hits[:len(r.hits)-1]
+	return last
+}
+
+// offer adds hit if it ranks among the k best.
+func (r *rankedHits) offer(hit Hit) {
+	if len(r.hits) < r.k {
+		heap.Push(r, hit)
+		return
+	}
+	if r.better(hit, r.hits[0]) {
+		r.hits[0] = hit
+		heap.Fix(r, 0)
+	}
+}
+
+// MergeRankedHits combines ranked hit lists, such as the results of scanning
+// consecutive parts of a range, and returns the k best in rank order.
+func MergeRankedHits(op TargetOp, k int, lists ...[]Hit) []Hit {
+	parts := make([]*rankedHits, len(lists))
+	for i, hits := range lists {
+		parts[i] = &rankedHits{hits: hits}
+	}
+	return mergeRanked(op, k, parts)
+}
+
+// mergeRanked combines per-worker heaps and returns the k best hits in rank
+// order.
+func mergeRanked(op TargetOp, k int, parts []*rankedHits) []Hit {
+	merged := newRankedHits(op, k)
+	for _, part := range parts {
+		for _, hit := range part.hits {
+			merged.offer(hit)
+		}
+	}
+	sort.Slice(merged.hits, func(i, j int) bool {
+		return merged.better(merged.hits[i], merged.hits[j])
+	})
+	return merged.hits
+}
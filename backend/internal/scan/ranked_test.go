@@ -0,0 +1,114 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+)
+
+// bruteForceRanked evaluates every nonce serially and sorts the outcomes.
+func bruteForceRanked(t *testing.T, req ScanRequest) []Hit {
+	t.Helper()
+	game, _ := games.GetGame(req.Game)
+	var all []Hit
+	for nonce := req.NonceStart; nonce <= req.NonceEnd; nonce++ {
+		res, err := game.Evaluate(req.Seeds, nonce, req.Params)
+		if err != nil {
+			t.Fatalf("evaluate nonce %d: %v", nonce, err)
+		}
+		all = append(all, Hit{Nonce: nonce, Metric: res.Metric})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Metric != all[j].Metric {
+			if req.TargetOp == OpBottomK {
+				return all[i].Metric < all[j].Metric
+			}
+			return all[i].Metric > all[j].Metric
+		}
+		return all[i].Nonce < all[j].Nonce
+	})
+	if len(all) > req.Limit {
+		all = all[:req.Limit]
+	}
+	return all
+}
+
+func TestScannerRanked(t *testing.T) {
+	tests := []struct {
+		name string
+		game string
+		op   TargetOp
+		k    int
+	}{
+		{"limbo_top", "limbo", OpTopK, 25},
+		{"limbo_bottom", "limbo", OpBottomK, 25},
+		// Roulette has 37 outcomes, so most of the ranking is decided by nonce
+		{"roulette_top_ties", "roulette", OpTopK, 100},
+		{"roulette_bottom_ties", "roulette", OpBottomK, 100},
+		{"k_larger_than_range", "dice", OpTopK, 50000},
+	}
+
+	scanner := NewScanner()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ScanRequest{
+				Game:       tt.game,
+				Seeds:      games.Seeds{Server: "ranked_server", Client: "ranked_client"},
+				NonceStart: 1,
+				NonceEnd:   20000,
+				TargetOp:   tt.op,
+				Limit:      tt.k,
+			}
+			result, err := scanner.Scan(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			want := bruteForceRanked(t, req)
+			if len(result.Hits) != len(want) {
+				t.Fatalf("Expected %d hits, got %d", len(want), len(result.Hits))
+			}
+			for i := range want {
+				if result.Hits[i] != want[i] {
+					t.Fatalf("Rank %d: expected %+v, got %+v", i+1, want[i], result.Hits[i])
+				}
+			}
+			if result.Summary.TotalEvaluated != 20000 {
+				t.Errorf("Expected 20000 evaluations, got %d", result.Summary.TotalEvaluated)
+			}
+			if result.Summary.HitsFound != len(want) {
+				t.Errorf("Expected hits_found %d, got %d", len(want), result.Summary.HitsFound)
+			}
+		})
+	}
+}
+
+func TestScannerRankedRequiresLimit(t *testing.T) {
+	_, err := NewScanner().Scan(context.Background(), ScanRequest{
+		Game:       "limbo",
+		Seeds:      games.Seeds{Server: "s", Client: "c"},
+		NonceStart: 1,
+		NonceEnd:   10,
+		TargetOp:   OpTopK,
+	})
+	if !errors.Is(err, ErrInvalidLimit) {
+		t.Fatalf("Expected ErrInvalidLimit, got %v", err)
+	}
+}
+
+func TestRankedHitsGrowLazily(t *testing.T) {
+	r := newRankedHits(OpTopK, 50_000_000)
+	if cap(r.hits) > rankedPrealloc {
+		t.Fatalf("expected at most %d slots reserved, got %d", rankedPrealloc, cap(r.hits))
+	}
+	for nonce := uint64(1); nonce <= 3*rankedPrealloc; nonce++ {
+		r.offer(Hit{Nonce: nonce, Metric: float64(nonce)})
+	}
+	hits := mergeRanked(OpTopK, 50_000_000, []*rankedHits{r})
+	if len(hits) != 3*rankedPrealloc || hits[0].Nonce != 3*rankedPrealloc {
+		t.Errorf("expected all %d hits kept best first, got %d starting at %+v", 3*rankedPrealloc, len(hits), hits[0])
+	}
+}
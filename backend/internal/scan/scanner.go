@@ -25,6 +25,13 @@ const (
 	OpOutside      TargetOp = "outside"
 )
 
+// EngineVersion identifies the scanner's outcome calculations, apart from
+// the payout tables, which manifests and the metric cache hash on their
+// own. It changes only when a calculation does, not with every release;
+// the build version is recorded next to it. Cached metrics are only reused
+// by the same version.
+const EngineVersion = "go-1.0.0"
+
 // ScanRequest represents a scan operation request
 type ScanRequest struct {
 	Game       string         `json:"game"`
@@ -80,7 +87,9 @@ type ScanWorker struct {
 	seeds      games.Seeds
 	params     map[string]any
 	evaluator  *TargetEvaluator
+	ranked     *rankedHits // set for top/bottom scans instead of sending hits
 	floatPool  *sync.Pool
+	budget     *WorkerBudget
 	evaluated  *uint64 // atomic counter
 }
 
@@ -88,6 +97,8 @@ type ScanWorker struct {
 type Scanner struct {
 	workerCount int
 	floatPool   *sync.Pool
+	cache       *MetricCache  // optional; see WithCache
+	budget      *WorkerBudget // optional; see WithBudget
 }
 
 // TargetEvaluator handles target condition evaluation with tolerance
@@ -147,12 +158,39 @@ func NewScanner() *Scanner {
 	}
 }
 
+// NewScannerWithWorkers creates a scanner that runs at most workers worker
+// goroutines per scan, for callers that share the CPU between several scans.
+func NewScannerWithWorkers(workers int) *Scanner {
+	s := NewScanner()
+	if workers > 0 {
+		s.workerCount = workers
+	}
+	return s
+}
+
+// WithBudget makes the scanner's workers share b with every other scanner
+// using it, so concurrent scans together stay within b's size.
+func (s *Scanner) WithBudget(b *WorkerBudget) *Scanner {
+	s.budget = b
+	return s
+}
+
+// WithCache makes Scan read metrics from c and store the ones it computes.
+// Scans of ranges larger than the cache fall back to evaluating every nonce.
+func (s *Scanner) WithCache(c *MetricCache) *Scanner {
+	s.cache = c
+	return s
+}
+
 // Scan performs a parallel scan across the specified nonce range
 func (s *Scanner) Scan(ctx context.Context, req ScanRequest) (*ScanResult, error) {
 	game, exists := games.GetGame(req.Game)
 	if !exists {
 		return nil, ErrGameNotFound
 	}
+	if req.TargetOp.IsRanked() && req.Limit <= 0 {
+		return nil, ErrInvalidLimit
+	}
 
 	// Setup timeout context if specified
 	if req.TimeoutMs > 0 {
@@ -175,12 +213,21 @@ func (s *Scanner) Scan(ctx context.Context, req ScanRequest) (*ScanResult, error
 	// Create target evaluator
 	evaluator := NewTargetEvaluator(req.TargetOp, req.TargetVal, req.TargetVal2, tolerance)
 
+	if s.cache != nil {
+		if result, ok := s.scanCached(ctx, game, req, evaluator); ok {
+			result.EngineVersion = EngineVersion
+			result.Echo = req
+			return result, nil
+		}
+	}
+
 	// Create job and result channels
 	jobs := make(chan ScanJob, s.workerCount*2) // Buffer for smooth job distribution
 	hits := make(chan Hit, 1000)               // Buffer for hit collection
 	
 	var totalEvaluated uint64
 	var wg sync.WaitGroup
+	var rankedParts []*rankedHits
 
 	// Start workers
 	for i := 0; i < s.workerCount; i++ {
@@ -193,8 +240,13 @@ func (s *Scanner) Scan(ctx context.Context, req ScanRequest) (*ScanResult, error
 			params:    req.Params,
 			evaluator: evaluator,
 			floatPool: s.floatPool,
+			budget:    s.budget,
 			evaluated: &totalEvaluated,
 		}
+		if req.TargetOp.IsRanked() {
+			worker.ranked = newRankedHits(req.TargetOp, req.Limit)
+			rankedParts = append(rankedParts, worker.ranked)
+		}
 		
 		wg.Add(1)
 		go worker.Run(ctx, &wg)
@@ -211,9 +263,21 @@ func (s *Scanner) Scan(ctx context.Context, req ScanRequest) (*ScanResult, error
 	}
 	
 	result := resultCollector.Collect(ctx, &wg)
+
+	if req.TargetOp.IsRanked() {
+		// Workers stop at the next nonce once the context is done; wait for
+		// them so their heaps are no longer being written.
+		wg.Wait()
+		result.Hits = mergeRanked(req.TargetOp, req.Limit, rankedParts)
+		metrics := make([]float64, len(result.Hits))
+		for i, hit := range result.Hits {
+			metrics[i] = hit.Metric
+		}
+		result.Summary = resultCollector.calculateSummary(metrics, atomic.LoadUint64(&totalEvaluated), result.Summary.TimedOut)
+	}
 	
 	// Add metadata
-	result.EngineVersion = "go-1.0.0"
+	result.EngineVersion = EngineVersion
 	result.Echo = req
 	
 	return result, nil
@@ -231,8 +295,11 @@ func (sw *ScanWorker) Run(ctx context.Context, wg *sync.WaitGroup) {
 			if !ok {
 				return // Channel closed, worker should exit
 			}
-			
+			if !sw.budget.acquire(ctx) {
+				return
+			}
 			sw.processJob(ctx, job, floatsNeeded)
+			sw.budget.release()
 			
 		case <-ctx.Done():
 			return
@@ -276,17 +343,21 @@ func (sw *ScanWorker) processJob(ctx context.Context, job ScanJob, floatsNeeded
 		// Increment evaluated counter atomically
 		atomic.AddUint64(sw.evaluated, 1)
 		
+		if sw.ranked != nil {
+			sw.ranked.offer(Hit{Nonce: nonce, Metric: result.Metric})
+			continue
+		}
+		
 		// Check if metric matches target
 		if sw.evaluator.Matches(result.Metric) {
 			// Create hit struct directly without intermediate allocations
 			hit := Hit{Nonce: nonce, Metric: result.Metric}
+			// Block rather than drop the hit when the buffer is full; the
+			// collector drains until every worker is done
 			select {
 			case sw.hits <- hit:
 			case <-ctx.Done():
 				return
-			default:
-				// Channel is full, continue processing but don't block
-				// This ensures workers keep running even if hit collection is slow
 			}
 		}
 	}
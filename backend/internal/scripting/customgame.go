@@ -0,0 +1,281 @@
+package scripting
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/engine"
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+)
+
+const (
+	// customGameCallTimeout bounds a single floatCount() or evaluate() call.
+	customGameCallTimeout = 100 * time.Millisecond
+	customGameMaxFloats   = 1024
+)
+
+// CustomGame is a games.Game whose rules come from a JavaScript definition:
+//
+//	module.exports = {
+//	  spec: { id: "dice-he2", name: "Dice (2% edge)", metricLabel: "roll" },
+//	  floatCount: function (params) { return 1 },
+//	  evaluate: function (floats, params) {
+//	    return { metric: floats[0] * 100, details: { raw: floats[0] } }
+//	  },
+//	}
+//
+// spec, floatCount and evaluate may also be declared as globals. evaluate
+// may return a bare number instead of an object.
+//
+// Definitions run in the same sandbox as user scripts, with Math.random and
+// Date removed so results stay deterministic. goja runtimes are not safe for
+// concurrent use, so each scan worker borrows its own runtime from a pool.
+type CustomGame struct {
+	spec          games.GameSpec
+	program       *goja.Program
+	sourceHash    string
+	defaultFloats int
+	callTimeout   time.Duration
+	pool          sync.Pool
+}
+
+type customGameInstance struct {
+	rt         *goja.Runtime
+	floatCount goja.Callable
+	evaluate   goja.Callable
+}
+
+// CompileCustomGame compiles and validates a custom game definition.
+func CompileCustomGame(source string) (*CustomGame, error) {
+	program, err := goja.Compile("custom_game.js", source, true)
+	if err != nil {
+		return nil, fmt.Errorf("custom game compile error: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(source))
+	g := &CustomGame{
+		program:     program,
+		sourceHash:  hex.EncodeToString(sum[:]),
+		callTimeout: customGameCallTimeout,
+	}
+
+	inst, spec, err := g.instantiate()
+	if err != nil {
+		return nil, err
+	}
+	g.spec = spec
+
+	n, err := inst.callFloatCount(g, nil)
+	if err != nil {
+		return nil, err
+	}
+	g.defaultFloats = n
+	g.pool.Put(inst)
+	return g, nil
+}
+
+// SourceHash returns the SHA-256 of the definition source.
+func (g *CustomGame) SourceHash() string {
+	return g.sourceHash
+}
+
+// Spec returns the metadata declared by the definition.
+func (g *CustomGame) Spec() games.GameSpec {
+	return g.spec
+}
+
+// FloatCount calls the definition's floatCount(params). If the call fails,
+// the count returned for empty params at load time is used.
+func (g *CustomGame) FloatCount(params map[string]any) int {
+	inst, err := g.acquire()
+	if err != nil {
+		return g.defaultFloats
+	}
+	defer g.pool.Put(inst)
+
+	n, err := inst.callFloatCount(g, params)
+	if err != nil {
+		return g.defaultFloats
+	}
+	return n
+}
+
+// Evaluate generates floats and runs the definition's evaluate().
+func (g *CustomGame) Evaluate(seeds games.Seeds, nonce uint64, params map[string]any) (games.GameResult, error) {
+	floats := engine.Floats(seeds.Server, seeds.Client, nonce, 0, g.FloatCount(params))
+	return g.EvaluateWithFloats(floats, params)
+}
+
+// EvaluateWithFloats runs the definition's evaluate() on pre-computed floats.
+func (g *CustomGame) EvaluateWithFloats(floats []float64, params map[string]any) (games.GameResult, error) {
+	inst, err := g.acquire()
+	if err != nil {
+		return games.GameResult{}, err
+	}
+	defer g.pool.Put(inst)
+
+	if params == nil {
+		params = map[string]any{}
+	}
+	val, err := inst.call(g, "evaluate", inst.evaluate, inst.rt.ToValue(floats), inst.rt.ToValue(params))
+	if err != nil {
+		return games.GameResult{}, err
+	}
+
+	result := games.GameResult{MetricLabel: g.spec.MetricLabel}
+	switch exported := val.Export().(type) {
+	case int64:
+		result.Metric = float64(exported)
+	case float64:
+		result.Metric = exported
+	case map[string]any:
+		obj := val.ToObject(inst.rt)
+		metric := obj.Get("metric")
+		if metric == nil || goja.IsUndefined(metric) || goja.IsNull(metric) {
+			return games.GameResult{}, fmt.Errorf("custom game %s: evaluate() result has no metric", g.spec.ID)
+		}
+		result.Metric = metric.ToFloat()
+		if label, ok := exported["metricLabel"].(string); ok && label != "" {
+			result.MetricLabel = label
+		}
+		result.Details = exported["details"]
+	default:
+		return games.GameResult{}, fmt.Errorf("custom game %s: evaluate() must return a number or an object, got %T", g.spec.ID, exported)
+	}
+
+	if math.IsNaN(result.Metric) || math.IsInf(result.Metric, 0) {
+		return games.GameResult{}, fmt.Errorf("custom game %s: evaluate() returned a non-finite metric", g.spec.ID)
+	}
+	return result, nil
+}
+
+func (g *CustomGame) acquire() (*customGameInstance, error) {
+	if inst, ok := g.pool.Get().(*customGameInstance); ok {
+		return inst, nil
+	}
+	inst, _, err := g.instantiate()
+	return inst, err
+}
+
+// instantiate runs the compiled definition in a fresh sandboxed runtime.
+func (g *CustomGame) instantiate() (*customGameInstance, games.GameSpec, error) {
+	rt := goja.New()
+	applySandbox(rt)
+	rt.Set("Date", goja.Undefined())
+	if mathObj := rt.Get("Math"); mathObj != nil {
+		mathObj.ToObject(rt).Set("random", goja.Undefined())
+	}
+
+	module := rt.NewObject()
+	exports := rt.NewObject()
+	module.Set("exports", exports)
+	rt.Set("module", module)
+	rt.Set("exports", exports)
+
+	inst := &customGameInstance{rt: rt}
+	runErr := make(chan error, 1)
+	go func() {
+		_, err := rt.RunProgram(g.program)
+		runErr <- err
+	}()
+	select {
+	case err := <-runErr:
+		if err != nil {
+			return nil, games.GameSpec{}, fmt.Errorf("custom game execution error: %w", err)
+		}
+	case <-time.After(scriptInitTimeout):
+		rt.Interrupt("custom game definition timeout")
+		<-runErr
+		return nil, games.GameSpec{}, fmt.Errorf("custom game definition timed out")
+	}
+
+	lookup := func(name string) goja.Value {
+		if obj := module.Get("exports"); obj != nil && !goja.IsUndefined(obj) && !goja.IsNull(obj) {
+			if v := obj.ToObject(rt).Get(name); v != nil && !goja.IsUndefined(v) {
+				return v
+			}
+		}
+		return rt.Get(name)
+	}
+
+	var ok bool
+	if inst.floatCount, ok = goja.AssertFunction(lookup("floatCount")); !ok {
+		return nil, games.GameSpec{}, fmt.Errorf("custom game must define floatCount(params)")
+	}
+	if inst.evaluate, ok = goja.AssertFunction(lookup("evaluate")); !ok {
+		return nil, games.GameSpec{}, fmt.Errorf("custom game must define evaluate(floats, params)")
+	}
+
+	specVal := lookup("spec")
+	if specVal == nil || goja.IsUndefined(specVal) || goja.IsNull(specVal) {
+		return nil, games.GameSpec{}, fmt.Errorf("custom game must define spec")
+	}
+	specObj := specVal.ToObject(rt)
+	spec := games.GameSpec{
+		ID:          toString(specObj.Get("id")),
+		Name:        toString(specObj.Get("name")),
+		MetricLabel: toString(specObj.Get("metricLabel")),
+	}
+	if spec.ID == "" {
+		return nil, games.GameSpec{}, fmt.Errorf("custom game spec.id is required")
+	}
+	if spec.Name == "" {
+		spec.Name = spec.ID
+	}
+	if spec.MetricLabel == "" {
+		spec.MetricLabel = "metric"
+	}
+	return inst, spec, nil
+}
+
+func (inst *customGameInstance) callFloatCount(g *CustomGame, params map[string]any) (int, error) {
+	if params == nil {
+		params = map[string]any{}
+	}
+	val, err := inst.call(g, "floatCount", inst.floatCount, inst.rt.ToValue(params))
+	if err != nil {
+		return 0, err
+	}
+	n := int(val.ToInteger())
+	if n < 1 || n > customGameMaxFloats {
+		return 0, fmt.Errorf("custom game %s: floatCount() must return 1-%d, got %d", g.spec.ID, customGameMaxFloats, n)
+	}
+	return n, nil
+}
+
+// call invokes fn with the game's per-call time budget.
+func (inst *customGameInstance) call(g *CustomGame, name string, fn goja.Callable, args ...goja.Value) (goja.Value, error) {
+	var mu sync.Mutex
+	finished := false
+	timer := time.AfterFunc(g.callTimeout, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if !finished {
+			inst.rt.Interrupt("custom game time budget exceeded")
+		}
+	})
+
+	val, err := fn(goja.Undefined(), args...)
+
+	mu.Lock()
+	finished = true
+	mu.Unlock()
+	timer.Stop()
+	inst.rt.ClearInterrupt()
+
+	if err != nil {
+		var interrupted *goja.InterruptedError
+		if errors.As(err, &interrupted) {
+			return nil, fmt.Errorf("custom game %s: %s() exceeded its %v time budget", g.spec.ID, name, g.callTimeout)
+		}
+		return nil, fmt.Errorf("custom game %s: %s() error: %w", g.spec.ID, name, err)
+	}
+	return val, nil
+}
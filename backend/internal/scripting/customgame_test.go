@@ -0,0 +1,157 @@
+package scripting
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+)
+
+const testCustomDice = `
+module.exports = {
+	spec: { id: "test-dice", name: "Test Dice", metricLabel: "roll" },
+	floatCount: function (params) { return params.extra ? 2 : 1 },
+	evaluate: function (floats, params) {
+		var roll = Math.floor(floats[0] * 10001) / 100
+		return { metric: roll, details: { raw: floats[0], count: floats.length } }
+	},
+}
+`
+
+func TestCustomGameMatchesBuiltinDice(t *testing.T) {
+	g, err := CompileCustomGame(testCustomDice)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	spec := g.Spec()
+	if spec.ID != "test-dice" || spec.Name != "Test Dice" || spec.MetricLabel != "roll" {
+		t.Errorf("unexpected spec: %+v", spec)
+	}
+	if g.FloatCount(nil) != 1 || g.FloatCount(map[string]any{"extra": true}) != 2 {
+		t.Error("floatCount did not follow params")
+	}
+
+	seeds := games.Seeds{Server: "server", Client: "client"}
+	dice := &games.DiceGame{}
+	for nonce := uint64(1); nonce <= 20; nonce++ {
+		want, _ := dice.Evaluate(seeds, nonce, nil)
+		got, err := g.Evaluate(seeds, nonce, nil)
+		if err != nil {
+			t.Fatalf("nonce %d: evaluate failed: %v", nonce, err)
+		}
+		if got.Metric != want.Metric {
+			t.Errorf("nonce %d: expected %v, got %v", nonce, want.Metric, got.Metric)
+		}
+	}
+}
+
+func TestCustomGameGlobalsAndNumberResult(t *testing.T) {
+	g, err := CompileCustomGame(`
+		var spec = { id: "flip" }
+		function floatCount() { return 1 }
+		function evaluate(floats) { return floats[0] < 0.5 ? 0 : 1 }
+	`)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	res, err := g.EvaluateWithFloats([]float64{0.75}, nil)
+	if err != nil {
+		t.Fatalf("evaluate failed: %v", err)
+	}
+	if res.Metric != 1 || res.MetricLabel != "metric" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
+
+func TestCustomGameConcurrentEvaluation(t *testing.T) {
+	g, err := CompileCustomGame(testCustomDice)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				if _, err := g.EvaluateWithFloats([]float64{0.5}, nil); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCustomGameSandbox(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		errSub string
+	}{
+		{"missing evaluate", `var spec = {id: "x"}; function floatCount() { return 1 }`, "evaluate"},
+		{"missing spec id", `var spec = {}; function floatCount() { return 1 }; function evaluate() { return 1 }`, "spec.id"},
+		{"bad float count", `var spec = {id: "x"}; function floatCount() { return 0 }; function evaluate() { return 1 }`, "floatCount"},
+		{"require blocked", `var fs = require("fs")`, "execution error"},
+		{"math random blocked", `var spec = {id: "x"}; function floatCount() { return Math.random() }; function evaluate() { return 1 }`, "floatCount"},
+		{"syntax error", `function (`, "compile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CompileCustomGame(tt.source)
+			if err == nil || !strings.Contains(err.Error(), tt.errSub) {
+				t.Errorf("expected error containing %q, got %v", tt.errSub, err)
+			}
+		})
+	}
+}
+
+func TestCustomGameTimeBudget(t *testing.T) {
+	g, err := CompileCustomGame(`
+		var spec = { id: "spin" }
+		function floatCount() { return 1 }
+		function evaluate(floats) { if (floats[0] > 0.9) { for (;;) {} } return 1 }
+	`)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if _, err := g.EvaluateWithFloats([]float64{0.95}, nil); err == nil || !strings.Contains(err.Error(), "time budget") {
+		t.Fatalf("expected time budget error, got %v", err)
+	}
+	// The runtime is reusable after an interrupted call.
+	if res, err := g.EvaluateWithFloats([]float64{0.1}, nil); err != nil || res.Metric != 1 {
+		t.Errorf("expected runtime to recover, got %v, %v", res, err)
+	}
+}
+
+func TestCustomGameRegistry(t *testing.T) {
+	g, err := CompileCustomGame(testCustomDice)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if err := games.RegisterCustomGame(g, g.SourceHash()); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	defer games.UnregisterCustomGame("test-dice")
+
+	if _, ok := games.GetGame("test-dice"); !ok {
+		t.Error("custom game not found in registry")
+	}
+	if hash, ok := games.CustomGameHash("test-dice"); !ok || hash != g.SourceHash() {
+		t.Error("expected custom game hash to be recorded")
+	}
+
+	clash, err := CompileCustomGame(`var spec = {id: "dice"}; function floatCount() { return 1 }; function evaluate() { return 1 }`)
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if err := games.RegisterCustomGame(clash, clash.SourceHash()); err == nil {
+		t.Error("expected built-in id conflict")
+	}
+	if games.UnregisterCustomGame("dice") {
+		t.Error("built-in games must not be removable")
+	}
+}
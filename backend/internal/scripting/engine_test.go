@@ -4,6 +4,9 @@ import (
 	"context"
 	"testing"
 	"time"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/games"
+	"github.com/dop251/goja"
 )
 
 // testBetPlacer simulates dice bets for testing.
@@ -208,3 +211,25 @@ func TestEngineGetLogs(t *testing.T) {
 		t.Error("expected log message 'hello from script' in logs")
 	}
 }
+
+func TestSyncFromVMChips(t *testing.T) {
+	vm := goja.New()
+	vars := NewVariables(NewStatistics(0))
+	injectVariables(vm, vars)
+
+	if _, err := vm.RunString(`chips = [{value: "number7", amount: 2}, {type: "split", numbers: [1, 2], amount: 0.5}]`); err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	syncFromVM(vm, vars)
+
+	if len(vars.Chips) != 2 || vars.Chips[0]["value"] != "number7" {
+		t.Fatalf("expected script chips to sync back, got %v", vars.Chips)
+	}
+	bets, err := games.ParseRouletteChips(vars.Chips)
+	if err != nil {
+		t.Fatalf("parse synced chips: %v", err)
+	}
+	if bets[0].Amount != 2 || len(bets[1].Numbers) != 2 {
+		t.Errorf("unexpected bets: %+v", bets)
+	}
+}
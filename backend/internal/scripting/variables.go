@@ -161,6 +161,9 @@ func syncFromVM(vm *goja.Runtime, vars *Variables) {
 	// HiLo
 	vars.HiLoGuess = toNullableInt(vm.Get("hiloguess"))
 
+	// Roulette
+	vars.Chips = toChips(vm.Get("chips"))
+
 	// Blackjack
 	vars.Action = toString(vm.Get("action"))
 	vars.NextActions = toString(vm.Get("nextactions"))
@@ -364,3 +367,22 @@ func toIntSlice(v goja.Value) []int {
 	}
 	return result
 }
+
+// toChips exports a JS array of chip objects. Entries that are not objects
+// are dropped; chip fields are validated when the layout is parsed.
+func toChips(v goja.Value) []map[string]interface{} {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil
+	}
+	list, ok := v.Export().([]interface{})
+	if !ok {
+		return nil
+	}
+	chips := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		if chip, ok := item.(map[string]interface{}); ok {
+			chips = append(chips, chip)
+		}
+	}
+	return chips
+}
@@ -97,12 +97,17 @@ func (vm *VM) injectGlobalFunctions() {
 	})
 
 	// Math is already available in goja by default.
-	// Block dangerous globals.
-	vm.runtime.Set("require", goja.Undefined())
-	vm.runtime.Set("fetch", goja.Undefined())
-	vm.runtime.Set("XMLHttpRequest", goja.Undefined())
-	vm.runtime.Set("eval", goja.Undefined())
-	vm.runtime.Set("Function", goja.Undefined())
+	applySandbox(vm.runtime)
+}
+
+// applySandbox blocks globals that would let a script load code or reach
+// the network.
+func applySandbox(rt *goja.Runtime) {
+	rt.Set("require", goja.Undefined())
+	rt.Set("fetch", goja.Undefined())
+	rt.Set("XMLHttpRequest", goja.Undefined())
+	rt.Set("eval", goja.Undefined())
+	rt.Set("Function", goja.Undefined())
 }
 
 // Execute runs user script source code. This should be called once at the
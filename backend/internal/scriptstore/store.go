@@ -374,3 +374,118 @@ func (s *Store) DeleteSession(id string) error {
 	}
 	return nil
 }
+
+// ListAllBets returns every bet of a session in nonce order.
+func (s *Store) ListAllBets(sessionID string) ([]ScriptBet, error) {
+	rows, err := s.db.Query(
+		`SELECT id, session_id, nonce, amount, payout, payout_multi, win, roll, created_at
+		 FROM script_bets WHERE session_id = ? ORDER BY nonce, id`,
+		sessionID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("scriptstore: list bets: %w", err)
+	}
+	defer rows.Close()
+
+	var bets []ScriptBet
+	for rows.Next() {
+		b := ScriptBet{}
+		if err := rows.Scan(&b.ID, &b.SessionID, &b.Nonce, &b.Amount, &b.Payout, &b.PayoutMulti, &b.Win, &b.Roll, &b.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scriptstore: scan bet: %w", err)
+		}
+		bets = append(bets, b)
+	}
+	return bets, rows.Err()
+}
+
+// FindSession returns the ID of a stored session with the same game,
+// currency, mode, script and start time as sess, or "" if there is none.
+// Imports use it to recognise sessions they have already brought in.
+func (s *Store) FindSession(sess *ScriptSession) (string, error) {
+	rows, err := s.db.Query(
+		`SELECT id, created_at FROM script_sessions
+		 WHERE game = ? AND currency = ? AND mode = ? AND script_source = ?`,
+		sess.Game, sess.Currency, sess.Mode, sess.ScriptSource,
+	)
+	if err != nil {
+		return "", fmt.Errorf("scriptstore: find session: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var createdAt time.Time
+		if err := rows.Scan(&id, &createdAt); err != nil {
+			return "", fmt.Errorf("scriptstore: scan session: %w", err)
+		}
+		// created_at defaults to CURRENT_TIMESTAMP, which has second precision
+		if createdAt.Unix() == sess.CreatedAt.Unix() {
+			return id, nil
+		}
+	}
+	return "", rows.Err()
+}
+
+// ImportSession inserts a session recorded elsewhere, keeping its start
+// and end times and final stats. A new ID is assigned when sess.ID is empty.
+func (s *Store) ImportSession(sess *ScriptSession) error {
+	if sess.ID == "" {
+		sess.ID = uuid.NewString()
+	}
+	var endedAt any
+	if sess.EndedAt != nil {
+		endedAt = sess.EndedAt.UTC()
+	}
+	_, err := s.db.Exec(
+		`INSERT INTO script_sessions (
+			id, name, game, currency, mode, script_source, start_balance, final_balance,
+			created_at, ended_at, final_state, total_bets, total_wins, total_losses,
+			total_profit, total_wagered, highest_streak, lowest_streak
+		 ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sess.ID, sess.Name, sess.Game, sess.Currency, sess.Mode, sess.ScriptSource,
+		sess.StartBalance, sess.FinalBalance,
+		sess.CreatedAt.UTC().Format("2006-01-02 15:04:05"), endedAt, sess.FinalState,
+		sess.TotalBets, sess.TotalWins, sess.TotalLosses,
+		sess.TotalProfit, sess.TotalWagered, sess.HighestStreak, sess.LowestStreak,
+	)
+	if err != nil {
+		return fmt.Errorf("scriptstore: import session: %w", err)
+	}
+	return nil
+}
+
+// ImportBets adds the bets whose nonce the session doesn't have yet and
+// returns how many were added. Bets keep their original timestamps.
+func (s *Store) ImportBets(sessionID string, bets []ScriptBet) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("scriptstore: begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(
+		`INSERT INTO script_bets (session_id, nonce, amount, payout, payout_multi, win, roll, created_at)
+		 SELECT ?, ?, ?, ?, ?, ?, ?, ?
+		 WHERE NOT EXISTS (SELECT 1 FROM script_bets WHERE session_id = ? AND nonce = ?)`,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("scriptstore: prepare: %w", err)
+	}
+	defer stmt.Close()
+
+	added := 0
+	for _, b := range bets {
+		res, err := stmt.Exec(sessionID, b.Nonce, b.Amount, b.Payout, b.PayoutMulti, b.Win, b.Roll,
+			b.CreatedAt.UTC().Format("2006-01-02 15:04:05"), sessionID, b.Nonce)
+		if err != nil {
+			return 0, fmt.Errorf("scriptstore: import bet #%d: %w", b.Nonce, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("scriptstore: commit: %w", err)
+	}
+	return added, nil
+}
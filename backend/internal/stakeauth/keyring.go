@@ -10,6 +10,8 @@ import (
 	"sync"
 
 	"github.com/zalando/go-keyring"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/atrest"
 )
 
 const (
@@ -23,6 +25,7 @@ const (
 type KeyringStore struct {
 	service      string
 	fallbackPath string
+	cipher       *atrest.Cipher // seals fallback file values; nil writes them as plain JSON
 	mu           sync.Mutex
 }
 
@@ -37,6 +40,14 @@ func NewKeyringStore(serviceName, fallbackPath string) *KeyringStore {
 	}
 }
 
+// SetCipher seals secrets written to the fallback file with c. Existing
+// plaintext entries stay readable until ResealFallback rewrites them.
+func (k *KeyringStore) SetCipher(c *atrest.Cipher) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.cipher = c
+}
+
 func (k *KeyringStore) key(accountID, part string) string {
 	return fmt.Sprintf("%s/%s", accountID, part)
 }
@@ -147,10 +158,14 @@ func (k *KeyringStore) setFallback(accountID, part, value string) error {
 	if err != nil {
 		return err
 	}
+	sealed, err := k.cipher.Seal(value)
+	if err != nil {
+		return fmt.Errorf("stakeauth: seal fallback secret: %w", err)
+	}
 	if _, ok := data[accountID]; !ok {
 		data[accountID] = map[string]string{}
 	}
-	data[accountID][part] = value
+	data[accountID][part] = sealed
 	return k.writeFallbackUnlocked(data)
 }
 
@@ -173,7 +188,50 @@ func (k *KeyringStore) getFallback(accountID, part string) (string, error) {
 	if !ok {
 		return "", keyring.ErrNotFound
 	}
-	return val, nil
+	plain, err := k.cipher.Open(val)
+	if err != nil {
+		return "", fmt.Errorf("stakeauth: open fallback secret: %w", err)
+	}
+	return plain, nil
+}
+
+// ResealFallback encrypts fallback file entries that are plaintext or
+// sealed under an older key, and returns how many it changed.
+func (k *KeyringStore) ResealFallback() (int, error) {
+	if strings.TrimSpace(k.fallbackPath) == "" {
+		return 0, nil
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.cipher == nil {
+		return 0, nil
+	}
+
+	data, err := k.readFallbackUnlocked()
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	for _, parts := range data {
+		for part, val := range parts {
+			if k.cipher.Current(val) {
+				continue
+			}
+			sealed, err := k.cipher.Reseal(val)
+			if err != nil {
+				return 0, fmt.Errorf("stakeauth: reseal fallback secret: %w", err)
+			}
+			parts[part] = sealed
+			changed++
+		}
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+	if err := k.writeFallbackUnlocked(data); err != nil {
+		return 0, err
+	}
+	return changed, nil
 }
 
 func (k *KeyringStore) deleteFallbackAccount(accountID string) error {
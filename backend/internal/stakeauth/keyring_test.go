@@ -1,8 +1,12 @@
 package stakeauth
 
 import (
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/atrest"
 )
 
 func TestKeyringStoreSetGetDelete(t *testing.T) {
@@ -47,3 +51,42 @@ func TestKeyringStoreSetGetDelete(t *testing.T) {
 		t.Fatalf("DeleteAll: %v", err)
 	}
 }
+
+func TestKeyringStoreFallbackSealing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fallback_secrets.json")
+	k := NewKeyringStore("wen-desktop-test", path)
+
+	// Written before encryption was enabled
+	if err := k.setFallback("acc", "api_key", "api-key-123"); err != nil {
+		t.Fatalf("setFallback: %v", err)
+	}
+
+	key, _ := atrest.NewKey()
+	cipher, err := atrest.NewCipher(key)
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+	k.SetCipher(cipher)
+	if err := k.setFallback("acc", "clearance", "cf-token-456"); err != nil {
+		t.Fatalf("setFallback: %v", err)
+	}
+
+	n, err := k.ResealFallback()
+	if err != nil || n != 1 {
+		t.Fatalf("ResealFallback = %d, %v", n, err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read fallback file: %v", err)
+	}
+	if strings.Contains(string(raw), "api-key-123") || strings.Contains(string(raw), "cf-token-456") {
+		t.Fatalf("fallback file holds plaintext secrets: %s", raw)
+	}
+
+	for part, want := range map[string]string{"api_key": "api-key-123", "clearance": "cf-token-456"} {
+		got, err := k.getFallback("acc", part)
+		if err != nil || got != want {
+			t.Errorf("%s = %q, %v", part, got, err)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidTag is returned for tags that are too long or contain commas
+var ErrInvalidTag = errors.New("invalid tag")
+
+const maxTagLength = 64
+
+// Annotation is the user-facing metadata of a run or a hit
+type Annotation struct {
+	Name    string   `json:"name"`
+	Notes   string   `json:"notes"`
+	Tags    []string `json:"tags"`
+	Starred bool     `json:"starred"`
+}
+
+// IsZero reports whether the annotation carries nothing
+func (a Annotation) IsZero() bool {
+	return a.Name == "" && a.Notes == "" && len(a.Tags) == 0 && !a.Starred
+}
+
+// HitAnnotation annotates one hit of a run. Hits are addressed by nonce, so
+// annotations survive hits being re-saved when a scan resumes.
+type HitAnnotation struct {
+	RunID string `json:"run_id"`
+	Nonce uint64 `json:"nonce"`
+	Annotation
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TagCount is an entry of the tag index
+type TagCount struct {
+	Tag  string `json:"tag"`
+	Runs int    `json:"runs"`
+	Hits int    `json:"hits"`
+}
+
+// NormalizeTags trims and lowercases tags, turns inner whitespace into
+// dashes, and drops empties and duplicates. The result is sorted.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), "-"))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength || strings.Contains(tag, ",") {
+			return nil, fmt.Errorf("%w: %q (at most %d characters, no commas)", ErrInvalidTag, tag, maxTagLength)
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// execer is satisfied by *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// replaceRunTags sets the tags of a run
+func replaceRunTags(db execer, runID string, tags []string) error {
+	if _, err := db.Exec("DELETE FROM run_tags WHERE run_id = ?", runID); err != nil {
+		return fmt.Errorf("failed to clear run tags: %w", err)
+	}
+	for _, tag := range tags {
+		if _, err := db.Exec("INSERT INTO run_tags (run_id, tag) VALUES (?, ?)", runID, tag); err != nil {
+			return fmt.Errorf("failed to save run tag: %w", err)
+		}
+	}
+	return nil
+}
+
+// AnnotateRun replaces the name, notes, tags and starred flag of a run.
+// UpdateRun leaves these alone, so a scan finishing in the background does
+// not overwrite notes made while it ran.
+func (s *SQLiteDB) AnnotateRun(runID string, a Annotation) error {
+	tags, err := NormalizeTags(a.Tags)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	starred := 0
+	if a.Starred {
+		starred = 1
+	}
+	res, err := tx.Exec("UPDATE runs SET name = ?, notes = ?, starred = ? WHERE id = ?",
+		nullableString(a.Name), nullableString(a.Notes), starred, runID)
+	if err != nil {
+		return fmt.Errorf("failed to annotate run: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("run %s: %w", runID, sql.ErrNoRows)
+	}
+	if err := replaceRunTags(tx, runID, tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AnnotateHit replaces the annotation of the hit at nonce. A zero
+// annotation removes it.
+func (s *SQLiteDB) AnnotateHit(runID string, nonce uint64, a Annotation) error {
+	tags, err := NormalizeTags(a.Tags)
+	if err != nil {
+		return err
+	}
+	a.Tags = tags
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM hit_tags WHERE run_id = ? AND nonce = ?", runID, nonce); err != nil {
+		return fmt.Errorf("failed to clear hit tags: %w", err)
+	}
+	if a.IsZero() {
+		if _, err := tx.Exec("DELETE FROM hit_annotations WHERE run_id = ? AND nonce = ?", runID, nonce); err != nil {
+			return fmt.Errorf("failed to delete hit annotation: %w", err)
+		}
+		return tx.Commit()
+	}
+
+	var exists int
+	err = tx.QueryRow("SELECT COUNT(*) FROM hits WHERE run_id = ? AND nonce = ?", runID, nonce).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to look up hit: %w", err)
+	}
+	if exists == 0 {
+		return fmt.Errorf("run %s has no hit at nonce %d: %w", runID, nonce, sql.ErrNoRows)
+	}
+
+	starred := 0
+	if a.Starred {
+		starred = 1
+	}
+	_, err = tx.Exec(`INSERT INTO hit_annotations (run_id, nonce, name, notes, starred, updated_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (run_id, nonce) DO UPDATE SET
+			name = excluded.name, notes = excluded.notes, starred = excluded.starred,
+			updated_at = excluded.updated_at`,
+		runID, nonce, a.Name, a.Notes, starred)
+	if err != nil {
+		return fmt.Errorf("failed to save hit annotation: %w", err)
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT INTO hit_tags (run_id, nonce, tag) VALUES (?, ?, ?)", runID, nonce, tag); err != nil {
+			return fmt.Errorf("failed to save hit tag: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ListHitAnnotations returns hit annotations in nonce order. runID and tag
+// narrow the list when set; with only a tag it searches every run.
+func (s *SQLiteDB) ListHitAnnotations(runID, tag string) ([]HitAnnotation, error) {
+	var conds []string
+	var args []any
+	if runID != "" {
+		conds = append(conds, "a.run_id = ?")
+		args = append(args, runID)
+	}
+	if tag != "" {
+		tags, err := NormalizeTags([]string{tag})
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, "EXISTS (SELECT 1 FROM hit_tags t WHERE t.run_id = a.run_id AND t.nonce = a.nonce AND t.tag = ?)")
+		args = append(args, tags[0])
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	rows, err := s.db.Query(`SELECT a.run_id, a.nonce, a.name, a.notes, a.starred, a.updated_at,
+			(SELECT group_concat(tag, ',') FROM hit_tags t WHERE t.run_id = a.run_id AND t.nonce = a.nonce)
+		FROM hit_annotations a `+where+`
+		ORDER BY a.run_id, a.nonce`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query hit annotations: %w", err)
+	}
+	defer rows.Close()
+
+	annotations := []HitAnnotation{}
+	for rows.Next() {
+		var ha HitAnnotation
+		var starred int
+		var tags sql.NullString
+		if err := rows.Scan(&ha.RunID, &ha.Nonce, &ha.Name, &ha.Notes, &starred, &ha.UpdatedAt, &tags); err != nil {
+			return nil, fmt.Errorf("failed to scan hit annotation: %w", err)
+		}
+		ha.Starred = starred == 1
+		ha.Tags = []string{}
+		if tags.Valid && tags.String != "" {
+			ha.Tags = strings.Split(tags.String, ",")
+			sort.Strings(ha.Tags)
+		}
+		annotations = append(annotations, ha)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating hit annotations: %w", err)
+	}
+	return annotations, nil
+}
+
+// ListTags returns every tag in use with the number of runs and hits
+// carrying it, most used first.
+func (s *SQLiteDB) ListTags() ([]TagCount, error) {
+	rows, err := s.db.Query(`SELECT tag, SUM(runs), SUM(hits) FROM (
+			SELECT tag, 1 AS runs, 0 AS hits FROM run_tags
+			UNION ALL
+			SELECT tag, 0, 1 FROM hit_tags
+		)
+		GROUP BY tag
+		ORDER BY SUM(runs) + SUM(hits) DESC, tag`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var tc TagCount
+		if err := rows.Scan(&tc.Tag, &tc.Runs, &tc.Hits); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tags: %w", err)
+	}
+	return tags, nil
+}
+
+// attachRunTags fills in the Tags of runs
+func (s *SQLiteDB) attachRunTags(runs []Run) error {
+	if len(runs) == 0 {
+		return nil
+	}
+	index := make(map[string]*Run, len(runs))
+	for i := range runs {
+		index[runs[i].ID] = &runs[i]
+	}
+
+	// Stay well below SQLite's bound parameter limit
+	const chunk = 500
+	for start := 0; start < len(runs); start += chunk {
+		end := min(start+chunk, len(runs))
+		args := make([]any, 0, end-start)
+		for _, run := range runs[start:end] {
+			args = append(args, run.ID)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")
+
+		rows, err := s.db.Query("SELECT run_id, tag FROM run_tags WHERE run_id IN ("+placeholders+") ORDER BY tag", args...)
+		if err != nil {
+			return fmt.Errorf("failed to query run tags: %w", err)
+		}
+		for rows.Next() {
+			var runID, tag string
+			if err := rows.Scan(&runID, &tag); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan run tag: %w", err)
+			}
+			if run := index[runID]; run != nil {
+				run.Tags = append(run.Tags, tag)
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("error iterating run tags: %w", err)
+		}
+	}
+	return nil
+}
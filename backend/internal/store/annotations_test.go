@@ -0,0 +1,221 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func newAnnotationTestDB(t *testing.T) *SQLiteDB {
+	t.Helper()
+	db, err := NewSQLiteDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	return db
+}
+
+func TestAnnotateRun(t *testing.T) {
+	db := newAnnotationTestDB(t)
+
+	run := &Run{ID: "run1", Game: "pump", ClientSeed: "c", TargetOp: "ge", TargetVal: 10, EngineVersion: "1.0.0"}
+	if err := db.SaveRun(run); err != nil {
+		t.Fatalf("Failed to save run: %v", err)
+	}
+	other := &Run{ID: "run2", Game: "dice", ClientSeed: "c", TargetOp: "ge", TargetVal: 99, EngineVersion: "1.0.0"}
+	if err := db.SaveRun(other); err != nil {
+		t.Fatalf("Failed to save run: %v", err)
+	}
+
+	err := db.AnnotateRun("run1", Annotation{
+		Name:    "Hard pump sweep",
+		Notes:   "Check the 3200x cluster near 40k",
+		Tags:    []string{"Cluster", " pump  hard ", "cluster"},
+		Starred: true,
+	})
+	if err != nil {
+		t.Fatalf("AnnotateRun failed: %v", err)
+	}
+
+	got, err := db.GetRun("run1")
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if got.Name != "Hard pump sweep" || got.Notes != "Check the 3200x cluster near 40k" || !got.Starred {
+		t.Errorf("Annotation not stored: %+v", got)
+	}
+	if !reflect.DeepEqual(got.Tags, []string{"cluster", "pump-hard"}) {
+		t.Errorf("Expected normalized tags, got %v", got.Tags)
+	}
+
+	// A scan finishing later must not clear the annotation
+	got.HitCount = 12
+	got.Name, got.Notes, got.Tags, got.Starred = "", "", nil, false
+	if err := db.UpdateRun(got); err != nil {
+		t.Fatalf("UpdateRun failed: %v", err)
+	}
+	got, err = db.GetRun("run1")
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if got.HitCount != 12 || got.Name != "Hard pump sweep" || len(got.Tags) != 2 || !got.Starred {
+		t.Errorf("UpdateRun changed the annotation: %+v", got)
+	}
+
+	starred := true
+	for name, query := range map[string]RunsQuery{
+		"tag":           {Tags: []string{"CLUSTER"}},
+		"all tags":      {Tags: []string{"cluster", "pump-hard"}},
+		"starred":       {Starred: &starred},
+		"text in notes": {Text: "3200x"},
+		"text in name":  {Text: "sweep"},
+		"text in tag":   {Text: "pump-h"},
+	} {
+		list, err := db.ListRuns(query)
+		if err != nil {
+			t.Fatalf("%s: ListRuns failed: %v", name, err)
+		}
+		if list.TotalCount != 1 || list.Runs[0].ID != "run1" || len(list.Runs[0].Tags) != 2 {
+			t.Errorf("%s: expected only run1 with its tags, got %+v", name, list.Runs)
+		}
+	}
+	list, err := db.ListRuns(RunsQuery{Tags: []string{"cluster", "dice"}})
+	if err != nil {
+		t.Fatalf("ListRuns failed: %v", err)
+	}
+	if list.TotalCount != 0 {
+		t.Errorf("Tags should combine with AND, got %+v", list.Runs)
+	}
+
+	if err := db.AnnotateRun("run1", Annotation{Tags: []string{"a,b"}}); !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("Expected ErrInvalidTag, got %v", err)
+	}
+	if err := db.AnnotateRun("missing", Annotation{Name: "x"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for a missing run, got %v", err)
+	}
+
+	// Clearing the annotation removes the tags too
+	if err := db.AnnotateRun("run1", Annotation{}); err != nil {
+		t.Fatalf("AnnotateRun failed: %v", err)
+	}
+	got, err = db.GetRun("run1")
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if got.Name != "" || got.Notes != "" || got.Tags != nil || got.Starred {
+		t.Errorf("Annotation not cleared: %+v", got)
+	}
+}
+
+func TestSaveRunKeepsAnnotation(t *testing.T) {
+	db := newAnnotationTestDB(t)
+
+	// Imported runs arrive with their annotation already set
+	run := &Run{ID: "imported", Game: "limbo", ServerSeed: "s", ClientSeed: "c", TargetOp: "ge", TargetVal: 2, EngineVersion: "1.0.0",
+		Name: "From Sam", Notes: "see thread", Tags: []string{"Shared", "limbo"}, Starred: true}
+	if err := db.SaveRun(run); err != nil {
+		t.Fatalf("Failed to save run: %v", err)
+	}
+
+	got, err := db.GetRun("imported")
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if got.Name != "From Sam" || got.Notes != "see thread" || !got.Starred || !reflect.DeepEqual(got.Tags, []string{"limbo", "shared"}) {
+		t.Errorf("Annotation lost on save: %+v", got)
+	}
+
+	seedRuns, err := db.ListRunsBySeed("", "s", "c")
+	if err != nil {
+		t.Fatalf("ListRunsBySeed failed: %v", err)
+	}
+	if len(seedRuns) != 1 || len(seedRuns[0].Tags) != 2 {
+		t.Errorf("Expected tags on seed group runs, got %+v", seedRuns)
+	}
+}
+
+func TestAnnotateHit(t *testing.T) {
+	db := newAnnotationTestDB(t)
+
+	for _, id := range []string{"run1", "run2"} {
+		if err := db.SaveRun(&Run{ID: id, Game: "limbo", ClientSeed: "c", TargetOp: "ge", TargetVal: 2, EngineVersion: "1.0.0"}); err != nil {
+			t.Fatalf("Failed to save run: %v", err)
+		}
+		hits := []Hit{{Nonce: 5, Metric: 3}, {Nonce: 9, Metric: 7}}
+		if err := db.SaveHits(id, hits); err != nil {
+			t.Fatalf("Failed to save hits: %v", err)
+		}
+	}
+
+	if err := db.AnnotateHit("run1", 9, Annotation{Name: "peak", Tags: []string{"Peak", "verify"}, Starred: true}); err != nil {
+		t.Fatalf("AnnotateHit failed: %v", err)
+	}
+	if err := db.AnnotateHit("run1", 5, Annotation{Notes: "warm-up"}); err != nil {
+		t.Fatalf("AnnotateHit failed: %v", err)
+	}
+	if err := db.AnnotateHit("run2", 5, Annotation{Tags: []string{"peak"}}); err != nil {
+		t.Fatalf("AnnotateHit failed: %v", err)
+	}
+	if err := db.AnnotateHit("run1", 6, Annotation{Name: "no such hit"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for a missing hit, got %v", err)
+	}
+
+	// Annotations are keyed by nonce, so re-saving hits keeps them
+	if err := db.DeleteHitsFrom("run1", 0); err != nil {
+		t.Fatalf("DeleteHitsFrom failed: %v", err)
+	}
+	if err := db.SaveHits("run1", []Hit{{Nonce: 5, Metric: 3}, {Nonce: 9, Metric: 7}}); err != nil {
+		t.Fatalf("Failed to save hits: %v", err)
+	}
+
+	annotations, err := db.ListHitAnnotations("run1", "")
+	if err != nil {
+		t.Fatalf("ListHitAnnotations failed: %v", err)
+	}
+	if len(annotations) != 2 || annotations[0].Nonce != 5 || annotations[1].Nonce != 9 {
+		t.Fatalf("Expected annotations for nonces 5 and 9, got %+v", annotations)
+	}
+	if annotations[0].Notes != "warm-up" || len(annotations[0].Tags) != 0 {
+		t.Errorf("Unexpected annotation: %+v", annotations[0])
+	}
+	if !annotations[1].Starred || !reflect.DeepEqual(annotations[1].Tags, []string{"peak", "verify"}) {
+		t.Errorf("Unexpected annotation: %+v", annotations[1])
+	}
+
+	tagged, err := db.ListHitAnnotations("", "PEAK")
+	if err != nil {
+		t.Fatalf("ListHitAnnotations failed: %v", err)
+	}
+	if len(tagged) != 2 || tagged[0].RunID != "run1" || tagged[1].RunID != "run2" {
+		t.Errorf("Expected peak hits from both runs, got %+v", tagged)
+	}
+
+	if err := db.AnnotateRun("run2", Annotation{Tags: []string{"peak"}}); err != nil {
+		t.Fatalf("AnnotateRun failed: %v", err)
+	}
+	tags, err := db.ListTags()
+	if err != nil {
+		t.Fatalf("ListTags failed: %v", err)
+	}
+	want := []TagCount{{Tag: "peak", Runs: 1, Hits: 2}, {Tag: "verify", Runs: 0, Hits: 1}}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("Expected tag index %+v, got %+v", want, tags)
+	}
+
+	// An empty annotation removes the hit's entry and its tags
+	if err := db.AnnotateHit("run1", 9, Annotation{}); err != nil {
+		t.Fatalf("AnnotateHit failed: %v", err)
+	}
+	tagged, err = db.ListHitAnnotations("", "verify")
+	if err != nil {
+		t.Fatalf("ListHitAnnotations failed: %v", err)
+	}
+	if len(tagged) != 0 {
+		t.Errorf("Expected the verify tag to be gone, got %+v", tagged)
+	}
+}
@@ -11,18 +11,51 @@ type DB interface {
 	SaveRun(run *Run) error
 	UpdateRun(run *Run) error
 	SaveHits(runID string, hits []Hit) error
+	ImportRun(run *Run) (RunImport, error)
 	GetRun(id string) (*Run, error)
 	GetHits(runID string, limit, offset int) ([]Hit, error)
 	ListRuns(query RunsQuery) (*RunsList, error)
 	GetRunHits(runID string, page, perPage int) (*HitsPage, error)
+	EachHit(runID string, fn func(HitWithDelta) error) error
 	ListRunsBySeed(serverSeedHash string, serverSeed string, clientSeed string) ([]Run, error)
+	ListChildRuns(parentRunID string) ([]Run, error)
+	DeleteHitsFrom(runID string, nonce uint64) error
+	AnnotateRun(runID string, a Annotation) error
+	AnnotateHit(runID string, nonce uint64, a Annotation) error
+	ListHitAnnotations(runID, tag string) ([]HitAnnotation, error)
+	ListTags() ([]TagCount, error)
 }
 
-// RunsQuery represents query parameters for listing runs
+// RunImport is a run being saved together with its hits. Nothing is
+// stored unless Commit succeeds.
+type RunImport interface {
+	SaveHits(hits []Hit) error
+	Commit() error
+	Rollback() error
+}
+
+// RunsQuery represents query parameters for listing runs. Every filter is
+// optional and they combine with AND.
 type RunsQuery struct {
-	Game     string `json:"game,omitempty"`
-	Page     int    `json:"page"`
-	PerPage  int    `json:"perPage"`
+	Game           string         `json:"game,omitempty"`
+	ServerSeedHash string         `json:"serverSeedHash,omitempty"` // prefix of the hash
+	ClientSeed     string         `json:"clientSeed,omitempty"`
+	CreatedAfter   *time.Time     `json:"createdAfter,omitempty"`
+	CreatedBefore  *time.Time     `json:"createdBefore,omitempty"`
+	TargetOp       string         `json:"targetOp,omitempty"`
+	TargetValMin   *float64       `json:"targetValMin,omitempty"`
+	TargetValMax   *float64       `json:"targetValMax,omitempty"`
+	HitCountMin    *int           `json:"hitCountMin,omitempty"`
+	HitCountMax    *int           `json:"hitCountMax,omitempty"`
+	TimedOut       *bool          `json:"timedOut,omitempty"`
+	Params         map[string]any `json:"params,omitempty"` // exact matches on top-level params fields, e.g. {"risk": "high"}
+	Tags           []string       `json:"tags,omitempty"`   // runs carrying all of these tags
+	Starred        *bool          `json:"starred,omitempty"`
+	Text           string         `json:"text,omitempty"`      // case-insensitive substring of name, notes, tags, game, client seed or params
+	SortBy         string         `json:"sortBy,omitempty"`    // one of RunSortColumns, default created_at
+	SortOrder      string         `json:"sortOrder,omitempty"` // "asc" or "desc" (default)
+	Page           int            `json:"page"`
+	PerPage        int            `json:"perPage"`
 }
 
 // RunsList represents paginated runs response
@@ -48,6 +81,7 @@ type Run struct {
 	ID             string    `json:"id" db:"id"`
 	Game           string    `json:"game" db:"game"`
 	ServerSeed     string    `json:"server_seed" db:"server_seed"`           // Deprecated: for backward compatibility
+	SeedSealed     bool      `json:"seed_sealed,omitempty"`                  // server seed is encrypted under a key this process doesn't have
 	ServerSeedHash string    `json:"server_seed_hash" db:"server_seed_hash"` // SHA256 hash only
 	ClientSeed     string    `json:"client_seed" db:"client_seed"`
 	NonceStart     uint64    `json:"nonce_start" db:"nonce_start"`
@@ -65,6 +99,12 @@ type Run struct {
 	SummarySum     *float64  `json:"summary_sum" db:"summary_sum"`
 	SummaryCount   int       `json:"summary_count" db:"summary_count"`
 	EngineVersion  string    `json:"engine_version" db:"engine_version"`
+	ParentRunID    string    `json:"parent_run_id,omitempty" db:"parent_run_id"` // set on the per-seed runs of a batch scan
+	Manifest       string    `json:"manifest,omitempty" db:"manifest_json"`      // JSON reproducibility manifest, see internal/repro
+	Name           string    `json:"name,omitempty" db:"name"`
+	Notes          string    `json:"notes,omitempty" db:"notes"`
+	Tags           []string  `json:"tags,omitempty"` // stored in run_tags
+	Starred        bool      `json:"starred" db:"starred"`
 	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 }
 
@@ -74,7 +114,8 @@ type Hit struct {
 	RunID   string  `json:"run_id" db:"run_id"`
 	Nonce   uint64  `json:"nonce" db:"nonce"`
 	Metric  float64 `json:"metric" db:"metric"`
-	Details string  `json:"details" db:"details"` // JSON string
+	Details string  `json:"details" db:"details"`     // JSON string
+	Rank    *int    `json:"rank,omitempty" db:"rank"` // 1-based position in top/bottom runs
 }
 
 // HitWithDelta represents a hit with calculated delta nonce
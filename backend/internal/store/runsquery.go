@@ -0,0 +1,158 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidRunsQuery is returned by ListRuns for an unknown sort column, a
+// malformed params filter or an invalid tag.
+var ErrInvalidRunsQuery = errors.New("invalid runs query")
+
+// RunSortColumns are the columns ListRuns can sort by
+var RunSortColumns = []string{
+	"created_at", "name", "starred", "game", "nonce_start", "nonce_end", "target_val", "hit_count",
+	"total_evaluated", "summary_min", "summary_max", "summary_sum", "summary_count",
+}
+
+var paramKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// runsFilter builds the WHERE clause and arguments for a RunsQuery
+func runsFilter(q RunsQuery) (string, []any, error) {
+	var conds []string
+	var args []any
+
+	if q.Game != "" {
+		conds = append(conds, "game = ?")
+		args = append(args, q.Game)
+	}
+	if q.ServerSeedHash != "" {
+		// A range keeps the prefix match on the server_seed_hash index
+		prefix := strings.ToLower(q.ServerSeedHash)
+		conds = append(conds, "server_seed_hash >= ? AND server_seed_hash < ?")
+		args = append(args, prefix, prefix+"\U0010FFFF")
+	}
+	if q.ClientSeed != "" {
+		conds = append(conds, "client_seed = ?")
+		args = append(args, q.ClientSeed)
+	}
+	if q.CreatedAfter != nil {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, q.CreatedAfter.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if q.CreatedBefore != nil {
+		conds = append(conds, "created_at < ?")
+		args = append(args, q.CreatedBefore.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if q.TargetOp != "" {
+		conds = append(conds, "target_op = ?")
+		args = append(args, q.TargetOp)
+	}
+	if q.TargetValMin != nil {
+		conds = append(conds, "target_val >= ?")
+		args = append(args, *q.TargetValMin)
+	}
+	if q.TargetValMax != nil {
+		conds = append(conds, "target_val <= ?")
+		args = append(args, *q.TargetValMax)
+	}
+	if q.HitCountMin != nil {
+		conds = append(conds, "hit_count >= ?")
+		args = append(args, *q.HitCountMin)
+	}
+	if q.HitCountMax != nil {
+		conds = append(conds, "hit_count <= ?")
+		args = append(args, *q.HitCountMax)
+	}
+	if q.TimedOut != nil {
+		conds = append(conds, "timed_out = ?")
+		if *q.TimedOut {
+			args = append(args, 1)
+		} else {
+			args = append(args, 0)
+		}
+	}
+
+	for key, value := range q.Params {
+		if !paramKeyPattern.MatchString(key) {
+			return "", nil, fmt.Errorf("%w: params key %q", ErrInvalidRunsQuery, key)
+		}
+		switch v := value.(type) {
+		case bool:
+			// json_extract returns JSON booleans as 1 and 0
+			value = 0
+			if v {
+				value = 1
+			}
+		case string, float64, int, int64:
+		default:
+			return "", nil, fmt.Errorf("%w: params value for %q must be a string, number or bool", ErrInvalidRunsQuery, key)
+		}
+		conds = append(conds, "json_extract(params_json, ?) = ?")
+		args = append(args, "$."+key, value)
+	}
+
+	tags, err := NormalizeTags(q.Tags)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidRunsQuery, err)
+	}
+	for _, tag := range tags {
+		conds = append(conds, "EXISTS (SELECT 1 FROM run_tags t WHERE t.run_id = runs.id AND t.tag = ?)")
+		args = append(args, tag)
+	}
+	if q.Starred != nil {
+		conds = append(conds, "starred = ?")
+		if *q.Starred {
+			args = append(args, 1)
+		} else {
+			args = append(args, 0)
+		}
+	}
+
+	if q.Text != "" {
+		pattern := "%" + escapeLike(q.Text) + "%"
+		conds = append(conds, `(name LIKE ? ESCAPE '\' OR notes LIKE ? ESCAPE '\' OR game LIKE ? ESCAPE '\'
+			OR client_seed LIKE ? ESCAPE '\' OR params_json LIKE ? ESCAPE '\'
+			OR EXISTS (SELECT 1 FROM run_tags t WHERE t.run_id = runs.id AND t.tag LIKE ? ESCAPE '\'))`)
+		args = append(args, pattern, pattern, pattern, pattern, pattern, pattern)
+	}
+
+	if len(conds) == 0 {
+		return "", args, nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+// runsOrder builds the ORDER BY clause for a RunsQuery. Newest runs come
+// first by default, and ties are broken by insertion order.
+func runsOrder(q RunsQuery) (string, error) {
+	column := "created_at"
+	if q.SortBy != "" {
+		column = ""
+		for _, c := range RunSortColumns {
+			if c == q.SortBy {
+				column = c
+			}
+		}
+		if column == "" {
+			return "", fmt.Errorf("%w: cannot sort by %q", ErrInvalidRunsQuery, q.SortBy)
+		}
+	}
+
+	dir := "DESC"
+	switch strings.ToLower(q.SortOrder) {
+	case "", "desc":
+	case "asc":
+		dir = "ASC"
+	default:
+		return "", fmt.Errorf("%w: sort order must be asc or desc", ErrInvalidRunsQuery)
+	}
+	// NULL summaries sort last either way
+	return fmt.Sprintf("ORDER BY %s IS NULL, %s %s, rowid %s", column, column, dir, dir), nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -4,15 +4,25 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
 	_ "modernc.org/sqlite"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/atrest"
 )
 
 // SQLiteDB implements the DB interface using SQLite
 type SQLiteDB struct {
-	db *sql.DB
+	db     *sql.DB
+	cipher *atrest.Cipher // seals server_seed; nil stores it as given
+}
+
+// SetCipher makes the store seal server seeds with c. Rows written before
+// stay readable; ResealSeeds encrypts them.
+func (s *SQLiteDB) SetCipher(c *atrest.Cipher) {
+	s.cipher = c
 }
 
 // NewSQLiteDB creates a new SQLite database connection
@@ -73,6 +83,26 @@ func (s *SQLiteDB) Migrate() error {
 		`CREATE INDEX IF NOT EXISTS idx_hits_run_id ON hits(run_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_hits_metric ON hits(run_id, metric)`,
 		`CREATE INDEX IF NOT EXISTS idx_hits_nonce ON hits(run_id, nonce)`,
+		`CREATE TABLE IF NOT EXISTS run_tags (
+			run_id TEXT NOT NULL,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (run_id, tag)
+		)`,
+		`CREATE TABLE IF NOT EXISTS hit_annotations (
+			run_id TEXT NOT NULL,
+			nonce INTEGER NOT NULL,
+			name TEXT NOT NULL DEFAULT '',
+			notes TEXT NOT NULL DEFAULT '',
+			starred INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (run_id, nonce)
+		)`,
+		`CREATE TABLE IF NOT EXISTS hit_tags (
+			run_id TEXT NOT NULL,
+			nonce INTEGER NOT NULL,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (run_id, nonce, tag)
+		)`,
 	}
 
 	for _, migration := range baseMigrations {
@@ -92,6 +122,12 @@ func (s *SQLiteDB) Migrate() error {
 		`ALTER TABLE runs ADD COLUMN summary_max REAL`,
 		`ALTER TABLE runs ADD COLUMN summary_sum REAL`,
 		`ALTER TABLE runs ADD COLUMN summary_count INTEGER DEFAULT 0`,
+		`ALTER TABLE hits ADD COLUMN rank INTEGER`,
+		`ALTER TABLE runs ADD COLUMN parent_run_id TEXT`,
+		`ALTER TABLE runs ADD COLUMN manifest_json TEXT`,
+		`ALTER TABLE runs ADD COLUMN name TEXT`,
+		`ALTER TABLE runs ADD COLUMN notes TEXT`,
+		`ALTER TABLE runs ADD COLUMN starred INTEGER DEFAULT 0`,
 	}
 
 	for _, migration := range alterMigrations {
@@ -109,6 +145,18 @@ func (s *SQLiteDB) Migrate() error {
 		`CREATE INDEX IF NOT EXISTS idx_runs_game ON runs(game)`,
 		`CREATE INDEX IF NOT EXISTS idx_runs_game_created ON runs(game, created_at DESC)`,
 		`CREATE INDEX IF NOT EXISTS idx_hits_run_nonce ON hits(run_id, nonce)`,
+		`DROP INDEX IF EXISTS idx_hits_run_rank`,
+		`CREATE INDEX IF NOT EXISTS idx_hits_run_rank_nonce ON hits(run_id, rank, nonce)`,
+		`CREATE INDEX IF NOT EXISTS idx_runs_parent ON runs(parent_run_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_runs_server_hash ON runs(server_seed_hash)`,
+		`CREATE INDEX IF NOT EXISTS idx_runs_client_seed ON runs(client_seed, created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_runs_target ON runs(target_op, target_val)`,
+		`CREATE INDEX IF NOT EXISTS idx_runs_hit_count ON runs(hit_count)`,
+		`CREATE INDEX IF NOT EXISTS idx_runs_total_evaluated ON runs(total_evaluated)`,
+		`CREATE INDEX IF NOT EXISTS idx_runs_summary_max ON runs(summary_max)`,
+		`CREATE INDEX IF NOT EXISTS idx_runs_starred ON runs(starred)`,
+		`CREATE INDEX IF NOT EXISTS idx_run_tags_tag ON run_tags(tag)`,
+		`CREATE INDEX IF NOT EXISTS idx_hit_tags_tag ON hit_tags(tag)`,
 	}
 
 	for _, migration := range indexMigrations {
@@ -131,58 +179,123 @@ func isDuplicateColumnError(err error) bool {
 		errStr == "SQL logic error: duplicate column name: summary_min (1)" ||
 		errStr == "SQL logic error: duplicate column name: summary_max (1)" ||
 		errStr == "SQL logic error: duplicate column name: summary_sum (1)" ||
-		errStr == "SQL logic error: duplicate column name: summary_count (1)"
+		errStr == "SQL logic error: duplicate column name: summary_count (1)" ||
+		errStr == "SQL logic error: duplicate column name: rank (1)" ||
+		errStr == "SQL logic error: duplicate column name: parent_run_id (1)" ||
+		errStr == "SQL logic error: duplicate column name: manifest_json (1)" ||
+		errStr == "SQL logic error: duplicate column name: name (1)" ||
+		errStr == "SQL logic error: duplicate column name: notes (1)" ||
+		errStr == "SQL logic error: duplicate column name: starred (1)"
+}
+
+// nullableString stores empty strings as NULL
+func nullableString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
 }
 
 // SaveRun saves a scan run to the database
 func (s *SQLiteDB) SaveRun(run *Run) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tags, err := s.insertRun(tx, run)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	run.Tags = tags
+	return nil
+}
+
+// insertRun inserts a run and its tags in tx, giving it an ID if it has
+// none, and returns its normalized tags
+func (s *SQLiteDB) insertRun(tx *sql.Tx, run *Run) ([]string, error) {
 	if run.ID == "" {
 		run.ID = uuid.New().String()
 	}
+	tags, err := NormalizeTags(run.Tags)
+	if err != nil {
+		return nil, err
+	}
+	serverSeed, err := s.cipher.Seal(run.ServerSeed)
+	if err != nil {
+		return nil, err
+	}
 
 	query := `INSERT INTO runs (
 		id, game, server_seed, server_seed_hash, client_seed, nonce_start, nonce_end,
 		params_json, target_op, target_val, tolerance, hit_limit, timed_out,
 		hit_count, total_evaluated, summary_min, summary_max, summary_sum, summary_count,
-		engine_version
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		engine_version, parent_run_id, manifest_json, name, notes, starred, created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+		COALESCE(?, CURRENT_TIMESTAMP))`
 
 	timedOutInt := 0
 	if run.TimedOut {
 		timedOutInt = 1
 	}
+	starredInt := 0
+	if run.Starred {
+		starredInt = 1
+	}
+	// Imported runs keep their original creation time
+	var createdAt any
+	if !run.CreatedAt.IsZero() {
+		createdAt = run.CreatedAt.UTC().Format("2006-01-02 15:04:05")
+	}
 
-	_, err := s.db.Exec(query,
-		run.ID, run.Game, run.ServerSeed, run.ServerSeedHash, run.ClientSeed,
+	_, err = tx.Exec(query,
+		run.ID, run.Game, serverSeed, run.ServerSeedHash, run.ClientSeed,
 		run.NonceStart, run.NonceEnd, run.ParamsJSON, run.TargetOp, run.TargetVal,
 		run.Tolerance, run.HitLimit, timedOutInt, run.HitCount, run.TotalEvaluated,
 		run.SummaryMin, run.SummaryMax, run.SummarySum, run.SummaryCount,
-		run.EngineVersion,
+		run.EngineVersion, nullableString(run.ParentRunID), nullableString(run.Manifest),
+		nullableString(run.Name), nullableString(run.Notes), starredInt, createdAt,
 	)
-
-	return err
+	if err != nil {
+		return nil, err
+	}
+	if err := replaceRunTags(tx, run.ID, tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
 }
 
-// UpdateRun updates an existing run in the database
+// UpdateRun updates an existing run in the database. Annotations are left
+// alone; see AnnotateRun. The server seed of a run loaded with SeedSealed
+// is kept as stored.
 func (s *SQLiteDB) UpdateRun(run *Run) error {
 	query := `UPDATE runs SET 
-		game = ?, server_seed = ?, server_seed_hash = ?, client_seed = ?, 
+		game = ?, server_seed = CASE WHEN ? THEN server_seed ELSE ? END, server_seed_hash = ?, client_seed = ?, 
 		nonce_start = ?, nonce_end = ?, params_json = ?, target_op = ?, target_val = ?, 
 		tolerance = ?, hit_limit = ?, timed_out = ?, hit_count = ?, total_evaluated = ?, 
-		summary_min = ?, summary_max = ?, summary_sum = ?, summary_count = ?, engine_version = ?
+		summary_min = ?, summary_max = ?, summary_sum = ?, summary_count = ?, engine_version = ?,
+		parent_run_id = ?, manifest_json = ?
 		WHERE id = ?`
 
 	timedOutInt := 0
 	if run.TimedOut {
 		timedOutInt = 1
 	}
+	serverSeed, err := s.cipher.Seal(run.ServerSeed)
+	if err != nil {
+		return err
+	}
 
-	_, err := s.db.Exec(query,
-		run.Game, run.ServerSeed, run.ServerSeedHash, run.ClientSeed,
+	_, err = s.db.Exec(query,
+		run.Game, run.SeedSealed, serverSeed, run.ServerSeedHash, run.ClientSeed,
 		run.NonceStart, run.NonceEnd, run.ParamsJSON, run.TargetOp, run.TargetVal,
 		run.Tolerance, run.HitLimit, timedOutInt, run.HitCount, run.TotalEvaluated,
 		run.SummaryMin, run.SummaryMax, run.SummarySum, run.SummaryCount,
-		run.EngineVersion, run.ID,
+		run.EngineVersion, nullableString(run.ParentRunID), nullableString(run.Manifest), run.ID,
 	)
 
 	return err
@@ -200,7 +313,15 @@ func (s *SQLiteDB) SaveHits(runID string, hits []Hit) error {
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare("INSERT INTO hits (run_id, nonce, metric, details) VALUES (?, ?, ?, ?)")
+	if err := insertHits(tx, runID, hits); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertHits inserts hits of a run in tx
+func insertHits(tx *sql.Tx, runID string, hits []Hit) error {
+	stmt, err := tx.Prepare("INSERT INTO hits (run_id, nonce, metric, details, rank) VALUES (?, ?, ?, ?, ?)")
 	if err != nil {
 		return err
 	}
@@ -212,37 +333,73 @@ func (s *SQLiteDB) SaveHits(runID string, hits []Hit) error {
 			detailsJSON = hit.Details
 		}
 
-		_, err := stmt.Exec(runID, hit.Nonce, hit.Metric, detailsJSON)
+		_, err := stmt.Exec(runID, hit.Nonce, hit.Metric, detailsJSON, hit.Rank)
 		if err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	return tx.Commit()
+// ImportRun starts saving run in a transaction that its hits join, so
+// an import that stops part way leaves no run without its hits.
+func (s *SQLiteDB) ImportRun(run *Run) (RunImport, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	tags, err := s.insertRun(tx, run)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	run.Tags = tags
+	return &sqliteRunImport{tx: tx, runID: run.ID}, nil
 }
 
-// GetRun retrieves a run by ID
-func (s *SQLiteDB) GetRun(id string) (*Run, error) {
-	query := `SELECT 
+// sqliteRunImport is a RunImport open on a SQLite transaction
+type sqliteRunImport struct {
+	tx    *sql.Tx
+	runID string
+}
+
+func (i *sqliteRunImport) SaveHits(hits []Hit) error {
+	if len(hits) == 0 {
+		return nil
+	}
+	return insertHits(i.tx, i.runID, hits)
+}
+
+func (i *sqliteRunImport) Commit() error   { return i.tx.Commit() }
+func (i *sqliteRunImport) Rollback() error { return i.tx.Rollback() }
+
+// runColumns lists the runs columns in the order scanRun reads them
+const runColumns = `
 		id, game, server_seed, server_seed_hash, client_seed, nonce_start, nonce_end,
 		params_json, target_op, target_val, tolerance, hit_limit, timed_out,
 		hit_count, total_evaluated, summary_min, summary_max, summary_sum, summary_count,
-		engine_version, created_at
-		FROM runs WHERE id = ?`
+		engine_version, parent_run_id, manifest_json, name, notes, starred, created_at`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
+// scanRun reads a run selected with runColumns and opens its server seed
+func (s *SQLiteDB) scanRun(row rowScanner) (*Run, error) {
 	var run Run
 	var timedOutInt int
-	var serverSeedHash, paramsJSON sql.NullString
+	var starred sql.NullInt64
+	var serverSeedHash, paramsJSON, parentRunID, manifest, name, notes sql.NullString
 	var summaryMin, summaryMax, summarySum sql.NullFloat64
 
-	err := s.db.QueryRow(query, id).Scan(
+	err := row.Scan(
 		&run.ID, &run.Game, &run.ServerSeed, &serverSeedHash, &run.ClientSeed,
 		&run.NonceStart, &run.NonceEnd, &paramsJSON, &run.TargetOp, &run.TargetVal,
 		&run.Tolerance, &run.HitLimit, &timedOutInt, &run.HitCount, &run.TotalEvaluated,
 		&summaryMin, &summaryMax, &summarySum, &run.SummaryCount,
-		&run.EngineVersion, &run.CreatedAt,
+		&run.EngineVersion, &parentRunID, &manifest, &name, &notes, &starred, &run.CreatedAt,
 	)
-
 	if err != nil {
 		return nil, err
 	}
@@ -265,17 +422,122 @@ func (s *SQLiteDB) GetRun(id string) (*Run, error) {
 	if summarySum.Valid {
 		run.SummarySum = &summarySum.Float64
 	}
+	if parentRunID.Valid {
+		run.ParentRunID = parentRunID.String
+	}
+	if manifest.Valid {
+		run.Manifest = manifest.String
+	}
+	if name.Valid {
+		run.Name = name.String
+	}
+	if notes.Valid {
+		run.Notes = notes.String
+	}
+	run.Starred = starred.Valid && starred.Int64 == 1
 
 	run.TimedOut = timedOutInt == 1
 
+	// A seed sealed under a key that isn't loaded stays hidden rather than
+	// failing every query that lists the run
+	if run.ServerSeed, err = s.cipher.Open(run.ServerSeed); errors.Is(err, atrest.ErrUnknownKey) {
+		run.ServerSeed, run.SeedSealed = "", true
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open server seed of run %s: %w", run.ID, err)
+	}
+
 	return &run, nil
 }
 
+// SealedSeeds returns how many runs hold a sealed server seed, which can't
+// be read without the key that sealed it.
+func (s *SQLiteDB) SealedSeeds() (int, error) {
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM runs WHERE server_seed LIKE ?", atrest.SealedPattern).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count sealed seeds: %w", err)
+	}
+	return n, nil
+}
+
+// ResealSeeds encrypts server seeds stored in plaintext or under an older
+// key with the current cipher, and returns how many runs it changed.
+func (s *SQLiteDB) ResealSeeds() (int, error) {
+	if s.cipher == nil {
+		return 0, nil
+	}
+	rows, err := s.db.Query("SELECT id, server_seed FROM runs WHERE server_seed != ''")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query server seeds: %w", err)
+	}
+	stale := map[string]string{}
+	for rows.Next() {
+		var id, seed string
+		if err := rows.Scan(&id, &seed); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan server seed: %w", err)
+		}
+		if !s.cipher.Current(seed) {
+			stale[id] = seed
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, fmt.Errorf("error iterating server seeds: %w", err)
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	for id, seed := range stale {
+		sealed, err := s.cipher.Reseal(seed)
+		if err != nil {
+			return 0, fmt.Errorf("run %s: %w", id, err)
+		}
+		if _, err := tx.Exec("UPDATE runs SET server_seed = ? WHERE id = ?", sealed, id); err != nil {
+			return 0, fmt.Errorf("failed to update server seed: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(stale), nil
+}
+
+// DeleteHitsFrom removes a run's hits at or above nonce
+func (s *SQLiteDB) DeleteHitsFrom(runID string, nonce uint64) error {
+	if _, err := s.db.Exec("DELETE FROM hits WHERE run_id = ? AND nonce >= ?", runID, nonce); err != nil {
+		return fmt.Errorf("failed to delete hits: %w", err)
+	}
+	return nil
+}
+
+// GetRun retrieves a run by ID
+func (s *SQLiteDB) GetRun(id string) (*Run, error) {
+	query := `SELECT ` + runColumns + `
+		FROM runs WHERE id = ?`
+
+	run, err := s.scanRun(s.db.QueryRow(query, id))
+	if err != nil {
+		return nil, err
+	}
+	runs := []Run{*run}
+	if err := s.attachRunTags(runs); err != nil {
+		return nil, err
+	}
+	return &runs[0], nil
+}
+
 // GetHits retrieves hits for a run with pagination
 func (s *SQLiteDB) GetHits(runID string, limit, offset int) ([]Hit, error) {
-	query := `SELECT id, run_id, nonce, metric, details 
+	query := `SELECT id, run_id, nonce, metric, details, rank 
 		FROM hits WHERE run_id = ? 
-		ORDER BY nonce LIMIT ? OFFSET ?`
+		ORDER BY rank, nonce LIMIT ? OFFSET ?`
 
 	rows, err := s.db.Query(query, runID, limit, offset)
 	if err != nil {
@@ -287,8 +549,9 @@ func (s *SQLiteDB) GetHits(runID string, limit, offset int) ([]Hit, error) {
 	for rows.Next() {
 		var hit Hit
 		var details sql.NullString
+		var rank sql.NullInt64
 
-		err := rows.Scan(&hit.ID, &hit.RunID, &hit.Nonce, &hit.Metric, &details)
+		err := rows.Scan(&hit.ID, &hit.RunID, &hit.Nonce, &hit.Metric, &details, &rank)
 		if err != nil {
 			return nil, err
 		}
@@ -296,6 +559,10 @@ func (s *SQLiteDB) GetHits(runID string, limit, offset int) ([]Hit, error) {
 		if details.Valid {
 			hit.Details = details.String
 		}
+		if rank.Valid {
+			r := int(rank.Int64)
+			hit.Rank = &r
+		}
 
 		hits = append(hits, hit)
 	}
@@ -305,19 +572,20 @@ func (s *SQLiteDB) GetHits(runID string, limit, offset int) ([]Hit, error) {
 
 // ListRuns retrieves runs with pagination and filtering
 func (s *SQLiteDB) ListRuns(query RunsQuery) (*RunsList, error) {
-	// Build WHERE clause for filtering
-	whereClause := ""
-	args := []interface{}{}
-
-	if query.Game != "" {
-		whereClause = "WHERE game = ?"
-		args = append(args, query.Game)
+	// Build WHERE and ORDER BY clauses for filtering
+	whereClause, args, err := runsFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	orderClause, err := runsOrder(query)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get total count
 	countQuery := "SELECT COUNT(*) FROM runs " + whereClause
 	var totalCount int
-	err := s.db.QueryRow(countQuery, args...).Scan(&totalCount)
+	err = s.db.QueryRow(countQuery, args...).Scan(&totalCount)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total count: %w", err)
 	}
@@ -334,13 +602,9 @@ func (s *SQLiteDB) ListRuns(query RunsQuery) (*RunsList, error) {
 	offset := (query.Page - 1) * query.PerPage
 
 	// Build main query
-	mainQuery := `SELECT 
-		id, game, server_seed, server_seed_hash, client_seed, nonce_start, nonce_end,
-		params_json, target_op, target_val, tolerance, hit_limit, timed_out,
-		hit_count, total_evaluated, summary_min, summary_max, summary_sum, summary_count,
-		engine_version, created_at
+	mainQuery := `SELECT ` + runColumns + `
 		FROM runs ` + whereClause + `
-		ORDER BY created_at DESC
+		` + orderClause + `
 		LIMIT ? OFFSET ?`
 
 	args = append(args, query.PerPage, offset)
@@ -353,49 +617,20 @@ func (s *SQLiteDB) ListRuns(query RunsQuery) (*RunsList, error) {
 
 	var runs []Run
 	for rows.Next() {
-		var run Run
-		var timedOutInt int
-		var serverSeedHash, paramsJSON sql.NullString
-		var summaryMin, summaryMax, summarySum sql.NullFloat64
-
-		err := rows.Scan(
-			&run.ID, &run.Game, &run.ServerSeed, &serverSeedHash, &run.ClientSeed,
-			&run.NonceStart, &run.NonceEnd, &paramsJSON, &run.TargetOp, &run.TargetVal,
-			&run.Tolerance, &run.HitLimit, &timedOutInt, &run.HitCount, &run.TotalEvaluated,
-			&summaryMin, &summaryMax, &summarySum, &run.SummaryCount,
-			&run.EngineVersion, &run.CreatedAt,
-		)
+		run, err := s.scanRun(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan run: %w", err)
 		}
 
-		// Handle nullable fields
-		if serverSeedHash.Valid {
-			run.ServerSeedHash = serverSeedHash.String
-		}
-		if paramsJSON.Valid {
-			run.ParamsJSON = paramsJSON.String
-		} else {
-			run.ParamsJSON = "{}"
-		}
-		if summaryMin.Valid {
-			run.SummaryMin = &summaryMin.Float64
-		}
-		if summaryMax.Valid {
-			run.SummaryMax = &summaryMax.Float64
-		}
-		if summarySum.Valid {
-			run.SummarySum = &summarySum.Float64
-		}
-
-		run.TimedOut = timedOutInt == 1
-
-		runs = append(runs, run)
+		runs = append(runs, *run)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating runs: %w", err)
 	}
+	if err := s.attachRunTags(runs); err != nil {
+		return nil, err
+	}
 
 	return &RunsList{
 		Runs:       runs,
@@ -417,11 +652,7 @@ func (s *SQLiteDB) ListRunsBySeed(serverSeedHash string, serverSeed string, clie
 		targetHash = computeServerHash(serverSeed)
 	}
 
-	query := `SELECT 
-		id, game, server_seed, server_seed_hash, client_seed, nonce_start, nonce_end,
-		params_json, target_op, target_val, tolerance, hit_limit, timed_out,
-		hit_count, total_evaluated, summary_min, summary_max, summary_sum, summary_count,
-		engine_version, created_at
+	query := `SELECT ` + runColumns + `
 		FROM runs WHERE client_seed = ?
 		ORDER BY created_at DESC`
 
@@ -433,42 +664,11 @@ func (s *SQLiteDB) ListRunsBySeed(serverSeedHash string, serverSeed string, clie
 
 	var runs []Run
 	for rows.Next() {
-		var run Run
-		var timedOutInt int
-		var serverSeedHashSQL, paramsJSON sql.NullString
-		var summaryMin, summaryMax, summarySum sql.NullFloat64
-
-		err := rows.Scan(
-			&run.ID, &run.Game, &run.ServerSeed, &serverSeedHashSQL, &run.ClientSeed,
-			&run.NonceStart, &run.NonceEnd, &paramsJSON, &run.TargetOp, &run.TargetVal,
-			&run.Tolerance, &run.HitLimit, &timedOutInt, &run.HitCount, &run.TotalEvaluated,
-			&summaryMin, &summaryMax, &summarySum, &run.SummaryCount,
-			&run.EngineVersion, &run.CreatedAt,
-		)
+		run, err := s.scanRun(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan run: %w", err)
 		}
 
-		if serverSeedHashSQL.Valid {
-			run.ServerSeedHash = serverSeedHashSQL.String
-		}
-		if paramsJSON.Valid {
-			run.ParamsJSON = paramsJSON.String
-		} else {
-			run.ParamsJSON = "{}"
-		}
-		if summaryMin.Valid {
-			run.SummaryMin = &summaryMin.Float64
-		}
-		if summaryMax.Valid {
-			run.SummaryMax = &summaryMax.Float64
-		}
-		if summarySum.Valid {
-			run.SummarySum = &summarySum.Float64
-		}
-
-		run.TimedOut = timedOutInt == 1
-
 		candidateHash := run.ServerSeedHash
 		if candidateHash == "" {
 			candidateHash = computeServerHash(run.ServerSeed)
@@ -477,17 +677,90 @@ func (s *SQLiteDB) ListRunsBySeed(serverSeedHash string, serverSeed string, clie
 		matchesHash := targetHash != "" && candidateHash != "" && candidateHash == targetHash
 		matchesPlain := serverSeed != "" && run.ServerSeed == serverSeed
 		if matchesHash || matchesPlain {
-			runs = append(runs, run)
+			runs = append(runs, *run)
 		}
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating runs by seed: %w", err)
 	}
+	if err := s.attachRunTags(runs); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// ListChildRuns returns the per-seed runs of a batch run in the order they
+// were saved
+func (s *SQLiteDB) ListChildRuns(parentRunID string) ([]Run, error) {
+	query := `SELECT ` + runColumns + `
+		FROM runs WHERE parent_run_id = ?
+		ORDER BY rowid`
+
+	rows, err := s.db.Query(query, parentRunID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query child runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		run, err := s.scanRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan run: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating child runs: %w", err)
+	}
+	if err := s.attachRunTags(runs); err != nil {
+		return nil, err
+	}
 
 	return runs, nil
 }
 
+// EachHit streams a run's hits to fn in the order GetRunHits pages them,
+// with delta nonces filled in. It stops at the first error fn returns.
+func (s *SQLiteDB) EachHit(runID string, fn func(HitWithDelta) error) error {
+	rows, err := s.db.Query(`SELECT id, run_id, nonce, metric, details, rank
+		FROM hits WHERE run_id = ?
+		ORDER BY rank, nonce`, runID)
+	if err != nil {
+		return fmt.Errorf("failed to query hits: %w", err)
+	}
+	defer rows.Close()
+
+	var prev *uint64
+	for rows.Next() {
+		var hit HitWithDelta
+		var details sql.NullString
+		var rank sql.NullInt64
+		if err := rows.Scan(&hit.ID, &hit.RunID, &hit.Nonce, &hit.Metric, &details, &rank); err != nil {
+			return fmt.Errorf("failed to scan hit: %w", err)
+		}
+		hit.Details = details.String
+		if rank.Valid {
+			r := int(rank.Int64)
+			hit.Rank = &r
+		} else {
+			if prev != nil {
+				delta := hit.Nonce - *prev
+				hit.DeltaNonce = &delta
+			}
+			nonce := hit.Nonce
+			prev = &nonce
+		}
+		if err := fn(hit); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 // GetRunHits retrieves hits for a run with server-side pagination and delta nonce calculation
 func (s *SQLiteDB) GetRunHits(runID string, page, perPage int) (*HitsPage, error) {
 	// Get total count
@@ -509,9 +782,10 @@ func (s *SQLiteDB) GetRunHits(runID string, page, perPage int) (*HitsPage, error
 	offset := (page - 1) * perPage
 
 	// Query hits with pagination
-	query := `SELECT id, run_id, nonce, metric, details 
+	// Ranked (top/bottom) runs page in rank order; rank is NULL otherwise.
+	query := `SELECT id, run_id, nonce, metric, details, rank 
 		FROM hits WHERE run_id = ? 
-		ORDER BY nonce 
+		ORDER BY rank, nonce 
 		LIMIT ? OFFSET ?`
 
 	rows, err := s.db.Query(query, runID, perPage, offset)
@@ -524,8 +798,9 @@ func (s *SQLiteDB) GetRunHits(runID string, page, perPage int) (*HitsPage, error
 	for rows.Next() {
 		var hit Hit
 		var details sql.NullString
+		var rank sql.NullInt64
 
-		err := rows.Scan(&hit.ID, &hit.RunID, &hit.Nonce, &hit.Metric, &details)
+		err := rows.Scan(&hit.ID, &hit.RunID, &hit.Nonce, &hit.Metric, &details, &rank)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan hit: %w", err)
 		}
@@ -533,6 +808,10 @@ func (s *SQLiteDB) GetRunHits(runID string, page, perPage int) (*HitsPage, error
 		if details.Valid {
 			hit.Details = details.String
 		}
+		if rank.Valid {
+			r := int(rank.Int64)
+			hit.Rank = &r
+		}
 
 		hits = append(hits, hit)
 	}
@@ -545,6 +824,10 @@ func (s *SQLiteDB) GetRunHits(runID string, page, perPage int) (*HitsPage, error
 	hitsWithDelta := make([]HitWithDelta, len(hits))
 	for i, hit := range hits {
 		hitsWithDelta[i] = HitWithDelta{Hit: hit}
+		if hit.Rank != nil {
+			// Nonce distance has no meaning between ranked hits
+			continue
+		}
 
 		// Calculate delta nonce (distance from previous hit)
 		if i > 0 {
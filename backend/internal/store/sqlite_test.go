@@ -1,7 +1,13 @@
 package store
 
 import (
+	"errors"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/MJE43/stake-pf-replay-go/internal/atrest"
 )
 
 func TestListRuns(t *testing.T) {
@@ -311,6 +317,219 @@ func TestGetRunHits(t *testing.T) {
 	}
 }
 
+func TestGetRunHitsRanked(t *testing.T) {
+	db, err := NewSQLiteDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	run := &Run{
+		ID:             "top-run",
+		Game:           "limbo",
+		ServerSeedHash: "test-hash",
+		ClientSeed:     "test-client",
+		NonceStart:     1,
+		NonceEnd:       1000,
+		TargetOp:       "top",
+		HitLimit:       4,
+		HitCount:       4,
+		TotalEvaluated: 1000,
+		EngineVersion:  "1.0.0",
+	}
+	if err := db.SaveRun(run); err != nil {
+		t.Fatalf("Failed to save run: %v", err)
+	}
+
+	// Saved in rank order: highest metric first, ties by nonce
+	ranked := []Hit{
+		{Nonce: 500, Metric: 20.1},
+		{Nonce: 100, Metric: 18.9},
+		{Nonce: 900, Metric: 18.9},
+		{Nonce: 250, Metric: 12.3},
+	}
+	for i := range ranked {
+		rank := i + 1
+		ranked[i].RunID = "top-run"
+		ranked[i].Rank = &rank
+	}
+	if err := db.SaveHits("top-run", ranked); err != nil {
+		t.Fatalf("Failed to save hits: %v", err)
+	}
+
+	var got []HitWithDelta
+	for page := 1; page <= 2; page++ {
+		result, err := db.GetRunHits("top-run", page, 2)
+		if err != nil {
+			t.Fatalf("Failed to get run hits page %d: %v", page, err)
+		}
+		got = append(got, result.Hits...)
+	}
+
+	if len(got) != len(ranked) {
+		t.Fatalf("Expected %d hits, got %d", len(ranked), len(got))
+	}
+	for i, hit := range got {
+		if hit.Nonce != ranked[i].Nonce {
+			t.Errorf("Rank %d: expected nonce %d, got %d", i+1, ranked[i].Nonce, hit.Nonce)
+		}
+		if hit.Rank == nil || *hit.Rank != i+1 {
+			t.Errorf("Rank %d: unexpected rank %v", i+1, hit.Rank)
+		}
+		if hit.DeltaNonce != nil {
+			t.Errorf("Rank %d: ranked hits should not have a delta nonce", i+1)
+		}
+	}
+}
+
+func TestHitRankOrderUsesIndex(t *testing.T) {
+	db, err := NewSQLiteDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	rows, err := db.db.Query(`EXPLAIN QUERY PLAN SELECT id, run_id, nonce, metric, details, rank
+		FROM hits WHERE run_id = ? ORDER BY rank, nonce LIMIT 10 OFFSET 0`, "run")
+	if err != nil {
+		t.Fatalf("Failed to explain query: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			t.Fatalf("Failed to scan plan: %v", err)
+		}
+		if strings.Contains(detail, "TEMP B-TREE") {
+			t.Errorf("Expected hit order to come from an index, plan step: %s", detail)
+		}
+	}
+}
+
+func TestEachHit(t *testing.T) {
+	db, err := NewSQLiteDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	run := &Run{ID: "each-run", Game: "limbo", TargetOp: ">=", TargetVal: 10, EngineVersion: "1.0.0"}
+	if err := db.SaveRun(run); err != nil {
+		t.Fatalf("Failed to save run: %v", err)
+	}
+	var hits []Hit
+	for i := 0; i < 25; i++ {
+		hits = append(hits, Hit{RunID: "each-run", Nonce: uint64(1000 - i*7), Metric: float64(i), Details: `{"multiplier": 1}`})
+	}
+	if err := db.SaveHits("each-run", hits); err != nil {
+		t.Fatalf("Failed to save hits: %v", err)
+	}
+
+	paged, err := db.GetRunHits("each-run", 1, 100)
+	if err != nil {
+		t.Fatalf("Failed to get run hits: %v", err)
+	}
+	var streamed []HitWithDelta
+	if err := db.EachHit("each-run", func(h HitWithDelta) error {
+		streamed = append(streamed, h)
+		return nil
+	}); err != nil {
+		t.Fatalf("EachHit failed: %v", err)
+	}
+
+	if len(streamed) != len(paged.Hits) {
+		t.Fatalf("Expected %d hits, got %d", len(paged.Hits), len(streamed))
+	}
+	for i, want := range paged.Hits {
+		got := streamed[i]
+		if got.Nonce != want.Nonce || got.Details != want.Details {
+			t.Errorf("Hit %d: expected nonce %d, got %d", i, want.Nonce, got.Nonce)
+		}
+		if (got.DeltaNonce == nil) != (want.DeltaNonce == nil) ||
+			(got.DeltaNonce != nil && *got.DeltaNonce != *want.DeltaNonce) {
+			t.Errorf("Hit %d: expected delta %v, got %v", i, want.DeltaNonce, got.DeltaNonce)
+		}
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = db.EachHit("each-run", func(HitWithDelta) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("Expected EachHit to stop at the first error, got %v after %d calls", err, calls)
+	}
+}
+
+func TestListChildRuns(t *testing.T) {
+	db, err := NewSQLiteDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	parent := &Run{ID: "batch", Game: "limbo", TargetOp: "ge", TargetVal: 2, EngineVersion: "1.0.0"}
+	if err := db.SaveRun(parent); err != nil {
+		t.Fatalf("Failed to save parent run: %v", err)
+	}
+	children := []*Run{
+		{ID: "child-b", Game: "limbo", ServerSeed: "server-b", ServerSeedHash: computeServerHash("server-b"), ClientSeed: "client-b", TargetOp: "ge", TargetVal: 2, EngineVersion: "1.0.0", ParentRunID: "batch"},
+		{ID: "child-a", Game: "limbo", ServerSeed: "server-a", ServerSeedHash: computeServerHash("server-a"), ClientSeed: "client-a", TargetOp: "ge", TargetVal: 2, EngineVersion: "1.0.0", ParentRunID: "batch"},
+	}
+	for _, child := range children {
+		if err := db.SaveRun(child); err != nil {
+			t.Fatalf("Failed to save child run: %v", err)
+		}
+	}
+
+	runs, err := db.ListChildRuns("batch")
+	if err != nil {
+		t.Fatalf("ListChildRuns failed: %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != "child-b" || runs[1].ID != "child-a" {
+		t.Fatalf("Expected children in save order, got %+v", runs)
+	}
+	if runs[0].ParentRunID != "batch" {
+		t.Errorf("Expected parent_run_id batch, got %q", runs[0].ParentRunID)
+	}
+
+	got, err := db.GetRun("batch")
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if got.ParentRunID != "" {
+		t.Errorf("Parent run should have no parent, got %q", got.ParentRunID)
+	}
+
+	// Child runs stay grouped with other runs of the same seeds
+	seedRuns, err := db.ListRunsBySeed(computeServerHash("server-a"), "", "client-a")
+	if err != nil {
+		t.Fatalf("ListRunsBySeed failed: %v", err)
+	}
+	if len(seedRuns) != 1 || seedRuns[0].ID != "child-a" {
+		t.Errorf("Expected child-a in seed group, got %+v", seedRuns)
+	}
+}
+
 func TestServerSeedHashStorage(t *testing.T) {
 	// Create in-memory database for testing
 	db, err := NewSQLiteDB(":memory:")
@@ -359,3 +578,235 @@ func TestServerSeedHashStorage(t *testing.T) {
 		t.Errorf("Expected empty server seed, got %s", retrieved.ServerSeed)
 	}
 }
+
+func TestServerSeedSealing(t *testing.T) {
+	db, err := NewSQLiteDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	rawSeed := func(id string) string {
+		var seed string
+		if err := db.db.QueryRow("SELECT server_seed FROM runs WHERE id = ?", id).Scan(&seed); err != nil {
+			t.Fatalf("Failed to read server seed: %v", err)
+		}
+		return seed
+	}
+	newRun := func(id string) *Run {
+		return &Run{
+			ID: id, Game: "limbo", ServerSeed: "seed-" + id, ClientSeed: "client",
+			NonceStart: 1, NonceEnd: 10, TargetOp: ">=", TargetVal: 2, EngineVersion: "test",
+		}
+	}
+
+	// Written before encryption was enabled
+	if err := db.SaveRun(newRun("legacy")); err != nil {
+		t.Fatalf("Failed to save run: %v", err)
+	}
+
+	key, _ := atrest.NewKey()
+	cipher, err := atrest.NewCipher(key)
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+	db.SetCipher(cipher)
+
+	if err := db.SaveRun(newRun("sealed")); err != nil {
+		t.Fatalf("Failed to save run: %v", err)
+	}
+	if raw := rawSeed("sealed"); !atrest.IsSealed(raw) || strings.Contains(raw, "seed-sealed") {
+		t.Errorf("Expected a sealed server seed, got %q", raw)
+	}
+	if raw := rawSeed("legacy"); raw != "seed-legacy" {
+		t.Errorf("Expected the legacy seed untouched before resealing, got %q", raw)
+	}
+
+	n, err := db.ResealSeeds()
+	if err != nil || n != 1 {
+		t.Fatalf("ResealSeeds = %d, %v", n, err)
+	}
+	if !atrest.IsSealed(rawSeed("legacy")) {
+		t.Error("Expected the legacy seed to be sealed")
+	}
+	if n, _ := db.ResealSeeds(); n != 0 {
+		t.Errorf("Expected nothing left to reseal, got %d", n)
+	}
+
+	for _, id := range []string{"legacy", "sealed"} {
+		run, err := db.GetRun(id)
+		if err != nil {
+			t.Fatalf("Failed to get run: %v", err)
+		}
+		if run.ServerSeed != "seed-"+id {
+			t.Errorf("Expected server seed seed-%s, got %q", id, run.ServerSeed)
+		}
+	}
+	runs, err := db.ListRunsBySeed("", "seed-legacy", "client")
+	if err != nil || len(runs) != 1 || runs[0].ID != "legacy" {
+		t.Errorf("Expected to find the legacy run by seed, got %v, %v", runs, err)
+	}
+
+	if n, err := db.SealedSeeds(); err != nil || n != 2 {
+		t.Errorf("SealedSeeds = %d, %v", n, err)
+	}
+
+	// Without the key the sealed seeds are hidden, but the runs still list
+	db.SetCipher(nil)
+	run, err := db.GetRun("legacy")
+	if err != nil || run.ServerSeed != "" || !run.SeedSealed {
+		t.Fatalf("Expected the run with its seed hidden, got %+v, %v", run, err)
+	}
+	if page, err := db.ListRuns(RunsQuery{}); err != nil || len(page.Runs) != 2 {
+		t.Errorf("Expected both runs listed without the key, got %+v, %v", page, err)
+	}
+	// Updating a run loaded that way keeps its sealed seed
+	run.HitCount = 3
+	if err := db.UpdateRun(run); err != nil {
+		t.Fatalf("UpdateRun: %v", err)
+	}
+	db.SetCipher(cipher)
+	if run, err := db.GetRun("legacy"); err != nil || run.ServerSeed != "seed-legacy" || run.HitCount != 3 {
+		t.Errorf("Expected the seed kept through the update, got %+v, %v", run, err)
+	}
+}
+
+func TestListRunsFilters(t *testing.T) {
+	db, err := NewSQLiteDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	maxA, maxB := 12.5, 80.0
+	runs := []*Run{
+		{ID: "pump-easy", Game: "pump", ServerSeedHash: "abc123", ClientSeed: "alpha", ParamsJSON: `{"difficulty":"easy"}`,
+			TargetOp: "ge", TargetVal: 10, HitCount: 3, TotalEvaluated: 1000, SummaryMax: &maxA, EngineVersion: "1.0.0"},
+		{ID: "pump-hard", Game: "pump", ServerSeedHash: "abd456", ClientSeed: "beta", ParamsJSON: `{"difficulty":"hard"}`,
+			TargetOp: "ge", TargetVal: 50, HitCount: 40, TotalEvaluated: 5000, SummaryMax: &maxB, EngineVersion: "1.0.0", TimedOut: true},
+		{ID: "keno-high", Game: "keno", ServerSeedHash: "ff0011", ClientSeed: "alpha", ParamsJSON: `{"risk":"high","picks":[1,2,3]}`,
+			TargetOp: "between", TargetVal: 3, HitCount: 0, TotalEvaluated: 200, EngineVersion: "1.0.0"},
+		{ID: "limbo", Game: "limbo", ServerSeedHash: "abc999", ClientSeed: "50%_off", ParamsJSON: `{}`,
+			TargetOp: "ge", TargetVal: 1000, HitCount: 7, TotalEvaluated: 3000, EngineVersion: "1.0.0"},
+	}
+	for _, run := range runs {
+		if err := db.SaveRun(run); err != nil {
+			t.Fatalf("Failed to save run %s: %v", run.ID, err)
+		}
+	}
+	if _, err := db.db.Exec(`UPDATE runs SET created_at = '2026-01-15 12:00:00' WHERE id = 'keno-high'`); err != nil {
+		t.Fatalf("Failed to backdate run: %v", err)
+	}
+
+	after := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	tvMin, tvMax := 10.0, 100.0
+	hitsMin, hitsMax := 1, 10
+	timedOut := true
+
+	tests := []struct {
+		name  string
+		query RunsQuery
+		want  []string
+	}{
+		{"hash prefix", RunsQuery{ServerSeedHash: "ABC"}, []string{"limbo", "pump-easy"}},
+		{"client seed", RunsQuery{ClientSeed: "alpha"}, []string{"keno-high", "pump-easy"}},
+		{"created after", RunsQuery{CreatedAfter: &after}, []string{"limbo", "pump-easy", "pump-hard"}},
+		{"created before", RunsQuery{CreatedBefore: &before}, []string{"keno-high"}},
+		{"target", RunsQuery{TargetOp: "ge", TargetValMin: &tvMin, TargetValMax: &tvMax}, []string{"pump-easy", "pump-hard"}},
+		{"hit count", RunsQuery{HitCountMin: &hitsMin, HitCountMax: &hitsMax}, []string{"limbo", "pump-easy"}},
+		{"timed out", RunsQuery{TimedOut: &timedOut}, []string{"pump-hard"}},
+		{"params", RunsQuery{Game: "pump", Params: map[string]any{"difficulty": "hard"}}, []string{"pump-hard"}},
+		{"params risk", RunsQuery{Params: map[string]any{"risk": "high"}}, []string{"keno-high"}},
+		{"text", RunsQuery{Text: "EASY"}, []string{"pump-easy"}},
+		{"text escapes wildcards", RunsQuery{Text: "%_"}, []string{"limbo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.SortBy, tt.query.SortOrder = "game", "asc"
+			list, err := db.ListRuns(tt.query)
+			if err != nil {
+				t.Fatalf("ListRuns failed: %v", err)
+			}
+			var got []string
+			for _, r := range list.Runs {
+				got = append(got, r.ID)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+			if list.TotalCount != len(tt.want) {
+				t.Errorf("Expected total count %d, got %d", len(tt.want), list.TotalCount)
+			}
+		})
+	}
+}
+
+func TestListRunsSorting(t *testing.T) {
+	db, err := NewSQLiteDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	high, low := 90.0, 5.0
+	runs := []*Run{
+		{ID: "a", Game: "dice", TargetOp: "ge", HitCount: 2, TotalEvaluated: 300, SummaryMax: &low, EngineVersion: "1.0.0"},
+		{ID: "b", Game: "dice", TargetOp: "ge", HitCount: 9, TotalEvaluated: 100, EngineVersion: "1.0.0"},
+		{ID: "c", Game: "dice", TargetOp: "ge", HitCount: 5, TotalEvaluated: 200, SummaryMax: &high, EngineVersion: "1.0.0"},
+	}
+	for _, run := range runs {
+		if err := db.SaveRun(run); err != nil {
+			t.Fatalf("Failed to save run %s: %v", run.ID, err)
+		}
+	}
+
+	tests := []struct {
+		sortBy, order string
+		want          string
+	}{
+		{"", "", "c,b,a"}, // newest first; same timestamp falls back to insertion order
+		{"hit_count", "desc", "b,c,a"},
+		{"hit_count", "asc", "a,c,b"},
+		{"total_evaluated", "asc", "b,c,a"},
+		{"summary_max", "desc", "c,a,b"}, // runs without a summary sort last
+		{"summary_max", "asc", "a,c,b"},
+	}
+	for _, tt := range tests {
+		list, err := db.ListRuns(RunsQuery{SortBy: tt.sortBy, SortOrder: tt.order})
+		if err != nil {
+			t.Fatalf("ListRuns(%s %s) failed: %v", tt.sortBy, tt.order, err)
+		}
+		var got []string
+		for _, r := range list.Runs {
+			got = append(got, r.ID)
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("Sort %s %s: expected %s, got %v", tt.sortBy, tt.order, tt.want, got)
+		}
+	}
+
+	invalid := []RunsQuery{
+		{SortBy: "server_seed; DROP TABLE runs"},
+		{SortOrder: "sideways"},
+		{Params: map[string]any{"risk') OR 1=1 --": "x"}},
+		{Params: map[string]any{"picks": []any{1, 2}}},
+	}
+	for _, q := range invalid {
+		if _, err := db.ListRuns(q); !errors.Is(err, ErrInvalidRunsQuery) {
+			t.Errorf("Expected ErrInvalidRunsQuery for %+v, got %v", q, err)
+		}
+	}
+}
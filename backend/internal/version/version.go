@@ -0,0 +1,43 @@
+// Package version describes the running build. Version, Commit and BuildTime
+// are set at link time:
+//
+//	go build -ldflags "-X github.com/MJE43/stake-pf-replay-go/internal/version.Version=v1.2.0 \
+//		-X github.com/MJE43/stake-pf-replay-go/internal/version.Commit=$(git rev-parse HEAD)"
+package version
+
+import "runtime/debug"
+
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = "unknown"
+)
+
+// Info is the version of the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	Modified  bool   `json:"modified,omitempty"` // built from a dirty tree
+}
+
+// Get returns the build version. When Commit wasn't set at link time, the
+// VCS revision recorded by the Go toolchain is used instead, or "unknown".
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime}
+	if info.Commit != "" {
+		return info
+	}
+	info.Commit = "unknown"
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Commit = s.Value
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	return info
+}
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Rank of each hit in top/bottom scans; NULL for threshold scans
+ALTER TABLE hits ADD COLUMN rank INTEGER;
+
+-- Covers ORDER BY rank, nonce so hit pages don't sort in a temp b-tree
+CREATE INDEX IF NOT EXISTS idx_hits_run_rank_nonce ON hits(run_id, rank, nonce);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_hits_run_rank_nonce;
+-- ALTER TABLE hits DROP COLUMN rank;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Per-seed runs of a batch scan point at the batch's parent run
+ALTER TABLE runs ADD COLUMN parent_run_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_runs_parent ON runs(parent_run_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_runs_parent;
+-- ALTER TABLE runs DROP COLUMN parent_run_id;
@@ -0,0 +1,23 @@
+-- Persistent scan job queue
+-- Jobs checkpoint next_nonce after every chunk; jobs found running at startup
+-- are requeued and resume from the checkpoint.
+
+CREATE TABLE IF NOT EXISTS scan_jobs (
+    id TEXT PRIMARY KEY,
+    status TEXT NOT NULL,
+    priority INTEGER NOT NULL DEFAULT 0,
+    request_json TEXT NOT NULL,
+    run_id TEXT,
+    next_nonce INTEGER NOT NULL,
+    evaluated INTEGER NOT NULL DEFAULT 0,
+    hits_found INTEGER NOT NULL DEFAULT 0,
+    metric_min REAL,
+    metric_max REAL,
+    ranked_json TEXT,
+    error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    started_at DATETIME,
+    finished_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_scan_jobs_pick ON scan_jobs(status, priority DESC, created_at);
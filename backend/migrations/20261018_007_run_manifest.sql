@@ -0,0 +1,6 @@
+-- +goose Up
+-- Reproducibility manifest recorded when a run is created
+ALTER TABLE runs ADD COLUMN manifest_json TEXT;
+
+-- +goose Down
+-- ALTER TABLE runs DROP COLUMN manifest_json;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Indexes backing the run search filters and sort columns
+CREATE INDEX IF NOT EXISTS idx_runs_server_hash ON runs(server_seed_hash);
+CREATE INDEX IF NOT EXISTS idx_runs_client_seed ON runs(client_seed, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_runs_target ON runs(target_op, target_val);
+CREATE INDEX IF NOT EXISTS idx_runs_hit_count ON runs(hit_count);
+CREATE INDEX IF NOT EXISTS idx_runs_total_evaluated ON runs(total_evaluated);
+CREATE INDEX IF NOT EXISTS idx_runs_summary_max ON runs(summary_max);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_runs_summary_max;
+DROP INDEX IF EXISTS idx_runs_total_evaluated;
+DROP INDEX IF EXISTS idx_runs_hit_count;
+DROP INDEX IF EXISTS idx_runs_target;
+DROP INDEX IF EXISTS idx_runs_client_seed;
+DROP INDEX IF EXISTS idx_runs_server_hash;
@@ -0,0 +1,43 @@
+-- +goose Up
+-- User annotations on runs and hits, with a tag index
+ALTER TABLE runs ADD COLUMN name TEXT;
+ALTER TABLE runs ADD COLUMN notes TEXT;
+ALTER TABLE runs ADD COLUMN starred INTEGER DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS run_tags (
+    run_id TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (run_id, tag)
+);
+
+CREATE TABLE IF NOT EXISTS hit_annotations (
+    run_id TEXT NOT NULL,
+    nonce INTEGER NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    notes TEXT NOT NULL DEFAULT '',
+    starred INTEGER NOT NULL DEFAULT 0,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (run_id, nonce)
+);
+
+CREATE TABLE IF NOT EXISTS hit_tags (
+    run_id TEXT NOT NULL,
+    nonce INTEGER NOT NULL,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (run_id, nonce, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_runs_starred ON runs(starred);
+CREATE INDEX IF NOT EXISTS idx_run_tags_tag ON run_tags(tag);
+CREATE INDEX IF NOT EXISTS idx_hit_tags_tag ON hit_tags(tag);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_hit_tags_tag;
+DROP INDEX IF EXISTS idx_run_tags_tag;
+DROP INDEX IF EXISTS idx_runs_starred;
+DROP TABLE IF EXISTS hit_tags;
+DROP TABLE IF EXISTS hit_annotations;
+DROP TABLE IF EXISTS run_tags;
+-- ALTER TABLE runs DROP COLUMN starred;
+-- ALTER TABLE runs DROP COLUMN notes;
+-- ALTER TABLE runs DROP COLUMN name;
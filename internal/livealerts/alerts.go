@@ -0,0 +1,592 @@
+// Package livealerts evaluates alert rules on live streams as heartbeats
+// and bets are ingested, and acts on those that hold: a Wails event for
+// an in-app toast, an OS notification, or a POST to a local webhook.
+//
+// A rule is one of these kinds, with Value and Target meaning:
+//
+//	result  a round of at least Value
+//	gap     a round of at least Target more than Value nonces after the last one
+//	streak  Value rounds without one of at least Target, once per streak
+//	payout  a bet paying out at least Value
+//	amount  a bet of at least Value
+//	stale   no ingest for Value seconds, once per silence
+//
+// Rules and their firings are kept in the live store. Staleness is only
+// watched for streams that have sent something since startup.
+package livealerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+)
+
+// Rule kinds
+const (
+	KindResult = "result"
+	KindGap    = "gap"
+	KindStreak = "streak"
+	KindPayout = "payout"
+	KindAmount = "amount"
+	KindStale  = "stale"
+)
+
+// Rule actions
+const (
+	ActionEvent   = "event"   // "live:alert" Wails event
+	ActionNotify  = "notify"  // OS notification
+	ActionWebhook = "webhook" // POST the firing as JSON to WebhookURL
+)
+
+const (
+	// staleTick is how often silent streams are checked
+	staleTick = 5 * time.Second
+	// webhookTimeout bounds a webhook POST
+	webhookTimeout = 5 * time.Second
+	// maxTestFirings caps the firings a test lists
+	maxTestFirings = 100
+	// firingQueue is how many firings may wait for their actions; more
+	// are dropped until the worker catches up
+	firingQueue = 256
+	// defaultNotifyCooldown is the cooldown of notifying rules that set none
+	defaultNotifyCooldown = 60
+	// minNotifyInterval spaces the OS notifications of a rule, whatever its
+	// cooldown, so a burst of firings can't flood the desktop
+	minNotifyInterval = 10 * time.Second
+)
+
+// Validate checks a rule and normalises it: kind and actions lowercased,
+// actions deduplicated and defaulting to an event, a missing name filled
+// in from the kind, and notifying rules without a cooldown given the
+// default one.
+func Validate(r *livestore.AlertRule) error {
+	r.Kind = strings.ToLower(strings.TrimSpace(r.Kind))
+	r.Name = strings.TrimSpace(r.Name)
+	r.StreamID = strings.TrimSpace(r.StreamID)
+	r.WebhookURL = strings.TrimSpace(r.WebhookURL)
+
+	switch r.Kind {
+	case KindResult, KindPayout, KindAmount, KindStale:
+	case KindGap, KindStreak:
+		if r.Target <= 0 {
+			return fmt.Errorf("%s rules need a target above 0", r.Kind)
+		}
+	default:
+		return fmt.Errorf("unknown rule kind %q", r.Kind)
+	}
+	if r.Value <= 0 {
+		return fmt.Errorf("value must be above 0")
+	}
+	if r.CooldownSeconds < 0 {
+		return fmt.Errorf("cooldown_seconds must not be negative")
+	}
+	if r.StreamID != "" {
+		id, err := uuid.Parse(r.StreamID)
+		if err != nil {
+			return fmt.Errorf("invalid stream id: %w", err)
+		}
+		r.StreamID = id.String()
+	}
+	if r.Name == "" {
+		r.Name = r.Kind + " alert"
+	}
+
+	actions := []string{}
+	seen := map[string]bool{}
+	for _, a := range r.Actions {
+		a = strings.ToLower(strings.TrimSpace(a))
+		switch a {
+		case ActionEvent, ActionNotify, ActionWebhook:
+		default:
+			return fmt.Errorf("unknown action %q, must be event, notify or webhook", a)
+		}
+		if !seen[a] {
+			seen[a] = true
+			actions = append(actions, a)
+		}
+	}
+	if len(actions) == 0 {
+		actions = append(actions, ActionEvent)
+	}
+	r.Actions = actions
+	if seen[ActionNotify] && r.CooldownSeconds == 0 {
+		r.CooldownSeconds = defaultNotifyCooldown
+	}
+
+	if seen[ActionWebhook] || r.WebhookURL != "" {
+		if err := validateWebhook(r.WebhookURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateWebhook accepts http(s) URLs on a loopback host only; alerts
+// carry stream details that shouldn't leave the machine.
+func validateWebhook(raw string) error {
+	if raw == "" {
+		return fmt.Errorf("webhook_url is required for the webhook action")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook_url must be an http or https URL")
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("webhook_url must point at localhost")
+	}
+	return nil
+}
+
+// appliesTo reports whether a rule watches a stream
+func appliesTo(r livestore.AlertRule, streamID uuid.UUID) bool {
+	return r.Enabled && (r.StreamID == "" || r.StreamID == streamID.String())
+}
+
+type stateKey struct {
+	rule   int64
+	stream uuid.UUID
+}
+
+// queuedFiring is a firing waiting for its actions
+type queuedFiring struct {
+	rule     livestore.AlertRule
+	streamID uuid.UUID
+	t        trigger
+	at       time.Time
+}
+
+// Service evaluates the enabled rules on what is ingested. All methods are
+// safe for concurrent use, and a nil Service does nothing.
+type Service struct {
+	store  *livestore.Store
+	client *http.Client
+	queue  chan queuedFiring // drained by one worker from Start
+	// notified is when each rule last showed a notification; the worker's own
+	notified map[int64]time.Time
+
+	mu       sync.Mutex
+	wailsCtx context.Context // for events; nil until Start
+	rules    []livestore.AlertRule
+	states   map[stateKey]*ruleState
+	seen     map[uuid.UUID]time.Time // last ingest of each stream since startup
+}
+
+// New evaluates the rules kept in store once started
+func New(store *livestore.Store) *Service {
+	return &Service{
+		store:    store,
+		client:   &http.Client{Timeout: webhookTimeout},
+		queue:    make(chan queuedFiring, firingQueue),
+		notified: map[int64]time.Time{},
+		states:   map[stateKey]*ruleState{},
+		seen:     map[uuid.UUID]time.Time{},
+	}
+}
+
+// Start loads the rules, then carries out firings and watches for silent
+// streams until ctx is done. ctx is the Wails context alert events are
+// emitted on.
+func (s *Service) Start(ctx context.Context) error {
+	if s == nil {
+		return fmt.Errorf("alerts not available")
+	}
+	s.mu.Lock()
+	s.wailsCtx = ctx
+	s.mu.Unlock()
+	if err := s.Reload(ctx); err != nil {
+		return err
+	}
+	go s.work(ctx)
+	go func() {
+		t := time.NewTicker(staleTick)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				s.checkStale(now)
+			}
+		}
+	}()
+	return nil
+}
+
+// Reload rereads the rules from the store. Streaks and cooldowns of rules
+// that changed start over.
+func (s *Service) Reload(ctx context.Context) error {
+	if s == nil {
+		return fmt.Errorf("alerts not available")
+	}
+	rules, err := s.store.ListAlertRules(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := map[int64]livestore.AlertRule{}
+	for _, r := range s.rules {
+		old[r.ID] = r
+	}
+	keep := map[int64]bool{}
+	s.rules = s.rules[:0:0]
+	for _, r := range rules {
+		if !r.Enabled {
+			continue
+		}
+		s.rules = append(s.rules, r)
+		if o, ok := old[r.ID]; ok && o.UpdatedAt.Equal(r.UpdatedAt) {
+			keep[r.ID] = true
+		}
+	}
+	for k := range s.states {
+		if !keep[k.rule] {
+			delete(s.states, k)
+		}
+	}
+	return nil
+}
+
+// ObserveRound evaluates the rules on a heartbeat round
+func (s *Service) ObserveRound(streamID uuid.UUID, nonce int64, result float64) {
+	s.observe(streamID, nonce, func(r livestore.AlertRule, st *ruleState) (trigger, bool) {
+		return st.round(r, nonce, result)
+	})
+}
+
+// ObserveBet evaluates the rules on a bet
+func (s *Service) ObserveBet(streamID uuid.UUID, b livestore.LiveBet) {
+	s.observe(streamID, b.Nonce, func(r livestore.AlertRule, st *ruleState) (trigger, bool) {
+		return st.bet(r, b)
+	})
+}
+
+func (s *Service) observe(streamID uuid.UUID, nonce int64, eval func(livestore.AlertRule, *ruleState) (trigger, bool)) {
+	if s == nil {
+		return
+	}
+	now := time.Now().UTC()
+	s.mu.Lock()
+	s.seen[streamID] = now
+	rules := s.rules
+	s.mu.Unlock()
+
+	for _, r := range rules {
+		if !appliesTo(r, streamID) {
+			continue
+		}
+		st := s.state(r, streamID, nonce)
+		s.mu.Lock()
+		st.stale = false
+		t, ok := eval(r, st)
+		ok = ok && st.allow(r, now)
+		s.mu.Unlock()
+		if ok {
+			s.enqueue(queuedFiring{r, streamID, t, now})
+		}
+	}
+}
+
+// state returns what a rule knows of a stream. Gap and streak rules
+// first pick up the stream's last hit before nonce from the store, so a
+// streak that began before startup counts in full.
+func (s *Service) state(r livestore.AlertRule, streamID uuid.UUID, nonce int64) *ruleState {
+	key := stateKey{r.ID, streamID}
+	s.mu.Lock()
+	st := s.states[key]
+	s.mu.Unlock()
+	if st != nil {
+		return st
+	}
+
+	st = &ruleState{}
+	if r.Kind == KindGap || r.Kind == KindStreak {
+		lastHit, first, err := s.store.LastHitBefore(context.Background(), streamID, r.Target, nonce)
+		if err != nil {
+			fmt.Printf("[livealerts] warning: loading history of %s for rule %d failed: %v\n", streamID, r.ID, err)
+		}
+		st.lastHit, st.first = lastHit, first
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur := s.states[key]; cur != nil {
+		return cur
+	}
+	s.states[key] = st
+	return st
+}
+
+// checkStale fires stale rules on streams silent for long enough
+func (s *Service) checkStale(now time.Time) {
+	var fired []queuedFiring
+
+	s.mu.Lock()
+	for _, r := range s.rules {
+		if r.Kind != KindStale {
+			continue
+		}
+		for id, last := range s.seen {
+			if !appliesTo(r, id) {
+				continue
+			}
+			key := stateKey{r.ID, id}
+			st := s.states[key]
+			if st == nil {
+				st = &ruleState{}
+				s.states[key] = st
+			}
+			if t, ok := st.idle(r, now.Sub(last)); ok && st.allow(r, now) {
+				fired = append(fired, queuedFiring{r, id, t, now.UTC()})
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for _, f := range fired {
+		s.enqueue(f)
+	}
+}
+
+// enqueue hands a firing to the worker, dropping it when the queue is
+// full rather than holding up ingest
+func (s *Service) enqueue(f queuedFiring) {
+	select {
+	case s.queue <- f:
+	default:
+		fmt.Printf("[livealerts] warning: firing queue full, dropped rule %d on %s\n", f.rule.ID, f.streamID)
+	}
+}
+
+// work carries out queued firings one at a time until ctx is done
+func (s *Service) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case f := <-s.queue:
+			s.fire(f.rule, f.streamID, f.t, f.at)
+		}
+	}
+}
+
+// notifyDue reports whether a rule may show a notification at, and if so
+// counts it as shown. Only the worker calls it.
+func (s *Service) notifyDue(ruleID int64, at time.Time) bool {
+	if last, ok := s.notified[ruleID]; ok && at.Sub(last) < minNotifyInterval {
+		return false
+	}
+	s.notified[ruleID] = at
+	return true
+}
+
+// fire records a firing and carries out the rule's actions
+func (s *Service) fire(r livestore.AlertRule, streamID uuid.UUID, t trigger, at time.Time) {
+	f := firingOf(r, streamID, t, at)
+	id, err := s.store.RecordAlertFiring(context.Background(), f)
+	if err != nil {
+		fmt.Printf("[livealerts] warning: recording firing of rule %d failed: %v\n", r.ID, err)
+	}
+	f.ID = id
+	fmt.Printf("[livealerts] %s on %s\n", f.Message, streamID)
+
+	s.mu.Lock()
+	wailsCtx := s.wailsCtx
+	s.mu.Unlock()
+	for _, a := range r.Actions {
+		switch a {
+		case ActionEvent:
+			if wailsCtx != nil {
+				runtime.EventsEmit(wailsCtx, "live:alert", f)
+			}
+		case ActionNotify:
+			if !s.notifyDue(r.ID, at) {
+				fmt.Printf("[livealerts] notification for rule %d skipped, one was shown under %s ago\n", r.ID, minNotifyInterval)
+				continue
+			}
+			if err := notify(r.Name, f.Message); err != nil {
+				fmt.Printf("[livealerts] warning: notification for rule %d failed: %v\n", r.ID, err)
+			}
+		case ActionWebhook:
+			if err := s.postWebhook(r.WebhookURL, f); err != nil {
+				fmt.Printf("[livealerts] warning: webhook for rule %d failed: %v\n", r.ID, err)
+			}
+		}
+	}
+}
+
+func firingOf(r livestore.AlertRule, streamID uuid.UUID, t trigger, at time.Time) livestore.AlertFiring {
+	return livestore.AlertFiring{
+		RuleID:   r.ID,
+		RuleName: r.Name,
+		StreamID: streamID,
+		Kind:     r.Kind,
+		Nonce:    t.nonce,
+		Value:    t.value,
+		Message:  r.Name + ": " + t.message,
+		FiredAt:  at,
+	}
+}
+
+func (s *Service) postWebhook(target string, f livestore.AlertFiring) error {
+	body, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook replied %s", resp.Status)
+	}
+	return nil
+}
+
+// ------------- Rules -------------
+
+// Rules returns every rule, enabled or not
+func (s *Service) Rules(ctx context.Context) ([]livestore.AlertRule, error) {
+	if s == nil {
+		return nil, fmt.Errorf("alerts not available")
+	}
+	return s.store.ListAlertRules(ctx)
+}
+
+// SaveRule validates and stores a rule, creating it when its ID is 0, and
+// starts evaluating it.
+func (s *Service) SaveRule(ctx context.Context, r livestore.AlertRule) (livestore.AlertRule, error) {
+	if s == nil {
+		return livestore.AlertRule{}, fmt.Errorf("alerts not available")
+	}
+	if err := Validate(&r); err != nil {
+		return livestore.AlertRule{}, err
+	}
+	saved, err := s.store.SaveAlertRule(ctx, r)
+	if err != nil {
+		return livestore.AlertRule{}, err
+	}
+	return saved, s.Reload(ctx)
+}
+
+// DeleteRule removes a rule and its firings
+func (s *Service) DeleteRule(ctx context.Context, id int64) error {
+	if s == nil {
+		return fmt.Errorf("alerts not available")
+	}
+	if err := s.store.DeleteAlertRule(ctx, id); err != nil {
+		return err
+	}
+	return s.Reload(ctx)
+}
+
+// Firings returns the latest firings, optionally of one rule or stream
+func (s *Service) Firings(ctx context.Context, ruleID int64, streamID *uuid.UUID, limit int) ([]livestore.AlertFiring, error) {
+	if s == nil {
+		return nil, fmt.Errorf("alerts not available")
+	}
+	return s.store.ListAlertFirings(ctx, ruleID, streamID, limit)
+}
+
+// ------------- Testing rules -------------
+
+// TestResult is what a rule would have fired on a recorded stream
+type TestResult struct {
+	Rule      livestore.AlertRule     `json:"rule"`
+	StreamID  string                  `json:"stream_id"`
+	Events    int64                   `json:"events"` // rounds and bets replayed
+	Fired     int64                   `json:"fired"`
+	Firings   []livestore.AlertFiring `json:"firings"`
+	Truncated bool                    `json:"truncated"` // more firings than listed
+}
+
+// Test replays a stream's rounds and bets in nonce order through a rule,
+// which needn't be saved or enabled, and lists what it would have fired.
+// Nothing is recorded and no actions run. Staleness is judged from the
+// time observed rounds and bets were received, and cooldowns likewise.
+func (s *Service) Test(ctx context.Context, r livestore.AlertRule, streamID uuid.UUID) (TestResult, error) {
+	res := TestResult{StreamID: streamID.String(), Firings: []livestore.AlertFiring{}}
+	if s == nil {
+		return res, fmt.Errorf("alerts not available")
+	}
+	if err := Validate(&r); err != nil {
+		return res, err
+	}
+	res.Rule = r
+	if _, err := s.store.GetStream(ctx, streamID); err != nil {
+		return res, err
+	}
+
+	var bets []livestore.LiveBet
+	if err := s.store.EachBet(ctx, streamID, func(b livestore.LiveBet) error {
+		bets = append(bets, b)
+		return nil
+	}); err != nil {
+		return res, err
+	}
+
+	st := &ruleState{}
+	var prev time.Time
+	replay := func(at time.Time, observed bool, eval func() (trigger, bool)) {
+		res.Events++
+		if observed && r.Kind == KindStale {
+			if !prev.IsZero() {
+				st.stale = false
+				if t, ok := st.idle(r, at.Sub(prev)); ok {
+					res.add(r, streamID, t, at, st)
+				}
+			}
+			prev = at
+			return
+		}
+		if t, ok := eval(); ok {
+			res.add(r, streamID, t, at, st)
+		}
+	}
+	next := 0
+	flushBets := func(upTo int64) {
+		for ; next < len(bets) && bets[next].Nonce <= upTo; next++ {
+			b := bets[next]
+			replay(b.ReceivedAt, true, func() (trigger, bool) { return st.bet(r, b) })
+		}
+	}
+	err := s.store.EachRound(ctx, streamID, func(lr livestore.LiveRound) error {
+		flushBets(lr.Nonce)
+		replay(lr.ReceivedAt, lr.Source != livestore.RoundComputed, func() (trigger, bool) {
+			return st.round(r, lr.Nonce, lr.RoundResult)
+		})
+		return ctx.Err()
+	})
+	if err != nil {
+		return res, err
+	}
+	flushBets(math.MaxInt64)
+	return res, nil
+}
+
+func (res *TestResult) add(r livestore.AlertRule, streamID uuid.UUID, t trigger, at time.Time, st *ruleState) {
+	if !st.allow(r, at) {
+		return
+	}
+	res.Fired++
+	if len(res.Firings) < maxTestFirings {
+		res.Firings = append(res.Firings, firingOf(r, streamID, t, at))
+	} else {
+		res.Truncated = true
+	}
+}
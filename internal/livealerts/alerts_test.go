@@ -0,0 +1,248 @@
+package livealerts
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+)
+
+// recordedStream stores a fixture stream of 30 rounds, one a second, with
+// a two minute silence before nonce 21. Rounds 5, 18 and 25 are 10x or
+// more; bets were placed on 5, 12 and 25. Rounds 21 and 22 were computed
+// by a later backfill, so they say nothing about when ingest was live.
+func recordedStream(t *testing.T) (*Service, uuid.UUID) {
+	t.Helper()
+	ctx := context.Background()
+	st, err := livestore.New(filepath.Join(t.TempDir(), "live.db"))
+	if err != nil {
+		t.Fatalf("livestore.New: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	id, err := st.FindOrCreateStream(ctx, "hash", "client")
+	if err != nil {
+		t.Fatalf("FindOrCreateStream: %v", err)
+	}
+
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(nonce int64) time.Time {
+		d := time.Duration(nonce) * time.Second
+		if nonce >= 21 {
+			d += 2 * time.Minute
+		}
+		return base.Add(d)
+	}
+	results := map[int64]float64{5: 10, 18: 12.5, 25: 50}
+
+	var rounds []livestore.LiveRound
+	for nonce := int64(1); nonce <= 30; nonce++ {
+		r := livestore.LiveRound{Nonce: nonce, RoundResult: 1, ReceivedAt: at(nonce), Source: livestore.RoundObserved}
+		if v, ok := results[nonce]; ok {
+			r.RoundResult = v
+		}
+		if nonce == 21 || nonce == 22 {
+			r.ReceivedAt, r.Source = base.Add(time.Hour), livestore.RoundComputed
+		}
+		rounds = append(rounds, r)
+	}
+	if _, err := st.ImportRounds(ctx, id, rounds); err != nil {
+		t.Fatalf("ImportRounds: %v", err)
+	}
+
+	bet := func(nonce int64, amount, payout float64) livestore.LiveBet {
+		return livestore.LiveBet{
+			AntebotBetID: fmt.Sprintf("bet-%d", nonce),
+			ReceivedAt:   at(nonce),
+			DateTime:     at(nonce),
+			Nonce:        nonce,
+			Amount:       amount,
+			Payout:       payout,
+			Difficulty:   "easy",
+			RoundTarget:  2,
+			RoundResult:  rounds[nonce-1].RoundResult,
+		}
+	}
+	bets := []livestore.LiveBet{bet(5, 2, 20), bet(12, 100, 0), bet(25, 1, 50)}
+	if _, err := st.ImportBets(ctx, id, bets); err != nil {
+		t.Fatalf("ImportBets: %v", err)
+	}
+	return New(st), id
+}
+
+type firing struct {
+	nonce int64
+	value float64
+}
+
+func TestRulesAgainstRecordedStream(t *testing.T) {
+	svc, id := recordedStream(t)
+
+	tests := []struct {
+		name string
+		rule livestore.AlertRule
+		want []firing
+	}{
+		{
+			name: "threshold",
+			rule: livestore.AlertRule{Kind: KindResult, Value: 10},
+			want: []firing{{5, 10}, {18, 12.5}, {25, 50}},
+		},
+		{
+			name: "threshold with cooldown",
+			rule: livestore.AlertRule{Kind: KindResult, Value: 10, CooldownSeconds: 60},
+			want: []firing{{5, 10}, {25, 50}},
+		},
+		{
+			name: "gap",
+			rule: livestore.AlertRule{Kind: KindGap, Value: 10, Target: 10},
+			want: []firing{{18, 13}},
+		},
+		{
+			name: "streak",
+			rule: livestore.AlertRule{Kind: KindStreak, Value: 8, Target: 10},
+			want: []firing{{13, 8}},
+		},
+		{
+			name: "streak from the first round",
+			rule: livestore.AlertRule{Kind: KindStreak, Value: 4, Target: 10},
+			want: []firing{{4, 4}, {9, 4}, {22, 4}, {29, 4}},
+		},
+		{
+			name: "bet payout",
+			rule: livestore.AlertRule{Kind: KindPayout, Value: 20},
+			want: []firing{{5, 20}, {25, 50}},
+		},
+		{
+			name: "bet amount",
+			rule: livestore.AlertRule{Kind: KindAmount, Value: 50},
+			want: []firing{{12, 100}},
+		},
+		{
+			name: "staleness",
+			rule: livestore.AlertRule{Kind: KindStale, Value: 60},
+			want: []firing{{0, 123}}, // nonce 20 to 23; the computed rounds between don't count
+		},
+		{
+			name: "staleness below the silence",
+			rule: livestore.AlertRule{Kind: KindStale, Value: 300},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := svc.Test(context.Background(), tt.rule, id)
+			if err != nil {
+				t.Fatalf("Test: %v", err)
+			}
+			if res.Events != 33 {
+				t.Errorf("expected 33 events replayed, got %d", res.Events)
+			}
+			if res.Fired != int64(len(tt.want)) || len(res.Firings) != len(tt.want) {
+				t.Fatalf("expected %d firings, got %d: %+v", len(tt.want), res.Fired, res.Firings)
+			}
+			for i, f := range res.Firings {
+				if f.Nonce != tt.want[i].nonce || f.Value != tt.want[i].value {
+					t.Errorf("firing %d: expected nonce %d value %g, got nonce %d value %g",
+						i, tt.want[i].nonce, tt.want[i].value, f.Nonce, f.Value)
+				}
+				if f.Kind != tt.rule.Kind || f.StreamID != id {
+					t.Errorf("firing %d: unexpected kind %q or stream %s", i, f.Kind, f.StreamID)
+				}
+			}
+		})
+	}
+}
+
+func TestRuleTestRejectsInvalidRules(t *testing.T) {
+	svc, id := recordedStream(t)
+	for _, r := range []livestore.AlertRule{
+		{Kind: "sometimes", Value: 1},
+		{Kind: KindGap, Value: 10},
+		{Kind: KindResult, Value: 0},
+		{Kind: KindResult, Value: 2, Actions: []string{ActionWebhook}, WebhookURL: "https://example.com/hook"},
+	} {
+		if _, err := svc.Test(context.Background(), r, id); err == nil {
+			t.Errorf("expected %+v to be rejected", r)
+		}
+	}
+	if _, err := svc.Test(context.Background(), livestore.AlertRule{Kind: KindResult, Value: 2}, uuid.New()); err == nil {
+		t.Error("expected an unknown stream to be rejected")
+	}
+}
+
+func TestValidateDefaultsNotifyCooldown(t *testing.T) {
+	r := livestore.AlertRule{Kind: KindResult, Value: 2, Actions: []string{"Notify"}}
+	if err := Validate(&r); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if r.CooldownSeconds != defaultNotifyCooldown {
+		t.Errorf("expected the default cooldown %d, got %d", defaultNotifyCooldown, r.CooldownSeconds)
+	}
+	r = livestore.AlertRule{Kind: KindResult, Value: 2, Actions: []string{ActionNotify}, CooldownSeconds: 5}
+	if err := Validate(&r); err != nil || r.CooldownSeconds != 5 {
+		t.Errorf("expected a set cooldown to be kept, got %d (%v)", r.CooldownSeconds, err)
+	}
+	r = livestore.AlertRule{Kind: KindResult, Value: 2}
+	if err := Validate(&r); err != nil || r.CooldownSeconds != 0 {
+		t.Errorf("expected no cooldown without notify, got %d (%v)", r.CooldownSeconds, err)
+	}
+}
+
+func TestNotificationsAreSpaced(t *testing.T) {
+	svc := New(nil)
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		rule  int64
+		after time.Duration
+		want  bool
+	}{
+		{1, 0, true},
+		{1, time.Second, false},
+		{2, time.Second, true},
+		{1, minNotifyInterval - time.Second, false},
+		{1, minNotifyInterval, true},
+	} {
+		if got := svc.notifyDue(tt.rule, at.Add(tt.after)); got != tt.want {
+			t.Errorf("rule %d after %s: expected %v, got %v", tt.rule, tt.after, tt.want, got)
+		}
+	}
+}
+
+func TestFiringQueueIsBounded(t *testing.T) {
+	svc, id := recordedStream(t)
+	rule := livestore.AlertRule{ID: 1, Name: "result alert", Kind: KindResult, Value: 2, Actions: []string{ActionEvent}}
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Nothing drains the queue before Start, so firings past its size
+	// are dropped instead of blocking
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < firingQueue+10; i++ {
+			svc.enqueue(queuedFiring{rule, id, trigger{nonce: int64(i), value: 2, message: "hit"}, at})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("enqueue blocked on a full queue")
+	}
+	if n := len(svc.queue); n != firingQueue {
+		t.Fatalf("expected %d queued firings, got %d", firingQueue, n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svc.work(ctx)
+	deadline := time.Now().Add(10 * time.Second)
+	for len(svc.queue) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(svc.queue); n != 0 {
+		t.Fatalf("expected the worker to drain the queue, %d left", n)
+	}
+}
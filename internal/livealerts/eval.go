@@ -0,0 +1,108 @@
+package livealerts
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+)
+
+// trigger is a rule holding on an event
+type trigger struct {
+	nonce   int64
+	value   float64
+	message string
+}
+
+// ruleState is what a rule remembers about one stream. Rounds are taken
+// in nonce order; a round at or before the last one seen, such as the
+// heartbeat repeating a bet's round, is ignored.
+type ruleState struct {
+	first     int64 // first round seen, for a streak with no hit yet
+	lastNonce int64
+	lastHit   int64 // last round reaching Target, for gap and streak rules
+	streak    bool  // the current streak has fired
+	stale     bool  // the current silence has fired
+	lastFired time.Time
+}
+
+// round evaluates result, gap and streak rules on a round
+func (st *ruleState) round(r livestore.AlertRule, nonce int64, result float64) (trigger, bool) {
+	if nonce <= st.lastNonce {
+		return trigger{}, false
+	}
+	if st.first == 0 {
+		st.first = nonce
+	}
+	st.lastNonce = nonce
+
+	switch r.Kind {
+	case KindResult:
+		if result >= r.Value {
+			return trigger{nonce, result, fmt.Sprintf("%.2fx at nonce %d", result, nonce)}, true
+		}
+	case KindGap:
+		if result < r.Target {
+			return trigger{}, false
+		}
+		prev := st.lastHit
+		st.lastHit = nonce
+		if gap := nonce - prev; prev > 0 && float64(gap) > r.Value {
+			return trigger{nonce, float64(gap),
+				fmt.Sprintf("%.2fx+ after a gap of %d nonces at nonce %d", r.Target, gap, nonce)}, true
+		}
+	case KindStreak:
+		if result >= r.Target {
+			st.lastHit, st.streak = nonce, false
+			return trigger{}, false
+		}
+		from := st.lastHit
+		if from == 0 {
+			from = st.first - 1
+		}
+		if n := nonce - from; !st.streak && float64(n) >= r.Value {
+			st.streak = true
+			return trigger{nonce, float64(n),
+				fmt.Sprintf("%d rounds without %.2fx at nonce %d", n, r.Target, nonce)}, true
+		}
+	}
+	return trigger{}, false
+}
+
+// bet evaluates any rule but staleness on a bet
+func (st *ruleState) bet(r livestore.AlertRule, b livestore.LiveBet) (trigger, bool) {
+	switch r.Kind {
+	case KindPayout:
+		if b.Payout >= r.Value {
+			return trigger{b.Nonce, b.Payout, fmt.Sprintf("payout %.8g at nonce %d", b.Payout, b.Nonce)}, true
+		}
+	case KindAmount:
+		if b.Amount >= r.Value {
+			return trigger{b.Nonce, b.Amount, fmt.Sprintf("bet of %.8g at nonce %d", b.Amount, b.Nonce)}, true
+		}
+	default:
+		return st.round(r, b.Nonce, b.RoundResult)
+	}
+	return trigger{}, false
+}
+
+// idle evaluates a stale rule on a stream that has been silent for a
+// while. It fires once per silence; the next ingest rearms it.
+func (st *ruleState) idle(r livestore.AlertRule, silent time.Duration) (trigger, bool) {
+	if r.Kind != KindStale || st.stale || silent.Seconds() < r.Value {
+		return trigger{}, false
+	}
+	st.stale = true
+	return trigger{0, silent.Seconds(),
+		fmt.Sprintf("no ingest for %s", silent.Truncate(time.Second))}, true
+}
+
+// allow applies the rule's cooldown to a firing at at and records it
+func (st *ruleState) allow(r livestore.AlertRule, at time.Time) bool {
+	cooldown := time.Duration(r.CooldownSeconds) * time.Second
+	if cooldown > 0 && !st.lastFired.IsZero() && at.Sub(st.lastFired) < cooldown {
+		return false
+	}
+	st.lastFired = at
+	return true
+}
@@ -0,0 +1,509 @@
+// Package liveanalytics tracks tier cadences of live streams: for each
+// tier threshold, when it was last hit, the gaps between hits and how the
+// hit rate compares with the game's exact odds.
+//
+// Analytics are built from a stream's heartbeat rounds the first time
+// they're asked for and then kept up to date as heartbeats arrive, so
+// reading them doesn't rescan live_rounds.
+package liveanalytics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+	"github.com/MJE43/stake-pf-replay-go/bindings"
+)
+
+// Config picks the tiers to track and how they're summarised. Live
+// streams are Pump rounds, so tiers are Pump multipliers at Difficulty.
+type Config struct {
+	Difficulty string    `json:"difficulty"`
+	Tiers      []float64 `json:"tiers"`  // hit when round_result >= tier
+	LastK      int       `json:"last_k"` // recent gaps summarised per tier
+	Band       float64   `json:"band"`   // a gap within ±Band of the expected gap is within band
+	Window     int64     `json:"window"` // nonces covered by the rolling hit rate
+}
+
+// DefaultConfig tracks the Pump expert tiers of the live dashboard
+func DefaultConfig() Config {
+	return Config{
+		Difficulty: "expert",
+		Tiers:      []float64{164.72, 400.02, 1066.73, 3200.18, 11200.65},
+		LastK:      10,
+		Band:       400,
+		Window:     10000,
+	}
+}
+
+// Gap is the nonce distance between two hits of a tier
+type Gap struct {
+	Gap       int64   `json:"gap"`
+	Deviation float64 `json:"deviation"` // gap minus the expected gap
+	AtNonce   int64   `json:"at_nonce"`  // nonce of the later hit
+}
+
+// Rolling is a tier's hit rate over the last Config.Window nonces
+type Rolling struct {
+	Rounds   int64   `json:"rounds"`
+	Hits     int64   `json:"hits"`
+	Rate     float64 `json:"rate"`
+	Expected float64 `json:"expected"` // expected hits over those rounds
+	PValue   float64 `json:"p_value"`
+}
+
+// TierStats is the cadence of one tier. P-values are two-sided against
+// the game's exact probability, except StreakPValue, which is the chance
+// of a dry run at least as long as the current streak. A p-value with
+// nothing to test is 1.
+type TierStats struct {
+	Threshold      float64 `json:"threshold"`
+	Probability    float64 `json:"probability"`
+	ExpectedGap    float64 `json:"expected_gap"`
+	Hits           int64   `json:"hits"`
+	HitRate        float64 `json:"hit_rate"`
+	HitRatePValue  float64 `json:"hit_rate_p_value"`
+	LastHitNonce   int64   `json:"last_hit_nonce,omitempty"`
+	CurrentStreak  int64   `json:"current_streak"`
+	DueIn          float64 `json:"due_in"` // expected gap minus the streak; negative when overdue
+	StreakPValue   float64 `json:"streak_p_value"`
+	LastGaps       []Gap   `json:"last_gaps"`
+	MeanGap        float64 `json:"mean_gap"`
+	MedianGap      float64 `json:"median_gap"`
+	WithinBand     int     `json:"within_band"`
+	LastGapsPValue float64 `json:"last_gaps_p_value"`
+	Rolling        Rolling `json:"rolling"`
+	Gaps           []Gap   `json:"gaps,omitempty"` // every gap, when asked for
+	// Partial is set when compacted blocks may hide hits of the tier,
+	// for a tier below the lowest one tracked when they were compacted
+	Partial bool `json:"partial,omitempty"`
+}
+
+// StreamAnalytics are the tier cadences of a stream. Streaks run up to
+// the stream's last observed nonce rather than its last stored round.
+type StreamAnalytics struct {
+	StreamID          uuid.UUID   `json:"stream_id"`
+	Difficulty        string      `json:"difficulty"`
+	Rounds            int64       `json:"rounds"`
+	FirstNonce        int64       `json:"first_nonce"`
+	LastRoundNonce    int64       `json:"last_round_nonce"`
+	LastObservedNonce int64       `json:"last_observed_nonce"`
+	Window            int64       `json:"window"`
+	Tiers             []TierStats `json:"tiers"`
+}
+
+// Service keeps the analytics of the streams that have been looked at.
+// All methods are safe for concurrent use, and a nil Service does nothing.
+type Service struct {
+	store *livestore.Store
+
+	mu      sync.Mutex
+	cfg     Config
+	probs   []float64
+	streams map[uuid.UUID]*streamState
+}
+
+// New tracks the streams of store with DefaultConfig
+func New(store *livestore.Store) *Service {
+	s := &Service{store: store, streams: map[uuid.UUID]*streamState{}}
+	if err := s.SetConfig(DefaultConfig()); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Config returns the tiers being tracked
+func (s *Service) Config() Config {
+	if s == nil {
+		return DefaultConfig()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cfg := s.cfg
+	cfg.Tiers = append([]float64(nil), cfg.Tiers...)
+	return cfg
+}
+
+// SetConfig changes the tracked tiers. Zero LastK, Band and Window keep
+// their defaults. Analytics already built are dropped and rebuilt with the
+// new tiers on their next read.
+func (s *Service) SetConfig(cfg Config) error {
+	if s == nil {
+		return fmt.Errorf("analytics not available")
+	}
+	def := DefaultConfig()
+	if cfg.Difficulty == "" {
+		cfg.Difficulty = def.Difficulty
+	}
+	if cfg.LastK == 0 {
+		cfg.LastK = def.LastK
+	}
+	if cfg.Band == 0 {
+		cfg.Band = def.Band
+	}
+	if cfg.Window == 0 {
+		cfg.Window = def.Window
+	}
+	if cfg.LastK < 1 || cfg.LastK > 1000 {
+		return fmt.Errorf("last_k must be between 1 and 1000")
+	}
+	if cfg.Band < 0 || cfg.Window < 1 {
+		return fmt.Errorf("band must be positive and window at least 1")
+	}
+	if len(cfg.Tiers) == 0 {
+		return fmt.Errorf("at least one tier is required")
+	}
+
+	tiers := append([]float64(nil), cfg.Tiers...)
+	sort.Float64s(tiers)
+	probs := make([]float64, 0, len(tiers))
+	unique := tiers[:0]
+	for _, t := range tiers {
+		if len(unique) > 0 && unique[len(unique)-1] == t {
+			continue
+		}
+		p, err := bindings.PumpHitProbability(cfg.Difficulty, t)
+		if err != nil {
+			return err
+		}
+		if p <= 0 || p >= 1 {
+			return fmt.Errorf("tier %gx is never or always hit at %s difficulty", t, cfg.Difficulty)
+		}
+		unique = append(unique, t)
+		probs = append(probs, p)
+	}
+	cfg.Tiers = unique
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg, s.probs = cfg, probs
+	s.streams = map[uuid.UUID]*streamState{}
+	return nil
+}
+
+// Observe adds a heartbeat round to a stream's analytics if they're
+// loaded. Rounds that arrive out of nonce order drop the analytics so
+// they're rebuilt from the database.
+func (s *Service) Observe(streamID uuid.UUID, nonce int64, result float64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.streams[streamID]
+	switch {
+	case st == nil:
+	case st.loading:
+		st.pending = append(st.pending, livestore.LiveRound{Nonce: nonce, RoundResult: result})
+	case !st.add(nonce, result):
+		delete(s.streams, streamID)
+	}
+}
+
+// Invalidate drops a stream's analytics, for when its rounds change other
+// than through Observe
+func (s *Service) Invalidate(streamID uuid.UUID) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	delete(s.streams, streamID)
+	s.mu.Unlock()
+}
+
+// Stream returns a stream's analytics, loading its rounds the first time.
+// series adds every gap of each tier.
+func (s *Service) Stream(ctx context.Context, streamID uuid.UUID, series bool) (StreamAnalytics, error) {
+	if s == nil {
+		return StreamAnalytics{}, fmt.Errorf("analytics not available")
+	}
+	ls, err := s.store.GetStream(ctx, streamID)
+	if err != nil {
+		return StreamAnalytics{}, err
+	}
+	st, err := s.load(ctx, streamID)
+	if err != nil {
+		return StreamAnalytics{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return st.snapshot(streamID, ls.LastObservedNonce, series), nil
+}
+
+// load returns the stream's state, building it from the database when
+// it isn't kept yet. Heartbeats arriving meanwhile are queued and applied
+// once the rounds are read.
+func (s *Service) load(ctx context.Context, streamID uuid.UUID) (*streamState, error) {
+	s.mu.Lock()
+	st := s.streams[streamID]
+	if st != nil {
+		s.mu.Unlock()
+		<-st.ready
+		if st.err != nil {
+			return nil, st.err
+		}
+		return st, nil
+	}
+	st = newStreamState(s.cfg, s.probs)
+	s.streams[streamID] = st
+	s.mu.Unlock()
+
+	// Until loading is cleared, Observe only queues rounds and readers wait
+	// on ready, so the state is ours alone. Compacted blocks are counted
+	// where they start, and the hits they list are taken in nonce order
+	// among the rounds they kept.
+	var hits []livestore.BlockHit
+	blocks, err := s.store.RoundBlocks(ctx, streamID)
+	if err == nil {
+		err = s.store.EachRound(ctx, streamID, func(r livestore.LiveRound) error {
+			for len(blocks) > 0 && blocks[0].StartNonce <= r.Nonce {
+				hits = append(hits, st.addBlock(blocks[0])...)
+				blocks = blocks[1:]
+			}
+			for len(hits) > 0 && hits[0].Nonce < r.Nonce {
+				st.addHit(hits[0])
+				hits = hits[1:]
+			}
+			st.add(r.Nonce, r.RoundResult)
+			return nil
+		})
+	}
+	if err == nil {
+		for _, b := range blocks {
+			hits = append(hits, st.addBlock(b)...)
+		}
+		for _, h := range hits {
+			st.addHit(h)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st.loading = false
+	if err != nil {
+		st.err = err
+		if s.streams[streamID] == st {
+			delete(s.streams, streamID)
+		}
+	} else {
+		for _, r := range st.pending {
+			if r.Nonce > st.last {
+				st.add(r.Nonce, r.RoundResult)
+			}
+		}
+	}
+	st.pending = nil
+	close(st.ready)
+	return st, err
+}
+
+// streamState is the running tally of one stream
+type streamState struct {
+	cfg   Config
+	probs []float64
+
+	loading bool
+	pending []livestore.LiveRound
+	ready   chan struct{} // closed once loaded
+	err     error
+
+	rounds      int64
+	first, last int64
+	lastResult  float64
+	window      []int64 // round nonces in the rolling window
+	tiers       []tierState
+}
+
+type tierState struct {
+	hits    int64
+	lastHit int64
+	gaps    []Gap
+	recent  []int64 // hit nonces in the rolling window
+	partial bool    // a block may hide hits
+}
+
+func newStreamState(cfg Config, probs []float64) *streamState {
+	return &streamState{
+		cfg:     cfg,
+		probs:   probs,
+		loading: true,
+		ready:   make(chan struct{}),
+		tiers:   make([]tierState, len(cfg.Tiers)),
+	}
+}
+
+// add counts a round that comes after every round seen so far. It reports
+// false for an earlier round, or a repeat of the last one with a
+// different result, which the running tally can't take in.
+func (st *streamState) add(nonce int64, result float64) bool {
+	if st.rounds > 0 && nonce <= st.last {
+		return nonce == st.last && result == st.lastResult
+	}
+	if st.rounds == 0 {
+		st.first = nonce
+	}
+	st.rounds++
+	st.last, st.lastResult = nonce, result
+
+	cutoff := nonce - st.cfg.Window
+	st.window = trimBefore(append(st.window, nonce), cutoff)
+	for i := range st.tiers {
+		t := &st.tiers[i]
+		if result >= st.cfg.Tiers[i] {
+			t.hit(nonce, st.probs[i])
+			t.hits++
+			t.recent = append(t.recent, nonce)
+		}
+		t.recent = trimBefore(t.recent, cutoff)
+	}
+	return true
+}
+
+// hit moves a tier's last hit to nonce, recording the gap from the one
+// before. A hit behind the last one records nothing.
+func (t *tierState) hit(nonce int64, prob float64) {
+	if nonce <= t.lastHit {
+		return
+	}
+	if t.lastHit > 0 {
+		gap := nonce - t.lastHit
+		t.gaps = append(t.gaps, Gap{Gap: gap, Deviation: float64(gap) - 1/prob, AtNonce: nonce})
+	}
+	t.lastHit = nonce
+}
+
+// addBlock counts the rounds compacted into a block and returns the hits
+// it lists, to be taken with addHit in nonce order. Retention leaves the
+// rolling window alone, so only totals, first nonce and hits change. A
+// tier is whole if the block listed its hits, kept them all, or has none
+// of them; otherwise it is marked partial.
+func (st *streamState) addBlock(b livestore.RoundBlock) []livestore.BlockHit {
+	if st.rounds == 0 {
+		st.first = b.StartNonce
+	}
+	st.rounds += b.Rounds
+	for i := range st.tiers {
+		threshold := st.cfg.Tiers[i]
+		listed := b.HitsAbove > 0 && threshold >= b.HitsAbove
+		kept := b.KeptAbove > 0 && threshold >= b.KeptAbove
+		if !listed && !kept && b.MaxResult >= threshold {
+			st.tiers[i].partial = true
+		}
+	}
+	return b.Hits
+}
+
+// addHit counts a compacted round a block listed against every tier it
+// reaches
+func (st *streamState) addHit(h livestore.BlockHit) {
+	for i := range st.tiers {
+		if h.Result >= st.cfg.Tiers[i] {
+			t := &st.tiers[i]
+			t.hit(h.Nonce, st.probs[i])
+			t.hits++
+		}
+	}
+}
+
+// trimBefore drops the nonces at or before cutoff from the front of a
+// sorted slice, reusing its storage
+func trimBefore(nonces []int64, cutoff int64) []int64 {
+	i := 0
+	for i < len(nonces) && nonces[i] <= cutoff {
+		i++
+	}
+	if i == 0 {
+		return nonces
+	}
+	return append(nonces[:0], nonces[i:]...)
+}
+
+func (st *streamState) snapshot(streamID uuid.UUID, lastObserved int64, series bool) StreamAnalytics {
+	if st.last > lastObserved {
+		lastObserved = st.last
+	}
+	out := StreamAnalytics{
+		StreamID:          streamID,
+		Difficulty:        st.cfg.Difficulty,
+		Rounds:            st.rounds,
+		FirstNonce:        st.first,
+		LastRoundNonce:    st.last,
+		LastObservedNonce: lastObserved,
+		Window:            st.cfg.Window,
+		Tiers:             make([]TierStats, len(st.tiers)),
+	}
+	for i, t := range st.tiers {
+		p := st.probs[i]
+		expected := 1 / p
+		ts := TierStats{
+			Threshold:     st.cfg.Tiers[i],
+			Probability:   p,
+			ExpectedGap:   expected,
+			Hits:          t.hits,
+			HitRatePValue: hitCountPValue(st.rounds, t.hits, p),
+			LastHitNonce:  t.lastHit,
+			LastGaps:      []Gap{},
+			Partial:       t.partial,
+		}
+		if st.rounds > 0 {
+			ts.HitRate = float64(t.hits) / float64(st.rounds)
+			if t.lastHit > 0 {
+				ts.CurrentStreak = lastObserved - t.lastHit
+			} else {
+				ts.CurrentStreak = lastObserved - st.first + 1
+			}
+		}
+		ts.DueIn = expected - float64(ts.CurrentStreak)
+		ts.StreakPValue = dryRunPValue(ts.CurrentStreak, p)
+
+		last := t.gaps
+		if len(last) > st.cfg.LastK {
+			last = last[len(last)-st.cfg.LastK:]
+		}
+		ts.LastGaps = append(ts.LastGaps, last...)
+		ts.LastGapsPValue = 1
+		if len(last) > 0 {
+			sizes := make([]float64, len(last))
+			var total int64
+			for j, g := range last {
+				sizes[j] = float64(g.Gap)
+				total += g.Gap
+				if math.Abs(g.Deviation) <= st.cfg.Band {
+					ts.WithinBand++
+				}
+			}
+			ts.MeanGap = float64(total) / float64(len(last))
+			ts.MedianGap = median(sizes)
+			ts.LastGapsPValue = gapSumPValue(int64(len(last)), total, p)
+		}
+
+		rolling := Rolling{Rounds: int64(len(st.window)), Hits: int64(len(t.recent))}
+		rolling.Expected = float64(rolling.Rounds) * p
+		if rolling.Rounds > 0 {
+			rolling.Rate = float64(rolling.Hits) / float64(rolling.Rounds)
+		}
+		rolling.PValue = hitCountPValue(rolling.Rounds, rolling.Hits, p)
+		ts.Rolling = rolling
+
+		if series {
+			ts.Gaps = append([]Gap{}, t.gaps...)
+		}
+		out.Tiers[i] = ts
+	}
+	return out
+}
+
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
@@ -0,0 +1,105 @@
+package liveanalytics
+
+import (
+	"context"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+)
+
+// pumpStream stores rounds 1..n with results spread like Pump multipliers
+// at expert difficulty, so every default tier is hit a few times
+func pumpStream(t *testing.T, n int64) (*livestore.Store, uuid.UUID) {
+	t.Helper()
+	ctx := context.Background()
+	st, err := livestore.New(filepath.Join(t.TempDir(), "live.db"))
+	if err != nil {
+		t.Fatalf("livestore.New: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	id, err := st.FindOrCreateStream(ctx, "hash", "client")
+	if err != nil {
+		t.Fatalf("FindOrCreateStream: %v", err)
+	}
+
+	rng := rand.New(rand.NewSource(48))
+	base := time.Now().Add(-24 * time.Hour)
+	rounds := make([]livestore.LiveRound, n)
+	for i := range rounds {
+		nonce := int64(i + 1)
+		rounds[i] = livestore.LiveRound{
+			Nonce:       nonce,
+			RoundResult: 0.99 / (1 - rng.Float64()*0.99999),
+			ReceivedAt:  base.Add(time.Duration(nonce) * time.Second),
+		}
+	}
+	if _, err := st.ImportRounds(ctx, id, rounds); err != nil {
+		t.Fatalf("ImportRounds: %v", err)
+	}
+	return st, id
+}
+
+func TestAnalyticsSurviveCompaction(t *testing.T) {
+	ctx := context.Background()
+	st, id := pumpStream(t, 30000)
+	s := New(st)
+	cfg := s.Config()
+	cfg.Window = 2000
+
+	// The same stream under the tiers compacted with and under a set of
+	// higher ones chosen afterwards
+	raised := cfg
+	raised.Tiers = []float64{400.02, 1066.73, 2000}
+	analyse := func(c Config) StreamAnalytics {
+		t.Helper()
+		if err := s.SetConfig(c); err != nil {
+			t.Fatalf("SetConfig: %v", err)
+		}
+		a, err := s.Stream(ctx, id, true)
+		if err != nil {
+			t.Fatalf("Stream: %v", err)
+		}
+		return a
+	}
+	before, beforeRaised := analyse(cfg), analyse(raised)
+	for _, ts := range before.Tiers[:3] {
+		if len(ts.Gaps) < 2 {
+			t.Fatalf("fixture too sparse: tier %g has %d gaps", ts.Threshold, len(ts.Gaps))
+		}
+	}
+
+	res, err := st.CompactRounds(ctx, id, livestore.RetentionPolicy{KeepLast: 100, KeepAbove: 3000, BlockSize: 7000},
+		livestore.CompactOptions{Tiers: cfg.Tiers, Protect: cfg.Window})
+	if err != nil {
+		t.Fatalf("CompactRounds: %v", err)
+	}
+	if res.Compacted < 25000 {
+		t.Fatalf("expected most rounds compacted, got %+v", res)
+	}
+
+	if after := analyse(cfg); !reflect.DeepEqual(before, after) {
+		t.Fatalf("analytics changed with compaction:\nbefore %+v\nafter  %+v", before, after)
+	}
+	if after := analyse(raised); !reflect.DeepEqual(beforeRaised, after) {
+		t.Fatalf("analytics of raised tiers changed with compaction:\nbefore %+v\nafter  %+v", beforeRaised, after)
+	}
+
+	// A tier below the lowest compacted with can't be recovered
+	lowered := cfg
+	lowered.Tiers = append([]float64{50}, cfg.Tiers...)
+	after := analyse(lowered)
+	if !after.Tiers[0].Partial {
+		t.Errorf("expected the 50x tier partial after compaction")
+	}
+	for _, ts := range after.Tiers[1:] {
+		if ts.Partial {
+			t.Errorf("tier %g: expected whole", ts.Threshold)
+		}
+	}
+}
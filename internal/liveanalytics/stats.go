@@ -0,0 +1,102 @@
+package liveanalytics
+
+import "math"
+
+// Hits of a tier are Bernoulli trials with the tier's probability p, so
+// the hit count over n rounds is Binomial(n, p) and the gaps between hits
+// are geometric with mean 1/p. Both tests below reduce to binomial tails.
+
+// binomLogPMF is log P(X = k) for X ~ Binomial(n, p), 0 < p < 1
+func binomLogPMF(n, k int64, p float64) float64 {
+	lg := func(x int64) float64 {
+		v, _ := math.Lgamma(float64(x) + 1)
+		return v
+	}
+	return lg(n) - lg(k) - lg(n-k) + float64(k)*math.Log(p) + float64(n-k)*math.Log1p(-p)
+}
+
+// binomMode is the most likely value of Binomial(n, p)
+func binomMode(n int64, p float64) int64 {
+	m := int64(math.Floor(float64(n+1) * p))
+	if m > n {
+		m = n
+	}
+	return m
+}
+
+// sumPMF adds P(X = i) from i = from, stepping by step, until the terms
+// stop mattering or i leaves [0, n]. Starting at the end nearest the mode
+// and walking away from it, the terms only shrink.
+func sumPMF(n, from, step int64, p float64) float64 {
+	sum := 0.0
+	for i := from; i >= 0 && i <= n; i += step {
+		term := math.Exp(binomLogPMF(n, i, p))
+		sum += term
+		if term < sum*1e-17 || (sum == 0 && term == 0) {
+			break
+		}
+	}
+	return sum
+}
+
+// binomCDF is P(X <= k)
+func binomCDF(n, k int64, p float64) float64 {
+	switch {
+	case k < 0:
+		return 0
+	case k >= n:
+		return 1
+	case k < binomMode(n, p):
+		return clamp01(sumPMF(n, k, -1, p))
+	}
+	return clamp01(1 - sumPMF(n, k+1, 1, p))
+}
+
+// binomSF is P(X >= k)
+func binomSF(n, k int64, p float64) float64 {
+	switch {
+	case k <= 0:
+		return 1
+	case k > n:
+		return 0
+	case k > binomMode(n, p):
+		return clamp01(sumPMF(n, k, 1, p))
+	}
+	return clamp01(1 - sumPMF(n, k-1, -1, p))
+}
+
+// hitCountPValue is the two-sided p-value of seeing hits in rounds rounds
+func hitCountPValue(rounds, hits int64, p float64) float64 {
+	if rounds == 0 {
+		return 1
+	}
+	return twoSided(binomCDF(rounds, hits, p), binomSF(rounds, hits, p))
+}
+
+// gapSumPValue is the two-sided p-value of k consecutive gaps adding up to
+// total. The k-th hit lands within total rounds exactly when those rounds
+// hold at least k hits.
+func gapSumPValue(k, total int64, p float64) float64 {
+	if k == 0 {
+		return 1
+	}
+	atMost := binomSF(total, k, p)       // P(sum <= total)
+	atLeast := binomCDF(total-1, k-1, p) // P(sum >= total)
+	return twoSided(atMost, atLeast)
+}
+
+// dryRunPValue is the chance of going streak rounds without a hit
+func dryRunPValue(streak int64, p float64) float64 {
+	if streak <= 0 {
+		return 1
+	}
+	return math.Exp(float64(streak) * math.Log1p(-p))
+}
+
+func twoSided(lower, upper float64) float64 {
+	return clamp01(2 * math.Min(lower, upper))
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
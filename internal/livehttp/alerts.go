@@ -0,0 +1,166 @@
+package livehttp
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livealerts"
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+)
+
+// GET|POST /live/alerts/rules
+func (s *Server) handleAlertRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := s.alerts.Rules(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to list alert rules", ""))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"rules": rules, "count": len(rules)})
+	case http.MethodPost:
+		rule, ok := decodeAlertRule(w, r)
+		if !ok {
+			return
+		}
+		rule.ID = 0
+		s.saveAlertRule(w, r, rule, http.StatusCreated)
+	default:
+		methodNotAllowed(w, "GET, POST")
+	}
+}
+
+// GET|PUT|DELETE /live/alerts/rules/{id}
+func (s *Server) handleAlertRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/live/alerts/rules/"), 10, 64)
+	if err != nil || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, errObj("VALIDATION_ERROR", "invalid rule id", "id"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rule, err := s.store.GetAlertRule(r.Context(), id)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			writeJSON(w, http.StatusNotFound, errObj("NOT_FOUND", "alert rule not found", "id"))
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to load alert rule", ""))
+		default:
+			writeJSON(w, http.StatusOK, rule)
+		}
+	case http.MethodPut:
+		rule, ok := decodeAlertRule(w, r)
+		if !ok {
+			return
+		}
+		rule.ID = id
+		s.saveAlertRule(w, r, rule, http.StatusOK)
+	case http.MethodDelete:
+		err := s.alerts.DeleteRule(r.Context(), id)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			writeJSON(w, http.StatusNotFound, errObj("NOT_FOUND", "alert rule not found", "id"))
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to delete alert rule", ""))
+		default:
+			writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+		}
+	default:
+		methodNotAllowed(w, "GET, PUT, DELETE")
+	}
+}
+
+// decodeAlertRule reads and validates a rule body, replying on failure.
+// Rules are enabled unless the body says otherwise.
+func decodeAlertRule(w http.ResponseWriter, r *http.Request) (livestore.AlertRule, bool) {
+	rule := livestore.AlertRule{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "invalid JSON", ""))
+		return rule, false
+	}
+	if err := livealerts.Validate(&rule); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", err.Error(), ""))
+		return rule, false
+	}
+	return rule, true
+}
+
+func (s *Server) saveAlertRule(w http.ResponseWriter, r *http.Request, rule livestore.AlertRule, status int) {
+	saved, err := s.alerts.SaveRule(r.Context(), rule)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, errObj("NOT_FOUND", "alert rule not found", "id"))
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to save alert rule", ""))
+	default:
+		writeJSON(w, status, saved)
+	}
+}
+
+// POST /live/alerts/test with {"rule": {...}, "stream_id": "..."}
+func (s *Server) handleAlertTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, "POST")
+		return
+	}
+	var body struct {
+		Rule     livestore.AlertRule `json:"rule"`
+		StreamID string              `json:"stream_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "invalid JSON", ""))
+		return
+	}
+	streamID, err := uuid.Parse(body.StreamID)
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "invalid stream id", "stream_id"))
+		return
+	}
+	body.Rule.Enabled = true
+	if err := livealerts.Validate(&body.Rule); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", err.Error(), "rule"))
+		return
+	}
+
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	res, err := s.alerts.Test(r.Context(), body.Rule, streamID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, errObj("NOT_FOUND", "stream not found", "stream_id"))
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to test alert rule", ""))
+	default:
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+// GET /live/alerts/firings?rule_id=&stream_id=&limit=
+func (s *Server) handleAlertFirings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, "GET")
+		return
+	}
+	var streamID *uuid.UUID
+	if v := r.URL.Query().Get("stream_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errObj("VALIDATION_ERROR", "invalid stream id", "stream_id"))
+			return
+		}
+		streamID = &id
+	}
+	firings, err := s.alerts.Firings(r.Context(), qInt64(r, "rule_id", 0), streamID, qInt(r, "limit", 100))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to list alert firings", ""))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"firings": firings, "count": len(firings)})
+}
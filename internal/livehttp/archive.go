@@ -0,0 +1,205 @@
+package livehttp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/liveanalytics"
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+	"github.com/MJE43/stake-pf-replay-go/bindings"
+)
+
+const (
+	streamsFile = "live_streams.ndjson"
+	betsFile    = "live_bets.ndjson"
+	roundsFile  = "live_rounds.ndjson"
+	blocksFile  = "live_round_blocks.ndjson"
+
+	archiveBatch = 5000
+)
+
+// archivedStream is a stream record in an archive. The plain server seed
+// travels with it when a seed alias is known.
+type archivedStream struct {
+	livestore.LiveStream
+	ServerSeedPlain string `json:"server_seed_plain,omitempty"`
+}
+
+// liveArchive archives streams with their bets, rounds and the blocks
+// retention compacted rounds into. Streams are matched on their (server
+// seed hash, client seed) pair, so importing a stream that exists locally
+// merges into it; bets and rounds already there (by nonce, or antebot bet
+// id for bets) are skipped, as are blocks over nonces it already covers.
+type liveArchive struct {
+	store     *livestore.Store
+	analytics *liveanalytics.Service
+}
+
+// ArchiveSection archives the module's live streams, under the "streams"
+// selection key.
+func ArchiveSection(m *LiveModule) bindings.ArchiveSection {
+	return liveArchive{store: m.store, analytics: m.analytics}
+}
+
+func (a liveArchive) Name() string { return "streams" }
+
+func (a liveArchive) Export(ctx context.Context, w *bindings.ArchiveWriter, ids []string) error {
+	var streams []uuid.UUID
+	seen := map[uuid.UUID]bool{}
+	for _, raw := range ids {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("invalid stream id: %w", err)
+		}
+		if !seen[id] {
+			seen[id] = true
+			streams = append(streams, id)
+		}
+	}
+
+	rec, err := w.Create(streamsFile)
+	if err != nil {
+		return err
+	}
+	for _, id := range streams {
+		ls, err := a.store.GetStream(ctx, id)
+		if err != nil {
+			return fmt.Errorf("stream %s: %w", id, err)
+		}
+		plain, _, err := a.store.LookupSeedAlias(ctx, ls.ServerSeedHashed)
+		if err != nil {
+			return err
+		}
+		if err := rec.Write(archivedStream{LiveStream: ls, ServerSeedPlain: plain}); err != nil {
+			return err
+		}
+	}
+
+	if rec, err = w.Create(betsFile); err != nil {
+		return err
+	}
+	for _, id := range streams {
+		err := a.store.EachBet(ctx, id, func(b livestore.LiveBet) error { return rec.Write(b) })
+		if err != nil {
+			return err
+		}
+	}
+
+	if rec, err = w.Create(roundsFile); err != nil {
+		return err
+	}
+	for _, id := range streams {
+		err := a.store.EachRound(ctx, id, func(r livestore.LiveRound) error { return rec.Write(r) })
+		if err != nil {
+			return err
+		}
+	}
+
+	if rec, err = w.Create(blocksFile); err != nil {
+		return err
+	}
+	for _, id := range streams {
+		blocks, err := a.store.RoundBlocks(ctx, id)
+		if err != nil {
+			return err
+		}
+		for _, b := range blocks {
+			if err := rec.Write(b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a liveArchive) Import(ctx context.Context, r *bindings.ArchiveReader) (bindings.ArchiveStats, error) {
+	var stats bindings.ArchiveStats
+	mapped := map[uuid.UUID]uuid.UUID{}
+	err := bindings.EachArchiveRecord(r, streamsFile, func(s archivedStream) error {
+		id, created, err := a.store.ImportStream(ctx, s.LiveStream)
+		if err != nil {
+			return err
+		}
+		if created {
+			stats.Added++
+		} else {
+			stats.Duplicates++
+		}
+		mapped[s.ID] = id
+		if s.ServerSeedPlain == "" {
+			return nil
+		}
+		if _, known, err := a.store.LookupSeedAlias(ctx, s.ServerSeedHashed); err != nil || known {
+			return err
+		}
+		if err := a.store.UpsertSeedAlias(ctx, s.ServerSeedHashed, s.ServerSeedPlain); err != nil {
+			return err
+		}
+		return a.store.VerifyStreamState(ctx, id)
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	if err := importBatched(ctx, r, betsFile, mapped, &stats,
+		func(b livestore.LiveBet) uuid.UUID { return b.StreamID },
+		a.store.ImportBets); err != nil {
+		return stats, err
+	}
+	// Blocks go in before the rounds they kept, which would otherwise
+	// look like local rounds in their range
+	if err := importBatched(ctx, r, blocksFile, mapped, &stats,
+		func(b livestore.RoundBlock) uuid.UUID { return b.StreamID },
+		a.store.ImportRoundBlocks); err != nil {
+		return stats, err
+	}
+	err = importBatched(ctx, r, roundsFile, mapped, &stats,
+		func(r livestore.LiveRound) uuid.UUID { return r.StreamID },
+		a.store.ImportRounds)
+	for _, id := range mapped {
+		a.analytics.Invalidate(id)
+	}
+	return stats, err
+}
+
+// importBatched reads the records of file, groups them by local stream and
+// saves them in batches with save, counting what was added and skipped
+func importBatched[T any](ctx context.Context, r *bindings.ArchiveReader, file string,
+	mapped map[uuid.UUID]uuid.UUID, stats *bindings.ArchiveStats,
+	streamOf func(T) uuid.UUID, save func(context.Context, uuid.UUID, []T) (int, error)) error {
+	var pending []T
+	var pendingStream uuid.UUID
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		added, err := save(ctx, pendingStream, pending)
+		if err != nil {
+			return err
+		}
+		stats.Items += added
+		stats.ItemDuplicates += len(pending) - added
+		pending = pending[:0]
+		return nil
+	}
+	err := bindings.EachArchiveRecord(r, file, func(v T) error {
+		local, ok := mapped[streamOf(v)]
+		if !ok {
+			return fmt.Errorf("%s: record of stream %s, which isn't in the archive", file, streamOf(v))
+		}
+		if local != pendingStream || len(pending) >= archiveBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+			pendingStream = local
+		}
+		pending = append(pending, v)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
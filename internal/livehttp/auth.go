@@ -0,0 +1,396 @@
+package livehttp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+)
+
+// Signed ingest requests carry these headers. The signature is the hex
+// HMAC-SHA256, under the key's secret, of "<timestamp>\n<nonce>\n<body>".
+const (
+	headerKeyID     = "X-Ingest-Key-Id"
+	headerTimestamp = "X-Ingest-Timestamp" // unix seconds
+	headerNonce     = "X-Ingest-Nonce"     // unique per request, 8 to 128 characters
+	headerSignature = "X-Ingest-Signature"
+)
+
+const (
+	// maxIngestSkew is how far a signed request's timestamp may be from
+	// the local clock
+	maxIngestSkew = 5 * time.Minute
+	// maxIngestNonces bounds the nonces remembered to refuse replays;
+	// signed requests are refused while it is full
+	maxIngestNonces = 200_000
+	// keyTouchInterval spaces out last_used_at updates of a key
+	keyTouchInterval = time.Minute
+)
+
+// Reasons an ingest request is refused, as recorded in the audit
+const (
+	rejectMissingToken    = "missing_token"
+	rejectBadToken        = "bad_token"
+	rejectUnsigned        = "unsigned"
+	rejectUnknownKey      = "unknown_key"
+	rejectRevokedKey      = "revoked_key"
+	rejectBadTimestamp    = "bad_timestamp"
+	rejectClockSkew       = "clock_skew"
+	rejectBadNonce        = "bad_nonce"
+	rejectBadSignature    = "bad_signature"
+	rejectReplay          = "replayed_nonce"
+	rejectReplayCacheFull = "replay_cache_full"
+)
+
+// ingestAuth decides whether an ingest request may be stored. A request
+// with a signature is checked against its key whatever the settings;
+// otherwise it needs the static token, if one is set, unless signing is
+// required.
+type ingestAuth struct {
+	store *livestore.Store
+
+	mu              sync.Mutex
+	token           string
+	signingRequired bool
+	keys            map[string]livestore.IngestKey
+	nonces          map[string]time.Time // "<key id>\n<nonce>" until it can no longer pass the skew check
+	touched         map[string]time.Time
+}
+
+func newIngestAuth(store *livestore.Store, token string) *ingestAuth {
+	return &ingestAuth{
+		store:   store,
+		token:   token,
+		keys:    map[string]livestore.IngestKey{},
+		nonces:  map[string]time.Time{},
+		touched: map[string]time.Time{},
+	}
+}
+
+// load reads the rotated token, the signing setting and the signing keys.
+// The token given at startup stands until one is rotated in.
+func (a *ingestAuth) load(ctx context.Context) error {
+	token, rotated, err := a.store.Setting(ctx, livestore.SettingIngestToken)
+	if err != nil {
+		return err
+	}
+	required, _, err := a.store.Setting(ctx, livestore.SettingSigningRequired)
+	if err != nil {
+		return err
+	}
+	keys, err := a.store.ListIngestKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if rotated {
+		a.token = token
+	}
+	a.signingRequired = required == "1"
+	a.keys = map[string]livestore.IngestKey{}
+	for _, k := range keys {
+		a.keys[k.KeyID] = k
+	}
+	return nil
+}
+
+// enabled reports whether ingest needs a token or a signature
+func (a *ingestAuth) enabled() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.token != "" || a.signingRequired
+}
+
+// feedAllowed decides on a feed request. Feeds are open only while ingest
+// is; otherwise they need the static token, if one is set, or a signature
+// made as for ingest with the request path in place of the body. Browsers
+// can't set headers on EventSource or WebSocket, so the token and the
+// signature may also come as ?token=, or ?key_id=, ?timestamp=, ?nonce=
+// and ?signature=.
+func (a *ingestAuth) feedAllowed(r *http.Request, now time.Time) bool {
+	a.mu.Lock()
+	token, required := a.token, a.signingRequired
+	a.mu.Unlock()
+	if token == "" && !required {
+		return true
+	}
+	q := r.URL.Query()
+	if token != "" {
+		for _, got := range []string{r.Header.Get("X-Ingest-Token"), q.Get("token")} {
+			if got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+				return true
+			}
+		}
+	}
+	param := func(header, query string) string {
+		if v := r.Header.Get(header); v != "" {
+			return v
+		}
+		return q.Get(query)
+	}
+	sig := param(headerSignature, "signature")
+	if sig == "" {
+		return false
+	}
+	return a.verify(param(headerKeyID, "key_id"), param(headerTimestamp, "timestamp"),
+		param(headerNonce, "nonce"), sig, []byte(r.URL.Path), now) == ""
+}
+
+// signed reports whether a request claims to be signed
+func signed(r *http.Request) bool {
+	return r.Header.Get(headerSignature) != ""
+}
+
+// check decides on a request with the given body. It returns the reason
+// it is refused, or "" when it may be stored, and the key it named.
+func (a *ingestAuth) check(r *http.Request, body []byte, now time.Time) (reason, keyID string) {
+	if !signed(r) {
+		a.mu.Lock()
+		required, token := a.signingRequired, a.token
+		a.mu.Unlock()
+		got := r.Header.Get("X-Ingest-Token")
+		switch {
+		case required:
+			return rejectUnsigned, ""
+		case token == "":
+			return "", ""
+		case got == "":
+			return rejectMissingToken, ""
+		case subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1:
+			return rejectBadToken, ""
+		}
+		return "", ""
+	}
+
+	keyID = r.Header.Get(headerKeyID)
+	return a.verify(keyID, r.Header.Get(headerTimestamp), r.Header.Get(headerNonce),
+		r.Header.Get(headerSignature), body, now), keyID
+}
+
+// verify checks a signature over body and, if it holds, spends its nonce.
+// It returns the reason it is refused, or "" when it holds.
+func (a *ingestAuth) verify(keyID, timestamp, nonce, signature string, body []byte, now time.Time) string {
+	a.mu.Lock()
+	key, ok := a.keys[keyID]
+	a.mu.Unlock()
+	switch {
+	case !ok:
+		return rejectUnknownKey
+	case key.RevokedAt != nil:
+		return rejectRevokedKey
+	}
+
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return rejectBadTimestamp
+	}
+	ts := time.Unix(secs, 0)
+	if skew := now.Sub(ts); skew > maxIngestSkew || skew < -maxIngestSkew {
+		return rejectClockSkew
+	}
+	if len(nonce) < 8 || len(nonce) > 128 || strings.ContainsAny(nonce, "\r\n") {
+		return rejectBadNonce
+	}
+
+	mac := hmac.New(sha256.New, []byte(key.Secret))
+	fmt.Fprintf(mac, "%d\n%s\n", secs, nonce)
+	mac.Write(body)
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || !hmac.Equal(got, mac.Sum(nil)) {
+		return rejectBadSignature
+	}
+
+	// Only nonces of genuine requests are remembered, so forged ones can't
+	// fill the cache
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	seen := keyID + "\n" + nonce
+	if _, dup := a.nonces[seen]; dup {
+		return rejectReplay
+	}
+	if len(a.nonces) >= maxIngestNonces {
+		for n, until := range a.nonces {
+			if now.After(until) {
+				delete(a.nonces, n)
+			}
+		}
+		if len(a.nonces) >= maxIngestNonces {
+			return rejectReplayCacheFull
+		}
+	}
+	a.nonces[seen] = ts.Add(maxIngestSkew)
+	if now.Sub(a.touched[keyID]) >= keyTouchInterval {
+		a.touched[keyID] = now
+		go func() {
+			if err := a.store.TouchIngestKey(context.Background(), keyID, now); err != nil {
+				fmt.Printf("[livehttp] warning: recording use of ingest key %s failed: %v\n", keyID, err)
+			}
+		}()
+	}
+	return ""
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// IngestKeySecret is a new signing key with its secret, which is only
+// ever shown this once.
+type IngestKeySecret struct {
+	livestore.IngestKey
+	Secret string `json:"secret"`
+}
+
+// createKey adds a signing key
+func (a *ingestAuth) createKey(ctx context.Context, label string) (IngestKeySecret, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return IngestKeySecret{}, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return IngestKeySecret{}, err
+	}
+	k := livestore.IngestKey{
+		KeyID:     "k_" + id,
+		Label:     strings.TrimSpace(label),
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := a.store.CreateIngestKey(ctx, k); err != nil {
+		return IngestKeySecret{}, err
+	}
+	if err := a.load(ctx); err != nil {
+		return IngestKeySecret{}, err
+	}
+	return IngestKeySecret{IngestKey: k, Secret: secret}, nil
+}
+
+// revokeKey stops a key from signing. The last active key can't be
+// revoked while signing is required.
+func (a *ingestAuth) revokeKey(ctx context.Context, keyID string) error {
+	a.mu.Lock()
+	k, ok := a.keys[keyID]
+	last := ok && k.RevokedAt == nil && a.signingRequired && a.activeKeys() == 1
+	a.mu.Unlock()
+	if last {
+		return errors.New("can't revoke the last active key while signing is required")
+	}
+	if err := a.store.RevokeIngestKey(ctx, keyID); err != nil {
+		return err
+	}
+	return a.load(ctx)
+}
+
+// rotateToken replaces the static token with a random one and returns it
+func (a *ingestAuth) rotateToken(ctx context.Context) (string, error) {
+	token, err := randomHex(24)
+	if err != nil {
+		return "", err
+	}
+	if err := a.store.PutSetting(ctx, livestore.SettingIngestToken, token); err != nil {
+		return "", err
+	}
+	return token, a.load(ctx)
+}
+
+// setSigningRequired refuses or accepts unsigned ingest. Requiring
+// signatures needs an active key, so senders aren't all locked out.
+func (a *ingestAuth) setSigningRequired(ctx context.Context, required bool) error {
+	value := "0"
+	if required {
+		a.mu.Lock()
+		active := a.activeKeys()
+		a.mu.Unlock()
+		if active == 0 {
+			return errors.New("create a signing key before requiring signatures")
+		}
+		value = "1"
+	}
+	if err := a.store.PutSetting(ctx, livestore.SettingSigningRequired, value); err != nil {
+		return err
+	}
+	return a.load(ctx)
+}
+
+// activeKeys counts keys that aren't revoked; a.mu must be held
+func (a *ingestAuth) activeKeys() int {
+	n := 0
+	for _, k := range a.keys {
+		if k.RevokedAt == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// authorizeIngest checks an ingest request and returns its body. A
+// refused request is answered, audited and reported on
+// "live:ingest:rejected", and ok is false.
+func (s *Server) authorizeIngest(w http.ResponseWriter, r *http.Request) (body []byte, ok bool) {
+	var tooBig *http.MaxBytesError
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestBody))
+	switch {
+	case errors.As(err, &tooBig):
+		writeJSON(w, http.StatusRequestEntityTooLarge, errObj("VALIDATION_ERROR", "request body too large", ""))
+		return nil, false
+	case err != nil:
+		writeJSON(w, http.StatusBadRequest, errObj("VALIDATION_ERROR", "failed to read body", ""))
+		return nil, false
+	}
+
+	now := time.Now()
+	reason, keyID := s.auth.check(r, body, now)
+	if reason == "" {
+		return body, true
+	}
+	rej := livestore.IngestRejection{
+		At:         now.UTC(),
+		RemoteAddr: r.RemoteAddr,
+		KeyID:      keyID,
+		Reason:     reason,
+		Path:       r.URL.Path,
+		Detail:     r.UserAgent(),
+	}
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		rej.Detail = strings.TrimSpace("forwarded for " + fwd + "; " + rej.Detail)
+	}
+	if rej.ID, err = s.store.RecordIngestRejection(r.Context(), rej); err != nil {
+		fmt.Printf("[livehttp] warning: failed to audit rejected ingest: %v\n", err)
+	}
+	fmt.Printf("[livehttp] rejected ingest from %s: %s\n", r.RemoteAddr, reason)
+	if s.wailsCtx != nil {
+		runtime.EventsEmit(s.wailsCtx, "live:ingest:rejected", rej)
+	}
+
+	msg := "missing or invalid X-Ingest-Token"
+	switch {
+	case reason == rejectUnsigned:
+		msg = "ingest requests must be signed"
+	case signed(r):
+		msg = "invalid ingest signature: " + strings.ReplaceAll(reason, "_", " ")
+	}
+	writeJSON(w, http.StatusUnauthorized, errObj("UNAUTHORIZED", msg, ""))
+	return nil, false
+}
@@ -0,0 +1,332 @@
+package livehttp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sign returns the signature of body as a sender would make it
+func sign(secret string, ts int64, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d\n%s\n", ts, nonce)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedRequest builds an ingest request signed under key at ts
+func signedRequest(key IngestKeySecret, ts time.Time, nonce, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/live/ingest", strings.NewReader(body))
+	r.Header.Set(headerKeyID, key.KeyID)
+	r.Header.Set(headerTimestamp, strconv.FormatInt(ts.Unix(), 10))
+	r.Header.Set(headerNonce, nonce)
+	r.Header.Set(headerSignature, sign(key.Secret, ts.Unix(), nonce, []byte(body)))
+	return r
+}
+
+func newTestAuth(t *testing.T, token string) (*ingestAuth, IngestKeySecret) {
+	t.Helper()
+	a := newIngestAuth(newTestStore(t), token)
+	if err := a.load(context.Background()); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	key, err := a.createKey(context.Background(), "sender")
+	if err != nil {
+		t.Fatalf("createKey: %v", err)
+	}
+	return a, key
+}
+
+func TestIngestSignatureVerification(t *testing.T) {
+	a, key := newTestAuth(t, "")
+	now := time.Now()
+	body := `{"nonce":1}`
+
+	r := signedRequest(key, now, "nonce-0001", body)
+	if reason, keyID := a.check(r, []byte(body), now); reason != "" || keyID != key.KeyID {
+		t.Fatalf("expected a valid signature to pass, got %q for %q", reason, keyID)
+	}
+
+	tests := []struct {
+		name   string
+		edit   func(r *http.Request)
+		body   string
+		reason string
+	}{
+		{"tampered body", nil, `{"nonce":2}`, rejectBadSignature},
+		{"wrong secret", func(r *http.Request) {
+			r.Header.Set(headerSignature, sign("not the secret", now.Unix(), "nonce-0002", []byte(body)))
+		}, body, rejectBadSignature},
+		{"not hex", func(r *http.Request) { r.Header.Set(headerSignature, "zz") }, body, rejectBadSignature},
+		{"unknown key", func(r *http.Request) { r.Header.Set(headerKeyID, "k_missing") }, body, rejectUnknownKey},
+		{"bad timestamp", func(r *http.Request) { r.Header.Set(headerTimestamp, "soon") }, body, rejectBadTimestamp},
+		{"short nonce", func(r *http.Request) { r.Header.Set(headerNonce, "abc") }, body, rejectBadNonce},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := signedRequest(key, now, "nonce-0002", body)
+			if tt.edit != nil {
+				tt.edit(r)
+			}
+			if reason, _ := a.check(r, []byte(tt.body), now); reason != tt.reason {
+				t.Fatalf("expected %q, got %q", tt.reason, reason)
+			}
+		})
+	}
+
+	// A prefixed signature is accepted too
+	r = signedRequest(key, now, "nonce-0003", body)
+	r.Header.Set(headerSignature, "sha256="+r.Header.Get(headerSignature))
+	if reason, _ := a.check(r, []byte(body), now); reason != "" {
+		t.Fatalf("expected a sha256= signature to pass, got %q", reason)
+	}
+}
+
+func TestIngestClockSkew(t *testing.T) {
+	a, key := newTestAuth(t, "")
+	now := time.Now()
+	body := `{}`
+	for i, tt := range []struct {
+		offset time.Duration
+		reason string
+	}{
+		{-maxIngestSkew + time.Second, ""},
+		{maxIngestSkew - time.Second, ""},
+		{-maxIngestSkew - time.Second, rejectClockSkew},
+		{maxIngestSkew + time.Second, rejectClockSkew},
+	} {
+		r := signedRequest(key, now.Add(tt.offset), fmt.Sprintf("skew-nonce-%d", i), body)
+		if reason, _ := a.check(r, []byte(body), now); reason != tt.reason {
+			t.Errorf("offset %s: expected %q, got %q", tt.offset, tt.reason, reason)
+		}
+	}
+}
+
+func TestIngestNonceReplay(t *testing.T) {
+	a, key := newTestAuth(t, "")
+	now := time.Now()
+	body := `{}`
+
+	if reason, _ := a.check(signedRequest(key, now, "replayed-nonce", body), []byte(body), now); reason != "" {
+		t.Fatalf("first use: expected to pass, got %q", reason)
+	}
+	if reason, _ := a.check(signedRequest(key, now, "replayed-nonce", body), []byte(body), now); reason != rejectReplay {
+		t.Fatalf("second use: expected %q, got %q", rejectReplay, reason)
+	}
+
+	// A forged request doesn't spend the nonce it names
+	forged := signedRequest(key, now, "unspent-nonce", body)
+	forged.Header.Set(headerSignature, sign("forged", now.Unix(), "unspent-nonce", []byte(body)))
+	if reason, _ := a.check(forged, []byte(body), now); reason != rejectBadSignature {
+		t.Fatalf("forged: expected %q, got %q", rejectBadSignature, reason)
+	}
+	if reason, _ := a.check(signedRequest(key, now, "unspent-nonce", body), []byte(body), now); reason != "" {
+		t.Fatalf("after a forgery: expected to pass, got %q", reason)
+	}
+
+	// Expired nonces are dropped to make room once the cache is full
+	a.mu.Lock()
+	for i := len(a.nonces); i < maxIngestNonces; i++ {
+		a.nonces[fmt.Sprintf("old\n%d", i)] = now.Add(-time.Second)
+	}
+	a.mu.Unlock()
+	if reason, _ := a.check(signedRequest(key, now, "fresh-nonce", body), []byte(body), now); reason != "" {
+		t.Fatalf("with expired nonces: expected to pass, got %q", reason)
+	}
+	if reason, _ := a.check(signedRequest(key, now, "replayed-nonce", body), []byte(body), now); reason != rejectReplay {
+		t.Fatalf("after pruning: expected %q, got %q", rejectReplay, reason)
+	}
+}
+
+func TestIngestKeyAndTokenRotation(t *testing.T) {
+	ctx := context.Background()
+	a, oldKey := newTestAuth(t, "startup-token")
+	now := time.Now()
+	body := `{}`
+
+	newKey, err := a.createKey(ctx, "replacement")
+	if err != nil {
+		t.Fatalf("createKey: %v", err)
+	}
+	if err := a.setSigningRequired(ctx, true); err != nil {
+		t.Fatalf("setSigningRequired: %v", err)
+	}
+	if err := a.revokeKey(ctx, oldKey.KeyID); err != nil {
+		t.Fatalf("revokeKey: %v", err)
+	}
+	if reason, _ := a.check(signedRequest(oldKey, now, "old-key-nonce", body), []byte(body), now); reason != rejectRevokedKey {
+		t.Fatalf("revoked key: expected %q, got %q", rejectRevokedKey, reason)
+	}
+	if reason, _ := a.check(signedRequest(newKey, now, "new-key-nonce", body), []byte(body), now); reason != "" {
+		t.Fatalf("new key: expected to pass, got %q", reason)
+	}
+	if err := a.revokeKey(ctx, newKey.KeyID); err == nil {
+		t.Fatal("expected the last active key to stay while signing is required")
+	}
+
+	// Unsigned requests are refused while signing is required, token or not
+	unsigned := httptest.NewRequest(http.MethodPost, "/live/ingest", strings.NewReader(body))
+	unsigned.Header.Set("X-Ingest-Token", "startup-token")
+	if reason, _ := a.check(unsigned, []byte(body), now); reason != rejectUnsigned {
+		t.Fatalf("unsigned: expected %q, got %q", rejectUnsigned, reason)
+	}
+
+	if err := a.setSigningRequired(ctx, false); err != nil {
+		t.Fatalf("setSigningRequired: %v", err)
+	}
+	token, err := a.rotateToken(ctx)
+	if err != nil {
+		t.Fatalf("rotateToken: %v", err)
+	}
+	if reason, _ := a.check(unsigned, []byte(body), now); reason != rejectBadToken {
+		t.Fatalf("startup token after rotation: expected %q, got %q", rejectBadToken, reason)
+	}
+	unsigned.Header.Set("X-Ingest-Token", token)
+	if reason, _ := a.check(unsigned, []byte(body), now); reason != "" {
+		t.Fatalf("rotated token: expected to pass, got %q", reason)
+	}
+
+	// The rotated token outlives a restart; the startup token doesn't
+	restarted := newIngestAuth(a.store, "startup-token")
+	if err := restarted.load(ctx); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if reason, _ := restarted.check(unsigned, []byte(body), now); reason != "" {
+		t.Fatalf("rotated token after restart: expected to pass, got %q", reason)
+	}
+}
+
+func TestIngestRejectionAudit(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+	s := New(nil, st, 0, "secret-token")
+	if err := s.auth.load(ctx); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	key, err := s.auth.createKey(ctx, "sender")
+	if err != nil {
+		t.Fatalf("createKey: %v", err)
+	}
+
+	body := `{"nonce":1}`
+	missing := httptest.NewRequest(http.MethodPost, "/live/ingest", strings.NewReader(body))
+	missing.RemoteAddr = "127.0.0.1:5000"
+	missing.Header.Set("X-Forwarded-For", "10.0.0.8")
+	skewed := signedRequest(key, time.Now().Add(-time.Hour), "skewed-nonce", body)
+	valid := signedRequest(key, time.Now(), "valid-nonce", body)
+
+	for _, r := range []*http.Request{missing, skewed} {
+		w := httptest.NewRecorder()
+		if _, ok := s.authorizeIngest(w, r); ok {
+			t.Fatal("expected the request to be refused")
+		}
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	got, ok := s.authorizeIngest(w, valid)
+	if !ok || string(got) != body {
+		t.Fatalf("expected the signed request through with its body, got %q (%d)", got, w.Code)
+	}
+
+	rejections, err := st.ListIngestRejections(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListIngestRejections: %v", err)
+	}
+	if len(rejections) != 2 {
+		t.Fatalf("expected 2 rejections audited, got %+v", rejections)
+	}
+	byReason := map[string]bool{}
+	for _, rej := range rejections {
+		byReason[rej.Reason] = true
+		if rej.Path != "/live/ingest" {
+			t.Errorf("%s: expected path /live/ingest, got %q", rej.Reason, rej.Path)
+		}
+		switch rej.Reason {
+		case rejectMissingToken:
+			if rej.RemoteAddr != "127.0.0.1:5000" || !strings.Contains(rej.Detail, "forwarded for 10.0.0.8") {
+				t.Errorf("missing token: unexpected origin %q / %q", rej.RemoteAddr, rej.Detail)
+			}
+		case rejectClockSkew:
+			if rej.KeyID != key.KeyID {
+				t.Errorf("clock skew: expected key %s, got %q", key.KeyID, rej.KeyID)
+			}
+		}
+	}
+	if !byReason[rejectMissingToken] || !byReason[rejectClockSkew] {
+		t.Fatalf("expected missing_token and clock_skew, got %+v", rejections)
+	}
+}
+
+func TestFeedAuthorization(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+	s := New(nil, st, 0, "")
+	feed := func(query string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/live/feed"+query, nil)
+	}
+
+	if !s.feedAuthorized(feed("")) {
+		t.Fatal("expected the feed open while ingest is")
+	}
+
+	key, err := s.auth.createKey(ctx, "sender")
+	if err != nil {
+		t.Fatalf("createKey: %v", err)
+	}
+	if err := s.auth.setSigningRequired(ctx, true); err != nil {
+		t.Fatalf("setSigningRequired: %v", err)
+	}
+	if s.feedAuthorized(feed("")) || s.feedAuthorized(feed("?token=")) {
+		t.Fatal("expected the feed closed once signing is required")
+	}
+
+	now := time.Now()
+	signedQuery := func(path, nonce string) string {
+		return "?" + url.Values{
+			"key_id":    {key.KeyID},
+			"timestamp": {strconv.FormatInt(now.Unix(), 10)},
+			"nonce":     {nonce},
+			"signature": {sign(key.Secret, now.Unix(), nonce, []byte(path))},
+		}.Encode()
+	}
+	if !s.feedAuthorized(feed(signedQuery("/live/feed", "feed-nonce-1"))) {
+		t.Fatal("expected a signed feed request through")
+	}
+	if s.feedAuthorized(feed(signedQuery("/live/feed", "feed-nonce-1"))) {
+		t.Fatal("expected a replayed feed signature refused")
+	}
+	if s.feedAuthorized(feed(signedQuery("/live/streams/other/feed", "feed-nonce-2"))) {
+		t.Fatal("expected a signature over another path refused")
+	}
+
+	headers := feed("")
+	headers.Header.Set(headerKeyID, key.KeyID)
+	headers.Header.Set(headerTimestamp, strconv.FormatInt(now.Unix(), 10))
+	headers.Header.Set(headerNonce, "feed-nonce-3")
+	headers.Header.Set(headerSignature, sign(key.Secret, now.Unix(), "feed-nonce-3", []byte("/live/feed")))
+	if !s.feedAuthorized(headers) {
+		t.Fatal("expected a feed signed in headers through")
+	}
+
+	token, err := s.auth.rotateToken(ctx)
+	if err != nil {
+		t.Fatalf("rotateToken: %v", err)
+	}
+	if !s.feedAuthorized(feed("?token=" + token)) {
+		t.Fatal("expected the configured token to open the feed")
+	}
+	if s.feedAuthorized(feed("?token=wrong")) {
+		t.Fatal("expected a wrong token refused")
+	}
+}
@@ -0,0 +1,245 @@
+package livehttp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/liveanalytics"
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+	"github.com/MJE43/stake-pf-replay-go/bindings"
+)
+
+const (
+	// backfillBatch is how many computed rounds are stored per transaction
+	backfillBatch = 5000
+	// backfillMaxRounds caps the rounds one backfill computes; the rest
+	// waits for the next run
+	backfillMaxRounds = 1_000_000
+)
+
+// BackfillResult reports a backfill. Skipped says why nothing was
+// computed: "no_seed" until the plain server seed is known, "running"
+// while another backfill of the stream is in progress, or "complete".
+// Ambiguous counts missing nonces left alone because the bets either side
+// of their gap differ in game or parameters.
+type BackfillResult struct {
+	StreamID  string `json:"stream_id"`
+	Computed  int    `json:"computed"`
+	Remaining int64  `json:"remaining"`
+	Ambiguous int64  `json:"ambiguous,omitempty"`
+	Skipped   string `json:"skipped,omitempty"`
+}
+
+// backfiller replays the rounds a stream is missing from its plain server
+// seed, one backfill per stream at a time.
+type backfiller struct {
+	store     *livestore.Store
+	analytics *liveanalytics.Service
+	wailsCtx  context.Context // for events; nil until Startup
+
+	mu      sync.Mutex
+	running map[uuid.UUID]bool
+}
+
+func newBackfiller(store *livestore.Store, analytics *liveanalytics.Service) *backfiller {
+	return &backfiller{store: store, analytics: analytics, running: map[uuid.UUID]bool{}}
+}
+
+// Kick backfills a stream in the background if its seed is known.
+func (b *backfiller) Kick(streamID uuid.UUID) {
+	if b == nil {
+		return
+	}
+	go func() {
+		if _, err := b.Run(context.Background(), streamID); err != nil {
+			fmt.Printf("[livehttp] warning: backfill of %s failed: %v\n", streamID, err)
+		}
+	}()
+}
+
+// Run computes up to backfillMaxRounds missing rounds of a stream, oldest
+// first, and stores them as computed rounds. Each gap is replayed as the
+// game and parameters of the bets around it; a gap between bets that
+// differ is skipped, since where the change happened isn't known.
+func (b *backfiller) Run(ctx context.Context, streamID uuid.UUID) (BackfillResult, error) {
+	res := BackfillResult{StreamID: streamID.String()}
+	if b == nil {
+		return res, fmt.Errorf("backfill not available")
+	}
+	b.mu.Lock()
+	if b.running[streamID] {
+		b.mu.Unlock()
+		res.Skipped = "running"
+		return res, nil
+	}
+	b.running[streamID] = true
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.running, streamID)
+		b.mu.Unlock()
+	}()
+
+	ls, err := b.store.GetStream(ctx, streamID)
+	if err != nil {
+		return res, err
+	}
+	if !ls.Incomplete {
+		res.Skipped = "complete"
+		return res, nil
+	}
+	plain, known, err := b.store.LookupSeedAlias(ctx, ls.ServerSeedHashed)
+	if err != nil {
+		return res, err
+	}
+	if !known {
+		res.Skipped = "no_seed"
+		res.Remaining = ls.MissingRounds
+		return res, nil
+	}
+	if !seedMatchesHash(plain, ls.ServerSeedHashed) {
+		return res, fmt.Errorf("stored server seed does not hash to %s", ls.ServerSeedHashed)
+	}
+	cov, err := b.store.GetCoverage(ctx, streamID, 0)
+	if err != nil {
+		return res, err
+	}
+	batch := make([]livestore.LiveRound, 0, backfillBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := b.store.InsertComputedRounds(ctx, streamID, batch)
+		res.Computed += n
+		batch = batch[:0]
+		return err
+	}
+	budget := backfillMaxRounds
+fill:
+	for _, gap := range cov.Missing {
+		if budget == 0 {
+			break
+		}
+		game, params, ok, err := b.gapBets(ctx, streamID, gap)
+		if err != nil {
+			return res, err
+		}
+		if !ok {
+			res.Ambiguous += gap.End - gap.Start + 1
+			continue
+		}
+		for nonce := gap.Start; nonce <= gap.End; nonce++ {
+			if budget == 0 {
+				break fill
+			}
+			budget--
+			result, err := bindings.EvaluateMetric(game, plain, ls.ClientSeed, uint64(nonce), params)
+			if err != nil {
+				return res, fmt.Errorf("nonce %d: %w", nonce, err)
+			}
+			batch = append(batch, livestore.LiveRound{Nonce: nonce, RoundResult: result, ReceivedAt: time.Now().UTC()})
+			if len(batch) < backfillBatch {
+				continue
+			}
+			if err := flush(); err != nil {
+				return res, err
+			}
+			if err := ctx.Err(); err != nil {
+				return res, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return res, err
+	}
+
+	if res.Computed > 0 {
+		b.analytics.Invalidate(streamID)
+	}
+	if ls, err = b.store.GetStream(ctx, streamID); err == nil {
+		res.Remaining = ls.MissingRounds
+	}
+	if b.wailsCtx != nil && res.Computed > 0 {
+		runtime.EventsEmit(b.wailsCtx, "live:backfill:"+streamID.String(), res)
+	}
+	fmt.Printf("[livehttp] backfilled %d rounds of %s, %d missing (%d between bets of different games or params)\n",
+		res.Computed, streamID, res.Remaining, res.Ambiguous)
+	return res, nil
+}
+
+// gapBets returns the game and parameters to replay a gap with: those of
+// the bets either side of it, or of the one side with a bet. Streams
+// without bets replay as the default game. ok is false when the bets
+// either side differ.
+func (b *backfiller) gapBets(ctx context.Context, streamID uuid.UUID, gap livestore.NonceRange) (game string, params map[string]any, ok bool, err error) {
+	before, hasBefore, err := b.store.BetBefore(ctx, streamID, gap.Start)
+	if err != nil {
+		return "", nil, false, err
+	}
+	after, hasAfter, err := b.store.BetAfter(ctx, streamID, gap.End)
+	if err != nil {
+		return "", nil, false, err
+	}
+	switch {
+	case hasBefore && hasAfter:
+		if params, err = betParams(before); err != nil {
+			return "", nil, false, err
+		}
+		afterParams, err := betParams(after)
+		if err != nil {
+			return "", nil, false, err
+		}
+		if before.Game != after.Game || !reflect.DeepEqual(params, afterParams) {
+			return "", nil, false, nil
+		}
+		return before.Game, params, true, nil
+	case hasBefore:
+		params, err = betParams(before)
+		return before.Game, params, err == nil, err
+	case hasAfter:
+		params, err = betParams(after)
+		return after.Game, params, err == nil, err
+	}
+	return livestore.DefaultGame, map[string]any{}, true, nil
+}
+
+// seedMatchesHash reports whether plain is the server seed behind hashed
+func seedMatchesHash(plain, hashed string) bool {
+	sum := sha256.Sum256([]byte(plain))
+	return strings.EqualFold(hex.EncodeToString(sum[:]), hashed)
+}
+
+// errSeedMismatch is returned for a server seed that doesn't hash to the
+// stream's hashed seed
+var errSeedMismatch = errors.New("server seed does not match the stream's hashed seed")
+
+// setServerSeed records the plain server seed of a stream, marks it
+// verified and backfills the rounds it is missing.
+func setServerSeed(ctx context.Context, st *livestore.Store, b *backfiller, streamID uuid.UUID, plain string) error {
+	plain = strings.TrimSpace(plain)
+	ls, err := st.GetStream(ctx, streamID)
+	if err != nil {
+		return err
+	}
+	if !seedMatchesHash(plain, ls.ServerSeedHashed) {
+		return errSeedMismatch
+	}
+	if err := st.UpsertSeedAlias(ctx, ls.ServerSeedHashed, plain); err != nil {
+		return err
+	}
+	if err := st.VerifyStreamState(ctx, streamID); err != nil {
+		return err
+	}
+	b.Kick(streamID)
+	return nil
+}
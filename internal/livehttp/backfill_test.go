@@ -0,0 +1,148 @@
+package livehttp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/liveanalytics"
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+	"github.com/MJE43/stake-pf-replay-go/bindings"
+)
+
+func newTestStore(t *testing.T) *livestore.Store {
+	t.Helper()
+	st, err := livestore.New(filepath.Join(t.TempDir(), "live.db"))
+	if err != nil {
+		t.Fatalf("livestore.New: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func hashSeed(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestBackfillComputesMissingRounds(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+	const plain, client = "backfill-server-seed", "backfill-client"
+	id, err := st.FindOrCreateStream(ctx, hashSeed(plain), client)
+	if err != nil {
+		t.Fatalf("FindOrCreateStream: %v", err)
+	}
+	for _, nonce := range []int64{1, 5} {
+		if _, err := st.InsertRound(ctx, id, nonce, 1.5); err != nil {
+			t.Fatalf("InsertRound: %v", err)
+		}
+	}
+	if err := st.UpdateLastObservedNonce(ctx, id, 7); err != nil {
+		t.Fatalf("UpdateLastObservedNonce: %v", err)
+	}
+
+	b := newBackfiller(st, liveanalytics.New(st))
+	res, err := b.Run(ctx, id)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Skipped != "no_seed" || res.Remaining != 5 {
+		t.Fatalf("expected a no_seed skip with 5 missing, got %+v", res)
+	}
+
+	if err := st.UpsertSeedAlias(ctx, hashSeed(plain), plain); err != nil {
+		t.Fatalf("UpsertSeedAlias: %v", err)
+	}
+	res, err = b.Run(ctx, id)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Computed != 5 || res.Remaining != 0 {
+		t.Fatalf("expected 5 computed rounds and none left, got %+v", res)
+	}
+
+	rounds := map[int64]livestore.LiveRound{}
+	if err := st.EachRound(ctx, id, func(r livestore.LiveRound) error { rounds[r.Nonce] = r; return nil }); err != nil {
+		t.Fatalf("EachRound: %v", err)
+	}
+	for nonce := int64(1); nonce <= 7; nonce++ {
+		r, ok := rounds[nonce]
+		if !ok {
+			t.Fatalf("nonce %d has no round", nonce)
+		}
+		if nonce == 1 || nonce == 5 {
+			if r.Source != livestore.RoundObserved || r.RoundResult != 1.5 {
+				t.Errorf("nonce %d: observed round changed: %+v", nonce, r)
+			}
+			continue
+		}
+		want, _ := bindings.EvaluateMetric(livestore.DefaultGame, plain, client, uint64(nonce), map[string]any{})
+		if r.Source != livestore.RoundComputed || r.RoundResult != want {
+			t.Errorf("nonce %d: expected computed %v, got %+v", nonce, want, r)
+		}
+	}
+
+	if res, _ = b.Run(ctx, id); res.Skipped != "complete" {
+		t.Errorf("expected a complete stream to be skipped, got %+v", res)
+	}
+}
+
+func TestBackfillReplaysEachGapAsItsBets(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+	const plain, client = "gap-server-seed", "gap-client"
+	id, err := st.FindOrCreateStream(ctx, hashSeed(plain), client)
+	if err != nil {
+		t.Fatalf("FindOrCreateStream: %v", err)
+	}
+	for _, bet := range []struct {
+		nonce int64
+		game  string
+	}{{1, "limbo"}, {4, "limbo"}, {8, "dice"}} {
+		_, err := st.IngestBet(ctx, id, livestore.LiveBet{
+			AntebotBetID: fmt.Sprintf("bet-%d", bet.nonce), DateTime: time.Now(), Nonce: bet.nonce,
+			Game: bet.game, Details: "{}",
+		})
+		if err != nil {
+			t.Fatalf("IngestBet: %v", err)
+		}
+		if _, err := st.InsertRound(ctx, id, bet.nonce, 1.5); err != nil {
+			t.Fatalf("InsertRound: %v", err)
+		}
+	}
+	if err := st.UpdateLastObservedNonce(ctx, id, 10); err != nil {
+		t.Fatalf("UpdateLastObservedNonce: %v", err)
+	}
+	if err := st.UpsertSeedAlias(ctx, hashSeed(plain), plain); err != nil {
+		t.Fatalf("UpsertSeedAlias: %v", err)
+	}
+
+	res, err := newBackfiller(st, liveanalytics.New(st)).Run(ctx, id)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	// 5-7 lie between a limbo and a dice bet
+	if res.Computed != 4 || res.Ambiguous != 3 || res.Remaining != 3 {
+		t.Fatalf("expected 4 computed and 3 ambiguous, got %+v", res)
+	}
+	rounds := map[int64]float64{}
+	if err := st.EachRound(ctx, id, func(r livestore.LiveRound) error { rounds[r.Nonce] = r.RoundResult; return nil }); err != nil {
+		t.Fatalf("EachRound: %v", err)
+	}
+	for nonce, game := range map[int64]string{2: "limbo", 3: "limbo", 9: "dice", 10: "dice"} {
+		want, _ := bindings.EvaluateMetric(game, plain, client, uint64(nonce), map[string]any{})
+		if got, ok := rounds[nonce]; !ok || got != want {
+			t.Errorf("nonce %d: expected %s result %v, got %v", nonce, game, want, got)
+		}
+	}
+	for nonce := int64(5); nonce <= 7; nonce++ {
+		if _, ok := rounds[nonce]; ok {
+			t.Errorf("nonce %d: expected no round between bets of different games", nonce)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package livehttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+	"github.com/MJE43/stake-pf-replay-go/bindings"
+)
+
+// exportFlushEvery is how often, in rows, an export is flushed to its
+// writer and reports progress
+const exportFlushEvery = 10000
+
+var betColumns = []bindings.ExportColumn{
+	{Name: "id", Kind: bindings.ExportInt64},
+	{Name: "nonce", Kind: bindings.ExportInt64},
+	{Name: "antebot_bet_id", Kind: bindings.ExportString},
+	{Name: "date_time", Kind: bindings.ExportTimestamp, Optional: true},
+	{Name: "received_at", Kind: bindings.ExportTimestamp},
+	{Name: "amount", Kind: bindings.ExportFloat64},
+	{Name: "payout", Kind: bindings.ExportFloat64},
+	{Name: "difficulty", Kind: bindings.ExportString},
+	{Name: "round_target", Kind: bindings.ExportFloat64},
+	{Name: "round_result", Kind: bindings.ExportFloat64},
+	{Name: "game", Kind: bindings.ExportString},
+	{Name: "details", Kind: bindings.ExportJSON},
+}
+
+var roundColumns = []bindings.ExportColumn{
+	{Name: "id", Kind: bindings.ExportInt64},
+	{Name: "nonce", Kind: bindings.ExportInt64},
+	{Name: "round_result", Kind: bindings.ExportFloat64},
+	{Name: "received_at", Kind: bindings.ExportTimestamp},
+	{Name: "source", Kind: bindings.ExportString},
+}
+
+// exportPageWriteTimeout bounds how long writing one page of an HTTP export
+// may take, so a stalled client is dropped instead of held open
+const exportPageWriteTimeout = 30 * time.Second
+
+// writeStreamExport streams a stream's bets or rounds, by table, to w in
+// nonce order. Rows are read a page at a time and the database is not held
+// while a page is written. beforePage, if set, runs before each page is
+// written; progress may be nil.
+func writeStreamExport(ctx context.Context, st *livestore.Store, w io.Writer, streamID uuid.UUID,
+	table string, format bindings.ExportFormat, beforePage func(), progress bindings.ExportProgress) (int64, error) {
+	var columns []bindings.ExportColumn
+	switch table {
+	case "", "bets":
+		columns = betColumns
+	case "rounds":
+		columns = roundColumns
+	default:
+		return 0, fmt.Errorf("unknown export table %q (want bets or rounds)", table)
+	}
+	rw, err := bindings.NewExportRowWriter(w, format, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	var written int64
+	add := func(row []any) error {
+		if err := rw.Write(row); err != nil {
+			return err
+		}
+		written++
+		if written%exportFlushEvery != 0 {
+			return nil
+		}
+		if progress != nil {
+			progress(written)
+		}
+		return rw.Flush()
+	}
+	startPage := func() {
+		if beforePage != nil {
+			beforePage()
+		}
+	}
+	if table == "rounds" {
+		err = st.EachRoundPage(ctx, streamID, func(page []livestore.LiveRound) error {
+			startPage()
+			for _, r := range page {
+				if err := add([]any{r.ID, r.Nonce, r.RoundResult, r.ReceivedAt, r.Source}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	} else {
+		err = st.EachBetPage(ctx, streamID, func(page []livestore.LiveBet) error {
+			startPage()
+			for _, b := range page {
+				var dateTime any
+				if !b.DateTime.IsZero() {
+					dateTime = b.DateTime
+				}
+				if err := add([]any{b.ID, b.Nonce, b.AntebotBetID, dateTime, b.ReceivedAt,
+					b.Amount, b.Payout, b.Difficulty, b.RoundTarget, b.RoundResult, b.Game, json.RawMessage(b.Details)}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	startPage() // the final flush on Close
+	if err != nil {
+		return written, err
+	}
+	if err := rw.Close(); err != nil {
+		return written, err
+	}
+	if progress != nil {
+		progress(written)
+	}
+	return written, nil
+}
+
+// pageDeadline returns a beforePage hook that gives the response a fresh
+// write deadline for each page of an export
+func pageDeadline(w http.ResponseWriter) func() {
+	rc := http.NewResponseController(w)
+	return func() {
+		_ = rc.SetWriteDeadline(time.Now().Add(exportPageWriteTimeout))
+	}
+}
+
+// exportName is the default file name of a stream export
+func exportName(streamID uuid.UUID, table string) string {
+	if table == "" {
+		table = "bets"
+	}
+	return fmt.Sprintf("stream_%s_%s_%d", streamID, table, time.Now().UTC().Unix())
+}
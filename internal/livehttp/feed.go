@@ -0,0 +1,418 @@
+package livehttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+)
+
+const (
+	// feedBuffer is how many events a subscriber may fall behind by before
+	// it is dropped and has to resume
+	feedBuffer = 1024
+	// feedReplayDefault and feedReplayMax bound the stored events sent
+	// before live ones
+	feedReplayDefault = 100
+	feedReplayMax     = 1000
+	// feedKeepAlive is how often an idle feed is pinged
+	feedKeepAlive = 15 * time.Second
+	// feedWriteTimeout bounds one write to a feed client
+	feedWriteTimeout = 10 * time.Second
+)
+
+// feedEvent is a stored bet or observed round sent to feed subscribers
+type feedEvent struct {
+	Type     string               `json:"type"` // "bet" or "round"
+	StreamID uuid.UUID            `json:"stream_id"`
+	Bet      *livestore.LiveBet   `json:"bet,omitempty"`
+	Round    *livestore.LiveRound `json:"round,omitempty"`
+}
+
+func betEvent(b livestore.LiveBet) feedEvent {
+	return feedEvent{Type: "bet", StreamID: b.StreamID, Bet: &b}
+}
+
+func roundEvent(streamID uuid.UUID, nonce int64, result float64) feedEvent {
+	return feedEvent{Type: "round", StreamID: streamID, Round: &livestore.LiveRound{
+		StreamID:    streamID,
+		Nonce:       nonce,
+		RoundResult: result,
+		ReceivedAt:  time.Now().UTC(),
+		Source:      livestore.RoundObserved,
+	}}
+}
+
+// feedHub fans ingested events out to feed subscribers. A nil hub
+// publishes nothing.
+type feedHub struct {
+	mu     sync.Mutex
+	subs   map[*feedSub]struct{}
+	closed bool
+}
+
+// feedSub is one subscriber. Its channel is closed when it falls more
+// than feedBuffer events behind or the hub closes.
+type feedSub struct {
+	streamID uuid.UUID // uuid.Nil for every stream
+	ch       chan feedEvent
+	overflow bool
+}
+
+func newFeedHub() *feedHub {
+	return &feedHub{subs: map[*feedSub]struct{}{}}
+}
+
+func (h *feedHub) subscribe(streamID uuid.UUID) *feedSub {
+	sub := &feedSub{streamID: streamID, ch: make(chan feedEvent, feedBuffer)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(sub.ch)
+	} else {
+		h.subs[sub] = struct{}{}
+	}
+	return sub
+}
+
+func (h *feedHub) unsubscribe(sub *feedSub) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// publish sends events to their subscribers without blocking ingest
+func (h *feedHub) publish(events ...feedEvent) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		for _, ev := range events {
+			if sub.streamID != uuid.Nil && sub.streamID != ev.StreamID {
+				continue
+			}
+			select {
+			case sub.ch <- ev:
+			default:
+				sub.overflow = true
+				delete(h.subs, sub)
+				close(sub.ch)
+			}
+			if sub.overflow {
+				break
+			}
+		}
+	}
+}
+
+// close ends every subscription, so open feeds don't hold up shutdown
+func (h *feedHub) close() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// feedCursor is where a subscriber has got to: the last bet id and, on a
+// single stream, the last round nonce. It travels as "<bet id>:<nonce>",
+// the SSE event id.
+type feedCursor struct {
+	betID int64
+	nonce int64
+}
+
+func (c feedCursor) String() string {
+	return fmt.Sprintf("%d:%d", c.betID, c.nonce)
+}
+
+func parseFeedCursor(s string) (feedCursor, bool) {
+	bet, nonce, _ := strings.Cut(s, ":")
+	var c feedCursor
+	var err error
+	if c.betID, err = strconv.ParseInt(bet, 10, 64); err != nil || c.betID < 0 {
+		return feedCursor{}, false
+	}
+	if nonce != "" {
+		if c.nonce, err = strconv.ParseInt(nonce, 10, 64); err != nil || c.nonce < 0 {
+			return feedCursor{}, false
+		}
+	}
+	return c, true
+}
+
+// advance moves the cursor past ev, reporting false for an event the
+// subscriber already has
+func (c *feedCursor) advance(ev feedEvent, single bool) bool {
+	switch {
+	case ev.Bet != nil:
+		if ev.Bet.ID <= c.betID {
+			return false
+		}
+		c.betID = ev.Bet.ID
+	case ev.Round != nil && single:
+		if ev.Round.Nonce <= c.nonce {
+			return false
+		}
+		c.nonce = ev.Round.Nonce
+	}
+	return true
+}
+
+// feedConn writes events to an SSE or WebSocket client
+type feedConn interface {
+	send(event, id string, data any) error
+	ping() error
+}
+
+type sseConn struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (c sseConn) send(event, id string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_ = c.rc.SetWriteDeadline(time.Now().Add(feedWriteTimeout))
+	if id != "" {
+		fmt.Fprintf(c.w, "id: %s\n", id)
+	}
+	if _, err := fmt.Fprintf(c.w, "event: %s\ndata: %s\n\n", event, b); err != nil {
+		return err
+	}
+	return c.rc.Flush()
+}
+
+func (c sseConn) ping() error {
+	_ = c.rc.SetWriteDeadline(time.Now().Add(feedWriteTimeout))
+	if _, err := fmt.Fprint(c.w, ": ping\n\n"); err != nil {
+		return err
+	}
+	return c.rc.Flush()
+}
+
+type wsConn struct {
+	c *websocket.Conn
+}
+
+func (c wsConn) send(event, id string, data any) error {
+	_ = c.c.SetWriteDeadline(time.Now().Add(feedWriteTimeout))
+	return c.c.WriteJSON(map[string]any{"event": event, "id": id, "data": data})
+}
+
+func (c wsConn) ping() error {
+	return c.c.WriteControl(websocket.PingMessage, nil, time.Now().Add(feedWriteTimeout))
+}
+
+// GET /live/feed and /live/streams/{id}/feed: bets and observed rounds of
+// every stream or of one, as Server-Sent Events or, when the request asks
+// to upgrade, WebSocket messages. The feed opens with up to ?replay= stored
+// events (after the cursor in ?since_id=, ?since_nonce= or Last-Event-ID
+// when given), then a "ready" event, then live ones.
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request, streamID uuid.UUID) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, "GET")
+		return
+	}
+	if !s.feedAuthorized(r) {
+		writeJSON(w, http.StatusUnauthorized, errObj("UNAUTHORIZED", "missing or invalid X-Ingest-Token or signature", ""))
+		return
+	}
+	single := streamID != uuid.Nil
+	if single {
+		if _, err := s.store.GetStream(r.Context(), streamID); err != nil {
+			writeJSON(w, http.StatusNotFound, errObj("NOT_FOUND", "stream not found", "id"))
+			return
+		}
+	}
+
+	cur := feedCursor{betID: qInt64(r, "since_id", 0), nonce: qInt64(r, "since_nonce", 0)}
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		c, ok := parseFeedCursor(v)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, errObj("VALIDATION_ERROR", "invalid Last-Event-ID", "Last-Event-ID"))
+			return
+		}
+		cur = c
+	}
+	replay := clampInt(qInt(r, "replay", feedReplayDefault), 0, feedReplayMax)
+
+	var conn feedConn
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if websocket.IsWebSocketUpgrade(r) {
+		up := websocket.Upgrader{CheckOrigin: s.feedOriginAllowed}
+		c, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return // the upgrader has replied
+		}
+		defer c.Close()
+		// Reading is only for control frames; the feed ends when the client
+		// goes away
+		go func() {
+			defer cancel()
+			for {
+				if _, _, err := c.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+		conn = wsConn{c}
+	} else {
+		// The server's write timeout would end a long-lived feed; each
+		// send sets its own deadline instead, so a stalled client is let go
+		rc := http.NewResponseController(w)
+		_ = rc.SetWriteDeadline(time.Now().Add(feedWriteTimeout))
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		conn = sseConn{w, rc}
+	}
+
+	// Subscribe before reading the replay, so nothing stored in between is
+	// missed; the cursor drops what the replay already covered
+	sub := s.feed.subscribe(streamID)
+	defer s.feed.unsubscribe(sub)
+
+	events, truncated, err := s.feedReplay(ctx, streamID, cur, replay)
+	if err != nil {
+		_ = conn.send("error", "", errObj("SERVER_ERROR", "failed to read stored events", ""))
+		return
+	}
+	for _, ev := range events {
+		if !cur.advance(ev, single) {
+			continue
+		}
+		if err := conn.send(ev.Type, cur.String(), ev); err != nil {
+			return
+		}
+	}
+	if err := conn.send("ready", cur.String(), map[string]any{
+		"replayed":  len(events),
+		"truncated": truncated,
+		"cursor":    cur.String(),
+	}); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(feedKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			if err := conn.ping(); err != nil {
+				return
+			}
+		case ev, ok := <-sub.ch:
+			if !ok {
+				if sub.overflow {
+					// Too slow to keep up; reconnecting with the cursor resumes
+					_ = conn.send("overflow", cur.String(), map[string]any{"cursor": cur.String()})
+				}
+				return
+			}
+			if !cur.advance(ev, single) {
+				continue
+			}
+			if err := conn.send(ev.Type, cur.String(), ev); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// feedReplay reads the stored events a subscriber gets before live ones:
+// the latest limit bets after the cursor and, on a single stream, the
+// latest limit rounds after it, merged by nonce. Without a cursor these
+// are simply the latest.
+func (s *Server) feedReplay(ctx context.Context, streamID uuid.UUID, cur feedCursor, limit int) ([]feedEvent, bool, error) {
+	if limit == 0 {
+		return nil, false, nil
+	}
+	var filter *uuid.UUID
+	if streamID != uuid.Nil {
+		filter = &streamID
+	}
+	bets, truncated, err := s.store.BetsAfter(ctx, filter, cur.betID, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	events := make([]feedEvent, 0, len(bets))
+	for _, b := range bets {
+		events = append(events, betEvent(b))
+	}
+	if filter == nil {
+		return events, truncated, nil
+	}
+
+	rounds, more, err := s.store.RoundsAfter(ctx, streamID, cur.nonce, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	for i := range rounds {
+		events = append(events, feedEvent{Type: "round", StreamID: streamID, Round: &rounds[i]})
+	}
+	nonce := func(ev feedEvent) int64 {
+		if ev.Bet != nil {
+			return ev.Bet.Nonce
+		}
+		return ev.Round.Nonce
+	}
+	// A round goes before the bet on the same nonce
+	sort.SliceStable(events, func(i, j int) bool {
+		ni, nj := nonce(events[i]), nonce(events[j])
+		if ni != nj {
+			return ni < nj
+		}
+		return events[i].Round != nil && events[j].Bet != nil
+	})
+	return events, truncated || more, nil
+}
+
+// feedAuthorized checks the ingest token or a signature; see feedAllowed
+func (s *Server) feedAuthorized(r *http.Request) bool {
+	return s.auth.feedAllowed(r, time.Now())
+}
+
+// feedOriginAllowed lets WebSocket clients in from pages on this machine,
+// and from anywhere once a token or signature guards the feed
+func (s *Server) feedOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || s.auth.enabled() {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	ip := net.ParseIP(host)
+	return host == "localhost" || (ip != nil && ip.IsLoopback()) || u.Scheme == "wails"
+}
@@ -0,0 +1,282 @@
+package livehttp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+)
+
+// feedStream stores a stream with observed rounds on nonces 1 to 5 and
+// bets on 2, 4 and 5
+func feedStream(t *testing.T) (*Server, uuid.UUID) {
+	t.Helper()
+	st := newTestStore(t)
+	ctx := context.Background()
+	id, err := st.FindOrCreateStream(ctx, "feed-hash", "feed-client")
+	if err != nil {
+		t.Fatalf("FindOrCreateStream: %v", err)
+	}
+	now := time.Now().UTC()
+	var rounds []livestore.LiveRound
+	for nonce := int64(1); nonce <= 5; nonce++ {
+		rounds = append(rounds, livestore.LiveRound{Nonce: nonce, RoundResult: float64(nonce), ReceivedAt: now, Source: livestore.RoundObserved})
+	}
+	if _, err := st.ImportRounds(ctx, id, rounds); err != nil {
+		t.Fatalf("ImportRounds: %v", err)
+	}
+	var bets []livestore.LiveBet
+	for _, nonce := range []int64{2, 4, 5} {
+		bets = append(bets, livestore.LiveBet{
+			AntebotBetID: fmt.Sprintf("feed-%d", nonce),
+			ReceivedAt:   now,
+			DateTime:     now,
+			Nonce:        nonce,
+			Amount:       1,
+			Difficulty:   "easy",
+			RoundTarget:  2,
+			RoundResult:  float64(nonce),
+		})
+	}
+	if _, err := st.ImportBets(ctx, id, bets); err != nil {
+		t.Fatalf("ImportBets: %v", err)
+	}
+	return New(nil, st, 0, ""), id
+}
+
+// describe lists events as "round 3" or "bet 4" by nonce
+func describe(events []feedEvent) string {
+	var out []string
+	for _, ev := range events {
+		if ev.Bet != nil {
+			out = append(out, fmt.Sprintf("bet %d", ev.Bet.Nonce))
+		} else {
+			out = append(out, fmt.Sprintf("round %d", ev.Round.Nonce))
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+func TestFeedCursor(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want feedCursor
+		ok   bool
+	}{
+		{"12:30", feedCursor{12, 30}, true},
+		{"12", feedCursor{12, 0}, true},
+		{"0:0", feedCursor{}, true},
+		{"x:1", feedCursor{}, false},
+		{"1:x", feedCursor{}, false},
+		{"-1:2", feedCursor{}, false},
+	} {
+		got, ok := parseFeedCursor(tt.in)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseFeedCursor(%q) = %+v, %v; want %+v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+	if s := (feedCursor{7, 9}).String(); s != "7:9" {
+		t.Errorf("expected 7:9, got %s", s)
+	}
+
+	cur := feedCursor{betID: 3, nonce: 10}
+	bet := func(id int64) feedEvent { return feedEvent{Bet: &livestore.LiveBet{ID: id}} }
+	round := func(nonce int64) feedEvent { return feedEvent{Round: &livestore.LiveRound{Nonce: nonce}} }
+	if cur.advance(bet(3), true) || cur.advance(round(10), true) {
+		t.Error("expected events at the cursor to be skipped")
+	}
+	if !cur.advance(bet(4), true) || !cur.advance(round(11), true) || cur != (feedCursor{4, 11}) {
+		t.Errorf("expected the cursor to move to 4:11, got %s", cur)
+	}
+	if !cur.advance(round(2), false) || cur.nonce != 11 {
+		t.Errorf("expected rounds of every stream to pass without moving the nonce, got %s", cur)
+	}
+}
+
+func TestFeedReplay(t *testing.T) {
+	s, id := feedStream(t)
+	ctx := context.Background()
+
+	events, truncated, err := s.feedReplay(ctx, id, feedCursor{}, feedReplayDefault)
+	if err != nil {
+		t.Fatalf("feedReplay: %v", err)
+	}
+	want := "round 1, round 2, bet 2, round 3, round 4, bet 4, round 5, bet 5"
+	if got := describe(events); got != want || truncated {
+		t.Fatalf("expected %s, got %s (truncated %v)", want, got, truncated)
+	}
+
+	// Past a cursor, only what came after it
+	events, _, err = s.feedReplay(ctx, id, feedCursor{betID: events[5].Bet.ID, nonce: 4}, feedReplayDefault)
+	if err != nil {
+		t.Fatalf("feedReplay: %v", err)
+	}
+	if got := describe(events); got != "round 5, bet 5" {
+		t.Errorf("expected round 5, bet 5 after the cursor, got %s", got)
+	}
+
+	// A limit keeps the latest events and reports the rest left out
+	events, truncated, err = s.feedReplay(ctx, id, feedCursor{}, 2)
+	if err != nil {
+		t.Fatalf("feedReplay: %v", err)
+	}
+	if got := describe(events); got != "round 4, bet 4, round 5, bet 5" || !truncated {
+		t.Errorf("expected the latest two of each, truncated; got %s (truncated %v)", got, truncated)
+	}
+
+	// Every stream's feed replays bets only
+	events, _, err = s.feedReplay(ctx, uuid.Nil, feedCursor{}, feedReplayDefault)
+	if err != nil {
+		t.Fatalf("feedReplay: %v", err)
+	}
+	if got := describe(events); got != "bet 2, bet 4, bet 5" {
+		t.Errorf("expected the bets, got %s", got)
+	}
+}
+
+func TestFeedHubDropsSlowSubscribers(t *testing.T) {
+	h := newFeedHub()
+	id, other := uuid.New(), uuid.New()
+	slow := h.subscribe(id)
+	elsewhere := h.subscribe(other)
+
+	for i := 0; i <= feedBuffer; i++ {
+		h.publish(roundEvent(id, int64(i+1), 1))
+	}
+	for range slow.ch {
+	}
+	if !slow.overflow {
+		t.Error("expected the subscriber that fell behind to be marked as overflowed")
+	}
+	if len(elsewhere.ch) != 0 || elsewhere.overflow {
+		t.Error("expected a subscriber to another stream to be left alone")
+	}
+
+	h.publish(roundEvent(other, 1, 1))
+	if ev := <-elsewhere.ch; ev.Round == nil || ev.Round.Nonce != 1 {
+		t.Errorf("expected the other stream's round, got %+v", ev)
+	}
+	h.close()
+	if _, ok := <-elsewhere.ch; ok {
+		t.Error("expected closing the hub to end its subscriptions")
+	}
+}
+
+// sseEvent is one Server-Sent Event read from a feed
+type sseEvent struct {
+	event, id string
+	data      json.RawMessage
+}
+
+func readSSE(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+	var ev sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading feed: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if ev.event != "" {
+				return ev
+			}
+		case strings.HasPrefix(line, "event: "):
+			ev.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "id: "):
+			ev.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = json.RawMessage(strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+func TestFeedServesReplayThenLiveEvents(t *testing.T) {
+	s, id := feedStream(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.handleFeed(w, r, id)
+	}))
+	defer srv.Close()
+
+	open := func(query, lastEventID string) (*bufio.Reader, func()) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+query, nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET feed: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("expected an event stream, got %s %q", resp.Status, resp.Header.Get("Content-Type"))
+		}
+		return bufio.NewReader(resp.Body), func() { resp.Body.Close() }
+	}
+
+	// A short replay is truncated, and ready carries the cursor
+	r, done := open("?replay=1", "")
+	var got []string
+	for {
+		ev := readSSE(t, r)
+		if ev.event == "ready" {
+			var ready struct {
+				Replayed  int    `json:"replayed"`
+				Truncated bool   `json:"truncated"`
+				Cursor    string `json:"cursor"`
+			}
+			if err := json.Unmarshal(ev.data, &ready); err != nil {
+				t.Fatalf("decoding ready: %v", err)
+			}
+			if ready.Replayed != 2 || !ready.Truncated || ready.Cursor != ev.id {
+				t.Fatalf("unexpected ready event %s (id %s)", ev.data, ev.id)
+			}
+			break
+		}
+		got = append(got, ev.event+" "+ev.id)
+	}
+	if strings.Join(got, ", ") != "round 0:5, bet 3:5" {
+		t.Fatalf("expected the last round and bet, got %v", got)
+	}
+
+	// Live events follow, and ones the cursor covers are skipped
+	s.feed.publish(roundEvent(id, 5, 5), roundEvent(id, 6, 2.5))
+	if ev := readSSE(t, r); ev.event != "round" || ev.id != "3:6" {
+		t.Fatalf("expected the live round 6, got %s %s", ev.event, ev.id)
+	}
+	done()
+
+	// Resuming from a Last-Event-ID replays only what came after it
+	r, done = open("", "2:4")
+	defer done()
+	got = got[:0]
+	for ev := readSSE(t, r); ev.event != "ready"; ev = readSSE(t, r) {
+		got = append(got, ev.event+" "+ev.id)
+	}
+	if strings.Join(got, ", ") != "round 2:5, bet 3:5" {
+		t.Fatalf("expected round 5 and bet 5 after the cursor, got %v", got)
+	}
+}
+
+func TestFeedRejectsBadCursor(t *testing.T) {
+	s, id := feedStream(t)
+	req := httptest.NewRequest(http.MethodGet, "/live/streams/"+id.String()+"/feed", nil)
+	req.Header.Set("Last-Event-ID", "nope")
+	rec := httptest.NewRecorder()
+	s.handleFeed(rec, req, id)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad Last-Event-ID, got %d", rec.Code)
+	}
+}
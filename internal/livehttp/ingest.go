@@ -0,0 +1,333 @@
+package livehttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+	"github.com/MJE43/stake-pf-replay-go/bindings"
+)
+
+const (
+	// maxIngestBody caps the size of an ingest request body
+	maxIngestBody = 16 << 20
+	// maxIngestBatch caps the messages in one batch
+	maxIngestBatch = 10000
+)
+
+// validate checks an ingest message and returns its type, "bet" or
+// "heartbeat". msg is set, with the offending field, when it is invalid.
+// For bets it settles the game and its parameters.
+func (p *ingestPayload) validate() (msgType, msg, field string) {
+	// Default to "bet" for backwards compatibility
+	msgType = strings.ToLower(p.Type)
+	if msgType == "" {
+		msgType = "bet"
+	}
+	switch {
+	case p.V < 0 || p.V > 2:
+		return msgType, "unsupported version, must be 1 or 2", "v"
+	case p.ServerSeedHashed == "" || p.ClientSeed == "":
+		return msgType, "serverSeedHashed and clientSeed are required", "serverSeedHashed/clientSeed"
+	case p.Nonce <= 0:
+		return msgType, "nonce must be >= 1", "nonce"
+	case msgType != "bet" && msgType != "heartbeat":
+		return msgType, "invalid type, must be 'bet' or 'heartbeat'", "type"
+	case msgType == "heartbeat":
+		return msgType, "", ""
+	case p.ID == "":
+		return msgType, "id is required for bet messages", "id"
+	}
+
+	if p.V < 2 {
+		if p.Difficulty == "" {
+			return msgType, "difficulty is required for bet messages", "difficulty"
+		}
+		p.Game = livestore.DefaultGame
+		p.params = map[string]any{"difficulty": strings.ToLower(p.Difficulty)}
+		return msgType, "", ""
+	}
+
+	p.Game = strings.ToLower(p.Game)
+	switch {
+	case p.Game == "":
+		return msgType, "game is required for version 2 bet messages", "game"
+	case !bindings.HasGame(p.Game):
+		return msgType, fmt.Sprintf("unknown game %q", p.Game), "game"
+	}
+	p.params = map[string]any{}
+	if len(p.Details) > 0 && string(p.Details) != "null" {
+		if err := json.Unmarshal(p.Details, &p.params); err != nil {
+			return msgType, "details must be a JSON object", "details"
+		}
+	}
+	if err := bindings.ValidateGameParams(p.Game, p.params); err != nil {
+		return msgType, fmt.Sprintf("invalid %s details: %v", p.Game, err), "details"
+	}
+	if d, ok := p.params["difficulty"].(string); ok && p.Difficulty == "" {
+		p.Difficulty = d
+	}
+	return msgType, "", ""
+}
+
+// bet builds the stored bet of a validated bet message. A missing or
+// invalid dateTime falls back to the time received.
+func (p ingestPayload) bet(streamID uuid.UUID) livestore.LiveBet {
+	details, _ := json.Marshal(p.params)
+	return livestore.LiveBet{
+		StreamID:     streamID,
+		AntebotBetID: p.ID,
+		ReceivedAt:   time.Now().UTC(),
+		DateTime:     parseISOTimeOrNow(p.DateTime),
+		Nonce:        int64(p.Nonce),
+		Amount:       p.Amount,
+		Payout:       p.Payout,
+		Difficulty:   strings.ToLower(p.Difficulty),
+		RoundTarget:  p.RoundTarget,
+		RoundResult:  p.RoundResult,
+		Game:         p.Game,
+		Details:      string(details),
+	}
+}
+
+// isBatchIngest reports whether an ingest body holds several messages:
+// an application/x-ndjson body, or a JSON array.
+func isBatchIngest(r *http.Request, body *bufio.Reader) bool {
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "application/x-ndjson" {
+		return true
+	}
+	for {
+		b, err := body.ReadByte()
+		if err != nil {
+			return false
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			continue
+		}
+		_ = body.UnreadByte()
+		return b == '['
+	}
+}
+
+// readIngestBatch splits a batch body into its raw messages
+func readIngestBatch(r *http.Request, body *bufio.Reader) ([]json.RawMessage, error) {
+	var raw []json.RawMessage
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "application/x-ndjson" {
+		sc := bufio.NewScanner(body)
+		sc.Buffer(make([]byte, 64<<10), maxIngestBody)
+		for sc.Scan() {
+			line := bytes.TrimSpace(sc.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			if len(raw) == maxIngestBatch {
+				return nil, errBatchTooLarge
+			}
+			raw = append(raw, json.RawMessage(bytes.Clone(line)))
+		}
+		return raw, sc.Err()
+	}
+
+	dec := json.NewDecoder(body)
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		if len(raw) == maxIngestBatch {
+			return nil, errBatchTooLarge
+		}
+		var m json.RawMessage
+		if err := dec.Decode(&m); err != nil {
+			return nil, err
+		}
+		raw = append(raw, m)
+	}
+	_, err := dec.Token()
+	return raw, err
+}
+
+var errBatchTooLarge = fmt.Errorf("a batch holds at most %d messages", maxIngestBatch)
+
+// ingestItemResult is the outcome of one message of a batch
+type ingestItemResult struct {
+	Index    int              `json:"index"`
+	Type     string           `json:"type,omitempty"`
+	StreamID string           `json:"streamId,omitempty"`
+	Accepted bool             `json:"accepted"`
+	Reason   string           `json:"reason,omitempty"` // "duplicate"
+	Error    *ingestItemError `json:"error,omitempty"`
+}
+
+type ingestItemError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+}
+
+// POST /live/ingest with a JSON array or NDJSON body. Messages may mix
+// bets and heartbeats and are stored in one transaction; each gets its own
+// result, and UI events go out once per stream for the whole batch.
+func (s *Server) handleIngestBatch(w http.ResponseWriter, r *http.Request, body *bufio.Reader) {
+	raw, err := readIngestBatch(r, body)
+	var tooBig *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooBig):
+		writeJSON(w, http.StatusRequestEntityTooLarge, errObj("VALIDATION_ERROR", "request body too large", ""))
+		return
+	case errors.Is(err, errBatchTooLarge):
+		writeJSON(w, http.StatusRequestEntityTooLarge, errObj("VALIDATION_ERROR", err.Error(), ""))
+		return
+	case err != nil:
+		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "invalid JSON", ""))
+		return
+	}
+
+	client := ingestClientOf(r)
+	results := make([]ingestItemResult, len(raw))
+	payloads := make([]ingestPayload, len(raw))
+	var items []livestore.IngestItem
+	var itemIndex []int // results index of each item
+	for i, m := range raw {
+		res := &results[i]
+		res.Index = i
+		p := &payloads[i]
+		if err := json.Unmarshal(m, p); err != nil {
+			res.Error = &ingestItemError{Code: "VALIDATION_ERROR", Message: "invalid JSON"}
+			continue
+		}
+		msgType, msg, field := p.validate()
+		res.Type = msgType
+		if msg != "" {
+			res.Error = &ingestItemError{Code: "VALIDATION_ERROR", Message: msg, Field: field}
+			continue
+		}
+		item := livestore.IngestItem{
+			ServerSeedHashed: p.ServerSeedHashed,
+			ClientSeed:       p.ClientSeed,
+			Nonce:            int64(p.Nonce),
+			RoundResult:      p.RoundResult,
+			IngestClient:     client,
+		}
+		if msgType == "bet" {
+			bet := p.bet(uuid.Nil)
+			item.Bet = &bet
+		}
+		items = append(items, item)
+		itemIndex = append(itemIndex, i)
+	}
+
+	var stored []livestore.BatchResult
+	if len(items) > 0 {
+		if stored, err = s.store.IngestBatch(r.Context(), items); err != nil {
+			fmt.Printf("[livehttp] warning: batch ingest failed: %v\n", err)
+			writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to store batch", ""))
+			return
+		}
+	}
+
+	events := map[uuid.UUID]*batchEvents{}
+	var feed []feedEvent
+	accepted, duplicates, failed := 0, 0, 0
+	for k, sr := range stored {
+		i := itemIndex[k]
+		res := &results[i]
+		if sr.StreamID != uuid.Nil {
+			res.StreamID = sr.StreamID.String()
+		}
+		if sr.Err != nil {
+			// The item was rolled back, whatever it got to
+			res.Error = &ingestItemError{Code: "SERVER_ERROR", Message: sr.Err.Error()}
+			continue
+		}
+		s.emitClosed(sr.Closed, sr.StreamID)
+		res.Accepted, res.Reason = sr.Accepted, sr.Reason
+		if !sr.Accepted {
+			continue
+		}
+		ev := events[sr.StreamID]
+		if ev == nil {
+			ev = &batchEvents{}
+			events[sr.StreamID] = ev
+		}
+		p := payloads[i]
+		if res.Type == "heartbeat" {
+			s.analytics.Observe(sr.StreamID, int64(p.Nonce), p.RoundResult)
+			s.alerts.ObserveRound(sr.StreamID, int64(p.Nonce), p.RoundResult)
+			feed = append(feed, roundEvent(sr.StreamID, int64(p.Nonce), p.RoundResult))
+			ev.gap = ev.gap || sr.Gap
+			ev.ticks++
+			if p.Nonce >= ev.tickNonce {
+				ev.tickNonce, ev.tickResult = p.Nonce, p.RoundResult
+			}
+		} else {
+			bet := *items[k].Bet
+			bet.ID, bet.StreamID = sr.BetID, sr.StreamID
+			s.alerts.ObserveBet(sr.StreamID, bet)
+			feed = append(feed, betEvent(bet))
+			ev.bets++
+			if p.Nonce >= ev.betNonce {
+				ev.betNonce, ev.betResult = p.Nonce, p.RoundResult
+			}
+		}
+	}
+	for _, res := range results {
+		switch {
+		case res.Error != nil:
+			failed++
+		case res.Accepted:
+			accepted++
+		case res.Reason == "duplicate":
+			duplicates++
+		}
+	}
+
+	for id, ev := range events {
+		ev.emit(s, id)
+	}
+	s.feed.publish(feed...)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"accepted":   accepted,
+		"duplicates": duplicates,
+		"errors":     failed,
+		"results":    results,
+	})
+}
+
+// batchEvents collects what a batch stored for one stream, so its UI
+// events fire once per batch
+type batchEvents struct {
+	bets, ticks           int
+	betNonce, tickNonce   int
+	betResult, tickResult float64
+	gap                   bool
+}
+
+func (ev *batchEvents) emit(s *Server, streamID uuid.UUID) {
+	if ev.ticks > 0 {
+		s.emit("live:tick:"+streamID.String(), map[string]any{
+			"nonce":       ev.tickNonce,
+			"roundResult": ev.tickResult,
+			"count":       ev.ticks,
+		})
+	}
+	if ev.bets > 0 {
+		s.emit("live:newrows:"+streamID.String(), map[string]any{
+			"nonce":       ev.betNonce,
+			"roundResult": ev.betResult,
+			"count":       ev.bets,
+		})
+	}
+	if ev.gap {
+		s.backfill.Kick(streamID)
+	}
+}
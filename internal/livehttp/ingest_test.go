@@ -0,0 +1,141 @@
+package livehttp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadIngestBatch(t *testing.T) {
+	tests := []struct {
+		name, contentType, body string
+		want                    int
+		last                    string
+		err                     error
+	}{
+		{"ndjson", "application/x-ndjson", "{\"nonce\":1}\n\n  {\"nonce\":2}\r\n{\"nonce\":3}", 3, `{"nonce":3}`, nil},
+		{"array", "application/json", ` [{"nonce":1}, {"nonce":2}]`, 2, `{"nonce":2}`, nil},
+		{"ndjson too large", "application/x-ndjson", strings.Repeat("{}\n", maxIngestBatch+1), 0, "", errBatchTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/live/ingest", nil)
+			r.Header.Set("Content-Type", tt.contentType)
+			body := bufio.NewReader(strings.NewReader(tt.body))
+			if !isBatchIngest(r, body) {
+				t.Fatal("expected a batch body")
+			}
+			raw, err := readIngestBatch(r, body)
+			if !errors.Is(err, tt.err) || len(raw) != tt.want {
+				t.Fatalf("expected %d messages and %v, got %d and %v", tt.want, tt.err, len(raw), err)
+			}
+			if tt.want > 0 && string(raw[tt.want-1]) != tt.last {
+				t.Errorf("unexpected last message %s", raw[tt.want-1])
+			}
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/live/ingest", nil)
+	if isBatchIngest(r, bufio.NewReader(strings.NewReader(` {"nonce":1}`))) {
+		t.Error("a single JSON object is not a batch")
+	}
+}
+
+func TestIngestBatchResults(t *testing.T) {
+	st := newTestStore(t)
+	s := New(nil, st, 0, "")
+	s.auth = newIngestAuth(st, "")
+	if err := s.auth.load(context.Background()); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	lines := []string{
+		`{"v":1,"id":"b1","nonce":1,"roundResult":2,"difficulty":"easy","serverSeedHashed":"h","clientSeed":"c"}`,
+		`{"type":"heartbeat","nonce":2,"roundResult":1.5,"serverSeedHashed":"h","clientSeed":"c"}`,
+		`{"v":1,"id":"b1","nonce":1,"roundResult":2,"difficulty":"easy","serverSeedHashed":"h","clientSeed":"c"}`,
+		`{"v":2,"id":"b3","nonce":3,"game":"nope","serverSeedHashed":"h","clientSeed":"c"}`,
+		`not json`,
+	}
+	r := httptest.NewRequest(http.MethodPost, "/live/ingest", strings.NewReader(strings.Join(lines, "\n")))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	s.handleIngest(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+
+	var resp struct {
+		Accepted, Duplicates, Errors int
+		Results                      []ingestItemResult
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Accepted != 2 || resp.Duplicates != 1 || resp.Errors != 2 || len(resp.Results) != len(lines) {
+		t.Fatalf("unexpected totals %+v", resp)
+	}
+	res := resp.Results
+	for i, r := range res {
+		if r.Index != i {
+			t.Errorf("result %d has index %d", i, r.Index)
+		}
+	}
+	if !res[0].Accepted || res[0].Type != "bet" || res[0].StreamID == "" {
+		t.Errorf("result 0: expected an accepted bet, got %+v", res[0])
+	}
+	if !res[1].Accepted || res[1].Type != "heartbeat" || res[1].StreamID != res[0].StreamID {
+		t.Errorf("result 1: expected an accepted heartbeat on the same stream, got %+v", res[1])
+	}
+	if res[2].Accepted || res[2].Reason != "duplicate" {
+		t.Errorf("result 2: expected a duplicate, got %+v", res[2])
+	}
+	if res[3].Error == nil || res[3].Error.Field != "game" {
+		t.Errorf("result 3: expected a game validation error, got %+v", res[3])
+	}
+	if res[4].Error == nil || res[4].Error.Message != "invalid JSON" {
+		t.Errorf("result 4: expected invalid JSON, got %+v", res[4])
+	}
+}
+
+func TestIngestPayloadValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		msgType string
+		field   string // the offending field; empty when valid
+		game    string
+	}{
+		{"v1 bet", `{"id":"1","nonce":1,"difficulty":"Hard","serverSeedHashed":"h","clientSeed":"c"}`, "bet", "", "pump"},
+		{"v1 bet without difficulty", `{"v":1,"id":"1","nonce":1,"serverSeedHashed":"h","clientSeed":"c"}`, "bet", "difficulty", ""},
+		{"v1 heartbeat", `{"type":"heartbeat","nonce":3,"serverSeedHashed":"h","clientSeed":"c"}`, "heartbeat", "", ""},
+		{"v2 bet", `{"v":2,"id":"1","nonce":1,"game":"Keno","details":{"risk":"low","picks":[1,2,3]},"serverSeedHashed":"h","clientSeed":"c"}`, "bet", "", "keno"},
+		{"v2 bet without game", `{"v":2,"id":"1","nonce":1,"serverSeedHashed":"h","clientSeed":"c"}`, "bet", "game", ""},
+		{"v2 unknown game", `{"v":2,"id":"1","nonce":1,"game":"nope","serverSeedHashed":"h","clientSeed":"c"}`, "bet", "game", ""},
+		{"v2 details not an object", `{"v":2,"id":"1","nonce":1,"game":"dice","details":[1],"serverSeedHashed":"h","clientSeed":"c"}`, "bet", "details", ""},
+		{"v2 details of the wrong type", `{"v":2,"id":"1","nonce":1,"game":"mines","details":{"mines":"three"},"serverSeedHashed":"h","clientSeed":"c"}`, "bet", "details", ""},
+		{"v2 videopoker ev", `{"v":2,"id":"1","nonce":1,"game":"videopoker","details":{"policy":"ev"},"serverSeedHashed":"h","clientSeed":"c"}`, "bet", "", "videopoker"},
+		{"unsupported version", `{"v":3,"id":"1","nonce":1,"serverSeedHashed":"h","clientSeed":"c"}`, "bet", "v", ""},
+		{"missing seeds", `{"id":"1","nonce":1,"difficulty":"easy"}`, "bet", "serverSeedHashed/clientSeed", ""},
+		{"bet without id", `{"nonce":1,"difficulty":"easy","serverSeedHashed":"h","clientSeed":"c"}`, "bet", "id", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p ingestPayload
+			if err := json.Unmarshal([]byte(tt.body), &p); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			msgType, msg, field := p.validate()
+			if msgType != tt.msgType || field != tt.field || (msg == "") != (tt.field == "") {
+				t.Fatalf("validate = %q, %q, %q; want type %q, field %q", msgType, msg, field, tt.msgType, tt.field)
+			}
+			if tt.game != "" && p.Game != tt.game {
+				t.Errorf("expected game %q, got %q", tt.game, p.Game)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package livehttp
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+)
+
+// headerIngestClient names the sender of an ingest request, e.g. one per
+// account, so a new seed pair only closes that sender's streams
+const headerIngestClient = "X-Ingest-Client"
+
+// maxIngestClient bounds the length of an ingest client name
+const maxIngestClient = 64
+
+// ingestClientOf returns who sent an authorized ingest request: the
+// X-Ingest-Client header, else the signing key, else the default client ""
+func ingestClientOf(r *http.Request) string {
+	if c := strings.TrimSpace(r.Header.Get(headerIngestClient)); c != "" {
+		if len(c) > maxIngestClient {
+			c = c[:maxIngestClient]
+		}
+		return c
+	}
+	if signed(r) {
+		return "key:" + r.Header.Get(headerKeyID)
+	}
+	return ""
+}
+
+// emitClosed reports streams closed because successor took over from them
+func (s *Server) emitClosed(closed []uuid.UUID, successor uuid.UUID) {
+	for _, id := range closed {
+		s.emit("live:stream:closed", map[string]any{
+			"streamId":    id.String(),
+			"successorId": successor.String(),
+		})
+	}
+}
+
+// validStreamState reports whether state is one a stream list can filter on
+func validStreamState(state string) bool {
+	switch state {
+	case livestore.StreamActive, livestore.StreamClosed, livestore.StreamVerified:
+		return true
+	}
+	return false
+}
+
+// GET /live/streams/{id}/history
+func (s *Server) handleStreamHistory(w http.ResponseWriter, r *http.Request, streamID uuid.UUID) {
+	chain, err := s.store.StreamHistory(r.Context(), streamID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, errObj("NOT_FOUND", "stream not found", "id"))
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to load stream history", ""))
+	default:
+		writeJSON(w, http.StatusOK, map[string]any{"streams": chain, "count": len(chain)})
+	}
+}
+
+// PUT /live/streams/{id}/state with {"state": "active"|"closed"}
+func (s *Server) handleStreamState(w http.ResponseWriter, r *http.Request, streamID uuid.UUID) {
+	var body struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "invalid JSON", ""))
+		return
+	}
+	state := strings.ToLower(strings.TrimSpace(body.State))
+	if state != livestore.StreamActive && state != livestore.StreamClosed {
+		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "state must be active or closed", "state"))
+		return
+	}
+	err := s.store.SetStreamState(r.Context(), streamID, state)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, errObj("NOT_FOUND", "stream not found", "id"))
+		return
+	case errors.Is(err, livestore.ErrStreamVerified):
+		writeJSON(w, http.StatusConflict, errObj("CONFLICT", err.Error(), "state"))
+		return
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to update stream state", ""))
+		return
+	}
+	s.handleStreamDetail(w, r, streamID)
+}
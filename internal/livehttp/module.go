@@ -3,6 +3,7 @@ package livehttp
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"time"
@@ -10,20 +11,29 @@ import (
 	"github.com/google/uuid"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livealerts"
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/liveanalytics"
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/liveretention"
 	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+	"github.com/MJE43/stake-pf-replay-go/bindings"
 )
 
 // LiveModule is a Wails-bound service that owns the DB and the local HTTP ingest server.
 // UI calls its methods directly (bindings). Antebot posts to the local HTTP server.
 // The module emits UI events on new rows via the ingest handler.
 type LiveModule struct {
-	ctx    context.Context
-	store  *livestore.Store
-	server *Server
+	ctx       context.Context
+	store     *livestore.Store
+	server    *Server
+	analytics *liveanalytics.Service
+	backfill  *backfiller
+	alerts    *livealerts.Service
+	retention *liveretention.Service
+	auth      *ingestAuth
+	replay    *bindings.App
 
 	dbPath string
 	port   int
-	token  string
 }
 
 // NewLiveModule constructs the module but does not start the HTTP server.
@@ -34,18 +44,36 @@ func NewLiveModule(dbPath string, port int, token string) (*LiveModule, error) {
 		return nil, err
 	}
 	m := &LiveModule{
-		store:  store,
-		dbPath: dbPath,
-		port:   port,
-		token:  token,
+		store:     store,
+		analytics: liveanalytics.New(store),
+		alerts:    livealerts.New(store),
+		auth:      newIngestAuth(store, token),
+		dbPath:    dbPath,
+		port:      port,
 	}
+	m.backfill = newBackfiller(store, m.analytics)
+	m.retention = liveretention.New(store, m.analytics)
 	return m, nil
 }
 
 // Startup stores the Wails context and starts the local HTTP server.
 func (m *LiveModule) Startup(ctx context.Context) error {
 	m.ctx = ctx
-	m.server = New(ctx, m.store, m.port, m.token)
+	if err := m.auth.load(ctx); err != nil {
+		return err
+	}
+	m.server = New(ctx, m.store, m.port, "")
+	m.server.auth = m.auth
+	m.server.analytics = m.analytics
+	m.backfill.wailsCtx = ctx
+	m.server.backfill = m.backfill
+	m.server.alerts = m.alerts
+	m.server.retention = m.retention
+	m.server.replay = m.replay
+	if err := m.alerts.Start(ctx); err != nil {
+		return err
+	}
+	m.retention.Start(ctx)
 	return m.server.Start()
 }
 
@@ -55,6 +83,29 @@ func (m *LiveModule) Shutdown(ctx context.Context) error {
 	return m.store.Close()
 }
 
+// SetSealer encrypts the plain server seeds the module keeps for seed
+// aliases, and its ingest secrets. Call it before Startup.
+func (m *LiveModule) SetSealer(sealer livestore.Sealer) {
+	m.store.SetSealer(sealer)
+}
+
+// SetReplayApp is the replay engine streams are opened as runs in, see
+// OpenStreamAsRun. Call it before Startup.
+func (m *LiveModule) SetReplayApp(app *bindings.App) {
+	m.replay = app
+}
+
+// ResealSeeds encrypts seed aliases and ingest secrets stored in
+// plaintext or under an older key and returns how many changed.
+func (m *LiveModule) ResealSeeds() (int, error) {
+	seeds, err := m.store.ResealSeedAliases(context.Background())
+	if err != nil {
+		return seeds, err
+	}
+	secrets, err := m.store.ResealIngestSecrets(context.Background())
+	return seeds + secrets, err
+}
+
 // ------------- Wails binding methods (UI calls) -------------
 
 // ListStreams returns recent streams with aggregates, ordered by last_seen_at desc.
@@ -62,6 +113,38 @@ func (m *LiveModule) ListStreams(limit int, offset int) ([]livestore.LiveStream,
 	return m.store.ListStreams(m.ctx, limit, offset)
 }
 
+// ListStreamsByState is ListStreams limited to "active", "closed" or
+// "verified" streams; an empty state lists them all.
+func (m *LiveModule) ListStreamsByState(state string, limit int, offset int) ([]livestore.LiveStream, error) {
+	if state != "" && !validStreamState(state) {
+		return nil, fmt.Errorf("state must be active, closed or verified")
+	}
+	return m.store.ListStreamsByState(m.ctx, state, limit, offset)
+}
+
+// GetStreamHistory returns the seed history a stream is part of, from the
+// earliest stream of its ingest client's chain to the latest.
+func (m *LiveModule) GetStreamHistory(streamID string) ([]livestore.LiveStream, error) {
+	id, err := uuid.Parse(streamID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream id: %w", err)
+	}
+	return m.store.StreamHistory(m.ctx, id)
+}
+
+// SetStreamState closes a stream ("closed") or reopens it ("active").
+// Verified streams can't change.
+func (m *LiveModule) SetStreamState(streamID string, state string) error {
+	id, err := uuid.Parse(streamID)
+	if err != nil {
+		return fmt.Errorf("invalid stream id: %w", err)
+	}
+	if state != livestore.StreamActive && state != livestore.StreamClosed {
+		return fmt.Errorf("state must be active or closed")
+	}
+	return m.store.SetStreamState(m.ctx, id, state)
+}
+
 // GetStream returns metadata and aggregates for a stream.
 func (m *LiveModule) GetStream(streamID string) (livestore.LiveStream, error) {
 	id, err := uuid.Parse(streamID)
@@ -145,13 +228,41 @@ func (m *LiveModule) ExportCSV(streamID string) (string, error) {
 	return path, nil
 }
 
+// ExportStream writes a stream's bets or rounds, picked by table, to an
+// NDJSON or Parquet file with typed columns. An empty path opens a save
+// dialog; progress is reported on bindings.ExportProgressEvent.
+func (m *LiveModule) ExportStream(streamID, table, format, path string) (bindings.ExportResult, error) {
+	id, err := uuid.Parse(streamID)
+	if err != nil {
+		return bindings.ExportResult{}, fmt.Errorf("invalid stream id: %w", err)
+	}
+	f, err := bindings.ParseExportFormat(format)
+	if err != nil {
+		return bindings.ExportResult{}, err
+	}
+	if table != "" && table != "bets" && table != "rounds" {
+		return bindings.ExportResult{}, fmt.Errorf("unknown export table %q (want bets or rounds)", table)
+	}
+	if _, err := m.store.GetStream(m.ctx, id); err != nil {
+		return bindings.ExportResult{}, fmt.Errorf("stream not found: %w", err)
+	}
+	return bindings.ExportToFile(m.ctx, path, exportName(id, table), f,
+		func(w io.Writer, progress bindings.ExportProgress) (int64, error) {
+			return writeStreamExport(m.ctx, m.store, w, id, table, f, nil, progress)
+		})
+}
+
 // DeleteStream removes a stream and all its bets.
 func (m *LiveModule) DeleteStream(streamID string) error {
 	id, err := uuid.Parse(streamID)
 	if err != nil {
 		return fmt.Errorf("invalid stream id: %w", err)
 	}
-	return m.store.DeleteStream(m.ctx, id)
+	if err := m.store.DeleteStream(m.ctx, id); err != nil {
+		return err
+	}
+	m.analytics.Invalidate(id)
+	return nil
 }
 
 // UpdateNotes sets the notes field on a stream.
@@ -163,20 +274,215 @@ func (m *LiveModule) UpdateNotes(streamID string, notes string) error {
 	return m.store.UpdateNotes(m.ctx, id, notes)
 }
 
+// GetStreamAnalytics returns the tier cadences of a stream: per tier the
+// current streak, recent gaps, rolling hit rate and p-values against the
+// exact Pump odds. series adds every gap.
+func (m *LiveModule) GetStreamAnalytics(streamID string, series bool) (liveanalytics.StreamAnalytics, error) {
+	id, err := uuid.Parse(streamID)
+	if err != nil {
+		return liveanalytics.StreamAnalytics{}, fmt.Errorf("invalid stream id: %w", err)
+	}
+	return m.analytics.Stream(m.ctx, id, series)
+}
+
+// GetAnalyticsConfig returns the tracked tiers and summary settings.
+func (m *LiveModule) GetAnalyticsConfig() liveanalytics.Config {
+	return m.analytics.Config()
+}
+
+// SetAnalyticsConfig changes the tracked tiers for every stream.
+func (m *LiveModule) SetAnalyticsConfig(cfg liveanalytics.Config) (liveanalytics.Config, error) {
+	if err := m.analytics.SetConfig(cfg); err != nil {
+		return liveanalytics.Config{}, err
+	}
+	return m.analytics.Config(), nil
+}
+
+// GetStreamCoverage returns which nonces of a stream have rounds, with up
+// to limit missing ranges.
+func (m *LiveModule) GetStreamCoverage(streamID string, limit int) (livestore.Coverage, error) {
+	id, err := uuid.Parse(streamID)
+	if err != nil {
+		return livestore.Coverage{}, fmt.Errorf("invalid stream id: %w", err)
+	}
+	return m.store.GetCoverage(m.ctx, id, limit)
+}
+
+// SetServerSeed records the revealed server seed of a stream, which must
+// hash to its server_seed_hashed, and starts backfilling missing rounds.
+func (m *LiveModule) SetServerSeed(streamID string, serverSeed string) error {
+	id, err := uuid.Parse(streamID)
+	if err != nil {
+		return fmt.Errorf("invalid stream id: %w", err)
+	}
+	return setServerSeed(m.ctx, m.store, m.backfill, id, serverSeed)
+}
+
+// BackfillStream computes the rounds a stream is missing from its server
+// seed and stores them marked as computed.
+func (m *LiveModule) BackfillStream(streamID string) (BackfillResult, error) {
+	id, err := uuid.Parse(streamID)
+	if err != nil {
+		return BackfillResult{}, fmt.Errorf("invalid stream id: %w", err)
+	}
+	return m.backfill.Run(m.ctx, id)
+}
+
+// VerifyStream replays every bet of a stream from its server seed, with
+// each bet's game and details, and lists those whose recorded result
+// doesn't match.
+func (m *LiveModule) VerifyStream(streamID string) (VerifyResult, error) {
+	id, err := uuid.Parse(streamID)
+	if err != nil {
+		return VerifyResult{}, fmt.Errorf("invalid stream id: %w", err)
+	}
+	return verifyStream(m.ctx, m.store, id)
+}
+
+// OpenStreamAsRun turns a stream whose server seed is known into a replay
+// run over the nonces played on it, each hit pairing the observed result
+// with the recomputed one.
+func (m *LiveModule) OpenStreamAsRun(streamID string) (bindings.ObservedRunResult, error) {
+	id, err := uuid.Parse(streamID)
+	if err != nil {
+		return bindings.ObservedRunResult{}, fmt.Errorf("invalid stream id: %w", err)
+	}
+	return openStreamRun(m.ctx, m.store, m.replay, id)
+}
+
+// ListAlertRules returns every alert rule, enabled or not.
+func (m *LiveModule) ListAlertRules() ([]livestore.AlertRule, error) {
+	return m.alerts.Rules(m.ctx)
+}
+
+// SaveAlertRule creates a rule when its ID is 0 and replaces it
+// otherwise. Changes apply to the next ingested round.
+func (m *LiveModule) SaveAlertRule(rule livestore.AlertRule) (livestore.AlertRule, error) {
+	return m.alerts.SaveRule(m.ctx, rule)
+}
+
+// DeleteAlertRule removes a rule and its firing history.
+func (m *LiveModule) DeleteAlertRule(ruleID int64) error {
+	return m.alerts.DeleteRule(m.ctx, ruleID)
+}
+
+// TestAlertRule replays a recorded stream through a rule, saved or not,
+// and returns what it would have fired without acting on it.
+func (m *LiveModule) TestAlertRule(rule livestore.AlertRule, streamID string) (livealerts.TestResult, error) {
+	id, err := uuid.Parse(streamID)
+	if err != nil {
+		return livealerts.TestResult{}, fmt.Errorf("invalid stream id: %w", err)
+	}
+	return m.alerts.Test(m.ctx, rule, id)
+}
+
+// ListAlertFirings returns the latest alert firings, newest first. A
+// ruleID of 0 or an empty streamID doesn't filter.
+func (m *LiveModule) ListAlertFirings(ruleID int64, streamID string, limit int) ([]livestore.AlertFiring, error) {
+	var id *uuid.UUID
+	if streamID != "" {
+		parsed, err := uuid.Parse(streamID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stream id: %w", err)
+		}
+		id = &parsed
+	}
+	return m.alerts.Firings(m.ctx, ruleID, id, limit)
+}
+
+// ListRetentionPolicies returns the retention policies, the global one
+// (with an empty stream id) first.
+func (m *LiveModule) ListRetentionPolicies() ([]livestore.RetentionPolicy, error) {
+	return m.retention.Policies(m.ctx)
+}
+
+// SaveRetentionPolicy creates or replaces a stream's retention policy, or
+// the global one when its stream id is empty.
+func (m *LiveModule) SaveRetentionPolicy(p livestore.RetentionPolicy) (livestore.RetentionPolicy, error) {
+	return m.retention.SavePolicy(m.ctx, p)
+}
+
+// DeleteRetentionPolicy removes a stream's retention policy, or the global
+// one when streamID is empty.
+func (m *LiveModule) DeleteRetentionPolicy(streamID string) error {
+	return m.retention.DeletePolicy(m.ctx, streamID)
+}
+
+// RunRetention applies the retention policies now and returns once the
+// database is vacuumed. Progress is emitted on "live:retention:progress".
+func (m *LiveModule) RunRetention() (liveretention.Report, error) {
+	return m.retention.Run(m.ctx)
+}
+
+// GetRetentionStatus reports a running retention pass and the last one.
+func (m *LiveModule) GetRetentionStatus() liveretention.Status {
+	return m.retention.Status()
+}
+
+// GetRoundBlocks returns the compacted blocks of a stream in nonce order.
+func (m *LiveModule) GetRoundBlocks(streamID string) ([]livestore.RoundBlock, error) {
+	id, err := uuid.Parse(streamID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream id: %w", err)
+	}
+	return m.store.RoundBlocks(m.ctx, id)
+}
+
 // IngestInfo returns the loopback URL Antebot should post to and whether a token is required.
 // Useful to render in a Settings/About UI.
 type IngestInfo struct {
-	URL          string `json:"url"`
-	TokenEnabled bool   `json:"tokenEnabled"`
+	URL             string `json:"url"`
+	TokenEnabled    bool   `json:"tokenEnabled"`
+	SigningRequired bool   `json:"signingRequired"`
+	ActiveKeys      int    `json:"activeKeys"`
 }
 
 func (m *LiveModule) IngestInfo() IngestInfo {
+	m.auth.mu.Lock()
+	defer m.auth.mu.Unlock()
 	return IngestInfo{
-		URL:          fmt.Sprintf("http://127.0.0.1:%d/live/ingest", m.port),
-		TokenEnabled: m.token != "",
+		URL:             fmt.Sprintf("http://127.0.0.1:%d/live/ingest", m.port),
+		TokenEnabled:    m.auth.token != "",
+		SigningRequired: m.auth.signingRequired,
+		ActiveKeys:      m.auth.activeKeys(),
 	}
 }
 
+// RotateIngestToken replaces the X-Ingest-Token with a new random one,
+// which takes over from LIVE_INGEST_TOKEN from now on, and returns it.
+func (m *LiveModule) RotateIngestToken() (string, error) {
+	return m.auth.rotateToken(m.ctx)
+}
+
+// CreateIngestKey adds a key for signing ingest requests. Its secret is
+// only returned here.
+func (m *LiveModule) CreateIngestKey(label string) (IngestKeySecret, error) {
+	return m.auth.createKey(m.ctx, label)
+}
+
+// ListIngestKeys returns the signing keys, revoked ones included, without
+// their secrets.
+func (m *LiveModule) ListIngestKeys() ([]livestore.IngestKey, error) {
+	return m.store.ListIngestKeys(m.ctx)
+}
+
+// RevokeIngestKey stops a key from signing ingest requests.
+func (m *LiveModule) RevokeIngestKey(keyID string) error {
+	return m.auth.revokeKey(m.ctx, keyID)
+}
+
+// SetIngestSigningRequired refuses unsigned ingest requests, token or
+// not, when required is true. It needs an active signing key.
+func (m *LiveModule) SetIngestSigningRequired(required bool) error {
+	return m.auth.setSigningRequired(m.ctx, required)
+}
+
+// ListIngestRejections returns the latest refused ingest requests, newest
+// first.
+func (m *LiveModule) ListIngestRejections(limit int) ([]livestore.IngestRejection, error) {
+	return m.store.ListIngestRejections(m.ctx, limit)
+}
+
 // EmitManualTick lets the UI force a "newrows" event (useful for testing the wiring).
 func (m *LiveModule) EmitManualTick(streamID string) {
 	runtime.EventsEmit(m.ctx, "live:newrows:"+streamID, map[string]any{"manual": true})
@@ -0,0 +1,160 @@
+package livehttp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+	"github.com/MJE43/stake-pf-replay-go/bindings"
+)
+
+// errNoSeed is returned for a stream whose plain server seed isn't known
+var errNoSeed = errors.New("the stream's server seed is not known yet")
+
+// openStreamRun opens a stream as a run of the replay engine over the
+// nonces that were played on it: its bets of the run's game and its
+// observed rounds, a bet's result winning over a round's at the same
+// nonce. Computed rounds, and rounds compacted into blocks, weren't
+// observed and are left out. The run takes the game of the latest bet,
+// and each bet is replayed with its own params; a round, with those of the
+// bet before it, or of the first bet when none is. A round doesn't say
+// which game it was, so on a stream of several games only the bets of the
+// run's game are used.
+func openStreamRun(ctx context.Context, st *livestore.Store, app *bindings.App, streamID uuid.UUID) (bindings.ObservedRunResult, error) {
+	if app == nil {
+		return bindings.ObservedRunResult{}, fmt.Errorf("replay runs not available")
+	}
+	ls, err := st.GetStream(ctx, streamID)
+	if err != nil {
+		return bindings.ObservedRunResult{}, err
+	}
+	plain, known, err := st.LookupSeedAlias(ctx, ls.ServerSeedHashed)
+	if err != nil {
+		return bindings.ObservedRunResult{}, err
+	}
+	if !known {
+		return bindings.ObservedRunResult{}, errNoSeed
+	}
+	if !seedMatchesHash(plain, ls.ServerSeedHashed) {
+		return bindings.ObservedRunResult{}, fmt.Errorf("stored server seed does not hash to %s", ls.ServerSeedHashed)
+	}
+	game, params := livestore.DefaultGame, map[string]any{}
+	latest, ok, err := st.LatestBet(ctx, streamID)
+	if err != nil {
+		return bindings.ObservedRunResult{}, err
+	}
+	if ok {
+		if params, err = betParams(latest); err != nil {
+			return bindings.ObservedRunResult{}, err
+		}
+		game = latest.Game
+	}
+	mixed := len(ls.Games) > 1
+
+	// Bets are read up front, and rounds a page at a time, each page's
+	// query closed before its rounds are evaluated and saved, so the
+	// store's single connection isn't held while the run is written
+	var (
+		bets    []livestore.LiveBet
+		betArgs []map[string]any
+	)
+	err = st.EachBet(ctx, streamID, func(b livestore.LiveBet) error {
+		if b.Game != game || b.Nonce < 0 {
+			return nil
+		}
+		p, err := betParams(b)
+		if err != nil {
+			return err
+		}
+		bets, betArgs = append(bets, b), append(betArgs, p)
+		return nil
+	})
+	if err != nil {
+		return bindings.ObservedRunResult{}, err
+	}
+
+	req := bindings.ObservedRun{
+		Game:   game,
+		Seeds:  bindings.Seeds{Server: plain, Client: ls.ClientSeed},
+		Params: params,
+		Name:   fmt.Sprintf("Live stream %s", ls.ID.String()[:8]),
+		Notes:  fmt.Sprintf("Played nonces of live stream %s (client seed %s).", ls.ID, ls.ClientSeed),
+		Tags:   []string{"live"},
+	}
+	if mixed {
+		req.Notes += fmt.Sprintf(" Only its %s bets; the stream was played on %s.", game, strings.Join(ls.Games, ", "))
+	}
+	// The engine skips a nonce it has already had, so yielding a nonce's
+	// bet before its round keeps the bet's result
+	each := func(yield func(bindings.ObservedRound) error) error {
+		i := 0
+		var roundArgs map[string]any // nil runs the run's params
+		if len(betArgs) > 0 {
+			roundArgs = betArgs[0]
+		}
+		yieldBets := func(upTo int64) error {
+			for ; i < len(bets) && bets[i].Nonce <= upTo; i++ {
+				b := bets[i]
+				roundArgs = betArgs[i]
+				if err := yield(bindings.ObservedRound{Nonce: uint64(b.Nonce), Observed: b.RoundResult, Source: "bet", Params: roundArgs}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if !mixed {
+			err := st.EachRoundPage(ctx, streamID, func(page []livestore.LiveRound) error {
+				for _, r := range page {
+					if r.Source != livestore.RoundObserved || r.Nonce < 0 {
+						continue
+					}
+					if err := yieldBets(r.Nonce); err != nil {
+						return err
+					}
+					if err := yield(bindings.ObservedRound{Nonce: uint64(r.Nonce), Observed: r.RoundResult, Source: "round", Params: roundArgs}); err != nil {
+						return err
+					}
+				}
+				return ctx.Err()
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return yieldBets(math.MaxInt64)
+	}
+
+	res, err := app.OpenObservedRun(req, each)
+	if err != nil {
+		return res, err
+	}
+	fmt.Printf("[livehttp] opened %s as run %s over %d played nonces, %d mismatched\n", streamID, res.RunID, res.Rounds, res.Mismatched)
+	return res, nil
+}
+
+// POST /live/streams/{id}/run
+func (s *Server) handleStreamRun(w http.ResponseWriter, r *http.Request, streamID uuid.UUID) {
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	res, err := openStreamRun(r.Context(), s.store, s.replay, streamID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, errObj("NOT_FOUND", "stream not found", "id"))
+	case errors.Is(err, errNoSeed):
+		writeJSON(w, http.StatusConflict, errObj("CONFLICT", err.Error(), "server_seed"))
+	case errors.Is(err, bindings.ErrNoObservedRounds):
+		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "the stream has no played rounds", ""))
+	case err != nil:
+		fmt.Printf("[livehttp] warning: opening %s as a run failed: %v\n", streamID, err)
+		writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to open stream as a run", ""))
+	default:
+		writeJSON(w, http.StatusCreated, res)
+	}
+}
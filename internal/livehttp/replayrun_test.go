@@ -0,0 +1,174 @@
+package livehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+	"github.com/MJE43/stake-pf-replay-go/bindings"
+)
+
+// newReplayApp starts a replay engine whose runs database lives under a
+// temporary config directory
+func newReplayApp(t *testing.T) *bindings.App {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	app := bindings.New(nil)
+	app.Startup(ctx)
+	t.Cleanup(func() {
+		app.Shutdown()
+		cancel()
+	})
+	return app
+}
+
+// replayStream stores a stream whose plain server seed is known
+func replayStream(t *testing.T, st *livestore.Store, plain, client string) uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+	id, err := st.FindOrCreateStream(ctx, hashSeed(plain), client)
+	if err != nil {
+		t.Fatalf("FindOrCreateStream: %v", err)
+	}
+	if err := st.UpsertSeedAlias(ctx, hashSeed(plain), plain); err != nil {
+		t.Fatalf("UpsertSeedAlias: %v", err)
+	}
+	return id
+}
+
+func metricOf(t *testing.T, game, plain, client string, nonce int64, params map[string]any) float64 {
+	t.Helper()
+	m, err := bindings.EvaluateMetric(game, plain, client, uint64(nonce), params)
+	if err != nil {
+		t.Fatalf("EvaluateMetric: %v", err)
+	}
+	return m
+}
+
+func ingestReplayBet(t *testing.T, st *livestore.Store, id uuid.UUID, game string, nonce int64, details string, result float64) {
+	t.Helper()
+	now := time.Now().UTC()
+	bet := livestore.LiveBet{
+		AntebotBetID: fmt.Sprintf("run-%s-%d", game, nonce),
+		ReceivedAt:   now,
+		DateTime:     now,
+		Nonce:        nonce,
+		Amount:       1,
+		Difficulty:   "easy",
+		RoundResult:  result,
+		Game:         game,
+		Details:      details,
+	}
+	if _, err := st.IngestBet(context.Background(), id, bet); err != nil {
+		t.Fatalf("IngestBet: %v", err)
+	}
+}
+
+func TestOpenStreamRun(t *testing.T) {
+	st := newTestStore(t)
+	app := newReplayApp(t)
+	ctx := context.Background()
+	const plain, client = "run-server-seed", "run-client"
+	id := replayStream(t, st, plain, client)
+	hard := map[string]any{"difficulty": "hard"}
+	expert := map[string]any{"difficulty": "expert"}
+
+	// Bets on 2 at hard and 4 at expert; the observed rounds around them
+	// were played at the same difficulty as the bet before, or the first
+	ingestReplayBet(t, st, id, "pump", 2, `{"difficulty":"hard"}`, metricOf(t, "pump", plain, client, 2, hard))
+	ingestReplayBet(t, st, id, "pump", 4, `{"difficulty":"expert"}`, metricOf(t, "pump", plain, client, 4, expert))
+	now := time.Now().UTC()
+	rounds := []livestore.LiveRound{
+		{Nonce: 1, RoundResult: metricOf(t, "pump", plain, client, 1, hard), Source: livestore.RoundObserved},
+		{Nonce: 2, RoundResult: 999, Source: livestore.RoundObserved}, // the bet wins
+		{Nonce: 3, RoundResult: metricOf(t, "pump", plain, client, 3, hard), Source: livestore.RoundObserved},
+		{Nonce: 4, RoundResult: 999, Source: livestore.RoundObserved},
+		{Nonce: 5, RoundResult: metricOf(t, "pump", plain, client, 5, expert) + 3, Source: livestore.RoundObserved},
+		{Nonce: 6, RoundResult: 1, Source: livestore.RoundComputed}, // never played
+	}
+	for i := range rounds {
+		rounds[i].ReceivedAt = now
+	}
+	if _, err := st.ImportRounds(ctx, id, rounds); err != nil {
+		t.Fatalf("ImportRounds: %v", err)
+	}
+
+	res, err := openStreamRun(ctx, st, app, id)
+	if err != nil {
+		t.Fatalf("openStreamRun: %v", err)
+	}
+	if res.Rounds != 5 || res.Matched != 4 || res.Mismatched != 1 || res.NonceStart != 1 || res.NonceEnd != 5 {
+		t.Fatalf("expected nonces 1-5 with one mismatch, got %+v", res)
+	}
+	run, err := app.GetRun(res.RunID)
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if run.Game != "pump" || run.ParamsJSON != `{"difficulty":"expert"}` {
+		t.Errorf("expected a pump run with the latest bet's params, got %s %s", run.Game, run.ParamsJSON)
+	}
+}
+
+func TestOpenStreamRunMixedGames(t *testing.T) {
+	st := newTestStore(t)
+	app := newReplayApp(t)
+	ctx := context.Background()
+	const plain, client = "mixed-server-seed", "mixed-client"
+	id := replayStream(t, st, plain, client)
+
+	ingestReplayBet(t, st, id, "pump", 1, `{"difficulty":"easy"}`, 1)
+	ingestReplayBet(t, st, id, "dice", 2, "", metricOf(t, "dice", plain, client, 2, nil))
+	ingestReplayBet(t, st, id, "dice", 4, "", metricOf(t, "dice", plain, client, 4, nil))
+	// Rounds don't say their game, so they are left out
+	if _, err := st.ImportRounds(ctx, id, []livestore.LiveRound{
+		{Nonce: 3, RoundResult: 50, ReceivedAt: time.Now().UTC(), Source: livestore.RoundObserved},
+	}); err != nil {
+		t.Fatalf("ImportRounds: %v", err)
+	}
+
+	res, err := openStreamRun(ctx, st, app, id)
+	if err != nil {
+		t.Fatalf("openStreamRun: %v", err)
+	}
+	if res.Rounds != 2 || res.Matched != 2 || res.NonceStart != 2 || res.NonceEnd != 4 {
+		t.Fatalf("expected the two dice bets only, got %+v", res)
+	}
+	if run, _ := app.GetRun(res.RunID); run == nil || run.Game != "dice" {
+		t.Errorf("expected a dice run, got %+v", run)
+	}
+}
+
+func TestOpenStreamRunRejects(t *testing.T) {
+	st := newTestStore(t)
+	app := newReplayApp(t)
+	ctx := context.Background()
+
+	unknown, err := st.FindOrCreateStream(ctx, hashSeed("secret"), "client")
+	if err != nil {
+		t.Fatalf("FindOrCreateStream: %v", err)
+	}
+	if _, err := openStreamRun(ctx, st, app, unknown); !errors.Is(err, errNoSeed) {
+		t.Errorf("expected errNoSeed without the plain seed, got %v", err)
+	}
+
+	// Only computed rounds: nothing was played
+	id := replayStream(t, st, "empty-server-seed", "client")
+	if _, err := st.ImportRounds(ctx, id, []livestore.LiveRound{
+		{Nonce: 1, RoundResult: 2, ReceivedAt: time.Now().UTC(), Source: livestore.RoundComputed},
+	}); err != nil {
+		t.Fatalf("ImportRounds: %v", err)
+	}
+	if _, err := openStreamRun(ctx, st, app, id); !errors.Is(err, bindings.ErrNoObservedRounds) {
+		t.Errorf("expected ErrNoObservedRounds, got %v", err)
+	}
+
+	if _, err := openStreamRun(ctx, st, nil, id); err == nil {
+		t.Error("expected an error without a replay engine")
+	}
+}
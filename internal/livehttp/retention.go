@@ -0,0 +1,91 @@
+package livehttp
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/liveretention"
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+)
+
+// GET /live/retention
+func (s *Server) handleRetention(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, "GET")
+		return
+	}
+	policies, err := s.retention.Policies(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to list retention policies", ""))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"policies": policies, "status": s.retention.Status()})
+}
+
+// PUT|DELETE /live/retention/policy; DELETE takes ?stream_id=, empty for
+// the global policy
+func (s *Server) handleRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		p := livestore.RetentionPolicy{Enabled: true}
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "invalid JSON", ""))
+			return
+		}
+		if err := liveretention.Validate(&p); err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", err.Error(), ""))
+			return
+		}
+		saved, err := s.retention.SavePolicy(r.Context(), p)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to save retention policy", ""))
+			return
+		}
+		writeJSON(w, http.StatusOK, saved)
+	case http.MethodDelete:
+		streamID := r.URL.Query().Get("stream_id")
+		if streamID != "" {
+			id, err := uuid.Parse(streamID)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, errObj("VALIDATION_ERROR", "invalid stream id", "stream_id"))
+				return
+			}
+			streamID = id.String()
+		}
+		err := s.retention.DeletePolicy(r.Context(), streamID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			writeJSON(w, http.StatusNotFound, errObj("NOT_FOUND", "retention policy not found", "stream_id"))
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to delete retention policy", ""))
+		default:
+			writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+		}
+	default:
+		methodNotAllowed(w, "PUT, DELETE")
+	}
+}
+
+// POST /live/retention/run starts a run in the background; its progress
+// is on "live:retention:progress" and GET /live/retention
+func (s *Server) handleRetentionRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, "POST")
+		return
+	}
+	if s.retention.Status().Running {
+		writeJSON(w, http.StatusConflict, errObj("CONFLICT", liveretention.ErrRunning.Error(), ""))
+		return
+	}
+	go func() {
+		if _, err := s.retention.Run(s.wailsCtx); err != nil && !errors.Is(err, liveretention.ErrRunning) {
+			fmt.Printf("[livehttp] warning: retention run failed: %v\n", err)
+		}
+	}()
+	writeJSON(w, http.StatusAccepted, map[string]any{"started": true})
+}
@@ -1,6 +1,8 @@
 package livehttp
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/csv"
@@ -16,16 +18,26 @@ import (
 	"github.com/google/uuid"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livealerts"
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/liveanalytics"
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/liveretention"
 	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+	"github.com/MJE43/stake-pf-replay-go/bindings"
 )
 
 // Server runs a local HTTP API for Antebot ingest and UI queries.
 type Server struct {
 	store       *livestore.Store
-	token       string
+	auth        *ingestAuth
 	addr        string // e.g. "127.0.0.1:8077"
 	httpServer  *http.Server
 	wailsCtx    context.Context
+	analytics   *liveanalytics.Service
+	backfill    *backfiller
+	alerts      *livealerts.Service
+	retention   *liveretention.Service
+	replay      *bindings.App // opens streams as replay runs; nil when not wired
+	feed        *feedHub
 	writeTimout time.Duration
 	readTimeout time.Duration
 }
@@ -38,14 +50,23 @@ func New(wailsCtx context.Context, store *livestore.Store, port int, token strin
 	}
 	return &Server{
 		store:       store,
-		token:       token,
+		auth:        newIngestAuth(store, token),
 		addr:        fmt.Sprintf("127.0.0.1:%d", port),
 		wailsCtx:    wailsCtx,
+		feed:        newFeedHub(),
 		writeTimout: 10 * time.Second,
 		readTimeout: 10 * time.Second,
 	}
 }
 
+// emit sends a UI event. A server without a Wails context, as in tests,
+// sends none.
+func (s *Server) emit(name string, data any) {
+	if s.wailsCtx != nil {
+		runtime.EventsEmit(s.wailsCtx, name, data)
+	}
+}
+
 // Start begins listening in a goroutine. It returns when the socket is bound.
 func (s *Server) Start() error {
 	mux := http.NewServeMux()
@@ -55,7 +76,26 @@ func (s *Server) Start() error {
 
 	// Streams
 	mux.HandleFunc("/live/streams", s.handleStreams)
-	mux.HandleFunc("/live/streams/", s.handleStreamSubroutes) // detail, bets, tail, export, notes, delete
+	mux.HandleFunc("/live/streams/", s.handleStreamSubroutes) // detail, bets, tail, feed, export, analytics, history, state, notes, delete
+
+	// Feeds of every stream; one stream's is under /live/streams/{id}/feed
+	mux.HandleFunc("/live/feed", func(w http.ResponseWriter, r *http.Request) {
+		s.handleFeed(w, r, uuid.Nil)
+	})
+
+	// Analytics
+	mux.HandleFunc("/live/analytics/config", s.handleAnalyticsConfig)
+
+	// Alerts
+	mux.HandleFunc("/live/alerts/rules", s.handleAlertRules)
+	mux.HandleFunc("/live/alerts/rules/", s.handleAlertRule)
+	mux.HandleFunc("/live/alerts/test", s.handleAlertTest)
+	mux.HandleFunc("/live/alerts/firings", s.handleAlertFirings)
+
+	// Retention
+	mux.HandleFunc("/live/retention", s.handleRetention)
+	mux.HandleFunc("/live/retention/policy", s.handleRetentionPolicy)
+	mux.HandleFunc("/live/retention/run", s.handleRetentionRun)
 
 	s.httpServer = &http.Server{
 		Addr:         s.addr,
@@ -79,6 +119,7 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	if s.httpServer == nil {
 		return nil
 	}
+	s.feed.close()
 	return s.httpServer.Shutdown(ctx)
 }
 
@@ -90,52 +131,49 @@ func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
 		methodNotAllowed(w, "POST")
 		return
 	}
-	if s.token != "" {
-		if r.Header.Get("X-Ingest-Token") != s.token {
-			writeJSON(w, http.StatusUnauthorized, errObj("UNAUTHORIZED", "missing or invalid X-Ingest-Token", ""))
-			return
-		}
-	}
-
-	var p ingestPayload
-	dec := json.NewDecoder(r.Body)
-	if err := dec.Decode(&p); err != nil {
-		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "invalid JSON", ""))
+	raw, ok := s.authorizeIngest(w, r)
+	if !ok {
 		return
 	}
 
-	// Determine message type (default to "bet" for backwards compatibility)
-	msgType := strings.ToLower(p.Type)
-	if msgType == "" {
-		msgType = "bet"
+	body := bufio.NewReader(bytes.NewReader(raw))
+	if isBatchIngest(r, body) {
+		s.handleIngestBatch(w, r, body)
+		return
 	}
 
-	// Common validation for both types
-	if p.ServerSeedHashed == "" || p.ClientSeed == "" {
-		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "serverSeedHashed and clientSeed are required", "serverSeedHashed/clientSeed"))
+	var p ingestPayload
+	dec := json.NewDecoder(body)
+	if err := dec.Decode(&p); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "invalid JSON", ""))
 		return
 	}
-	if p.Nonce <= 0 {
-		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "nonce must be >= 1", "nonce"))
+	msgType, msg, field := p.validate()
+	if msg != "" {
+		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", msg, field))
 		return
 	}
 
 	ctx := r.Context()
 
-	// Find or create stream
-	streamID, err := s.store.FindOrCreateStream(ctx, p.ServerSeedHashed, p.ClientSeed)
+	// Find or create stream; a new one closes the sender's previous streams
+	open, err := s.store.OpenStream(ctx, p.ServerSeedHashed, p.ClientSeed, ingestClientOf(r))
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to upsert stream", ""))
 		return
 	}
+	streamID := open.ID
+	s.emitClosed(open.Closed, streamID)
 
-	switch msgType {
-	case "heartbeat":
+	if msgType == "heartbeat" {
 		s.handleHeartbeat(w, ctx, streamID, p)
-	case "bet":
+	} else {
 		s.handleBet(w, ctx, streamID, p)
-	default:
-		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "invalid type, must be 'bet' or 'heartbeat'", "type"))
+	}
+	if open.Frozen {
+		if err := s.store.RefreezeStream(ctx, streamID); err != nil {
+			fmt.Printf("[livehttp] warning: refreezing closed stream %s failed: %v\n", streamID, err)
+		}
 	}
 }
 
@@ -150,13 +188,20 @@ func (s *Server) handleHeartbeat(w http.ResponseWriter, ctx context.Context, str
 	}
 
 	// Store round result for pattern analysis
-	if err := s.store.InsertRound(ctx, streamID, nonce, p.RoundResult); err != nil {
+	if gap, err := s.store.InsertRound(ctx, streamID, nonce, p.RoundResult); err != nil {
 		// Log but don't fail - the nonce update is more important
 		fmt.Printf("[livehttp] warning: failed to insert round: %v\n", err)
+	} else {
+		s.analytics.Observe(streamID, nonce, p.RoundResult)
+		s.alerts.ObserveRound(streamID, nonce, p.RoundResult)
+		s.feed.publish(roundEvent(streamID, nonce, p.RoundResult))
+		if gap {
+			s.backfill.Kick(streamID)
+		}
 	}
 
 	// Emit tick event for UI to update streak counters
-	runtime.EventsEmit(s.wailsCtx, "live:tick:"+streamID.String(), map[string]any{
+	s.emit("live:tick:"+streamID.String(), map[string]any{
 		"nonce":       nonce,
 		"roundResult": p.RoundResult,
 	})
@@ -170,32 +215,7 @@ func (s *Server) handleHeartbeat(w http.ResponseWriter, ctx context.Context, str
 
 // handleBet processes a bet message (full bet details).
 func (s *Server) handleBet(w http.ResponseWriter, ctx context.Context, streamID uuid.UUID, p ingestPayload) {
-	// Additional validation for bet messages
-	if p.ID == "" {
-		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "id is required for bet messages", "id"))
-		return
-	}
-	if p.Difficulty == "" {
-		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "difficulty is required for bet messages", "difficulty"))
-		return
-	}
-
-	// Parse dateTime; if missing/invalid, use received time
-	parsedDT := parseISOTimeOrNow(p.DateTime)
-
-	// Build bet
-	bet := livestore.LiveBet{
-		StreamID:     streamID,
-		AntebotBetID: p.ID,
-		ReceivedAt:   time.Now().UTC(),
-		DateTime:     parsedDT,
-		Nonce:        int64(p.Nonce),
-		Amount:       p.Amount,
-		Payout:       p.Payout,
-		Difficulty:   strings.ToLower(p.Difficulty),
-		RoundTarget:  p.RoundTarget,
-		RoundResult:  p.RoundResult,
-	}
+	bet := p.bet(streamID)
 
 	res, err := s.store.IngestBet(ctx, streamID, bet)
 	if err != nil && !res.Accepted {
@@ -212,7 +232,10 @@ func (s *Server) handleBet(w http.ResponseWriter, ctx context.Context, streamID
 
 	// Emit event for UI if accepted
 	if res.Accepted {
-		runtime.EventsEmit(s.wailsCtx, "live:newrows:"+streamID.String(), map[string]any{
+		bet.ID = res.ID
+		s.alerts.ObserveBet(streamID, bet)
+		s.feed.publish(betEvent(bet))
+		s.emit("live:newrows:"+streamID.String(), map[string]any{
 			"nonce":       p.Nonce,
 			"roundResult": p.RoundResult,
 		})
@@ -231,8 +254,13 @@ func (s *Server) handleStreams(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		limit := clampInt(qInt(r, "limit", 100), 1, 500)
 		offset := clampInt(qInt(r, "offset", 0), 0, 1_000_000)
+		state := r.URL.Query().Get("state")
+		if state != "" && !validStreamState(state) {
+			writeJSON(w, http.StatusBadRequest, errObj("VALIDATION_ERROR", "state must be active, closed or verified", "state"))
+			return
+		}
 
-		items, err := s.store.ListStreams(r.Context(), limit, offset)
+		items, err := s.store.ListStreamsByState(r.Context(), state, limit, offset)
 		if err != nil {
 			writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to list streams", ""))
 			return
@@ -248,7 +276,7 @@ func (s *Server) handleStreams(w http.ResponseWriter, r *http.Request) {
 
 // /live/streams/{id}[/*]
 func (s *Server) handleStreamSubroutes(w http.ResponseWriter, r *http.Request) {
-	// Expect path: /live/streams/{id} or /live/streams/{id}/bets|tail|export.csv
+	// Expect path: /live/streams/{id} or /live/streams/{id}/bets|tail|feed|rounds|analytics|coverage|backfill|seed|verify|history|state|export.{csv,ndjson,parquet}
 	path := strings.TrimPrefix(r.URL.Path, "/live/streams/")
 	parts := strings.Split(path, "/")
 	if len(parts) == 0 || parts[0] == "" {
@@ -295,6 +323,9 @@ func (s *Server) handleStreamSubroutes(w http.ResponseWriter, r *http.Request) {
 		}
 		s.handleStreamTail(w, r, streamID)
 		return
+	case "feed":
+		s.handleFeed(w, r, streamID)
+		return
 	case "rounds":
 		if r.Method != http.MethodGet {
 			methodNotAllowed(w, "GET")
@@ -309,6 +340,69 @@ func (s *Server) handleStreamSubroutes(w http.ResponseWriter, r *http.Request) {
 		}
 		s.handleStreamExport(w, r, streamID)
 		return
+	case "analytics":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, "GET")
+			return
+		}
+		s.handleStreamAnalytics(w, r, streamID)
+		return
+	case "coverage":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, "GET")
+			return
+		}
+		s.handleStreamCoverage(w, r, streamID)
+		return
+	case "verify":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, "GET")
+			return
+		}
+		s.handleStreamVerify(w, r, streamID)
+		return
+	case "backfill":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, "POST")
+			return
+		}
+		s.handleStreamBackfill(w, r, streamID)
+		return
+	case "history":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, "GET")
+			return
+		}
+		s.handleStreamHistory(w, r, streamID)
+		return
+	case "state":
+		if r.Method != http.MethodPut {
+			methodNotAllowed(w, "PUT")
+			return
+		}
+		s.handleStreamState(w, r, streamID)
+		return
+	case "run":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, "POST")
+			return
+		}
+		s.handleStreamRun(w, r, streamID)
+		return
+	case "seed":
+		if r.Method != http.MethodPut {
+			methodNotAllowed(w, "PUT")
+			return
+		}
+		s.handleStreamSeed(w, r, streamID)
+		return
+	case "export.ndjson", "export.parquet":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, "GET")
+			return
+		}
+		s.handleStreamTypedExport(w, r, streamID, strings.TrimPrefix(parts[1], "export."))
+		return
 	default:
 		http.NotFound(w, r)
 		return
@@ -335,6 +429,7 @@ func (s *Server) handleStreamDelete(w http.ResponseWriter, r *http.Request, stre
 		writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to delete stream", ""))
 		return
 	}
+	s.analytics.Invalidate(streamID)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -432,6 +527,114 @@ func (s *Server) handleStreamRounds(w http.ResponseWriter, r *http.Request, stre
 	}
 }
 
+// GET /live/streams/{id}/analytics?series=1
+// Tier cadences from the stream's heartbeat rounds; series adds every gap.
+func (s *Server) handleStreamAnalytics(w http.ResponseWriter, r *http.Request, streamID uuid.UUID) {
+	series := r.URL.Query().Get("series")
+	out, err := s.analytics.Stream(r.Context(), streamID, series == "1" || series == "true")
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, errObj("NOT_FOUND", "stream not found", "id"))
+		return
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to compute analytics", ""))
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// GET /live/streams/{id}/coverage?limit=100
+func (s *Server) handleStreamCoverage(w http.ResponseWriter, r *http.Request, streamID uuid.UUID) {
+	limit := qInt(r, "limit", 100)
+	cov, err := s.store.GetCoverage(r.Context(), streamID, limit)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, errObj("NOT_FOUND", "stream not found", "id"))
+		return
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to read coverage", ""))
+		return
+	}
+	writeJSON(w, http.StatusOK, cov)
+}
+
+// POST /live/streams/{id}/backfill
+func (s *Server) handleStreamBackfill(w http.ResponseWriter, r *http.Request, streamID uuid.UUID) {
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	res, err := s.backfill.Run(r.Context(), streamID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, errObj("NOT_FOUND", "stream not found", "id"))
+		return
+	case err != nil:
+		fmt.Printf("[livehttp] warning: backfill of %s failed: %v\n", streamID, err)
+		writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "backfill failed", ""))
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// GET /live/streams/{id}/verify
+func (s *Server) handleStreamVerify(w http.ResponseWriter, r *http.Request, streamID uuid.UUID) {
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	res, err := verifyStream(r.Context(), s.store, streamID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, errObj("NOT_FOUND", "stream not found", "id"))
+		return
+	case err != nil:
+		fmt.Printf("[livehttp] warning: verifying %s failed: %v\n", streamID, err)
+		writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "verification failed", ""))
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// PUT /live/streams/{id}/seed {"server_seed": "..."}
+func (s *Server) handleStreamSeed(w http.ResponseWriter, r *http.Request, streamID uuid.UUID) {
+	var body struct {
+		ServerSeed string `json:"server_seed"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ServerSeed == "" {
+		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "server_seed is required", "server_seed"))
+		return
+	}
+	err := setServerSeed(r.Context(), s.store, s.backfill, streamID, body.ServerSeed)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, errObj("NOT_FOUND", "stream not found", "id"))
+		return
+	case errors.Is(err, errSeedMismatch):
+		writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", err.Error(), "server_seed"))
+		return
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to store seed", ""))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "backfill": "started"})
+}
+
+// GET|PUT /live/analytics/config
+func (s *Server) handleAnalyticsConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.analytics.Config())
+	case http.MethodPut:
+		var cfg liveanalytics.Config
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", "invalid JSON", ""))
+			return
+		}
+		if err := s.analytics.SetConfig(cfg); err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, errObj("VALIDATION_ERROR", err.Error(), ""))
+			return
+		}
+		writeJSON(w, http.StatusOK, s.analytics.Config())
+	default:
+		methodNotAllowed(w, "GET, PUT")
+	}
+}
+
 // GET /live/streams/{id}/export.csv
 func (s *Server) handleStreamExport(w http.ResponseWriter, r *http.Request, streamID uuid.UUID) {
 	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
@@ -445,68 +648,101 @@ func (s *Server) handleStreamExport(w http.ResponseWriter, r *http.Request, stre
 		defer f.Flush()
 	}
 
-	// Write header via csv.Writer then rows from DB
+	// Write header via csv.Writer then rows from DB. Each page of rows gets
+	// its own write deadline, as the whole export may outlast the server's.
+	nextPage := pageDeadline(w)
+	nextPage()
 	cw := csv.NewWriter(w)
-	_ = cw.Write([]string{"id", "nonce", "date_time", "amount", "payout", "difficulty", "round_target", "round_result"})
+	_ = cw.Write(livestore.CSVHeader)
 	cw.Flush()
 
 	// Now write rows (append) ordered by nonce
-	err := s.streamCSVAppend(r.Context(), w, streamID)
+	err := s.streamCSVAppend(r.Context(), w, streamID, nextPage)
 	if err != nil {
 		// cannot change headers now; log-style write error message row
 		_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 	}
 }
 
-func (s *Server) streamCSVAppend(ctx context.Context, w http.ResponseWriter, streamID uuid.UUID) error {
-	// Reuse store.ExportCSV but skip header (we already wrote it)
-	// We'll query directly to avoid writing header twice.
-	rows, err := s.storeTailAllForCSV(ctx, streamID)
-	if err != nil {
-		return err
-	}
+// streamCSVAppend writes a stream's bets as CSV rows a page at a time,
+// calling beforePage ahead of each page and flushing after it.
+func (s *Server) streamCSVAppend(ctx context.Context, w http.ResponseWriter, streamID uuid.UUID, beforePage func()) error {
 	cw := csv.NewWriter(w)
-	for _, rec := range rows {
-		row := []string{
-			strconv.FormatInt(rec.ID, 10),
-			strconv.FormatInt(rec.Nonce, 10),
-			rec.DateTime.UTC().Format(time.RFC3339Nano),
-			strconv.FormatFloat(rec.Amount, 'f', 8, 64),
-			strconv.FormatFloat(rec.Payout, 'f', 8, 64),
-			rec.Difficulty,
-			strconv.FormatFloat(rec.RoundTarget, 'f', 2, 64),
-			strconv.FormatFloat(rec.RoundResult, 'f', 2, 64),
-		}
-		if err := cw.Write(row); err != nil {
-			return err
+	err := s.store.EachBetPage(ctx, streamID, func(page []livestore.LiveBet) error {
+		beforePage()
+		for _, rec := range page {
+			if err := cw.Write(livestore.CSVRecord(rec)); err != nil {
+				return err
+			}
 		}
-	}
+		cw.Flush()
+		return cw.Error()
+	})
 	cw.Flush()
+	if err != nil {
+		return err
+	}
 	return cw.Error()
 }
 
-func (s *Server) storeTailAllForCSV(ctx context.Context, streamID uuid.UUID) ([]livestore.LiveBet, error) {
-	// Fetch in chunks using TailBets
-	var out []livestore.LiveBet
-	var lastID int64 = 0
-	for {
-		chunk, err := s.store.TailBets(ctx, streamID, lastID, 2000)
-		if err != nil {
-			return nil, err
-		}
-		if len(chunk) == 0 {
-			break
+// GET /live/streams/{id}/export.ndjson|export.parquet?table=bets|rounds
+// Streams typed rows straight from the database as a chunked response.
+func (s *Server) handleStreamTypedExport(w http.ResponseWriter, r *http.Request, streamID uuid.UUID, ext string) {
+	format, err := bindings.ParseExportFormat(ext)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errObj("VALIDATION_ERROR", err.Error(), "format"))
+		return
+	}
+	table := r.URL.Query().Get("table")
+	if table != "" && table != "bets" && table != "rounds" {
+		writeJSON(w, http.StatusBadRequest, errObj("VALIDATION_ERROR", "table must be bets or rounds", "table"))
+		return
+	}
+	if _, err := s.store.GetStream(r.Context(), streamID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSON(w, http.StatusNotFound, errObj("NOT_FOUND", "stream not found", "id"))
+		} else {
+			writeJSON(w, http.StatusInternalServerError, errObj("SERVER_ERROR", "failed to fetch stream", ""))
 		}
-		out = append(out, chunk...)
-		lastID = chunk[len(chunk)-1].ID
+		return
 	}
-	return out, nil
+
+	// Exports run longer than the server's write timeout allows, so each
+	// page gets its own deadline instead
+	nextPage := pageDeadline(w)
+	nextPage()
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s.%s"`, exportName(streamID, table), format.Ext()))
+	w.WriteHeader(http.StatusOK)
+	if _, err := writeStreamExport(r.Context(), s.store, flushWriter{w}, streamID, table, format, nextPage, nil); err != nil {
+		// Headers are out; the client sees a truncated file
+		fmt.Printf("[livehttp] export of stream %s failed: %v\n", streamID, err)
+	}
+}
+
+// flushWriter pushes each write to the client so exports stream
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if fl, ok := f.w.(http.Flusher); ok && err == nil {
+		fl.Flush()
+	}
+	return n, err
 }
 
 // ========== Types & helpers ==========
 
 // ingestPayload is the unified payload for both bet and heartbeat messages.
 type ingestPayload struct {
+	// V is the version of the ingest contract. Version 1 (or unset) only
+	// carries pump bets, with their difficulty; version 2 names the game
+	// and sends its parameters as details.
+	V int `json:"v"`
+
 	// Type distinguishes between "bet" and "heartbeat" messages.
 	// If empty, defaults to "bet" for backwards compatibility.
 	Type string `json:"type"`
@@ -524,6 +760,12 @@ type ingestPayload struct {
 	Payout      float64 `json:"payout"`
 	Difficulty  string  `json:"difficulty"` // easy|medium|hard|expert
 	RoundTarget float64 `json:"roundTarget"`
+
+	// Version 2 bet fields
+	Game    string          `json:"game"`    // a games registry ID, e.g. "keno"
+	Details json.RawMessage `json:"details"` // the game's parameters, e.g. {"risk": "high", "picks": [...]}
+
+	params map[string]any // the bet's game parameters, set by validate
 }
 
 func parseISOTimeOrNow(s string) time.Time {
@@ -0,0 +1,95 @@
+package livehttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+	"github.com/MJE43/stake-pf-replay-go/bindings"
+)
+
+// maxVerifyMismatches caps the mismatches a verification lists
+const maxVerifyMismatches = 100
+
+// VerifyResult reports a stream verification. Skipped is "no_seed" until
+// the plain server seed is known.
+type VerifyResult struct {
+	StreamID   string        `json:"stream_id"`
+	Checked    int64         `json:"checked"`
+	Matched    int64         `json:"matched"`
+	Mismatches []BetMismatch `json:"mismatches"`
+	Truncated  bool          `json:"truncated"` // more mismatches than listed
+	Skipped    string        `json:"skipped,omitempty"`
+}
+
+// BetMismatch is a bet whose recorded result the engine didn't reproduce.
+// Error is set when the bet couldn't be replayed at all, e.g. for a game
+// that is no longer registered.
+type BetMismatch struct {
+	ID           int64   `json:"id"`
+	AntebotBetID string  `json:"antebot_bet_id"`
+	Nonce        int64   `json:"nonce"`
+	Game         string  `json:"game"`
+	Recorded     float64 `json:"recorded"`
+	Computed     float64 `json:"computed"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// verifyStream replays every bet of a stream with its game and details
+// and compares the result with the one recorded.
+func verifyStream(ctx context.Context, st *livestore.Store, streamID uuid.UUID) (VerifyResult, error) {
+	res := VerifyResult{StreamID: streamID.String(), Mismatches: []BetMismatch{}}
+	ls, err := st.GetStream(ctx, streamID)
+	if err != nil {
+		return res, err
+	}
+	plain, known, err := st.LookupSeedAlias(ctx, ls.ServerSeedHashed)
+	if err != nil {
+		return res, err
+	}
+	if !known {
+		res.Skipped = "no_seed"
+		return res, nil
+	}
+	if !seedMatchesHash(plain, ls.ServerSeedHashed) {
+		return res, fmt.Errorf("stored server seed does not hash to %s", ls.ServerSeedHashed)
+	}
+
+	err = st.EachBet(ctx, streamID, func(b livestore.LiveBet) error {
+		res.Checked++
+		m := BetMismatch{ID: b.ID, AntebotBetID: b.AntebotBetID, Nonce: b.Nonce, Game: b.Game, Recorded: b.RoundResult}
+		params, err := betParams(b)
+		if err == nil {
+			m.Computed, err = bindings.EvaluateMetric(b.Game, plain, ls.ClientSeed, uint64(b.Nonce), params)
+		}
+		switch {
+		case err != nil:
+			m.Error = err.Error()
+		case bindings.MetricsMatch(m.Recorded, m.Computed):
+			res.Matched++
+			return nil
+		}
+		if len(res.Mismatches) < maxVerifyMismatches {
+			res.Mismatches = append(res.Mismatches, m)
+		} else {
+			res.Truncated = true
+		}
+		return ctx.Err()
+	})
+	return res, err
+}
+
+// betParams are the game parameters stored with a bet
+func betParams(b livestore.LiveBet) (map[string]any, error) {
+	params := map[string]any{}
+	if b.Details == "" {
+		return params, nil
+	}
+	if err := json.Unmarshal([]byte(b.Details), &params); err != nil {
+		return nil, fmt.Errorf("bet %d: invalid details: %w", b.ID, err)
+	}
+	return params, nil
+}
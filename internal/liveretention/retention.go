@@ -0,0 +1,286 @@
+// Package liveretention bounds the growth of the live store. On a
+// schedule, or when asked, it applies each stream's retention policy, or
+// the global one, compacting the rounds the policy doesn't keep into
+// per-block aggregates, and then vacuums the database to give the space
+// back.
+//
+// Compaction spares the rolling analytics window, and blocks count the
+// hits of the analytics tiers, so tier totals and streaks read the same
+// afterwards; only the gaps between more than two hits inside a block are
+// lost. A stream whose own policy is disabled is left alone whatever the
+// global policy.
+package liveretention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/liveanalytics"
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+)
+
+const (
+	// firstRunDelay leaves startup alone before the first scheduled run
+	firstRunDelay = 5 * time.Minute
+	// runInterval is how often retention runs on its own
+	runInterval = 6 * time.Hour
+	// progressEvery spaces out progress events within a stream
+	progressEvery = 250 * time.Millisecond
+
+	minBlockSize = 100
+	maxBlockSize = 1_000_000
+)
+
+// Phases of a run, as reported in Progress
+const (
+	PhaseCompact = "compact"
+	PhaseVacuum  = "vacuum"
+	PhaseDone    = "done"
+	PhaseFailed  = "failed"
+)
+
+// ErrRunning is returned when a run is asked for while one is going
+var ErrRunning = errors.New("retention is already running")
+
+// Progress is where a run is, sent as "live:retention:progress" events.
+// Done and Total count the nonces of the stream being compacted.
+type Progress struct {
+	Phase     string `json:"phase"`
+	StreamID  string `json:"stream_id,omitempty"`
+	Stream    int    `json:"stream"` // 1-based position of StreamID among Streams
+	Streams   int    `json:"streams"`
+	Done      int64  `json:"done"`
+	Total     int64  `json:"total"`
+	Compacted int64  `json:"compacted"` // rounds compacted so far in the run
+	Error     string `json:"error,omitempty"`
+}
+
+// Report sums up a finished run
+type Report struct {
+	StartedAt  time.Time                 `json:"started_at"`
+	FinishedAt time.Time                 `json:"finished_at"`
+	Streams    []livestore.CompactResult `json:"streams"` // streams that had rounds compacted
+	Compacted  int64                     `json:"compacted"`
+	Vacuumed   bool                      `json:"vacuumed"`
+	Error      string                    `json:"error,omitempty"`
+}
+
+// Status is whether a run is going, how far it is, and the last report
+type Status struct {
+	Running  bool      `json:"running"`
+	Progress *Progress `json:"progress,omitempty"`
+	Last     *Report   `json:"last,omitempty"`
+}
+
+// Validate checks a policy and normalises its stream id and block size.
+func Validate(p *livestore.RetentionPolicy) error {
+	if p.StreamID != "" {
+		id, err := uuid.Parse(p.StreamID)
+		if err != nil {
+			return fmt.Errorf("invalid stream id: %w", err)
+		}
+		p.StreamID = id.String()
+	}
+	switch {
+	case p.KeepLast < 0:
+		return fmt.Errorf("keep_last must not be negative")
+	case p.KeepAbove < 0:
+		return fmt.Errorf("keep_above must not be negative")
+	case p.BlockSize == 0:
+		p.BlockSize = livestore.DefaultBlockSize
+	case p.BlockSize < minBlockSize || p.BlockSize > maxBlockSize:
+		return fmt.Errorf("block_size must be between %d and %d", minBlockSize, maxBlockSize)
+	}
+	return nil
+}
+
+// Service runs retention over the streams of a store, one run at a time.
+type Service struct {
+	store     *livestore.Store
+	analytics *liveanalytics.Service
+	// after and emitEvent are time.After and the Wails event emitter,
+	// swapped out by tests
+	after     func(time.Duration) <-chan time.Time
+	emitEvent func(ctx context.Context, name string, data ...interface{})
+
+	mu       sync.Mutex
+	wailsCtx context.Context
+	running  bool
+	progress Progress
+	emitted  time.Time // when progress was last emitted
+	last     *Report
+}
+
+// New applies the policies of store, sparing what analytics tracks. A nil
+// analytics spares the default tiers and window.
+func New(store *livestore.Store, analytics *liveanalytics.Service) *Service {
+	return &Service{store: store, analytics: analytics, after: time.After, emitEvent: runtime.EventsEmit}
+}
+
+// Start runs retention every runInterval until ctx is done. ctx is also
+// the Wails context progress is emitted on.
+func (s *Service) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.wailsCtx = ctx
+	s.mu.Unlock()
+
+	go func() {
+		for wait := firstRunDelay; ; wait = runInterval {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.after(wait):
+			}
+			if _, err := s.Run(ctx); err != nil && !errors.Is(err, ErrRunning) && ctx.Err() == nil {
+				fmt.Printf("[liveretention] warning: scheduled run failed: %v\n", err)
+			}
+		}
+	}()
+}
+
+// Policies returns every policy, the global one first.
+func (s *Service) Policies(ctx context.Context) ([]livestore.RetentionPolicy, error) {
+	return s.store.ListRetentionPolicies(ctx)
+}
+
+// SavePolicy validates and stores a policy, replacing the stream's (or
+// the global) one. It applies from the next run.
+func (s *Service) SavePolicy(ctx context.Context, p livestore.RetentionPolicy) (livestore.RetentionPolicy, error) {
+	if err := Validate(&p); err != nil {
+		return livestore.RetentionPolicy{}, err
+	}
+	return s.store.PutRetentionPolicy(ctx, p)
+}
+
+// DeletePolicy removes a stream's policy, or the global one when streamID
+// is empty. A missing policy is sql.ErrNoRows.
+func (s *Service) DeletePolicy(ctx context.Context, streamID string) error {
+	if streamID != "" {
+		id, err := uuid.Parse(streamID)
+		if err != nil {
+			return fmt.Errorf("invalid stream id: %w", err)
+		}
+		streamID = id.String()
+	}
+	return s.store.DeleteRetentionPolicy(ctx, streamID)
+}
+
+// Status returns the current run's progress, if any, and the last report.
+func (s *Service) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := Status{Running: s.running, Last: s.last}
+	if s.running {
+		p := s.progress
+		st.Progress = &p
+	}
+	return st
+}
+
+// Run applies the policies to every stream, then vacuums the database if
+// any rounds were compacted. It returns ErrRunning if a run is going.
+func (s *Service) Run(ctx context.Context) (Report, error) {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return Report{}, ErrRunning
+	}
+	s.running = true
+	s.progress = Progress{Phase: PhaseCompact}
+	s.mu.Unlock()
+
+	rep := Report{StartedAt: time.Now().UTC(), Streams: []livestore.CompactResult{}}
+	err := s.run(ctx, &rep)
+	rep.FinishedAt = time.Now().UTC()
+
+	final := Progress{Phase: PhaseDone, Compacted: rep.Compacted}
+	if err != nil {
+		rep.Error = err.Error()
+		final = Progress{Phase: PhaseFailed, Compacted: rep.Compacted, Error: rep.Error}
+	}
+	s.mu.Lock()
+	s.running = false
+	s.last = &rep
+	s.mu.Unlock()
+	s.emit(final)
+	if rep.Compacted > 0 {
+		fmt.Printf("[liveretention] compacted %d rounds from %d streams\n", rep.Compacted, len(rep.Streams))
+	}
+	return rep, err
+}
+
+func (s *Service) run(ctx context.Context, rep *Report) error {
+	ids, err := s.store.StreamIDs(ctx)
+	if err != nil {
+		return err
+	}
+	cfg := s.analytics.Config()
+
+	for i, id := range ids {
+		p, ok, err := s.store.RetentionPolicyFor(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !ok || !p.Enabled {
+			continue
+		}
+		prog := Progress{Phase: PhaseCompact, StreamID: id.String(), Stream: i + 1, Streams: len(ids), Compacted: rep.Compacted}
+		s.report(prog, true)
+		res, err := s.store.CompactRounds(ctx, id, p, livestore.CompactOptions{
+			Tiers:   cfg.Tiers,
+			Protect: cfg.Window,
+			Progress: func(done, total int64) {
+				prog.Done, prog.Total = done, total
+				s.report(prog, done == total)
+			},
+		})
+		if res.Compacted > 0 {
+			s.analytics.Invalidate(id)
+			rep.Streams = append(rep.Streams, res)
+			rep.Compacted += res.Compacted
+		}
+		if err != nil {
+			return fmt.Errorf("stream %s: %w", id, err)
+		}
+	}
+
+	if rep.Compacted == 0 {
+		return nil
+	}
+	s.report(Progress{Phase: PhaseVacuum, Streams: len(ids), Compacted: rep.Compacted}, true)
+	if err := s.store.Vacuum(ctx); err != nil {
+		return fmt.Errorf("vacuum: %w", err)
+	}
+	rep.Vacuumed = true
+	return nil
+}
+
+// report records a run's progress and emits it, at most every
+// progressEvery unless force is set
+func (s *Service) report(p Progress, force bool) {
+	s.mu.Lock()
+	s.progress = p
+	due := force || time.Since(s.emitted) >= progressEvery
+	if due {
+		s.emitted = time.Now()
+	}
+	s.mu.Unlock()
+	if due {
+		s.emit(p)
+	}
+}
+
+func (s *Service) emit(p Progress) {
+	s.mu.Lock()
+	ctx := s.wailsCtx
+	s.mu.Unlock()
+	if ctx != nil {
+		s.emitEvent(ctx, "live:retention:progress", p)
+	}
+}
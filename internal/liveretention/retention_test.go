@@ -0,0 +1,247 @@
+package liveretention
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/liveanalytics"
+	"github.com/MJE43/stake-pf-replay-go-desktop/internal/livestore"
+)
+
+// events records the progress a service emits
+type events struct {
+	mu   sync.Mutex
+	list []Progress
+}
+
+func (e *events) emit(_ context.Context, name string, data ...interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if name == "live:retention:progress" && len(data) == 1 {
+		e.list = append(e.list, data[0].(Progress))
+	}
+}
+
+func (e *events) phases() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var out []string
+	for _, p := range e.list {
+		out = append(out, p.Phase)
+	}
+	return out
+}
+
+// newTestService returns a service over a fresh store whose analytics
+// track one tier of 5 and spare the last 10 rounds, and the progress it
+// emits
+func newTestService(t *testing.T) (*Service, *livestore.Store, *events) {
+	t.Helper()
+	st, err := livestore.New(filepath.Join(t.TempDir(), "live.db"))
+	if err != nil {
+		t.Fatalf("livestore.New: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	an := liveanalytics.New(st)
+	if err := an.SetConfig(liveanalytics.Config{Tiers: []float64{5}, Window: 10}); err != nil {
+		t.Fatalf("SetConfig: %v", err)
+	}
+	ev := &events{}
+	s := New(st, an)
+	s.wailsCtx = context.Background()
+	s.emitEvent = ev.emit
+	return s, st, ev
+}
+
+// testStream stores a stream of n observed rounds, every 20th a hit of 10
+func testStream(t *testing.T, st *livestore.Store, hash string, n int64) uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+	id, err := st.FindOrCreateStream(ctx, hash, "client")
+	if err != nil {
+		t.Fatalf("FindOrCreateStream: %v", err)
+	}
+	base := time.Now().Add(-time.Duration(n) * time.Minute)
+	rounds := make([]livestore.LiveRound, 0, n)
+	for nonce := int64(1); nonce <= n; nonce++ {
+		r := livestore.LiveRound{Nonce: nonce, RoundResult: 1, ReceivedAt: base.Add(time.Duration(nonce) * time.Minute)}
+		if nonce%20 == 0 {
+			r.RoundResult = 10
+		}
+		rounds = append(rounds, r)
+	}
+	if _, err := st.ImportRounds(ctx, id, rounds); err != nil {
+		t.Fatalf("ImportRounds: %v", err)
+	}
+	return id
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy livestore.RetentionPolicy
+		ok     bool
+		block  int64
+	}{
+		{"defaults the block size", livestore.RetentionPolicy{KeepLast: 10}, true, livestore.DefaultBlockSize},
+		{"keeps a block size in range", livestore.RetentionPolicy{BlockSize: 500}, true, 500},
+		{"block size too small", livestore.RetentionPolicy{BlockSize: minBlockSize - 1}, false, 0},
+		{"block size too large", livestore.RetentionPolicy{BlockSize: maxBlockSize + 1}, false, 0},
+		{"negative keep_last", livestore.RetentionPolicy{KeepLast: -1}, false, 0},
+		{"negative keep_above", livestore.RetentionPolicy{KeepAbove: -1}, false, 0},
+		{"bad stream id", livestore.RetentionPolicy{StreamID: "nope"}, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.policy
+			err := Validate(&p)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Validate(%+v) = %v, want ok %v", tt.policy, err, tt.ok)
+			}
+			if tt.ok && p.BlockSize != tt.block {
+				t.Errorf("expected block size %d, got %d", tt.block, p.BlockSize)
+			}
+		})
+	}
+
+	id := uuid.New()
+	p := livestore.RetentionPolicy{StreamID: "{" + id.String() + "}"}
+	if err := Validate(&p); err != nil || p.StreamID != id.String() {
+		t.Errorf("expected the stream id normalised to %s, got %q (%v)", id, p.StreamID, err)
+	}
+}
+
+func TestRunCompactsAndReports(t *testing.T) {
+	s, st, ev := newTestService(t)
+	ctx := context.Background()
+	kept := testStream(t, st, "hash-1", 300)
+	spared := testStream(t, st, "hash-2", 300)
+	if _, err := s.SavePolicy(ctx, livestore.RetentionPolicy{KeepLast: 50, BlockSize: 100, Enabled: true}); err != nil {
+		t.Fatalf("SavePolicy: %v", err)
+	}
+	if _, err := s.SavePolicy(ctx, livestore.RetentionPolicy{StreamID: spared.String(), Enabled: false}); err != nil {
+		t.Fatalf("SavePolicy: %v", err)
+	}
+
+	rep, err := s.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if rep.Compacted != 250 || len(rep.Streams) != 1 || rep.Streams[0].StreamID != kept || !rep.Vacuumed {
+		t.Fatalf("expected 250 rounds of one stream compacted and a vacuum, got %+v", rep)
+	}
+	if rep.Error != "" || rep.FinishedAt.Before(rep.StartedAt) {
+		t.Errorf("unexpected report times or error: %+v", rep)
+	}
+
+	// Compact events for the stream, the vacuum, then done
+	phases := ev.phases()
+	if len(phases) < 3 || phases[0] != PhaseCompact || phases[len(phases)-2] != PhaseVacuum || phases[len(phases)-1] != PhaseDone {
+		t.Fatalf("expected compact, vacuum and done events, got %v", phases)
+	}
+	first := ev.list[0]
+	if first.StreamID != kept.String() || first.Streams != 2 || first.Stream < 1 {
+		t.Errorf("unexpected first progress %+v", first)
+	}
+	if last := ev.list[len(ev.list)-1]; last.Compacted != 250 {
+		t.Errorf("expected done to carry the compacted total, got %+v", last)
+	}
+
+	st2 := s.Status()
+	if st2.Running || st2.Progress != nil || st2.Last == nil || st2.Last.Compacted != 250 {
+		t.Errorf("expected an idle status with the last report, got %+v", st2)
+	}
+
+	blocks, err := st.RoundBlocks(ctx, spared)
+	if err != nil || len(blocks) != 0 {
+		t.Errorf("expected a stream with a disabled policy left alone, got %d blocks (%v)", len(blocks), err)
+	}
+
+	// Nothing left to compact: no vacuum, still done
+	rep, err = s.Run(ctx)
+	if err != nil || rep.Compacted != 0 || rep.Vacuumed || len(rep.Streams) != 0 {
+		t.Fatalf("expected a second run to do nothing, got %+v (%v)", rep, err)
+	}
+	if phases := ev.phases(); phases[len(phases)-1] != PhaseDone {
+		t.Errorf("expected the second run to end with done, got %v", phases)
+	}
+}
+
+func TestRunFailsAndRefusesOverlap(t *testing.T) {
+	s, st, ev := newTestService(t)
+	testStream(t, st, "hash", 50)
+
+	s.mu.Lock()
+	s.running = true
+	s.mu.Unlock()
+	if _, err := s.Run(context.Background()); !errors.Is(err, ErrRunning) {
+		t.Fatalf("expected ErrRunning while a run is going, got %v", err)
+	}
+	if len(ev.phases()) != 0 {
+		t.Error("expected a refused run to emit nothing")
+	}
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rep, err := s.Run(ctx)
+	if err == nil || rep.Error == "" {
+		t.Fatalf("expected a cancelled run to fail, got %+v", rep)
+	}
+	last := ev.list[len(ev.list)-1]
+	if last.Phase != PhaseFailed || last.Error != rep.Error {
+		t.Errorf("expected a failed event with the error, got %+v", last)
+	}
+	if st := s.Status(); st.Running || st.Last == nil || st.Last.Error == "" {
+		t.Errorf("expected the failed run reported, got %+v", st)
+	}
+}
+
+func TestStartSchedule(t *testing.T) {
+	s, _, ev := newTestService(t)
+	waits := make(chan time.Duration)
+	fire := make(chan time.Time)
+	s.after = func(d time.Duration) <-chan time.Time {
+		waits <- d
+		return fire
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	next := func() time.Duration {
+		select {
+		case d := <-waits:
+			return d
+		case <-time.After(5 * time.Second):
+			t.Fatal("scheduler did not wait")
+			return 0
+		}
+	}
+	if d := next(); d != firstRunDelay {
+		t.Fatalf("expected the first run after %s, got %s", firstRunDelay, d)
+	}
+	fire <- time.Now()
+	if d := next(); d != runInterval {
+		t.Fatalf("expected later runs every %s, got %s", runInterval, d)
+	}
+	if st := s.Status(); st.Last == nil {
+		t.Fatal("expected the scheduled run to have reported")
+	}
+	if phases := ev.phases(); len(phases) == 0 || phases[len(phases)-1] != PhaseDone {
+		t.Errorf("expected the scheduled run to end with done, got %v", phases)
+	}
+	fire <- time.Now()
+	if d := next(); d != runInterval {
+		t.Fatalf("expected the interval to repeat, got %s", d)
+	}
+}
@@ -1,12 +1,17 @@
 package livestore
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"math"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,6 +32,23 @@ type LiveStream struct {
 	HighestResult     float64   `json:"highest_result"`
 	LastObservedNonce int64     `json:"last_observed_nonce"`
 	LastObservedAt    time.Time `json:"last_observed_at"`
+	// MissingRounds counts the nonces between the first stored round and
+	// the last observed nonce that have no round; Incomplete is set when
+	// there are any.
+	MissingRounds int64 `json:"missing_rounds"`
+	Incomplete    bool  `json:"incomplete"`
+	// Games lists the games the stream's bets were on, first seen first.
+	Games []string `json:"games"`
+	// State is StreamActive until the stream is closed, by a new seed pair
+	// from its ingest client or by hand, and StreamVerified once its server
+	// seed is revealed. EndNonce and Summary are frozen when it closes.
+	State         string         `json:"state"`
+	ClosedAt      *time.Time     `json:"closed_at,omitempty"`
+	EndNonce      int64          `json:"end_nonce,omitempty"`
+	Summary       *StreamSummary `json:"summary,omitempty"`
+	IngestClient  string         `json:"ingest_client"`
+	PredecessorID *uuid.UUID     `json:"predecessor_id,omitempty"` // the client's stream before this one
+	SuccessorID   *uuid.UUID     `json:"successor_id,omitempty"`
 }
 
 // LiveRound represents a single round observation from heartbeat data.
@@ -36,8 +58,16 @@ type LiveRound struct {
 	Nonce       int64     `json:"nonce"`
 	RoundResult float64   `json:"round_result"`
 	ReceivedAt  time.Time `json:"received_at"`
+	Source      string    `json:"source"` // RoundObserved or RoundComputed
 }
 
+// Round sources: observed rounds came in through ingest, computed ones
+// were replayed from the plain server seed to fill a gap.
+const (
+	RoundObserved = "observed"
+	RoundComputed = "computed"
+)
+
 type LiveBet struct {
 	ID           int64     `json:"id"`
 	StreamID     uuid.UUID `json:"stream_id"`
@@ -50,20 +80,41 @@ type LiveBet struct {
 	Difficulty   string    `json:"difficulty"`
 	RoundTarget  float64   `json:"round_target"`
 	RoundResult  float64   `json:"round_result"`
+	Game         string    `json:"game"`    // a games.GameRegistry ID
+	Details      string    `json:"details"` // JSON object of the game's parameters
 }
 
+// DefaultGame is the game of bets ingested without one; the first ingest
+// contract only carried pump bets.
+const DefaultGame = "pump"
+
 // IngestResult indicates whether a bet was stored or ignored as duplicate.
 type IngestResult struct {
 	Accepted bool   `json:"accepted"`
 	Reason   string `json:"reason,omitempty"`
+	ID       int64  `json:"id,omitempty"` // the stored bet's id when accepted
 }
 
 // --------- Store ---------
 
 type Store struct {
-	db *sql.DB
+	db     *sql.DB
+	sealer Sealer // encrypts plain seeds and ingest secrets; nil stores them as given
+}
+
+// Sealer encrypts values at rest. Open must return values that were never
+// sealed unchanged, and Current reports whether a value is already sealed
+// under the newest key.
+type Sealer interface {
+	Seal(plain string) (string, error)
+	Open(value string) (string, error)
+	Current(value string) bool
 }
 
+// SetSealer makes the store encrypt plain server seeds and ingest secrets
+// with sealer.
+func (s *Store) SetSealer(sealer Sealer) { s.sealer = sealer }
+
 // New opens/creates a SQLite database at dbPath and runs migrations.
 func New(dbPath string) (*Store, error) {
 	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&cache=shared", dbPath)
@@ -113,6 +164,8 @@ func (s *Store) migrate(ctx context.Context) error {
 			difficulty TEXT NOT NULL,
 			round_target REAL NOT NULL,
 			round_result REAL NOT NULL,
+			game TEXT NOT NULL DEFAULT 'pump',
+			details TEXT NOT NULL DEFAULT '{}',
 			UNIQUE(stream_id, antebot_bet_id),
 			FOREIGN KEY(stream_id) REFERENCES live_streams(id) ON DELETE CASCADE
 		);`,
@@ -127,12 +180,32 @@ func (s *Store) migrate(ctx context.Context) error {
 			nonce INTEGER NOT NULL,
 			round_result REAL NOT NULL,
 			received_at TIMESTAMP NOT NULL,
+			source TEXT NOT NULL DEFAULT 'observed',
 			UNIQUE(stream_id, nonce),
 			FOREIGN KEY(stream_id) REFERENCES live_streams(id) ON DELETE CASCADE
 		);`,
 		`CREATE INDEX IF NOT EXISTS idx_live_rounds_stream_nonce ON live_rounds(stream_id, nonce DESC);`,
 		`CREATE INDEX IF NOT EXISTS idx_live_rounds_stream_result ON live_rounds(stream_id, round_result DESC);`,
 
+		// Contiguous nonce ranges covered by live_rounds, kept in step with it
+		`CREATE TABLE IF NOT EXISTS live_round_spans (
+			stream_id TEXT NOT NULL,
+			start_nonce INTEGER NOT NULL,
+			end_nonce INTEGER NOT NULL,
+			PRIMARY KEY(stream_id, start_nonce),
+			FOREIGN KEY(stream_id) REFERENCES live_streams(id) ON DELETE CASCADE
+		);`,
+
+		// Games each stream's bets were on
+		`CREATE TABLE IF NOT EXISTS live_stream_games (
+			stream_id TEXT NOT NULL,
+			game TEXT NOT NULL,
+			first_seen TIMESTAMP NOT NULL,
+			last_seen TIMESTAMP NOT NULL,
+			PRIMARY KEY(stream_id, game),
+			FOREIGN KEY(stream_id) REFERENCES live_streams(id) ON DELETE CASCADE
+		);`,
+
 		// Optional mapping of hashed → plain
 		`CREATE TABLE IF NOT EXISTS seed_aliases (
 			server_seed_hashed TEXT PRIMARY KEY,
@@ -141,6 +214,82 @@ func (s *Store) migrate(ctx context.Context) error {
 			last_seen  TIMESTAMP NOT NULL
 		);`,
 
+		// Alert rules and when they fired
+		`CREATE TABLE IF NOT EXISTS live_alert_rules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			stream_id TEXT NOT NULL DEFAULT '',
+			kind TEXT NOT NULL,
+			value REAL NOT NULL,
+			target REAL NOT NULL DEFAULT 0,
+			actions TEXT NOT NULL DEFAULT 'event',
+			webhook_url TEXT NOT NULL DEFAULT '',
+			cooldown_seconds INTEGER NOT NULL DEFAULT 0,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS live_alert_firings (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			rule_id INTEGER NOT NULL,
+			stream_id TEXT NOT NULL,
+			nonce INTEGER NOT NULL DEFAULT 0,
+			value REAL NOT NULL DEFAULT 0,
+			message TEXT NOT NULL,
+			fired_at TIMESTAMP NOT NULL,
+			FOREIGN KEY(rule_id) REFERENCES live_alert_rules(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_live_alert_firings_rule ON live_alert_firings(rule_id, fired_at DESC);`,
+		`CREATE INDEX IF NOT EXISTS idx_live_alert_firings_stream ON live_alert_firings(stream_id, fired_at DESC);`,
+
+		// Ingest authentication: settings, signing keys and refused requests
+		`CREATE TABLE IF NOT EXISTS live_settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS live_ingest_keys (
+			key_id TEXT PRIMARY KEY,
+			label TEXT NOT NULL DEFAULT '',
+			secret TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			last_used_at TIMESTAMP NULL,
+			revoked_at TIMESTAMP NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS live_ingest_audit (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			at TIMESTAMP NOT NULL,
+			remote_addr TEXT NOT NULL,
+			key_id TEXT NOT NULL DEFAULT '',
+			reason TEXT NOT NULL,
+			path TEXT NOT NULL,
+			detail TEXT NOT NULL DEFAULT ''
+		);`,
+
+		// Retention: policies ('' is the global one) and the aggregates of
+		// compacted rounds
+		`CREATE TABLE IF NOT EXISTS live_retention_policies (
+			stream_id TEXT PRIMARY KEY,
+			keep_last INTEGER NOT NULL DEFAULT 0,
+			keep_since TIMESTAMP NULL,
+			keep_above REAL NOT NULL DEFAULT 0,
+			block_size INTEGER NOT NULL,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			updated_at TIMESTAMP NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS live_round_blocks (
+			stream_id TEXT NOT NULL,
+			start_nonce INTEGER NOT NULL,
+			end_nonce INTEGER NOT NULL,
+			rounds INTEGER NOT NULL,
+			max_result REAL NOT NULL,
+			kept_above REAL NOT NULL DEFAULT 0,
+			hits_above REAL NOT NULL DEFAULT 0,
+			hits TEXT NOT NULL DEFAULT '[]',
+			compacted_at TIMESTAMP NOT NULL,
+			PRIMARY KEY(stream_id, start_nonce),
+			FOREIGN KEY(stream_id) REFERENCES live_streams(id) ON DELETE CASCADE
+		);`,
+
 		// Migration: add columns to existing live_streams if they don't exist
 		// SQLite doesn't support IF NOT EXISTS for columns, so we use a workaround
 		`CREATE TABLE IF NOT EXISTS _migration_marker (version INTEGER PRIMARY KEY);`,
@@ -184,45 +333,197 @@ func (s *Store) migrateColumns(ctx context.Context) error {
 			return err
 		}
 	}
-	return nil
+
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM pragma_table_info('live_rounds') WHERE name='source'`).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		if _, err := s.db.ExecContext(ctx,
+			`ALTER TABLE live_rounds ADD COLUMN source TEXT NOT NULL DEFAULT 'observed'`); err != nil {
+			return err
+		}
+	}
+
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM pragma_table_info('live_bets') WHERE name='game'`).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		// Bets before games were recorded are all pump bets; their details
+		// are the difficulty
+		for _, q := range []string{
+			`ALTER TABLE live_bets ADD COLUMN game TEXT NOT NULL DEFAULT 'pump'`,
+			`ALTER TABLE live_bets ADD COLUMN details TEXT NOT NULL DEFAULT '{}'`,
+			`UPDATE live_bets SET details = json_object('difficulty', difficulty)`,
+			`INSERT OR IGNORE INTO live_stream_games(stream_id, game, first_seen, last_seen)
+			 SELECT stream_id, game, MIN(received_at), MAX(received_at) FROM live_bets GROUP BY stream_id, game`,
+		} {
+			if _, err := s.db.ExecContext(ctx, q); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM pragma_table_info('live_streams') WHERE name='state'`).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		// Streams whose server seed is already known have been rotated away
+		for _, q := range []string{
+			`ALTER TABLE live_streams ADD COLUMN state TEXT NOT NULL DEFAULT 'active'`,
+			`ALTER TABLE live_streams ADD COLUMN closed_at TIMESTAMP NULL`,
+			`ALTER TABLE live_streams ADD COLUMN end_nonce INTEGER NULL`,
+			`ALTER TABLE live_streams ADD COLUMN summary TEXT NULL`,
+			`ALTER TABLE live_streams ADD COLUMN ingest_client TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE live_streams ADD COLUMN predecessor_id TEXT NULL`,
+			`UPDATE live_streams SET state='verified'
+			 WHERE server_seed_hashed IN (SELECT server_seed_hashed FROM seed_aliases)`,
+		} {
+			if _, err := s.db.ExecContext(ctx, q); err != nil {
+				return err
+			}
+		}
+	}
+	for _, q := range []string{
+		`CREATE INDEX IF NOT EXISTS idx_live_streams_client_state ON live_streams(ingest_client, state)`,
+		`CREATE INDEX IF NOT EXISTS idx_live_streams_predecessor ON live_streams(predecessor_id)`,
+	} {
+		if _, err := s.db.ExecContext(ctx, q); err != nil {
+			return err
+		}
+	}
+
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM pragma_table_info('live_round_blocks') WHERE name='hits'`).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		// Blocks compacted before hits were listed vouch for no tier
+		for _, q := range []string{
+			`ALTER TABLE live_round_blocks ADD COLUMN hits_above REAL NOT NULL DEFAULT 0`,
+			`ALTER TABLE live_round_blocks ADD COLUMN hits TEXT NOT NULL DEFAULT '[]'`,
+		} {
+			if _, err := s.db.ExecContext(ctx, q); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Rounds stored before spans were tracked
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO live_round_spans(stream_id, start_nonce, end_nonce)
+		SELECT stream_id, MIN(nonce), MAX(nonce) FROM (
+			SELECT stream_id, nonce,
+			       nonce - ROW_NUMBER() OVER (PARTITION BY stream_id ORDER BY nonce) AS island
+			FROM live_rounds
+			WHERE stream_id NOT IN (SELECT stream_id FROM live_round_spans)
+		) GROUP BY stream_id, island`)
+	return err
 }
 
 // --------- Streams ---------
 
 // FindOrCreateStream gets the stream id for a (hash, client) pair.
-// If it does not exist, it is created.
+// If it does not exist, it is created, as by OpenStream from the default
+// ingest client.
 func (s *Store) FindOrCreateStream(ctx context.Context, serverSeedHashed, clientSeed string) (uuid.UUID, error) {
+	open, err := s.OpenStream(ctx, serverSeedHashed, clientSeed, "")
+	return open.ID, err
+}
+
+// StreamOpen is the stream a message belongs to. Closed lists the streams
+// of the same ingest client that its creation closed. Frozen reports an
+// existing stream that is closed or verified, whose frozen end nonce and
+// summary RefreezeStream brings up to date once the message is stored.
+type StreamOpen struct {
+	ID      uuid.UUID
+	Created bool
+	Closed  []uuid.UUID
+	Frozen  bool
+}
+
+// OpenStream gets the stream for a (hash, client) pair sent by
+// ingestClient, creating it if needed. A new stream closes the client's
+// active streams, since a new seed pair means the last one was rotated,
+// and follows the latest of them as its predecessor.
+func (s *Store) OpenStream(ctx context.Context, serverSeedHashed, clientSeed, ingestClient string) (StreamOpen, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return StreamOpen{}, err
+	}
+	defer tx.Rollback()
+	open, err := openStream(ctx, tx, serverSeedHashed, clientSeed, ingestClient)
+	if err != nil {
+		return StreamOpen{}, err
+	}
+	return open, tx.Commit()
+}
+
+func openStream(ctx context.Context, q dbtx, serverSeedHashed, clientSeed, ingestClient string) (StreamOpen, error) {
 	now := time.Now().UTC()
 
 	// Try fast path: select existing
-	var idStr string
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id FROM live_streams WHERE server_seed_hashed=? AND client_seed=?`,
-		serverSeedHashed, clientSeed).Scan(&idStr)
+	var idStr, state string
+	err := q.QueryRowContext(ctx,
+		`SELECT id, state FROM live_streams WHERE server_seed_hashed=? AND client_seed=?`,
+		serverSeedHashed, clientSeed).Scan(&idStr, &state)
 	switch {
 	case err == nil:
-		if _, err2 := s.db.ExecContext(ctx,
+		if _, err2 := q.ExecContext(ctx,
 			`UPDATE live_streams SET last_seen_at=? WHERE id=?`, now, idStr); err2 != nil {
-			return uuid.Nil, err2
+			return StreamOpen{}, err2
 		}
-		return uuid.MustParse(idStr), nil
+		// A late message for a stream a newer seed pair closed still
+		// belongs to it; the stream stays closed
+		return StreamOpen{ID: uuid.MustParse(idStr), Frozen: state != StreamActive}, nil
 	case errors.Is(err, sql.ErrNoRows):
-		// Create new
-		id := uuid.New()
-		_, err2 := s.db.ExecContext(ctx,
-			`INSERT INTO live_streams(id, server_seed_hashed, client_seed, created_at, last_seen_at, notes)
-			 VALUES(?, ?, ?, ?, ?, '')`,
-			id.String(), serverSeedHashed, clientSeed, now, now)
+		// Create new, after the client's current streams
+		open := StreamOpen{ID: uuid.New(), Created: true}
+		rows, err := q.QueryContext(ctx, `
+			SELECT id FROM live_streams WHERE ingest_client=? AND state=?
+			ORDER BY last_seen_at DESC`, ingestClient, StreamActive)
+		if err != nil {
+			return StreamOpen{}, err
+		}
+		for rows.Next() {
+			var prev uuid.UUID
+			if err := rows.Scan(&prev); err != nil {
+				rows.Close()
+				return StreamOpen{}, err
+			}
+			open.Closed = append(open.Closed, prev)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return StreamOpen{}, err
+		}
+		var predecessor any
+		if len(open.Closed) > 0 {
+			predecessor = open.Closed[0].String()
+		}
+
+		_, err2 := q.ExecContext(ctx,
+			`INSERT INTO live_streams(id, server_seed_hashed, client_seed, created_at, last_seen_at, notes,
+				state, ingest_client, predecessor_id)
+			 VALUES(?, ?, ?, ?, ?, '', ?, ?, ?)`,
+			open.ID.String(), serverSeedHashed, clientSeed, now, now, StreamActive, ingestClient, predecessor)
 		if err2 != nil {
 			// Race: another writer inserted concurrently; select again.
 			if isConstraintErr(err2) {
-				return s.FindOrCreateStream(ctx, serverSeedHashed, clientSeed)
+				return openStream(ctx, q, serverSeedHashed, clientSeed, ingestClient)
 			}
-			return uuid.Nil, err2
+			return StreamOpen{}, err2
 		}
-		return id, nil
+		for _, prev := range open.Closed {
+			if err := closeStream(ctx, q, prev, StreamClosed, now); err != nil {
+				return StreamOpen{}, err
+			}
+		}
+		return open, nil
 	default:
-		return uuid.Nil, err
+		return StreamOpen{}, err
 	}
 }
 
@@ -232,32 +533,67 @@ func (s *Store) UpdateNotes(ctx context.Context, streamID uuid.UUID, notes strin
 	return err
 }
 
+// spanTotalsQuery sums a stream's round spans for missingRoundsExpr, which
+// counts the uncovered nonces from its first round to the last observed one.
+const (
+	spanTotalsQuery = `SELECT stream_id, MIN(start_nonce) AS first, MAX(end_nonce) AS last,
+		SUM(end_nonce - start_nonce + 1) AS covered FROM live_round_spans`
+	missingRoundsExpr = `CASE WHEN c.first IS NULL THEN 0
+		ELSE MAX(c.last, COALESCE(s.last_observed_nonce, 0)) - c.first + 1 - c.covered END`
+	// streamGamesExpr lists a stream's games, comma separated
+	streamGamesExpr = `(SELECT GROUP_CONCAT(g.game, ',' ORDER BY g.first_seen, g.game)
+		FROM live_stream_games g WHERE g.stream_id = s.id)`
+)
+
+func splitGames(games sql.NullString) []string {
+	if !games.Valid || games.String == "" {
+		return []string{}
+	}
+	return strings.Split(games.String, ",")
+}
+
 // GetStream returns stream metadata including aggregates.
 func (s *Store) GetStream(ctx context.Context, streamID uuid.UUID) (LiveStream, error) {
 	var ls LiveStream
 	var lastObservedAt sql.NullTime
+	var games sql.NullString
 	row := s.db.QueryRowContext(ctx, `
 		SELECT s.id, s.server_seed_hashed, s.client_seed, s.created_at, s.last_seen_at, s.notes,
 		       COALESCE(s.last_observed_nonce, 0), s.last_observed_at,
-		       COALESCE(b.cnt, 0), COALESCE(b.maxres, 0)
+		       COALESCE(b.cnt, 0), COALESCE(b.maxres, 0),
+		       `+missingRoundsExpr+`, `+streamGamesExpr+`, `+streamLifecycleColumns+`
 		FROM live_streams s
 		LEFT JOIN (
 			SELECT stream_id, COUNT(*) AS cnt, MAX(round_result) AS maxres
 			FROM live_bets WHERE stream_id=? ) b
 		ON s.id = b.stream_id
+		LEFT JOIN (`+spanTotalsQuery+` WHERE stream_id=?) c ON s.id = c.stream_id
 		WHERE s.id=?`,
-		streamID.String(), streamID.String(),
+		streamID.String(), streamID.String(), streamID.String(),
 	)
-	err := row.Scan(&ls.ID, &ls.ServerSeedHashed, &ls.ClientSeed, &ls.CreatedAt, &ls.LastSeenAt, &ls.Notes,
-		&ls.LastObservedNonce, &lastObservedAt, &ls.TotalBets, &ls.HighestResult)
+	var lc streamLifecycle
+	err := row.Scan(append([]any{&ls.ID, &ls.ServerSeedHashed, &ls.ClientSeed, &ls.CreatedAt, &ls.LastSeenAt, &ls.Notes,
+		&ls.LastObservedNonce, &lastObservedAt, &ls.TotalBets, &ls.HighestResult, &ls.MissingRounds, &games},
+		lc.dest(&ls)...)...)
+	if err != nil {
+		return ls, err
+	}
 	if lastObservedAt.Valid {
 		ls.LastObservedAt = lastObservedAt.Time
 	}
-	return ls, err
+	ls.Incomplete = ls.MissingRounds > 0
+	ls.Games = splitGames(games)
+	return ls, lc.apply(&ls)
 }
 
 // ListStreams returns streams ordered by last_seen_at desc with aggregates.
 func (s *Store) ListStreams(ctx context.Context, limit, offset int) ([]LiveStream, error) {
+	return s.ListStreamsByState(ctx, "", limit, offset)
+}
+
+// ListStreamsByState is ListStreams limited to streams in state; an empty
+// state lists them all.
+func (s *Store) ListStreamsByState(ctx context.Context, state string, limit, offset int) ([]LiveStream, error) {
 	if limit <= 0 || limit > 500 {
 		limit = 100
 	}
@@ -266,14 +602,19 @@ func (s *Store) ListStreams(ctx context.Context, limit, offset int) ([]LiveStrea
 		       COALESCE(s.last_observed_nonce, 0) AS last_observed_nonce,
 		       s.last_observed_at,
 		       COALESCE(b.cnt, 0) AS total_bets,
-		       COALESCE(b.maxres, 0) AS highest_result
+		       COALESCE(b.maxres, 0) AS highest_result,
+		       `+missingRoundsExpr+` AS missing_rounds,
+		       `+streamGamesExpr+` AS games,
+		       `+streamLifecycleColumns+`
 		FROM live_streams s
 		LEFT JOIN (
 			SELECT stream_id, COUNT(*) AS cnt, MAX(round_result) AS maxres
 			FROM live_bets GROUP BY stream_id
 		) b ON s.id = b.stream_id
+		LEFT JOIN (`+spanTotalsQuery+` GROUP BY stream_id) c ON s.id = c.stream_id
+		WHERE ? = '' OR s.state = ?
 		ORDER BY s.last_seen_at DESC
-		LIMIT ? OFFSET ?`, limit, offset)
+		LIMIT ? OFFSET ?`, state, state, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -283,22 +624,277 @@ func (s *Store) ListStreams(ctx context.Context, limit, offset int) ([]LiveStrea
 	for rows.Next() {
 		var ls LiveStream
 		var lastObservedAt sql.NullTime
-		if err := rows.Scan(&ls.ID, &ls.ServerSeedHashed, &ls.ClientSeed, &ls.CreatedAt, &ls.LastSeenAt, &ls.Notes,
-			&ls.LastObservedNonce, &lastObservedAt, &ls.TotalBets, &ls.HighestResult); err != nil {
+		var games sql.NullString
+		var lc streamLifecycle
+		if err := rows.Scan(append([]any{&ls.ID, &ls.ServerSeedHashed, &ls.ClientSeed, &ls.CreatedAt, &ls.LastSeenAt, &ls.Notes,
+			&ls.LastObservedNonce, &lastObservedAt, &ls.TotalBets, &ls.HighestResult, &ls.MissingRounds, &games},
+			lc.dest(&ls)...)...); err != nil {
 			return nil, err
 		}
 		if lastObservedAt.Valid {
 			ls.LastObservedAt = lastObservedAt.Time
 		}
+		ls.Incomplete = ls.MissingRounds > 0
+		ls.Games = splitGames(games)
+		if err := lc.apply(&ls); err != nil {
+			return nil, err
+		}
 		out = append(out, ls)
 	}
 	return out, rows.Err()
 }
 
+// --------- Stream lifecycle ---------
+
+// Stream states
+const (
+	StreamActive   = "active"
+	StreamClosed   = "closed"
+	StreamVerified = "verified" // closed, with its server seed revealed
+)
+
+// ErrStreamVerified is returned when changing the state of a verified
+// stream, which is final.
+var ErrStreamVerified = errors.New("a verified stream's state can't change")
+
+// StreamSummary is a stream's totals as they stood when it was closed.
+type StreamSummary struct {
+	Bets          int64    `json:"bets"`
+	Wagered       float64  `json:"wagered"`
+	Payout        float64  `json:"payout"`
+	HighestResult float64  `json:"highest_result"`
+	FirstNonce    int64    `json:"first_nonce"` // first covered round
+	Rounds        int64    `json:"rounds"`      // covered nonces, compacted ones included
+	MissingRounds int64    `json:"missing_rounds"`
+	Games         []string `json:"games"`
+}
+
+// streamLifecycleColumns are the columns streamLifecycle scans, for a
+// query on live_streams s
+const streamLifecycleColumns = `s.state, s.closed_at, s.end_nonce, s.summary, s.ingest_client, s.predecessor_id,
+	(SELECT n.id FROM live_streams n WHERE n.predecessor_id = s.id ORDER BY n.created_at LIMIT 1)`
+
+// streamLifecycle holds the nullable lifecycle columns of a stream row
+type streamLifecycle struct {
+	closedAt                        sql.NullTime
+	endNonce                        sql.NullInt64
+	summary, predecessor, successor sql.NullString
+}
+
+func (lc *streamLifecycle) dest(ls *LiveStream) []any {
+	return []any{&ls.State, &lc.closedAt, &lc.endNonce, &lc.summary, &ls.IngestClient, &lc.predecessor, &lc.successor}
+}
+
+func (lc *streamLifecycle) apply(ls *LiveStream) error {
+	if lc.closedAt.Valid {
+		ls.ClosedAt = &lc.closedAt.Time
+	}
+	ls.EndNonce = lc.endNonce.Int64
+	if lc.summary.Valid {
+		ls.Summary = &StreamSummary{}
+		if err := json.Unmarshal([]byte(lc.summary.String), ls.Summary); err != nil {
+			return fmt.Errorf("summary of stream %s: %w", ls.ID, err)
+		}
+	}
+	for _, link := range []struct {
+		col sql.NullString
+		id  **uuid.UUID
+	}{{lc.predecessor, &ls.PredecessorID}, {lc.successor, &ls.SuccessorID}} {
+		if link.col.Valid {
+			id, err := uuid.Parse(link.col.String)
+			if err != nil {
+				return err
+			}
+			*link.id = &id
+		}
+	}
+	return nil
+}
+
+// summarizeStream totals a stream's bets and rounds as they are now
+func summarizeStream(ctx context.Context, q dbtx, streamID uuid.UUID) (StreamSummary, error) {
+	var sum StreamSummary
+	var games sql.NullString
+	err := q.QueryRowContext(ctx, `
+		SELECT COALESCE(b.cnt, 0), COALESCE(b.wagered, 0), COALESCE(b.payout, 0), COALESCE(b.maxres, 0),
+		       COALESCE(c.first, 0), COALESCE(c.covered, 0), `+missingRoundsExpr+`, `+streamGamesExpr+`
+		FROM live_streams s
+		LEFT JOIN (
+			SELECT stream_id, COUNT(*) AS cnt, SUM(amount) AS wagered, SUM(payout) AS payout,
+			       MAX(round_result) AS maxres
+			FROM live_bets WHERE stream_id=? ) b
+		ON s.id = b.stream_id
+		LEFT JOIN (`+spanTotalsQuery+` WHERE stream_id=?) c ON s.id = c.stream_id
+		WHERE s.id=?`,
+		streamID.String(), streamID.String(), streamID.String()).Scan(&sum.Bets, &sum.Wagered, &sum.Payout,
+		&sum.HighestResult, &sum.FirstNonce, &sum.Rounds, &sum.MissingRounds, &games)
+	sum.Games = splitGames(games)
+	return sum, err
+}
+
+// closeStream moves an active or closed stream to state, freezing its end
+// nonce and summary the first time it's closed
+func closeStream(ctx context.Context, q dbtx, streamID uuid.UUID, state string, now time.Time) error {
+	var current string
+	if err := q.QueryRowContext(ctx,
+		`SELECT state FROM live_streams WHERE id=?`, streamID.String()).Scan(&current); err != nil {
+		return err
+	}
+	switch current {
+	case StreamVerified:
+		return nil
+	case StreamClosed:
+		_, err := q.ExecContext(ctx, `UPDATE live_streams SET state=? WHERE id=?`, state, streamID.String())
+		return err
+	}
+
+	sum, err := summarizeStream(ctx, q, streamID)
+	if err != nil {
+		return err
+	}
+	frozen, err := json.Marshal(sum)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, `
+		UPDATE live_streams SET state=?, closed_at=?, end_nonce=COALESCE(last_observed_nonce, 0), summary=?
+		WHERE id=?`, state, now, string(frozen), streamID.String())
+	return err
+}
+
+// refreezeStream brings the end nonce and summary of a closed or verified
+// stream up to date, keeping when it was closed. Active streams are left
+// alone.
+func refreezeStream(ctx context.Context, q dbtx, streamID uuid.UUID) error {
+	sum, err := summarizeStream(ctx, q, streamID)
+	if err != nil {
+		return err
+	}
+	frozen, err := json.Marshal(sum)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, `
+		UPDATE live_streams SET end_nonce=COALESCE(last_observed_nonce, 0), summary=?
+		WHERE id=? AND state<>?`, string(frozen), streamID.String(), StreamActive)
+	return err
+}
+
+// RefreezeStream brings a closed or verified stream's end nonce and
+// summary up to date after a message reached it; see StreamOpen.
+func (s *Store) RefreezeStream(ctx context.Context, streamID uuid.UUID) error {
+	return refreezeStream(ctx, s.db, streamID)
+}
+
+// SetStreamState closes an active stream or reopens a closed one, which
+// drops its frozen summary. A verified stream is ErrStreamVerified; use
+// VerifyStreamState to verify one.
+func (s *Store) SetStreamState(ctx context.Context, streamID uuid.UUID, state string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	if err := tx.QueryRowContext(ctx,
+		`SELECT state FROM live_streams WHERE id=?`, streamID.String()).Scan(&current); err != nil {
+		return err
+	}
+	switch {
+	case current == StreamVerified:
+		return ErrStreamVerified
+	case current == state:
+	case state == StreamClosed:
+		err = closeStream(ctx, tx, streamID, StreamClosed, time.Now().UTC())
+	case state == StreamActive:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE live_streams SET state=?, closed_at=NULL, end_nonce=NULL, summary=NULL
+			WHERE id=?`, StreamActive, streamID.String())
+	default:
+		return fmt.Errorf("state must be %s or %s", StreamActive, StreamClosed)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// VerifyStreamState marks a stream verified once its server seed is
+// known, closing it first if it's still active.
+func (s *Store) VerifyStreamState(ctx context.Context, streamID uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := closeStream(ctx, tx, streamID, StreamVerified, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// StreamHistory returns the chain of streams a stream belongs to, from
+// its earliest predecessor to its latest successor.
+func (s *Store) StreamHistory(ctx context.Context, streamID uuid.UUID) ([]LiveStream, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		WITH RECURSIVE
+		back(id, predecessor_id, depth) AS (
+			SELECT id, predecessor_id, 0 FROM live_streams WHERE id=?
+			UNION ALL
+			SELECT s.id, s.predecessor_id, back.depth - 1
+			FROM live_streams s JOIN back ON s.id = back.predecessor_id
+		),
+		forward(id, depth) AS (
+			SELECT id, 0 FROM live_streams WHERE id=?
+			UNION ALL
+			SELECT s.id, forward.depth + 1
+			FROM live_streams s JOIN forward ON s.predecessor_id = forward.id
+		)
+		SELECT id, depth FROM back
+		UNION
+		SELECT id, depth FROM forward
+		ORDER BY depth`, streamID.String(), streamID.String())
+	if err != nil {
+		return nil, err
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		var depth int64
+		if err := rows.Scan(&id, &depth); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	out := make([]LiveStream, 0, len(ids))
+	for _, id := range ids {
+		ls, err := s.GetStream(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ls)
+	}
+	return out, nil
+}
+
 // --------- Bets (ingest/query) ---------
 
 // IngestBet stores a bet under the stream. Idempotent on (stream_id, antebot_bet_id).
 func (s *Store) IngestBet(ctx context.Context, streamID uuid.UUID, bet LiveBet) (IngestResult, error) {
+	return ingestBet(ctx, s.db, streamID, bet)
+}
+
+func ingestBet(ctx context.Context, q dbtx, streamID uuid.UUID, bet LiveBet) (IngestResult, error) {
 	// Basic validation
 	if bet.AntebotBetID == "" {
 		return IngestResult{Accepted: false, Reason: "missing bet id"}, errors.New("missing antebot_bet_id")
@@ -309,18 +905,21 @@ func (s *Store) IngestBet(ctx context.Context, streamID uuid.UUID, bet LiveBet)
 	if bet.Nonce <= 0 {
 		return IngestResult{Accepted: false, Reason: "invalid nonce"}, errors.New("invalid nonce")
 	}
-	if bet.Difficulty == "" {
+	if bet.Game == "" && bet.Difficulty == "" {
+		// A bet without a game is a pump bet, which needs its difficulty
 		return IngestResult{Accepted: false, Reason: "missing difficulty"}, errors.New("missing difficulty")
 	}
+	defaultGame(&bet)
 
 	now := time.Now().UTC()
-	_, err := s.db.ExecContext(ctx, `
+	res, err := q.ExecContext(ctx, `
 		INSERT INTO live_bets(
 			stream_id, antebot_bet_id, received_at, date_time, nonce,
-			amount, payout, difficulty, round_target, round_result
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			amount, payout, difficulty, round_target, round_result, game, details
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		streamID.String(), bet.AntebotBetID, now, bet.DateTime.UTC(), bet.Nonce,
-		bet.Amount, bet.Payout, strings.ToLower(bet.Difficulty), bet.RoundTarget, bet.RoundResult)
+		bet.Amount, bet.Payout, strings.ToLower(bet.Difficulty), bet.RoundTarget, bet.RoundResult,
+		bet.Game, bet.Details)
 	if err != nil {
 		if isConstraintErr(err) {
 			// Duplicate bet for this stream
@@ -328,10 +927,151 @@ func (s *Store) IngestBet(ctx context.Context, streamID uuid.UUID, bet LiveBet)
 		}
 		return IngestResult{Accepted: false, Reason: "db_error"}, err
 	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return IngestResult{Accepted: false, Reason: "db_error"}, err
+	}
 
 	// touch last_seen_at
-	_, _ = s.db.ExecContext(ctx, `UPDATE live_streams SET last_seen_at=? WHERE id=?`, now, streamID.String())
-	return IngestResult{Accepted: true}, nil
+	_, _ = q.ExecContext(ctx, `UPDATE live_streams SET last_seen_at=? WHERE id=?`, now, streamID.String())
+	if _, err := q.ExecContext(ctx, `
+		INSERT INTO live_stream_games(stream_id, game, first_seen, last_seen) VALUES (?, ?, ?, ?)
+		ON CONFLICT(stream_id, game) DO UPDATE SET last_seen=excluded.last_seen`,
+		streamID.String(), bet.Game, now, now); err != nil {
+		return IngestResult{Accepted: false, Reason: "db_error"}, err
+	}
+	return IngestResult{Accepted: true, ID: id}, nil
+}
+
+// defaultGame fills in the game and details of a bet recorded without
+// them, which is a pump bet whose only parameter is its difficulty.
+func defaultGame(b *LiveBet) {
+	if b.Game == "" {
+		b.Game = DefaultGame
+	}
+	if b.Details != "" {
+		return
+	}
+	b.Details = "{}"
+	if b.Game == DefaultGame && b.Difficulty != "" {
+		details, _ := json.Marshal(map[string]string{"difficulty": strings.ToLower(b.Difficulty)})
+		b.Details = string(details)
+	}
+}
+
+// IngestItem is one message of an ingest batch: a bet, or a heartbeat
+// (round) when Bet is nil.
+type IngestItem struct {
+	ServerSeedHashed string
+	ClientSeed       string
+	Nonce            int64
+	RoundResult      float64
+	Bet              *LiveBet
+	IngestClient     string // who sent it; see OpenStream
+}
+
+// BatchResult is the outcome of one IngestItem. Reason is "duplicate" for
+// a bet already stored; Err is set when the item failed. Gap is as
+// reported by InsertRound.
+type BatchResult struct {
+	StreamID uuid.UUID
+	BetID    int64 // the stored bet's id, for an accepted bet
+	Accepted bool
+	Reason   string
+	Gap      bool
+	Closed   []uuid.UUID // streams closed by this item's new stream
+	Err      error
+
+	frozen bool // the item opened a closed or verified stream
+}
+
+// IngestBatch stores items in a single transaction. Each item runs under
+// its own savepoint, so a failing item is rolled back on its own and the
+// rest still commit. Closed streams the batch reached are refrozen before
+// it commits. The error is for the batch as a whole.
+func (s *Store) IngestBatch(ctx context.Context, items []IngestItem) ([]BatchResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	streams := map[streamKey]uuid.UUID{}
+	frozen := map[uuid.UUID]bool{}
+	out := make([]BatchResult, len(items))
+	for i, it := range items {
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT ingest_item`); err != nil {
+			return nil, err
+		}
+		key := streamKey{it.ServerSeedHashed, it.ClientSeed}
+		_, known := streams[key]
+		res := ingestItem(ctx, tx, streams, it)
+		release := `RELEASE ingest_item`
+		if res.Err != nil {
+			release = `ROLLBACK TO ingest_item; RELEASE ingest_item`
+		}
+		if _, err := tx.ExecContext(ctx, release); err != nil {
+			return nil, err
+		}
+		switch {
+		case res.Err == nil:
+			// Only a stream whose savepoint was released is sure to exist
+			streams[key] = res.StreamID
+			if res.frozen {
+				frozen[res.StreamID] = true
+			}
+		case !known:
+			// The rollback undid opening the stream and what it closed
+			res.StreamID, res.Closed = uuid.Nil, nil
+		}
+		out[i] = res
+	}
+	for id := range frozen {
+		if err := refreezeStream(ctx, tx, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// streamKey identifies a stream by its seed pair
+type streamKey struct{ hashed, client string }
+
+// ingestItem stores one batch item, looking its stream up in streams, the
+// streams earlier items of the batch committed to, before opening it
+func ingestItem(ctx context.Context, tx *sql.Tx, streams map[streamKey]uuid.UUID, it IngestItem) BatchResult {
+	var res BatchResult
+	id, ok := streams[streamKey{it.ServerSeedHashed, it.ClientSeed}]
+	if !ok {
+		open, err := openStream(ctx, tx, it.ServerSeedHashed, it.ClientSeed, it.IngestClient)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		id, res.Closed, res.frozen = open.ID, open.Closed, open.Frozen
+	}
+	res.StreamID = id
+
+	if it.Bet == nil {
+		if res.Err = updateLastObservedNonce(ctx, tx, id, it.Nonce); res.Err != nil {
+			return res
+		}
+		res.Gap, res.Err = insertRound(ctx, tx, id, it.Nonce, it.RoundResult)
+		res.Accepted = res.Err == nil
+		return res
+	}
+
+	ir, err := ingestBet(ctx, tx, id, *it.Bet)
+	if err != nil {
+		res.Reason, res.Err = ir.Reason, err
+		return res
+	}
+	res.Accepted, res.Reason, res.BetID = ir.Accepted, ir.Reason, ir.ID
+	res.Err = updateLastObservedNonce(ctx, tx, id, it.Nonce)
+	return res
 }
 
 // ListBets returns paginated bets for a stream with optional minResult filter.
@@ -357,7 +1097,7 @@ func (s *Store) ListBets(ctx context.Context, streamID uuid.UUID, minResult floa
 	}
 	// Page
 	pageQ := fmt.Sprintf(`
-		SELECT id, stream_id, antebot_bet_id, received_at, date_time, nonce, amount, payout, difficulty, round_target, round_result
+		SELECT id, stream_id, antebot_bet_id, received_at, date_time, nonce, amount, payout, difficulty, round_target, round_result, game, details
 		FROM live_bets
 		WHERE %s
 		ORDER BY nonce %s
@@ -373,7 +1113,7 @@ func (s *Store) ListBets(ctx context.Context, streamID uuid.UUID, minResult floa
 	for rows.Next() {
 		var b LiveBet
 		if err := rows.Scan(&b.ID, &b.StreamID, &b.AntebotBetID, &b.ReceivedAt, &b.DateTime, &b.Nonce,
-			&b.Amount, &b.Payout, &b.Difficulty, &b.RoundTarget, &b.RoundResult); err != nil {
+			&b.Amount, &b.Payout, &b.Difficulty, &b.RoundTarget, &b.RoundResult, &b.Game, &b.Details); err != nil {
 			return nil, 0, err
 		}
 		out = append(out, b)
@@ -387,7 +1127,7 @@ func (s *Store) TailBets(ctx context.Context, streamID uuid.UUID, lastID int64,
 		limit = 1000
 	}
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, stream_id, antebot_bet_id, received_at, date_time, nonce, amount, payout, difficulty, round_target, round_result
+		SELECT id, stream_id, antebot_bet_id, received_at, date_time, nonce, amount, payout, difficulty, round_target, round_result, game, details
 		FROM live_bets
 		WHERE stream_id=? AND id > ?
 		ORDER BY id ASC
@@ -401,7 +1141,7 @@ func (s *Store) TailBets(ctx context.Context, streamID uuid.UUID, lastID int64,
 	for rows.Next() {
 		var b LiveBet
 		if err := rows.Scan(&b.ID, &b.StreamID, &b.AntebotBetID, &b.ReceivedAt, &b.DateTime, &b.Nonce,
-			&b.Amount, &b.Payout, &b.Difficulty, &b.RoundTarget, &b.RoundResult); err != nil {
+			&b.Amount, &b.Payout, &b.Difficulty, &b.RoundTarget, &b.RoundResult, &b.Game, &b.Details); err != nil {
 			return nil, err
 		}
 		out = append(out, b)
@@ -409,52 +1149,100 @@ func (s *Store) TailBets(ctx context.Context, streamID uuid.UUID, lastID int64,
 	return out, rows.Err()
 }
 
-// DeleteStream removes a stream and all related bets.
-func (s *Store) DeleteStream(ctx context.Context, streamID uuid.UUID) error {
-	_, err := s.db.ExecContext(ctx, `DELETE FROM live_streams WHERE id=?`, streamID.String())
-	return err
-}
-
-// ExportCSV writes all bets for a stream to the writer as CSV (header included).
-func (s *Store) ExportCSV(ctx context.Context, w io.Writer, streamID uuid.UUID) error {
-	// Write header
-	if _, err := io.WriteString(w, "id,nonce,date_time,amount,payout,difficulty,round_target,round_result\n"); err != nil {
-		return err
+// BetsAfter returns the latest limit bets with id > afterID, of one stream
+// or of all when streamID is nil, ordered by id ASC. truncated reports
+// that earlier bets after afterID were left out.
+func (s *Store) BetsAfter(ctx context.Context, streamID *uuid.UUID, afterID int64, limit int) (bets []LiveBet, truncated bool, err error) {
+	if limit <= 0 || limit > 5000 {
+		limit = 1000
+	}
+	where := "id > ?"
+	args := []any{afterID}
+	if streamID != nil {
+		where += " AND stream_id = ?"
+		args = append(args, streamID.String())
 	}
+	args = append(args, limit+1)
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, nonce, date_time, amount, payout, difficulty, round_target, round_result
-		FROM live_bets WHERE stream_id=? ORDER BY nonce ASC`, streamID.String())
+		SELECT id, stream_id, antebot_bet_id, received_at, date_time, nonce, amount, payout, difficulty, round_target, round_result, game, details
+		FROM live_bets
+		WHERE `+where+`
+		ORDER BY id DESC
+		LIMIT ?`, args...)
 	if err != nil {
-		return err
+		return nil, false, err
 	}
 	defer rows.Close()
 
-	var (
-		id                 int64
-		n                  int64
-		ts                 time.Time
-		amt, pay, tgt, res float64
-		diff               string
-	)
 	for rows.Next() {
-		if err := rows.Scan(&id, &n, &ts, &amt, &pay, &diff, &tgt, &res); err != nil {
-			return err
-		}
-		line := fmt.Sprintf("%d,%d,%s,%.8f,%.8f,%s,%.2f,%.2f\n",
-			id, n, ts.UTC().Format(time.RFC3339Nano), amt, pay, diff, tgt, res)
-		if _, err := io.WriteString(w, line); err != nil {
-			return err
+		var b LiveBet
+		if err := rows.Scan(&b.ID, &b.StreamID, &b.AntebotBetID, &b.ReceivedAt, &b.DateTime, &b.Nonce,
+			&b.Amount, &b.Payout, &b.Difficulty, &b.RoundTarget, &b.RoundResult, &b.Game, &b.Details); err != nil {
+			return nil, false, err
 		}
+		bets = append(bets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(bets) > limit {
+		bets, truncated = bets[:limit], true
+	}
+	slices.Reverse(bets)
+	return bets, truncated, nil
+}
+
+// DeleteStream removes a stream and all related bets.
+func (s *Store) DeleteStream(ctx context.Context, streamID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM live_streams WHERE id=?`, streamID.String())
+	return err
+}
+
+// ExportCSV writes all bets for a stream to the writer as CSV (header included).
+func (s *Store) ExportCSV(ctx context.Context, w io.Writer, streamID uuid.UUID) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(CSVHeader); err != nil {
+		return err
+	}
+	err := s.EachBet(ctx, streamID, func(b LiveBet) error {
+		return cw.Write(CSVRecord(b))
+	})
+	cw.Flush()
+	if err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// CSVHeader is the header of a bets CSV export
+var CSVHeader = []string{"id", "nonce", "date_time", "amount", "payout", "difficulty", "round_target", "round_result", "game", "details"}
+
+// CSVRecord formats a bet as a CSVHeader row.
+func CSVRecord(b LiveBet) []string {
+	return []string{
+		strconv.FormatInt(b.ID, 10),
+		strconv.FormatInt(b.Nonce, 10),
+		b.DateTime.UTC().Format(time.RFC3339Nano),
+		strconv.FormatFloat(b.Amount, 'f', 8, 64),
+		strconv.FormatFloat(b.Payout, 'f', 8, 64),
+		b.Difficulty,
+		strconv.FormatFloat(b.RoundTarget, 'f', 2, 64),
+		strconv.FormatFloat(b.RoundResult, 'f', 2, 64),
+		b.Game,
+		b.Details,
 	}
-	return rows.Err()
 }
 
 // --------- Rounds (heartbeat data) ---------
 
 // UpdateLastObservedNonce updates the stream's last observed nonce (from heartbeats).
 func (s *Store) UpdateLastObservedNonce(ctx context.Context, streamID uuid.UUID, nonce int64) error {
+	return updateLastObservedNonce(ctx, s.db, streamID, nonce)
+}
+
+func updateLastObservedNonce(ctx context.Context, q dbtx, streamID uuid.UUID, nonce int64) error {
 	now := time.Now().UTC()
-	_, err := s.db.ExecContext(ctx, `
+	_, err := q.ExecContext(ctx, `
 		UPDATE live_streams
 		SET last_observed_nonce = CASE
 		        WHEN COALESCE(last_observed_nonce, 0) >= ? THEN COALESCE(last_observed_nonce, 0)
@@ -470,17 +1258,94 @@ func (s *Store) UpdateLastObservedNonce(ctx context.Context, streamID uuid.UUID,
 	return err
 }
 
-// InsertRound stores a round from heartbeat data. Idempotent on (stream_id, nonce).
-func (s *Store) InsertRound(ctx context.Context, streamID uuid.UUID, nonce int64, roundResult float64) error {
-	now := time.Now().UTC()
-	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO live_rounds(stream_id, nonce, round_result, received_at)
-		VALUES (?, ?, ?, ?)
+// InsertRound stores an observed round from heartbeat data. Idempotent on
+// (stream_id, nonce); an observed round replaces a computed one. gap
+// reports that the round is past the stream's last round with nonces
+// missing in between.
+func (s *Store) InsertRound(ctx context.Context, streamID uuid.UUID, nonce int64, roundResult float64) (gap bool, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if gap, err = insertRound(ctx, tx, streamID, nonce, roundResult); err != nil {
+		return false, err
+	}
+	return gap, tx.Commit()
+}
+
+func insertRound(ctx context.Context, tx dbtx, streamID uuid.UUID, nonce int64, roundResult float64) (gap bool, err error) {
+	var last sql.NullInt64
+	if err := tx.QueryRowContext(ctx,
+		`SELECT MAX(end_nonce) FROM live_round_spans WHERE stream_id=?`, streamID.String()).Scan(&last); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO live_rounds(stream_id, nonce, round_result, received_at, source)
+		VALUES (?, ?, ?, ?, ?)
 		ON CONFLICT(stream_id, nonce) DO UPDATE SET
 			round_result = excluded.round_result,
-			received_at = excluded.received_at`,
-		streamID.String(), nonce, roundResult, now)
-	return err
+			received_at = excluded.received_at,
+			source = excluded.source`,
+		streamID.String(), nonce, roundResult, time.Now().UTC(), RoundObserved); err != nil {
+		return false, err
+	}
+	if err := coverRange(ctx, tx, streamID, nonce, nonce); err != nil {
+		return false, err
+	}
+	return last.Valid && nonce > last.Int64+1, nil
+}
+
+// InsertComputedRounds stores rounds replayed from the server seed. Nonces
+// that already have a round are left alone. Returns how many were added.
+func (s *Store) InsertComputedRounds(ctx context.Context, streamID uuid.UUID, rounds []LiveRound) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT OR IGNORE INTO live_rounds(stream_id, nonce, round_result, received_at, source)
+		VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	added := 0
+	start := int64(-1)
+	var prev int64
+	for _, r := range rounds {
+		res, err := stmt.ExecContext(ctx, streamID.String(), r.Nonce, r.RoundResult, now, RoundComputed)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added++
+		}
+		// Cover runs of consecutive nonces in one go
+		if start >= 0 && r.Nonce != prev+1 {
+			if err := coverRange(ctx, tx, streamID, start, prev); err != nil {
+				return 0, err
+			}
+			start = -1
+		}
+		if start < 0 {
+			start = r.Nonce
+		}
+		prev = r.Nonce
+	}
+	if start >= 0 {
+		if err := coverRange(ctx, tx, streamID, start, prev); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return added, nil
 }
 
 // ListRounds returns rounds for a stream ordered by nonce.
@@ -502,7 +1367,7 @@ func (s *Store) ListRounds(ctx context.Context, streamID uuid.UUID, minResult fl
 	}
 	// Page
 	pageQ := fmt.Sprintf(`
-		SELECT id, stream_id, nonce, round_result, received_at
+		SELECT id, stream_id, nonce, round_result, received_at, source
 		FROM live_rounds
 		WHERE %s
 		ORDER BY nonce DESC
@@ -517,7 +1382,7 @@ func (s *Store) ListRounds(ctx context.Context, streamID uuid.UUID, minResult fl
 	var out []LiveRound
 	for rows.Next() {
 		var r LiveRound
-		if err := rows.Scan(&r.ID, &r.StreamID, &r.Nonce, &r.RoundResult, &r.ReceivedAt); err != nil {
+		if err := rows.Scan(&r.ID, &r.StreamID, &r.Nonce, &r.RoundResult, &r.ReceivedAt, &r.Source); err != nil {
 			return nil, 0, err
 		}
 		out = append(out, r)
@@ -531,7 +1396,7 @@ func (s *Store) TailRounds(ctx context.Context, streamID uuid.UUID, sinceNonce i
 		limit = 1000
 	}
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, stream_id, nonce, round_result, received_at
+		SELECT id, stream_id, nonce, round_result, received_at, source
 		FROM live_rounds
 		WHERE stream_id = ? AND nonce > ?
 		ORDER BY nonce ASC
@@ -544,7 +1409,7 @@ func (s *Store) TailRounds(ctx context.Context, streamID uuid.UUID, sinceNonce i
 	var out []LiveRound
 	for rows.Next() {
 		var r LiveRound
-		if err := rows.Scan(&r.ID, &r.StreamID, &r.Nonce, &r.RoundResult, &r.ReceivedAt); err != nil {
+		if err := rows.Scan(&r.ID, &r.StreamID, &r.Nonce, &r.RoundResult, &r.ReceivedAt, &r.Source); err != nil {
 			return nil, err
 		}
 		out = append(out, r)
@@ -552,6 +1417,41 @@ func (s *Store) TailRounds(ctx context.Context, streamID uuid.UUID, sinceNonce i
 	return out, rows.Err()
 }
 
+// RoundsAfter returns a stream's latest limit rounds with nonce >
+// afterNonce, ordered by nonce ASC. truncated reports that earlier rounds
+// after afterNonce were left out.
+func (s *Store) RoundsAfter(ctx context.Context, streamID uuid.UUID, afterNonce int64, limit int) (rounds []LiveRound, truncated bool, err error) {
+	if limit <= 0 || limit > 5000 {
+		limit = 1000
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, stream_id, nonce, round_result, received_at, source
+		FROM live_rounds
+		WHERE stream_id = ? AND nonce > ?
+		ORDER BY nonce DESC
+		LIMIT ?`, streamID.String(), afterNonce, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r LiveRound
+		if err := rows.Scan(&r.ID, &r.StreamID, &r.Nonce, &r.RoundResult, &r.ReceivedAt, &r.Source); err != nil {
+			return nil, false, err
+		}
+		rounds = append(rounds, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(rounds) > limit {
+		rounds, truncated = rounds[:limit], true
+	}
+	slices.Reverse(rounds)
+	return rounds, truncated, nil
+}
+
 // GetRecentRounds returns the most recent N rounds for a stream, ordered by nonce DESC.
 func (s *Store) GetRecentRounds(ctx context.Context, streamID uuid.UUID, limit int) ([]LiveRound, error) {
 	// Frontend requests thousands of rounds for analytics/patterns; keep this in sync.
@@ -565,7 +1465,7 @@ func (s *Store) GetRecentRounds(ctx context.Context, streamID uuid.UUID, limit i
 		limit = maxLimit
 	}
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, stream_id, nonce, round_result, received_at
+		SELECT id, stream_id, nonce, round_result, received_at, source
 		FROM live_rounds
 		WHERE stream_id = ?
 		ORDER BY nonce DESC
@@ -578,7 +1478,7 @@ func (s *Store) GetRecentRounds(ctx context.Context, streamID uuid.UUID, limit i
 	var out []LiveRound
 	for rows.Next() {
 		var r LiveRound
-		if err := rows.Scan(&r.ID, &r.StreamID, &r.Nonce, &r.RoundResult, &r.ReceivedAt); err != nil {
+		if err := rows.Scan(&r.ID, &r.StreamID, &r.Nonce, &r.RoundResult, &r.ReceivedAt, &r.Source); err != nil {
 			return nil, err
 		}
 		out = append(out, r)
@@ -586,20 +1486,14 @@ func (s *Store) GetRecentRounds(ctx context.Context, streamID uuid.UUID, limit i
 	return out, rows.Err()
 }
 
-// CleanupOldRounds removes rounds older than the specified nonce threshold for a stream.
-// This helps prevent unbounded growth of the rounds table.
+// CleanupOldRounds compacts all but the last keepLastN rounds of a stream
+// (50,000 when keepLastN <= 0) into per-block aggregates, keeping their
+// nonces covered. Retention policies do the same on a schedule.
 func (s *Store) CleanupOldRounds(ctx context.Context, streamID uuid.UUID, keepLastN int) error {
 	if keepLastN <= 0 {
 		keepLastN = 50000 // Default: keep last 50k rounds
 	}
-	_, err := s.db.ExecContext(ctx, `
-		DELETE FROM live_rounds
-		WHERE stream_id = ? AND nonce < (
-			SELECT MIN(nonce) FROM (
-				SELECT nonce FROM live_rounds WHERE stream_id = ?
-				ORDER BY nonce DESC LIMIT ?
-			)
-		)`, streamID.String(), streamID.String(), keepLastN)
+	_, err := s.CompactRounds(ctx, streamID, RetentionPolicy{KeepLast: int64(keepLastN)}, CompactOptions{})
 	return err
 }
 
@@ -607,6 +1501,13 @@ func (s *Store) CleanupOldRounds(ctx context.Context, streamID uuid.UUID, keepLa
 
 // UpsertSeedAlias links a hashed server seed to its plain text.
 func (s *Store) UpsertSeedAlias(ctx context.Context, hashed, plain string) error {
+	if s.sealer != nil {
+		sealed, err := s.sealer.Seal(plain)
+		if err != nil {
+			return err
+		}
+		plain = sealed
+	}
 	now := time.Now().UTC()
 	_, err := s.db.ExecContext(ctx, `
 		INSERT INTO seed_aliases(server_seed_hashed, server_seed_plain, first_seen, last_seen)
@@ -625,10 +1526,1431 @@ func (s *Store) LookupSeedAlias(ctx context.Context, hashed string) (string, boo
 	if errors.Is(err, sql.ErrNoRows) {
 		return "", false, nil
 	}
-	return plain, err == nil, err
+	if err != nil {
+		return "", false, err
+	}
+	if s.sealer != nil {
+		if plain, err = s.sealer.Open(plain); err != nil {
+			return "", false, err
+		}
+	}
+	return plain, true, nil
 }
 
-// --------- helpers ---------
+// ResealSeedAliases encrypts plain seeds stored unsealed or under an older
+// key, and returns how many aliases it changed.
+func (s *Store) ResealSeedAliases(ctx context.Context) (int, error) {
+	return s.resealColumn(ctx, "seed_aliases", "server_seed_hashed", "server_seed_plain")
+}
+
+// resealColumn reseals the values of column col of table that are stored
+// unsealed or under an older key, keyed by column key.
+func (s *Store) resealColumn(ctx context.Context, table, key, col string) (int, error) {
+	if s.sealer == nil {
+		return 0, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT `+key+`, `+col+` FROM `+table)
+	if err != nil {
+		return 0, err
+	}
+	stale := map[string]string{}
+	for rows.Next() {
+		var k, value string
+		if err := rows.Scan(&k, &value); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !s.sealer.Current(value) {
+			stale[k] = value
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil || len(stale) == 0 {
+		return 0, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	for k, value := range stale {
+		plain, err := s.sealer.Open(value)
+		if err != nil {
+			return 0, fmt.Errorf("%s %s: %w", table, k, err)
+		}
+		sealed, err := s.sealer.Seal(plain)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET `+col+`=? WHERE `+key+`=?`, sealed, k); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(stale), nil
+}
+
+// --------- Ingest keys and audit ---------
+
+// Live settings keys
+const (
+	SettingIngestToken     = "ingest_token"     // static X-Ingest-Token, replacing the one configured at startup
+	SettingSigningRequired = "signing_required" // "1" when unsigned ingest is refused
+)
+
+// maxIngestRejections is how many rejected requests the audit keeps
+const maxIngestRejections = 10000
+
+// IngestKey is a key a sender signs ingest requests with. Secret is only
+// filled in for the ingest server and never serialised.
+type IngestKey struct {
+	KeyID      string     `json:"key_id"`
+	Label      string     `json:"label"`
+	Secret     string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IngestRejection is an audited ingest request that was refused.
+type IngestRejection struct {
+	ID         int64     `json:"id"`
+	At         time.Time `json:"at"`
+	RemoteAddr string    `json:"remote_addr"`
+	KeyID      string    `json:"key_id,omitempty"`
+	Reason     string    `json:"reason"`
+	Path       string    `json:"path"`
+	Detail     string    `json:"detail,omitempty"`
+}
+
+// seal encrypts a secret when the store has a sealer
+func (s *Store) seal(plain string) (string, error) {
+	if s.sealer == nil {
+		return plain, nil
+	}
+	return s.sealer.Seal(plain)
+}
+
+// open decrypts a value stored by seal
+func (s *Store) open(value string) (string, error) {
+	if s.sealer == nil {
+		return value, nil
+	}
+	return s.sealer.Open(value)
+}
+
+// Setting returns a live setting and whether it is set. Settings are
+// sealed at rest like seeds.
+func (s *Store) Setting(ctx context.Context, key string) (string, bool, error) {
+	var value string
+	err := s.db.QueryRowContext(ctx, `SELECT value FROM live_settings WHERE key=?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	value, err = s.open(value)
+	return value, err == nil, err
+}
+
+// PutSetting stores a live setting.
+func (s *Store) PutSetting(ctx context.Context, key, value string) error {
+	sealed, err := s.seal(value)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO live_settings(key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value=excluded.value`, key, sealed)
+	return err
+}
+
+// CreateIngestKey stores a new signing key.
+func (s *Store) CreateIngestKey(ctx context.Context, k IngestKey) error {
+	secret, err := s.seal(k.Secret)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO live_ingest_keys(key_id, label, secret, created_at) VALUES (?, ?, ?, ?)`,
+		k.KeyID, k.Label, secret, k.CreatedAt.UTC())
+	return err
+}
+
+// ListIngestKeys returns every signing key, revoked ones included, with
+// their secrets, oldest first.
+func (s *Store) ListIngestKeys(ctx context.Context) ([]IngestKey, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT key_id, label, secret, created_at, last_used_at, revoked_at
+		FROM live_ingest_keys ORDER BY created_at, key_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []IngestKey{}
+	for rows.Next() {
+		var k IngestKey
+		var used, revoked sql.NullTime
+		if err := rows.Scan(&k.KeyID, &k.Label, &k.Secret, &k.CreatedAt, &used, &revoked); err != nil {
+			return nil, err
+		}
+		if k.Secret, err = s.open(k.Secret); err != nil {
+			return nil, fmt.Errorf("ingest key %s: %w", k.KeyID, err)
+		}
+		if used.Valid {
+			k.LastUsedAt = &used.Time
+		}
+		if revoked.Valid {
+			k.RevokedAt = &revoked.Time
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+// RevokeIngestKey stops a key from signing. Revoking a missing or already
+// revoked key is sql.ErrNoRows.
+func (s *Store) RevokeIngestKey(ctx context.Context, keyID string) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE live_ingest_keys SET revoked_at=? WHERE key_id=? AND revoked_at IS NULL`,
+		time.Now().UTC(), keyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// TouchIngestKey records when a key last signed an accepted request.
+func (s *Store) TouchIngestKey(ctx context.Context, keyID string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE live_ingest_keys SET last_used_at=? WHERE key_id=?`, at.UTC(), keyID)
+	return err
+}
+
+// ResealIngestSecrets encrypts signing keys and settings stored unsealed
+// or under an older key, and returns how many it changed.
+func (s *Store) ResealIngestSecrets(ctx context.Context) (int, error) {
+	keys, err := s.resealColumn(ctx, "live_ingest_keys", "key_id", "secret")
+	if err != nil {
+		return keys, err
+	}
+	settings, err := s.resealColumn(ctx, "live_settings", "key", "value")
+	return keys + settings, err
+}
+
+// RecordIngestRejection audits a refused ingest request, keeping the
+// latest maxIngestRejections.
+func (s *Store) RecordIngestRejection(ctx context.Context, rej IngestRejection) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO live_ingest_audit(at, remote_addr, key_id, reason, path, detail)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		rej.At.UTC(), rej.RemoteAddr, rej.KeyID, rej.Reason, rej.Path, rej.Detail)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	_, err = s.db.ExecContext(ctx, `DELETE FROM live_ingest_audit WHERE id <= ?`, id-maxIngestRejections)
+	return id, err
+}
+
+// ListIngestRejections returns the latest refused ingest requests, newest
+// first.
+func (s *Store) ListIngestRejections(ctx context.Context, limit int) ([]IngestRejection, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, at, remote_addr, key_id, reason, path, detail
+		FROM live_ingest_audit ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []IngestRejection{}
+	for rows.Next() {
+		var rej IngestRejection
+		if err := rows.Scan(&rej.ID, &rej.At, &rej.RemoteAddr, &rej.KeyID, &rej.Reason, &rej.Path, &rej.Detail); err != nil {
+			return nil, err
+		}
+		out = append(out, rej)
+	}
+	return out, rows.Err()
+}
+
+// --------- Archive export/import ---------
+
+// eachPageSize is how many rows EachBet and EachRound read per query
+const eachPageSize = 1000
+
+// EachBet calls fn for every bet of a stream in nonce order. See
+// EachBetPage.
+func (s *Store) EachBet(ctx context.Context, streamID uuid.UUID, fn func(LiveBet) error) error {
+	return s.EachBetPage(ctx, streamID, func(page []LiveBet) error {
+		for _, b := range page {
+			if err := fn(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// EachBetPage calls fn with a stream's bets in nonce order, a page at a
+// time. Each page is read by its own keyset query and closed before fn
+// runs, so a slow fn doesn't hold the database connection.
+func (s *Store) EachBetPage(ctx context.Context, streamID uuid.UUID, fn func([]LiveBet) error) error {
+	afterNonce, afterID := int64(math.MinInt64), int64(0)
+	for {
+		page, err := s.betPage(ctx, streamID, afterNonce, afterID)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if len(page) < eachPageSize {
+			return nil
+		}
+		last := page[len(page)-1]
+		afterNonce, afterID = last.Nonce, last.ID
+	}
+}
+
+func (s *Store) betPage(ctx context.Context, streamID uuid.UUID, afterNonce, afterID int64) ([]LiveBet, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, stream_id, antebot_bet_id, received_at, date_time, nonce, amount, payout, difficulty, round_target, round_result, game, details
+		FROM live_bets WHERE stream_id=? AND (nonce, id) > (?, ?)
+		ORDER BY nonce ASC, id ASC
+		LIMIT ?`, streamID.String(), afterNonce, afterID, eachPageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := make([]LiveBet, 0, eachPageSize)
+	for rows.Next() {
+		var b LiveBet
+		if err := rows.Scan(&b.ID, &b.StreamID, &b.AntebotBetID, &b.ReceivedAt, &b.DateTime, &b.Nonce,
+			&b.Amount, &b.Payout, &b.Difficulty, &b.RoundTarget, &b.RoundResult, &b.Game, &b.Details); err != nil {
+			return nil, err
+		}
+		page = append(page, b)
+	}
+	return page, rows.Err()
+}
+
+// EachRound calls fn for every round of a stream in nonce order. See
+// EachRoundPage.
+func (s *Store) EachRound(ctx context.Context, streamID uuid.UUID, fn func(LiveRound) error) error {
+	return s.EachRoundPage(ctx, streamID, func(page []LiveRound) error {
+		for _, r := range page {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// EachRoundPage calls fn with a stream's rounds in nonce order, a page at
+// a time, reading each page by its own keyset query like EachBetPage.
+func (s *Store) EachRoundPage(ctx context.Context, streamID uuid.UUID, fn func([]LiveRound) error) error {
+	afterNonce := int64(math.MinInt64)
+	for {
+		page, err := s.roundPage(ctx, streamID, afterNonce)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if len(page) < eachPageSize {
+			return nil
+		}
+		afterNonce = page[len(page)-1].Nonce
+	}
+}
+
+func (s *Store) roundPage(ctx context.Context, streamID uuid.UUID, afterNonce int64) ([]LiveRound, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, stream_id, nonce, round_result, received_at, source
+		FROM live_rounds WHERE stream_id=? AND nonce > ?
+		ORDER BY nonce ASC
+		LIMIT ?`, streamID.String(), afterNonce, eachPageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := make([]LiveRound, 0, eachPageSize)
+	for rows.Next() {
+		var r LiveRound
+		if err := rows.Scan(&r.ID, &r.StreamID, &r.Nonce, &r.RoundResult, &r.ReceivedAt, &r.Source); err != nil {
+			return nil, err
+		}
+		page = append(page, r)
+	}
+	return page, rows.Err()
+}
+
+// ImportStream finds the stream for ls's (hash, client) pair. If there is
+// none, it is created with ls's timestamps, notes and last observed nonce
+// and, when ls was closed, its state, end nonce and summary. An existing
+// stream takes ls's notes only if it has none. created reports whether
+// the stream is new.
+func (s *Store) ImportStream(ctx context.Context, ls LiveStream) (id uuid.UUID, created bool, err error) {
+	var idStr string
+	err = s.db.QueryRowContext(ctx,
+		`SELECT id FROM live_streams WHERE server_seed_hashed=? AND client_seed=?`,
+		ls.ServerSeedHashed, ls.ClientSeed).Scan(&idStr)
+	if err == nil {
+		if _, err := s.db.ExecContext(ctx,
+			`UPDATE live_streams SET notes=? WHERE id=? AND COALESCE(notes, '')=''`, ls.Notes, idStr); err != nil {
+			return uuid.Nil, false, err
+		}
+		return uuid.MustParse(idStr), false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, false, err
+	}
+
+	now := time.Now().UTC()
+	createdAt, lastSeen := ls.CreatedAt.UTC(), ls.LastSeenAt.UTC()
+	if ls.CreatedAt.IsZero() {
+		createdAt = now
+	}
+	if ls.LastSeenAt.IsZero() {
+		lastSeen = createdAt
+	}
+	var lastObservedAt any
+	if !ls.LastObservedAt.IsZero() {
+		lastObservedAt = ls.LastObservedAt.UTC()
+	}
+	// A closed stream keeps what was frozen when it closed
+	state := StreamActive
+	var closedAt, endNonce, summary any
+	if ls.State == StreamClosed || ls.State == StreamVerified {
+		state, endNonce = ls.State, ls.EndNonce
+		closedAt = lastSeen
+		if ls.ClosedAt != nil {
+			closedAt = ls.ClosedAt.UTC()
+		}
+		if ls.Summary != nil {
+			frozen, err := json.Marshal(ls.Summary)
+			if err != nil {
+				return uuid.Nil, false, err
+			}
+			summary = string(frozen)
+		}
+	}
+	id = uuid.New()
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO live_streams(id, server_seed_hashed, client_seed, created_at, last_seen_at, notes,
+			last_observed_nonce, last_observed_at, state, closed_at, end_nonce, summary)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id.String(), ls.ServerSeedHashed, ls.ClientSeed, createdAt, lastSeen, ls.Notes,
+		ls.LastObservedNonce, lastObservedAt, state, closedAt, endNonce, summary)
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	return id, true, nil
+}
+
+// ImportBets stores bets under a stream, keeping their received_at times.
+// Bets whose antebot bet id or nonce the stream already has are skipped.
+// Returns how many were added.
+func (s *Store) ImportBets(ctx context.Context, streamID uuid.UUID, bets []LiveBet) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT OR IGNORE INTO live_bets(
+			stream_id, antebot_bet_id, received_at, date_time, nonce,
+			amount, payout, difficulty, round_target, round_result, game, details
+		)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM live_bets WHERE stream_id=? AND nonce=?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	added := 0
+	for _, b := range bets {
+		// Archives from before bets had a game hold pump bets
+		defaultGame(&b)
+		res, err := stmt.ExecContext(ctx,
+			streamID.String(), b.AntebotBetID, b.ReceivedAt.UTC(), b.DateTime.UTC(), b.Nonce,
+			b.Amount, b.Payout, strings.ToLower(b.Difficulty), b.RoundTarget, b.RoundResult,
+			b.Game, b.Details, streamID.String(), b.Nonce)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added++
+		}
+	}
+	if added > 0 {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO live_stream_games(stream_id, game, first_seen, last_seen)
+			SELECT stream_id, game, MIN(received_at), MAX(received_at) FROM live_bets
+			WHERE stream_id=? GROUP BY game
+			ON CONFLICT(stream_id, game) DO UPDATE SET
+				first_seen=MIN(first_seen, excluded.first_seen),
+				last_seen=MAX(last_seen, excluded.last_seen)`, streamID.String()); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// ImportRounds stores rounds under a stream, skipping nonces it already
+// has. Returns how many were added.
+func (s *Store) ImportRounds(ctx context.Context, streamID uuid.UUID, rounds []LiveRound) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT OR IGNORE INTO live_rounds(stream_id, nonce, round_result, received_at, source)
+		VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	added := 0
+	for _, r := range rounds {
+		source := r.Source
+		if source != RoundComputed {
+			source = RoundObserved
+		}
+		res, err := stmt.ExecContext(ctx, streamID.String(), r.Nonce, r.RoundResult, r.ReceivedAt.UTC(), source)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added++
+		}
+	}
+	if added > 0 {
+		if err := s.rebuildSpans(ctx, tx, streamID); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// ImportRoundBlocks stores compacted blocks under a stream, keeping their
+// compaction times. A block is skipped if the stream already has a block
+// or a round in its range, since those nonces would be counted twice.
+// Import blocks before the rounds they kept. Returns how many were added.
+func (s *Store) ImportRoundBlocks(ctx context.Context, streamID uuid.UUID, blocks []RoundBlock) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	added := 0
+	for _, b := range blocks {
+		var taken int
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM live_round_blocks WHERE stream_id=? AND start_nonce <= ? AND end_nonce >= ?)
+				OR EXISTS(SELECT 1 FROM live_rounds WHERE stream_id=? AND nonce BETWEEN ? AND ?)`,
+			streamID.String(), b.EndNonce, b.StartNonce,
+			streamID.String(), b.StartNonce, b.EndNonce).Scan(&taken); err != nil {
+			return 0, err
+		}
+		if taken != 0 {
+			continue
+		}
+		hits, err := json.Marshal(b.Hits)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO live_round_blocks(stream_id, start_nonce, end_nonce, rounds, max_result, kept_above, hits_above, hits, compacted_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			streamID.String(), b.StartNonce, b.EndNonce, b.Rounds, b.MaxResult, b.KeptAbove, b.HitsAbove,
+			string(hits), b.CompactedAt.UTC()); err != nil {
+			return 0, err
+		}
+		added++
+	}
+	if added > 0 {
+		if err := s.rebuildSpans(ctx, tx, streamID); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// --------- Alerts ---------
+
+// AlertRule is a condition on live streams and what to do when it holds.
+// StreamID is empty for a rule on every stream. What Value and Target
+// mean depends on Kind; see package livealerts.
+type AlertRule struct {
+	ID              int64     `json:"id"`
+	Name            string    `json:"name"`
+	StreamID        string    `json:"stream_id"`
+	Kind            string    `json:"kind"`
+	Value           float64   `json:"value"`
+	Target          float64   `json:"target"`
+	Actions         []string  `json:"actions"` // "event", "notify", "webhook"
+	WebhookURL      string    `json:"webhook_url"`
+	CooldownSeconds int64     `json:"cooldown_seconds"`
+	Enabled         bool      `json:"enabled"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// AlertFiring records a rule holding on a stream.
+type AlertFiring struct {
+	ID       int64     `json:"id"`
+	RuleID   int64     `json:"rule_id"`
+	RuleName string    `json:"rule_name"`
+	StreamID uuid.UUID `json:"stream_id"`
+	Kind     string    `json:"kind"`
+	Nonce    int64     `json:"nonce"` // 0 for staleness
+	Value    float64   `json:"value"` // what crossed the rule: result, gap, streak, seconds...
+	Message  string    `json:"message"`
+	FiredAt  time.Time `json:"fired_at"`
+}
+
+const alertRuleColumns = `id, name, stream_id, kind, value, target, actions, webhook_url,
+	cooldown_seconds, enabled, created_at, updated_at`
+
+func scanAlertRule(row interface{ Scan(...any) error }) (AlertRule, error) {
+	var r AlertRule
+	var actions string
+	err := row.Scan(&r.ID, &r.Name, &r.StreamID, &r.Kind, &r.Value, &r.Target, &actions, &r.WebhookURL,
+		&r.CooldownSeconds, &r.Enabled, &r.CreatedAt, &r.UpdatedAt)
+	r.Actions = []string{}
+	if actions != "" {
+		r.Actions = strings.Split(actions, ",")
+	}
+	return r, err
+}
+
+// SaveAlertRule creates a rule when its ID is 0 and replaces it otherwise,
+// returning the stored rule. Replacing a missing rule is sql.ErrNoRows.
+func (s *Store) SaveAlertRule(ctx context.Context, r AlertRule) (AlertRule, error) {
+	now := time.Now().UTC()
+	actions := strings.Join(r.Actions, ",")
+	if r.ID == 0 {
+		res, err := s.db.ExecContext(ctx, `
+			INSERT INTO live_alert_rules(name, stream_id, kind, value, target, actions, webhook_url,
+				cooldown_seconds, enabled, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.Name, r.StreamID, r.Kind, r.Value, r.Target, actions, r.WebhookURL,
+			r.CooldownSeconds, r.Enabled, now, now)
+		if err != nil {
+			return AlertRule{}, err
+		}
+		if r.ID, err = res.LastInsertId(); err != nil {
+			return AlertRule{}, err
+		}
+	} else {
+		res, err := s.db.ExecContext(ctx, `
+			UPDATE live_alert_rules SET name=?, stream_id=?, kind=?, value=?, target=?, actions=?,
+				webhook_url=?, cooldown_seconds=?, enabled=?, updated_at=?
+			WHERE id=?`,
+			r.Name, r.StreamID, r.Kind, r.Value, r.Target, actions, r.WebhookURL,
+			r.CooldownSeconds, r.Enabled, now, r.ID)
+		if err != nil {
+			return AlertRule{}, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return AlertRule{}, sql.ErrNoRows
+		}
+	}
+	return s.GetAlertRule(ctx, r.ID)
+}
+
+// GetAlertRule returns a rule by id.
+func (s *Store) GetAlertRule(ctx context.Context, id int64) (AlertRule, error) {
+	return scanAlertRule(s.db.QueryRowContext(ctx,
+		`SELECT `+alertRuleColumns+` FROM live_alert_rules WHERE id=?`, id))
+}
+
+// ListAlertRules returns every rule, oldest first.
+func (s *Store) ListAlertRules(ctx context.Context) ([]AlertRule, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+alertRuleColumns+` FROM live_alert_rules ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []AlertRule{}
+	for rows.Next() {
+		r, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// DeleteAlertRule removes a rule and its firings.
+func (s *Store) DeleteAlertRule(ctx context.Context, id int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM live_alert_firings WHERE rule_id=?`, id); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM live_alert_rules WHERE id=?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// RecordAlertFiring stores a firing and returns its id.
+func (s *Store) RecordAlertFiring(ctx context.Context, f AlertFiring) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO live_alert_firings(rule_id, stream_id, nonce, value, message, fired_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		f.RuleID, f.StreamID.String(), f.Nonce, f.Value, f.Message, f.FiredAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ListAlertFirings returns the latest firings, newest first, optionally
+// only those of a rule (ruleID > 0) or a stream (streamID set).
+func (s *Store) ListAlertFirings(ctx context.Context, ruleID int64, streamID *uuid.UUID, limit int) ([]AlertFiring, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	where := "1=1"
+	var args []any
+	if ruleID > 0 {
+		where += " AND f.rule_id = ?"
+		args = append(args, ruleID)
+	}
+	if streamID != nil {
+		where += " AND f.stream_id = ?"
+		args = append(args, streamID.String())
+	}
+	args = append(args, limit)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT f.id, f.rule_id, COALESCE(r.name, ''), f.stream_id, COALESCE(r.kind, ''),
+		       f.nonce, f.value, f.message, f.fired_at
+		FROM live_alert_firings f
+		LEFT JOIN live_alert_rules r ON r.id = f.rule_id
+		WHERE `+where+`
+		ORDER BY f.fired_at DESC, f.id DESC
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []AlertFiring{}
+	for rows.Next() {
+		var f AlertFiring
+		if err := rows.Scan(&f.ID, &f.RuleID, &f.RuleName, &f.StreamID, &f.Kind,
+			&f.Nonce, &f.Value, &f.Message, &f.FiredAt); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// LastHitBefore returns the nonce of a stream's last round below nonce
+// with a result of at least threshold (0 if none), and its first round's
+// nonce (0 if it has no rounds). Alerts use them to pick up streaks.
+func (s *Store) LastHitBefore(ctx context.Context, streamID uuid.UUID, threshold float64, nonce int64) (lastHit, first int64, err error) {
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(CASE WHEN round_result >= ? THEN nonce END), 0), COALESCE(MIN(nonce), 0)
+		FROM live_rounds WHERE stream_id=? AND nonce < ?`,
+		threshold, streamID.String(), nonce).Scan(&lastHit, &first)
+	return lastHit, first, err
+}
+
+// --------- Retention ---------
+
+// DefaultBlockSize is the nonces per compacted block when a policy
+// doesn't set it
+const DefaultBlockSize = 10000
+
+// RetentionPolicy decides which of a stream's rounds are kept whole. A
+// round is kept if it's one of the last KeepLast rounds, was received at
+// or after KeepSince, or has a result of at least KeepAbove; the others
+// are compacted into per-block aggregates. A policy with neither KeepLast
+// nor KeepSince keeps everything. StreamID is empty for the global
+// policy, which applies to streams without their own.
+type RetentionPolicy struct {
+	StreamID  string     `json:"stream_id"`
+	KeepLast  int64      `json:"keep_last"`
+	KeepSince *time.Time `json:"keep_since,omitempty"`
+	KeepAbove float64    `json:"keep_above"` // 0 keeps no round for its result
+	BlockSize int64      `json:"block_size"` // nonces per block, aligned on nonce 1
+	Enabled   bool       `json:"enabled"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// BlockHit is a compacted round listed in its block
+type BlockHit struct {
+	Nonce  int64   `json:"nonce"`
+	Result float64 `json:"result"`
+}
+
+// RoundBlock aggregates the compacted rounds of a contiguous run of
+// covered nonces within one block. Rounds the policy kept stay in
+// live_rounds and aren't counted here. Compacted rounds of at least
+// HitsAbove are listed in Hits in nonce order, so hits of any tier from
+// HitsAbove up, and the gaps between them, survive compaction.
+type RoundBlock struct {
+	StreamID    uuid.UUID  `json:"stream_id"`
+	StartNonce  int64      `json:"start_nonce"`
+	EndNonce    int64      `json:"end_nonce"`
+	Rounds      int64      `json:"rounds"`
+	MaxResult   float64    `json:"max_result"`
+	KeptAbove   float64    `json:"kept_above"` // every round in range of at least this is still stored; 0 if none is sure to be
+	HitsAbove   float64    `json:"hits_above"` // every compacted round of at least this is in Hits; 0 if none is sure to be
+	Hits        []BlockHit `json:"hits"`
+	CompactedAt time.Time  `json:"compacted_at"`
+}
+
+// CompactOptions are what a compaction must preserve besides the policy
+type CompactOptions struct {
+	Tiers   []float64 // compacted rounds reaching the lowest are listed in their block
+	Protect int64     // rounds within this many nonces of the last one are kept
+	// Progress, if set, is called after each block with the nonces
+	// scanned so far and in all
+	Progress func(done, total int64)
+}
+
+// CompactResult sums up a compaction of one stream
+type CompactResult struct {
+	StreamID  uuid.UUID `json:"stream_id"`
+	Compacted int64     `json:"compacted"` // rounds folded into blocks
+	Blocks    int       `json:"blocks"`    // blocks created or extended
+}
+
+const retentionPolicyColumns = `stream_id, keep_last, keep_since, keep_above, block_size, enabled, updated_at`
+
+func scanRetentionPolicy(row interface{ Scan(...any) error }) (RetentionPolicy, error) {
+	var p RetentionPolicy
+	var since sql.NullTime
+	err := row.Scan(&p.StreamID, &p.KeepLast, &since, &p.KeepAbove, &p.BlockSize, &p.Enabled, &p.UpdatedAt)
+	if since.Valid {
+		p.KeepSince = &since.Time
+	}
+	return p, err
+}
+
+// PutRetentionPolicy creates or replaces the policy of p.StreamID and
+// returns it as stored.
+func (s *Store) PutRetentionPolicy(ctx context.Context, p RetentionPolicy) (RetentionPolicy, error) {
+	if p.BlockSize <= 0 {
+		p.BlockSize = DefaultBlockSize
+	}
+	var since any
+	if p.KeepSince != nil {
+		since = p.KeepSince.UTC()
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO live_retention_policies(`+retentionPolicyColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(stream_id) DO UPDATE SET keep_last=excluded.keep_last, keep_since=excluded.keep_since,
+			keep_above=excluded.keep_above, block_size=excluded.block_size, enabled=excluded.enabled,
+			updated_at=excluded.updated_at`,
+		p.StreamID, p.KeepLast, since, p.KeepAbove, p.BlockSize, p.Enabled, time.Now().UTC())
+	if err != nil {
+		return RetentionPolicy{}, err
+	}
+	return scanRetentionPolicy(s.db.QueryRowContext(ctx,
+		`SELECT `+retentionPolicyColumns+` FROM live_retention_policies WHERE stream_id=?`, p.StreamID))
+}
+
+// ListRetentionPolicies returns every policy, the global one first.
+func (s *Store) ListRetentionPolicies(ctx context.Context) ([]RetentionPolicy, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+retentionPolicyColumns+` FROM live_retention_policies ORDER BY stream_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []RetentionPolicy{}
+	for rows.Next() {
+		p, err := scanRetentionPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// DeleteRetentionPolicy removes a policy; streamID is empty for the
+// global one. A missing policy is sql.ErrNoRows.
+func (s *Store) DeleteRetentionPolicy(ctx context.Context, streamID string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM live_retention_policies WHERE stream_id=?`, streamID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RetentionPolicyFor returns the policy that applies to a stream: its
+// own, else the global one. ok is false when there is neither.
+func (s *Store) RetentionPolicyFor(ctx context.Context, streamID uuid.UUID) (p RetentionPolicy, ok bool, err error) {
+	p, err = scanRetentionPolicy(s.db.QueryRowContext(ctx, `
+		SELECT `+retentionPolicyColumns+` FROM live_retention_policies
+		WHERE stream_id IN (?, '') ORDER BY stream_id DESC LIMIT 1`, streamID.String()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return RetentionPolicy{}, false, nil
+	}
+	return p, err == nil, err
+}
+
+// StreamIDs returns the id of every stream.
+func (s *Store) StreamIDs(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM live_streams ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+// RoundBlocks returns a stream's compacted blocks in nonce order.
+func (s *Store) RoundBlocks(ctx context.Context, streamID uuid.UUID) ([]RoundBlock, error) {
+	return roundBlocks(ctx, s.db, streamID, 1, math.MaxInt64)
+}
+
+// roundBlocks returns the blocks of a stream overlapping [lo, hi]
+func roundBlocks(ctx context.Context, q dbtx, streamID uuid.UUID, lo, hi int64) ([]RoundBlock, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT stream_id, start_nonce, end_nonce, rounds, max_result, kept_above, hits_above, hits, compacted_at
+		FROM live_round_blocks
+		WHERE stream_id=? AND start_nonce <= ? AND end_nonce >= ?
+		ORDER BY start_nonce`, streamID.String(), hi, lo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []RoundBlock{}
+	for rows.Next() {
+		var b RoundBlock
+		var hits string
+		if err := rows.Scan(&b.StreamID, &b.StartNonce, &b.EndNonce, &b.Rounds, &b.MaxResult, &b.KeptAbove,
+			&b.HitsAbove, &hits, &b.CompactedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(hits), &b.Hits); err != nil {
+			return nil, fmt.Errorf("block %d of stream %s: %w", b.StartNonce, streamID, err)
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// CompactRounds folds the rounds of a stream that p doesn't keep into
+// per-block aggregates, one block of p.BlockSize nonces per transaction.
+// The nonces stay covered, so compacted rounds are neither reported
+// missing nor backfilled.
+func (s *Store) CompactRounds(ctx context.Context, streamID uuid.UUID, p RetentionPolicy, opt CompactOptions) (CompactResult, error) {
+	res := CompactResult{StreamID: streamID}
+	if p.KeepLast <= 0 && p.KeepSince == nil {
+		return res, nil
+	}
+	if p.BlockSize <= 0 {
+		p.BlockSize = DefaultBlockSize
+	}
+
+	// Rounds at or past cutoff are all kept
+	var first, last, rounds int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(MIN(nonce), 0), COALESCE(MAX(nonce), 0), COUNT(*)
+		FROM live_rounds WHERE stream_id=?`, streamID.String()).Scan(&first, &last, &rounds)
+	if err != nil || rounds == 0 {
+		return res, err
+	}
+	cutoff := last - max(opt.Protect, 0) + 1
+	if p.KeepLast > 0 {
+		if rounds <= p.KeepLast {
+			return res, nil
+		}
+		var nth int64
+		if err := s.db.QueryRowContext(ctx, `
+			SELECT nonce FROM live_rounds WHERE stream_id=?
+			ORDER BY nonce DESC LIMIT 1 OFFSET ?`, streamID.String(), p.KeepLast-1).Scan(&nth); err != nil {
+			return res, err
+		}
+		cutoff = min(cutoff, nth)
+	}
+	if cutoff <= first {
+		return res, nil
+	}
+
+	total := cutoff - first
+	for lo := (first-1)/p.BlockSize*p.BlockSize + 1; lo < cutoff; lo += p.BlockSize {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		hi := min(lo+p.BlockSize-1, cutoff-1)
+		n, blocks, err := s.compactBlock(ctx, streamID, p, opt.Tiers, max(lo, first), hi)
+		if err != nil {
+			return res, err
+		}
+		res.Compacted += n
+		res.Blocks += blocks
+		if opt.Progress != nil {
+			opt.Progress(hi-first+1, total)
+		}
+	}
+	return res, nil
+}
+
+// compactBlock compacts the rounds p doesn't keep in [lo, hi], which lies
+// within one block. Runs of covered nonces outside existing blocks
+// become new blocks; rounds inside one are folded into it. Compacted
+// rounds reaching the lowest tier are listed in their block.
+func (s *Store) compactBlock(ctx context.Context, streamID uuid.UUID, p RetentionPolicy, tiers []float64, lo, hi int64) (compacted int64, blocks int, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	existing, err := roundBlocks(ctx, tx, streamID, lo, hi)
+	if err != nil {
+		return 0, 0, err
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, nonce, round_result, received_at FROM live_rounds
+		WHERE stream_id=? AND nonce BETWEEN ? AND ? ORDER BY nonce`, streamID.String(), lo, hi)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	now := time.Now().UTC()
+	keptAbove := max(p.KeepAbove, 0)
+	hitsAbove := 0.0
+	for i, t := range tiers {
+		if i == 0 || t < hitsAbove {
+			hitsAbove = t
+		}
+	}
+	hitsAbove = max(hitsAbove, 0)
+	newBlock := func(nonce int64) *RoundBlock {
+		return &RoundBlock{StreamID: streamID, StartNonce: nonce, EndNonce: nonce, KeptAbove: keptAbove,
+			HitsAbove: hitsAbove, Hits: []BlockHit{}, CompactedAt: now}
+	}
+
+	var (
+		ids     []int64
+		created []*RoundBlock
+		touched = map[int]bool{}
+		run     *RoundBlock // the new block being extended
+	)
+	for rows.Next() {
+		var (
+			id, nonce int64
+			result    float64
+			received  time.Time
+		)
+		if err := rows.Scan(&id, &nonce, &result, &received); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		keep := (p.KeepSince != nil && !received.Before(*p.KeepSince)) ||
+			(p.KeepAbove > 0 && result >= p.KeepAbove)
+
+		in := -1
+		for i := range existing {
+			if existing[i].StartNonce <= nonce && nonce <= existing[i].EndNonce {
+				in = i
+				break
+			}
+		}
+		var b *RoundBlock
+		switch {
+		case in >= 0:
+			run = nil
+			if keep {
+				continue
+			}
+			b = &existing[in]
+			if !touched[in] {
+				touched[in] = true
+				b.KeptAbove = mergeAbove(b.KeptAbove, keptAbove)
+				b.HitsAbove = mergeAbove(b.HitsAbove, hitsAbove)
+			}
+		case run != nil && nonce == run.EndNonce+1:
+			run.EndNonce = nonce
+			b = run
+		default:
+			run = newBlock(nonce)
+			created = append(created, run)
+			b = run
+		}
+		if keep {
+			continue
+		}
+		ids = append(ids, id)
+		b.Rounds++
+		b.MaxResult = max(b.MaxResult, result)
+		if hitsAbove > 0 && result >= hitsAbove {
+			b.Hits = append(b.Hits, BlockHit{Nonce: nonce, Result: result})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	if len(ids) == 0 {
+		return 0, 0, nil
+	}
+
+	del, err := tx.PrepareContext(ctx, `DELETE FROM live_rounds WHERE id=?`)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer del.Close()
+	for _, id := range ids {
+		if _, err := del.ExecContext(ctx, id); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	for _, b := range created {
+		// A run of rounds all kept needs no block
+		if b.Rounds == 0 {
+			continue
+		}
+		hits, err := json.Marshal(b.Hits)
+		if err != nil {
+			return 0, 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO live_round_blocks(stream_id, start_nonce, end_nonce, rounds, max_result, kept_above, hits_above, hits, compacted_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			streamID.String(), b.StartNonce, b.EndNonce, b.Rounds, b.MaxResult, b.KeptAbove, b.HitsAbove, string(hits), now); err != nil {
+			return 0, 0, err
+		}
+		blocks++
+	}
+	for i := range touched {
+		b := existing[i]
+		b.Hits = mergeHits(b.Hits, b.HitsAbove)
+		hits, err := json.Marshal(b.Hits)
+		if err != nil {
+			return 0, 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE live_round_blocks SET rounds=?, max_result=?, kept_above=?, hits_above=?, hits=?, compacted_at=?
+			WHERE stream_id=? AND start_nonce=?`,
+			b.Rounds, b.MaxResult, b.KeptAbove, b.HitsAbove, string(hits), now, streamID.String(), b.StartNonce); err != nil {
+			return 0, 0, err
+		}
+		blocks++
+	}
+	return int64(len(ids)), blocks, tx.Commit()
+}
+
+// mergeAbove is what a block can promise about the rounds of at least
+// a threshold once compacted under two
+func mergeAbove(a, b float64) float64 {
+	if a <= 0 || b <= 0 {
+		return 0
+	}
+	return max(a, b)
+}
+
+// mergeHits puts a block's listed hits back in nonce order after rounds
+// were folded into it, dropping those below what it now promises.
+func mergeHits(hits []BlockHit, above float64) []BlockHit {
+	out := hits[:0]
+	for _, h := range hits {
+		if above > 0 && h.Result >= above {
+			out = append(out, h)
+		}
+	}
+	slices.SortFunc(out, func(a, b BlockHit) int { return cmp.Compare(a.Nonce, b.Nonce) })
+	return out
+}
+
+// Vacuum rebuilds the database file to give back the space of deleted
+// rows, then checkpoints and truncates the write-ahead log if there is
+// one.
+func (s *Store) Vacuum(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `VACUUM`); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
+
+// --------- Nonce coverage ---------
+
+// NonceRange is an inclusive range of nonces
+type NonceRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// Coverage describes which nonces of a stream have rounds. Missing lists
+// the holes from the first stored round up to the last observed nonce,
+// which bets also advance.
+type Coverage struct {
+	FirstNonce        int64        `json:"first_nonce"`
+	LastNonce         int64        `json:"last_nonce"`
+	LastObservedNonce int64        `json:"last_observed_nonce"`
+	Rounds            int64        `json:"rounds"`
+	Computed          int64        `json:"computed"`
+	Compacted         int64        `json:"compacted"` // rounds folded into blocks, counted in Rounds
+	MissingRounds     int64        `json:"missing_rounds"`
+	Missing           []NonceRange `json:"missing"`
+	Truncated         bool         `json:"truncated"` // Missing was cut at the limit
+}
+
+// GetCoverage returns a stream's nonce coverage with at most limit missing
+// ranges, oldest first; limit <= 0 returns them all.
+func (s *Store) GetCoverage(ctx context.Context, streamID uuid.UUID, limit int) (Coverage, error) {
+	var c Coverage
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(last_observed_nonce, 0),
+		       (SELECT COUNT(*) FROM live_rounds WHERE stream_id=? AND source=?),
+		       (SELECT COALESCE(SUM(rounds), 0) FROM live_round_blocks WHERE stream_id=?)
+		FROM live_streams WHERE id=?`,
+		streamID.String(), RoundComputed, streamID.String(), streamID.String()).Scan(&c.LastObservedNonce, &c.Computed, &c.Compacted)
+	if err != nil {
+		return c, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT start_nonce, end_nonce FROM live_round_spans
+		WHERE stream_id=? ORDER BY start_nonce`, streamID.String())
+	if err != nil {
+		return c, err
+	}
+	defer rows.Close()
+
+	c.Missing = []NonceRange{}
+	addMissing := func(r NonceRange) {
+		c.MissingRounds += r.End - r.Start + 1
+		if limit > 0 && len(c.Missing) >= limit {
+			c.Truncated = true
+			return
+		}
+		c.Missing = append(c.Missing, r)
+	}
+	first := true
+	for rows.Next() {
+		var span NonceRange
+		if err := rows.Scan(&span.Start, &span.End); err != nil {
+			return c, err
+		}
+		if first {
+			c.FirstNonce = span.Start
+			first = false
+		} else {
+			addMissing(NonceRange{Start: c.LastNonce + 1, End: span.Start - 1})
+		}
+		c.LastNonce = span.End
+		c.Rounds += span.End - span.Start + 1
+	}
+	if err := rows.Err(); err != nil {
+		return c, err
+	}
+	if !first && c.LastObservedNonce > c.LastNonce {
+		addMissing(NonceRange{Start: c.LastNonce + 1, End: c.LastObservedNonce})
+	}
+	return c, nil
+}
+
+// LatestBet returns a stream's bet with the highest nonce, and false when
+// it has no bets.
+func (s *Store) LatestBet(ctx context.Context, streamID uuid.UUID) (LiveBet, bool, error) {
+	return s.oneBet(ctx, `stream_id=? ORDER BY nonce DESC, id DESC`, streamID.String())
+}
+
+// BetBefore returns a stream's bet with the highest nonce below nonce, and
+// false when there is none.
+func (s *Store) BetBefore(ctx context.Context, streamID uuid.UUID, nonce int64) (LiveBet, bool, error) {
+	return s.oneBet(ctx, `stream_id=? AND nonce < ? ORDER BY nonce DESC, id DESC`, streamID.String(), nonce)
+}
+
+// BetAfter returns a stream's bet with the lowest nonce above nonce, and
+// false when there is none.
+func (s *Store) BetAfter(ctx context.Context, streamID uuid.UUID, nonce int64) (LiveBet, bool, error) {
+	return s.oneBet(ctx, `stream_id=? AND nonce > ? ORDER BY nonce, id`, streamID.String(), nonce)
+}
+
+// oneBet returns the first bet matching where, which also orders them
+func (s *Store) oneBet(ctx context.Context, where string, args ...any) (LiveBet, bool, error) {
+	var b LiveBet
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, stream_id, antebot_bet_id, received_at, date_time, nonce, amount, payout, difficulty, round_target, round_result, game, details
+		FROM live_bets WHERE `+where+` LIMIT 1`, args...).Scan(&b.ID, &b.StreamID, &b.AntebotBetID,
+		&b.ReceivedAt, &b.DateTime, &b.Nonce, &b.Amount, &b.Payout, &b.Difficulty, &b.RoundTarget, &b.RoundResult,
+		&b.Game, &b.Details)
+	if errors.Is(err, sql.ErrNoRows) {
+		return b, false, nil
+	}
+	return b, err == nil, err
+}
+
+// coverRange merges [start, end] into a stream's spans, joining the spans
+// it overlaps or touches.
+func coverRange(ctx context.Context, tx dbtx, streamID uuid.UUID, start, end int64) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT start_nonce, end_nonce FROM live_round_spans
+		WHERE stream_id=? AND start_nonce <= ? AND end_nonce >= ?`,
+		streamID.String(), end+1, start-1)
+	if err != nil {
+		return err
+	}
+	lo, hi, n := start, end, 0
+	for rows.Next() {
+		var a, b int64
+		if err := rows.Scan(&a, &b); err != nil {
+			rows.Close()
+			return err
+		}
+		if n == 0 && a <= start && b >= end {
+			// Already covered; only the first match can cover it whole
+			// since spans never touch
+			n = -1
+			break
+		}
+		lo, hi = min(lo, a), max(hi, b)
+		n++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || n < 0 {
+		return err
+	}
+
+	if n > 0 {
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM live_round_spans
+			WHERE stream_id=? AND start_nonce <= ? AND end_nonce >= ?`,
+			streamID.String(), end+1, start-1); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO live_round_spans(stream_id, start_nonce, end_nonce) VALUES (?, ?, ?)`,
+		streamID.String(), lo, hi)
+	return err
+}
+
+// rebuildSpans recomputes a stream's spans from its rounds and compacted
+// blocks, after rounds were added or removed in bulk
+func (s *Store) rebuildSpans(ctx context.Context, db dbtx, streamID uuid.UUID) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT MIN(nonce), MAX(nonce) FROM (
+			SELECT nonce, nonce - ROW_NUMBER() OVER (ORDER BY nonce) AS island
+			FROM live_rounds WHERE stream_id=?
+		) GROUP BY island
+		UNION ALL
+		SELECT start_nonce, end_nonce FROM live_round_blocks WHERE stream_id=?
+		ORDER BY 1`, streamID.String(), streamID.String())
+	if err != nil {
+		return err
+	}
+	var spans []NonceRange
+	for rows.Next() {
+		var r NonceRange
+		if err := rows.Scan(&r.Start, &r.End); err != nil {
+			rows.Close()
+			return err
+		}
+		// Blocks overlap the islands of the rounds they kept
+		if n := len(spans); n > 0 && r.Start <= spans[n-1].End+1 {
+			spans[n-1].End = max(spans[n-1].End, r.End)
+			continue
+		}
+		spans = append(spans, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, `DELETE FROM live_round_spans WHERE stream_id=?`, streamID.String()); err != nil {
+		return err
+	}
+	for _, r := range spans {
+		if _, err := db.ExecContext(ctx,
+			`INSERT INTO live_round_spans(stream_id, start_nonce, end_nonce) VALUES (?, ?, ?)`,
+			streamID.String(), r.Start, r.End); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --------- helpers ---------
+
+// dbtx is a *sql.DB or *sql.Tx
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
 
 func isConstraintErr(err error) bool {
 	// modernc sqlite returns errors with messages containing "constraint failed"
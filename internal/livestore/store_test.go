@@ -0,0 +1,624 @@
+package livestore
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	st, err := New(filepath.Join(t.TempDir(), "live.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func testBets(n int, start int64) []LiveBet {
+	now := time.Now().UTC()
+	bets := make([]LiveBet, n)
+	for i := range bets {
+		nonce := start + int64(i)
+		bets[i] = LiveBet{
+			AntebotBetID: fmt.Sprintf("bet-%d", nonce),
+			ReceivedAt:   now,
+			DateTime:     now,
+			Nonce:        nonce,
+			Amount:       1,
+			Difficulty:   "easy",
+			RoundTarget:  2,
+			RoundResult:  float64(nonce%7) + 1,
+		}
+	}
+	return bets
+}
+
+func TestEachBetPagesReleaseConnection(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+	id, err := st.FindOrCreateStream(ctx, "hash", "client")
+	if err != nil {
+		t.Fatalf("FindOrCreateStream: %v", err)
+	}
+	n := eachPageSize*2 + 17
+	if _, err := st.ImportBets(ctx, id, testBets(n, 1)); err != nil {
+		t.Fatalf("ImportBets: %v", err)
+	}
+
+	// The store has a single connection, so querying it from fn would
+	// block if EachBet still held its rows open.
+	qctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var seen []int64
+	err = st.EachBet(qctx, id, func(b LiveBet) error {
+		seen = append(seen, b.Nonce)
+		if len(seen)%eachPageSize == 1 {
+			if _, err := st.GetStream(qctx, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EachBet: %v", err)
+	}
+	if len(seen) != n {
+		t.Fatalf("expected %d bets, got %d", n, len(seen))
+	}
+	for i, nonce := range seen {
+		if nonce != int64(i+1) {
+			t.Fatalf("bet %d: expected nonce %d, got %d", i, i+1, nonce)
+		}
+	}
+
+	var rounds int
+	if err := st.EachRound(qctx, uuid.New(), func(LiveRound) error { rounds++; return nil }); err != nil || rounds != 0 {
+		t.Fatalf("expected no rounds for an unknown stream, got %d, %v", rounds, err)
+	}
+}
+
+func TestCoverageMissingRangesAndComputedRounds(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+	id, err := st.FindOrCreateStream(ctx, "hash", "client")
+	if err != nil {
+		t.Fatalf("FindOrCreateStream: %v", err)
+	}
+	for _, nonce := range []int64{1, 2, 3, 7, 10, 11} {
+		if _, err := st.InsertRound(ctx, id, nonce, float64(nonce)); err != nil {
+			t.Fatalf("InsertRound %d: %v", nonce, err)
+		}
+	}
+	if err := st.UpdateLastObservedNonce(ctx, id, 15); err != nil {
+		t.Fatalf("UpdateLastObservedNonce: %v", err)
+	}
+
+	cov, err := st.GetCoverage(ctx, id, 0)
+	if err != nil {
+		t.Fatalf("GetCoverage: %v", err)
+	}
+	want := []NonceRange{{4, 6}, {8, 9}, {12, 15}}
+	if !equalRanges(cov.Missing, want) || cov.MissingRounds != 9 || cov.Rounds != 6 || cov.FirstNonce != 1 || cov.LastNonce != 11 {
+		t.Fatalf("unexpected coverage: %+v", cov)
+	}
+	if cut, _ := st.GetCoverage(ctx, id, 2); !cut.Truncated || len(cut.Missing) != 2 || cut.MissingRounds != 9 {
+		t.Fatalf("expected truncated coverage with the full missing count, got %+v", cut)
+	}
+	if ls, _ := st.GetStream(ctx, id); !ls.Incomplete || ls.MissingRounds != 9 {
+		t.Fatalf("expected an incomplete stream missing 9 rounds, got %+v", ls)
+	}
+
+	// Backfill two of the holes; nonce 3 is already observed and kept
+	computed := []LiveRound{{Nonce: 3, RoundResult: 99}, {Nonce: 4, RoundResult: 40}, {Nonce: 5, RoundResult: 50},
+		{Nonce: 6, RoundResult: 60}, {Nonce: 12, RoundResult: 120}, {Nonce: 13, RoundResult: 130}}
+	added, err := st.InsertComputedRounds(ctx, id, computed)
+	if err != nil {
+		t.Fatalf("InsertComputedRounds: %v", err)
+	}
+	if added != 5 {
+		t.Fatalf("expected 5 computed rounds added, got %d", added)
+	}
+
+	cov, _ = st.GetCoverage(ctx, id, 0)
+	want = []NonceRange{{8, 9}, {14, 15}}
+	if !equalRanges(cov.Missing, want) || cov.MissingRounds != 4 || cov.Computed != 5 {
+		t.Fatalf("unexpected coverage after backfill: %+v", cov)
+	}
+
+	rounds := map[int64]LiveRound{}
+	if err := st.EachRound(ctx, id, func(r LiveRound) error { rounds[r.Nonce] = r; return nil }); err != nil {
+		t.Fatalf("EachRound: %v", err)
+	}
+	if r := rounds[3]; r.Source != RoundObserved || r.RoundResult != 3 {
+		t.Errorf("observed round 3 was overwritten: %+v", r)
+	}
+	for _, c := range computed[1:] {
+		if r := rounds[c.Nonce]; r.Source != RoundComputed || r.RoundResult != c.RoundResult {
+			t.Errorf("nonce %d: expected computed round %v, got %+v", c.Nonce, c.RoundResult, r)
+		}
+	}
+
+	// An observed round replaces a computed one
+	if _, err := st.InsertRound(ctx, id, 4, 41); err != nil {
+		t.Fatalf("InsertRound: %v", err)
+	}
+	if cov, _ = st.GetCoverage(ctx, id, 0); cov.Computed != 4 {
+		t.Errorf("expected 4 computed rounds after an observation, got %d", cov.Computed)
+	}
+}
+
+func equalRanges(a, b []NonceRange) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// importTestRounds stores rounds 1..n received a minute apart from base,
+// with the results in hits and 1 otherwise
+func importTestRounds(t *testing.T, st *Store, id uuid.UUID, n int64, base time.Time, hits map[int64]float64) {
+	t.Helper()
+	rounds := make([]LiveRound, 0, n)
+	for nonce := int64(1); nonce <= n; nonce++ {
+		r := LiveRound{Nonce: nonce, RoundResult: 1, ReceivedAt: base.Add(time.Duration(nonce) * time.Minute)}
+		if v, ok := hits[nonce]; ok {
+			r.RoundResult = v
+		}
+		rounds = append(rounds, r)
+	}
+	if _, err := st.ImportRounds(context.Background(), id, rounds); err != nil {
+		t.Fatalf("ImportRounds: %v", err)
+	}
+}
+
+func storedNonces(t *testing.T, st *Store, id uuid.UUID) []int64 {
+	t.Helper()
+	var out []int64
+	if err := st.EachRound(context.Background(), id, func(r LiveRound) error {
+		out = append(out, r.Nonce)
+		return nil
+	}); err != nil {
+		t.Fatalf("EachRound: %v", err)
+	}
+	return out
+}
+
+func nonceRun(lo, hi int64) []int64 {
+	var out []int64
+	for n := lo; n <= hi; n++ {
+		out = append(out, n)
+	}
+	return out
+}
+
+func TestCompactKeepLast(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+	id, _ := st.FindOrCreateStream(ctx, "hash", "client")
+	hits := map[int64]float64{10: 10, 20: 10, 30: 10, 40: 10, 50: 10, 60: 10, 70: 10, 80: 10}
+	importTestRounds(t, st, id, 100, time.Now().Add(-time.Hour), hits)
+
+	p := RetentionPolicy{KeepLast: 30, BlockSize: 40}
+	res, err := st.CompactRounds(ctx, id, p, CompactOptions{Tiers: []float64{50, 5}})
+	if err != nil {
+		t.Fatalf("CompactRounds: %v", err)
+	}
+	if res.Compacted != 70 || res.Blocks != 2 {
+		t.Fatalf("expected 70 rounds in 2 blocks, got %+v", res)
+	}
+	if got := storedNonces(t, st, id); !slices.Equal(got, nonceRun(71, 100)) {
+		t.Fatalf("expected the last 30 rounds kept, got %v", got)
+	}
+
+	blocks, err := st.RoundBlocks(ctx, id)
+	if err != nil {
+		t.Fatalf("RoundBlocks: %v", err)
+	}
+	want := []RoundBlock{
+		{StartNonce: 1, EndNonce: 40, Rounds: 40, MaxResult: 10, HitsAbove: 5,
+			Hits: []BlockHit{{10, 10}, {20, 10}, {30, 10}, {40, 10}}},
+		{StartNonce: 41, EndNonce: 70, Rounds: 30, MaxResult: 10, HitsAbove: 5,
+			Hits: []BlockHit{{50, 10}, {60, 10}, {70, 10}}},
+	}
+	checkBlocks(t, blocks, want)
+
+	// Compacted nonces stay covered
+	if cov, _ := st.GetCoverage(ctx, id, 0); cov.MissingRounds != 0 {
+		t.Fatalf("expected no missing rounds after compaction, got %+v", cov)
+	}
+	if res, _ := st.CompactRounds(ctx, id, p, CompactOptions{Tiers: []float64{5}}); res.Compacted != 0 {
+		t.Fatalf("expected a second compaction to do nothing, got %+v", res)
+	}
+}
+
+func TestCompactKeepSince(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+	id, _ := st.FindOrCreateStream(ctx, "hash", "client")
+	base := time.Now().Add(-2 * time.Hour)
+	importTestRounds(t, st, id, 50, base, map[int64]float64{12: 8, 40: 9})
+
+	since := base.Add(31 * time.Minute)
+	res, err := st.CompactRounds(ctx, id, RetentionPolicy{KeepSince: &since}, CompactOptions{Tiers: []float64{5}})
+	if err != nil {
+		t.Fatalf("CompactRounds: %v", err)
+	}
+	if res.Compacted != 30 {
+		t.Fatalf("expected 30 rounds compacted, got %+v", res)
+	}
+	if got := storedNonces(t, st, id); !slices.Equal(got, nonceRun(31, 50)) {
+		t.Fatalf("expected rounds received since the cutoff kept, got %v", got)
+	}
+	blocks, _ := st.RoundBlocks(ctx, id)
+	checkBlocks(t, blocks, []RoundBlock{
+		{StartNonce: 1, EndNonce: 50, Rounds: 30, MaxResult: 8, HitsAbove: 5, Hits: []BlockHit{{12, 8}}},
+	})
+
+	// Protected rounds near the end stay whatever the policy
+	st2 := newTestStore(t)
+	id2, _ := st2.FindOrCreateStream(ctx, "hash", "client")
+	importTestRounds(t, st2, id2, 50, base, nil)
+	late := base.Add(time.Hour)
+	if _, err := st2.CompactRounds(ctx, id2, RetentionPolicy{KeepSince: &late}, CompactOptions{Protect: 15}); err != nil {
+		t.Fatalf("CompactRounds: %v", err)
+	}
+	if got := storedNonces(t, st2, id2); !slices.Equal(got, nonceRun(36, 50)) {
+		t.Fatalf("expected the protected rounds kept, got %v", got)
+	}
+}
+
+func TestCompactKeepAbove(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+	id, _ := st.FindOrCreateStream(ctx, "hash", "client")
+	importTestRounds(t, st, id, 60, time.Now().Add(-time.Hour), map[int64]float64{15: 20, 25: 7, 45: 30})
+
+	p := RetentionPolicy{KeepLast: 10, KeepAbove: 10}
+	if _, err := st.CompactRounds(ctx, id, p, CompactOptions{Tiers: []float64{5, 25}}); err != nil {
+		t.Fatalf("CompactRounds: %v", err)
+	}
+	want := append([]int64{15, 45}, nonceRun(51, 60)...)
+	if got := storedNonces(t, st, id); !slices.Equal(got, want) {
+		t.Fatalf("expected rounds of 10x and over and the last 10 kept, got %v", got)
+	}
+	blocks, _ := st.RoundBlocks(ctx, id)
+	checkBlocks(t, blocks, []RoundBlock{
+		{StartNonce: 1, EndNonce: 50, Rounds: 48, MaxResult: 7, KeptAbove: 10, HitsAbove: 5, Hits: []BlockHit{{25, 7}}},
+	})
+}
+
+func TestCompactMergesIntoExistingBlock(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+	id, _ := st.FindOrCreateStream(ctx, "hash", "client")
+	base := time.Now().Add(-2 * time.Hour)
+	hits := map[int64]float64{5: 6, 10: 10, 20: 10, 30: 10, 35: 6, 40: 10, 50: 10}
+	importTestRounds(t, st, id, 60, base, hits)
+
+	// Rounds received from nonce 21 on are kept at first, inside the block
+	since := base.Add(21 * time.Minute)
+	first, err := st.CompactRounds(ctx, id, RetentionPolicy{KeepLast: 10, KeepSince: &since, KeepAbove: 100},
+		CompactOptions{Tiers: []float64{5}})
+	if err != nil {
+		t.Fatalf("CompactRounds: %v", err)
+	}
+	if first.Compacted != 20 {
+		t.Fatalf("expected 20 rounds compacted, got %+v", first)
+	}
+	blocks, _ := st.RoundBlocks(ctx, id)
+	checkBlocks(t, blocks, []RoundBlock{
+		{StartNonce: 1, EndNonce: 50, Rounds: 20, MaxResult: 10, KeptAbove: 100, HitsAbove: 5,
+			Hits: []BlockHit{{5, 6}, {10, 10}, {20, 10}}},
+	})
+
+	// A later policy folds them in; the block lists what both tier sets
+	// agree on and keeps no promise about rounds it no longer has
+	second, err := st.CompactRounds(ctx, id, RetentionPolicy{KeepLast: 10}, CompactOptions{Tiers: []float64{8}})
+	if err != nil {
+		t.Fatalf("CompactRounds: %v", err)
+	}
+	if second.Compacted != 30 || second.Blocks != 1 {
+		t.Fatalf("expected 30 rounds folded into 1 block, got %+v", second)
+	}
+	if got := storedNonces(t, st, id); !slices.Equal(got, nonceRun(51, 60)) {
+		t.Fatalf("expected the last 10 rounds kept, got %v", got)
+	}
+	blocks, _ = st.RoundBlocks(ctx, id)
+	checkBlocks(t, blocks, []RoundBlock{
+		{StartNonce: 1, EndNonce: 50, Rounds: 50, MaxResult: 10, HitsAbove: 8,
+			Hits: []BlockHit{{10, 10}, {20, 10}, {30, 10}, {40, 10}, {50, 10}}},
+	})
+}
+
+func TestImportRoundBlocks(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+	src, _ := st.FindOrCreateStream(ctx, "hash", "client")
+	importTestRounds(t, st, src, 60, time.Now().Add(-time.Hour), map[int64]float64{10: 10, 20: 10})
+	if _, err := st.CompactRounds(ctx, src, RetentionPolicy{KeepLast: 20, BlockSize: 20}, CompactOptions{Tiers: []float64{5}}); err != nil {
+		t.Fatalf("CompactRounds: %v", err)
+	}
+	blocks, _ := st.RoundBlocks(ctx, src)
+
+	// The copy already has a round inside the second block
+	dst, _ := st.FindOrCreateStream(ctx, "hash", "other")
+	if _, err := st.ImportRounds(ctx, dst, []LiveRound{{Nonce: 30, RoundResult: 1}}); err != nil {
+		t.Fatalf("ImportRounds: %v", err)
+	}
+	added, err := st.ImportRoundBlocks(ctx, dst, blocks)
+	if err != nil || added != 1 {
+		t.Fatalf("ImportRoundBlocks = %d, %v", added, err)
+	}
+	got, _ := st.RoundBlocks(ctx, dst)
+	checkBlocks(t, got, blocks[:1])
+	if !got[0].CompactedAt.Equal(blocks[0].CompactedAt) {
+		t.Errorf("expected the compaction time kept, got %v", got[0].CompactedAt)
+	}
+	if added, _ := st.ImportRoundBlocks(ctx, dst, blocks); added != 0 {
+		t.Errorf("expected a second import to add nothing, got %d", added)
+	}
+	if cov, _ := st.GetCoverage(ctx, dst, 0); cov.MissingRounds != 9 {
+		t.Errorf("expected nonces 21-29 missing, got %+v", cov)
+	}
+}
+
+func checkBlocks(t *testing.T, got, want []RoundBlock) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d blocks, got %+v", len(want), got)
+	}
+	for i, b := range got {
+		w := want[i]
+		if b.StartNonce != w.StartNonce || b.EndNonce != w.EndNonce || b.Rounds != w.Rounds ||
+			b.MaxResult != w.MaxResult || b.KeptAbove != w.KeptAbove || b.HitsAbove != w.HitsAbove ||
+			!slices.Equal(b.Hits, w.Hits) {
+			t.Errorf("block %d: expected %+v, got %+v", i, w, b)
+		}
+	}
+}
+
+func TestNewSeedPairClosesPreviousStream(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	first, err := st.OpenStream(ctx, "hash-1", "client", "bot-a")
+	if err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	if !first.Created || len(first.Closed) != 0 {
+		t.Fatalf("expected a new stream closing nothing, got %+v", first)
+	}
+	bets := testBets(5, 1)
+	for i := range bets {
+		bets[i].Payout = float64(i)
+		if _, err := st.IngestBet(ctx, first.ID, bets[i]); err != nil {
+			t.Fatalf("IngestBet: %v", err)
+		}
+	}
+	for nonce := int64(1); nonce <= 8; nonce++ {
+		if _, err := st.InsertRound(ctx, first.ID, nonce, float64(nonce)); err != nil {
+			t.Fatalf("InsertRound: %v", err)
+		}
+	}
+	if err := st.UpdateLastObservedNonce(ctx, first.ID, 10); err != nil {
+		t.Fatalf("UpdateLastObservedNonce: %v", err)
+	}
+
+	// Seeing the same pair again is not a rotation
+	again, err := st.OpenStream(ctx, "hash-1", "client", "bot-a")
+	if err != nil || again.ID != first.ID || again.Created || len(again.Closed) != 0 {
+		t.Fatalf("expected the same stream back, got %+v, %v", again, err)
+	}
+
+	// Another ingest client's new pair leaves it open
+	other, err := st.OpenStream(ctx, "hash-other", "client", "bot-b")
+	if err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	if len(other.Closed) != 0 {
+		t.Fatalf("expected another client's stream to close nothing, got %+v", other)
+	}
+	if ls, _ := st.GetStream(ctx, other.ID); ls.PredecessorID != nil {
+		t.Fatalf("expected no predecessor across clients, got %v", ls.PredecessorID)
+	}
+	if ls, _ := st.GetStream(ctx, first.ID); ls.State != StreamActive {
+		t.Fatalf("expected the first stream still active, got %q", ls.State)
+	}
+
+	second, err := st.OpenStream(ctx, "hash-2", "client", "bot-a")
+	if err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	if !second.Created || !slices.Equal(second.Closed, []uuid.UUID{first.ID}) {
+		t.Fatalf("expected the new pair to close the first stream only, got %+v", second)
+	}
+
+	closed, err := st.GetStream(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("GetStream: %v", err)
+	}
+	if closed.State != StreamClosed || closed.ClosedAt == nil || closed.EndNonce != 10 {
+		t.Fatalf("expected the first stream closed at nonce 10, got %+v", closed)
+	}
+	want := StreamSummary{Bets: 5, Wagered: 5, Payout: 10, HighestResult: 6, FirstNonce: 1, Rounds: 8,
+		MissingRounds: 2, Games: []string{DefaultGame}}
+	if closed.Summary == nil || !reflect.DeepEqual(*closed.Summary, want) {
+		t.Fatalf("expected summary %+v, got %+v", want, closed.Summary)
+	}
+	if closed.SuccessorID == nil || *closed.SuccessorID != second.ID {
+		t.Fatalf("expected the second stream as successor, got %v", closed.SuccessorID)
+	}
+	next, _ := st.GetStream(ctx, second.ID)
+	if next.PredecessorID == nil || *next.PredecessorID != first.ID || next.IngestClient != "bot-a" {
+		t.Fatalf("expected the first stream as predecessor, got %+v", next)
+	}
+
+	// A late bet still lands on the closed stream, which stays closed with
+	// its summary and end nonce refrozen
+	lateOpen, err := st.OpenStream(ctx, "hash-1", "client", "bot-a")
+	if err != nil || lateOpen.ID != first.ID || lateOpen.Created || !lateOpen.Frozen || len(lateOpen.Closed) != 0 {
+		t.Fatalf("expected the closed stream back, flagged frozen, got %+v, %v", lateOpen, err)
+	}
+	late := testBets(1, 11)[0]
+	late.Amount = 1000
+	if _, err := st.IngestBet(ctx, first.ID, late); err != nil {
+		t.Fatalf("IngestBet: %v", err)
+	}
+	if err := st.UpdateLastObservedNonce(ctx, first.ID, 11); err != nil {
+		t.Fatalf("UpdateLastObservedNonce: %v", err)
+	}
+	if err := st.RefreezeStream(ctx, first.ID); err != nil {
+		t.Fatalf("RefreezeStream: %v", err)
+	}
+	refrozen, _ := st.GetStream(ctx, first.ID)
+	want.Bets, want.Wagered, want.HighestResult, want.MissingRounds = 6, 1005, 6, 3
+	if refrozen.State != StreamClosed || !refrozen.ClosedAt.Equal(*closed.ClosedAt) || refrozen.EndNonce != 11 {
+		t.Fatalf("expected the stream still closed as before, now ending at 11, got %+v", refrozen)
+	}
+	if !reflect.DeepEqual(*refrozen.Summary, want) {
+		t.Fatalf("expected summary %+v, got %+v", want, refrozen.Summary)
+	}
+	if _, err := st.OpenStream(ctx, "hash-2", "client", "bot-a"); err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	if ls, _ := st.GetStream(ctx, second.ID); ls.State != StreamActive {
+		t.Fatalf("expected the late message to leave the second stream active, got %q", ls.State)
+	}
+
+	// A third pair closes the second, and the chain reads in order
+	third, err := st.OpenStream(ctx, "hash-3", "client", "bot-a")
+	if err != nil || !slices.Equal(third.Closed, []uuid.UUID{second.ID}) {
+		t.Fatalf("expected the third pair to close the second stream, got %+v, %v", third, err)
+	}
+	history, err := st.StreamHistory(ctx, second.ID)
+	if err != nil {
+		t.Fatalf("StreamHistory: %v", err)
+	}
+	var chain []uuid.UUID
+	for _, ls := range history {
+		chain = append(chain, ls.ID)
+	}
+	if !slices.Equal(chain, []uuid.UUID{first.ID, second.ID, third.ID}) {
+		t.Fatalf("expected the chain first, second, third, got %v", chain)
+	}
+}
+
+func TestFindOrCreateStreamClosesDefaultClientStream(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+	a, err := st.FindOrCreateStream(ctx, "hash-1", "client")
+	if err != nil {
+		t.Fatalf("FindOrCreateStream: %v", err)
+	}
+	if _, err := st.OpenStream(ctx, "hash-x", "client", "bot-a"); err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	if ls, _ := st.GetStream(ctx, a); ls.State != StreamActive {
+		t.Fatalf("expected a named client to leave the default client's stream open, got %q", ls.State)
+	}
+	b, err := st.FindOrCreateStream(ctx, "hash-2", "client")
+	if err != nil {
+		t.Fatalf("FindOrCreateStream: %v", err)
+	}
+	first, _ := st.GetStream(ctx, a)
+	second, _ := st.GetStream(ctx, b)
+	if first.State != StreamClosed || second.PredecessorID == nil || *second.PredecessorID != a {
+		t.Fatalf("expected the default client's new pair to close and follow the first, got %q, %v",
+			first.State, second.PredecessorID)
+	}
+}
+
+func TestIngestBatchRefreezesClosedStreams(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+	old, err := st.OpenStream(ctx, "old", "c", "bot")
+	if err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	if _, err := st.OpenStream(ctx, "new", "c", "bot"); err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	closed, _ := st.GetStream(ctx, old.ID)
+	if closed.State != StreamClosed || closed.Summary == nil || closed.Summary.Bets != 0 {
+		t.Fatalf("expected the old stream closed with an empty summary, got %+v", closed)
+	}
+
+	bets := testBets(2, 1)
+	out, err := st.IngestBatch(ctx, []IngestItem{
+		{ServerSeedHashed: "old", ClientSeed: "c", Nonce: 1, Bet: &bets[0], IngestClient: "bot"},
+		{ServerSeedHashed: "old", ClientSeed: "c", Nonce: 2, Bet: &bets[1], IngestClient: "bot"},
+		{ServerSeedHashed: "old", ClientSeed: "c", Nonce: 3, RoundResult: 2, IngestClient: "bot"},
+	})
+	if err != nil {
+		t.Fatalf("IngestBatch: %v", err)
+	}
+	for i, res := range out {
+		if !res.Accepted || res.StreamID != old.ID || len(res.Closed) != 0 {
+			t.Fatalf("item %d: expected it stored on the closed stream, got %+v", i, res)
+		}
+	}
+	ls, _ := st.GetStream(ctx, old.ID)
+	if ls.State != StreamClosed || ls.EndNonce != 3 || ls.Summary == nil || ls.Summary.Bets != 2 || ls.Summary.Rounds != 1 {
+		t.Fatalf("expected the closed stream refrozen at nonce 3 with 2 bets, got %+v (%+v)", ls, ls.Summary)
+	}
+}
+
+func TestIngestBatchRollsBackFailedItems(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+	bet := func(id string, nonce int64) *LiveBet {
+		return &LiveBet{AntebotBetID: id, DateTime: time.Now(), Nonce: nonce, Difficulty: "easy"}
+	}
+	items := []IngestItem{
+		{ServerSeedHashed: "a", ClientSeed: "c", Nonce: 1, Bet: bet("a-1", 1)},
+		{ServerSeedHashed: "a", ClientSeed: "c", Nonce: 1, Bet: bet("a-1", 1)},
+		// Opens stream b, then fails on the bet and rolls the stream back
+		{ServerSeedHashed: "b", ClientSeed: "c", Nonce: 1, Bet: bet("", 1)},
+		{ServerSeedHashed: "b", ClientSeed: "c", Nonce: 2, RoundResult: 3},
+	}
+	out, err := st.IngestBatch(ctx, items)
+	if err != nil {
+		t.Fatalf("IngestBatch: %v", err)
+	}
+	if !out[0].Accepted || out[0].BetID == 0 || out[0].Err != nil {
+		t.Errorf("item 0: expected the bet stored, got %+v", out[0])
+	}
+	if out[1].Accepted || out[1].Reason != "duplicate" || out[1].StreamID != out[0].StreamID {
+		t.Errorf("item 1: expected a duplicate on the same stream, got %+v", out[1])
+	}
+	if out[2].Err == nil || out[2].StreamID != uuid.Nil {
+		t.Errorf("item 2: expected a failure with no stream, got %+v", out[2])
+	}
+	if !out[3].Accepted || out[3].Err != nil || out[3].StreamID == uuid.Nil {
+		t.Fatalf("item 3: expected the round stored, got %+v", out[3])
+	}
+
+	// The heartbeat opened b afresh rather than reusing the rolled back id
+	ls, err := st.GetStream(ctx, out[3].StreamID)
+	if err != nil || ls.ServerSeedHashed != "b" || ls.LastObservedNonce != 2 {
+		t.Fatalf("expected stream b to exist, got %+v, %v", ls, err)
+	}
+	var rounds []int64
+	if err := st.EachRound(ctx, ls.ID, func(r LiveRound) error { rounds = append(rounds, r.Nonce); return nil }); err != nil {
+		t.Fatalf("EachRound: %v", err)
+	}
+	if !slices.Equal(rounds, []int64{2}) {
+		t.Errorf("expected the heartbeat's round on b, got %v", rounds)
+	}
+	if streams, _ := st.ListStreams(ctx, 10, 0); len(streams) != 2 {
+		t.Errorf("expected 2 streams, got %d", len(streams))
+	}
+}
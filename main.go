@@ -155,12 +155,21 @@ func buildLinuxOptions() *linux.Options {
 func main() {
 	log.Printf("Starting WEN? (Go %s)...", runtime.Version())
 
+	// At-rest encryption of server seeds and fallback secrets
+	vault, err := bindings.OpenVault(appDataDir())
+	if err != nil {
+		if os.Getenv(bindings.SeedPassphraseEnv) != "" {
+			log.Fatalf("seed encryption init failed: %v", err)
+		}
+		log.Printf("seed encryption unavailable (storing seeds unencrypted): %v", err)
+	}
+
 	// Existing backend bindings object
-	app := bindings.New()
+	app := bindings.New(vault)
 
 	// Stake account/auth module (multi-account + keyring + connection checks)
 	authDBPath := filepath.Join(appDataDir(), "auth.db")
-	authMod, err := bindings.NewAuthModule(authDBPath, bindings.DefaultFallbackSecretsPath(appDataDir()))
+	authMod, err := bindings.NewAuthModule(authDBPath, bindings.DefaultFallbackSecretsPath(appDataDir()), vault)
 	if err != nil {
 		log.Fatalf("auth module init failed: %v", err)
 	}
@@ -176,6 +185,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("live module init failed: %v", err)
 	}
+	liveMod.SetSealer(vault.Cipher())
+	vault.Register("live seeds", liveMod.ResealSeeds)
+	liveMod.SetReplayApp(app)
 
 	// Initialize script session store
 	scriptDBPath := filepath.Join(appDataDir(), "script_sessions.db")
@@ -183,13 +195,29 @@ func main() {
 		log.Printf("script store init failed (continuing without persistence): %v", err)
 	}
 
+	// Portable archives of runs, live streams and script sessions
+	archiveMod := bindings.NewArchiveModule(
+		bindings.RunsArchive(app),
+		livehttp.ArchiveSection(liveMod),
+		bindings.SessionsArchive(scriptMod),
+	)
+
 	startup := func(ctx context.Context) {
 		// Start existing app
 		app.Startup(ctx)
 		authMod.Startup(ctx)
 		scriptMod.Startup(ctx)
+		archiveMod.Startup(ctx)
 		setAppContext(ctx)
 
+		// Encrypt seeds stored before encryption was enabled, and finish
+		// a key rotation that was interrupted
+		if n, err := vault.Migrate(); err != nil {
+			log.Printf("seed encryption migration failed: %v", err)
+		} else if n > 0 {
+			log.Printf("encrypted %d stored seeds and secrets", n)
+		}
+
 		// Start local HTTP ingest server
 		if err := liveMod.Startup(ctx); err != nil {
 			log.Printf("live ingest server failed to start: %v", err)
@@ -207,6 +235,7 @@ func main() {
 		if err := authMod.Shutdown(); err != nil {
 			log.Printf("auth module shutdown error: %v", err)
 		}
+		app.Shutdown()
 		clearAppContext()
 		log.Println("Application is closing")
 		return false
@@ -249,7 +278,7 @@ func main() {
 		Menu: buildAppMenu(),
 
 		// Bindings
-		Bind: []interface{}{app, liveMod, scriptMod, authMod},
+		Bind: []interface{}{app, liveMod, scriptMod, authMod, archiveMod},
 
 		// Logging
 		LogLevel:           logger.INFO,